@@ -0,0 +1,278 @@
+package stereoscope
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// CapabilitiesSchemaVersion is the version of the BuildCapabilities format, which is only incremented on incompatible
+// changes (new sources, media types, or features are not incompatible changes).
+const CapabilitiesSchemaVersion = 1
+
+const (
+	// FeatureLazyLayers indicates that layers may be indexed on first use (see image.WithLazyLayers).
+	FeatureLazyLayers Feature = "lazy-layers"
+	// FeatureStreamingLayers indicates that layer tars may be streamed instead of cached (see image.WithStreamingLayers).
+	FeatureStreamingLayers Feature = "streaming-layers"
+	// FeatureLayerCache indicates that layer blobs may be shared across images (see image.WithLayerCache).
+	FeatureLayerCache Feature = "layer-cache"
+	// FeatureLayerConcurrency indicates that layers may be read concurrently (see image.WithLayerConcurrency).
+	FeatureLayerConcurrency Feature = "layer-concurrency"
+	// FeaturePathFilters indicates that paths may be excluded from indexing (see image.WithIndexOnlyPaths and
+	// image.WithExclusions).
+	FeaturePathFilters Feature = "path-filters"
+	// FeatureFileDigests indicates that file contents may be digested while indexing (see image.WithFileDigests).
+	FeatureFileDigests Feature = "file-digests"
+	// FeatureXattrs indicates that extended attributes (and file capabilities) are captured from layer tars.
+	FeatureXattrs Feature = "xattrs"
+	// FeatureSkippedEntries indicates that tar entries not indexed as found are reported (see image.Layer.SkippedEntries).
+	FeatureSkippedEntries Feature = "skipped-entries"
+	// FeatureTempWriteHook indicates that temp writes may be observed, vetoed, or redirected (see image.WithTempWriteHook).
+	FeatureTempWriteHook Feature = "temp-write-hook"
+	// FeaturePlatformSelection indicates that an image may be selected from a multi-platform image (see WithPlatform).
+	FeaturePlatformSelection Feature = "platform-selection"
+	// FeatureImageIndex indicates that multi-platform images may be obtained as a whole (see GetImageIndex).
+	FeatureImageIndex Feature = "image-index"
+	// FeatureSingleLayer indicates that a single layer may be obtained by digest (see GetLayer).
+	FeatureSingleLayer Feature = "single-layer"
+	// FeatureImageListing indicates that the images available from a source may be listed (see ListImages).
+	FeatureImageListing Feature = "image-listing"
+	// FeatureVerify indicates that cached image content may be audited (see image.Image.Verify).
+	FeatureVerify Feature = "verify"
+	// FeatureTreeDiff indicates that layers and images may be compared (see image.Layer.Diff and image.Compare).
+	FeatureTreeDiff Feature = "tree-diff"
+	// FeatureSquashedWalk indicates that the squashed tree may be walked with file contents on demand (see
+	// image.Image.SquashedWalk).
+	FeatureSquashedWalk Feature = "squashed-walk"
+	// FeatureLinkFarmExport indicates that the squashed tree may be exported as links (see image.Image.ExportLinkFarm).
+	FeatureLinkFarmExport Feature = "link-farm-export"
+	// FeatureSeekableLayers indicates that eStargz layers may be read by blob range (see image.WithSeekableLayers).
+	FeatureSeekableLayers Feature = "seekable-layers"
+	// FeatureAcquisitionPlan indicates that what reading an image would fetch may be reported up front (see PlanImage).
+	FeatureAcquisitionPlan Feature = "acquisition-plan"
+	// FeatureLayerDigestVerification indicates that layer content may be verified against the recorded digests while
+	// reading (see image.WithLayerDigestPolicy).
+	FeatureLayerDigestVerification Feature = "layer-digest-verification"
+	// FeatureFileSampling indicates that a deterministic sample of files may be taken (see
+	// image.Image.SampleFilesFromSquash).
+	FeatureFileSampling Feature = "file-sampling"
+	// FeatureOrphanCleanup indicates that temp dirs left behind by killed processes may be removed (see
+	// EnableCleanupManifest and CleanupOrphans).
+	FeatureOrphanCleanup Feature = "orphan-cleanup"
+	// FeatureOCILayoutExport indicates that images may be written as an OCI image layout (see
+	// image.Image.WriteOCILayout).
+	FeatureOCILayoutExport Feature = "oci-layout-export"
+	// FeatureDockerArchiveExport indicates that images may be written as a docker archive tarball (see
+	// image.Image.WriteDockerArchive).
+	FeatureDockerArchiveExport Feature = "docker-archive-export"
+	// FeatureLayerTarCache indicates that layer tars and indexes may be cached across images and process runs (see
+	// image.WithLayerTarCache).
+	FeatureLayerTarCache Feature = "layer-tar-cache"
+	// FeatureContentLimits indicates that file contents may be read with per-file and total size caps (see
+	// image.Image.MultipleFileContentsFromSquashWithLimits).
+	FeatureContentLimits Feature = "content-limits"
+	// FeatureConcurrentFileCatalog indicates that file catalogs (and file contents) may be read from multiple goroutines
+	// (see image.FileCatalog).
+	FeatureConcurrentFileCatalog Feature = "concurrent-file-catalog"
+	// FeatureContentTypes indicates that the content type of each file may be sniffed while cataloging (see
+	// image.WithContentTypes).
+	FeatureContentTypes Feature = "content-types"
+	// FeatureContentSearch indicates that file contents may be searched for keywords while cataloging (see
+	// image.WithContentSearch).
+	FeatureContentSearch Feature = "content-search"
+	// FeatureImageHistory indicates that the image config history is mapped to the layers of the image (see
+	// image.Metadata.History).
+	FeatureImageHistory Feature = "image-history"
+	// FeatureFoldedPathLookup indicates that paths may be looked up case insensitively (optionally with unicode
+	// normalization, see filetree.FileTree.FileWithFold).
+	FeatureFoldedPathLookup Feature = "folded-path-lookup"
+	// FeatureTreeSerialization indicates that file trees may be persisted and restored (see filetree.FileTree.Marshal
+	// and image.FileCatalog.Save).
+	FeatureTreeSerialization Feature = "tree-serialization"
+	// FeatureJSONListing indicates that the squashed filesystem may be exported as a stable JSON listing (see
+	// filetree.Listing and image.Image.SquashedListing).
+	FeatureJSONListing Feature = "json-listing"
+	// FeatureWhiteouts indicates that the whiteouts within each layer (and the paths they remove) may be inspected (see
+	// image.Layer.Whiteouts).
+	FeatureWhiteouts Feature = "whiteouts"
+	// FeatureSquashPolicy indicates that squash trees may include deleted files or only consider the top layers (see
+	// image.WithSquashPolicy and image.Image.Squash).
+	FeatureSquashPolicy Feature = "squash-policy"
+	// FeatureSquashedTar indicates that the squashed filesystem may be streamed as a single tar (see
+	// image.Image.SquashedTarReader).
+	FeatureSquashedTar Feature = "squashed-tar"
+	// FeatureSeekableContents indicates that file contents may be read by range (see
+	// image.FileCatalog.OpenSeekableByID).
+	FeatureSeekableContents Feature = "seekable-contents"
+	// FeatureContentRanges indicates that a single range of file contents may be read (see
+	// image.FileCatalog.FileContentsRange).
+	FeatureContentRanges Feature = "content-ranges"
+	// FeatureDecompressedContents indicates that compressed file contents may be decompressed upon read (see
+	// image.WithDecompressedContents).
+	FeatureDecompressedContents Feature = "decompressed-contents"
+	// FeatureNestedArchives indicates that the entries of archives within layers may be indexed (see
+	// image.WithNestedArchives).
+	FeatureNestedArchives Feature = "nested-archives"
+	// FeatureSpecialFiles indicates that devices and FIFOs are represented as such within file trees, with the device
+	// numbers within the file metadata (see file.Type.IsSpecial).
+	FeatureSpecialFiles Feature = "special-files"
+	// FeaturePathPolicy indicates that tar entries with suspicious names may be rejected or quarantined (see
+	// image.WithPathPolicy and image.Layer.SuspiciousEntries).
+	FeaturePathPolicy Feature = "path-policy"
+	// FeatureLinkCycleDiagnostics indicates that link cycles are reported with the chain of links followed (see
+	// filetree.ErrLinkCycle).
+	FeatureLinkCycleDiagnostics Feature = "link-cycle-diagnostics"
+	// FeatureWarningLogs indicates that the logger given to SetLogger receives warnings (see logger.Logger.Warnf).
+	FeatureWarningLogs Feature = "warning-logs"
+	// FeatureProviderErrors indicates that provider failures may be told apart with errors.Is (see
+	// image.ErrImageNotFound, image.ErrDaemonUnavailable, image.ErrUnsupportedMediaType, and image.ErrManifestInvalid).
+	FeatureProviderErrors Feature = "provider-errors"
+	// FeatureRetryPolicy indicates that daemon and registry operations may be retried upon transient failures (see
+	// WithRetryPolicy).
+	FeatureRetryPolicy Feature = "retry-policy"
+	// FeatureDaemonOptions indicates that the daemon to obtain images from may be selected explicitly, including remote
+	// daemons over SSH or TCP with TLS (see WithDaemonOptions).
+	FeatureDaemonOptions Feature = "daemon-options"
+	// FeatureDaemonPullPolicy indicates that when the daemon pulls images (if missing, never, or always), and with which
+	// credentials, may be selected (see docker.DaemonOptions).
+	FeatureDaemonPullPolicy Feature = "daemon-pull-policy"
+	// FeatureDaemonStreaming indicates that images may be read as they are saved from the daemon, without saving the
+	// whole image tar (see docker.DaemonOptions).
+	FeatureDaemonStreaming Feature = "daemon-streaming"
+	// FeatureSourceDetection indicates that a user string without a scheme is provided by the first source that has the
+	// image, in a configurable order (see WithSourceDetectionOrder).
+	FeatureSourceDetection Feature = "source-detection"
+)
+
+// allFeatures are the features of this build (in a stable order).
+var allFeatures = []Feature{
+	FeatureLazyLayers,
+	FeatureStreamingLayers,
+	FeatureLayerCache,
+	FeatureLayerConcurrency,
+	FeaturePathFilters,
+	FeatureFileDigests,
+	FeatureXattrs,
+	FeatureSkippedEntries,
+	FeatureTempWriteHook,
+	FeaturePlatformSelection,
+	FeatureImageIndex,
+	FeatureSingleLayer,
+	FeatureImageListing,
+	FeatureVerify,
+	FeatureTreeDiff,
+	FeatureSquashedWalk,
+	FeatureLinkFarmExport,
+	FeatureSeekableLayers,
+	FeatureAcquisitionPlan,
+	FeatureLayerDigestVerification,
+	FeatureFileSampling,
+	FeatureOrphanCleanup,
+	FeatureOCILayoutExport,
+	FeatureDockerArchiveExport,
+	FeatureLayerTarCache,
+	FeatureContentLimits,
+	FeatureConcurrentFileCatalog,
+	FeatureContentTypes,
+	FeatureContentSearch,
+	FeatureImageHistory,
+	FeatureFoldedPathLookup,
+	FeatureTreeSerialization,
+	FeatureJSONListing,
+	FeatureWhiteouts,
+	FeatureSquashPolicy,
+	FeatureSquashedTar,
+	FeatureSeekableContents,
+	FeatureContentRanges,
+	FeatureDecompressedContents,
+	FeatureNestedArchives,
+	FeatureSpecialFiles,
+	FeaturePathPolicy,
+	FeatureLinkCycleDiagnostics,
+	FeatureWarningLogs,
+	FeatureProviderErrors,
+	FeatureRetryPolicy,
+	FeatureDaemonOptions,
+	FeatureDaemonPullPolicy,
+	FeatureDaemonStreaming,
+	FeatureSourceDetection,
+}
+
+// supportedLayerMediaTypes are the layer media types that can be read (other media types may still be read when the
+// content is a tar, optionally compressed with one of the supported compressions).
+var supportedLayerMediaTypes = []types.MediaType{
+	types.DockerLayer,
+	types.DockerUncompressedLayer,
+	types.OCILayer,
+	types.OCIUncompressedLayer,
+	types.OCIRestrictedLayer,
+	types.OCIUncompressedRestrictedLayer,
+	image.OCIZstdLayerMediaType,
+	image.SquashfsLayerMediaType,
+}
+
+// supportedCompressions are the layer compressions that are handled, either as indicated by the media type or as
+// detected from content (when the media type does not indicate a compression).
+var supportedCompressions = []file.Compression{
+	file.GzipCompression,
+	file.Bzip2Compression,
+	file.XzCompression,
+	file.ZstdCompression,
+}
+
+// Feature is a named capability of the linked build of stereoscope (see Capabilities).
+type Feature string
+
+// BuildCapabilities is a machine-readable description of what the linked build of stereoscope supports, so that tools
+// can detect support at runtime instead of parsing version strings. The JSON field names are stable.
+type BuildCapabilities struct {
+	// SchemaVersion is the version of this format (see CapabilitiesSchemaVersion).
+	SchemaVersion int `json:"schemaVersion"`
+	// SourceSchemes are the schemes of all supported image sources (e.g. "registry" for "registry:alpine:latest").
+	SourceSchemes []string `json:"sourceSchemes"`
+	// LayerMediaTypes are the layer media types that can be read.
+	LayerMediaTypes []string `json:"layerMediaTypes"`
+	// Compressions are the layer content compressions that are detected and handled transparently.
+	Compressions []string `json:"compressions"`
+	// Features are the optional features supported by this build.
+	Features []Feature `json:"features"`
+}
+
+// Capabilities describes the source schemes, layer media types, and features supported by the linked build.
+func Capabilities() BuildCapabilities {
+	capabilities := BuildCapabilities{
+		SchemaVersion: CapabilitiesSchemaVersion,
+		Features:      append([]Feature{}, allFeatures...),
+	}
+	for _, source := range image.AllSources {
+		capabilities.SourceSchemes = append(capabilities.SourceSchemes, source.Scheme())
+	}
+	for _, mediaType := range supportedLayerMediaTypes {
+		capabilities.LayerMediaTypes = append(capabilities.LayerMediaTypes, string(mediaType))
+	}
+	for _, compression := range supportedCompressions {
+		capabilities.Compressions = append(capabilities.Compressions, string(compression))
+	}
+	return capabilities
+}
+
+// HasFeature indicates if the given feature is supported.
+func (c BuildCapabilities) HasFeature(feature Feature) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsSourceScheme indicates if the given source scheme is supported (e.g. "oci-dir").
+func (c BuildCapabilities) SupportsSourceScheme(scheme string) bool {
+	for _, s := range c.SourceSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
@@ -1,67 +1,449 @@
 package stereoscope
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/anchore/stereoscope/internal/bus"
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/containerd"
+	"github.com/anchore/stereoscope/pkg/image/cri"
+	"github.com/anchore/stereoscope/pkg/image/directory"
 	"github.com/anchore/stereoscope/pkg/image/docker"
 	"github.com/anchore/stereoscope/pkg/image/oci"
+	"github.com/anchore/stereoscope/pkg/image/registry"
+	"github.com/anchore/stereoscope/pkg/image/storage"
 	"github.com/anchore/stereoscope/pkg/logger"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/wagoodman/go-partybus"
 )
 
 var tempDirGenerator = file.NewTempDirGenerator()
 
+// defaultTempDir is where all temp dirs are created when not given per call (the platform temp dir when empty, see
+// SetTempDir).
+var defaultTempDir string
+
+// cleanupManifestDir is where temp dirs of this process are recorded (empty when not enabled, see EnableCleanupManifest).
+var cleanupManifestDir string
+
 // GetImage parses the user provided image string and provides an image object
-func GetImage(userStr string) (*image.Image, error) {
-	var provider image.Provider
+func GetImage(userStr string, options ...Option) (*image.Image, error) {
+	return GetImageWithContext(context.Background(), userStr, options...)
+}
+
+// GetImageWithContext is the same as GetImage, however, providing (e.g. pulling or saving) and reading the image is
+// aborted once the given context is done (cancelled or past the deadline).
+func GetImageWithContext(ctx context.Context, userStr string, options ...Option) (*image.Image, error) {
+	cfg, err := newConfig(options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %w", err)
+	}
+
+	// all temp dirs of the image are isolated from other images, so that they can be removed with the image alone
+	tmpDirGen, err := cfg.tempDirGenerator().NewScope()
+	if err != nil {
+		return nil, err
+	}
+
+	provider, img, detection, err := provideImage(ctx, userStr, cfg, tmpDirGen)
+	if err != nil {
+		tmpDirGen.Cleanup()
+		return nil, err
+	}
+
+	readOptions := []image.ReadOption{image.WithProvider(provider), image.WithTempDirs(tmpDirGen)}
+	if detection != nil {
+		readOptions = append(readOptions, image.WithSourceDetection(*detection))
+	}
+	err = img.ReadWithContext(ctx, append(readOptions, cfg.readOptions...)...)
+	if err != nil {
+		tmpDirGen.Cleanup()
+		return nil, fmt.Errorf("could not read image: %w", err)
+	}
+
+	return img, nil
+}
+
+// provideImage provides the image from the first source (of those detected from the given user string) that has the
+// image, also returning how the source was detected (nil when the user string has a scheme). Sources are only skipped
+// when the image is unavailable from the source (the daemon is unavailable or the image is not found).
+func provideImage(ctx context.Context, userStr string, cfg *config, tmpDirGen *file.TempDirGenerator) (image.Provider, *image.Image, *image.SourceDetection, error) {
+	sources, imgStr, err := image.DetectSourceCandidates(userStr, cfg.detectionOrder)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(sources) == 0 {
+		return nil, nil, nil, fmt.Errorf("unable determine image source")
+	}
+
+	var detection *image.SourceDetection
+	if !image.HasSourceScheme(userStr) {
+		detection = &image.SourceDetection{
+			Order: cfg.detectionOrder,
+		}
+		if len(detection.Order) == 0 {
+			detection.Order = image.DefaultSourceDetectionOrder
+		}
+	}
+
+	for idx, source := range sources {
+		provider, err := newSourceProvider(source, imgStr, cfg, tmpDirGen)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		img, err := provider.Provide(ctx)
+		if err == nil {
+			return provider, img, detection, nil
+		}
+		unavailable := errors.Is(err, image.ErrDaemonUnavailable) || errors.Is(err, image.ErrImageNotFound)
+		if detection == nil || idx == len(sources)-1 || !unavailable {
+			return nil, nil, nil, err
+		}
+
+		log.Debugf("image=%q is unavailable from source=%s, trying source=%s: %+v", imgStr, source, sources[idx+1], err)
+		detection.Skipped = append(detection.Skipped, image.SkippedSource{
+			Source: source,
+			Reason: err.Error(),
+		})
+	}
+	return nil, nil, nil, fmt.Errorf("unable determine image source")
+}
+
+// newProvider selects the provider for the image source detected from the given user string.
+func newProvider(userStr string, cfg *config, tmpDirGen *file.TempDirGenerator) (image.Provider, error) {
 	source, imgStr, err := image.DetectSource(userStr)
 	if err != nil {
 		return nil, err
 	}
+	return newSourceProvider(source, imgStr, cfg, tmpDirGen)
+}
 
+// newSourceProvider creates the provider for the given image source.
+func newSourceProvider(source image.Source, imgStr string, cfg *config, tmpDirGen *file.TempDirGenerator) (image.Provider, error) {
 	log.Debugf("image: source=%+v location=%+v", source, imgStr)
 
 	switch source {
 	case image.DockerTarballSource:
 		// note: the imgStr is the path on disk to the tar file
-		provider = docker.NewProviderFromTarball(imgStr, &tempDirGenerator)
+		return docker.NewProviderFromTarball(imgStr, tmpDirGen), nil
 	case image.DockerDaemonSource:
-		provider = docker.NewProviderFromDaemon(imgStr, &tempDirGenerator)
+		provider := docker.NewProviderFromDaemon(imgStr, tmpDirGen, cfg.providerOptions)
+		provider.SetDaemonOptions(cfg.daemonOptions)
+		return provider, nil
 	case image.OciDirectorySource:
-		provider = oci.NewProviderFromPath(imgStr, &tempDirGenerator)
+		return oci.NewProviderFromPath(imgStr, tmpDirGen, cfg.providerOptions), nil
 	case image.OciTarballSource:
-		provider = oci.NewProviderFromTarball(imgStr, &tempDirGenerator)
+		return oci.NewProviderFromTarball(imgStr, tmpDirGen, cfg.providerOptions), nil
+	case image.PodmanDaemonSource:
+		provider := docker.NewProviderFromPodman(imgStr, tmpDirGen, cfg.providerOptions)
+		provider.SetDaemonOptions(cfg.daemonOptions)
+		return provider, nil
+	case image.ContainerdDaemonSource:
+		return containerd.NewProviderFromDaemon(imgStr, tmpDirGen, cfg.providerOptions), nil
+	case image.RegistrySource:
+		return registry.NewProviderFromRegistry(imgStr, tmpDirGen, cfg.providerOptions, cfg.registryOptions), nil
+	case image.DirectorySource:
+		// note: the imgStr is the path on disk to the root filesystem dir
+		return directory.NewProviderFromPath(imgStr, tmpDirGen), nil
+	case image.ContainersStorageSource:
+		// note: the imgStr is the image reference, optionally preceded by the store (e.g. "[/path/to/store]alpine")
+		return storage.NewProviderFromStore(imgStr, tmpDirGen), nil
+	case image.CRISource:
+		return cri.NewProviderFromCRI(imgStr, tmpDirGen, cfg.providerOptions), nil
 	default:
 		return nil, fmt.Errorf("unable determine image source")
 	}
+}
 
-	img, err := provider.Provide()
+// PlanImage resolves the image for the given user string (as GetImage would) and reports which layer blobs reading the
+// image would transfer from the image source versus serve from the layer cache or local disk (see image.WithLayerCache),
+// along with their sizes and the chosen provider, without transferring any layer data. This is useful for pre-flight
+// cost checks (e.g. in CI). Only sources that can resolve the manifest without transferring the image are supported
+// (registry and OCI directory references), since daemon and archive sources must save or unpack the entire image.
+func PlanImage(userStr string, options ...Option) (*image.AcquisitionPlan, error) {
+	return PlanImageWithContext(context.Background(), userStr, options...)
+}
+
+// PlanImageWithContext is the same as PlanImage, however, resolving the manifest is aborted once the given context is
+// done.
+func PlanImageWithContext(ctx context.Context, userStr string, options ...Option) (*image.AcquisitionPlan, error) {
+	cfg, err := newConfig(options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %w", err)
+	}
+
+	source, _, err := image.DetectSource(userStr)
 	if err != nil {
 		return nil, err
 	}
+	if source != image.RegistrySource && source != image.OciDirectorySource {
+		return nil, fmt.Errorf("unable to plan acquisition: source=%s must transfer the entire image", source)
+	}
 
-	err = img.Read()
+	// no layer data is transferred, so all temp dirs are removed once the plan is made
+	tmpDirGen, err := cfg.tempDirGenerator().NewScope()
 	if err != nil {
-		return nil, fmt.Errorf("could not read image: %+v", err)
+		return nil, err
 	}
+	defer tmpDirGen.Cleanup()
 
-	return img, nil
+	provider, err := newProvider(userStr, cfg, tmpDirGen)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := provider.Provide(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := img.Plan(cfg.readOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not plan image acquisition: %w", err)
+	}
+	return plan, nil
+}
+
+// GetLayer pulls a single layer blob by digest from the registry repository of the given image reference (e.g.
+// "alpine:latest" or "registry:alpine:latest", the tag or digest is not considered) and provides a layer object with
+// the layer tree and file catalog built for just that blob. This is useful for scanners that track results per layer
+// (keyed by the layer digest). Only registry references are supported. All temp dirs created for the layer are removed
+// with Layer.Cleanup.
+func GetLayer(imgStr, layerDigest string, options ...Option) (*image.Layer, error) {
+	return GetLayerWithContext(context.Background(), imgStr, layerDigest, options...)
 }
 
+// GetLayerWithContext is the same as GetLayer, however, pulling and reading the layer is aborted once the given
+// context is done.
+func GetLayerWithContext(ctx context.Context, imgStr, layerDigest string, options ...Option) (*image.Layer, error) {
+	cfg, err := newConfig(options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %w", err)
+	}
+
+	imgStr, err = registryReference(imgStr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a single layer: %w", err)
+	}
+
+	// all temp dirs of the layer are isolated from other layers and images, so that they can be removed with the layer
+	tmpDirGen, err := cfg.tempDirGenerator().NewScope()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := registry.NewLayerProviderFromRegistry(imgStr, layerDigest, tmpDirGen, cfg.registryOptions)
+	provider.SetRetryPolicy(cfg.providerOptions.Retry)
+	layer, err := provider.Provide(ctx)
+	if err != nil {
+		tmpDirGen.Cleanup()
+		return nil, fmt.Errorf("could not get layer: %w", err)
+	}
+	layer.SetCleanup(tmpDirGen.Cleanup)
+	return layer, nil
+}
+
+// GetImageIndex fetches the multi-platform image (an image index or manifest list) for the given registry reference
+// (e.g. "alpine:latest" or "registry:alpine:latest") and provides an index object describing the image for each
+// platform. Each image is only pulled (by digest, without resolving the reference again) and read once requested (see
+// image.IndexManifest.Image). Only registry references are supported. All temp dirs created for the index (and the
+// images read from it) are removed with Index.Cleanup.
+func GetImageIndex(imgStr string, options ...Option) (*image.Index, error) {
+	return GetImageIndexWithContext(context.Background(), imgStr, options...)
+}
+
+// GetImageIndexWithContext is the same as GetImageIndex, however, fetching the index is aborted once the given context
+// is done.
+func GetImageIndexWithContext(ctx context.Context, imgStr string, options ...Option) (*image.Index, error) {
+	cfg, err := newConfig(options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %w", err)
+	}
+
+	imgStr, err = registryReference(imgStr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get an image index: %w", err)
+	}
+
+	// all temp dirs of the images read from the index are isolated from other images, so that they can be removed with
+	// the index
+	tmpDirGen, err := cfg.tempDirGenerator().NewScope()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := registry.NewIndexProviderFromRegistry(imgStr, tmpDirGen, cfg.providerOptions, cfg.registryOptions).Provide(ctx, cfg.readOptions...)
+	if err != nil {
+		tmpDirGen.Cleanup()
+		return nil, fmt.Errorf("could not get image index: %w", err)
+	}
+	index.SetCleanup(tmpDirGen.Cleanup)
+	return index, nil
+}
+
+// registryReference strips an optional "registry:" scheme from the given user string, rejecting any other source
+// scheme (only registry references are supported).
+func registryReference(userStr string) (string, error) {
+	candidates := strings.SplitN(userStr, image.SchemeSeparator, 2)
+	if len(candidates) != 2 {
+		return userStr, nil
+	}
+	switch source := image.ParseSourceScheme(candidates[0]); source {
+	case image.RegistrySource:
+		return candidates[1], nil
+	case image.UnknownSource:
+		return userStr, nil
+	default:
+		return "", fmt.Errorf("unsupported source=%s (only registry references are supported)", source)
+	}
+}
+
+// ListImages lists the images available from the given source, so that a user can select an image before calling
+// GetImage. The location is the path to an archive or directory, or the root of a containers-storage store (the store
+// of the current user when empty), and is ignored for daemon sources, which are taken from the environment. An
+// image.ErrListingNotSupported error is returned for sources that cannot list images (e.g. a registry).
+func ListImages(source image.Source, location string) ([]image.ListedImage, error) {
+	return ListImagesWithContext(context.Background(), source, location)
+}
+
+// ListImagesWithContext is the same as ListImages, however, listing the images of a daemon (or CRI runtime) is aborted
+// once the given context is done.
+func ListImagesWithContext(ctx context.Context, source image.Source, location string) ([]image.ListedImage, error) {
+	switch source {
+	case image.DockerTarballSource:
+		return docker.ListTarballImages(location)
+	case image.DockerDaemonSource:
+		return docker.ListDaemonImages(ctx)
+	case image.PodmanDaemonSource:
+		return docker.ListPodmanImages(ctx)
+	case image.ContainerdDaemonSource:
+		return containerd.ListDaemonImages(ctx)
+	case image.CRISource:
+		return cri.ListImages(ctx)
+	case image.OciDirectorySource:
+		return oci.ListDirectoryImages(location)
+	case image.OciTarballSource:
+		return oci.ListTarballImages(location)
+	case image.ContainersStorageSource:
+		return storage.ListImages(location)
+	}
+	return nil, fmt.Errorf("%w: source=%s", image.ErrListingNotSupported, source)
+}
+
+// NewImageFromV1Image reads an image that the caller has already obtained (e.g. with their own registry or daemon
+// client) without fetching it again. Provider-specific options (e.g. registry credentials or a platform) do not apply.
+func NewImageFromV1Image(img v1.Image, options ...Option) (*image.Image, error) {
+	cfg, err := newConfig(options...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %w", err)
+	}
+
+	// all temp dirs of the image are isolated from other images, so that they can be removed with the image alone
+	tmpDirGen, err := cfg.tempDirGenerator().NewScope()
+	if err != nil {
+		return nil, err
+	}
+
+	contentTempDir, err := tmpDirGen.NewTempDir()
+	if err != nil {
+		tmpDirGen.Cleanup()
+		return nil, err
+	}
+
+	var metadata []image.AdditionalMetadata
+
+	// make a best-effort attempt at getting the manifest digest, raw manifest, and raw config
+	if digest, err := img.Digest(); err == nil {
+		metadata = append(metadata, image.WithManifestDigest(digest.String()))
+	} else {
+		log.Debugf("unable to get image manifest digest: %+v", err)
+	}
+	if rawManifest, err := img.RawManifest(); err == nil {
+		metadata = append(metadata, image.WithManifest(rawManifest))
+	} else {
+		log.Debugf("unable to get raw manifest: %+v", err)
+	}
+	if rawConfig, err := img.RawConfigFile(); err == nil {
+		metadata = append(metadata, image.WithConfig(rawConfig))
+	} else {
+		log.Debugf("unable to get raw config: %+v", err)
+	}
+
+	result := image.NewImage(img, contentTempDir, metadata...)
+	if err := result.Read(append([]image.ReadOption{image.WithTempDirs(tmpDirGen)}, cfg.readOptions...)...); err != nil {
+		tmpDirGen.Cleanup()
+		return nil, fmt.Errorf("could not read image: %w", err)
+	}
+
+	return result, nil
+}
+
+// SetLogger sets the logger used by all providers, image reads (e.g. building file catalogs), and cleanup, which is
+// silent by default. A nil logger restores the default.
 func SetLogger(logger logger.Logger) {
-	log.Log = logger
+	log.SetLogger(logger)
 }
 
 func SetBus(b *partybus.Bus) {
 	bus.SetPublisher(b)
 }
 
+// SetTempDir creates all temp dirs (e.g. saved images and layer content cache) within the given existing dir instead of
+// the platform temp dir, unless another dir is given for a single call (see WithTempDir). An empty dir restores the
+// platform temp dir. These are still removed upon Cleanup. This should be called before any images are obtained.
+func SetTempDir(dir string) error {
+	if dir != "" {
+		if err := checkTempDir(dir); err != nil {
+			return err
+		}
+	}
+	defaultTempDir = dir
+	return nil
+}
+
+// Cleanup removes all temp dirs created by this process (for all images, see image.Image.Cleanup for a single image).
 func Cleanup() {
 	if err := tempDirGenerator.Cleanup(); err != nil {
-		log.Errorf("failed to cleanup: %w", err)
+		log.Errorf("failed to cleanup: %+v", err)
+	}
+}
+
+// DefaultCleanupManifestDir is where temp dirs are recorded when tracking is enabled without a dir (see
+// EnableCleanupManifest).
+func DefaultCleanupManifestDir() string {
+	return filepath.Join(os.TempDir(), "stereoscope-manifests")
+}
+
+// EnableCleanupManifest records all temp dirs created by this process (e.g. saved images and layer content caches)
+// within a manifest file in the given dir (DefaultCleanupManifestDir when empty), so that should this process exit
+// without calling Cleanup (e.g. when killed) a later process can remove the leftovers with CleanupOrphans. This should
+// be called before any images are obtained.
+func EnableCleanupManifest(dir string) error {
+	if dir == "" {
+		dir = DefaultCleanupManifestDir()
+	}
+	cleanupManifestDir = dir
+	return tempDirGenerator.TrackWithManifest(dir)
+}
+
+// CleanupOrphans removes all temp dirs left behind by processes that recorded their temp dirs (see
+// EnableCleanupManifest) within the same manifest dir but are no longer running, returning the dirs removed. Temp dirs
+// of running processes (including this one) are never removed.
+func CleanupOrphans() ([]string, error) {
+	dir := cleanupManifestDir
+	if dir == "" {
+		dir = DefaultCleanupManifestDir()
+	}
+	removed, err := file.CleanupOrphanedTempDirs(dir)
+	for _, d := range removed {
+		log.Debugf("removed orphaned temp dir=%q", d)
 	}
+	return removed, err
 }
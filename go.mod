@@ -3,30 +3,41 @@ module github.com/anchore/stereoscope
 go 1.14
 
 require (
+	bazil.org/fuse v0.0.0-20200117225306-7b5117fecadc
 	github.com/Microsoft/hcsshim v0.8.10 // indirect
 	github.com/anchore/go-testutils v0.0.0-20200925183923-d5f45b0d3c04
 	github.com/apex/log v1.3.0
 	github.com/bmatcuk/doublestar/v2 v2.0.4
-	github.com/containerd/containerd v1.3.4 // indirect
+	github.com/containerd/containerd v1.3.4
 	github.com/containerd/continuity v0.0.0-20200710164510-efbc4488d8fe // indirect
 	github.com/docker/cli v0.0.0-20191017083524-a8ff7f821017
+	github.com/docker/distribution v2.8.0+incompatible // indirect
 	github.com/docker/docker v17.12.0-ce-rc1.0.20200309214505-aa6a9891b09c+incompatible
+	github.com/docker/go-events v0.0.0-20190806004212-e31b211e4f1c // indirect
 	github.com/go-test/deep v1.0.7
+	github.com/gogo/googleapis v1.2.0 // indirect
 	github.com/google/go-containerregistry v0.1.0
 	github.com/hashicorp/go-multierror v1.1.0
+	github.com/klauspost/compress v1.10.10
 	github.com/logrusorgru/aurora v0.0.0-20200102142835-e9ef32dff381
 	github.com/mitchellh/go-homedir v1.1.0
-	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
 	github.com/opencontainers/runc v0.1.1 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/scylladb/go-set v1.0.2 // indirect
 	github.com/sergi/go-diff v1.1.0
 	github.com/spf13/afero v1.2.2
 	github.com/stretchr/testify v1.6.0 // indirect
+	github.com/syndtr/gocapability v0.0.0-20180916011248-d98352740cb2 // indirect
+	github.com/ulikunitz/xz v0.5.7
 	github.com/vbatts/tar-split v0.11.1 // indirect
 	github.com/wagoodman/go-partybus v0.0.0-20200526224238-eb215533f07d
 	github.com/wagoodman/go-progress v0.0.0-20200621122631-1a2120f0695a
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/net v0.0.0-20200602114024-627f9648deb9 // indirect
 	golang.org/x/sys v0.0.0-20200602225109-6fdc65e7d980 // indirect
 	google.golang.org/genproto v0.0.0-20200604104852-0b0486081ffb // indirect
+	google.golang.org/grpc v1.29.1
+	k8s.io/cri-api v0.18.6
 )
@@ -19,6 +19,7 @@ type testCase struct {
 	imageMediaType v1Types.MediaType
 	layerMediaType v1Types.MediaType
 	tagCount       int
+	originSource   image.Source
 }
 
 func TestSimpleImage(t *testing.T) {
@@ -26,6 +27,7 @@ func TestSimpleImage(t *testing.T) {
 		{
 			name:           "FromTarball",
 			source:         "docker-archive",
+			originSource:   image.DockerTarballSource,
 			imageMediaType: v1Types.DockerManifestSchema2,
 			layerMediaType: v1Types.DockerLayer,
 			tagCount:       1,
@@ -33,6 +35,7 @@ func TestSimpleImage(t *testing.T) {
 		{
 			name:           "FromDocker",
 			source:         "docker",
+			originSource:   image.DockerDaemonSource,
 			imageMediaType: v1Types.DockerManifestSchema2,
 			layerMediaType: v1Types.DockerLayer,
 			// name:hash
@@ -42,6 +45,7 @@ func TestSimpleImage(t *testing.T) {
 		{
 			name:           "FromOciTarball",
 			source:         "oci-archive",
+			originSource:   image.OciTarballSource,
 			imageMediaType: v1Types.OCIManifestSchema1,
 			layerMediaType: v1Types.OCILayer,
 			tagCount:       0,
@@ -49,6 +53,7 @@ func TestSimpleImage(t *testing.T) {
 		{
 			name:           "FromOciDirectory",
 			source:         "oci-dir",
+			originSource:   image.OciDirectorySource,
 			imageMediaType: v1Types.OCIManifestSchema1,
 			layerMediaType: v1Types.OCILayer,
 			tagCount:       0,
@@ -88,6 +93,16 @@ func assertImageSimpleMetadata(t *testing.T, i *image.Image, expectedValues test
 		}
 	}
 
+	if i.Metadata.Origin.Source != expectedValues.originSource {
+		t.Errorf("unexpected origin source: %+v", i.Metadata.Origin.Source)
+	}
+	if i.Metadata.Origin.Location == "" {
+		t.Errorf("expected an origin location")
+	}
+	if i.Metadata.Origin.AcquisitionStarted.IsZero() || i.Metadata.Origin.AcquisitionCompleted.Before(i.Metadata.Origin.AcquisitionStarted) {
+		t.Errorf("unexpected origin acquisition times: %+v", i.Metadata.Origin)
+	}
+
 	expected := []image.LayerMetadata{
 		{
 			Index:     0,
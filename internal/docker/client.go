@@ -1,8 +1,10 @@
 package docker
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -12,55 +14,100 @@ import (
 	"github.com/docker/docker/client"
 )
 
-var instanceErr error
-var instance *client.Client
-var once sync.Once
+// Config selects the daemon to connect to, where anything not provided is taken from the environment (DOCKER_HOST,
+// DOCKER_CERT_PATH, and DOCKER_TLS_VERIFY).
+type Config struct {
+	// Host is the daemon endpoint (e.g. "unix:///var/run/docker.sock", "tcp://host:2376", "ssh://user@host", or
+	// "npipe:////./pipe/docker_engine").
+	Host string
+	// CertPath is the directory with the TLS certificates to connect with (ca.pem, cert.pem, and key.pem).
+	CertPath string
+}
+
+var clientsLock sync.Mutex
+var clients = make(map[Config]*client.Client)
 
+// GetClient returns the client for the daemon selected by the environment.
 func GetClient() (*client.Client, error) {
-	once.Do(func() {
-		var clientOpts = []client.Opt{
-			client.FromEnv,
-			client.WithAPIVersionNegotiation(),
-		}
+	return GetClientWithConfig(Config{})
+}
 
-		host := os.Getenv("DOCKER_HOST")
+// GetClientWithConfig returns the client for the daemon selected by the given config (reusing the client for the same
+// config).
+func GetClientWithConfig(cfg Config) (*client.Client, error) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
 
-		if strings.HasPrefix(host, "ssh") {
-			helper, err := connhelper.GetConnectionHelper(host)
-			if err != nil {
-				log.Errorf("failed to fetch docker connection helper: %w", err)
-				instanceErr = err
-				return
-			}
-			clientOpts = append(clientOpts, func(c *client.Client) error {
-				httpClient := &http.Client{
-					Transport: &http.Transport{
-						DialContext: helper.Dialer,
-					},
-				}
-				return client.WithHTTPClient(httpClient)(c)
-			})
-			clientOpts = append(clientOpts, client.WithHost(helper.Host))
-			clientOpts = append(clientOpts, client.WithDialContext(helper.Dialer))
-		}
+	if c, ok := clients[cfg]; ok {
+		return c, nil
+	}
 
-		if os.Getenv("DOCKER_TLS_VERIFY") != "" && os.Getenv("DOCKER_CERT_PATH") == "" {
-			err := os.Setenv("DOCKER_CERT_PATH", "~/.docker")
-			if err != nil {
-				log.Errorf("failed create docker client: %w", err)
-				instanceErr = err
-				return
-			}
-		}
-		dockerClient, err := client.NewClientWithOpts(clientOpts...)
+	c, err := newClient(cfg)
+	if err != nil {
+		log.Errorf("failed create docker client: %+v", err)
+		return nil, err
+	}
+	clients[cfg] = c
+	return c, nil
+}
+
+func newClient(cfg Config) (*client.Client, error) {
+	var clientOpts = []client.Opt{
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+	}
+
+	host := cfg.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+
+	if strings.HasPrefix(host, "ssh") {
+		helper, err := connhelper.GetConnectionHelper(host)
 		if err != nil {
-			log.Errorf("failed create docker client: %w", err)
-			instanceErr = err
-			return
+			return nil, fmt.Errorf("failed to fetch docker connection helper: %w", err)
 		}
+		clientOpts = append(clientOpts, func(c *client.Client) error {
+			httpClient := &http.Client{
+				Transport: &http.Transport{
+					DialContext: helper.Dialer,
+				},
+			}
+			return client.WithHTTPClient(httpClient)(c)
+		})
+		clientOpts = append(clientOpts, client.WithHost(helper.Host))
+		clientOpts = append(clientOpts, client.WithDialContext(helper.Dialer))
+		return client.NewClientWithOpts(clientOpts...)
+	}
+
+	// note: the TLS config must be set before the host (which configures the transport for the host protocol)
+	if certPath := tlsCertPath(cfg); certPath != "" {
+		clientOpts = append(clientOpts, client.WithTLSClientConfig(
+			filepath.Join(certPath, "ca.pem"),
+			filepath.Join(certPath, "cert.pem"),
+			filepath.Join(certPath, "key.pem"),
+		))
+	}
+	if cfg.Host != "" {
+		clientOpts = append(clientOpts, client.WithHost(cfg.Host))
+	}
 
-		instance = dockerClient
-	})
+	return client.NewClientWithOpts(clientOpts...)
+}
 
-	return instance, instanceErr
+// tlsCertPath is the directory with the TLS certificates to use beyond what the environment already provides (empty
+// when there is nothing to add), defaulting to ~/.docker when DOCKER_TLS_VERIFY is set without DOCKER_CERT_PATH (as
+// with the docker CLI).
+func tlsCertPath(cfg Config) string {
+	if cfg.CertPath != "" {
+		return cfg.CertPath
+	}
+	if os.Getenv("DOCKER_TLS_VERIFY") == "" || os.Getenv("DOCKER_CERT_PATH") != "" {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
 }
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+	original, existed := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("could not set env: %+v", err)
+	}
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(key, original)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestTLSCertPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("could not get home dir: %+v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		tlsVerify string
+		certPath  string
+		expected  string
+	}{
+		{
+			name: "no TLS",
+		},
+		{
+			name:     "explicit cert path",
+			cfg:      Config{CertPath: "/certs"},
+			expected: "/certs",
+		},
+		{
+			name:      "explicit cert path overrides the environment",
+			cfg:       Config{CertPath: "/certs"},
+			tlsVerify: "1",
+			certPath:  "/env/certs",
+			expected:  "/certs",
+		},
+		{
+			name:      "environment cert path (already used by the client)",
+			tlsVerify: "1",
+			certPath:  "/env/certs",
+		},
+		{
+			name:      "default cert path",
+			tlsVerify: "1",
+			expected:  filepath.Join(home, ".docker"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, "DOCKER_TLS_VERIFY", test.tlsVerify)
+			setEnv(t, "DOCKER_CERT_PATH", test.certPath)
+
+			if actual := tlsCertPath(test.cfg); actual != test.expected {
+				t.Errorf("unexpected cert path: %q != %q", actual, test.expected)
+			}
+		})
+	}
+}
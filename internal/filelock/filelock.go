@@ -0,0 +1,61 @@
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked indicates that a lock file is held by another process (or that this cannot be determined, see TryAcquire).
+var ErrLocked = errors.New("lock file is held")
+
+// Lock is an exclusive advisory lock on a lock file, used to coordinate access to files that are shared by multiple
+// processes (e.g. a cache dir shared by several CI jobs on the same host). The lock is released if the process exits.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire blocks until an exclusive lock is held on the given lock file (which is created if it does not exist). Note:
+// lock files are never removed, since removing a lock file that another process is waiting on is not safe.
+func Acquire(path string) (*Lock, error) {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file=%q: %w", path, err)
+	}
+
+	if err := lock(fh); err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("unable to acquire lock file=%q: %w", path, err)
+	}
+
+	return &Lock{file: fh}, nil
+}
+
+// TryAcquire is the same as Acquire, however, an ErrLocked error is returned instead of waiting when the lock is already
+// held. Note: on platforms without advisory locks it cannot be determined if a lock is held, so ErrLocked is always
+// returned.
+func TryAcquire(path string) (*Lock, error) {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file=%q: %w", path, err)
+	}
+
+	if err := tryLock(fh); err != nil {
+		fh.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to acquire lock file=%q: %w", path, err)
+	}
+
+	return &Lock{file: fh}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("unable to release lock file=%q: %w", l.file.Name(), err)
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package filelock
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-filelock-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "some.lock")
+
+	first, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("could not acquire lock: %+v", err)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		second, err := Acquire(path)
+		if err != nil {
+			t.Errorf("could not acquire lock: %+v", err)
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("could not release lock: %+v", err)
+	}
+
+	select {
+	case second := <-acquired:
+		if second != nil {
+			if err := second.Release(); err != nil {
+				t.Fatalf("could not release lock: %+v", err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("lock not acquired after release")
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-filelock-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "some.lock")
+
+	first, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("could not acquire lock: %+v", err)
+	}
+
+	if _, err := TryAcquire(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the lock to be held, got: %+v", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("could not release lock: %+v", err)
+	}
+
+	second, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("could not acquire lock after release: %+v", err)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatalf("could not release lock: %+v", err)
+	}
+}
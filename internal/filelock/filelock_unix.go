@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+func lock(fh *os.File) error {
+	return syscall.Flock(int(fh.Fd()), syscall.LOCK_EX)
+}
+
+func unlock(fh *os.File) error {
+	return syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+}
+
+func tryLock(fh *os.File) error {
+	err := syscall.Flock(int(fh.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+	return err
+}
@@ -4,10 +4,22 @@ import "github.com/anchore/stereoscope/pkg/logger"
 
 var Log logger.Logger = &nopLogger{}
 
+// SetLogger replaces the logger used throughout the library (a nil logger silences all logging).
+func SetLogger(l logger.Logger) {
+	if l == nil {
+		l = &nopLogger{}
+	}
+	Log = l
+}
+
 func Errorf(format string, args ...interface{}) {
 	Log.Errorf(format, args...)
 }
 
+func Warnf(format string, args ...interface{}) {
+	Log.Warnf(format, args...)
+}
+
 func Infof(format string, args ...interface{}) {
 	Log.Infof(format, args...)
 }
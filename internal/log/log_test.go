@@ -0,0 +1,48 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+)
+
+type recordingLogger struct {
+	nopLogger
+	entries []string
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.entries = append(l.entries, "warn: "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.entries = append(l.entries, "error: "+fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	original := Log
+	defer func() { Log = original }()
+
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+
+	Warnf("layer=%q: %s", "sha256:abc", "something odd")
+	Errorf("failed: %+v", fmt.Errorf("boom"))
+	Debugf("not recorded")
+
+	expected := []string{`warn: layer="sha256:abc": something odd`, "error: failed: boom"}
+	if len(recorder.entries) != len(expected) {
+		t.Fatalf("unexpected entries: %+v", recorder.entries)
+	}
+	for idx, entry := range expected {
+		if recorder.entries[idx] != entry {
+			t.Errorf("unexpected entry: %q != %q", recorder.entries[idx], entry)
+		}
+	}
+
+	// a nil logger restores the default (silent) logger
+	SetLogger(nil)
+	if _, ok := Log.(*nopLogger); !ok {
+		t.Errorf("expected the default logger, got: %T", Log)
+	}
+	Warnf("must not panic")
+}
@@ -0,0 +1,95 @@
+package podman
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// rootfulSocket is the podman API socket for the system service.
+	rootfulSocket = "/run/podman/podman.sock"
+	// rootlessSocket is the podman API socket for the user service (relative to XDG_RUNTIME_DIR).
+	rootlessSocket = "podman/podman.sock"
+)
+
+var instanceErr error
+var instance *client.Client
+var once sync.Once
+
+// GetClient returns a client for the docker-compatible API served by podman. The CONTAINER_HOST environment variable
+// selects the API location (as with the podman CLI), otherwise the rootless socket for the current user is preferred
+// over the rootful socket.
+func GetClient() (*client.Client, error) {
+	once.Do(func() {
+		host, err := apiHost()
+		if err != nil {
+			instanceErr = err
+			return
+		}
+
+		var clientOpts = []client.Opt{
+			client.WithAPIVersionNegotiation(),
+		}
+
+		if strings.HasPrefix(host, "ssh") {
+			helper, err := connhelper.GetConnectionHelper(host)
+			if err != nil {
+				log.Errorf("failed to fetch podman connection helper: %+v", err)
+				instanceErr = err
+				return
+			}
+			clientOpts = append(clientOpts, func(c *client.Client) error {
+				httpClient := &http.Client{
+					Transport: &http.Transport{
+						DialContext: helper.Dialer,
+					},
+				}
+				return client.WithHTTPClient(httpClient)(c)
+			})
+			clientOpts = append(clientOpts, client.WithHost(helper.Host))
+			clientOpts = append(clientOpts, client.WithDialContext(helper.Dialer))
+		} else {
+			clientOpts = append(clientOpts, client.WithHost(host))
+		}
+
+		podmanClient, err := client.NewClientWithOpts(clientOpts...)
+		if err != nil {
+			log.Errorf("failed create podman client: %+v", err)
+			instanceErr = err
+			return
+		}
+
+		instance = podmanClient
+	})
+
+	return instance, instanceErr
+}
+
+// apiHost determines where the podman API is served from.
+func apiHost() (string, error) {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host, nil
+	}
+
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, rootlessSocket))
+	}
+	candidates = append(candidates, rootfulSocket)
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return "unix://" + candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to find the podman API socket (tried %s): is the podman service running (e.g. 'systemctl --user start podman.socket')?", strings.Join(candidates, ", "))
+}
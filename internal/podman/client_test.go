@@ -0,0 +1,64 @@
+package podman
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+	original, existed := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("could not set env: %+v", err)
+	}
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(key, original)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestAPIHost(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "stereoscope-podman-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(runtimeDir)
+
+	// explicit hosts always take precedence
+	setEnv(t, "CONTAINER_HOST", "ssh://user@host/run/podman/podman.sock")
+	host, err := apiHost()
+	if err != nil || host != "ssh://user@host/run/podman/podman.sock" {
+		t.Errorf("unexpected host=%q err=%+v", host, err)
+	}
+
+	// the rootless socket is used when present
+	setEnv(t, "CONTAINER_HOST", "")
+	setEnv(t, "XDG_RUNTIME_DIR", runtimeDir)
+	socket := filepath.Join(runtimeDir, rootlessSocket)
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		t.Fatalf("could not create socket dir: %+v", err)
+	}
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatalf("could not create socket: %+v", err)
+	}
+	host, err = apiHost()
+	if err != nil || host != "unix://"+socket {
+		t.Errorf("unexpected host=%q err=%+v", host, err)
+	}
+
+	// a helpful error is raised when there is no socket
+	if _, err := os.Stat(rootfulSocket); err == nil {
+		t.Skip("rootful podman socket exists on this host")
+	}
+	if err := os.Remove(socket); err != nil {
+		t.Fatalf("could not remove socket: %+v", err)
+	}
+	if _, err = apiHost(); err == nil {
+		t.Errorf("expected an error when there is no socket")
+	}
+}
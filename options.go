@@ -0,0 +1,148 @@
+package stereoscope
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/docker"
+	"github.com/anchore/stereoscope/pkg/image/registry"
+)
+
+// Option is a functional option that tailors how GetImage provides and reads an image.
+type Option func(*config) error
+
+// config is the set of all user-provided options for a single GetImage request.
+type config struct {
+	readOptions     []image.ReadOption
+	registryOptions registry.Options
+	daemonOptions   docker.DaemonOptions
+	providerOptions image.ProviderOptions
+	tempDir         string
+	detectionOrder  []image.Source
+}
+
+// WithReadOptions passes the given options to image.Read(), tailoring how the image is indexed.
+func WithReadOptions(options ...image.ReadOption) Option {
+	return func(c *config) error {
+		c.readOptions = append(c.readOptions, options...)
+		return nil
+	}
+}
+
+// WithRegistryOptions tailors how images are pulled from a registry (e.g. credentials), which only applies to the
+// registry source.
+func WithRegistryOptions(options registry.Options) Option {
+	return func(c *config) error {
+		c.registryOptions = options
+		return nil
+	}
+}
+
+// WithRegistryAuth adds credentials for pulling images from a registry (see registry.Credentials for how credentials are
+// matched to a registry), which only applies to the registry source.
+func WithRegistryAuth(credentials ...registry.Credentials) Option {
+	return func(c *config) error {
+		c.registryOptions.Credentials = append(c.registryOptions.Credentials, credentials...)
+		return nil
+	}
+}
+
+// WithDaemonOptions selects the daemon to obtain images from (e.g. a remote daemon over SSH or TCP with TLS) instead of
+// the daemon selected by the environment (DOCKER_HOST), and when the daemon pulls images (by default, only images
+// missing from the daemon), which only applies to the docker and podman sources.
+func WithDaemonOptions(options docker.DaemonOptions) Option {
+	return func(c *config) error {
+		c.daemonOptions = options
+		return nil
+	}
+}
+
+// WithTempDir creates all temp dirs (e.g. saved images and layer content cache) within the given existing dir instead of
+// the platform temp dir. These are still removed upon Cleanup.
+func WithTempDir(dir string) Option {
+	return func(c *config) error {
+		if err := checkTempDir(dir); err != nil {
+			return err
+		}
+		c.tempDir = dir
+		return nil
+	}
+}
+
+func checkTempDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid temp dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid temp dir: %q is not a directory", dir)
+	}
+	return nil
+}
+
+// tempDirGenerator provides the generator for all temp dirs created for a single call (within the dir given by
+// WithTempDir, otherwise by SetTempDir).
+func (c *config) tempDirGenerator() *file.TempDirGenerator {
+	dir := c.tempDir
+	if dir == "" {
+		dir = defaultTempDir
+	}
+	if dir == "" {
+		return &tempDirGenerator
+	}
+	return tempDirGenerator.WithRoot(dir)
+}
+
+// WithoutSquash skips creating the squash trees when reading the image (see image.WithoutSquash).
+func WithoutSquash() Option {
+	return WithReadOptions(image.WithoutSquash())
+}
+
+// WithPlatform selects which image to use when the user string refers to a multi-platform image (e.g. "linux/arm64"
+// or "linux/arm/v7"). By default the host platform is selected.
+func WithPlatform(platform string) Option {
+	return func(c *config) error {
+		p, err := image.NewPlatform(platform)
+		if err != nil {
+			return fmt.Errorf("invalid platform: %w", err)
+		}
+		c.providerOptions.Platform = &p
+		return nil
+	}
+}
+
+// WithRetryPolicy retries daemon and registry operations upon transient failures (e.g. a busy daemon, registry rate
+// limiting and server errors, or network resets) per the given policy (see image.DefaultRetryPolicy). By default
+// operations are never retried.
+func WithRetryPolicy(policy image.RetryPolicy) Option {
+	return func(c *config) error {
+		c.providerOptions.Retry = policy
+		return nil
+	}
+}
+
+// WithSourceDetectionOrder sets the order sources are considered in for a user string without a scheme (see
+// image.DefaultSourceDetectionOrder), where each source is attempted in turn until one provides the image (e.g. when
+// the daemon is not running, the next source is attempted). The detection is reported within the image origin.
+func WithSourceDetectionOrder(sources ...image.Source) Option {
+	return func(c *config) error {
+		if err := image.CheckSourceDetectionOrder(sources); err != nil {
+			return fmt.Errorf("invalid source detection order: %w", err)
+		}
+		c.detectionOrder = sources
+		return nil
+	}
+}
+
+// newConfig applies all user-provided options to a new config.
+func newConfig(options ...Option) (*config, error) {
+	var c config
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
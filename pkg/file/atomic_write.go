@@ -0,0 +1,40 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes a file by providing the given write function a temp file within the same dir as the given path,
+// which is renamed to the given path only once the write function succeeds. Other readers (including other processes)
+// either observe the previous file or the complete new file, never a partially written file.
+func WriteFileAtomic(path string, write func(io.Writer) error) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".partial-")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file for path=%q: %w", path, err)
+	}
+	tempPath := tempFile.Name()
+
+	cleanup := func(err error) error {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := write(tempFile); err != nil {
+		return cleanup(err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return cleanup(fmt.Errorf("unable to sync temp file for path=%q: %w", path, err))
+	}
+	if err := tempFile.Close(); err != nil {
+		return cleanup(fmt.Errorf("unable to close temp file for path=%q: %w", path, err))
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return cleanup(fmt.Errorf("unable to move temp file to path=%q: %w", path, err))
+	}
+	return nil
+}
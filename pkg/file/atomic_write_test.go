@@ -0,0 +1,64 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-atomic-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "some-file")
+	if err := ioutil.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+
+	// a failed write leaves the original file untouched (and no temp files behind)
+	expectedErr := errors.New("failed")
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return expectedErr
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected the write error, got: %+v", err)
+	}
+	assertFileContents(t, path, "original")
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("could not read dir: %+v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the original file, found %d entries", len(entries))
+	}
+
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("replaced"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+	assertFileContents(t, path, "replaced")
+}
+
+func assertFileContents(t *testing.T, path, expected string) {
+	t.Helper()
+	actual, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read file: %+v", err)
+	}
+	if string(actual) != expected {
+		t.Errorf("unexpected contents: %q != %q", string(actual), expected)
+	}
+}
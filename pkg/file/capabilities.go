@@ -0,0 +1,119 @@
+package file
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// CapabilityXattr is the name of the extended attribute holding the file capabilities (as set by setcap).
+const CapabilityXattr = "security.capability"
+
+const (
+	capabilityRevisionMask = 0xFF000000
+	capabilityEffective    = 0x000001
+	capabilityRevision1    = 0x01000000
+	capabilityRevision2    = 0x02000000
+	capabilityRevision3    = 0x03000000
+)
+
+// capabilityNames are the names of all known capabilities, indexed by capability number (see capability.h).
+var capabilityNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID",
+	"CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN",
+	"CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE", "CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+// Capabilities are the file capabilities decoded from the security.capability extended attribute.
+type Capabilities struct {
+	// Effective indicates that all permitted capabilities are raised in the effective set upon exec.
+	Effective bool
+	// Permitted is the bit set of capabilities permitted upon exec (bit N is capability number N).
+	Permitted uint64
+	// Inheritable is the bit set of capabilities inherited from the calling process upon exec.
+	Inheritable uint64
+	// RootID is the user namespace root ID the capabilities apply to (only for namespaced capabilities, zero otherwise).
+	RootID uint32
+}
+
+// Capabilities decodes the file capabilities of the file (from the security.capability extended attribute), returning
+// false if the file has no capabilities.
+func (m Metadata) Capabilities() (Capabilities, bool, error) {
+	value, ok := m.Xattrs[CapabilityXattr]
+	if !ok {
+		return Capabilities{}, false, nil
+	}
+	capabilities, err := ParseCapabilities([]byte(value))
+	if err != nil {
+		return Capabilities{}, true, err
+	}
+	return capabilities, true, nil
+}
+
+// ParseCapabilities decodes the raw value of the security.capability extended attribute (a vfs_cap_data structure
+// of any revision).
+func ParseCapabilities(raw []byte) (Capabilities, error) {
+	if len(raw) < 4 {
+		return Capabilities{}, fmt.Errorf("invalid capability data: too short (%d bytes)", len(raw))
+	}
+	magic := binary.LittleEndian.Uint32(raw)
+
+	var expectedSize, words int
+	switch magic & capabilityRevisionMask {
+	case capabilityRevision1:
+		expectedSize, words = 12, 1
+	case capabilityRevision2:
+		expectedSize, words = 20, 2
+	case capabilityRevision3:
+		expectedSize, words = 24, 2
+	default:
+		return Capabilities{}, fmt.Errorf("invalid capability data: unknown revision=%#x", magic&capabilityRevisionMask)
+	}
+	if len(raw) != expectedSize {
+		return Capabilities{}, fmt.Errorf("invalid capability data: unexpected size=%d for revision=%#x", len(raw), magic&capabilityRevisionMask)
+	}
+
+	capabilities := Capabilities{
+		Effective: magic&capabilityEffective != 0,
+	}
+	for word := 0; word < words; word++ {
+		offset := 4 + word*8
+		capabilities.Permitted |= uint64(binary.LittleEndian.Uint32(raw[offset:])) << (32 * word)
+		capabilities.Inheritable |= uint64(binary.LittleEndian.Uint32(raw[offset+4:])) << (32 * word)
+	}
+	if magic&capabilityRevisionMask == capabilityRevision3 {
+		capabilities.RootID = binary.LittleEndian.Uint32(raw[20:])
+	}
+	return capabilities, nil
+}
+
+// PermittedNames returns the names of all permitted capabilities (e.g. "CAP_NET_RAW").
+func (c Capabilities) PermittedNames() []string {
+	return capabilitySetNames(c.Permitted)
+}
+
+// InheritableNames returns the names of all inheritable capabilities.
+func (c Capabilities) InheritableNames() []string {
+	return capabilitySetNames(c.Inheritable)
+}
+
+// capabilitySetNames returns the names of all capabilities within the given bit set (unknown capabilities are named
+// by number, e.g. "CAP_63").
+func capabilitySetNames(set uint64) []string {
+	var names []string
+	for bit := 0; bit < 64; bit++ {
+		if set&(1<<uint(bit)) == 0 {
+			continue
+		}
+		if bit < len(capabilityNames) {
+			names = append(names, capabilityNames[bit])
+		} else {
+			names = append(names, "CAP_"+strconv.Itoa(bit))
+		}
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package file
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// capabilityData encodes a vfs_cap_data structure with the given magic and 32-bit words.
+func capabilityData(magic uint32, words ...uint32) []byte {
+	raw := make([]byte, 4*(len(words)+1))
+	binary.LittleEndian.PutUint32(raw, magic)
+	for idx, word := range words {
+		binary.LittleEndian.PutUint32(raw[4*(idx+1):], word)
+	}
+	return raw
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected Capabilities
+		names    []string
+		wantErr  bool
+	}{
+		{
+			name:     "revision 1",
+			raw:      capabilityData(capabilityRevision1, 1<<13, 0),
+			expected: Capabilities{Permitted: 1 << 13},
+			names:    []string{"CAP_NET_RAW"},
+		},
+		{
+			name:     "revision 2 (effective)",
+			raw:      capabilityData(capabilityRevision2|capabilityEffective, 1<<10|1<<13, 1<<0, 1<<7, 0),
+			expected: Capabilities{Effective: true, Permitted: 1<<10 | 1<<13 | 1<<39, Inheritable: 1},
+			names:    []string{"CAP_NET_BIND_SERVICE", "CAP_NET_RAW", "CAP_BPF"},
+		},
+		{
+			name:     "revision 3",
+			raw:      capabilityData(capabilityRevision3, 1<<21, 0, 0, 0, 1000),
+			expected: Capabilities{Permitted: 1 << 21, RootID: 1000},
+			names:    []string{"CAP_SYS_ADMIN"},
+		},
+		{
+			name:    "unknown revision",
+			raw:     capabilityData(0x04000000, 0, 0),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			raw:     capabilityData(capabilityRevision2, 0, 0)[:10],
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseCapabilities(test.raw)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not parse capabilities: %+v", err)
+			}
+			for _, d := range deep.Equal(actual, test.expected) {
+				t.Errorf("unexpected capabilities: %s", d)
+			}
+			for _, d := range deep.Equal(actual.PermittedNames(), test.names) {
+				t.Errorf("unexpected names: %s", d)
+			}
+		})
+	}
+}
+
+func TestMetadata_Capabilities(t *testing.T) {
+	if _, ok, err := (Metadata{}).Capabilities(); ok || err != nil {
+		t.Errorf("expected no capabilities: ok=%v err=%+v", ok, err)
+	}
+
+	m := Metadata{Xattrs: map[string]string{CapabilityXattr: string(capabilityData(capabilityRevision2, 1<<13, 0, 0, 0))}}
+	capabilities, ok, err := m.Capabilities()
+	if !ok || err != nil {
+		t.Fatalf("expected capabilities: ok=%v err=%+v", ok, err)
+	}
+	if capabilities.Permitted != 1<<13 {
+		t.Errorf("unexpected capabilities: %+v", capabilities)
+	}
+}
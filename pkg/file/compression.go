@@ -0,0 +1,172 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	NoCompression    Compression = ""
+	GzipCompression  Compression = "gzip"
+	Bzip2Compression Compression = "bzip2"
+	XzCompression    Compression = "xz"
+	ZstdCompression  Compression = "zstd"
+)
+
+// compressionHeaderSize is the number of leading bytes inspected to detect the compression of a stream (a tar block,
+// see tarMagicOffset).
+const compressionHeaderSize = 512
+
+// tarMagicOffset is the offset of the "ustar" magic within a tar header. A stream that starts with a tar header is
+// never compressed, regardless of what the first entry name looks like.
+const tarMagicOffset = 257
+
+// compressionMagic maps the leading bytes of a stream to the compression algorithm that produced it. Each magic is
+// as long as the format allows, since uncompressed content (e.g. a tar entry name) may start with a short magic.
+var compressionMagic = []struct {
+	matches     func(header []byte) bool
+	compression Compression
+}{
+	{
+		// the gzip magic followed by the deflate method (the only method defined)
+		matches:     hasPrefix([]byte{0x1f, 0x8b, 0x08}),
+		compression: GzipCompression,
+	},
+	{
+		matches:     isBzip2Header,
+		compression: Bzip2Compression,
+	},
+	{
+		matches:     hasPrefix([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}),
+		compression: XzCompression,
+	},
+	{
+		matches:     hasPrefix([]byte{0x28, 0xb5, 0x2f, 0xfd}),
+		compression: ZstdCompression,
+	},
+}
+
+// bzip2 block and end of stream magic (following the "BZh" magic and the block size)
+var (
+	bzip2BlockMagic       = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndOfStreamMagic = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+func hasPrefix(magic []byte) func([]byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(header, magic)
+	}
+}
+
+// isBzip2Header indicates that the header is the "BZh" magic, followed by a block size of 1-9 and then either the first
+// block or the end of an empty stream (so text that merely starts with "BZh" is not mistaken for bzip2).
+func isBzip2Header(header []byte) bool {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("BZh")) {
+		return false
+	}
+	if header[3] < '1' || header[3] > '9' {
+		return false
+	}
+	return bytes.Equal(header[4:10], bzip2BlockMagic) || bytes.Equal(header[4:10], bzip2EndOfStreamMagic)
+}
+
+// IsTarHeader indicates that the header (the leading bytes of a stream) is a (ustar, pax, or GNU) tar header.
+func IsTarHeader(header []byte) bool {
+	return len(header) >= tarMagicOffset+5 && bytes.Equal(header[tarMagicOffset:tarMagicOffset+5], []byte("ustar"))
+}
+
+// Compression is the compression algorithm detected for a stream of bytes.
+type Compression string
+
+// readCloser pairs a (potentially decompressing) reader with the closer of the original source.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// zstdReadCloser releases the zstd decoder before closing the original source.
+type zstdReadCloser struct {
+	*zstd.Decoder
+	source io.Closer
+}
+
+func (r *zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return r.source.Close()
+}
+
+// DetectCompression reports the compression algorithm used for the given stream based on magic bytes. The returned
+// reader must be used in place of the given reader since the leading bytes have been consumed for inspection.
+func DetectCompression(reader io.Reader) (Compression, io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	// note: a short read (e.g. an empty stream) is not an error, there simply is no compression to detect
+	header, err := buffered.Peek(compressionHeaderSize)
+	if err != nil && err != io.EOF {
+		return NoCompression, buffered, fmt.Errorf("unable to inspect stream header: %w", err)
+	}
+
+	if IsTarHeader(header) {
+		return NoCompression, buffered, nil
+	}
+	for _, candidate := range compressionMagic {
+		if candidate.matches(header) {
+			return candidate.compression, buffered, nil
+		}
+	}
+	return NoCompression, buffered, nil
+}
+
+// NewDecompressedReadCloser detects the compression of the given stream and transparently decompresses the contents.
+// The detected compression is returned so that callers can record unexpected encodings. Closing the returned
+// io.ReadCloser closes the given io.ReadCloser.
+func NewDecompressedReadCloser(reader io.ReadCloser) (io.ReadCloser, Compression, error) {
+	compression, buffered, err := DetectCompression(reader)
+	if err != nil {
+		return nil, compression, err
+	}
+
+	decompressed, err := NewDecompressingReadCloser(&readCloser{Reader: buffered, Closer: reader}, compression)
+	if err != nil {
+		return nil, compression, err
+	}
+	return decompressed, compression, nil
+}
+
+// NewDecompressingReadCloser decompresses the given stream with the given (already known) compression algorithm,
+// without inspecting the stream. Closing the returned io.ReadCloser closes the given io.ReadCloser.
+func NewDecompressingReadCloser(reader io.ReadCloser, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case NoCompression:
+		return reader, nil
+	case GzipCompression:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gzip stream: %w", err)
+		}
+		return &readCloser{Reader: gzipReader, Closer: reader}, nil
+	case Bzip2Compression:
+		return &readCloser{Reader: bzip2.NewReader(reader), Closer: reader}, nil
+	case XzCompression:
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read xz stream: %w", err)
+		}
+		return &readCloser{Reader: xzReader, Closer: reader}, nil
+	case ZstdCompression:
+		// note: a single stream is decoded sequentially, so there is no need for concurrent decoders
+		zstdReader, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read zstd stream: %w", err)
+		}
+		return &zstdReadCloser{Decoder: zstdReader, source: reader}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
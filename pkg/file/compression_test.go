@@ -0,0 +1,192 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestNewDecompressedReadCloser(t *testing.T) {
+	contents := []byte("some contents that should survive a round trip")
+
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	if _, err := gw.Write(contents); err != nil {
+		t.Fatalf("could not write gzip content: %+v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("could not close gzip writer: %+v", err)
+	}
+
+	tests := []struct {
+		name                string
+		input               []byte
+		expectedCompression Compression
+		expectedContents    []byte
+		expectedErr         bool
+	}{
+		{
+			name:                "uncompressed",
+			input:               contents,
+			expectedCompression: NoCompression,
+			expectedContents:    contents,
+		},
+		{
+			name:                "empty",
+			input:               []byte{},
+			expectedCompression: NoCompression,
+			expectedContents:    []byte{},
+		},
+		{
+			name:                "gzip",
+			input:               gzipped.Bytes(),
+			expectedCompression: GzipCompression,
+			expectedContents:    contents,
+		},
+		{
+			name:                "xz",
+			input:               xzBytes(t, contents),
+			expectedCompression: XzCompression,
+			expectedContents:    contents,
+		},
+		{
+			name:                "zstd",
+			input:               zstdBytes(t, contents),
+			expectedCompression: ZstdCompression,
+			expectedContents:    contents,
+		},
+		{
+			name:                "empty bzip2 stream",
+			input:               []byte{'B', 'Z', 'h', '9', 0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0x00, 0x00, 0x00, 0x00},
+			expectedCompression: Bzip2Compression,
+			expectedContents:    []byte{},
+		},
+		{
+			name:                "text starting with the bzip2 magic",
+			input:               []byte("BZh9 is not a bzip2 stream"),
+			expectedCompression: NoCompression,
+			expectedContents:    []byte("BZh9 is not a bzip2 stream"),
+		},
+		{
+			name:                "truncated bzip2 header",
+			input:               []byte{'B', 'Z', 'h', '9', 0x31, 0x41},
+			expectedCompression: NoCompression,
+			expectedContents:    []byte{'B', 'Z', 'h', '9', 0x31, 0x41},
+		},
+		{
+			name:                "corrupt gzip",
+			input:               []byte{0x1f, 0x8b, 0x08, 0x00},
+			expectedCompression: GzipCompression,
+			expectedErr:         true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, compression, err := NewDecompressedReadCloser(ioutil.NopCloser(bytes.NewReader(test.input)))
+			if compression != test.expectedCompression {
+				t.Errorf("unexpected compression: %q != %q", compression, test.expectedCompression)
+			}
+			if err != nil && !test.expectedErr {
+				t.Fatalf("unexpected error: %+v", err)
+			} else if err == nil && test.expectedErr {
+				t.Fatalf("expected an error but got none")
+			}
+			if test.expectedErr {
+				return
+			}
+
+			actual, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("could not read: %+v", err)
+			}
+			if !bytes.Equal(actual, test.expectedContents) {
+				t.Errorf("unexpected contents: %q", string(actual))
+			}
+			if err := reader.Close(); err != nil {
+				t.Errorf("could not close: %+v", err)
+			}
+		})
+	}
+}
+
+func xzBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := xz.NewWriter(buf)
+	if err != nil {
+		t.Fatalf("could not create xz writer: %+v", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		t.Fatalf("could not xz: %+v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close xz writer: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatalf("could not create zstd writer: %+v", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		t.Fatalf("could not zstd: %+v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close zstd writer: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewDecompressingReadCloser(t *testing.T) {
+	contents := []byte("some contents that should survive a round trip")
+
+	// the compression is given, so the stream is never inspected
+	reader, err := NewDecompressingReadCloser(ioutil.NopCloser(bytes.NewReader(zstdBytes(t, contents))), ZstdCompression)
+	if err != nil {
+		t.Fatalf("could not decompress: %+v", err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read: %+v", err)
+	}
+	if !bytes.Equal(actual, contents) {
+		t.Errorf("unexpected contents: %q", string(actual))
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("could not close: %+v", err)
+	}
+
+	if _, err := NewDecompressingReadCloser(ioutil.NopCloser(bytes.NewReader(contents)), Compression("lz4")); err == nil {
+		t.Errorf("expected an error for an unsupported compression")
+	}
+}
+
+func TestDetectCompression_TarWithMagicEntryName(t *testing.T) {
+	// the first entry name is exactly the bzip2 magic (including the block magic), but the stream is a tar
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "BZh91AY&SY", Mode: 0o644}); err != nil {
+		t.Fatalf("could not write header: %+v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	compression, _, err := DetectCompression(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("could not detect compression: %+v", err)
+	}
+	if compression != NoCompression {
+		t.Errorf("unexpected compression: %q", compression)
+	}
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ContentSniffLen is the number of leading bytes of file contents considered when sniffing the content type (see
+// SniffContentType).
+const ContentSniffLen = 512
+
+// elf object file types (e_type) within the ELF header
+const (
+	elfTypeRelocatable = 1
+	elfTypeExecutable  = 2
+	elfTypeShared      = 3
+	elfTypeCore        = 4
+)
+
+// ContentType is the type of file contents as sniffed from the leading bytes of the contents.
+type ContentType struct {
+	// MIMEType is the media type of the contents without any parameters (e.g. "application/x-executable" or
+	// "text/plain").
+	MIMEType string
+	// IsBinary indicates that the contents are not text (e.g. executables, archives, or images).
+	IsBinary bool
+	// IsELF indicates that the contents are an ELF object (executables, shared libraries, relocatable objects, or core
+	// dumps).
+	IsELF bool
+}
+
+// ContentTypeFromReader sniffs the content type from the leading bytes of the given reader, returning the bytes read
+// (which must be considered by any further reads of the same contents).
+func ContentTypeFromReader(reader io.Reader) (ContentType, []byte, error) {
+	head := make([]byte, ContentSniffLen)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ContentType{}, nil, err
+	}
+	head = head[:n]
+	return SniffContentType(head), head, nil
+}
+
+// SniffContentType determines the content type from the given leading bytes of file contents (at most ContentSniffLen
+// bytes are considered). ELF objects, PE executables, and scripts (by interpreter line) are recognized in addition to
+// the types known to http.DetectContentType.
+func SniffContentType(head []byte) ContentType {
+	if len(head) > ContentSniffLen {
+		head = head[:ContentSniffLen]
+	}
+
+	if mimeType, ok := sniffELF(head); ok {
+		return ContentType{
+			MIMEType: mimeType,
+			IsBinary: true,
+			IsELF:    true,
+		}
+	}
+
+	binaryData := isBinaryData(head)
+	var mimeType string
+	switch {
+	case bytes.HasPrefix(head, []byte("MZ")) && binaryData:
+		mimeType = "application/x-dosexec"
+	case bytes.HasPrefix(head, []byte("#!")) && !binaryData:
+		mimeType = sniffScript(head)
+	default:
+		mimeType = http.DetectContentType(head)
+		if idx := strings.Index(mimeType, ";"); idx >= 0 {
+			mimeType = strings.TrimSpace(mimeType[:idx])
+		}
+	}
+
+	return ContentType{
+		MIMEType: mimeType,
+		IsBinary: binaryData || !isTextMIMEType(mimeType),
+	}
+}
+
+// sniffELF returns the MIME type of the given ELF object by the object file type (false if this is not an ELF object).
+func sniffELF(head []byte) (string, bool) {
+	// the ELF identification (16 bytes) is followed by the object file type (2 bytes)
+	if len(head) < 18 || !bytes.HasPrefix(head, []byte("\x7fELF")) {
+		return "", false
+	}
+
+	var order binary.ByteOrder
+	switch head[5] {
+	case 1:
+		order = binary.LittleEndian
+	case 2:
+		order = binary.BigEndian
+	default:
+		return "", false
+	}
+
+	switch order.Uint16(head[16:18]) {
+	case elfTypeRelocatable:
+		return "application/x-object", true
+	case elfTypeExecutable:
+		return "application/x-executable", true
+	case elfTypeShared:
+		// note: position independent executables are shared objects as well
+		return "application/x-sharedlib", true
+	case elfTypeCore:
+		return "application/x-coredump", true
+	default:
+		return "application/x-elf", true
+	}
+}
+
+// sniffScript returns the MIME type of a script by the interpreter given on the first line.
+func sniffScript(head []byte) string {
+	line := head
+	if idx := bytes.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	fields := strings.Fields(strings.TrimPrefix(string(line), "#!"))
+	if len(fields) == 0 {
+		return "text/plain"
+	}
+
+	interpreter := fields[0]
+	if idx := strings.LastIndex(interpreter, "/"); idx >= 0 {
+		interpreter = interpreter[idx+1:]
+	}
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+
+	switch {
+	case interpreter == "sh" || interpreter == "bash" || interpreter == "dash" || interpreter == "ash" || interpreter == "zsh" || interpreter == "ksh":
+		return "text/x-shellscript"
+	case strings.HasPrefix(interpreter, "python"):
+		return "text/x-script.python"
+	case strings.HasPrefix(interpreter, "perl"):
+		return "text/x-perl"
+	case strings.HasPrefix(interpreter, "ruby"):
+		return "text/x-ruby"
+	case interpreter == "node" || interpreter == "nodejs":
+		return "text/javascript"
+	default:
+		return "text/plain"
+	}
+}
+
+// isBinaryData indicates that the given bytes hold control characters that are not found within text (following the
+// same rules as http.DetectContentType).
+func isBinaryData(head []byte) bool {
+	for _, b := range head {
+		switch {
+		case b <= 0x08, b == 0x0B, 0x0E <= b && b <= 0x1A, 0x1C <= b && b <= 0x1F:
+			return true
+		}
+	}
+	return false
+}
+
+// isTextMIMEType indicates that the given MIME type describes text contents.
+func isTextMIMEType(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return true
+	case mimeType == "application/json", mimeType == "application/xml", mimeType == "application/javascript":
+		return true
+	case strings.HasSuffix(mimeType, "+xml"), strings.HasSuffix(mimeType, "+json"):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,105 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+// elfHeader returns the leading bytes of a little endian ELF object of the given type.
+func elfHeader(elfType byte) []byte {
+	head := make([]byte, 64)
+	copy(head, "\x7fELF")
+	head[4] = 2 // 64-bit
+	head[5] = 1 // little endian
+	head[6] = 1 // version
+	head[16] = elfType
+	return head
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		expected ContentType
+	}{
+		{
+			name:     "executable",
+			head:     elfHeader(elfTypeExecutable),
+			expected: ContentType{MIMEType: "application/x-executable", IsBinary: true, IsELF: true},
+		},
+		{
+			name:     "shared library",
+			head:     elfHeader(elfTypeShared),
+			expected: ContentType{MIMEType: "application/x-sharedlib", IsBinary: true, IsELF: true},
+		},
+		{
+			name:     "relocatable object",
+			head:     elfHeader(elfTypeRelocatable),
+			expected: ContentType{MIMEType: "application/x-object", IsBinary: true, IsELF: true},
+		},
+		{
+			name:     "truncated elf header",
+			head:     []byte("\x7fELF\x02\x01"),
+			expected: ContentType{MIMEType: "application/octet-stream", IsBinary: true},
+		},
+		{
+			name:     "shell script",
+			head:     []byte("#!/bin/sh\necho hello\n"),
+			expected: ContentType{MIMEType: "text/x-shellscript"},
+		},
+		{
+			name:     "python script via env",
+			head:     []byte("#!/usr/bin/env python3\nprint('hello')\n"),
+			expected: ContentType{MIMEType: "text/x-script.python"},
+		},
+		{
+			name:     "plain text",
+			head:     []byte("hello world\n"),
+			expected: ContentType{MIMEType: "text/plain"},
+		},
+		{
+			name:     "empty",
+			head:     nil,
+			expected: ContentType{MIMEType: "text/plain"},
+		},
+		{
+			name:     "gzip",
+			head:     []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"),
+			expected: ContentType{MIMEType: "application/x-gzip", IsBinary: true},
+		},
+		{
+			name:     "json",
+			head:     []byte(`{"key": "value"}`),
+			expected: ContentType{MIMEType: "text/plain"},
+		},
+		{
+			name:     "pe executable",
+			head:     []byte("MZ\x90\x00\x03\x00\x00\x00"),
+			expected: ContentType{MIMEType: "application/x-dosexec", IsBinary: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := SniffContentType(test.head)
+			if actual != test.expected {
+				t.Errorf("unexpected content type: %+v != %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestContentTypeFromReader(t *testing.T) {
+	contents := "#!/bin/bash\n" + strings.Repeat("x", 2*ContentSniffLen)
+
+	contentType, head, err := ContentTypeFromReader(strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("could not sniff content type: %+v", err)
+	}
+	if contentType.MIMEType != "text/x-shellscript" {
+		t.Errorf("unexpected MIME type: %q", contentType.MIMEType)
+	}
+	if string(head) != contents[:ContentSniffLen] {
+		t.Errorf("unexpected leading bytes: %q", string(head))
+	}
+}
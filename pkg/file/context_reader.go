@@ -0,0 +1,31 @@
+package file
+
+import (
+	"context"
+	"io"
+)
+
+var _ io.Reader = (*ContextReader)(nil)
+
+// ContextReader is a reader that stops providing content once the given context is done (cancelled or past the
+// deadline), allowing for long reads (e.g. layer tars) to be aborted between reads of the underlying reader.
+type ContextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// NewContextReader creates a new ContextReader for the given reader.
+func NewContextReader(ctx context.Context, reader io.Reader) *ContextReader {
+	return &ContextReader{
+		ctx:    ctx,
+		reader: reader,
+	}
+}
+
+// Read implements the io.Reader interface, returning the context error once the context is done.
+func (r *ContextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(b)
+}
@@ -0,0 +1,29 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reader := NewContextReader(ctx, strings.NewReader("some contents"))
+
+	buf := make([]byte, 4)
+	if _, err := reader.Read(buf); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if string(buf) != "some" {
+		t.Errorf("unexpected contents: %q", string(buf))
+	}
+
+	cancel()
+
+	if _, err := ioutil.ReadAll(reader); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got: %+v", err)
+	}
+}
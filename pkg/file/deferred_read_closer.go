@@ -11,8 +11,10 @@ var _ io.ReadCloser = (*DeferredReadCloser)(nil)
 type DeferredReadCloser struct {
 	// path is the path to be opened
 	path string
+	// opener opens the source instead of the path (if provided)
+	opener OpenerFn
 	// file is the io.ReadCloser source for the path
-	file *os.File
+	file io.ReadCloser
 }
 
 // NewDeferredReadCloser creates a new DeferredReadCloser for the given path.
@@ -22,18 +24,43 @@ func NewDeferredReadCloser(path string) *DeferredReadCloser {
 	}
 }
 
+// NewDeferredReadCloserFromOpener creates a new DeferredReadCloser that opens the source with the given function upon
+// the first Read() call (instead of a path).
+func NewDeferredReadCloserFromOpener(opener OpenerFn) *DeferredReadCloser {
+	return &DeferredReadCloser{
+		opener: opener,
+	}
+}
+
 // Read implements the io.Reader interface for the previously loaded path, opening the file upon the first invocation.
 func (d *DeferredReadCloser) Read(b []byte) (n int, err error) {
 	if d.file == nil {
-		var err error
-		d.file, err = os.Open(d.path)
-		if err != nil {
+		if err := d.open(); err != nil {
 			return 0, err
 		}
 	}
 	return d.file.Read(b)
 }
 
+// open allocates the source (note: the source is only kept when it could be opened).
+func (d *DeferredReadCloser) open() error {
+	if d.opener != nil {
+		reader, err := d.opener()
+		if err != nil {
+			return err
+		}
+		d.file = reader
+		return nil
+	}
+
+	fh, err := os.Open(d.path)
+	if err != nil {
+		return err
+	}
+	d.file = fh
+	return nil
+}
+
 // Close implements the io.Closer interface for the previously loaded path / opened file.
 func (d *DeferredReadCloser) Close() error {
 	if d.file == nil {
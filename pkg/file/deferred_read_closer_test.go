@@ -2,8 +2,10 @@ package file
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -45,3 +47,30 @@ func TestDeferredReadCloser(t *testing.T) {
 		t.Fatalf("should not have a file, but we do somehow")
 	}
 }
+
+func TestDeferredReadCloserFromOpener(t *testing.T) {
+	var opened int
+	dReader := NewDeferredReadCloserFromOpener(func() (io.ReadCloser, error) {
+		opened++
+		return ioutil.NopCloser(strings.NewReader("contents")), nil
+	})
+
+	if opened != 0 {
+		t.Fatalf("should not have opened the source yet")
+	}
+
+	actualContents, err := ioutil.ReadAll(dReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actualContents) != "contents" {
+		t.Fatalf("unexpected contents: %s", string(actualContents))
+	}
+	if opened != 1 {
+		t.Fatalf("unexpected number of opens: %d", opened)
+	}
+
+	if err := dReader.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
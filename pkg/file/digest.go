@@ -0,0 +1,55 @@
+package file
+
+import (
+	"crypto"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Digest is the hash of the contents of a file.
+type Digest struct {
+	// Algorithm is the name of the hash algorithm (e.g. "sha256", see DigestAlgorithmName).
+	Algorithm string
+	// Value is the hex-encoded hash of the file contents.
+	Value string
+}
+
+// String returns the digest in "algorithm:value" form (e.g. "sha256:e3b0c442...").
+func (d Digest) String() string {
+	return d.Algorithm + ":" + d.Value
+}
+
+// DigestAlgorithmName returns the name of the given hash algorithm as used within a Digest (e.g. "sha256" for
+// crypto.SHA256 and "sha512" for crypto.SHA512).
+func DigestAlgorithmName(h crypto.Hash) string {
+	return strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+}
+
+// DigestsFromReader reads all contents from the given reader, returning a digest for each of the given hash algorithms
+// (in the same order). All hash algorithms must be available (i.e. the implementation must be linked into the binary).
+func DigestsFromReader(reader io.Reader, hashes ...crypto.Hash) ([]Digest, error) {
+	writers := make([]io.Writer, len(hashes))
+	hashers := make([]hash.Hash, len(hashes))
+	for idx, h := range hashes {
+		if !h.Available() {
+			return nil, fmt.Errorf("unavailable hash algorithm: %s", h)
+		}
+		hashers[idx] = h.New()
+		writers[idx] = hashers[idx]
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), reader); err != nil {
+		return nil, err
+	}
+
+	digests := make([]Digest, len(hashes))
+	for idx, h := range hashes {
+		digests[idx] = Digest{
+			Algorithm: DigestAlgorithmName(h),
+			Value:     fmt.Sprintf("%x", hashers[idx].Sum(nil)),
+		}
+	}
+	return digests, nil
+}
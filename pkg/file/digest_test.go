@@ -0,0 +1,29 @@
+package file
+
+import (
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDigestsFromReader(t *testing.T) {
+	actual, err := DigestsFromReader(strings.NewReader("hello"), crypto.SHA256, crypto.SHA1)
+	if err != nil {
+		t.Fatalf("could not digest: %+v", err)
+	}
+
+	expected := []Digest{
+		{Algorithm: "sha256", Value: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{Algorithm: "sha1", Value: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected digests: %+v", actual)
+	}
+
+	if actual[0].String() != "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected digest string: %q", actual[0].String())
+	}
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+// DirTarOptions tailors how a directory is captured as a tar (see WriteDirTar).
+type DirTarOptions struct {
+	// Exclude are paths that are never captured (e.g. the dir the tar is written into when capturing a live "/").
+	Exclude []string
+	// SkipContents are dirs (relative to the captured directory, slash separated) that are captured without their
+	// contents (e.g. mount points for pseudo filesystems).
+	SkipContents []string
+	// Rewrite replaces the tar header of each path with the returned headers (none to omit the path), which allows for
+	// translating entries that have another meaning within a tar (e.g. overlay whiteouts). The contents of a regular
+	// file are only written for the original header.
+	Rewrite func(path string, header *tar.Header) []*tar.Header
+}
+
+// WriteDirTar captures the given directory as an uncompressed tar. Entries are written in lexical order with access
+// and change times omitted, so the same directory content yields the same tar. Unreadable paths are skipped (common
+// within a live root filesystem), as are sockets (which cannot be represented within a tar).
+func WriteDirTar(ctx context.Context, root string, w io.Writer, options DirTarOptions) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("unable to resolve directory=%q: %w", root, err)
+	}
+
+	var exclude = make(map[string]bool)
+	for _, p := range options.Exclude {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("unable to resolve excluded path=%q: %w", p, err)
+		}
+		exclude[abs] = true
+	}
+	var skipContents = make(map[string]bool)
+	for _, p := range options.SkipContents {
+		skipContents[p] = true
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Debugf("skipping unreadable path=%q: %+v", path, err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if exclude[path] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if err := writeDirTarEntry(tw, path, rel, info, options.Rewrite); err != nil {
+			return err
+		}
+
+		if info.IsDir() && skipContents[rel] {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to capture directory=%q: %w", root, err)
+	}
+
+	return tw.Close()
+}
+
+// writeDirTarEntry writes the tar entry (and contents for regular files) for a single path within the directory.
+func writeDirTarEntry(tw *tar.Writer, path, rel string, info os.FileInfo, rewrite func(string, *tar.Header) []*tar.Header) error {
+	if info.Mode()&os.ModeSocket != 0 {
+		return nil
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(path)
+		if err != nil {
+			log.Debugf("skipping unreadable symlink=%q: %+v", path, err)
+			return nil
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		log.Debugf("skipping unsupported path=%q: %+v", path, err)
+		return nil
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Format = tar.FormatPAX
+
+	headers := []*tar.Header{header}
+	if rewrite != nil {
+		headers = rewrite(path, header)
+	}
+
+	for _, h := range headers {
+		if h != header || h.Typeflag != tar.TypeReg {
+			if err := tw.WriteHeader(h); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeDirTarFile(tw, path, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDirTarFile writes the tar entry and contents of a regular file.
+func writeDirTarFile(tw *tar.Writer, path string, header *tar.Header) error {
+	contents, err := os.Open(path)
+	if err != nil {
+		log.Debugf("skipping unreadable file=%q: %+v", path, err)
+		return nil
+	}
+	defer contents.Close()
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(tw, io.LimitReader(contents, header.Size))
+	if err != nil {
+		return fmt.Errorf("unable to capture file=%q: %w", path, err)
+	}
+	if n < header.Size {
+		// the file shrank while being captured (e.g. within a live root filesystem), the entry must still be complete
+		log.Debugf("file=%q changed while being captured", path)
+		if _, err := io.CopyN(tw, zeroReader{}, header.Size-n); err != nil {
+			return fmt.Errorf("unable to capture file=%q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// zeroReader provides an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for idx := range p {
+		p[idx] = 0
+	}
+	return len(p), nil
+}
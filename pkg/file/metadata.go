@@ -1,6 +1,9 @@
 package file
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 // Metadata represents all file metadata of interest (used today for in-tar file resolution).
 type Metadata struct {
@@ -8,14 +11,40 @@ type Metadata struct {
 	Path string
 	// TarHeaderName is the exact entry name as found within a tar header
 	TarHeaderName string
+	// TarSequence is the index of the entry within the tar (entries with a lower sequence are found at a lower byte
+	// offset), which allows for ordering multiple reads into a single sequential pass of the tar. This is also the
+	// exact on-archive order of entries (see HeaderFromTar for fetching the raw tar header for the entry).
+	TarSequence int64
 	// Linkname is populated only for hardlinks / symlinks, can be an absolute or relative.
 	Linkname string
 	// Size of the file in bytes.
 	Size    int64
 	UserID  int
 	GroupID int
+	// UserName and GroupName are the owner names as recorded within the tar entry (empty when not recorded).
+	UserName  string
+	GroupName string
 	// TypeFlag is the tar.TypeFlag entry for the file
 	TypeFlag byte
 	IsDir    bool
+	// DevMajor and DevMinor are the device numbers of character and block devices (zero for all other types).
+	DevMajor int64
+	DevMinor int64
 	Mode     os.FileMode
+	// ModTime is the modification time of the file (in UTC). Sub-second precision is preserved when the tar entry
+	// provides it (e.g. PAX headers).
+	ModTime time.Time
+	// AccessTime and ChangeTime are only populated when the tar entry provides them (PAX or GNU formats), otherwise
+	// these are zero values.
+	AccessTime time.Time
+	ChangeTime time.Time
+	// Digests are the hashes of the file contents (only populated for regular files when requested while cataloging,
+	// the first digest is always SHA-256).
+	Digests []Digest
+	// Xattrs are the extended attributes of the file (from PAX records), keyed by attribute name (e.g.
+	// "security.capability", see Capabilities). Values are the raw (possibly binary) attribute values.
+	Xattrs map[string]string
+	// ContentType is the type of the file contents as sniffed from the leading bytes (only populated for regular files
+	// when requested while cataloging, otherwise this is a zero value).
+	ContentType ContentType
 }
@@ -13,11 +13,17 @@ const (
 	DirSeparator   = "/"
 )
 
+var errNoParent = fmt.Errorf("no parent")
+
 // Path represents a file path
 type Path string
 
 // Normalize returns the cleaned file path representation (trimmed of spaces and resolve relative notations)
 func (p Path) Normalize() Path {
+	if isNormalized(string(p)) {
+		// this is the common case (e.g. paths from previous normalization or from the tree), skip the clean operation
+		return p
+	}
 	trimmed := strings.Trim(string(p), " ")
 	if trimmed == "/" {
 		return Path(trimmed)
@@ -25,6 +31,31 @@ func (p Path) Normalize() Path {
 	return Path(filepath.Clean(strings.TrimRight(trimmed, DirSeparator)))
 }
 
+// isNormalized indicates if the given path is already in normalized form (an absolute path with no relative notations,
+// repeated separators, trailing separators, or surrounding spaces).
+func isNormalized(p string) bool {
+	switch {
+	case p == DirSeparator:
+		return true
+	case len(p) < 2 || p[0] != '/' || p[len(p)-1] == '/' || p[len(p)-1] == ' ':
+		return false
+	}
+
+	// every element must be non-empty and neither "." nor ".."
+	start := 1
+	for idx := 1; idx <= len(p); idx++ {
+		if idx < len(p) && p[idx] != '/' {
+			continue
+		}
+		switch p[start:idx] {
+		case "", ".", "..":
+			return false
+		}
+		start = idx + 1
+	}
+	return true
+}
+
 func (p Path) IsAbsolutePath() bool {
 	return strings.HasPrefix(string(p), DirSeparator)
 }
@@ -65,7 +96,7 @@ func (p Path) ParentPath() (Path, error) {
 		if child != "" {
 			return "/", nil
 		}
-		return "", fmt.Errorf("no parent")
+		return "", errNoParent
 	}
 	return sanitized, nil
 }
@@ -81,6 +112,27 @@ func (p Path) AllPaths() []Path {
 
 // ConstituentPaths returns all constituent paths for the current path (not including the current path itself) (e.g. /home/wagoodman/file.txt -> /, /home, /home/wagoodman )
 func (p Path) ConstituentPaths() []Path {
+	trimmed := strings.TrimRight(string(p), DirSeparator)
+	if trimmed == "" {
+		return []Path{DirSeparator}
+	}
+	if !isNormalized(trimmed) {
+		return p.constituentPathsFromParts()
+	}
+
+	// all constituent paths are prefixes of the path itself, so these can be sliced without allocating new strings
+	fullPaths := make([]Path, 1, strings.Count(trimmed, DirSeparator))
+	fullPaths[0] = DirSeparator
+	for idx := 1; idx < len(trimmed); idx++ {
+		if trimmed[idx] == '/' {
+			fullPaths = append(fullPaths, Path(trimmed[:idx]))
+		}
+	}
+	return fullPaths
+}
+
+// constituentPathsFromParts returns all constituent paths for paths that are not normalized (e.g. relative paths).
+func (p Path) constituentPathsFromParts() []Path {
 	parents := strings.Split(strings.Trim(string(p), DirSeparator), DirSeparator)
 	fullPaths := make([]Path, len(parents))
 	for idx := range parents {
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MaxTarEntryPathDepth is the number of path elements above which a tar entry name is considered suspicious (no
+// legitimate filesystem needs paths this deep, while such paths are costly to index).
+const MaxTarEntryPathDepth = 256
+
+// PathPolicy determines how tar entries with suspicious names are handled (see SuspiciousTarEntryName), protecting
+// catalog consumers from images crafted to write outside of the extraction root or to exhaust resources.
+type PathPolicy uint8
+
+const (
+	// NormalizePaths indexes suspicious entries at the normalized path (relative to the root), reporting each as a
+	// SanitizedTarEntry.
+	NormalizePaths PathPolicy = iota
+	// RejectSuspiciousPaths fails on the first suspicious entry (see ErrSuspiciousTarEntry).
+	RejectSuspiciousPaths
+	// QuarantineSuspiciousPaths never indexes suspicious entries, reporting each as a QuarantinedTarEntry instead.
+	QuarantineSuspiciousPaths
+)
+
+// ErrSuspiciousTarEntry is returned for a tar entry with a suspicious name (only with RejectSuspiciousPaths).
+var ErrSuspiciousTarEntry = fmt.Errorf("suspicious tar entry")
+
+// drivePathPattern matches names that are absolute with a (windows) drive letter (e.g. "C:\evil.exe" or "c:/evil").
+var drivePathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// SuspiciousTarEntryName describes why the given tar entry name is suspicious (empty when it is not): names with ".."
+// elements (which may escape the root), names that are absolute with a drive letter, names with duplicate separators,
+// and names deeper than MaxTarEntryPathDepth. Note: a leading separator or "./" prefix is common and not suspicious.
+func SuspiciousTarEntryName(name string) string {
+	trimmed := strings.TrimPrefix(name, DirSeparator)
+	elements := strings.Split(strings.TrimSuffix(trimmed, DirSeparator), DirSeparator)
+
+	switch {
+	case escapesRoot(name):
+		return "entry name escapes the archive root"
+	case containsElement(elements, ".."):
+		return `entry name has ".." elements`
+	case drivePathPattern.MatchString(name):
+		return "entry name is absolute with a drive letter"
+	case strings.Contains(trimmed, DirSeparator+DirSeparator):
+		return "entry name has duplicate separators"
+	case len(elements) > MaxTarEntryPathDepth:
+		return fmt.Sprintf("entry name is deeper than %d elements", MaxTarEntryPathDepth)
+	}
+	return ""
+}
+
+// CheckTarEntryPath applies the given policy to the given entry, returning the entry to report when the name is
+// suspicious (nil otherwise). Reported entries with a QuarantinedTarEntry reason must not be indexed, while entries
+// with a SanitizedTarEntry reason are indexed at the normalized path (see Metadata.Path).
+func CheckTarEntryPath(metadata Metadata, policy PathPolicy) (*SkippedTarEntry, error) {
+	detail := SuspiciousTarEntryName(metadata.TarHeaderName)
+	if detail == "" {
+		return nil, nil
+	}
+
+	entry := &SkippedTarEntry{
+		Path:          metadata.Path,
+		TarHeaderName: metadata.TarHeaderName,
+		TarSequence:   metadata.TarSequence,
+		TypeFlag:      metadata.TypeFlag,
+	}
+	switch policy {
+	case RejectSuspiciousPaths:
+		return nil, fmt.Errorf("%w: name=%q (%s)", ErrSuspiciousTarEntry, metadata.TarHeaderName, detail)
+	case QuarantineSuspiciousPaths:
+		entry.Reason = QuarantinedTarEntry
+		entry.Detail = fmt.Sprintf("%s, not indexed", detail)
+	default:
+		entry.Reason = SanitizedTarEntry
+		entry.Detail = fmt.Sprintf("%s, indexed at path=%q", detail, metadata.Path)
+	}
+	return entry, nil
+}
+
+func containsElement(elements []string, element string) bool {
+	for _, e := range elements {
+		if e == element {
+			return true
+		}
+	}
+	return false
+}
+
+// escapesRoot indicates if the given (relative) tar entry name refers to a path above the archive root.
+func escapesRoot(name string) bool {
+	cleaned := path.Clean(strings.TrimPrefix(name, DirSeparator))
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
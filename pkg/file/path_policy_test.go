@@ -0,0 +1,64 @@
+package file
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSuspiciousTarEntryName(t *testing.T) {
+	tests := []struct {
+		name       string
+		suspicious bool
+	}{
+		{name: "etc/passwd"},
+		{name: "./etc/passwd"},
+		{name: "/etc/passwd"},
+		{name: "etc/"},
+		{name: "./"},
+		{name: "../../etc/passwd", suspicious: true},
+		{name: "etc/../../passwd", suspicious: true},
+		{name: "etc/../passwd", suspicious: true},
+		{name: `C:\Windows\evil.exe`, suspicious: true},
+		{name: "c:/evil", suspicious: true},
+		{name: "etc//passwd", suspicious: true},
+		{name: strings.Repeat("a/", MaxTarEntryPathDepth) + "deep", suspicious: true},
+		{name: strings.Repeat("a/", MaxTarEntryPathDepth-1) + "deep"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detail := SuspiciousTarEntryName(test.name)
+			if (detail != "") != test.suspicious {
+				t.Errorf("unexpected result: %q", detail)
+			}
+		})
+	}
+}
+
+func TestCheckTarEntryPath(t *testing.T) {
+	metadata := Metadata{
+		Path:          "/etc/passwd",
+		TarHeaderName: "../etc/passwd",
+		TarSequence:   3,
+	}
+
+	entry, err := CheckTarEntryPath(metadata, NormalizePaths)
+	if err != nil || entry == nil || entry.Reason != SanitizedTarEntry || entry.Path != "/etc/passwd" {
+		t.Errorf("unexpected normalized entry: %+v (%v)", entry, err)
+	}
+
+	entry, err = CheckTarEntryPath(metadata, QuarantineSuspiciousPaths)
+	if err != nil || entry == nil || entry.Reason != QuarantinedTarEntry || entry.TarSequence != 3 {
+		t.Errorf("unexpected quarantined entry: %+v (%v)", entry, err)
+	}
+
+	if _, err := CheckTarEntryPath(metadata, RejectSuspiciousPaths); !errors.Is(err, ErrSuspiciousTarEntry) {
+		t.Errorf("expected a suspicious tar entry error, got %+v", err)
+	}
+
+	entry, err = CheckTarEntryPath(Metadata{Path: "/etc/passwd", TarHeaderName: "etc/passwd"}, RejectSuspiciousPaths)
+	if err != nil || entry != nil {
+		t.Errorf("unexpected result for a regular name: %+v (%v)", entry, err)
+	}
+}
@@ -28,6 +28,26 @@ func TestPath_Normalize(t *testing.T) {
 			path:     "/",
 			expected: "/",
 		},
+		{
+			name:     "Already normalized",
+			path:     "/some/path",
+			expected: "/some/path",
+		},
+		{
+			name:     "Resolve relative notations",
+			path:     "/some/./other/../path",
+			expected: "/some/path",
+		},
+		{
+			name:     "Collapse repeated slashes",
+			path:     "//some//path",
+			expected: "/some/path",
+		},
+		{
+			name:     "Trailing dot",
+			path:     "/some/path/.",
+			expected: "/some/path",
+		},
 	}
 
 	for _, c := range cases {
@@ -64,6 +84,34 @@ func TestPath_AllPaths(t *testing.T) {
 	}
 }
 
+func TestPath_ConstituentPaths(t *testing.T) {
+	cases := []Path{
+		"/",
+		"",
+		"/home",
+		"/home/",
+		"/some/path/to/a/file.txt",
+		"some/relative/path",
+		"/some//path/./to/../file.txt",
+	}
+
+	for _, c := range cases {
+		t.Run(string(c), func(t *testing.T) {
+			// the optimized path must be equivalent to building paths from each part
+			expected := c.constituentPathsFromParts()
+			actual := c.ConstituentPaths()
+			if len(actual) != len(expected) {
+				t.Fatalf("unexpected number of paths (%+v!=%+v): %+v", len(actual), len(expected), actual)
+			}
+			for idx := range actual {
+				if actual[idx] != expected[idx] {
+					t.Errorf("unexpected path ('%v' != '%v')", actual[idx], expected[idx])
+				}
+			}
+		})
+	}
+}
+
 func TestPath_Sanitize_ID(t *testing.T) {
 	patha := Path("/some/path/to/a")
 	pathb := Path("/some/path/to/a/")
@@ -140,3 +188,57 @@ func TestPath_UnWhiteoutPath(t *testing.T) {
 		t.Fatal("path should be a whiteout")
 	}
 }
+
+var benchmarkPaths = []Path{
+	"/",
+	"/usr",
+	"/usr/lib/python3.8/site-packages/pip/_internal/cli/main.py",
+	"/var/lib/dpkg/info/libc6:amd64.list",
+	"/some/path/",
+	" /some/untrimmed/path ",
+}
+
+func BenchmarkPath_Normalize(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchmarkPaths {
+			p.Normalize()
+		}
+	}
+}
+
+func BenchmarkPath_ParentPath(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchmarkPaths {
+			_, _ = p.ParentPath()
+		}
+	}
+}
+
+func BenchmarkPath_Basename(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchmarkPaths {
+			p.Basename()
+		}
+	}
+}
+
+func BenchmarkPath_ConstituentPaths(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchmarkPaths {
+			p.ConstituentPaths()
+		}
+	}
+}
+
+func BenchmarkPath_IsWhiteout(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchmarkPaths {
+			p.IsWhiteout()
+		}
+	}
+}
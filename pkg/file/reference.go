@@ -2,9 +2,11 @@ package file
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
-var nextID = 0
+// nextID is the last assigned reference ID (only accessed atomically, since references may be created concurrently).
+var nextID uint64
 
 // ID is used for file tree manipulation to uniquely identify tree nodes.
 type ID uint64
@@ -17,10 +19,24 @@ type Reference struct {
 
 // NewFileReference creates a new unique file reference for the given path.
 func NewFileReference(path Path) *Reference {
-	nextID++
 	return &Reference{
 		RealPath: path,
-		id:       ID(nextID),
+		id:       ID(atomic.AddUint64(&nextID, 1)),
+	}
+}
+
+// RestoreFileReference recreates a file reference with a previously assigned ID (e.g. when loading references
+// persisted by another process). All references created afterwards are assigned IDs greater than the given ID.
+func RestoreFileReference(id ID, path Path) *Reference {
+	for {
+		last := atomic.LoadUint64(&nextID)
+		if uint64(id) <= last || atomic.CompareAndSwapUint64(&nextID, last, uint64(id)) {
+			break
+		}
+	}
+	return &Reference{
+		RealPath: path,
+		id:       id,
 	}
 }
 
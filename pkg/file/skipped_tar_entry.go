@@ -0,0 +1,51 @@
+package file
+
+const (
+	// UnsupportedTarEntry is an entry with a type that cannot be represented as a file (e.g. a global PAX header).
+	UnsupportedTarEntry SkipReason = iota
+	// FilteredTarEntry is an entry excluded by the caller (e.g. an index filter or path exclusion).
+	FilteredTarEntry
+	// SanitizedTarEntry is an entry with a suspicious name, such as a name that escapes the root of the archive (e.g.
+	// "../../etc/passwd", see SuspiciousTarEntryName). The entry is not skipped, instead it is indexed at the sanitized
+	// path (relative to the root) which may not be where the entry would have been extracted to by the archive name.
+	SanitizedTarEntry
+	// MalformedTarEntry is a header that could not be read, where all remaining entries in the archive are skipped
+	// (only with LenientTarEntries, otherwise an error is returned).
+	MalformedTarEntry
+	// QuarantinedTarEntry is an entry with a suspicious name that is not indexed (see QuarantineSuspiciousPaths).
+	QuarantinedTarEntry
+)
+
+var skipReasonStr = [...]string{
+	"unsupported",
+	"filtered",
+	"sanitized",
+	"malformed",
+	"quarantined",
+}
+
+// SkipReason describes why a tar entry was not indexed as found within the archive.
+type SkipReason uint8
+
+// String returns a convenient display string for the reason.
+func (r SkipReason) String() string {
+	if int(r) < len(skipReasonStr) {
+		return skipReasonStr[r]
+	}
+	return "unknown"
+}
+
+// SkippedTarEntry describes a single tar entry that was not indexed as found within the archive (see SkipReason).
+type SkippedTarEntry struct {
+	// Path is the sanitized absolute path of the entry (empty for malformed headers).
+	Path string
+	// TarHeaderName is the exact entry name as found within the tar header (empty for malformed headers).
+	TarHeaderName string
+	// TarSequence is the index of the entry within the tar (for malformed headers, the index the header would have).
+	TarSequence int64
+	// TypeFlag is the tar.TypeFlag entry for the file (zero for malformed headers).
+	TypeFlag byte
+	Reason   SkipReason
+	// Detail is a human-readable description of why the entry was skipped (e.g. the read error of a malformed header).
+	Detail string
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/pkg/errors"
@@ -90,9 +92,11 @@ func ReaderFromTar(reader io.ReadCloser, tarPath string) (io.ReadCloser, error)
 // MetadataFromTar returns the tar metadata from the header info.
 func MetadataFromTar(reader io.ReadCloser, tarPath string) (Metadata, error) {
 	var metadata *Metadata
+	var sequence int64 = -1
 	visitor := func(header *tar.Header, _ io.Reader) error {
+		sequence++
 		if header.Name == tarPath {
-			m := assembleMetadata(header)
+			m := assembleMetadata(header, sequence)
 			metadata = &m
 			return ErrTarStopIteration
 		}
@@ -107,49 +111,223 @@ func MetadataFromTar(reader io.ReadCloser, tarPath string) (Metadata, error) {
 	return *metadata, nil
 }
 
+// HeaderFromTar returns a copy of the raw tar header for the entry at the given sequence (see Metadata.TarSequence).
+func HeaderFromTar(reader io.Reader, sequence int64) (*tar.Header, error) {
+	var result *tar.Header
+	var current int64 = -1
+	visitor := func(header *tar.Header, _ io.Reader) error {
+		current++
+		if current == sequence {
+			h := *header
+			result = &h
+			return ErrTarStopIteration
+		}
+		return nil
+	}
+	if err := TarIterator(reader, visitor); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no tar entry found (sequence=%d)", sequence)
+	}
+	return result, nil
+}
+
+// TarEntryPolicy determines how tar entries that cannot be represented (unsupported entry types and malformed
+// headers) are handled.
+type TarEntryPolicy uint8
+
+const (
+	// LenientTarEntries skips unsupported entries (with a warning) and stops reading at the first malformed header,
+	// keeping all entries read so far.
+	LenientTarEntries TarEntryPolicy = iota
+	// StrictTarEntries fails on any unsupported entry or malformed header.
+	StrictTarEntries
+)
+
+// ErrUnsupportedTarEntry is returned when a tar entry cannot be represented (only with StrictTarEntries).
+var ErrUnsupportedTarEntry = fmt.Errorf("unsupported tar entry")
+
+// ErrMalformedTar is returned when a tar header cannot be read (only with StrictTarEntries).
+var ErrMalformedTar = fmt.Errorf("malformed tar")
+
+// isSupportedTarEntryType indicates if the given tar entry type can be represented as a file.
+func isSupportedTarEntryType(typeFlag byte) bool {
+	switch typeFlag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir,
+		tar.TypeFifo, tar.TypeCont, tar.TypeGNUSparse:
+		return true
+	}
+	return false
+}
+
 // EnumerateFileMetadataFromTar populates and returns a Metadata object for all files in the tar.
 func EnumerateFileMetadataFromTar(reader io.Reader) <-chan Metadata {
 	result := make(chan Metadata)
 	go func() {
-		visitor := func(header *tar.Header, contents io.Reader) error {
-			// always ensure relative Path notations are not parsed as part of the filename
-			name := path.Clean(DirSeparator + header.Name)
-			if name == "." {
-				return nil
-			}
+		// note: with a lenient policy only errors from the visitor are returned, which there are none
+		_ = VisitFileMetadataFromTar(reader, LenientTarEntries, func(metadata Metadata) error {
+			result <- metadata
+			return nil
+		})
+		close(result)
+	}()
+	return result
+}
+
+// VisitFileMetadataFromTar invokes the given visitor with a Metadata object for each file in the tar (in tar order).
+// Unsupported entry types and malformed headers are handled according to the given policy. Any error from the
+// visitor stops iteration and is returned.
+func VisitFileMetadataFromTar(reader io.Reader, policy TarEntryPolicy, visitor func(Metadata) error) error {
+	return VisitFileMetadataAndContentsFromTar(reader, policy, func(metadata Metadata, _ io.Reader) error {
+		return visitor(metadata)
+	})
+}
+
+// VisitFileMetadataAndContentsFromTar is the same as VisitFileMetadataFromTar, however, the visitor is also given the
+// contents of each entry (which may only be read until the visitor returns).
+func VisitFileMetadataAndContentsFromTar(reader io.Reader, policy TarEntryPolicy, visitor func(Metadata, io.Reader) error) error {
+	return VisitFileMetadataAndContentsFromTarWithSkips(reader, policy, visitor, nil)
+}
 
+// VisitFileMetadataAndContentsFromTarWithSkips is the same as VisitFileMetadataAndContentsFromTar, however, every entry
+// that is not visited as found within the archive (see SkipReason) is additionally reported to the given skip function
+// (which may be nil).
+func VisitFileMetadataAndContentsFromTarWithSkips(reader io.Reader, policy TarEntryPolicy, visitor func(Metadata, io.Reader) error, skip func(SkippedTarEntry)) error {
+	return VisitFileMetadataAndContentsFromTarWithPathPolicy(reader, policy, NormalizePaths, visitor, skip)
+}
+
+// VisitFileMetadataAndContentsFromTarWithPathPolicy is the same as VisitFileMetadataAndContentsFromTarWithSkips,
+// however, entries with suspicious names are handled according to the given path policy (see PathPolicy).
+func VisitFileMetadataAndContentsFromTarWithPathPolicy(reader io.Reader, policy TarEntryPolicy, pathPolicy PathPolicy, visitor func(Metadata, io.Reader) error, skip func(SkippedTarEntry)) error {
+	if skip == nil {
+		skip = func(SkippedTarEntry) {}
+	}
+
+	var sequence int64 = -1
+	var visitErr error
+	err := TarIterator(reader, func(header *tar.Header, contents io.Reader) error {
+		sequence++
+		// always ensure relative Path notations are not parsed as part of the filename
+		name := path.Clean(DirSeparator + header.Name)
+		if name == "." {
+			return nil
+		}
+
+		if !isSupportedTarEntryType(header.Typeflag) {
+			if policy == StrictTarEntries {
+				visitErr = fmt.Errorf("%w: type=%q name=%s", ErrUnsupportedTarEntry, header.Typeflag, name)
+				return visitErr
+			}
 			switch header.Typeflag {
 			case tar.TypeXGlobalHeader:
 				log.Errorf("unexpected tar file: (XGlobalHeader): type=%v name=%s", header.Typeflag, name)
 			case tar.TypeXHeader:
 				log.Errorf("unexpected tar file (XHeader): type=%v name=%s", header.Typeflag, name)
 			default:
-				result <- assembleMetadata(header)
+				log.Warnf("skipping unsupported tar entry: type=%q name=%s", header.Typeflag, name)
 			}
+			skip(SkippedTarEntry{
+				Path:          name,
+				TarHeaderName: header.Name,
+				TarSequence:   sequence,
+				TypeFlag:      header.Typeflag,
+				Reason:        UnsupportedTarEntry,
+				Detail:        fmt.Sprintf("unsupported tar entry type=%q", header.Typeflag),
+			})
 			return nil
 		}
 
-		if err := TarIterator(reader, visitor); err != nil {
-			log.Errorf("failed to extract metadata from tar: %w", err)
+		metadata := assembleMetadata(header, sequence)
+		suspicious, err := CheckTarEntryPath(metadata, pathPolicy)
+		if err != nil {
+			visitErr = err
+			return visitErr
+		}
+		if suspicious != nil {
+			skip(*suspicious)
+			if suspicious.Reason == QuarantinedTarEntry {
+				return nil
+			}
 		}
 
-		close(result)
-	}()
-	return result
+		visitErr = visitor(metadata, contents)
+		return visitErr
+	})
+
+	switch {
+	case err == nil:
+		return nil
+	case visitErr != nil:
+		return visitErr
+	case policy == StrictTarEntries:
+		return fmt.Errorf("%w: %v", ErrMalformedTar, err)
+	default:
+		log.Errorf("failed to extract metadata from tar: %+v", err)
+		skip(SkippedTarEntry{
+			TarSequence: sequence + 1,
+			Reason:      MalformedTarEntry,
+			Detail:      fmt.Sprintf("unable to read tar header (all remaining entries are skipped): %v", err),
+		})
+		return nil
+	}
+}
+
+// MetadataFromTarHeader returns the Metadata for the given tar header, found at the given index within the tar (see
+// Metadata.TarSequence). This is useful for layer formats that describe tar entries without a tar stream (e.g. an
+// eStargz table of contents).
+func MetadataFromTarHeader(header *tar.Header, sequence int64) Metadata {
+	return assembleMetadata(header, sequence)
 }
 
-func assembleMetadata(header *tar.Header) Metadata {
+func assembleMetadata(header *tar.Header, sequence int64) Metadata {
 	return Metadata{
 		Path:          path.Clean(DirSeparator + header.Name),
 		TarHeaderName: header.Name,
+		TarSequence:   sequence,
 		TypeFlag:      header.Typeflag,
 		Linkname:      header.Linkname,
 		Size:          header.FileInfo().Size(),
 		Mode:          header.FileInfo().Mode(),
 		UserID:        header.Uid,
 		GroupID:       header.Gid,
+		UserName:      header.Uname,
+		GroupName:     header.Gname,
 		IsDir:         header.FileInfo().IsDir(),
+		DevMajor:      header.Devmajor,
+		DevMinor:      header.Devminor,
+		ModTime:       utcTime(header.ModTime),
+		AccessTime:    utcTime(header.AccessTime),
+		ChangeTime:    utcTime(header.ChangeTime),
+		Xattrs:        xattrsFromTar(header),
+	}
+}
+
+// paxXattrPrefix is the prefix of PAX records that hold extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// xattrsFromTar returns the extended attributes of the given tar header (nil if there are none).
+func xattrsFromTar(header *tar.Header) map[string]string {
+	var xattrs map[string]string
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = value
+	}
+	return xattrs
+}
+
+// utcTime normalizes the given time to UTC without losing sub-second precision. Zero values are left as-is so
+// callers can continue to use IsZero() to detect absent timestamps.
+func utcTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
 	}
+	return t.UTC()
 }
 
 // UntarToDirectory writes the contents of the given tar reader to the given destination
@@ -194,7 +372,7 @@ func UntarToDirectory(reader io.Reader, dst string) error {
 			}
 
 			if err = f.Close(); err != nil {
-				log.Errorf("failed to close file during untar of path=%q: %w", f.Name(), err)
+				log.Errorf("failed to close file during untar of path=%q: %+v", f.Name(), err)
 			}
 		}
 	}
@@ -1,7 +1,10 @@
 package file
 
 import (
+	"archive/tar"
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,7 +12,9 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 const (
@@ -127,18 +132,209 @@ func TestReaderFromTar_MissingFile(t *testing.T) {
 	}
 }
 
+func TestHeaderFromTar(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0644, Uname: "someone", Format: tar.FormatPAX, PAXRecords: map[string]string{"SCHILY.xattr.user.origin": "forensics"}},
+		{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0600},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	header, err := HeaderFromTar(bytes.NewReader(buf.Bytes()), 1)
+	if err != nil {
+		t.Fatalf("could not get header: %+v", err)
+	}
+	if header.Name != "etc/passwd" || header.Mode != 0644 || header.Uname != "someone" {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if header.PAXRecords["SCHILY.xattr.user.origin"] != "forensics" {
+		t.Errorf("expected raw PAX records, got %+v", header.PAXRecords)
+	}
+
+	// entries with the same name are distinguished by sequence
+	header, err = HeaderFromTar(bytes.NewReader(buf.Bytes()), 2)
+	if err != nil {
+		t.Fatalf("could not get header: %+v", err)
+	}
+	if header.Mode != 0600 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	if _, err := HeaderFromTar(bytes.NewReader(buf.Bytes()), 3); err == nil {
+		t.Errorf("expected an error for a sequence beyond the last entry")
+	}
+}
+
+func TestVisitFileMetadataFromTar_Policy(t *testing.T) {
+	writeTar := func(t *testing.T, headers ...*tar.Header) []byte {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, header := range headers {
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatalf("could not write header: %+v", err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("could not close tar: %+v", err)
+		}
+		return buf.Bytes()
+	}
+
+	unsupported := writeTar(t,
+		&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0644},
+		&tar.Header{Typeflag: 'Z', Name: "unknown", Mode: 0644},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "b.txt", Mode: 0644},
+	)
+
+	// corrupt the checksum of the second header (each header is a single 512 byte block since there is no content)
+	malformed := writeTar(t,
+		&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0644},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "b.txt", Mode: 0644},
+	)
+	malformed[512+148] = 'x'
+
+	tests := []struct {
+		name          string
+		tar           []byte
+		policy        TarEntryPolicy
+		expectedPaths []string
+		expectedErr   error
+	}{
+		{
+			name:          "lenient skips unsupported entries",
+			tar:           unsupported,
+			policy:        LenientTarEntries,
+			expectedPaths: []string{"/a.txt", "/b.txt"},
+		},
+		{
+			name:          "strict fails on unsupported entries",
+			tar:           unsupported,
+			policy:        StrictTarEntries,
+			expectedPaths: []string{"/a.txt"},
+			expectedErr:   ErrUnsupportedTarEntry,
+		},
+		{
+			name:          "lenient keeps entries before a malformed header",
+			tar:           malformed,
+			policy:        LenientTarEntries,
+			expectedPaths: []string{"/a.txt"},
+		},
+		{
+			name:          "strict fails on malformed headers",
+			tar:           malformed,
+			policy:        StrictTarEntries,
+			expectedPaths: []string{"/a.txt"},
+			expectedErr:   ErrMalformedTar,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var paths []string
+			err := VisitFileMetadataFromTar(bytes.NewReader(test.tar), test.policy, func(metadata Metadata) error {
+				paths = append(paths, metadata.Path)
+				return nil
+			})
+
+			if test.expectedErr == nil && err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %+v, got %+v", test.expectedErr, err)
+			}
+
+			if len(paths) != len(test.expectedPaths) {
+				t.Fatalf("unexpected paths: %+v", paths)
+			}
+			for idx, p := range test.expectedPaths {
+				if paths[idx] != p {
+					t.Errorf("unexpected path at %d: %q", idx, paths[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestVisitFileMetadataAndContentsFromTarWithSkips(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0644},
+		{Typeflag: 'Z', Name: "unknown", Mode: 0644},
+		{Typeflag: tar.TypeReg, Name: "../../escape.txt", Mode: 0644},
+		{Typeflag: tar.TypeReg, Name: "b.txt", Mode: 0644},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+	contents := buf.Bytes()
+	// corrupt the checksum of the last header (each header is a single 512 byte block since there is no content)
+	contents[3*512+148] = 'x'
+
+	var paths []string
+	var skipped []SkippedTarEntry
+	err := VisitFileMetadataAndContentsFromTarWithSkips(bytes.NewReader(contents), LenientTarEntries, func(metadata Metadata, _ io.Reader) error {
+		paths = append(paths, metadata.Path)
+		return nil
+	}, func(entry SkippedTarEntry) {
+		skipped = append(skipped, entry)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expectedPaths := []string{"/a.txt", "/escape.txt"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("unexpected paths: %+v", paths)
+	}
+
+	expected := []struct {
+		path     string
+		sequence int64
+		reason   SkipReason
+	}{
+		{path: "/unknown", sequence: 1, reason: UnsupportedTarEntry},
+		{path: "/escape.txt", sequence: 2, reason: SanitizedTarEntry},
+		{path: "", sequence: 3, reason: MalformedTarEntry},
+	}
+	if len(skipped) != len(expected) {
+		t.Fatalf("unexpected skipped entries: %+v", skipped)
+	}
+	for idx, e := range expected {
+		actual := skipped[idx]
+		if actual.Path != e.path || actual.TarSequence != e.sequence || actual.Reason != e.reason {
+			t.Errorf("unexpected skipped entry at %d: %+v", idx, actual)
+		}
+		if actual.Detail == "" {
+			t.Errorf("expected a detail for skipped entry at %d", idx)
+		}
+	}
+}
+
 func TestEnumerateFileMetadataFromTar_GoCase(t *testing.T) {
 	tarReader, cleanup := getTarFixture(t, "fixture-1")
 	defer cleanup()
 
 	expected := []Metadata{
-		{Path: "/path", TarHeaderName: "path/", TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
-		{Path: "/path/branch", TarHeaderName: "path/branch/", TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
-		{Path: "/path/branch/one", TarHeaderName: "path/branch/one/", TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o700, UserID: 1337, GroupID: 5432, IsDir: true},
-		{Path: "/path/branch/one/file-1.txt", TarHeaderName: "path/branch/one/file-1.txt", TypeFlag: 48, Linkname: "", Size: 11, Mode: 0o700, UserID: 1337, GroupID: 5432, IsDir: false},
-		{Path: "/path/branch/two", TarHeaderName: "path/branch/two/", TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
-		{Path: "/path/branch/two/file-2.txt", TarHeaderName: "path/branch/two/file-2.txt", TypeFlag: 48, Linkname: "", Size: 12, Mode: 0o755, UserID: 1337, GroupID: 5432, IsDir: false},
-		{Path: "/path/file-3.txt", TarHeaderName: "path/file-3.txt", TypeFlag: 48, Linkname: "", Size: 11, Mode: 0o664, UserID: 1337, GroupID: 5432, IsDir: false},
+		{Path: "/path", TarHeaderName: "path/", TarSequence: 0, TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
+		{Path: "/path/branch", TarHeaderName: "path/branch/", TarSequence: 1, TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
+		{Path: "/path/branch/one", TarHeaderName: "path/branch/one/", TarSequence: 2, TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o700, UserID: 1337, GroupID: 5432, IsDir: true},
+		{Path: "/path/branch/one/file-1.txt", TarHeaderName: "path/branch/one/file-1.txt", TarSequence: 3, TypeFlag: 48, Linkname: "", Size: 11, Mode: 0o700, UserID: 1337, GroupID: 5432, IsDir: false},
+		{Path: "/path/branch/two", TarHeaderName: "path/branch/two/", TarSequence: 4, TypeFlag: 53, Linkname: "", Size: 0, Mode: os.ModeDir | 0o755, UserID: 1337, GroupID: 5432, IsDir: true},
+		{Path: "/path/branch/two/file-2.txt", TarHeaderName: "path/branch/two/file-2.txt", TarSequence: 5, TypeFlag: 48, Linkname: "", Size: 12, Mode: 0o755, UserID: 1337, GroupID: 5432, IsDir: false},
+		{Path: "/path/file-3.txt", TarHeaderName: "path/file-3.txt", TarSequence: 6, TypeFlag: 48, Linkname: "", Size: 11, Mode: 0o664, UserID: 1337, GroupID: 5432, IsDir: false},
 	}
 
 	idx := 0
@@ -147,7 +343,15 @@ func TestEnumerateFileMetadataFromTar_GoCase(t *testing.T) {
 		if len(expected) <= idx {
 			t.Fatal("more metadata files than expected!")
 		}
-		if metadata != expected[idx] {
+		// the fixture modification times depend on when the fixture was generated, so only ensure they are present
+		if metadata.ModTime.IsZero() || metadata.ModTime.Location() != time.UTC {
+			t.Errorf("expected a UTC modification time, got: %+v", metadata.ModTime)
+		}
+		metadata.ModTime = time.Time{}
+		metadata.AccessTime = time.Time{}
+		metadata.ChangeTime = time.Time{}
+
+		if !reflect.DeepEqual(metadata, expected[idx]) {
 			t.Logf("Mode: actual:%d expected:%d", metadata.Mode, expected[idx].Mode)
 			t.Errorf("unexpected file metadata:\n\texpected: %+v\n\tgot     : %+v\n", expected[idx], metadata)
 
@@ -159,3 +363,139 @@ func TestEnumerateFileMetadataFromTar_GoCase(t *testing.T) {
 		t.Errorf("unexpected length: %d != %d", len(expected), idx)
 	}
 }
+
+func TestEnumerateFileMetadataFromTar_SubSecondModTime(t *testing.T) {
+	modTime := time.Date(2020, 10, 1, 12, 30, 45, 123456789, time.FixedZone("EST", -5*60*60))
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	contents := []byte("contents")
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "some/file.txt",
+		Size:     int64(len(contents)),
+		Mode:     0o644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		t.Fatalf("could not write header: %+v", err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		t.Fatalf("could not write contents: %+v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	var actual []Metadata
+	for metadata := range EnumerateFileMetadataFromTar(buf) {
+		actual = append(actual, metadata)
+	}
+
+	if len(actual) != 1 {
+		t.Fatalf("unexpected number of entries: %d", len(actual))
+	}
+
+	if !actual[0].ModTime.Equal(modTime) {
+		t.Errorf("unexpected mod time: %+v != %+v", actual[0].ModTime, modTime)
+	}
+
+	if actual[0].ModTime.Location() != time.UTC {
+		t.Errorf("expected mod time in UTC, got: %+v", actual[0].ModTime.Location())
+	}
+
+	if actual[0].ModTime.Nanosecond() != modTime.Nanosecond() {
+		t.Errorf("sub-second precision lost: %d != %d", actual[0].ModTime.Nanosecond(), modTime.Nanosecond())
+	}
+}
+
+func TestEnumerateFileMetadataFromTar_Xattrs(t *testing.T) {
+	capability := string([]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []*tar.Header{
+		{
+			Typeflag: tar.TypeReg,
+			Name:     "bin/ping",
+			Mode:     0o755,
+			Format:   tar.FormatPAX,
+			PAXRecords: map[string]string{
+				"SCHILY.xattr." + CapabilityXattr: capability,
+				"SCHILY.xattr.user.comment":       "ping",
+				"comment":                         "not an xattr",
+			},
+		},
+		{
+			Typeflag: tar.TypeReg,
+			Name:     "bin/sh",
+			Mode:     0o755,
+		},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	var actual []Metadata
+	for metadata := range EnumerateFileMetadataFromTar(buf) {
+		actual = append(actual, metadata)
+	}
+
+	if len(actual) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(actual))
+	}
+
+	expected := map[string]string{
+		CapabilityXattr: capability,
+		"user.comment":  "ping",
+	}
+	if !reflect.DeepEqual(actual[0].Xattrs, expected) {
+		t.Errorf("unexpected xattrs: %+v", actual[0].Xattrs)
+	}
+	if actual[1].Xattrs != nil {
+		t.Errorf("expected no xattrs: %+v", actual[1].Xattrs)
+	}
+
+	capabilities, ok, err := actual[0].Capabilities()
+	if !ok || err != nil {
+		t.Fatalf("expected capabilities: ok=%v err=%+v", ok, err)
+	}
+	if capabilities.Permitted != 1<<13 {
+		t.Errorf("unexpected capabilities: %+v", capabilities)
+	}
+}
+
+func TestEnumerateFileMetadataFromTar_OwnerNames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "home/app/.profile", Mode: 0o644, Uid: 1000, Gid: 50, Uname: "app", Gname: "staff"},
+		{Typeflag: tar.TypeReg, Name: "etc/hosts", Mode: 0o644},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	var actual []Metadata
+	for metadata := range EnumerateFileMetadataFromTar(buf) {
+		actual = append(actual, metadata)
+	}
+
+	if len(actual) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(actual))
+	}
+	if actual[0].UserName != "app" || actual[0].GroupName != "staff" || actual[0].UserID != 1000 || actual[0].GroupID != 50 {
+		t.Errorf("unexpected owner: %+v", actual[0])
+	}
+	if actual[1].UserName != "" || actual[1].GroupName != "" {
+		t.Errorf("expected no owner names: %+v", actual[1])
+	}
+}
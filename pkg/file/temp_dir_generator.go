@@ -12,6 +12,15 @@ import (
 type TempDirGenerator struct {
 	tempDir []string
 	lock    *sync.Mutex
+	// root is the dir that all temp dirs are created within (the platform temp dir when empty)
+	root string
+	// parent is the generator that tracks all temp dirs created by this generator (for cleanup)
+	parent *TempDirGenerator
+	// manifest records all temp dirs created for cleanup by later processes (nil when not tracked, see TrackWithManifest)
+	manifest *tempDirManifest
+	// scope is the dir that this generator is confined to, which is removed upon Cleanup (empty when not scoped, see
+	// NewScope)
+	scope string
 }
 
 func NewTempDirGenerator() TempDirGenerator {
@@ -21,21 +30,106 @@ func NewTempDirGenerator() TempDirGenerator {
 	}
 }
 
-// NewTempDir creates an empty dir in the platform temp dir
+// WithRoot provides a generator that creates temp dirs within the given root dir instead of the platform temp dir. All
+// temp dirs created are still removed by the Cleanup of this generator.
+func (t *TempDirGenerator) WithRoot(root string) *TempDirGenerator {
+	return &TempDirGenerator{
+		lock:   &sync.Mutex{},
+		root:   root,
+		parent: t,
+	}
+}
+
+// NewScope creates a temp dir (tracked by this generator) and provides a generator that creates all temp dirs within
+// it, isolating the temp dirs of a single consumer (e.g. an image). The Cleanup of the returned generator only removes
+// the scope (and all temp dirs within it), while the Cleanup of this generator removes the scope as well.
+func (t *TempDirGenerator) NewScope() (*TempDirGenerator, error) {
+	dir, err := t.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+	return &TempDirGenerator{
+		lock:  &sync.Mutex{},
+		root:  dir,
+		scope: dir,
+	}, nil
+}
+
+// NewTempDir creates an empty dir in the platform temp dir (or the root dir, see WithRoot)
 func (t *TempDirGenerator) NewTempDir() (string, error) {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+	tracker := t
+	if t.parent != nil {
+		tracker = t.parent
+	}
 
-	dir, err := ioutil.TempDir("", "stereoscope-cache")
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	dir, err := ioutil.TempDir(t.root, tempDirPrefix)
 	if err != nil {
 		return "", fmt.Errorf("could not create temp dir: %w", err)
 	}
 
-	t.tempDir = append(t.tempDir, dir)
+	tracker.tempDir = append(tracker.tempDir, dir)
+	if tracker.manifest != nil {
+		if err := tracker.manifest.record(dir); err != nil {
+			return "", err
+		}
+	}
 	return dir, nil
 }
 
+// TempDirs returns all temp dirs created by this generator (and all generators sharing its tracking, see WithRoot)
+// that have not been removed.
+func (t *TempDirGenerator) TempDirs() []string {
+	tracker := t
+	if t.parent != nil {
+		tracker = t.parent
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	return append([]string{}, tracker.tempDir...)
+}
+
+// Remove removes the given temp dirs (created by this generator) ahead of Cleanup, for temp dirs that are no longer
+// needed. Dirs that are not tracked by this generator are left as-is.
+func (t *TempDirGenerator) Remove(dirs ...string) error {
+	tracker := t
+	if t.parent != nil {
+		tracker = t.parent
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	remove := make(map[string]bool)
+	for _, dir := range dirs {
+		remove[dir] = true
+	}
+
+	var allErrors error
+	var remaining = make([]string, 0, len(tracker.tempDir))
+	for _, dir := range tracker.tempDir {
+		if !remove[dir] {
+			remaining = append(remaining, dir)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			allErrors = multierror.Append(allErrors, err)
+			remaining = append(remaining, dir)
+		}
+	}
+	tracker.tempDir = remaining
+	return allErrors
+}
+
 func (t *TempDirGenerator) Cleanup() error {
+	if t.parent != nil {
+		return t.parent.Cleanup()
+	}
+
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
@@ -46,5 +140,15 @@ func (t *TempDirGenerator) Cleanup() error {
 			allErrors = multierror.Append(allErrors, err)
 		}
 	}
+	if t.scope != "" {
+		if err := os.RemoveAll(t.scope); err != nil {
+			allErrors = multierror.Append(allErrors, err)
+		}
+	}
+	if t.manifest != nil && allErrors == nil {
+		if err := t.manifest.reset(); err != nil {
+			allErrors = multierror.Append(allErrors, err)
+		}
+	}
 	return allErrors
 }
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempDirGenerator_WithRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "stereoscope-root-")
+	if err != nil {
+		t.Fatalf("could not create root dir: %+v", err)
+	}
+	defer os.RemoveAll(root)
+
+	generator := NewTempDirGenerator()
+	dir, err := generator.WithRoot(root).NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+
+	if filepath.Dir(dir) != root {
+		t.Errorf("expected temp dir within root=%q, got %q", root, dir)
+	}
+
+	if err := generator.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup: %+v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected temp dir to be removed: %+v", err)
+	}
+}
+
+func TestTempDirGenerator_NewScope(t *testing.T) {
+	generator := NewTempDirGenerator()
+	defer generator.Cleanup()
+
+	first, err := generator.NewScope()
+	if err != nil {
+		t.Fatalf("could not create scope: %+v", err)
+	}
+	second, err := generator.NewScope()
+	if err != nil {
+		t.Fatalf("could not create scope: %+v", err)
+	}
+
+	firstDir, err := first.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	secondDir, err := second.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	if filepath.Dir(firstDir) == filepath.Dir(secondDir) {
+		t.Errorf("expected temp dirs within separate scopes, got %q and %q", firstDir, secondDir)
+	}
+
+	// cleaning up a scope leaves other scopes alone
+	if err := first.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(firstDir)); !os.IsNotExist(err) {
+		t.Errorf("expected scope to be removed: %+v", err)
+	}
+	if _, err := os.Stat(secondDir); err != nil {
+		t.Errorf("expected other scope to remain: %+v", err)
+	}
+
+	// cleaning up the generator removes all scopes
+	if err := generator.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(secondDir)); !os.IsNotExist(err) {
+		t.Errorf("expected scope to be removed: %+v", err)
+	}
+}
+
+func TestTempDirGenerator_Remove(t *testing.T) {
+	generator := NewTempDirGenerator()
+	defer generator.Cleanup()
+
+	first, err := generator.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	second, err := generator.WithRoot(first).NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	third, err := generator.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+
+	if err := generator.Remove(first, "/not/tracked"); err != nil {
+		t.Fatalf("could not remove: %+v", err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("expected temp dir to be removed: %+v", err)
+	}
+	if _, err := os.Stat(third); err != nil {
+		t.Errorf("expected other temp dir to remain: %+v", err)
+	}
+
+	dirs := generator.TempDirs()
+	if len(dirs) != 2 || dirs[0] != second || dirs[1] != third {
+		t.Errorf("unexpected temp dirs: %+v", dirs)
+	}
+}
+
+func TestTempDirGenerator_TrackWithManifest(t *testing.T) {
+	manifestDir, err := ioutil.TempDir("", "stereoscope-manifests-")
+	if err != nil {
+		t.Fatalf("could not create manifest dir: %+v", err)
+	}
+	defer os.RemoveAll(manifestDir)
+
+	// a process that is still running (the manifest stays locked)
+	running := NewTempDirGenerator()
+	if err := running.TrackWithManifest(manifestDir); err != nil {
+		t.Fatalf("could not track temp dirs: %+v", err)
+	}
+	runningDir, err := running.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer running.Cleanup()
+
+	// a process that was killed (the manifest lock is released without cleanup)
+	crashed := NewTempDirGenerator()
+	beforeTracking, err := crashed.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	if err := crashed.TrackWithManifest(manifestDir); err != nil {
+		t.Fatalf("could not track temp dirs: %+v", err)
+	}
+	afterTracking, err := crashed.NewTempDir()
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	if err := crashed.manifest.lock.Release(); err != nil {
+		t.Fatalf("could not release manifest lock: %+v", err)
+	}
+
+	removed, err := CleanupOrphanedTempDirs(manifestDir)
+	if err != nil {
+		t.Fatalf("could not cleanup orphans: %+v", err)
+	}
+
+	if len(removed) != 2 || removed[0] != beforeTracking || removed[1] != afterTracking {
+		t.Errorf("unexpected removed dirs: %+v", removed)
+	}
+	for _, dir := range []string{beforeTracking, afterTracking} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected orphaned dir=%q to be removed: %+v", dir, err)
+		}
+	}
+	if _, err := os.Stat(runningDir); err != nil {
+		t.Errorf("expected dir of running process to remain: %+v", err)
+	}
+	if _, err := os.Stat(crashed.manifest.path); !os.IsNotExist(err) {
+		t.Errorf("expected orphaned manifest to be removed: %+v", err)
+	}
+
+	// cleanup of the running process forgets its temp dirs
+	if err := running.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup: %+v", err)
+	}
+	dirs, err := readTempDirManifest(running.manifest.path)
+	if err != nil {
+		t.Fatalf("could not read manifest: %+v", err)
+	}
+	if len(dirs) != 0 {
+		t.Errorf("expected an empty manifest after cleanup: %+v", dirs)
+	}
+}
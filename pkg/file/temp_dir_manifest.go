@@ -0,0 +1,181 @@
+package file
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/filelock"
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// tempDirPrefix is the name prefix of all temp dirs created by a TempDirGenerator.
+	tempDirPrefix = "stereoscope-cache"
+	// tempDirManifestSuffix is the name suffix of all manifest files within a manifest dir.
+	tempDirManifestSuffix = ".manifest"
+)
+
+// tempDirManifest is a file within a manifest dir that records all temp dirs created by a single process. The file is
+// locked for as long as the process runs (the lock is released by the OS even if the process is killed), so a manifest
+// that is not locked belongs to a process that is gone.
+type tempDirManifest struct {
+	path string
+	lock *filelock.Lock
+}
+
+// newTempDirManifest creates a new (locked) manifest file within the given manifest dir.
+func newTempDirManifest(manifestDir string) (*tempDirManifest, error) {
+	if err := os.MkdirAll(manifestDir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create temp dir manifest dir=%q: %w", manifestDir, err)
+	}
+
+	fh, err := ioutil.TempFile(manifestDir, fmt.Sprintf("%d-*%s", os.Getpid(), tempDirManifestSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temp dir manifest: %w", err)
+	}
+	fh.Close()
+
+	lock, err := filelock.TryAcquire(fh.Name())
+	if err != nil {
+		os.Remove(fh.Name())
+		return nil, fmt.Errorf("unable to lock temp dir manifest: %w", err)
+	}
+
+	return &tempDirManifest{path: fh.Name(), lock: lock}, nil
+}
+
+// record appends the given temp dirs to the manifest.
+func (m *tempDirManifest) record(dirs ...string) error {
+	fh, err := os.OpenFile(m.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open temp dir manifest=%q: %w", m.path, err)
+	}
+	for _, dir := range dirs {
+		if _, err := fmt.Fprintln(fh, dir); err != nil {
+			fh.Close()
+			return fmt.Errorf("unable to record temp dir=%q: %w", dir, err)
+		}
+	}
+	return fh.Close()
+}
+
+// reset forgets all recorded temp dirs (once they have been removed).
+func (m *tempDirManifest) reset() error {
+	return os.Truncate(m.path, 0)
+}
+
+// TrackWithManifest records every temp dir created by this generator (including those already created) within a
+// manifest file in the given manifest dir, so that the temp dirs can be removed by CleanupOrphanedTempDirs should this
+// process exit without calling Cleanup (e.g. when killed). The manifest is locked while this process runs, so temp dirs
+// of running processes are never removed. This is a no-op if the generator already tracks its temp dirs.
+func (t *TempDirGenerator) TrackWithManifest(manifestDir string) error {
+	tracker := t
+	if t.parent != nil {
+		tracker = t.parent
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if tracker.manifest != nil {
+		return nil
+	}
+
+	manifest, err := newTempDirManifest(manifestDir)
+	if err != nil {
+		return err
+	}
+	if err := manifest.record(tracker.tempDir...); err != nil {
+		return err
+	}
+	tracker.manifest = manifest
+	return nil
+}
+
+// CleanupOrphanedTempDirs removes all temp dirs recorded within the given manifest dir by processes that are no longer
+// running (see TempDirGenerator.TrackWithManifest), returning the temp dirs removed. Only dirs named as created by a
+// TempDirGenerator are removed. Note: on platforms without advisory file locks it cannot be determined if a process is
+// still running, so nothing is removed.
+func CleanupOrphanedTempDirs(manifestDir string) ([]string, error) {
+	manifests, err := filepath.Glob(filepath.Join(manifestDir, "*"+tempDirManifestSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list temp dir manifests within dir=%q: %w", manifestDir, err)
+	}
+
+	var removed []string
+	var allErrors error
+	for _, manifestPath := range manifests {
+		dirs, err := cleanupOrphanedManifest(manifestPath)
+		removed = append(removed, dirs...)
+		if err != nil {
+			allErrors = multierror.Append(allErrors, err)
+		}
+	}
+	return removed, allErrors
+}
+
+// cleanupOrphanedManifest removes all temp dirs recorded within the given manifest (and the manifest itself), unless
+// the manifest is locked by a running process.
+func cleanupOrphanedManifest(manifestPath string) ([]string, error) {
+	lock, err := filelock.TryAcquire(manifestPath)
+	if errors.Is(err, filelock.ErrLocked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	dirs, err := readTempDirManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, dir := range dirs {
+		if !strings.HasPrefix(filepath.Base(dir), tempDirPrefix) {
+			log.Debugf("not removing unexpected temp dir=%q from manifest=%q", dir, manifestPath)
+			continue
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("unable to remove orphaned temp dir=%q: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+
+	// note: the manifest is removed while locked, any process waiting on it will find nothing to remove
+	if err := os.Remove(manifestPath); err != nil {
+		return removed, fmt.Errorf("unable to remove temp dir manifest=%q: %w", manifestPath, err)
+	}
+	return removed, nil
+}
+
+// readTempDirManifest returns all temp dirs recorded within the given manifest.
+func readTempDirManifest(manifestPath string) ([]string, error) {
+	fh, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open temp dir manifest=%q: %w", manifestPath, err)
+	}
+	defer fh.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			dirs = append(dirs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read temp dir manifest=%q: %w", manifestPath, err)
+	}
+	return dirs, nil
+}
@@ -7,6 +7,22 @@ const (
 	TypeDir      Type = tar.TypeDir
 	TypeSymlink  Type = tar.TypeSymlink
 	TypeHardLink Type = tar.TypeLink
+	// TypeCharacterDevice and TypeBlockDevice are device nodes (see Metadata.DevMajor and Metadata.DevMinor).
+	TypeCharacterDevice Type = tar.TypeChar
+	TypeBlockDevice     Type = tar.TypeBlock
+	TypeFifo            Type = tar.TypeFifo
+	// TypeSocket is a unix domain socket. Note: sockets cannot be represented within a tar, so these are never found
+	// within layer trees (only within trees built by other means).
+	TypeSocket Type = 'S'
 )
 
 type Type rune
+
+// IsSpecial indicates that the type is a device node, FIFO, or socket (a file without contents of its own).
+func (t Type) IsSpecial() bool {
+	switch t {
+	case TypeCharacterDevice, TypeBlockDevice, TypeFifo, TypeSocket:
+		return true
+	}
+	return false
+}
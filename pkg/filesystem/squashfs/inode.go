@@ -0,0 +1,232 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// inode types (extended types carry additional fields, e.g. xattrs or larger sizes)
+const (
+	basicDirectory = iota + 1
+	basicFile
+	basicSymlink
+	basicBlockDevice
+	basicCharDevice
+	basicFifo
+	basicSocket
+	extendedDirectory
+	extendedFile
+	extendedSymlink
+	extendedBlockDevice
+	extendedCharDevice
+	extendedFifo
+	extendedSocket
+)
+
+// inodeHeader is common to all inode types.
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UIDIndex    uint16
+	GIDIndex    uint16
+	ModTime     uint32
+	Number      uint32
+}
+
+// inode is a single directory, file, link, device, or IPC entry.
+type inode struct {
+	inodeHeader
+	uid uint32
+	gid uint32
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// regular files
+	blocksStart    uint64
+	size           uint64
+	fragment       uint32
+	fragmentOffset uint32
+	blockSizes     []uint32
+
+	// symlinks
+	target string
+
+	// devices
+	device uint32
+}
+
+// basicType returns the basic inode type for the inode (extended types are mapped to their basic counterpart).
+func (i *inode) basicType() uint16 {
+	if i.Type >= extendedDirectory {
+		return i.Type - extendedDirectory + basicDirectory
+	}
+	return i.Type
+}
+
+// readInode reads the inode at the given offset within the inode table metadata block at the given position (relative
+// to the start of the inode table).
+func (r *Reader) readInode(block uint64, offset uint16) (*inode, error) {
+	m, err := r.newMetadataReader(int64(r.sb.InodeTableStart+block), int(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	var in inode
+	if err := binary.Read(m, binary.LittleEndian, &in.inodeHeader); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs inode header: %w", err)
+	}
+	if in.uid, err = r.id(in.UIDIndex); err != nil {
+		return nil, err
+	}
+	if in.gid, err = r.id(in.GIDIndex); err != nil {
+		return nil, err
+	}
+
+	switch in.Type {
+	case basicDirectory:
+		err = in.readBasicDirectory(m)
+	case extendedDirectory:
+		err = in.readExtendedDirectory(m)
+	case basicFile:
+		err = in.readBasicFile(m, r.sb.BlockSize)
+	case extendedFile:
+		err = in.readExtendedFile(m, r.sb.BlockSize)
+	case basicSymlink, extendedSymlink:
+		err = in.readSymlink(m)
+	case basicBlockDevice, basicCharDevice, extendedBlockDevice, extendedCharDevice:
+		var fields struct {
+			LinkCount uint32
+			Device    uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &fields)
+		in.device = fields.Device
+	case basicFifo, basicSocket, extendedFifo, extendedSocket:
+		// note: only the link count follows (and an xattr index for extended types), which is not needed
+	default:
+		return nil, fmt.Errorf("unsupported squashfs inode type=%d", in.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read squashfs inode=%d: %w", in.Number, err)
+	}
+	return &in, nil
+}
+
+// readInodeRef reads the inode for a packed inode reference (the metadata block position in the upper bits and the
+// offset within the block in the lower 16 bits).
+func (r *Reader) readInodeRef(ref uint64) (*inode, error) {
+	return r.readInode(ref>>16, uint16(ref&0xffff))
+}
+
+func (i *inode) readBasicDirectory(m io.Reader) error {
+	var fields struct {
+		BlockIndex  uint32
+		LinkCount   uint32
+		FileSize    uint16
+		BlockOffset uint16
+		ParentInode uint32
+	}
+	if err := binary.Read(m, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+	i.dirBlock = fields.BlockIndex
+	i.dirOffset = fields.BlockOffset
+	i.dirSize = uint32(fields.FileSize)
+	return nil
+}
+
+func (i *inode) readExtendedDirectory(m io.Reader) error {
+	var fields struct {
+		LinkCount   uint32
+		FileSize    uint32
+		BlockIndex  uint32
+		ParentInode uint32
+		IndexCount  uint16
+		BlockOffset uint16
+		XattrIndex  uint32
+	}
+	if err := binary.Read(m, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+	i.dirBlock = fields.BlockIndex
+	i.dirOffset = fields.BlockOffset
+	i.dirSize = fields.FileSize
+	return nil
+}
+
+func (i *inode) readBasicFile(m io.Reader, blockSize uint32) error {
+	var fields struct {
+		BlocksStart    uint32
+		Fragment       uint32
+		FragmentOffset uint32
+		FileSize       uint32
+	}
+	if err := binary.Read(m, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+	i.blocksStart = uint64(fields.BlocksStart)
+	i.fragment = fields.Fragment
+	i.fragmentOffset = fields.FragmentOffset
+	i.size = uint64(fields.FileSize)
+	return i.readBlockSizes(m, blockSize)
+}
+
+func (i *inode) readExtendedFile(m io.Reader, blockSize uint32) error {
+	var fields struct {
+		BlocksStart    uint64
+		FileSize       uint64
+		Sparse         uint64
+		LinkCount      uint32
+		Fragment       uint32
+		FragmentOffset uint32
+		XattrIndex     uint32
+	}
+	if err := binary.Read(m, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+	i.blocksStart = fields.BlocksStart
+	i.fragment = fields.Fragment
+	i.fragmentOffset = fields.FragmentOffset
+	i.size = fields.FileSize
+	return i.readBlockSizes(m, blockSize)
+}
+
+// readBlockSizes reads the encoded size of each full data block of the file (the tail is within a fragment block when
+// the file has a fragment).
+func (i *inode) readBlockSizes(m io.Reader, blockSize uint32) error {
+	count := i.size / uint64(blockSize)
+	if i.fragment == noFragment && i.size%uint64(blockSize) != 0 {
+		count++
+	}
+	i.blockSizes = make([]uint32, count)
+	return binary.Read(m, binary.LittleEndian, i.blockSizes)
+}
+
+func (i *inode) readSymlink(m io.Reader) error {
+	var fields struct {
+		LinkCount  uint32
+		TargetSize uint32
+	}
+	if err := binary.Read(m, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+	target := make([]byte, fields.TargetSize)
+	if _, err := io.ReadFull(m, target); err != nil {
+		return err
+	}
+	i.target = string(target)
+	return nil
+}
+
+// devMajor returns the major number of a device inode (from the linux device number encoding).
+func (i *inode) devMajor() int64 {
+	return int64((i.device & 0xfff00) >> 8)
+}
+
+// devMinor returns the minor number of a device inode (from the linux device number encoding).
+func (i *inode) devMinor() int64 {
+	return int64((i.device & 0xff) | ((i.device >> 12) & 0xfff00))
+}
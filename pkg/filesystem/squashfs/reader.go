@@ -0,0 +1,359 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// magic is the leading bytes of a squashfs image ("hsqs").
+	magic = 0x73717368
+	// superblockSize is the size of the superblock at the start of a squashfs image.
+	superblockSize = 96
+	// metadataBlockSize is the maximum (uncompressed) size of a metadata block.
+	metadataBlockSize = 8192
+	// metadataUncompressed is set within a metadata block header when the block is stored uncompressed.
+	metadataUncompressed = 0x8000
+	// dataUncompressed is set within a data block size when the block is stored uncompressed.
+	dataUncompressed = 1 << 24
+	// noFragment is the fragment index of a file without a tail within a fragment block.
+	noFragment = 0xffffffff
+	// fragmentEntrySize is the size of a single fragment table entry.
+	fragmentEntrySize = 16
+	// idEntrySize is the size of a single id table entry.
+	idEntrySize = 4
+)
+
+// compression ids of the superblock (only zlib is supported, other compressors are not available within the stdlib).
+const (
+	zlibCompression = 1
+	lzmaCompression = 2
+	lzoCompression  = 3
+	xzCompression   = 4
+	lz4Compression  = 5
+	zstdCompression = 6
+)
+
+var compressionNames = map[uint16]string{
+	zlibCompression: "gzip",
+	lzmaCompression: "lzma",
+	lzoCompression:  "lzo",
+	xzCompression:   "xz",
+	lz4Compression:  "lz4",
+	zstdCompression: "zstd",
+}
+
+// ErrNotSquashfs is returned when the content is not a squashfs (v4) image.
+var ErrNotSquashfs = errors.New("not a squashfs image")
+
+// superblock is the header of a squashfs image.
+type superblock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModTime             uint32
+	BlockSize           uint32
+	FragmentCount       uint32
+	Compression         uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrTableStart     uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+// fragmentEntry is the location of a fragment block (which holds the tails of several files).
+type fragmentEntry struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+// metadataBlock is a single decompressed metadata block along with the location of the block that follows it.
+type metadataBlock struct {
+	data []byte
+	next int64
+}
+
+// Reader reads the directories, files, and links within a squashfs (v4) image.
+type Reader struct {
+	r          io.ReaderAt
+	sb         superblock
+	ids        []uint32
+	fragments  []fragmentEntry
+	metadata   map[int64]metadataBlock
+	lastFrag   int64
+	lastFragBy []byte
+}
+
+// IsSquashfs indicates if the given leading bytes of some content are the start of a squashfs image.
+func IsSquashfs(header []byte) bool {
+	return len(header) >= 4 && binary.LittleEndian.Uint32(header) == magic
+}
+
+// NewReader parses the superblock, id table, and fragment table of the squashfs image within the given content.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	reader := &Reader{
+		r:        r,
+		metadata: make(map[int64]metadataBlock),
+		lastFrag: -1,
+	}
+
+	header := make([]byte, superblockSize)
+	if err := reader.readAt(header, 0); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs superblock: %w", err)
+	}
+	if !IsSquashfs(header) {
+		return nil, ErrNotSquashfs
+	}
+	if err := binary.Read(bytes.NewReader(header), binary.LittleEndian, &reader.sb); err != nil {
+		return nil, fmt.Errorf("unable to parse squashfs superblock: %w", err)
+	}
+	if reader.sb.VersionMajor != 4 {
+		return nil, fmt.Errorf("unsupported squashfs version=%d.%d", reader.sb.VersionMajor, reader.sb.VersionMinor)
+	}
+	if reader.sb.BlockSize == 0 {
+		return nil, fmt.Errorf("invalid squashfs block size=%d", reader.sb.BlockSize)
+	}
+
+	var err error
+	reader.ids, err = reader.readIDs()
+	if err != nil {
+		return nil, err
+	}
+	reader.fragments, err = reader.readFragments()
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Compression returns the name of the compressor used for the squashfs image (e.g. "gzip" or "xz").
+func (r *Reader) Compression() string {
+	if name, ok := compressionNames[r.sb.Compression]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", r.sb.Compression)
+}
+
+// readAt fills the given buffer from the given position within the image.
+func (r *Reader) readAt(buf []byte, pos int64) error {
+	n, err := r.r.ReadAt(buf, pos)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decompress decompresses a single (data or metadata) block.
+func (r *Reader) decompress(data []byte) ([]byte, error) {
+	if r.sb.Compression != zlibCompression {
+		return nil, fmt.Errorf("unsupported squashfs compression=%s", r.Compression())
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress squashfs block: %w", err)
+	}
+	defer zr.Close()
+	decompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress squashfs block: %w", err)
+	}
+	return decompressed, nil
+}
+
+// readMetadataBlock reads (and caches) the metadata block at the given position within the image.
+func (r *Reader) readMetadataBlock(pos int64) (metadataBlock, error) {
+	if block, ok := r.metadata[pos]; ok {
+		return block, nil
+	}
+
+	header := make([]byte, 2)
+	if err := r.readAt(header, pos); err != nil {
+		return metadataBlock{}, fmt.Errorf("unable to read squashfs metadata block at=%d: %w", pos, err)
+	}
+	size := binary.LittleEndian.Uint16(header)
+	onDisk := int64(size &^ metadataUncompressed)
+
+	data := make([]byte, onDisk)
+	if err := r.readAt(data, pos+2); err != nil {
+		return metadataBlock{}, fmt.Errorf("unable to read squashfs metadata block at=%d: %w", pos, err)
+	}
+	if size&metadataUncompressed == 0 {
+		var err error
+		data, err = r.decompress(data)
+		if err != nil {
+			return metadataBlock{}, err
+		}
+	}
+
+	block := metadataBlock{data: data, next: pos + 2 + onDisk}
+	r.metadata[pos] = block
+	return block, nil
+}
+
+// metadataReader reads a metadata stream (e.g. the inode or directory table) across metadata blocks.
+type metadataReader struct {
+	reader *Reader
+	next   int64
+	buf    []byte
+}
+
+// newMetadataReader starts reading the metadata stream at the given offset within the block at the given position.
+func (r *Reader) newMetadataReader(pos int64, offset int) (*metadataReader, error) {
+	block, err := r.readMetadataBlock(pos)
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(block.data) {
+		return nil, fmt.Errorf("invalid squashfs metadata offset=%d within block at=%d", offset, pos)
+	}
+	return &metadataReader{
+		reader: r,
+		next:   block.next,
+		buf:    block.data[offset:],
+	}, nil
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if m.next >= int64(m.reader.sb.BytesUsed) {
+			return 0, io.EOF
+		}
+		block, err := m.reader.readMetadataBlock(m.next)
+		if err != nil {
+			return 0, err
+		}
+		m.buf = block.data
+		m.next = block.next
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// readLookupTable reads the given number of entries (of the given size) from the metadata blocks listed by the lookup
+// table at the given position (as used for the id and fragment tables).
+func (r *Reader) readLookupTable(start uint64, count, entrySize int, entries interface{}) error {
+	if count == 0 {
+		return nil
+	}
+	entriesPerBlock := metadataBlockSize / entrySize
+	blockCount := (count + entriesPerBlock - 1) / entriesPerBlock
+
+	locations := make([]uint64, blockCount)
+	raw := make([]byte, 8*blockCount)
+	if err := r.readAt(raw, int64(start)); err != nil {
+		return err
+	}
+	for idx := range locations {
+		locations[idx] = binary.LittleEndian.Uint64(raw[idx*8:])
+	}
+
+	var table bytes.Buffer
+	for _, location := range locations {
+		block, err := r.readMetadataBlock(int64(location))
+		if err != nil {
+			return err
+		}
+		table.Write(block.data)
+	}
+	if table.Len() < count*entrySize {
+		return io.ErrUnexpectedEOF
+	}
+	return binary.Read(bytes.NewReader(table.Bytes()[:count*entrySize]), binary.LittleEndian, entries)
+}
+
+// readIDs reads the table of uid/gid values that inodes refer to by index.
+func (r *Reader) readIDs() ([]uint32, error) {
+	ids := make([]uint32, r.sb.IDCount)
+	if err := r.readLookupTable(r.sb.IDTableStart, len(ids), idEntrySize, ids); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs id table: %w", err)
+	}
+	return ids, nil
+}
+
+// readFragments reads the table of fragment block locations.
+func (r *Reader) readFragments() ([]fragmentEntry, error) {
+	fragments := make([]fragmentEntry, r.sb.FragmentCount)
+	if err := r.readLookupTable(r.sb.FragmentTableStart, len(fragments), fragmentEntrySize, fragments); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs fragment table: %w", err)
+	}
+	return fragments, nil
+}
+
+// id returns the uid/gid value for the given id table index.
+func (r *Reader) id(idx uint16) (uint32, error) {
+	if int(idx) >= len(r.ids) {
+		return 0, fmt.Errorf("invalid squashfs id index=%d", idx)
+	}
+	return r.ids[idx], nil
+}
+
+// readDataBlock reads a single (data or fragment) block of the given encoded size at the given position, providing the
+// given number of (uncompressed) bytes. A block with a size of zero is sparse (all zeros).
+func (r *Reader) readDataBlock(pos int64, encodedSize uint32, expected int) ([]byte, error) {
+	onDisk := encodedSize &^ dataUncompressed
+	if onDisk == 0 {
+		return make([]byte, expected), nil
+	}
+
+	data := make([]byte, onDisk)
+	if err := r.readAt(data, pos); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs data block at=%d: %w", pos, err)
+	}
+	if encodedSize&dataUncompressed == 0 {
+		var err error
+		data, err = r.decompress(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) < expected {
+		return nil, fmt.Errorf("short squashfs data block at=%d: %d < %d bytes", pos, len(data), expected)
+	}
+	return data[:expected], nil
+}
+
+// readFragment reads (and caches the last) fragment block with the given index.
+func (r *Reader) readFragment(idx uint32) ([]byte, error) {
+	if int(idx) >= len(r.fragments) {
+		return nil, fmt.Errorf("invalid squashfs fragment index=%d", idx)
+	}
+	if r.lastFrag == int64(idx) {
+		return r.lastFragBy, nil
+	}
+
+	entry := r.fragments[idx]
+	onDisk := entry.Size &^ dataUncompressed
+	data := make([]byte, onDisk)
+	if err := r.readAt(data, int64(entry.Start)); err != nil {
+		return nil, fmt.Errorf("unable to read squashfs fragment=%d: %w", idx, err)
+	}
+	if entry.Size&dataUncompressed == 0 {
+		var err error
+		data, err = r.decompress(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.lastFrag = int64(idx)
+	r.lastFragBy = data
+	return data, nil
+}
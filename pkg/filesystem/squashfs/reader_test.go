@@ -0,0 +1,398 @@
+package squashfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+const testBlockSize = 4096
+
+// testNode is an entry within a squashfs image built for testing.
+type testNode struct {
+	name     string
+	typ      uint16
+	mode     uint16
+	uid      uint16
+	contents []byte
+	target   string
+	device   uint32
+	children []*testNode
+	// hardlink refers to another node whose inode is shared
+	hardlink *testNode
+
+	number    uint32
+	inodeRef  uint64
+	blocks    []uint32
+	start     uint64
+	fragment  uint32
+	fragStart uint32
+}
+
+// testImageBuilder assembles a squashfs image (all metadata within a single metadata block per table).
+type testImageBuilder struct {
+	t        *testing.T
+	compress bool
+	data     bytes.Buffer
+	fragment bytes.Buffer
+	inodes   bytes.Buffer
+	dirs     bytes.Buffer
+	inodeNum uint32
+}
+
+func (b *testImageBuilder) block(data []byte) ([]byte, bool) {
+	if !b.compress {
+		return data, false
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		b.t.Fatalf("could not compress: %+v", err)
+	}
+	if err := zw.Close(); err != nil {
+		b.t.Fatalf("could not compress: %+v", err)
+	}
+	if buf.Len() >= len(data) {
+		return data, false
+	}
+	return buf.Bytes(), true
+}
+
+func (b *testImageBuilder) metadataBlock(data []byte) []byte {
+	if len(data) > metadataBlockSize {
+		b.t.Fatalf("test metadata exceeds a single block: %d", len(data))
+	}
+	stored, compressed := b.block(data)
+	header := uint16(len(stored))
+	if !compressed {
+		header |= metadataUncompressed
+	}
+	out := make([]byte, 2, 2+len(stored))
+	binary.LittleEndian.PutUint16(out, header)
+	return append(out, stored...)
+}
+
+// writeData writes the data blocks (and collects the tails into the fragment block) of all files.
+func (b *testImageBuilder) writeData(node *testNode) {
+	for _, child := range node.children {
+		b.writeData(child)
+	}
+	if node.typ != basicFile || node.hardlink != nil {
+		return
+	}
+	node.start = uint64(superblockSize + b.data.Len())
+	node.fragment = noFragment
+	contents := node.contents
+	for len(contents) >= testBlockSize {
+		stored, compressed := b.block(contents[:testBlockSize])
+		size := uint32(len(stored))
+		if !compressed {
+			size |= dataUncompressed
+		}
+		b.data.Write(stored)
+		node.blocks = append(node.blocks, size)
+		contents = contents[testBlockSize:]
+	}
+	if len(contents) > 0 {
+		node.fragment = 0
+		node.fragStart = uint32(b.fragment.Len())
+		b.fragment.Write(contents)
+	}
+}
+
+// writeInodes writes the inodes (children first, so directory listings can refer to them) and directory listings.
+func (b *testImageBuilder) writeInodes(node *testNode) {
+	for _, child := range node.children {
+		b.writeInodes(child)
+	}
+	if node.hardlink != nil {
+		return
+	}
+
+	b.inodeNum++
+	node.number = b.inodeNum
+	node.inodeRef = uint64(b.inodes.Len())
+
+	var body bytes.Buffer
+	w := func(v interface{}) {
+		if err := binary.Write(&body, binary.LittleEndian, v); err != nil {
+			b.t.Fatalf("could not write inode: %+v", err)
+		}
+	}
+	w(inodeHeader{Type: node.typ, Permissions: node.mode, UIDIndex: node.uid, GIDIndex: 0, ModTime: 1600000000, Number: node.number})
+
+	switch node.typ {
+	case basicDirectory:
+		listingStart := b.dirs.Len()
+		children := append([]*testNode{}, node.children...)
+		sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+		for _, child := range children {
+			target := child
+			if child.hardlink != nil {
+				target = child.hardlink
+			}
+			w := func(v interface{}) {
+				if err := binary.Write(&b.dirs, binary.LittleEndian, v); err != nil {
+					b.t.Fatalf("could not write directory: %+v", err)
+				}
+			}
+			w(directoryHeader{Count: 0, Start: 0, InodeNumber: target.number})
+			w(directoryEntryHeader{Offset: uint16(target.inodeRef), Type: target.typ, NameSize: uint16(len(child.name) - 1)})
+			b.dirs.WriteString(child.name)
+		}
+		w(struct {
+			BlockIndex  uint32
+			LinkCount   uint32
+			FileSize    uint16
+			BlockOffset uint16
+			ParentInode uint32
+		}{0, 2, uint16(b.dirs.Len() - listingStart + 3), uint16(listingStart), 0})
+	case basicFile:
+		w(struct {
+			BlocksStart    uint32
+			Fragment       uint32
+			FragmentOffset uint32
+			FileSize       uint32
+		}{uint32(node.start), node.fragment, node.fragStart, uint32(len(node.contents))})
+		w(node.blocks)
+	case basicSymlink:
+		w(struct {
+			LinkCount  uint32
+			TargetSize uint32
+		}{1, uint32(len(node.target))})
+		body.WriteString(node.target)
+	case basicCharDevice, basicBlockDevice:
+		w(struct {
+			LinkCount uint32
+			Device    uint32
+		}{1, node.device})
+	case basicFifo, basicSocket:
+		w(uint32(1))
+	}
+	b.inodes.Write(body.Bytes())
+}
+
+// build returns the squashfs image for the given root directory.
+func (b *testImageBuilder) build(root *testNode) []byte {
+	b.writeData(root)
+	b.writeInodes(root)
+
+	var image bytes.Buffer
+	image.Write(make([]byte, superblockSize))
+	image.Write(b.data.Bytes())
+
+	var fragmentCount uint32
+	var fragment fragmentEntry
+	if b.fragment.Len() > 0 {
+		fragmentCount = 1
+		stored, compressed := b.block(b.fragment.Bytes())
+		fragment.Start = uint64(image.Len())
+		fragment.Size = uint32(len(stored))
+		if !compressed {
+			fragment.Size |= dataUncompressed
+		}
+		image.Write(stored)
+	}
+
+	inodeTableStart := uint64(image.Len())
+	image.Write(b.metadataBlock(b.inodes.Bytes()))
+	directoryTableStart := uint64(image.Len())
+	image.Write(b.metadataBlock(b.dirs.Bytes()))
+
+	lookupTable := func(entries interface{}) uint64 {
+		var table bytes.Buffer
+		if err := binary.Write(&table, binary.LittleEndian, entries); err != nil {
+			b.t.Fatalf("could not write table: %+v", err)
+		}
+		blockStart := uint64(image.Len())
+		image.Write(b.metadataBlock(table.Bytes()))
+		start := uint64(image.Len())
+		if err := binary.Write(&image, binary.LittleEndian, blockStart); err != nil {
+			b.t.Fatalf("could not write table: %+v", err)
+		}
+		return start
+	}
+
+	var fragmentTableStart uint64
+	if fragmentCount > 0 {
+		fragmentTableStart = lookupTable([]fragmentEntry{fragment})
+	}
+	ids := []uint32{0, 1000}
+	idTableStart := lookupTable(ids)
+
+	sb := superblock{
+		Magic:               magic,
+		InodeCount:          b.inodeNum,
+		ModTime:             1600000000,
+		BlockSize:           testBlockSize,
+		FragmentCount:       fragmentCount,
+		Compression:         zlibCompression,
+		BlockLog:            12,
+		IDCount:             uint16(len(ids)),
+		VersionMajor:        4,
+		RootInode:           root.inodeRef,
+		BytesUsed:           uint64(image.Len()),
+		IDTableStart:        idTableStart,
+		XattrTableStart:     0xffffffffffffffff,
+		InodeTableStart:     inodeTableStart,
+		DirectoryTableStart: directoryTableStart,
+		FragmentTableStart:  fragmentTableStart,
+		ExportTableStart:    0xffffffffffffffff,
+	}
+
+	result := image.Bytes()
+	var header bytes.Buffer
+	if err := binary.Write(&header, binary.LittleEndian, sb); err != nil {
+		b.t.Fatalf("could not write superblock: %+v", err)
+	}
+	copy(result, header.Bytes())
+	return result
+}
+
+// testImage builds a squashfs image with a variety of entries (with zlib compression when requested).
+func testImage(t *testing.T, compress bool) []byte {
+	t.Helper()
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	app := &testNode{name: "app", typ: basicFile, mode: 0755, uid: 1, contents: large}
+	return (&testImageBuilder{t: t, compress: compress}).build(&testNode{
+		typ:  basicDirectory,
+		mode: 0755,
+		children: []*testNode{
+			{name: "etc", typ: basicDirectory, mode: 0755, children: []*testNode{
+				{name: "os-release", typ: basicFile, mode: 0644, contents: []byte("ID=test\n")},
+				{name: "empty", typ: basicFile, mode: 0644},
+			}},
+			{name: "usr", typ: basicDirectory, mode: 0755, children: []*testNode{
+				app,
+				{name: "app-link", typ: basicFile, hardlink: app},
+				{name: "release", typ: basicSymlink, mode: 0777, target: "../etc/os-release"},
+			}},
+			{name: "dev", typ: basicDirectory, mode: 0755, children: []*testNode{
+				{name: "null", typ: basicCharDevice, mode: 0666, device: 1<<8 | 3},
+				{name: "pipe", typ: basicFifo, mode: 0644},
+				{name: "sock", typ: basicSocket, mode: 0644},
+			}},
+		},
+	})
+}
+
+func TestReader_WriteTar(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+
+	for _, compress := range []bool{false, true} {
+		name := "uncompressed"
+		if compress {
+			name = "zlib"
+		}
+		t.Run(name, func(t *testing.T) {
+			reader, err := NewReader(bytes.NewReader(testImage(t, compress)))
+			if err != nil {
+				t.Fatalf("could not open squashfs: %+v", err)
+			}
+			if reader.Compression() != "gzip" {
+				t.Errorf("unexpected compression: %q", reader.Compression())
+			}
+
+			var buf bytes.Buffer
+			if err := reader.WriteTar(&buf); err != nil {
+				t.Fatalf("could not write tar: %+v", err)
+			}
+
+			type entry struct {
+				typ      byte
+				mode     int64
+				uid      int
+				linkname string
+				contents string
+				devmajor int64
+				devminor int64
+			}
+			expected := map[string]entry{
+				"dev/":           {typ: tar.TypeDir, mode: 0755},
+				"dev/null":       {typ: tar.TypeChar, mode: 0666, devmajor: 1, devminor: 3},
+				"dev/pipe":       {typ: tar.TypeFifo, mode: 0644},
+				"etc/":           {typ: tar.TypeDir, mode: 0755},
+				"etc/empty":      {typ: tar.TypeReg, mode: 0644},
+				"etc/os-release": {typ: tar.TypeReg, mode: 0644, contents: "ID=test\n"},
+				"usr/":           {typ: tar.TypeDir, mode: 0755},
+				"usr/app":        {typ: tar.TypeReg, mode: 0755, uid: 1000, contents: string(large)},
+				"usr/app-link":   {typ: tar.TypeLink, mode: 0755, uid: 1000, linkname: "usr/app"},
+				"usr/release":    {typ: tar.TypeSymlink, mode: 0777, linkname: "../etc/os-release"},
+			}
+
+			var names []string
+			tr := tar.NewReader(&buf)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("could not read tar: %+v", err)
+				}
+				names = append(names, header.Name)
+				contents, err := ioutil.ReadAll(tr)
+				if err != nil {
+					t.Fatalf("could not read contents: %+v", err)
+				}
+
+				actual := entry{
+					typ:      header.Typeflag,
+					mode:     header.Mode,
+					uid:      header.Uid,
+					linkname: header.Linkname,
+					contents: string(contents),
+					devmajor: header.Devmajor,
+					devminor: header.Devminor,
+				}
+				if actual != expected[header.Name] {
+					t.Errorf("unexpected entry=%q: %+v", header.Name, actual)
+				}
+			}
+
+			// entries are sorted within each directory and parents come before children (sockets are skipped)
+			expectedNames := []string{"dev/", "dev/null", "dev/pipe", "etc/", "etc/empty", "etc/os-release", "usr/", "usr/app", "usr/app-link", "usr/release"}
+			if len(names) != len(expectedNames) {
+				t.Fatalf("unexpected entries: %+v", names)
+			}
+			for idx := range names {
+				if names[idx] != expectedNames[idx] {
+					t.Errorf("unexpected entry order: %+v", names)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestNewReader_NotSquashfs(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(make([]byte, superblockSize))); err != ErrNotSquashfs {
+		t.Errorf("unexpected error: %+v", err)
+	}
+	if IsSquashfs([]byte("hsq")) {
+		t.Errorf("expected a short header to not be squashfs")
+	}
+	if !IsSquashfs([]byte("hsqs")) {
+		t.Errorf("expected the magic to be squashfs")
+	}
+}
+
+func TestReader_UnsupportedCompression(t *testing.T) {
+	image := testImage(t, true)
+	// xz compression
+	binary.LittleEndian.PutUint16(image[20:], xzCompression)
+
+	// note: compressed blocks may be found while opening the image (e.g. the fragment table) or while reading entries
+	reader, err := NewReader(bytes.NewReader(image))
+	if err == nil {
+		err = reader.WriteTar(ioutil.Discard)
+	}
+	if err == nil {
+		t.Errorf("expected an error for an unsupported compression")
+	}
+}
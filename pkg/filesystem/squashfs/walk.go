@@ -0,0 +1,252 @@
+package squashfs
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// WalkFn is called for each entry within the squashfs image (in lexical order, parents before children). The header
+// describes the entry as a tar header would (directory names end with "/" and files seen before under another path are
+// hardlinks). The contents are only provided for regular files and must be read before returning to be read at all.
+type WalkFn func(header *tar.Header, contents io.Reader) error
+
+// directoryHeader precedes a run of directory entries that share the same inode table metadata block.
+type directoryHeader struct {
+	Count       uint32
+	Start       uint32
+	InodeNumber uint32
+}
+
+// directoryEntryHeader precedes the name of a single directory entry.
+type directoryEntryHeader struct {
+	Offset      uint16
+	InodeOffset int16
+	Type        uint16
+	NameSize    uint16
+}
+
+// directoryEntry is a single named entry within a directory.
+type directoryEntry struct {
+	name        string
+	inodeBlock  uint32
+	inodeOffset uint16
+}
+
+// Walk calls the given function for every entry within the squashfs image (the root directory itself is not
+// included). Sockets are skipped since they cannot be represented within a tar.
+func (r *Reader) Walk(fn WalkFn) error {
+	root, err := r.readInodeRef(r.sb.RootInode)
+	if err != nil {
+		return fmt.Errorf("unable to read squashfs root inode: %w", err)
+	}
+	if root.basicType() != basicDirectory {
+		return fmt.Errorf("squashfs root inode is not a directory (type=%d)", root.Type)
+	}
+	return r.walkDirectory("", root, make(map[uint32]string), fn)
+}
+
+// WriteTar writes every entry within the squashfs image to the given writer as an uncompressed tar.
+func (r *Reader) WriteTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := r.Walk(func(header *tar.Header, contents io.Reader) error {
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if contents == nil {
+			return nil
+		}
+		_, err := io.Copy(tw, contents)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (r *Reader) walkDirectory(dirPath string, dir *inode, seen map[uint32]string, fn WalkFn) error {
+	entries, err := r.readDirectory(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read squashfs directory=%q: %w", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.name)
+		in, err := r.readInode(uint64(entry.inodeBlock), entry.inodeOffset)
+		if err != nil {
+			return fmt.Errorf("unable to read squashfs entry=%q: %w", entryPath, err)
+		}
+
+		header := &tar.Header{
+			Name:    entryPath,
+			Mode:    int64(in.Permissions),
+			Uid:     int(in.uid),
+			Gid:     int(in.gid),
+			ModTime: time.Unix(int64(in.ModTime), 0),
+		}
+		var contents io.Reader
+
+		switch in.basicType() {
+		case basicDirectory:
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case basicSocket:
+			continue
+		default:
+			if first, ok := seen[in.Number]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				break
+			}
+			seen[in.Number] = entryPath
+
+			switch in.basicType() {
+			case basicFile:
+				header.Typeflag = tar.TypeReg
+				header.Size = int64(in.size)
+				contents = r.newFileReader(in)
+			case basicSymlink:
+				header.Typeflag = tar.TypeSymlink
+				header.Linkname = in.target
+			case basicBlockDevice:
+				header.Typeflag = tar.TypeBlock
+				header.Devmajor = in.devMajor()
+				header.Devminor = in.devMinor()
+			case basicCharDevice:
+				header.Typeflag = tar.TypeChar
+				header.Devmajor = in.devMajor()
+				header.Devminor = in.devMinor()
+			case basicFifo:
+				header.Typeflag = tar.TypeFifo
+			}
+		}
+
+		if err := fn(header, contents); err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			if err := r.walkDirectory(entryPath, in, seen, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDirectory reads all entries of the given directory inode from the directory table (in the stored order, which is
+// sorted by name).
+func (r *Reader) readDirectory(dir *inode) ([]directoryEntry, error) {
+	// note: the recorded size includes the (implicit) "." and ".." entries
+	if dir.dirSize <= 3 {
+		return nil, nil
+	}
+	remaining := int64(dir.dirSize) - 3
+
+	m, err := r.newMetadataReader(int64(r.sb.DirectoryTableStart)+int64(dir.dirBlock), int(dir.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []directoryEntry
+	for remaining > 0 {
+		var header directoryHeader
+		if err := binary.Read(m, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+		remaining -= int64(binary.Size(header))
+
+		for idx := uint32(0); idx <= header.Count; idx++ {
+			var entryHeader directoryEntryHeader
+			if err := binary.Read(m, binary.LittleEndian, &entryHeader); err != nil {
+				return nil, err
+			}
+			name := make([]byte, int(entryHeader.NameSize)+1)
+			if _, err := io.ReadFull(m, name); err != nil {
+				return nil, err
+			}
+			remaining -= int64(binary.Size(entryHeader) + len(name))
+
+			entries = append(entries, directoryEntry{
+				name:        string(name),
+				inodeBlock:  header.Start,
+				inodeOffset: entryHeader.Offset,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// fileReader reads the contents of a regular file, block by block (and the tail from a fragment block).
+type fileReader struct {
+	reader *Reader
+	in     *inode
+	block  int
+	pos    int64
+	read   uint64
+	buf    []byte
+}
+
+func (r *Reader) newFileReader(in *inode) *fileReader {
+	return &fileReader{
+		reader: r,
+		in:     in,
+		pos:    int64(in.blocksStart),
+	}
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.read >= f.in.size {
+			return 0, io.EOF
+		}
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// next loads the next data block (or the tail from the fragment block) of the file.
+func (f *fileReader) next() error {
+	blockSize := uint64(f.reader.sb.BlockSize)
+	remaining := f.in.size - f.read
+
+	if f.block < len(f.in.blockSizes) {
+		expected := blockSize
+		if remaining < expected {
+			expected = remaining
+		}
+		encodedSize := f.in.blockSizes[f.block]
+		data, err := f.reader.readDataBlock(f.pos, encodedSize, int(expected))
+		if err != nil {
+			return err
+		}
+		f.block++
+		f.pos += int64(encodedSize &^ dataUncompressed)
+		f.read += expected
+		f.buf = data
+		return nil
+	}
+
+	if f.in.fragment == noFragment {
+		return fmt.Errorf("squashfs file inode=%d is missing %d bytes", f.in.Number, remaining)
+	}
+	fragment, err := f.reader.readFragment(f.in.fragment)
+	if err != nil {
+		return err
+	}
+	start := uint64(f.in.fragmentOffset)
+	if start+remaining > uint64(len(fragment)) {
+		return fmt.Errorf("squashfs file inode=%d tail exceeds fragment=%d", f.in.Number, f.in.fragment)
+	}
+	f.read += remaining
+	f.buf = fragment[start : start+remaining]
+	return nil
+}
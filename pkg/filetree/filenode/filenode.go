@@ -50,6 +50,15 @@ func NewHardLink(p, linkPath file.Path, ref *file.Reference) *FileNode {
 	}
 }
 
+// NewSpecialFile returns a node for a device node, FIFO, or socket (see file.Type.IsSpecial).
+func NewSpecialFile(p file.Path, fileType file.Type, ref *file.Reference) *FileNode {
+	return &FileNode{
+		RealPath:  p,
+		FileType:  fileType,
+		Reference: ref,
+	}
+}
+
 func (n *FileNode) ID() node.ID {
 	return IDByPath(n.RealPath)
 }
@@ -5,19 +5,37 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/anchore/stereoscope/internal"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree/filenode"
 	"github.com/anchore/stereoscope/pkg/tree"
-	"github.com/anchore/stereoscope/pkg/tree/node"
 	"github.com/bmatcuk/doublestar/v2"
 )
 
 var ErrRemovingRoot = errors.New("cannot remove the root path (`/`) from the FileTree")
 var ErrLinkCycleDetected = errors.New("cycle during symlink resolution")
 
+// ErrLinkCycle is returned when link resolution revisits a link, carrying the chain of link paths followed (ending
+// with the revisited link). This matches ErrLinkCycleDetected with errors.Is.
+type ErrLinkCycle struct {
+	Chain []file.Path
+}
+
+func (e *ErrLinkCycle) Error() string {
+	links := make([]string, len(e.Chain))
+	for idx, p := range e.Chain {
+		links[idx] = string(p)
+	}
+	return fmt.Sprintf("%s: %s", ErrLinkCycleDetected, strings.Join(links, " -> "))
+}
+
+func (e *ErrLinkCycle) Is(target error) bool {
+	return target == ErrLinkCycleDetected
+}
+
 // FileTree represents a file/directory Tree
 type FileTree struct {
 	tree *tree.Tree
@@ -159,7 +177,7 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	var currentNode *filenode.FileNode
 	var err error
 	if strategy.FollowAncestorLinks {
-		currentNode, err = t.resolveAncestorLinks(normalizedPath)
+		currentNode, err = t.resolveAncestorLinks(normalizedPath, nil)
 		if err != nil {
 			return currentNode, err
 		}
@@ -176,14 +194,15 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	}
 
 	if strategy.FollowBasenameLinks {
-		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks)
+		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks, nil)
 	}
 	return currentNode, err
 }
 
 // return FileNode of the basename in the given path (no resolution is done at or past the basename). Note: it is
-// assumed that the given path has already been normalized.
-func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, error) {
+// assumed that the given path has already been normalized. The given chain is the links being resolved by callers
+// (used for cycle detection).
+func (t *FileTree) resolveAncestorLinks(path file.Path, chain []file.Path) (*filenode.FileNode, error) {
 	// performance optimization... see if there is a node at the path (as if it is a real path). If so,
 	// use it, otherwise, continue with ancestor resolution
 	currentNode, err := t.node(path, linkResolutionStrategy{})
@@ -239,7 +258,7 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 		// links until the next Node is resolved (or not).
 		isLastPart := idx == len(pathParts)-1
 		if !isLastPart && currentNode.IsLink() {
-			currentNode, err = t.resolveNodeLinks(currentNode, true)
+			currentNode, err = t.resolveNodeLinks(currentNode, true, chain)
 			if err != nil {
 				// only expected to happen on cycles
 				return currentNode, err
@@ -256,8 +275,9 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 }
 
 // followNode takes the given FileNode and resolves all links at the base of the real path for the node (this implies
-// that NO ancestors are considered).
-func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks bool) (*filenode.FileNode, error) {
+// that NO ancestors are considered). The given chain is the links being resolved by callers, where resolving any of
+// these links again (e.g. while resolving the ancestors of a link target) is a cycle.
+func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks bool, chain []file.Path) (*filenode.FileNode, error) {
 	if n == nil {
 		return nil, fmt.Errorf("cannot resolve links with nil Node given")
 	}
@@ -267,8 +287,9 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 
 	currentNode := n
 
-	// keep resolving links until a regular file or directory is found
-	alreadySeen := internal.NewStringSet()
+	// keep resolving links until a regular file or directory is found (copying the chain, since callers may
+	// continue to use theirs)
+	chain = append([]file.Path{}, chain...)
 	var err error
 	for {
 		// if there is no next path, return this reference (dead link)
@@ -276,8 +297,8 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 			break
 		}
 
-		if alreadySeen.Contains(string(currentNode.RealPath)) {
-			return nil, ErrLinkCycleDetected
+		if currentNode.IsLink() && containsPath(chain, currentNode.RealPath) {
+			return nil, &ErrLinkCycle{Chain: append(chain, currentNode.RealPath)}
 		}
 
 		if !currentNode.IsLink() {
@@ -287,7 +308,7 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 		}
 
 		// prepare for the next iteration
-		alreadySeen.Add(string(currentNode.RealPath))
+		chain = append(chain, currentNode.RealPath)
 
 		var nextPath file.Path
 		if currentNode.LinkPath.IsAbsolutePath() {
@@ -310,7 +331,7 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 		lastNode = currentNode
 
 		// get the next Node (based on the next path)
-		currentNode, err = t.resolveAncestorLinks(nextPath)
+		currentNode, err = t.resolveAncestorLinks(nextPath, chain)
 		if err != nil {
 			// only expected to occur upon cycle detection
 			return currentNode, err
@@ -324,7 +345,17 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 	return currentNode, nil
 }
 
-// File fetches zero to many file.References for the given glob pattern (considers symlinks).
+func containsPath(paths []file.Path, p file.Path) bool {
+	for _, candidate := range paths {
+		if candidate == p {
+			return true
+		}
+	}
+	return false
+}
+
+// FilesByGlob fetches zero to many file.References for the given doublestar-style glob pattern (e.g. "**/*.so" or
+// "/etc/*.conf"), where patterns are always relative to the root (considers symlinks). Directories are never matched.
 func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([]GlobResult, error) {
 	results := make([]GlobResult, 0)
 
@@ -394,11 +425,8 @@ func (t *FileTree) AddFile(realPath file.Path) (*file.Reference, error) {
 		if fn.FileType != file.TypeReg {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a regular file", realPath)
 		}
-		// this is a regular file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		// provide a new or existing file.Reference
+		return t.attachReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -422,11 +450,8 @@ func (t *FileTree) AddSymLink(realPath file.Path, linkPath file.Path) (*file.Ref
 		if fn.FileType != file.TypeSymlink {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
-		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		// provide a new or existing file.Reference
+		return t.attachReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -450,11 +475,8 @@ func (t *FileTree) AddHardLink(realPath file.Path, linkPath file.Path) (*file.Re
 		if fn.FileType != file.TypeHardLink {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
-		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		// provide a new or existing file.Reference
+		return t.attachReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -467,6 +489,35 @@ func (t *FileTree) AddHardLink(realPath file.Path, linkPath file.Path) (*file.Re
 	return newFn.Reference, t.setFileNode(newFn)
 }
 
+// AddSpecialFile adds a new path to the Tree that represents a device node, FIFO, or socket (see file.Type.IsSpecial).
+// It also adds any ancestors of the path that are not already present in the Tree. The resulting file.Reference of the
+// new (leaf) addition is returned. Note: NO symlink or hardlink resolution is performed on the given path --which
+// implies that the given path MUST be a real path (have no links in constituent paths)
+func (t *FileTree) AddSpecialFile(realPath file.Path, fileType file.Type) (*file.Reference, error) {
+	if !fileType.IsSpecial() {
+		return nil, fmt.Errorf("path=%q has a type that is not a special file: %q", realPath, fileType)
+	}
+	fn, err := t.node(realPath, linkResolutionStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		// this path already exists
+		if fn.FileType != fileType {
+			return nil, fmt.Errorf("path=%q already exists but is NOT a special file of type=%q", realPath, fileType)
+		}
+		// provide a new or existing file.Reference
+		return t.attachReference(fn)
+	}
+
+	// this is a new path... add the new Node + parents
+	if err := t.addParentPaths(realPath); err != nil {
+		return nil, err
+	}
+	newFn := filenode.NewSpecialFile(realPath, fileType, file.NewFileReference(realPath))
+	return newFn.Reference, t.setFileNode(newFn)
+}
+
 // AddDir adds a new path representing a DIRECTORY to the Tree. It also adds any ancestors of the path that are
 // not already present in the Tree. The resulting file.Reference of the new (leaf) addition is returned.
 // Note: NO symlink or hardlink resolution is performed on the given path --which implies that the given path MUST
@@ -481,11 +532,8 @@ func (t *FileTree) AddDir(realPath file.Path) (*file.Reference, error) {
 		if fn.FileType != file.TypeDir {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
-		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		// provide a new or existing file.Reference
+		return t.attachReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -497,6 +545,18 @@ func (t *FileTree) AddDir(realPath file.Path) (*file.Reference, error) {
 	return newFn.Reference, t.setFileNode(newFn)
 }
 
+// attachReference returns the file.Reference for the given existing node, creating one if the node does not have
+// a reference yet. Nodes may be shared with copies of the FileTree, so a new node is stored in place of the existing
+// node instead of modifying the existing node.
+func (t *FileTree) attachReference(fn *filenode.FileNode) (*file.Reference, error) {
+	if fn.Reference != nil {
+		return fn.Reference, nil
+	}
+	nodeCopy := *fn
+	nodeCopy.Reference = file.NewFileReference(fn.RealPath)
+	return nodeCopy.Reference, t.setFileNode(&nodeCopy)
+}
+
 // addParentPaths adds paths into the Tree for all constituent paths, but does NOT attach a file.Reference for each new path.
 // if the parent already exists, nothing is done and the function returns with no error. Note: NO symlink or hardlink
 // resolution is performed on the given path --which implies that the given path MUST be a real path (have no
@@ -659,6 +719,92 @@ func (t *FileTree) Equal(other *FileTree) bool {
 	return len(extra) == 0 && len(missing) == 0
 }
 
+// RefChange describes a path found in both trees that does not refer to the same file.
+type RefChange struct {
+	Path file.Path
+	// Before is the file reference within the original tree (nil for directories only implied by other paths).
+	Before *file.Reference
+	// After is the file reference within the other tree (nil for directories only implied by other paths).
+	After *file.Reference
+}
+
+// DiffResult is the set of path changes from one tree to another (see Diff). All paths are real paths (links are not
+// resolved) and are sorted depth-first (parents before children).
+type DiffResult struct {
+	// Added are the paths found only in the other tree.
+	Added []file.Path
+	// Removed are the paths found only in the original tree.
+	Removed []file.Path
+	// Changed are the paths found in both trees that refer to different files (or differ in type or link destination).
+	Changed []RefChange
+}
+
+// Empty indicates that there are no differences between the trees.
+func (d DiffResult) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff reports the paths added, removed, and changed in the given tree relative to this tree. Paths are compared by
+// file reference, so two trees squashed from the same layers are considered identical, while trees from unrelated
+// sources typically differ at every shared path that has a reference (compare the file metadata to determine if the
+// files themselves differ).
+func (t *FileTree) Diff(other *FileTree) DiffResult {
+	ourNodes := t.nodesByPath()
+	theirNodes := other.nodesByPath()
+
+	var result DiffResult
+	for _, theirs := range other.sortedNodes() {
+		ours, ok := ourNodes[theirs.RealPath]
+		if !ok {
+			result.Added = append(result.Added, theirs.RealPath)
+			continue
+		}
+		if nodeChanged(ours, theirs) {
+			result.Changed = append(result.Changed, RefChange{
+				Path:   theirs.RealPath,
+				Before: ours.Reference,
+				After:  theirs.Reference,
+			})
+		}
+	}
+
+	for _, ours := range t.sortedNodes() {
+		if _, ok := theirNodes[ours.RealPath]; !ok {
+			result.Removed = append(result.Removed, ours.RealPath)
+		}
+	}
+
+	return result
+}
+
+// Merge combines the given tree into this tree, preferring files in the given tree when a path exists in both and
+// applying any whiteouts from the given tree (removing the paths from this tree, unless IgnoreWhiteouts is given). This
+// is the same operation used for squashing each layer tree onto the tree of all lower layers.
+func (t *FileTree) Merge(other *FileTree, options ...MergeOption) error {
+	return t.merge(other, newMergeStrategy(options...))
+}
+
+// nodesByPath returns all nodes keyed by real path.
+func (t *FileTree) nodesByPath() map[file.Path]*filenode.FileNode {
+	nodes := make(map[file.Path]*filenode.FileNode)
+	for _, n := range t.tree.Nodes() {
+		fn := n.(*filenode.FileNode)
+		nodes[fn.RealPath] = fn
+	}
+	return nodes
+}
+
+// nodeChanged indicates if two nodes for the same path do not refer to the same file.
+func nodeChanged(ours, theirs *filenode.FileNode) bool {
+	if ours.FileType != theirs.FileType || ours.LinkPath != theirs.LinkPath {
+		return true
+	}
+	if ours.Reference == nil || theirs.Reference == nil {
+		return (ours.Reference == nil) != (theirs.Reference == nil)
+	}
+	return ours.Reference.ID() != theirs.Reference.ID()
+}
+
 // HasPath indicates is the given path is in the file Tree (with optional link resolution options).
 func (t *FileTree) HasPath(path file.Path, options ...LinkResolutionOption) bool {
 	exists, _, err := t.File(path, options...)
@@ -673,29 +819,58 @@ func (t *FileTree) Walk(fn func(path file.Path, f filenode.FileNode) error, cond
 	return NewDepthFirstPathWalker(t, fn, conditions).WalkAll()
 }
 
+// WalkNodes invokes the given visitor for every node within the FileTree (including directories only implied by other
+// paths) in depth-first path order, where links are not resolved (each node is visited at its real path only once).
+// Any error from the visitor stops the walk and is returned.
+func (t *FileTree) WalkNodes(fn func(path file.Path, f filenode.FileNode) error) error {
+	for _, n := range t.sortedNodes() {
+		if err := fn(n.RealPath, *n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // merge takes the given Tree and combines it with the current Tree, preferring files in the other Tree if there
 // are path conflicts. This is the basis function for squashing (where the current Tree is the bottom Tree and the
-// given Tree is the top Tree).
+// given Tree is the top Tree). The merge is a single pass over the upper Tree paths in sorted order (which guarantees
+// parents are merged before children) where each upper path is merged with a constant number of lower Tree lookups.
+// Whiteouts within the upper Tree are never merged, however, these only remove lower paths as the strategy allows.
 // nolint:gocognit,funlen
-func (t *FileTree) merge(upper *FileTree) error {
-	conditions := tree.WalkConditions{
-		ShouldContinueBranch: func(n node.Node) bool {
-			p := file.Path(n.ID())
-			return !p.IsWhiteout()
-		},
-		ShouldVisit: func(n node.Node) bool {
-			p := file.Path(n.ID())
-			return !p.IsDirWhiteout()
-		},
-	}
-
-	visitor := func(n node.Node) error {
-		if n == nil {
-			return fmt.Errorf("found nil Node while traversing %+v", upper)
+func (t *FileTree) merge(upper *FileTree, strategy mergeStrategy) error {
+	upperNodes := upper.sortedNodes()
+
+	// find all opaque directories up front (instead of checking for an opaque whiteout child for every upper path)
+	opaqueDirs := make(map[file.Path]struct{})
+	for _, upperNode := range upperNodes {
+		if strategy.IgnoreWhiteouts || !upperNode.RealPath.IsDirWhiteout() {
+			continue
+		}
+		parentPath, err := upperNode.RealPath.ParentPath()
+		if err != nil {
+			return fmt.Errorf("filetree merge failed to find opaque directory (upperPath=%s): %w", upperNode.RealPath, err)
 		}
-		upperNode := n.(*filenode.FileNode)
+		opaqueDirs[parentPath] = struct{}{}
+	}
+
+	// whiteouts (and anything beneath them) are never merged into the lower tree
+	skipped := make(map[file.Path]struct{})
+
+	for _, upperNode := range upperNodes {
+		if parentPath, err := upperNode.RealPath.ParentPath(); err == nil {
+			if _, ok := skipped[parentPath]; ok {
+				skipped[upperNode.RealPath] = struct{}{}
+				continue
+			}
+		}
+
+		if upperNode.RealPath.IsDirWhiteout() {
+			skipped[upperNode.RealPath] = struct{}{}
+			continue
+		}
+
 		// opaque directories must be processed first
-		if upper.hasOpaqueDirectory(upperNode.RealPath) {
+		if _, ok := opaqueDirs[upperNode.RealPath]; ok {
 			err := t.RemoveChildPaths(upperNode.RealPath)
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to remove child paths (upperPath=%s): %w", upperNode.RealPath, err)
@@ -703,6 +878,11 @@ func (t *FileTree) merge(upper *FileTree) error {
 		}
 
 		if upperNode.RealPath.IsWhiteout() {
+			skipped[upperNode.RealPath] = struct{}{}
+			if strategy.IgnoreWhiteouts {
+				continue
+			}
+
 			lowerPath, err := upperNode.RealPath.UnWhiteoutPath()
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to find original upperPath for whiteout (upperPath=%s): %w", upperNode.RealPath, err)
@@ -713,7 +893,7 @@ func (t *FileTree) merge(upper *FileTree) error {
 				return fmt.Errorf("filetree merge failed to remove upperPath (upperPath=%s): %w", lowerPath, err)
 			}
 
-			return nil
+			continue
 		}
 
 		lowerNode, err := t.node(upperNode.RealPath, linkResolutionStrategy{
@@ -749,17 +929,40 @@ func (t *FileTree) merge(upper *FileTree) error {
 		if err := t.setFileNode(&nodeCopy); err != nil {
 			return fmt.Errorf("filetree merge failed to set file Node (Node=%+v): %w", nodeCopy, err)
 		}
-
-		return nil
 	}
 
-	// we are using the tree walker instead of the path walker to only look at an resolve merging of real files
-	// with no consideration to virtual paths (paths that are valid in the filetree because constituent paths
-	// contain symlinks).
-	return tree.NewDepthFirstWalkerWithConditions(upper.Reader(), visitor, conditions).WalkAll()
+	return nil
+}
+
+// sortedNodes returns all nodes in the Tree in depth-first order (parents before children, siblings sorted by path).
+// Note: this only considers real paths, with no consideration to virtual paths (paths that are valid in the filetree
+// because constituent paths contain symlinks).
+func (t *FileTree) sortedNodes() []*filenode.FileNode {
+	nodes := t.tree.Nodes()
+	fileNodes := make([]*filenode.FileNode, 0, len(nodes))
+	for _, n := range nodes {
+		fileNodes = append(fileNodes, n.(*filenode.FileNode))
+	}
+	sort.Slice(fileNodes, func(i, j int) bool {
+		return depthFirstPathLess(fileNodes[i].RealPath, fileNodes[j].RealPath)
+	})
+	return fileNodes
 }
 
-func (t *FileTree) hasOpaqueDirectory(directoryPath file.Path) bool {
-	opaqueWhiteoutChild := file.Path(path.Join(string(directoryPath), file.OpaqueWhiteout))
-	return t.HasPath(opaqueWhiteoutChild)
+// depthFirstPathLess orders paths as a depth-first traversal would visit them: by path element (so "/a/b" is ordered
+// before "/a-b", unlike a plain string comparison).
+func depthFirstPathLess(a, b file.Path) bool {
+	for idx := 0; idx < len(a) && idx < len(b); idx++ {
+		if a[idx] == b[idx] {
+			continue
+		}
+		switch {
+		case a[idx] == '/':
+			return true
+		case b[idx] == '/':
+			return false
+		}
+		return a[idx] < b[idx]
+	}
+	return len(a) < len(b)
 }
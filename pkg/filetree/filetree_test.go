@@ -3,6 +3,7 @@ package filetree
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/filetree/filenode"
@@ -56,6 +57,34 @@ func TestFileTree_AddPathAndMissingAncestors(t *testing.T) {
 	}
 }
 
+func TestFileTree_AddSpecialFile(t *testing.T) {
+	tr := NewFileTree()
+	path := file.Path("/dev/null")
+	ref, err := tr.AddSpecialFile(path, file.TypeCharacterDevice)
+	if err != nil {
+		t.Fatalf("could not add path: %+v", err)
+	}
+
+	n, err := tr.node(path, linkResolutionStrategy{})
+	if err != nil || n == nil {
+		t.Fatalf("could not get node: %+v", err)
+	}
+	if n.FileType != file.TypeCharacterDevice || n.Reference != ref {
+		t.Errorf("unexpected node: %+v", n)
+	}
+
+	// the same path may be added again (as the same type only)
+	if _, err := tr.AddSpecialFile(path, file.TypeCharacterDevice); err != nil {
+		t.Errorf("could not add path again: %+v", err)
+	}
+	if _, err := tr.AddSpecialFile(path, file.TypeFifo); err == nil {
+		t.Errorf("expected an error for a different type")
+	}
+	if _, err := tr.AddSpecialFile("/dev/other", file.TypeReg); err == nil {
+		t.Errorf("expected an error for a type that is not special")
+	}
+}
+
 func TestFileTree_RemovePath(t *testing.T) {
 	tr := NewFileTree()
 	path := file.Path("/home/wagoodman/awesome/file.txt")
@@ -332,7 +361,7 @@ func TestFileTree_Merge(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/file-2.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -350,7 +379,7 @@ func TestFileTree_Merge_Overwrite(t *testing.T) {
 	tr2 := NewFileTree()
 	newRef, _ := tr2.AddFile("/home/wagoodman/awesome/file.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -368,7 +397,7 @@ func TestFileTree_Merge_OpaqueWhiteout(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/.wh..wh..opq")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -393,7 +422,7 @@ func TestFileTree_Merge_OpaqueWhiteout_NoLowerDirectory(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/luhring/.wh..wh..opq")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -411,7 +440,7 @@ func TestFileTree_Merge_Whiteout(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/.wh.file.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -436,7 +465,7 @@ func TestFileTree_Merge_DirOverride(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/place/thing.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.merge(tr2, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -470,7 +499,7 @@ func TestFileTree_Merge_RemoveChildPathsOnOverride(t *testing.T) {
 	upperTree.AddFile("/home/wagoodman/awesome/place")
 
 	// merge the upper tree into the lower tree
-	if err := lowerTree.merge(upperTree); err != nil {
+	if err := lowerTree.merge(upperTree, mergeStrategy{}); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -499,6 +528,86 @@ func TestFileTree_Merge_RemoveChildPathsOnOverride(t *testing.T) {
 
 }
 
+func TestFileTree_Diff(t *testing.T) {
+	lower := NewFileTree()
+	lower.AddFile("/etc/untouched.txt")
+	lower.AddFile("/etc/changed.txt")
+	lower.AddFile("/etc/removed.txt")
+	lower.AddSymLink("/etc/link", "/etc/untouched.txt")
+
+	upper := NewFileTree()
+	changedRef, _ := upper.AddFile("/etc/changed.txt")
+	upper.AddFile("/etc/.wh.removed.txt")
+	upper.AddFile("/usr/added.txt")
+	upper.AddSymLink("/etc/link", "/etc/changed.txt")
+
+	squashed, err := lower.Copy()
+	if err != nil {
+		t.Fatalf("could not copy tree: %+v", err)
+	}
+	if err := squashed.Merge(upper); err != nil {
+		t.Fatalf("error on merge : %+v", err)
+	}
+
+	result := lower.Diff(squashed)
+
+	expectedAdded := []file.Path{"/usr", "/usr/added.txt"}
+	if !reflect.DeepEqual(result.Added, expectedAdded) {
+		t.Errorf("unexpected added paths: %+v", result.Added)
+	}
+
+	expectedRemoved := []file.Path{"/etc/removed.txt"}
+	if !reflect.DeepEqual(result.Removed, expectedRemoved) {
+		t.Errorf("unexpected removed paths: %+v", result.Removed)
+	}
+
+	var changedPaths []file.Path
+	for _, change := range result.Changed {
+		changedPaths = append(changedPaths, change.Path)
+		if change.Path == "/etc/changed.txt" && change.After.ID() != changedRef.ID() {
+			t.Errorf("unexpected changed ref: %+v", change.After)
+		}
+	}
+	expectedChanged := []file.Path{"/etc/changed.txt", "/etc/link"}
+	if !reflect.DeepEqual(changedPaths, expectedChanged) {
+		t.Errorf("unexpected changed paths: %+v", changedPaths)
+	}
+
+	if !squashed.Diff(squashed).Empty() {
+		t.Errorf("expected no differences for the same tree")
+	}
+
+	copied, err := squashed.Copy()
+	if err != nil {
+		t.Fatalf("could not copy tree: %+v", err)
+	}
+	if !squashed.Diff(copied).Empty() {
+		t.Errorf("expected no differences for a copy of the same tree")
+	}
+}
+
+func TestFileTree_WalkNodes(t *testing.T) {
+	tr := NewFileTree()
+	tr.AddFile("/a-b.txt")
+	tr.AddFile("/a/b.txt")
+	tr.AddSymLink("/link", "/a")
+
+	var paths []file.Path
+	err := tr.WalkNodes(func(path file.Path, _ filenode.FileNode) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not walk nodes: %+v", err)
+	}
+
+	// links are not followed and children are visited before siblings that sort after the parent
+	expected := []file.Path{"/", "/a", "/a/b.txt", "/a-b.txt", "/link"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("unexpected paths: %+v", paths)
+	}
+}
+
 func TestFileTree_File_Symlink(t *testing.T) {
 
 	tests := []struct {
@@ -777,7 +886,7 @@ func TestFileTree_File_CycleDetection(t *testing.T) {
 
 	// the test.... do we stop when a cycle is detected?
 	exists, _, err := tr.File("/home/wagoodman", FollowBasenameLinks)
-	if err != ErrLinkCycleDetected {
+	if !errors.Is(err, ErrLinkCycleDetected) {
 		t.Fatalf("should have gotten an error on resolving a file")
 	}
 
@@ -785,4 +894,74 @@ func TestFileTree_File_CycleDetection(t *testing.T) {
 		t.Errorf("resolution should not exist in cycle")
 	}
 
+	var cycleErr *ErrLinkCycle
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("expected a link cycle error, got: %+v", err)
+	}
+	expectedChain := []file.Path{"/home", "/another/place", "/home"}
+	if !reflect.DeepEqual(cycleErr.Chain, expectedChain) {
+		t.Errorf("unexpected chain: %+v", cycleErr.Chain)
+	}
+	if cycleErr.Error() != "cycle during symlink resolution: /home -> /another/place -> /home" {
+		t.Errorf("unexpected error message: %q", cycleErr.Error())
+	}
+}
+
+func TestFileTree_File_AncestorCycleDetection(t *testing.T) {
+	tr := NewFileTree()
+	// each link target is within the other link, so resolving either requires resolving both (indefinitely)
+	if _, err := tr.AddSymLink("/a", "/b/x"); err != nil {
+		t.Fatalf("unexpected an error on add link: %+v", err)
+	}
+	if _, err := tr.AddSymLink("/b", "/a/y"); err != nil {
+		t.Fatalf("unexpected an error on add link: %+v", err)
+	}
+
+	exists, _, err := tr.File("/a/z", FollowBasenameLinks)
+	var cycleErr *ErrLinkCycle
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("expected a link cycle error, got: %+v", err)
+	}
+	if exists {
+		t.Errorf("resolution should not exist in cycle")
+	}
+	expectedChain := []file.Path{"/a", "/b", "/a"}
+	if !reflect.DeepEqual(cycleErr.Chain, expectedChain) {
+		t.Errorf("unexpected chain: %+v", cycleErr.Chain)
+	}
+
+	// the same link may be followed more than once when there is no cycle
+	if _, err := tr.AddSymLink("/c", "/d"); err != nil {
+		t.Fatalf("unexpected an error on add link: %+v", err)
+	}
+	if _, err := tr.AddSymLink("/d", "/e/../e"); err != nil {
+		t.Fatalf("unexpected an error on add link: %+v", err)
+	}
+	if _, err := tr.AddFile("/e/file.txt"); err != nil {
+		t.Fatalf("unexpected an error on add file: %+v", err)
+	}
+	exists, _, err = tr.File("/c/file.txt", FollowBasenameLinks)
+	if err != nil || !exists {
+		t.Errorf("expected resolution without a cycle: exists=%v err=%+v", exists, err)
+	}
+}
+
+func BenchmarkFileTree_AddFile(b *testing.B) {
+	var paths []file.Path
+	for dir := 0; dir < 50; dir++ {
+		for f := 0; f < 20; f++ {
+			paths = append(paths, file.Path(fmt.Sprintf("/usr/lib/python3.8/site-packages/pkg-%d/module/file-%d.py", dir, f)))
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr := NewFileTree()
+		for _, p := range paths {
+			if _, err := tr.AddFile(p); err != nil {
+				b.Fatalf("could not add path=%q: %+v", p, err)
+			}
+		}
+	}
 }
@@ -0,0 +1,117 @@
+package filetree
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ListingSchemaVersion is the version of the JSON listing format (see Listing), which is only incremented on
+// incompatible changes (new fields are not incompatible changes).
+const ListingSchemaVersion = 1
+
+// listing entry types, as found within the JSON listing
+const (
+	ListingTypeFile            = "file"
+	ListingTypeDir             = "dir"
+	ListingTypeSymlink         = "symlink"
+	ListingTypeHardLink        = "hardlink"
+	ListingTypeCharacterDevice = "char-device"
+	ListingTypeBlockDevice     = "block-device"
+	ListingTypeFifo            = "fifo"
+	ListingTypeSocket          = "socket"
+)
+
+// Listing is a stable, language-neutral description of all paths within a FileTree (e.g. for tools that consume the
+// squashed filesystem of an image without linking stereoscope). The JSON field names are stable.
+type Listing struct {
+	// SchemaVersion is the version of this format (see ListingSchemaVersion).
+	SchemaVersion int `json:"schemaVersion"`
+	// Entries are all paths within the tree in depth-first order (parents before children, siblings sorted by path).
+	Entries []ListingEntry `json:"entries"`
+}
+
+// ListingEntry is a single path within a Listing.
+type ListingEntry struct {
+	// Path is the absolute real path (no links within the constituent paths, the path itself may be a link).
+	Path string `json:"path"`
+	// Type is one of "file", "dir", "symlink", or "hardlink".
+	Type string `json:"type"`
+	// LinkTarget is the target of a symlink (absolute or relative) or hardlink (absolute), empty for all other types.
+	LinkTarget string `json:"linkTarget,omitempty"`
+	// Size is the size of the file contents in bytes (omitted when there is no file metadata for the path, e.g. for
+	// implied parent directories or when listing a tree without metadata).
+	Size *int64 `json:"size,omitempty"`
+	// Digest is the digest of the file contents in "algorithm:value" form (omitted unless file contents were digested
+	// while cataloging).
+	Digest string `json:"digest,omitempty"`
+}
+
+// ListingMetadataFn provides the file metadata for a reference within the tree (nil if there is no metadata for the
+// reference).
+type ListingMetadataFn func(ref file.Reference) (*file.Metadata, error)
+
+// Listing describes all paths within the tree, where sizes and digests are taken from the metadata provided by the
+// given function (if any).
+func (t *FileTree) Listing(metadata ListingMetadataFn) (Listing, error) {
+	listing := Listing{
+		SchemaVersion: ListingSchemaVersion,
+		Entries:       []ListingEntry{},
+	}
+	for _, fn := range t.sortedNodes() {
+		entry := ListingEntry{
+			Path:       string(fn.RealPath),
+			Type:       listingType(fn.FileType),
+			LinkTarget: string(fn.LinkPath),
+		}
+
+		if metadata != nil && fn.Reference != nil {
+			m, err := metadata(*fn.Reference)
+			if err != nil {
+				return Listing{}, fmt.Errorf("unable to list path=%q: %w", fn.RealPath, err)
+			}
+			if m != nil {
+				size := m.Size
+				entry.Size = &size
+				if len(m.Digests) > 0 {
+					entry.Digest = m.Digests[0].String()
+				}
+			}
+		}
+
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing, nil
+}
+
+// MarshalJSON encodes the Listing of the tree. Since the tree only holds paths (file metadata is held by the file
+// catalog), sizes and digests are omitted (see image.Image.SquashedListing for a listing with file metadata).
+func (t *FileTree) MarshalJSON() ([]byte, error) {
+	listing, err := t.Listing(nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(listing)
+}
+
+func listingType(fileType file.Type) string {
+	switch fileType {
+	case file.TypeDir:
+		return ListingTypeDir
+	case file.TypeSymlink:
+		return ListingTypeSymlink
+	case file.TypeHardLink:
+		return ListingTypeHardLink
+	case file.TypeCharacterDevice:
+		return ListingTypeCharacterDevice
+	case file.TypeBlockDevice:
+		return ListingTypeBlockDevice
+	case file.TypeFifo:
+		return ListingTypeFifo
+	case file.TypeSocket:
+		return ListingTypeSocket
+	default:
+		return ListingTypeFile
+	}
+}
@@ -0,0 +1,69 @@
+package filetree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestFileTree_MarshalJSON(t *testing.T) {
+	tr := NewFileTree()
+	if _, err := tr.AddFile("/etc/hosts"); err != nil {
+		t.Fatalf("could not add file: %+v", err)
+	}
+	if _, err := tr.AddSymLink("/etc/hosts-link", "./hosts"); err != nil {
+		t.Fatalf("could not add symlink: %+v", err)
+	}
+	if _, err := tr.AddHardLink("/etc-hosts", "/etc/hosts"); err != nil {
+		t.Fatalf("could not add hardlink: %+v", err)
+	}
+
+	actual, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatalf("could not marshal tree: %+v", err)
+	}
+
+	// note: "/etc/..." is ordered before "/etc-hosts" (depth first)
+	expected := `{"schemaVersion":1,"entries":[` +
+		`{"path":"/","type":"dir"},` +
+		`{"path":"/etc","type":"dir"},` +
+		`{"path":"/etc/hosts","type":"file"},` +
+		`{"path":"/etc/hosts-link","type":"symlink","linkTarget":"./hosts"},` +
+		`{"path":"/etc-hosts","type":"hardlink","linkTarget":"/etc/hosts"}]}`
+	if string(actual) != expected {
+		t.Errorf("unexpected listing:\n%s\n!=\n%s", actual, expected)
+	}
+}
+
+func TestFileTree_Listing_Metadata(t *testing.T) {
+	tr := NewFileTree()
+	ref, err := tr.AddFile("/etc/hosts")
+	if err != nil {
+		t.Fatalf("could not add file: %+v", err)
+	}
+
+	listing, err := tr.Listing(func(r file.Reference) (*file.Metadata, error) {
+		if r.ID() != ref.ID() {
+			return nil, nil
+		}
+		return &file.Metadata{
+			Size:    5,
+			Digests: []file.Digest{{Algorithm: "sha256", Value: "abc"}},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("could not list tree: %+v", err)
+	}
+
+	if len(listing.Entries) != 3 {
+		t.Fatalf("unexpected entries: %+v", listing.Entries)
+	}
+	entry := listing.Entries[2]
+	if entry.Path != "/etc/hosts" || entry.Size == nil || *entry.Size != 5 || entry.Digest != "sha256:abc" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if listing.Entries[1].Size != nil {
+		t.Errorf("expected no size for an implied dir")
+	}
+}
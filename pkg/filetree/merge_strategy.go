@@ -0,0 +1,26 @@
+package filetree
+
+const (
+	// IgnoreWhiteouts merges trees without applying whiteouts (or opaque whiteouts) from the upper tree, so paths removed
+	// by an upper tree remain within the merged tree. Whiteouts themselves are never merged.
+	IgnoreWhiteouts MergeOption = iota
+)
+
+// MergeOption is a single rule for merging trees (see FileTree.Merge and UnionFileTree.Squash).
+type MergeOption int
+
+// mergeStrategy describes the full set of possible merge rules and their indications.
+type mergeStrategy struct {
+	IgnoreWhiteouts bool
+}
+
+// newMergeStrategy creates a new mergeStrategy for the given set of MergeOptions.
+func newMergeStrategy(options ...MergeOption) mergeStrategy {
+	s := mergeStrategy{}
+	for _, o := range options {
+		if o == IgnoreWhiteouts {
+			s.IgnoreWhiteouts = true
+		}
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package filetree
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// PathFold maps a single path element (a file or directory name) to a canonical form, where path elements with the
+// same canonical form are considered the same path element (see FileTree.FileWithFold).
+type PathFold func(element string) string
+
+// CaseInsensitive matches path elements regardless of case (via Unicode simple case folding, e.g. "Windows" matches
+// "WINDOWS" and "windows"), as is needed for lookups within Windows images.
+func CaseInsensitive(element string) string {
+	return strings.Map(foldRune, element)
+}
+
+// NormalizedCaseInsensitive matches path elements regardless of case after applying the given Unicode normalization
+// (e.g. norm.NFC.String from golang.org/x/text/unicode/norm), so names that are composed differently (such as "é" as a
+// single code point or as "e" followed by a combining accent) match as well.
+func NormalizedCaseInsensitive(normalize func(string) string) PathFold {
+	return func(element string) string {
+		return CaseInsensitive(normalize(element))
+	}
+}
+
+// foldRune maps the given rune to the smallest rune that is equivalent under simple case folding (the same
+// equivalence used by strings.EqualFold).
+func foldRune(r rune) rune {
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < smallest {
+			smallest = f
+		}
+	}
+	return smallest
+}
+
+// FileWithFold is the same as File, however, each path element is matched by the canonical form from the given fold
+// (e.g. CaseInsensitive) instead of exactly. Exact matches are always preferred; when multiple paths within the tree
+// match a path element (e.g. "/etc/Hosts" and "/etc/hosts" for a case insensitive lookup of "/etc/HOSTS"), the
+// lexically smallest path is used. Links within the path are resolved as with File.
+func (t *FileTree) FileWithFold(path file.Path, fold PathFold, options ...LinkResolutionOption) (bool, *file.Reference, error) {
+	realPath, err := t.resolveFoldedPath(path.Normalize(), fold)
+	if err != nil || realPath == "" {
+		return false, nil, err
+	}
+	return t.File(realPath, options...)
+}
+
+// resolveFoldedPath returns the path within the tree that matches the given path for the given fold (empty if there is
+// no match), where all links within the ancestors of the path are resolved (the basename may still be a link).
+func (t *FileTree) resolveFoldedPath(path file.Path, fold PathFold) (file.Path, error) {
+	parts := strings.Split(strings.Trim(string(path), file.DirSeparator), file.DirSeparator)
+	current := file.Path(file.DirSeparator)
+
+	for idx, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		next, err := t.foldedChild(current, part, fold)
+		if err != nil || next == "" {
+			return "", err
+		}
+		current = next
+
+		if idx == len(parts)-1 {
+			break
+		}
+
+		// ancestors that are links are resolved, so the remaining path elements are matched against the link target
+		resolved, err := t.node(current, linkResolutionStrategy{
+			FollowAncestorLinks: true,
+			FollowBasenameLinks: true,
+		})
+		if err != nil || resolved == nil {
+			return "", err
+		}
+		current = resolved.RealPath
+	}
+	return current, nil
+}
+
+// foldedChild returns the path of the child of the given dir that matches the given path element for the given fold
+// (empty if there is no match).
+func (t *FileTree) foldedChild(dir file.Path, element string, fold PathFold) (file.Path, error) {
+	exact := file.Path(strings.TrimSuffix(string(dir), file.DirSeparator) + file.DirSeparator + element)
+	if t.tree.HasNode(filenode.IDByPath(exact)) {
+		return exact, nil
+	}
+
+	parent, err := t.node(dir, linkResolutionStrategy{})
+	if err != nil || parent == nil {
+		return "", err
+	}
+
+	target := fold(element)
+	var matches []file.Path
+	for _, child := range t.tree.Children(parent) {
+		childPath := child.(*filenode.FileNode).RealPath
+		if fold(childPath.Basename()) == target {
+			matches = append(matches, childPath)
+		}
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i] < matches[j]
+	})
+	return matches[0], nil
+}
@@ -0,0 +1,151 @@
+package filetree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestFileTree_FileWithFold(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{
+		"/Windows/System32/drivers/etc/hosts",
+		"/Users/Public/Documents/readme.txt",
+		"/etc/Hosts",
+		"/etc/hosts",
+		"/caf\u00e9/menu.txt",
+	} {
+		if _, err := tr.AddFile(p); err != nil {
+			t.Fatalf("could not add path=%q: %+v", p, err)
+		}
+	}
+	if _, err := tr.AddSymLink("/Docs", "/Users/Public/Documents"); err != nil {
+		t.Fatalf("could not add link: %+v", err)
+	}
+	if _, err := tr.AddSymLink("/Readme", "/Docs/README.TXT"); err != nil {
+		t.Fatalf("could not add link: %+v", err)
+	}
+
+	if _, err := tr.AddSymLink("/Motd", "/etc/hosts"); err != nil {
+		t.Fatalf("could not add link: %+v", err)
+	}
+
+	// a stand-in for unicode normalization (NFC) that composes an "e" followed by a combining acute accent
+	composeAcute := func(s string) string {
+		return strings.NewReplacer("e\u0301", "\u00e9", "E\u0301", "\u00c9").Replace(s)
+	}
+
+	tests := []struct {
+		name     string
+		path     file.Path
+		fold     PathFold
+		options  []LinkResolutionOption
+		expected file.Path
+	}{
+		{
+			name:     "exact path",
+			path:     "/Windows/System32/drivers/etc/hosts",
+			fold:     CaseInsensitive,
+			expected: "/Windows/System32/drivers/etc/hosts",
+		},
+		{
+			name:     "different case",
+			path:     "/WINDOWS/system32/Drivers/ETC/HOSTS",
+			fold:     CaseInsensitive,
+			expected: "/Windows/System32/drivers/etc/hosts",
+		},
+		{
+			name:     "exact match preferred",
+			path:     "/etc/Hosts",
+			fold:     CaseInsensitive,
+			expected: "/etc/Hosts",
+		},
+		{
+			name:     "lexically smallest of multiple matches",
+			path:     "/ETC/HOSTS",
+			fold:     CaseInsensitive,
+			expected: "/etc/Hosts",
+		},
+		{
+			name:     "through an ancestor link",
+			path:     "/docs/README.TXT",
+			fold:     CaseInsensitive,
+			expected: "/Users/Public/Documents/readme.txt",
+		},
+		{
+			name:     "basename link is not followed by default",
+			path:     "/docs",
+			fold:     CaseInsensitive,
+			expected: "/Docs",
+		},
+		{
+			name:     "basename link followed",
+			path:     "/MOTD",
+			fold:     CaseInsensitive,
+			options:  []LinkResolutionOption{FollowBasenameLinks},
+			expected: "/etc/hosts",
+		},
+		{
+			name: "link target with different case is not folded",
+			path: "/readme",
+			fold: CaseInsensitive,
+			// note: link targets are resolved exactly (as with File)
+			options: []LinkResolutionOption{FollowBasenameLinks},
+		},
+		{
+			name:     "normalized",
+			path:     "/CAFE\u0301/Menu.txt",
+			fold:     NormalizedCaseInsensitive(composeAcute),
+			expected: "/caf\u00e9/menu.txt",
+		},
+		{
+			name: "not normalized",
+			path: "/CAFE\u0301/Menu.txt",
+			fold: CaseInsensitive,
+		},
+		{
+			name: "missing path",
+			path: "/windows/system32/missing",
+			fold: CaseInsensitive,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exists, ref, err := tr.FileWithFold(test.path, test.fold, test.options...)
+			if err != nil {
+				t.Fatalf("could not get file: %+v", err)
+			}
+			if test.expected == "" {
+				if exists && ref != nil {
+					t.Fatalf("expected no file, got %q", ref.RealPath)
+				}
+				return
+			}
+			if !exists || ref == nil {
+				t.Fatalf("expected file=%q", test.expected)
+			}
+			if ref.RealPath != test.expected {
+				t.Errorf("unexpected file: %q != %q", ref.RealPath, test.expected)
+			}
+		})
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"Windows", "WINDOWS"},
+		{"stra\u00dfe", "STRA\u00dfE"},
+		{"\u03a9mega", "\u03c9MEGA"},
+		// the kelvin sign folds to "k"
+		{"\u212a", "k"},
+	} {
+		if CaseInsensitive(pair[0]) != CaseInsensitive(pair[1]) {
+			t.Errorf("expected %q to match %q", pair[0], pair[1])
+		}
+	}
+	if CaseInsensitive("hosts") == CaseInsensitive("host") {
+		t.Errorf("expected different paths not to match")
+	}
+}
@@ -0,0 +1,106 @@
+package filetree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	"github.com/anchore/stereoscope/pkg/tree"
+)
+
+// fileTreeSchemaVersion is the version of the persisted file tree format (bumped on incompatible changes).
+const fileTreeSchemaVersion = 1
+
+var ErrFileTreeSchemaVersion = fmt.Errorf("unsupported file tree schema version")
+
+// savedFileTree is the persisted form of a FileTree.
+type savedFileTree struct {
+	SchemaVersion int
+	// Nodes are all nodes within the tree in depth-first order (parents before children).
+	Nodes []savedFileNode
+}
+
+// savedFileNode is the persisted form of a single filenode.FileNode.
+type savedFileNode struct {
+	RealPath file.Path
+	FileType file.Type
+	LinkPath file.Path
+	// HasReference indicates that the node has a file.Reference (implied parent directories do not).
+	HasReference bool
+	ReferenceID  file.ID
+}
+
+// Marshal encodes all paths within the tree (along with the file.Reference of each path) into a compact binary form,
+// such that the tree can be restored via Unmarshal (e.g. by another process) without reading the image again. File
+// references keep their IDs, so a tree may be persisted along with the file catalog the references were cataloged in
+// (see image.FileCatalog.Save).
+func (t *FileTree) Marshal() ([]byte, error) {
+	saved := savedFileTree{
+		SchemaVersion: fileTreeSchemaVersion,
+	}
+	for _, fn := range t.sortedNodes() {
+		savedNode := savedFileNode{
+			RealPath: fn.RealPath,
+			FileType: fn.FileType,
+			LinkPath: fn.LinkPath,
+		}
+		if fn.Reference != nil {
+			savedNode.HasReference = true
+			savedNode.ReferenceID = fn.Reference.ID()
+		}
+		saved.Nodes = append(saved.Nodes, savedNode)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(saved); err != nil {
+		return nil, fmt.Errorf("unable to marshal file tree: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal replaces all paths within the tree with the paths decoded from the given data (as encoded by Marshal).
+// Restored file references have the same IDs as the references within the marshaled tree.
+func (t *FileTree) Unmarshal(data []byte) error {
+	var saved savedFileTree
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil {
+		return fmt.Errorf("unable to unmarshal file tree: %w", err)
+	}
+
+	if saved.SchemaVersion != fileTreeSchemaVersion {
+		return fmt.Errorf("%w: %d", ErrFileTreeSchemaVersion, saved.SchemaVersion)
+	}
+
+	restored := &FileTree{
+		tree: tree.NewTree(),
+	}
+	if err := restored.tree.AddRoot(filenode.NewDir("/", nil)); err != nil {
+		return err
+	}
+
+	// the same reference may be held by multiple nodes, which should remain the same reference once restored
+	refs := make(map[file.ID]*file.Reference)
+	for _, savedNode := range saved.Nodes {
+		fn := &filenode.FileNode{
+			RealPath: savedNode.RealPath,
+			FileType: savedNode.FileType,
+			LinkPath: savedNode.LinkPath,
+		}
+		if savedNode.HasReference {
+			ref, ok := refs[savedNode.ReferenceID]
+			if !ok {
+				ref = file.RestoreFileReference(savedNode.ReferenceID, savedNode.RealPath)
+				refs[savedNode.ReferenceID] = ref
+			}
+			fn.Reference = ref
+		}
+		// note: parents are always restored before children, so the parent of each node is already within the tree
+		if err := restored.setFileNode(fn); err != nil {
+			return fmt.Errorf("unable to unmarshal file tree path=%q: %w", savedNode.RealPath, err)
+		}
+	}
+
+	t.tree = restored.tree
+	return nil
+}
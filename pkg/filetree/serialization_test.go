@@ -0,0 +1,104 @@
+package filetree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestFileTree_MarshalUnmarshal(t *testing.T) {
+	original := NewFileTree()
+	fileRef, err := original.AddFile("/etc/hosts")
+	if err != nil {
+		t.Fatalf("could not add file: %+v", err)
+	}
+	dirRef, err := original.AddDir("/var/lib")
+	if err != nil {
+		t.Fatalf("could not add dir: %+v", err)
+	}
+	if _, err := original.AddSymLink("/etc/hosts-link", "./hosts"); err != nil {
+		t.Fatalf("could not add symlink: %+v", err)
+	}
+	if _, err := original.AddSymLink("/lib", "/var/lib"); err != nil {
+		t.Fatalf("could not add symlink: %+v", err)
+	}
+	if _, err := original.AddHardLink("/etc/hosts-hardlink", "/etc/hosts"); err != nil {
+		t.Fatalf("could not add hardlink: %+v", err)
+	}
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("could not marshal tree: %+v", err)
+	}
+
+	restored := NewFileTree()
+	if _, err := restored.AddFile("/stale.txt"); err != nil {
+		t.Fatalf("could not add file: %+v", err)
+	}
+	if err := restored.Unmarshal(data); err != nil {
+		t.Fatalf("could not unmarshal tree: %+v", err)
+	}
+
+	if !original.Equal(restored) {
+		extra, missing := original.PathDiff(restored)
+		t.Fatalf("unexpected restored tree: extra=%+v missing=%+v", extra, missing)
+	}
+	if restored.HasPath("/stale.txt") {
+		t.Errorf("expected existing paths to be replaced")
+	}
+
+	for _, test := range []struct {
+		path     file.Path
+		expected *file.Reference
+	}{
+		{path: "/etc/hosts", expected: fileRef},
+		{path: "/etc/hosts-link", expected: fileRef},
+		{path: "/lib", expected: dirRef},
+	} {
+		_, ref, err := restored.File(test.path, FollowBasenameLinks)
+		if err != nil {
+			t.Fatalf("could not get path=%q: %+v", test.path, err)
+		}
+		if ref == nil {
+			t.Fatalf("expected a reference for path=%q", test.path)
+		}
+		if ref.ID() != test.expected.ID() || ref.RealPath != test.expected.RealPath {
+			t.Errorf("unexpected reference for path=%q: %+v != %+v", test.path, ref, test.expected)
+		}
+	}
+
+	// implied parent directories have no reference
+	_, ref, err := restored.File("/var")
+	if err != nil {
+		t.Fatalf("could not get path: %+v", err)
+	}
+	if ref != nil {
+		t.Errorf("expected no reference for an implied dir, got %+v", ref)
+	}
+
+	// references created afterwards must not collide with restored references
+	newRef, err := restored.AddFile("/etc/new")
+	if err != nil {
+		t.Fatalf("could not add file: %+v", err)
+	}
+	for _, ref := range original.AllFiles() {
+		if newRef.ID() <= ref.ID() {
+			t.Errorf("expected new reference id=%d to be greater than restored id=%d", newRef.ID(), ref.ID())
+		}
+	}
+}
+
+func TestFileTree_Unmarshal_SchemaVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(savedFileTree{SchemaVersion: fileTreeSchemaVersion + 1}); err != nil {
+		t.Fatalf("could not encode tree: %+v", err)
+	}
+
+	err := NewFileTree().Unmarshal(buf.Bytes())
+	if !errors.Is(err, ErrFileTreeSchemaVersion) {
+		t.Errorf("expected a schema version error, got %+v", err)
+	}
+}
@@ -16,7 +16,9 @@ func (u *UnionFileTree) PushTree(t *FileTree) {
 	u.trees = append(u.trees, t)
 }
 
-func (u *UnionFileTree) Squash() (*FileTree, error) {
+// Squash merges all trees in the order pushed (see FileTree.Merge), returning the combined tree.
+func (u *UnionFileTree) Squash(options ...MergeOption) (*FileTree, error) {
+	strategy := newMergeStrategy(options...)
 	switch len(u.trees) {
 	case 0:
 		return NewFileTree(), nil
@@ -35,7 +37,7 @@ func (u *UnionFileTree) Squash() (*FileTree, error) {
 			continue
 		}
 
-		if err = squashedTree.merge(refTree); err != nil {
+		if err = squashedTree.merge(refTree, strategy); err != nil {
 			return nil, fmt.Errorf("unable to squash layer=%d : %w", layerIdx, err)
 		}
 	}
@@ -1,6 +1,7 @@
 package filetree
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
@@ -142,3 +143,108 @@ func TestUnionFileTree_Squash_whiteout(t *testing.T) {
 	}
 
 }
+
+// newBenchmarkLayerTrees creates a base tree with the given number of files and an upper tree that overrides, adds,
+// and deletes a portion of those files (similar to a package install on top of a base image).
+func newBenchmarkLayerTrees(b *testing.B, files int) (*FileTree, *FileTree) {
+	base := NewFileTree()
+	upper := NewFileTree()
+	for idx := 0; idx < files; idx++ {
+		dir := fmt.Sprintf("/usr/lib/pkg-%d/module-%d", idx/1000, (idx/50)%20)
+		if _, err := base.AddFile(file.Path(fmt.Sprintf("%s/file-%d.py", dir, idx))); err != nil {
+			b.Fatalf("could not add base file: %+v", err)
+		}
+
+		var err error
+		switch idx % 10 {
+		case 0:
+			_, err = upper.AddFile(file.Path(fmt.Sprintf("%s/file-%d.py", dir, idx)))
+		case 1:
+			_, err = upper.AddFile(file.Path(fmt.Sprintf("%s/new-file-%d.py", dir, idx)))
+		case 2:
+			_, err = upper.AddFile(file.Path(fmt.Sprintf("%s/%sfile-%d.py", dir, file.WhiteoutPrefix, idx)))
+		}
+		if err != nil {
+			b.Fatalf("could not add upper file: %+v", err)
+		}
+	}
+	return base, upper
+}
+
+func BenchmarkUnionFileTree_Squash(b *testing.B) {
+	for _, files := range []int{10000, 200000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			base, upper := newBenchmarkLayerTrees(b, files)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ut := NewUnionFileTree()
+				ut.PushTree(base)
+				ut.PushTree(upper)
+				if _, err := ut.Squash(); err != nil {
+					b.Fatalf("could not squash: %+v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnionFileTree_SquashDeep(b *testing.B) {
+	// simulates squashing each layer of a deep image, where each squash is the squash of the previous layer with
+	// the next layer (all squash trees are retained, as with image layers)
+	const layers = 30
+	base, upper := newBenchmarkLayerTrees(b, 10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		squashed := make([]*FileTree, 0, layers)
+		last := base
+		for idx := 0; idx < layers; idx++ {
+			ut := NewUnionFileTree()
+			ut.PushTree(last)
+			ut.PushTree(upper)
+			next, err := ut.Squash()
+			if err != nil {
+				b.Fatalf("could not squash: %+v", err)
+			}
+			squashed = append(squashed, next)
+			last = next
+		}
+	}
+}
+
+func TestUnionFileTree_Squash_IgnoreWhiteouts(t *testing.T) {
+	lower := NewFileTree()
+	for _, p := range []file.Path{"/etc/secret", "/var/cache/old"} {
+		if _, err := lower.AddFile(p); err != nil {
+			t.Fatalf("could not add path: %+v", err)
+		}
+	}
+	upper := NewFileTree()
+	for _, p := range []file.Path{"/etc/.wh.secret", "/var/cache/.wh..wh..opq", "/var/cache/new"} {
+		if _, err := upper.AddFile(p); err != nil {
+			t.Fatalf("could not add path: %+v", err)
+		}
+	}
+
+	union := NewUnionFileTree()
+	union.PushTree(lower)
+	union.PushTree(upper)
+	squashed, err := union.Squash(IgnoreWhiteouts)
+	if err != nil {
+		t.Fatalf("could not squash: %+v", err)
+	}
+
+	for _, p := range []file.Path{"/etc/secret", "/var/cache/old", "/var/cache/new"} {
+		if !squashed.HasPath(p) {
+			t.Errorf("expected path=%q", p)
+		}
+	}
+	for _, p := range []file.Path{"/etc/.wh.secret", "/var/cache/.wh..wh..opq"} {
+		if squashed.HasPath(p) {
+			t.Errorf("unexpected whiteout path=%q", p)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/afero"
+)
+
+const (
+	UnknownArchive ArchiveType = iota
+	DockerArchive
+	OciArchive
+	OciDirectory
+	SquashfsArchive
+)
+
+var archiveTypeStr = [...]string{
+	"UnknownArchive",
+	"DockerArchive",
+	"OciArchive",
+	"OciDirectory",
+	"SquashfsArchive",
+}
+
+// squashfsMagic is the magic number found at the start of every squashfs filesystem ("hsqs", little endian).
+var squashfsMagic = []byte("hsqs")
+
+// ArchiveType is the format of an image on disk, as determined by the content at a path (not the name of the path).
+type ArchiveType uint8
+
+// String returns a convenient display string for the archive type.
+func (t ArchiveType) String() string {
+	return archiveTypeStr[t]
+}
+
+// Source returns the image source that can provide images for the archive type (UnknownSource if there is none).
+func (t ArchiveType) Source() Source {
+	switch t {
+	case DockerArchive:
+		return DockerTarballSource
+	case OciArchive:
+		return OciTarballSource
+	case OciDirectory:
+		return OciDirectorySource
+	}
+	return UnknownSource
+}
+
+// DetectArchiveType determines the format of the image at the given path by inspecting its content: an OCI layout
+// directory (with an oci-layout file), a docker archive (manifest.json, or a repositories file for legacy archives), an
+// OCI archive (oci-layout within a tar), or a squashfs filesystem (by magic bytes). Note: index.json alone is not
+// considered evidence of an OCI layout since it is optional. UnknownArchive is returned when the path does not exist or
+// the content is not recognized.
+func DetectArchiveType(imgPath string) (ArchiveType, error) {
+	return detectArchiveType(afero.NewOsFs(), imgPath)
+}
+
+func detectArchiveType(fs afero.Fs, imgPath string) (ArchiveType, error) {
+	imgPath, err := homedir.Expand(imgPath)
+	if err != nil {
+		return UnknownArchive, fmt.Errorf("unable to expand potential home dir expression: %w", err)
+	}
+
+	pathStat, err := fs.Stat(imgPath)
+	if os.IsNotExist(err) {
+		return UnknownArchive, nil
+	} else if err != nil {
+		return UnknownArchive, fmt.Errorf("failed to open path=%s: %w", imgPath, err)
+	}
+
+	if pathStat.IsDir() {
+		if _, err := fs.Stat(path.Join(imgPath, "oci-layout")); err == nil {
+			return OciDirectory, nil
+		}
+
+		// there are no other directory-based formats
+		return UnknownArchive, nil
+	}
+
+	archive, err := fs.Open(imgPath)
+	if err != nil {
+		return UnknownArchive, fmt.Errorf("unable to open archive=%s: %w", imgPath, err)
+	}
+	defer archive.Close()
+
+	magic := make([]byte, len(squashfsMagic))
+	if _, err := io.ReadFull(archive, magic); err == nil && bytes.Equal(magic, squashfsMagic) {
+		return SquashfsArchive, nil
+	}
+
+	if _, err = archive.Seek(0, io.SeekStart); err != nil {
+		return UnknownArchive, fmt.Errorf("unable to seek archive=%s: %w", imgPath, err)
+	}
+
+	return detectTarArchiveType(archive)
+}
+
+// detectTarArchiveType determines the archive type from the root-level entries within a tar.
+func detectTarArchiveType(reader io.Reader) (ArchiveType, error) {
+	var hasOciLayout, hasLegacyRepositories bool
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return UnknownArchive, err
+		}
+
+		switch strings.TrimPrefix(header.Name, "./") {
+		case "manifest.json":
+			// note: newer docker archives are also OCI archives (with oci-layout and index.json), however, the docker
+			// archive format is preferred since it has richer metadata (e.g. tags)
+			return DockerArchive, nil
+		case "oci-layout":
+			hasOciLayout = true
+		case "repositories":
+			hasLegacyRepositories = true
+		}
+	}
+
+	switch {
+	case hasOciLayout:
+		return OciArchive, nil
+	case hasLegacyRepositories:
+		return DockerArchive, nil
+	}
+	return UnknownArchive, nil
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestDetectArchiveType(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		kind     string
+		expected ArchiveType
+	}{
+		{
+			name:     "docker archive",
+			paths:    []string{"manifest.json"},
+			kind:     "tar",
+			expected: DockerArchive,
+		},
+		{
+			name:     "docker archive with relative entries",
+			paths:    []string{"./manifest.json"},
+			kind:     "tar",
+			expected: DockerArchive,
+		},
+		{
+			name:     "docker archive that is also an oci archive",
+			paths:    []string{"oci-layout", "index.json", "manifest.json"},
+			kind:     "tar",
+			expected: DockerArchive,
+		},
+		{
+			name:     "legacy docker archive",
+			paths:    []string{"repositories", "abc/layer.tar"},
+			kind:     "tar",
+			expected: DockerArchive,
+		},
+		{
+			name:     "oci archive",
+			paths:    []string{"oci-layout", "index.json"},
+			kind:     "tar",
+			expected: OciArchive,
+		},
+		{
+			name:     "unknown archive",
+			paths:    []string{"index.json"},
+			kind:     "tar",
+			expected: UnknownArchive,
+		},
+		{
+			name:     "oci directory",
+			paths:    []string{"oci-layout"},
+			kind:     "dir",
+			expected: OciDirectory,
+		},
+		{
+			name:     "squashfs",
+			kind:     "squashfs",
+			expected: SquashfsArchive,
+		},
+		{
+			name:     "missing path",
+			kind:     "none",
+			expected: UnknownArchive,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			var testPath string
+			switch test.kind {
+			case "tar":
+				testPath = getDummyTar(t, fs.(*afero.MemMapFs), "image.tar", test.paths...)
+			case "dir":
+				testPath = getDummyPath(t, fs.(*afero.MemMapFs), "image", test.paths...)
+			case "squashfs":
+				testPath = "image.sqfs"
+				if err := afero.WriteFile(fs, testPath, append([]byte("hsqs"), make([]byte, 92)...), 0644); err != nil {
+					t.Fatalf("could not write squashfs: %+v", err)
+				}
+			case "none":
+				testPath = "/does-not-exist"
+			}
+
+			actual, err := detectArchiveType(fs, testPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("unexpected archive type: %s (expected: %s)", actual, test.expected)
+			}
+		})
+	}
+}
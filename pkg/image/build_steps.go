@@ -0,0 +1,53 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// LayersByCommand returns all layers created by a build step with a command that contains the given text (e.g.
+// "apt-get install"), in build order (see LayerMetadata.CreatedBy).
+func (i *Image) LayersByCommand(command string) []*Layer {
+	var layers []*Layer
+	for _, layer := range i.Layers {
+		if layer.Metadata.CreatedBy != "" && strings.Contains(layer.Metadata.CreatedBy, command) {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// BuildStepFromSquash returns the history entry of the build step that last added (or modified) the given path,
+// relative to the image squash tree (e.g. to report that a file was added by "RUN apt-get install ..."). Links are not
+// followed, so the build step that added the link itself is returned. When the image config history does not describe
+// the layer, only the layer index of the returned entry is populated.
+func (i *Image) BuildStepFromSquash(path file.Path) (HistoryEntry, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return HistoryEntry{}, err
+	}
+
+	exists, ref, err := i.squashedTree().File(path)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if !exists || ref == nil {
+		return HistoryEntry{}, fmt.Errorf("%w: path=%q", ErrFileNotFound, path)
+	}
+
+	entry, err := i.FileCatalog.Get(*ref)
+	if err != nil {
+		return HistoryEntry{}, fmt.Errorf("%w: path=%q", err, path)
+	}
+	if entry.Layer == nil {
+		return HistoryEntry{}, fmt.Errorf("no layer found for path=%q", path)
+	}
+
+	layerIdx := int(entry.Layer.Metadata.Index)
+	if history, ok := i.Metadata.LayerHistory(layerIdx); ok {
+		return history, nil
+	}
+	return HistoryEntry{LayerIndex: layerIdx}, nil
+}
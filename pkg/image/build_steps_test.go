@@ -0,0 +1,129 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// buildStepsImage returns an image where each layer was created by a distinct build step (with empty layer steps in
+// between).
+func buildStepsImage(t *testing.T) *Image {
+	t.Helper()
+	v1Img, err := mutate.Append(empty.Image,
+		mutate.Addendum{
+			Layer: newTestLayer(t, nil,
+				tar.Header{Typeflag: tar.TypeReg, Name: "etc/os-release"},
+				tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/curl"},
+			),
+			History: v1.History{CreatedBy: "ADD rootfs.tar /"},
+		},
+		mutate.Addendum{
+			Layer:   newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/curl"}),
+			History: v1.History{CreatedBy: "RUN apt-get install -y curl"},
+		},
+		mutate.Addendum{
+			Layer:   newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "app/main"}),
+			History: v1.History{CreatedBy: "COPY main /app/main"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	// note: empty layer steps are only found within the history (not the layers)
+	cfg, err := v1Img.ConfigFile()
+	if err != nil {
+		t.Fatalf("could not get config: %+v", err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.History = append(cfg.History[:1], append([]v1.History{{CreatedBy: "ENV DEBIAN_FRONTEND=noninteractive", EmptyLayer: true}}, cfg.History[1:]...)...)
+	v1Img, err = mutate.ConfigFile(v1Img, cfg)
+	if err != nil {
+		t.Fatalf("could not set config: %+v", err)
+	}
+
+	img := NewImage(v1Img, testTempDir(t))
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func TestImage_LayerCreatedBy(t *testing.T) {
+	img := buildStepsImage(t)
+
+	var actual []string
+	for _, layer := range img.Layers {
+		actual = append(actual, layer.Metadata.CreatedBy)
+	}
+	expected := []string{"ADD rootfs.tar /", "RUN apt-get install -y curl", "COPY main /app/main"}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("unexpected layer commands: %q != %q", actual, expected)
+	}
+}
+
+func TestImage_LayersByCommand(t *testing.T) {
+	img := buildStepsImage(t)
+
+	layers := img.LayersByCommand("apt-get install")
+	if len(layers) != 1 || layers[0].Metadata.Index != 1 {
+		t.Errorf("unexpected layers: %+v", layers)
+	}
+
+	if layers := img.LayersByCommand("yum install"); len(layers) != 0 {
+		t.Errorf("unexpected layers: %+v", layers)
+	}
+}
+
+func TestImage_BuildStepFromSquash(t *testing.T) {
+	img := buildStepsImage(t)
+
+	tests := []struct {
+		path     file.Path
+		expected HistoryEntry
+		err      error
+	}{
+		{
+			path:     "/etc/os-release",
+			expected: HistoryEntry{CreatedBy: "ADD rootfs.tar /", LayerIndex: 0},
+		},
+		{
+			// the file is replaced by a later step
+			path:     "/usr/bin/curl",
+			expected: HistoryEntry{CreatedBy: "RUN apt-get install -y curl", LayerIndex: 1},
+		},
+		{
+			path:     "/app/main",
+			expected: HistoryEntry{CreatedBy: "COPY main /app/main", LayerIndex: 2},
+		},
+		{
+			path: "/missing",
+			err:  ErrFileNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			actual, err := img.BuildStepFromSquash(test.path)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error %+v, got %+v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not get build step: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("unexpected build step: %+v != %+v", actual, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"context"
+	"time"
+)
+
+// BuildTimestamps summarizes the timestamps that describe when the image (and each layer) was built, which can be
+// used to flag stale base images or builds that are not reproducible (i.e. builds that embed the time of the build).
+type BuildTimestamps struct {
+	// Created is the image creation time from the image config (zero if not provided).
+	Created time.Time
+	// Layers contains the timestamps for each layer (in build order).
+	Layers []LayerTimestamps
+	// NewestFileModTime is the most recent file modification time across all layers.
+	NewestFileModTime time.Time
+	// OldestFileModTime is the least recent file modification time across all layers.
+	OldestFileModTime time.Time
+	// UniformFileModTimes indicates that all files share the same modification time, which is typical of builds that
+	// normalize timestamps for reproducibility (e.g. via SOURCE_DATE_EPOCH).
+	UniformFileModTimes bool
+}
+
+// LayerTimestamps summarizes the timestamps for a single layer.
+type LayerTimestamps struct {
+	// Created is the time from the image config history entry for the layer (zero if not provided).
+	Created time.Time
+	// CreatedBy is the command from the image config history entry for the layer (empty if not provided).
+	CreatedBy string
+	// NewestFileModTime is the most recent file modification time within the layer.
+	NewestFileModTime time.Time
+}
+
+// BuildTimestamps returns the image config creation time, the history timestamp for each layer, and a summary of
+// the file modification times found within all layers (files without a modification time are ignored).
+func (i *Image) BuildTimestamps() (BuildTimestamps, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return BuildTimestamps{}, err
+	}
+
+	result := BuildTimestamps{
+		Created: i.Metadata.Config.Created.Time,
+		Layers:  make([]LayerTimestamps, len(i.Layers)),
+	}
+
+	// history entries for empty layers (e.g. ENV or CMD instructions) do not have a corresponding layer
+	for _, history := range i.Metadata.History {
+		if history.LayerIndex < 0 || history.LayerIndex >= len(result.Layers) {
+			continue
+		}
+		result.Layers[history.LayerIndex].Created = history.Created
+		result.Layers[history.LayerIndex].CreatedBy = history.CreatedBy
+	}
+
+	layerIndexes := make(map[*Layer]int)
+	for idx, layer := range i.Layers {
+		layerIndexes[layer] = idx
+	}
+
+	var fileCount int
+	result.UniformFileModTimes = true
+	for _, id := range i.FileCatalog.ids() {
+		entry, err := i.FileCatalog.get(id)
+		if err != nil {
+			return BuildTimestamps{}, err
+		}
+		if entry == nil || entry.Metadata.ModTime.IsZero() {
+			continue
+		}
+		modTime := entry.Metadata.ModTime
+
+		if fileCount > 0 && !modTime.Equal(result.NewestFileModTime) {
+			result.UniformFileModTimes = false
+		}
+		if fileCount == 0 || modTime.After(result.NewestFileModTime) {
+			result.NewestFileModTime = modTime
+		}
+		if fileCount == 0 || modTime.Before(result.OldestFileModTime) {
+			result.OldestFileModTime = modTime
+		}
+		fileCount++
+
+		if idx, ok := layerIndexes[entry.Layer]; ok && modTime.After(result.Layers[idx].NewestFileModTime) {
+			result.Layers[idx].NewestFileModTime = modTime
+		}
+	}
+
+	result.UniformFileModTimes = result.UniformFileModTimes && fileCount > 0
+
+	return result, nil
+}
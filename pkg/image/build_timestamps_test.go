@@ -0,0 +1,115 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func TestImage_BuildTimestamps(t *testing.T) {
+	base := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	build := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	epoch := time.Unix(0, 0).UTC()
+
+	tests := []struct {
+		name     string
+		layers   []mutate.Addendum
+		expected BuildTimestamps
+	}{
+		{
+			name: "varying timestamps",
+			layers: []mutate.Addendum{
+				{
+					Layer: newTestLayer(t, nil,
+						tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", ModTime: base},
+						tar.Header{Typeflag: tar.TypeReg, Name: "etc/group", ModTime: base.Add(-time.Hour)},
+					),
+					History: v1.History{Created: v1.Time{Time: base}, CreatedBy: "ADD rootfs.tar /"},
+				},
+				{
+					Layer:   newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "app/main", ModTime: build}),
+					History: v1.History{Created: v1.Time{Time: build}, CreatedBy: "COPY main /app/main"},
+				},
+			},
+			expected: BuildTimestamps{
+				Created: build,
+				Layers: []LayerTimestamps{
+					{Created: base, CreatedBy: "ADD rootfs.tar /", NewestFileModTime: base},
+					{Created: build, CreatedBy: "COPY main /app/main", NewestFileModTime: build},
+				},
+				NewestFileModTime: build,
+				OldestFileModTime: base.Add(-time.Hour),
+			},
+		},
+		{
+			name: "normalized timestamps",
+			layers: []mutate.Addendum{
+				{
+					Layer: newTestLayer(t, nil,
+						tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", ModTime: epoch},
+						tar.Header{Typeflag: tar.TypeReg, Name: "etc/group", ModTime: epoch},
+					),
+					History: v1.History{Created: v1.Time{Time: epoch}},
+				},
+			},
+			expected: BuildTimestamps{
+				Created: build,
+				Layers: []LayerTimestamps{
+					{Created: epoch, NewestFileModTime: epoch},
+				},
+				NewestFileModTime:   epoch,
+				OldestFileModTime:   epoch,
+				UniformFileModTimes: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1Image, err := mutate.Append(empty.Image, test.layers...)
+			if err != nil {
+				t.Fatalf("could not create image: %+v", err)
+			}
+			v1Image, err = mutate.CreatedAt(v1Image, v1.Time{Time: build})
+			if err != nil {
+				t.Fatalf("could not set created time: %+v", err)
+			}
+
+			img := NewImage(v1Image, testTempDir(t))
+			if err := img.Read(); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			actual, err := img.BuildTimestamps()
+			if err != nil {
+				t.Fatalf("could not get build timestamps: %+v", err)
+			}
+
+			if !actual.Created.Equal(test.expected.Created) {
+				t.Errorf("unexpected created time: %+v", actual.Created)
+			}
+			if !actual.NewestFileModTime.Equal(test.expected.NewestFileModTime) {
+				t.Errorf("unexpected newest file mod time: %+v", actual.NewestFileModTime)
+			}
+			if !actual.OldestFileModTime.Equal(test.expected.OldestFileModTime) {
+				t.Errorf("unexpected oldest file mod time: %+v", actual.OldestFileModTime)
+			}
+			if actual.UniformFileModTimes != test.expected.UniformFileModTimes {
+				t.Errorf("unexpected uniform file mod times: %+v", actual.UniformFileModTimes)
+			}
+			if len(actual.Layers) != len(test.expected.Layers) {
+				t.Fatalf("unexpected layers: %+v", actual.Layers)
+			}
+			for idx, expected := range test.expected.Layers {
+				layer := actual.Layers[idx]
+				if !layer.Created.Equal(expected.Created) || layer.CreatedBy != expected.CreatedBy || !layer.NewestFileModTime.Equal(expected.NewestFileModTime) {
+					t.Errorf("unexpected layer %d timestamps: %+v", idx, layer)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package image
+
+import (
+	"io"
+	"sync"
+)
+
+// BytesRead is the number of bytes read for a single image, by where the bytes were read from.
+type BytesRead struct {
+	// Remote is the number of bytes transferred from a registry or a daemon (e.g. pulled blobs or a saved image).
+	Remote int64
+	// Disk is the number of bytes read from local disk (image archives, OCI layouts, and the content cache dir).
+	Disk int64
+}
+
+// Total is the number of bytes read from all sources.
+func (b BytesRead) Total() int64 {
+	return b.Remote + b.Disk
+}
+
+// BytesReadHook is called with the number of additional bytes read each time bytes are read for an image, which is
+// useful for feeding metrics (e.g. to attribute egress costs). Hooks may be called concurrently.
+type BytesReadHook func(read BytesRead)
+
+// ByteCounter tracks the bytes read for a single image. Providers record the bytes read while providing the image
+// (see WithByteCounter) and the image records all bytes read for layer content thereafter.
+type ByteCounter struct {
+	lock  sync.Mutex
+	total BytesRead
+	hooks []BytesReadHook
+}
+
+// NewByteCounter creates a new, empty ByteCounter.
+func NewByteCounter() *ByteCounter {
+	return &ByteCounter{}
+}
+
+// WithByteCounter associates the counter that the provider recorded bytes read with while providing the image, so
+// these are included in the totals for the image.
+func WithByteCounter(counter *ByteCounter) AdditionalMetadata {
+	return func(image *Image) error {
+		image.bytesRead = counter
+		return nil
+	}
+}
+
+// WithBytesReadHook registers a hook that is called each time bytes are read for the image. Bytes that were already
+// read (e.g. by the provider before the image was read) are reported to the hook upon the first image read.
+func WithBytesReadHook(hook BytesReadHook) ReadOption {
+	return func(image *Image) error {
+		image.bytesReadHooks = append(image.bytesReadHooks, hook)
+		return nil
+	}
+}
+
+// AddRemote records the given number of bytes as read from a registry or daemon.
+func (c *ByteCounter) AddRemote(n int64) {
+	c.add(BytesRead{Remote: n})
+}
+
+// AddDisk records the given number of bytes as read from local disk.
+func (c *ByteCounter) AddDisk(n int64) {
+	c.add(BytesRead{Disk: n})
+}
+
+func (c *ByteCounter) add(read BytesRead) {
+	if c == nil || read.Total() == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	c.total.Remote += read.Remote
+	c.total.Disk += read.Disk
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	for _, hook := range hooks {
+		hook(read)
+	}
+}
+
+// addHooks registers the given hooks, reporting all bytes read so far to each.
+func (c *ByteCounter) addHooks(hooks ...BytesReadHook) {
+	if c == nil || len(hooks) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	// note: the slice is copied since it is iterated outside of the lock
+	c.hooks = append(append([]BytesReadHook{}, c.hooks...), hooks...)
+	total := c.total
+	c.lock.Unlock()
+
+	if total.Total() == 0 {
+		return
+	}
+	for _, hook := range hooks {
+		hook(total)
+	}
+}
+
+// BytesRead returns the bytes read so far.
+func (c *ByteCounter) BytesRead() BytesRead {
+	if c == nil {
+		return BytesRead{}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.total
+}
+
+// RemoteReader records all bytes read from the given reader as read from a registry or daemon.
+func (c *ByteCounter) RemoteReader(reader io.Reader) io.Reader {
+	return &countingReader{reader: reader, count: c.AddRemote}
+}
+
+// DiskReader records all bytes read from the given reader as read from local disk.
+func (c *ByteCounter) DiskReader(reader io.Reader) io.Reader {
+	return &countingReader{reader: reader, count: c.AddDisk}
+}
+
+// countingReader reports the number of bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  func(int64)
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.count(int64(n))
+	return n, err
+}
+
+// countingLayerOpener is a LayerOpener that records all layer content read as read from local disk.
+type countingLayerOpener struct {
+	LayerOpener
+	counter *ByteCounter
+}
+
+func (o countingLayerOpener) Open() (io.ReadCloser, error) {
+	return o.wrap(o.LayerOpener.Open())
+}
+
+func (o countingLayerOpener) OpenExtent(offset, size int64) (io.ReadCloser, error) {
+	return o.wrap(o.LayerOpener.OpenExtent(offset, size))
+}
+
+func (o countingLayerOpener) wrap(reader io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &extentReadCloser{
+		Reader: o.counter.DiskReader(reader),
+		Closer: reader,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestImage_BytesRead(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	// bytes recorded by the provider before the image is read
+	counter := NewByteCounter()
+	counter.AddRemote(100)
+
+	var lock sync.Mutex
+	var hooked BytesRead
+	hook := func(read BytesRead) {
+		lock.Lock()
+		defer lock.Unlock()
+		hooked.Remote += read.Remote
+		hooked.Disk += read.Disk
+	}
+
+	img := NewImage(randomImg, testTempDir(t), WithByteCounter(counter))
+	if err := img.Read(WithBytesReadHook(hook)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	read := img.Metadata.BytesRead
+	if read.Remote != 100 {
+		t.Errorf("unexpected remote bytes read: %d", read.Remote)
+	}
+	// each layer is read from the source (to populate the cache) and from the cache (to index the layer)
+	if read.Disk < 2*img.Metadata.Size {
+		t.Errorf("unexpected disk bytes read: %d < %d", read.Disk, 2*img.Metadata.Size)
+	}
+	if hooked != read {
+		t.Errorf("unexpected hooked bytes read: %+v != %+v", hooked, read)
+	}
+
+	// fetching file contents reads the layer again
+	var ref *file.Reference
+	for _, r := range squashedTreeOf(t, img).AllFiles() {
+		r := r
+		ref = &r
+		break
+	}
+	if ref == nil {
+		t.Fatalf("expected at least one file")
+	}
+	reader, err := img.FileContentsByReference(*ref)
+	if err != nil {
+		t.Fatalf("could not get file contents: %+v", err)
+	}
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+
+	if img.BytesRead().Disk <= read.Disk {
+		t.Errorf("expected more disk bytes read after fetching contents: %d <= %d", img.BytesRead().Disk, read.Disk)
+	}
+	if hooked != img.BytesRead() {
+		t.Errorf("unexpected hooked bytes read: %+v != %+v", hooked, img.BytesRead())
+	}
+}
@@ -0,0 +1,37 @@
+package image
+
+import "github.com/anchore/stereoscope/pkg/file"
+
+// WithCleanup associates the function that removes all temp dirs created for the image (e.g. the layer content cache),
+// see Image.Cleanup.
+func WithCleanup(fn func() error) ReadOption {
+	return func(image *Image) error {
+		image.cleanup = fn
+		return nil
+	}
+}
+
+// WithTempDirs associates the generator of all temp dirs created for the image, which must be dedicated to the image
+// (see file.TempDirGenerator.NewScope). All temp dirs are removed by Image.Cleanup (as with WithCleanup), while temp
+// dirs that are no longer used after Image.Refresh are removed right away.
+func WithTempDirs(generator *file.TempDirGenerator) ReadOption {
+	return func(image *Image) error {
+		image.tempDirs = generator
+		image.cleanup = generator.Cleanup
+		return nil
+	}
+}
+
+// Cleanup closes the file catalog (removing a disk-backed catalog, see WithDiskBackedFileCatalog) and removes all temp
+// dirs created for the image (e.g. saved images and the layer content cache), after which no file contents can be read
+// from the image. This does not affect other images. Images without temp dirs of their own (see WithCleanup) are
+// otherwise left as-is.
+func (i *Image) Cleanup() error {
+	catalogErr := i.FileCatalog.close()
+	if i.cleanup != nil {
+		if err := i.cleanup(); err != nil {
+			return err
+		}
+	}
+	return catalogErr
+}
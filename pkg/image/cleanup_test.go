@@ -0,0 +1,55 @@
+package image
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_Cleanup(t *testing.T) {
+	img := &Image{}
+	if err := img.Cleanup(); err != nil {
+		t.Fatalf("expected no error without a cleanup: %+v", err)
+	}
+
+	var called int
+	expected := errors.New("cleanup failed")
+	if err := WithCleanup(func() error {
+		called++
+		return expected
+	})(img); err != nil {
+		t.Fatalf("could not apply option: %+v", err)
+	}
+
+	if err := img.Cleanup(); !errors.Is(err, expected) {
+		t.Errorf("unexpected error: %+v", err)
+	}
+	if called != 1 {
+		t.Errorf("unexpected number of cleanup calls: %d", called)
+	}
+}
+
+func TestImage_Cleanup_ClosesDiskBackedFileCatalog(t *testing.T) {
+	img := &Image{FileCatalog: testFileCatalog(t)}
+	if err := WithDiskBackedFileCatalog(1)(img); err != nil {
+		t.Fatalf("could not apply option: %+v", err)
+	}
+	for _, p := range testFilePaths {
+		img.FileCatalog.Add(*file.NewFileReference(p), file.Metadata{Path: string(p)}, nil)
+	}
+	store, ok := img.FileCatalog.store.(*boltFileCatalogStore)
+	if !ok {
+		t.Fatalf("expected disk-backed store, got %T", img.FileCatalog.store)
+	}
+	entriesPath := store.path
+
+	// without temp dirs of its own, the image only closes the catalog
+	if err := img.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup: %+v", err)
+	}
+	if _, err := os.Stat(entriesPath); !os.IsNotExist(err) {
+		t.Errorf("expected the entries file to be removed: %+v", err)
+	}
+}
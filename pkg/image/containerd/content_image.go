@@ -0,0 +1,141 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// resolveImage returns the image (along with the raw manifest and the descriptor of the manifest) for the given
+// descriptor within the content store. An index (e.g. a multi-platform image) is resolved to the image for the given
+// platform, considering only manifests that are present within the content store (a pull may only fetch a single
+// platform).
+func resolveImage(ctx context.Context, source *contentSource, platform image.Platform, descriptor v1.Descriptor) (v1.Image, []byte, v1.Descriptor, error) {
+	switch descriptor.MediaType {
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		return nil, nil, v1.Descriptor{}, fmt.Errorf("%w: containerd manifest=%q has media type=%q", image.ErrUnsupportedMediaType, descriptor.Digest, descriptor.MediaType)
+	case types.OCIImageIndex, types.DockerManifestList:
+		// resolved below
+	default:
+		img, rawManifest, err := newContentImage(ctx, source, descriptor)
+		if err != nil {
+			return nil, nil, v1.Descriptor{}, err
+		}
+		return img, rawManifest, descriptor, nil
+	}
+
+	rawIndex, err := source.read(ctx, descriptor)
+	if err != nil {
+		return nil, nil, v1.Descriptor{}, err
+	}
+	index, err := v1.ParseIndexManifest(bytes.NewReader(rawIndex))
+	if err != nil {
+		return nil, nil, v1.Descriptor{}, image.NewProviderError(image.ErrManifestInvalid, fmt.Sprintf("unable to parse containerd index=%q", descriptor.Digest), err)
+	}
+
+	var candidates []v1.Descriptor
+	for _, manifest := range index.Manifests {
+		exists, err := source.exists(ctx, manifest)
+		if err != nil {
+			return nil, nil, v1.Descriptor{}, err
+		}
+		if !exists {
+			continue
+		}
+		if platform.Matches(manifest.Platform) {
+			return resolveImage(ctx, source, platform, manifest)
+		}
+		candidates = append(candidates, manifest)
+	}
+
+	if len(candidates) != 1 {
+		return nil, nil, v1.Descriptor{}, fmt.Errorf("unable to select a single image for platform=%q from containerd index=%q (found %d candidates)", platform, descriptor.Digest, len(candidates))
+	}
+	return resolveImage(ctx, source, platform, candidates[0])
+}
+
+// contentImage is an image within the containerd content store, where the config and layer blobs are read from the
+// content store as needed (see partial.CompressedImageCore).
+type contentImage struct {
+	source      *contentSource
+	rawManifest []byte
+	manifest    *v1.Manifest
+	mediaType   types.MediaType
+}
+
+// newContentImage reads the manifest for the given descriptor, returning the image along with the raw manifest.
+func newContentImage(ctx context.Context, source *contentSource, descriptor v1.Descriptor) (v1.Image, []byte, error) {
+	rawManifest, err := source.read(ctx, descriptor)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, nil, image.NewProviderError(image.ErrManifestInvalid, fmt.Sprintf("unable to parse containerd manifest=%q", descriptor.Digest), err)
+	}
+
+	mediaType := descriptor.MediaType
+	if mediaType == "" {
+		mediaType = manifest.MediaType
+	}
+
+	img, err := partial.CompressedToImage(&contentImage{
+		source:      source,
+		rawManifest: rawManifest,
+		manifest:    manifest,
+		mediaType:   mediaType,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, rawManifest, nil
+}
+
+func (i *contentImage) RawConfigFile() ([]byte, error) {
+	return i.source.read(context.Background(), i.manifest.Config)
+}
+
+func (i *contentImage) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *contentImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *contentImage) LayerByDigest(hash v1.Hash) (partial.CompressedLayer, error) {
+	for _, descriptor := range i.manifest.Layers {
+		if descriptor.Digest == hash {
+			return &contentLayer{source: i.source, descriptor: descriptor}, nil
+		}
+	}
+	return nil, fmt.Errorf("no layer=%q within containerd manifest", hash)
+}
+
+// contentLayer is a (compressed) layer blob within the containerd content store.
+type contentLayer struct {
+	source     *contentSource
+	descriptor v1.Descriptor
+}
+
+func (l *contentLayer) Digest() (v1.Hash, error) {
+	return l.descriptor.Digest, nil
+}
+
+func (l *contentLayer) Compressed() (io.ReadCloser, error) {
+	return l.source.open(context.Background(), l.descriptor)
+}
+
+func (l *contentLayer) Size() (int64, error) {
+	return l.descriptor.Size, nil
+}
+
+func (l *contentLayer) MediaType() (types.MediaType, error) {
+	return l.descriptor.MediaType, nil
+}
@@ -0,0 +1,170 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// daemonClient is the part of the containerd client used to read images from the containerd image and content stores.
+type daemonClient interface {
+	ImageService() images.Store
+	ContentStore() content.Store
+	Close() error
+}
+
+// newDaemonClient connects to containerd at the given socket address.
+var newDaemonClient = func(address string) (daemonClient, error) {
+	// note: the containerd client waits for a missing socket to appear (until the dial timeout)
+	if _, err := os.Stat(strings.TrimPrefix(address, "unix://")); err != nil {
+		return nil, err
+	}
+	return containerd.New(address)
+}
+
+// contentSource reads images and blobs from the containerd content store within a single namespace. A connection is
+// made for each read, so that no connection is held while the image is not being read (layers are read long after
+// the image has been provided).
+type contentSource struct {
+	address   string
+	namespace string
+	// bytesRead records all blob content read from the content store
+	bytesRead *image.ByteCounter
+}
+
+// connect connects to containerd, returning the client along with a context bound to the namespace of the source.
+func (s *contentSource) connect(ctx context.Context) (daemonClient, context.Context, error) {
+	client, err := newDaemonClient(s.address)
+	if err != nil {
+		return nil, nil, image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to connect to containerd (address=%q)", s.address), err)
+	}
+	return client, namespaces.WithNamespace(ctx, s.namespace), nil
+}
+
+// image returns the image record (naming the root manifest or index of the image) for the given image name.
+func (s *contentSource) image(ctx context.Context, imageName string) (images.Image, error) {
+	client, ctx, err := s.connect(ctx)
+	if err != nil {
+		return images.Image{}, err
+	}
+	defer client.Close()
+
+	record, err := client.ImageService().Get(ctx, imageName)
+	if err != nil {
+		return images.Image{}, daemonError(err, fmt.Sprintf("unable to get image=%q from containerd (address=%q namespace=%q)", imageName, s.address, s.namespace))
+	}
+	return record, nil
+}
+
+// images returns all image records within the namespace of the source.
+func (s *contentSource) images(ctx context.Context) ([]images.Image, error) {
+	client, ctx, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	records, err := client.ImageService().List(ctx)
+	if err != nil {
+		return nil, daemonError(err, fmt.Sprintf("unable to list images from containerd (address=%q namespace=%q)", s.address, s.namespace))
+	}
+	return records, nil
+}
+
+// exists indicates if the content store holds the blob for the given descriptor (e.g. a pull may only fetch the
+// manifest of a single platform within an index).
+func (s *contentSource) exists(ctx context.Context, descriptor v1.Descriptor) (bool, error) {
+	client, ctx, err := s.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	_, err = client.ContentStore().Info(ctx, digest.Digest(descriptor.Digest.String()))
+	switch {
+	case errdefs.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, daemonError(err, fmt.Sprintf("unable to get blob=%q from containerd", descriptor.Digest))
+	}
+	return true, nil
+}
+
+// read returns the entire blob for the given descriptor (e.g. a manifest or config).
+func (s *contentSource) read(ctx context.Context, descriptor v1.Descriptor) ([]byte, error) {
+	reader, err := s.open(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, daemonError(err, fmt.Sprintf("unable to read blob=%q from containerd", descriptor.Digest))
+	}
+	return contents, nil
+}
+
+// open returns a reader for the blob of the given descriptor, which holds a connection to containerd until closed.
+func (s *contentSource) open(ctx context.Context, descriptor v1.Descriptor) (io.ReadCloser, error) {
+	client, ctx, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	readerAt, err := client.ContentStore().ReaderAt(ctx, ocispec.Descriptor{
+		MediaType: string(descriptor.MediaType),
+		Digest:    digest.Digest(descriptor.Digest.String()),
+		Size:      descriptor.Size,
+	})
+	if err != nil {
+		client.Close()
+		return nil, daemonError(err, fmt.Sprintf("unable to open blob=%q from containerd", descriptor.Digest))
+	}
+
+	return &blobReader{
+		Reader:   s.bytesRead.RemoteReader(io.NewSectionReader(readerAt, 0, readerAt.Size())),
+		readerAt: readerAt,
+		client:   client,
+	}, nil
+}
+
+// blobReader reads a blob from the content store, closing the connection to containerd once closed.
+type blobReader struct {
+	io.Reader
+	readerAt content.ReaderAt
+	client   daemonClient
+}
+
+func (r *blobReader) Close() error {
+	err := r.readerAt.Close()
+	if closeErr := r.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// daemonError describes the given containerd failure, classifying an unreachable containerd (see
+// image.ErrDaemonUnavailable) and missing images or content (see image.ErrImageNotFound).
+func daemonError(err error, description string) error {
+	switch {
+	case errdefs.IsUnavailable(err):
+		return image.NewProviderError(image.ErrDaemonUnavailable, description, err)
+	case errdefs.IsNotFound(err):
+		return image.NewProviderError(image.ErrImageNotFound, description, err)
+	}
+	return fmt.Errorf("%s: %w", description, err)
+}
@@ -0,0 +1,148 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// DefaultAddress is the default containerd socket (overridden by the CONTAINERD_ADDRESS environment variable).
+	DefaultAddress = "/run/containerd/containerd.sock"
+	// DefaultNamespace is the default containerd namespace (overridden by the CONTAINERD_NAMESPACE environment
+	// variable). Note: images pulled by Kubernetes are within the "k8s.io" namespace.
+	DefaultNamespace = "default"
+)
+
+// DaemonImageProvider is an image.Provider capable of fetching and representing an image from the containerd content
+// store (no docker daemon is required).
+type DaemonImageProvider struct {
+	imageStr  string
+	address   string
+	namespace string
+	options   image.ProviderOptions
+	tmpDirGen *file.TempDirGenerator
+	origin    *image.Origin
+}
+
+// NewProviderFromDaemon creates a new provider instance for a specific image within the containerd content store. The
+// containerd socket address and namespace are taken from the environment (see DefaultAddress and DefaultNamespace).
+func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *DaemonImageProvider {
+	return &DaemonImageProvider{
+		imageStr:  imgStr,
+		address:   envOrDefault("CONTAINERD_ADDRESS", DefaultAddress),
+		namespace: envOrDefault("CONTAINERD_NAMESPACE", DefaultNamespace),
+		options:   options,
+		tmpDirGen: tmpDirGen,
+	}
+}
+
+// SetDaemon overrides the containerd socket address and namespace taken from the environment (e.g. for images pulled by
+// Kubernetes, which are within the "k8s.io" namespace).
+func (p *DaemonImageProvider) SetDaemon(address, namespace string) {
+	p.address = address
+	p.namespace = namespace
+}
+
+// SetOrigin overrides where the image is reported to be from, which is useful for providers that resolve the image
+// from another source and delegate to this provider.
+func (p *DaemonImageProvider) SetOrigin(origin image.Origin) {
+	p.origin = &origin
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Provide an image object that represents the cached containerd image. The image (for the selected platform) is read
+// directly from the containerd content store, where layer blobs are only read once the image is read.
+func (p *DaemonImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	origin := image.Origin{
+		Source:             image.ContainerdDaemonSource,
+		Location:           p.address,
+		AcquisitionStarted: time.Now(),
+	}
+	if p.origin != nil {
+		origin = *p.origin
+	}
+
+	imageName, err := normalizeImageName(p.imageStr)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &contentSource{
+		address:   p.address,
+		namespace: p.namespace,
+		bytesRead: image.NewByteCounter(),
+	}
+
+	record, err := source.image(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("reading containerd image=%q (target=%q) from address=%q namespace=%q", imageName, record.Target.Digest, p.address, p.namespace)
+
+	target, err := v1.NewHash(record.Target.Digest.String())
+	if err != nil {
+		return nil, image.NewProviderError(image.ErrManifestInvalid, fmt.Sprintf("invalid containerd image=%q target", imageName), err)
+	}
+
+	img, rawManifest, manifest, err := resolveImage(ctx, source, p.options.SelectedPlatform(), v1.Descriptor{
+		MediaType: types.MediaType(record.Target.MediaType),
+		Digest:    target,
+		Size:      record.Target.Size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	origin.AcquisitionCompleted = time.Now()
+	return image.NewImage(img, contentTempDir,
+		image.WithManifestDigest(manifest.Digest.String()),
+		image.WithManifest(rawManifest),
+		image.WithOrigin(origin),
+		image.WithByteCounter(source.bytesRead),
+	), nil
+}
+
+// normalizeImageName converts a user provided image reference into the fully qualified name used by containerd (e.g.
+// "alpine" becomes "docker.io/library/alpine:latest").
+func normalizeImageName(imgStr string) (string, error) {
+	ref, err := name.ParseReference(imgStr, name.WeakValidation)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse image reference=%q: %w", imgStr, err)
+	}
+
+	registry := ref.Context().RegistryStr()
+	if registry == name.DefaultRegistry {
+		// containerd refers to docker hub as "docker.io", not "index.docker.io"
+		registry = "docker.io"
+	}
+	repository := registry + "/" + ref.Context().RepositoryStr()
+
+	switch r := ref.(type) {
+	case name.Digest:
+		return repository + "@" + r.DigestStr(), nil
+	case name.Tag:
+		return repository + ":" + r.TagStr(), nil
+	}
+	return "", fmt.Errorf("unsupported image reference=%q", imgStr)
+}
@@ -0,0 +1,377 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestNormalizeImageName(t *testing.T) {
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			input:    "alpine",
+			expected: "docker.io/library/alpine:latest",
+		},
+		{
+			input:    "docker.io/anchore/syft:v0.1.0",
+			expected: "docker.io/anchore/syft:v0.1.0",
+		},
+		{
+			input:    "index.docker.io/library/alpine:3.12",
+			expected: "docker.io/library/alpine:3.12",
+		},
+		{
+			input:    "registry.example.com:5000/some/image@" + digest,
+			expected: "registry.example.com:5000/some/image@" + digest,
+		},
+		{
+			input:   "Not A Reference",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actual, err := normalizeImageName(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("unexpected name: %q != %q", actual, test.expected)
+			}
+		})
+	}
+}
+
+// fakeDaemon is a containerd daemon with a local content store and an in-memory image store (within one namespace).
+type fakeDaemon struct {
+	t         *testing.T
+	namespace string
+	store     content.Store
+	images    map[string]images.Image
+	// imagesErr is returned for all image store operations (when set)
+	imagesErr error
+	// open is the number of clients that have not been closed
+	open int
+}
+
+func newFakeDaemon(t *testing.T, namespace string) *fakeDaemon {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stereoscope-containerd-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	store, err := local.NewStore(dir)
+	if err != nil {
+		t.Fatalf("could not create content store: %+v", err)
+	}
+	return &fakeDaemon{
+		t:         t,
+		namespace: namespace,
+		store:     store,
+		images:    make(map[string]images.Image),
+	}
+}
+
+// install swaps the containerd client for clients of this daemon (for the duration of the test).
+func (d *fakeDaemon) install(address string) {
+	original := newDaemonClient
+	newDaemonClient = func(actual string) (daemonClient, error) {
+		if actual != address {
+			return nil, fmt.Errorf("unexpected address=%q", actual)
+		}
+		d.open++
+		return &fakeClient{daemon: d}, nil
+	}
+	d.t.Cleanup(func() {
+		newDaemonClient = original
+	})
+}
+
+// writeBlob adds the given blob to the content store, returning the descriptor of the blob.
+func (d *fakeDaemon) writeBlob(mediaType string, blob []byte) ocispec.Descriptor {
+	d.t.Helper()
+	descriptor := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(blob),
+		Size:      int64(len(blob)),
+	}
+	if err := content.WriteBlob(context.Background(), d.store, descriptor.Digest.String(), bytes.NewReader(blob), descriptor); err != nil {
+		d.t.Fatalf("could not write blob: %+v", err)
+	}
+	return descriptor
+}
+
+// writeImage adds the manifest, config, and layer blobs of the given image to the content store, returning the
+// descriptor of the manifest.
+func (d *fakeDaemon) writeImage(img v1.Image) ocispec.Descriptor {
+	d.t.Helper()
+	layers, err := img.Layers()
+	if err != nil {
+		d.t.Fatalf("could not get layers: %+v", err)
+	}
+	for _, layer := range layers {
+		reader, err := layer.Compressed()
+		if err != nil {
+			d.t.Fatalf("could not get layer: %+v", err)
+		}
+		blob, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			d.t.Fatalf("could not read layer: %+v", err)
+		}
+		d.writeBlob(string(ocispec.MediaTypeImageLayerGzip), blob)
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		d.t.Fatalf("could not get config: %+v", err)
+	}
+	d.writeBlob(ocispec.MediaTypeImageConfig, config)
+
+	manifest, err := img.RawManifest()
+	if err != nil {
+		d.t.Fatalf("could not get manifest: %+v", err)
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		d.t.Fatalf("could not get media type: %+v", err)
+	}
+	return d.writeBlob(string(mediaType), manifest)
+}
+
+// fakeClient is a client of the fake daemon.
+type fakeClient struct {
+	daemon *fakeDaemon
+	closed bool
+}
+
+func (c *fakeClient) ImageService() images.Store {
+	return &fakeImageStore{daemon: c.daemon}
+}
+
+func (c *fakeClient) ContentStore() content.Store {
+	return c.daemon.store
+}
+
+func (c *fakeClient) Close() error {
+	if !c.closed {
+		c.closed = true
+		c.daemon.open--
+	}
+	return nil
+}
+
+// fakeImageStore is the in-memory image store of the fake daemon (only get and list are supported).
+type fakeImageStore struct {
+	images.Store
+	daemon *fakeDaemon
+}
+
+func (s *fakeImageStore) checkNamespace(ctx context.Context) error {
+	if s.daemon.imagesErr != nil {
+		return s.daemon.imagesErr
+	}
+	if namespace, _ := namespaces.Namespace(ctx); namespace != s.daemon.namespace {
+		return fmt.Errorf("unexpected namespace=%q", namespace)
+	}
+	return nil
+}
+
+func (s *fakeImageStore) Get(ctx context.Context, name string) (images.Image, error) {
+	if err := s.checkNamespace(ctx); err != nil {
+		return images.Image{}, err
+	}
+	record, ok := s.daemon.images[name]
+	if !ok {
+		return images.Image{}, errdefs.ErrNotFound
+	}
+	return record, nil
+}
+
+func (s *fakeImageStore) List(ctx context.Context, _ ...string) ([]images.Image, error) {
+	if err := s.checkNamespace(ctx); err != nil {
+		return nil, err
+	}
+	var records []images.Image
+	for _, record := range s.daemon.images {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func TestDaemonImageProvider_Provide(t *testing.T) {
+	daemon := newFakeDaemon(t, "k8s.io")
+	daemon.install("/some/containerd.sock")
+
+	amd64, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	arm64, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	// only the blobs for a single platform were pulled
+	daemon.writeImage(amd64)
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+	rawIndex, err := index.RawManifest()
+	if err != nil {
+		t.Fatalf("could not get index: %+v", err)
+	}
+	daemon.images["docker.io/library/alpine:latest"] = images.Image{
+		Name:   "docker.io/library/alpine:latest",
+		Target: daemon.writeBlob(ocispec.MediaTypeImageIndex, rawIndex),
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	provider := NewProviderFromDaemon("alpine:latest", &tmpDirGen, image.ProviderOptions{})
+	provider.SetDaemon("/some/containerd.sock", "k8s.io")
+
+	img, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	expectedDigest, err := amd64.Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+	if img.Metadata.ManifestDigest != expectedDigest.String() {
+		t.Errorf("unexpected manifest digest: %q != %q", img.Metadata.ManifestDigest, expectedDigest.String())
+	}
+	if len(img.Layers) != 2 {
+		t.Errorf("unexpected number of layers: %d", len(img.Layers))
+	}
+	if img.Metadata.Origin.Source != image.ContainerdDaemonSource || img.Metadata.Origin.Location != "/some/containerd.sock" {
+		t.Errorf("unexpected origin: %+v", img.Metadata.Origin)
+	}
+	if img.Metadata.BytesRead.Remote == 0 {
+		t.Errorf("expected the content store reads to be recorded: %+v", img.Metadata.BytesRead)
+	}
+
+	if daemon.open != 0 {
+		t.Errorf("expected all containerd clients to be closed: %d open", daemon.open)
+	}
+}
+
+func TestDaemonImageProvider_Provide_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		imagesErr error
+		connect   error
+		expected  error
+	}{
+		{
+			name:     "unknown image",
+			expected: image.ErrImageNotFound,
+		},
+		{
+			name:     "containerd not running",
+			connect:  fmt.Errorf("failed to dial: connection refused"),
+			expected: image.ErrDaemonUnavailable,
+		},
+		{
+			name:      "containerd unavailable",
+			imagesErr: errdefs.ErrUnavailable,
+			expected:  image.ErrDaemonUnavailable,
+		},
+		{
+			name:      "other failure",
+			imagesErr: errdefs.ErrInvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			daemon := newFakeDaemon(t, DefaultNamespace)
+			daemon.imagesErr = test.imagesErr
+			daemon.install(DefaultAddress)
+			if test.connect != nil {
+				newDaemonClient = func(string) (daemonClient, error) {
+					return nil, test.connect
+				}
+			}
+
+			tmpDirGen := file.NewTempDirGenerator()
+			defer tmpDirGen.Cleanup()
+
+			provider := NewProviderFromDaemon("missing:latest", &tmpDirGen, image.ProviderOptions{})
+			provider.SetDaemon(DefaultAddress, DefaultNamespace)
+
+			_, err := provider.Provide(context.Background())
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			for _, sentinel := range []error{image.ErrDaemonUnavailable, image.ErrImageNotFound} {
+				if errors.Is(err, sentinel) != (sentinel == test.expected) {
+					t.Errorf("unexpected classification of %q (as %q)", err, sentinel)
+				}
+			}
+			cause := test.connect
+			if cause == nil {
+				cause = test.imagesErr
+			}
+			if cause != nil && !errors.Is(err, cause) {
+				t.Errorf("expected the cause to be wrapped: %+v", err)
+			}
+		})
+	}
+}
+
+func TestNewDaemonClient_NoDaemon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-containerd-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	provider := NewProviderFromDaemon("alpine:latest", &tmpDirGen, image.ProviderOptions{})
+	provider.SetDaemon(dir+"/containerd.sock", DefaultNamespace)
+
+	if _, err := provider.Provide(context.Background()); !errors.Is(err, image.ErrDaemonUnavailable) {
+		t.Errorf("expected daemon unavailable error, got %+v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package containerd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/containerd/containerd/images"
+)
+
+// ListDaemonImages lists all images within the containerd content store. The containerd socket address and namespace
+// are taken from the environment (see DefaultAddress and DefaultNamespace).
+func ListDaemonImages(ctx context.Context) ([]image.ListedImage, error) {
+	source := &contentSource{
+		address:   envOrDefault("CONTAINERD_ADDRESS", DefaultAddress),
+		namespace: envOrDefault("CONTAINERD_NAMESPACE", DefaultNamespace),
+	}
+
+	records, err := source.images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listedImages(records), nil
+}
+
+// listedImages describes the given image records, grouping all names that refer to the same manifest (or index). Names
+// are either tags or digest references, where only tags are listed as tags.
+func listedImages(records []images.Image) []image.ListedImage {
+	var listed []image.ListedImage
+	var byDigest = make(map[string]int)
+	for _, record := range records {
+		manifestDigest := record.Target.Digest.String()
+		idx, ok := byDigest[manifestDigest]
+		if !ok {
+			idx = len(listed)
+			byDigest[manifestDigest] = idx
+			listed = append(listed, image.ListedImage{ManifestDigest: manifestDigest})
+		}
+		if !strings.Contains(record.Name, "@") {
+			listed[idx].Tags = append(listed[idx].Tags, record.Name)
+		}
+	}
+	return listed
+}
@@ -0,0 +1,62 @@
+package containerd
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/containerd/containerd/images"
+	"github.com/go-test/deep"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestListedImages(t *testing.T) {
+	first := digest.Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	second := digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	records := []images.Image{
+		{Name: "docker.io/library/alpine:latest", Target: ocispec.Descriptor{Digest: first}},
+		{Name: "registry.example.com/app@" + second.String(), Target: ocispec.Descriptor{Digest: second}},
+		{Name: "docker.io/library/alpine:3.12", Target: ocispec.Descriptor{Digest: first}},
+	}
+
+	expected := []image.ListedImage{
+		{ManifestDigest: first.String(), Tags: []string{"docker.io/library/alpine:latest", "docker.io/library/alpine:3.12"}},
+		{ManifestDigest: second.String()},
+	}
+
+	for _, d := range deep.Equal(listedImages(records), expected) {
+		t.Errorf("unexpected images: %s", d)
+	}
+}
+
+func TestListDaemonImages(t *testing.T) {
+	daemon := newFakeDaemon(t, "k8s.io")
+	daemon.install("/some/containerd.sock")
+	t.Setenv("CONTAINERD_ADDRESS", "/some/containerd.sock")
+	t.Setenv("CONTAINERD_NAMESPACE", "k8s.io")
+
+	for _, name := range []string{"docker.io/library/alpine:latest", "docker.io/library/busybox:latest"} {
+		daemon.images[name] = images.Image{
+			Name:   name,
+			Target: daemon.writeBlob(ocispec.MediaTypeImageManifest, []byte(name)),
+		}
+	}
+
+	listed, err := ListDaemonImages(context.Background())
+	if err != nil {
+		t.Fatalf("could not list images: %+v", err)
+	}
+	var tags []string
+	for _, l := range listed {
+		tags = append(tags, l.Tags...)
+	}
+	sort.Strings(tags)
+	for _, d := range deep.Equal(tags, []string{"docker.io/library/alpine:latest", "docker.io/library/busybox:latest"}) {
+		t.Errorf("unexpected tags: %s", d)
+	}
+	if daemon.open != 0 {
+		t.Errorf("expected all containerd clients to be closed: %d open", daemon.open)
+	}
+}
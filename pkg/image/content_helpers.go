@@ -1,6 +1,7 @@
 package image
 
 import (
+	"archive/tar"
 	"fmt"
 	"io"
 
@@ -9,16 +10,18 @@ import (
 	"github.com/anchore/stereoscope/pkg/file"
 )
 
+// ErrDeadLink is returned when fetching the contents of a path that is (or resolves through) a link whose target
+// does not exist (see filetree.DoNotFollowDeadBasenameLinks to fetch the contents of the last link instead).
+var ErrDeadLink = fmt.Errorf("link target does not exist")
+
 // fetchFileContentsByPath is a common helper function for resolving the file contents for a path from the file
-// catalog relative to the given tree.
-func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path) (io.ReadCloser, error) {
-	exists, fileReference, err := ft.File(path, filetree.FollowBasenameLinks)
+// catalog relative to the given tree. All basename links are followed (chains of links, relative links, and links
+// into ancestor links are resolved), additional link resolution options may be given.
+func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path, options ...filetree.LinkResolutionOption) (io.ReadCloser, error) {
+	fileReference, err := resolveContentReference(ft, fileCatalog, path, options...)
 	if err != nil {
 		return nil, err
 	}
-	if !exists && fileReference == nil {
-		return nil, fmt.Errorf("could not find file path in Tree: %s", path)
-	}
 
 	reader, err := fileCatalog.FileContents(*fileReference)
 	if err != nil {
@@ -30,22 +33,52 @@ func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, pa
 // fetchMultipleFileContentsByPath is a common helper function for resolving the file contents for all paths from the
 // file catalog relative to the given tree. If any one path does not exist in the given tree then an error is returned.
 func fetchMultipleFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, paths ...file.Path) (map[file.Reference]io.ReadCloser, error) {
+	fileReferences, err := resolveContentReferences(ft, fileCatalog, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	readers, err := fileCatalog.MultipleFileContents(fileReferences...)
+	if err != nil {
+		return nil, err
+	}
+	return readers, nil
+}
+
+// resolveContentReferences resolves the references to fetch the contents of all given paths from, relative to the
+// given tree. If any one path does not exist in the given tree then an error is returned.
+func resolveContentReferences(ft *filetree.FileTree, fileCatalog *FileCatalog, paths ...file.Path) ([]file.Reference, error) {
 	fileReferences := make([]file.Reference, len(paths))
 	for idx, p := range paths {
-		exists, fileReference, err := ft.File(p, filetree.FollowBasenameLinks)
+		fileReference, err := resolveContentReference(ft, fileCatalog, p)
 		if err != nil {
 			return nil, err
 		}
-		if !exists && fileReference == nil {
-			return nil, fmt.Errorf("could not find file path in Tree: %s", p)
-		}
-
 		fileReferences[idx] = *fileReference
 	}
+	return fileReferences, nil
+}
 
-	readers, err := fileCatalog.MultipleFileContents(fileReferences...)
+// resolveContentReference resolves the reference to fetch the contents of the given path from, relative to the given
+// tree (following all basename links). A hardlink whose target is not within the tree (e.g. a file in a lower layer
+// relative to a layer diff tree) resolves to the hardlink itself, which the file catalog resolves upon read.
+func resolveContentReference(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	allOptions := append([]filetree.LinkResolutionOption{filetree.FollowBasenameLinks}, options...)
+	exists, fileReference, err := ft.File(path, allOptions...)
 	if err != nil {
 		return nil, err
 	}
-	return readers, nil
+	if exists || fileReference != nil {
+		return fileReference, nil
+	}
+
+	// distinguish paths that do not exist from dead links, since the path itself is within the tree
+	_, linkReference, err := ft.File(path, filetree.FollowBasenameLinks, filetree.DoNotFollowDeadBasenameLinks)
+	if err != nil || linkReference == nil {
+		return nil, fmt.Errorf("could not find file path in Tree: %s", path)
+	}
+	if entry, err := fileCatalog.Get(*linkReference); err == nil && entry.Metadata.TypeFlag == tar.TypeLink {
+		return linkReference, nil
+	}
+	return nil, fmt.Errorf("%w: path=%q (last link=%q)", ErrDeadLink, path, linkReference.RealPath)
 }
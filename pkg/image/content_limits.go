@@ -0,0 +1,117 @@
+package image
+
+import (
+	"context"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ContentLimits caps the bytes of file contents provided for a single request, protecting callers from very large
+// files within an image (e.g. multi-GB archives or databases). Contents beyond the limits are never read into memory
+// nor cached on disk.
+type ContentLimits struct {
+	// MaxFileBytes caps the bytes provided for each file (no limit when zero).
+	MaxFileBytes int64
+	// MaxTotalBytes caps the bytes provided for all files of the request together, allotted to files in the order the
+	// files are requested (no limit when zero).
+	MaxTotalBytes int64
+}
+
+// LimitedFileContents is the (possibly truncated) contents of a single file (see ContentLimits).
+type LimitedFileContents struct {
+	io.ReadCloser
+	// Size is the size of the complete file contents.
+	Size int64
+	// Truncated indicates that only the leading bytes of the contents are provided, since the contents exceed the
+	// limits.
+	Truncated bool
+}
+
+// limitReadCloser provides the first limit bytes of the given reader (closing the given reader upon close).
+func limitReadCloser(reader io.ReadCloser, limit int64) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, limit), reader}
+}
+
+// MultipleFileContentsWithLimits is the same as MultipleFileContentsWithContext, however, the contents of each file are
+// cut short according to the given limits (see LimitedFileContents.Truncated). Each file is allotted the bytes left
+// within the total limit at the time the file is considered, so the limits are decided up front (from the file sizes),
+// regardless of how much of each file is actually read by the caller.
+func (c *FileCatalog) MultipleFileContentsWithLimits(ctx context.Context, limits ContentLimits, files ...file.Reference) (map[file.Reference]LimitedFileContents, error) {
+	sizes := make(map[file.Reference]int64)
+	truncated := make(map[file.ID]int64)
+
+	var total int64
+	for _, f := range files {
+		if _, ok := sizes[f]; ok {
+			continue
+		}
+		size, err := c.contentSize(f)
+		if err != nil {
+			return nil, err
+		}
+		sizes[f] = size
+
+		allowed := size
+		if limits.MaxFileBytes > 0 && allowed > limits.MaxFileBytes {
+			allowed = limits.MaxFileBytes
+		}
+		if limits.MaxTotalBytes > 0 && allowed > limits.MaxTotalBytes-total {
+			allowed = limits.MaxTotalBytes - total
+		}
+		total += allowed
+
+		if allowed < size {
+			truncated[f.ID()] = allowed
+		}
+	}
+
+	readers, err := c.multipleFileContents(ctx, truncated, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[file.Reference]LimitedFileContents)
+	for f, reader := range readers {
+		_, isTruncated := truncated[f.ID()]
+		results[f] = LimitedFileContents{
+			ReadCloser: reader,
+			Size:       sizes[f],
+			Truncated:  isTruncated,
+		}
+	}
+	return results, nil
+}
+
+// contentSize is the size of the contents of the given file (the size of the target file for hardlinks).
+func (c *FileCatalog) contentSize(f file.Reference) (int64, error) {
+	entry, err := c.Get(f)
+	if err != nil {
+		return 0, err
+	}
+	resolved, err := c.resolveHardlink(&entry)
+	if err != nil {
+		return 0, err
+	}
+	return resolved.Metadata.Size, nil
+}
+
+// openTruncated streams the first limit bytes of the contents of the given file directly from the layer tar.
+func (c *FileCatalog) openTruncated(ctx context.Context, f file.Reference, limit int64) (io.ReadCloser, error) {
+	entry, err := c.Get(f)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := c.resolveHardlink(&entry)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := c.openTarEntry(ctx, *resolved)
+	if err != nil {
+		return nil, err
+	}
+	return limitReadCloser(reader, limit), nil
+}
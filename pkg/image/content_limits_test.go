@@ -0,0 +1,106 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_MultipleFileContentsFromSquashWithLimits(t *testing.T) {
+	img := linkedImage(t)
+
+	tests := []struct {
+		name     string
+		limits   ContentLimits
+		paths    []file.Path
+		expected map[file.Path]string
+	}{
+		{
+			name:  "no limits",
+			paths: []file.Path{"/opt/app/config.txt", "/usr/local.txt"},
+			expected: map[file.Path]string{
+				"/opt/app/config.txt": "opt/app/config.txt",
+				"/usr/local.txt":      "usr/local.txt",
+			},
+		},
+		{
+			name:   "per file limit",
+			limits: ContentLimits{MaxFileBytes: 10},
+			paths:  []file.Path{"/opt/app/config.txt", "/usr/local.txt"},
+			expected: map[file.Path]string{
+				"/opt/app/config.txt": "opt/app/co",
+				"/usr/local.txt":      "usr/local.",
+			},
+		},
+		{
+			name:   "total limit allotted in request order",
+			limits: ContentLimits{MaxTotalBytes: 20},
+			paths:  []file.Path{"/opt/app/config.txt", "/usr/local.txt"},
+			expected: map[file.Path]string{
+				"/opt/app/config.txt": "opt/app/config.txt",
+				"/usr/local.txt":      "us",
+			},
+		},
+		{
+			name:   "hardlink limited by target size",
+			limits: ContentLimits{MaxFileBytes: 3},
+			paths:  []file.Path{"/usr/hard.txt"},
+			expected: map[file.Path]string{
+				// note: the hardlink resolves to the target within the squashed tree
+				"/opt/app/config.txt": "opt",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := img.MultipleFileContentsFromSquashWithLimits(test.limits, test.paths...)
+			if err != nil {
+				t.Fatalf("could not fetch contents: %+v", err)
+			}
+			if len(results) != len(test.expected) {
+				t.Fatalf("unexpected number of results: %d", len(results))
+			}
+			for ref, contents := range results {
+				expected, ok := test.expected[ref.RealPath]
+				if !ok {
+					t.Fatalf("unexpected result for %q", ref.RealPath)
+				}
+				if contents.Size != int64(len(ref.RealPath)-1) {
+					t.Errorf("unexpected size for %q: %d", ref.RealPath, contents.Size)
+				}
+				if contents.Truncated != (int64(len(expected)) < contents.Size) {
+					t.Errorf("unexpected truncation for %q: %t (size=%d)", ref.RealPath, contents.Truncated, contents.Size)
+				}
+				assertContents(t, contents.ReadCloser, expected)
+			}
+		})
+	}
+}
+
+func TestImage_MultipleFileContentsFromSquashWithLimits_LargeFiles(t *testing.T) {
+	// treat all files as large files (which would otherwise be cached on disk)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	img := linkedImage(t)
+
+	results, err := img.MultipleFileContentsFromSquashWithLimits(ContentLimits{MaxFileBytes: 5}, "/usr/local.txt")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	for _, contents := range results {
+		if !contents.Truncated || contents.Size != int64(len("usr/local.txt")) {
+			t.Errorf("unexpected limited contents: %+v", contents)
+		}
+		assertContents(t, contents.ReadCloser, "usr/l")
+	}
+
+	// truncated contents must not be served for later requests of the complete contents
+	reader, err := img.FileContentsFromSquash("/usr/local.txt")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	assertContents(t, reader, "usr/local.txt")
+}
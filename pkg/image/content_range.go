@@ -0,0 +1,28 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// FileContentsRange provides (at most) length bytes of the contents of the given file reference, starting at the
+// given offset (e.g. to parse a single table of a large database dump). Only the requested range is read from the
+// contents cache dir when cached, otherwise the contents are read as with OpenSeekableByID. An offset at or beyond the
+// end of the contents provides no contents.
+func (c *FileCatalog) FileContentsRange(f file.Reference, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range for path=%q: offset=%d length=%d", f.RealPath, offset, length)
+	}
+
+	contents, err := c.OpenSeekableByID(f.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	return &extentReadCloser{
+		Reader: io.NewSectionReader(contents, offset, length),
+		Closer: contents,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestFileCatalog_FileContentsRange(t *testing.T) {
+	// treat all files as large files (so contents are read from the contents cache dir)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	img := newTestImage(t, []v1.Layer{newTestLayer(t, map[string]string{"dump.sql": "0123456789"})})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	_, ref, err := squashedTreeOf(t, img).File("/dump.sql")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find file: %+v", err)
+	}
+
+	tests := []struct {
+		name     string
+		offset   int64
+		length   int64
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "within contents",
+			offset:   2,
+			length:   3,
+			expected: "234",
+		},
+		{
+			name:     "beyond the end",
+			offset:   8,
+			length:   10,
+			expected: "89",
+		},
+		{
+			name:   "offset beyond the end",
+			offset: 20,
+			length: 1,
+		},
+		{
+			name:    "negative offset",
+			offset:  -1,
+			length:  1,
+			wantErr: true,
+		},
+		{
+			name:    "negative length",
+			offset:  1,
+			length:  -1,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := img.FileCatalog.FileContentsRange(*ref, test.offset, test.length)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not open range: %+v", err)
+			}
+			defer reader.Close()
+
+			contents, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("could not read range: %+v", err)
+			}
+			if string(contents) != test.expected {
+				t.Errorf("unexpected contents: %q != %q", string(contents), test.expected)
+			}
+		})
+	}
+
+	if _, err := img.FileCatalog.FileContentsRange(*file.NewFileReference("/missing"), 0, 1); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
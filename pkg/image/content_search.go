@@ -0,0 +1,129 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ContentMatch is a single occurrence of a keyword within the contents of a file (see WithContentSearch).
+type ContentMatch struct {
+	// File is the reference of the file within the layer tree (and the file catalog).
+	File file.Reference
+	// Layer is the layer the file was read from.
+	Layer *Layer
+	// Keyword is the keyword found within the contents.
+	Keyword string
+	// Offset is the byte offset of the keyword within the file contents.
+	Offset int64
+}
+
+// ContentMatchHandler is called for each keyword found while the layer tars are read. Returning an error stops reading
+// the image. Note: the handler may be called concurrently when layers are read concurrently (see WithLayerConcurrency).
+type ContentMatchHandler func(match ContentMatch) error
+
+// contentSearch is the set of keywords to search file contents for, along with the handler for all matches.
+type contentSearch struct {
+	keywords [][]byte
+	handler  ContentMatchHandler
+	// overlap is the number of trailing bytes of each chunk that must be searched again along with the next chunk (so
+	// keywords split across chunks are found).
+	overlap int
+}
+
+// WithContentSearch searches the contents of each regular file for the given keywords while the layer tars are read,
+// calling the given handler for every occurrence (e.g. to find secrets or markers in a single pass, without reading
+// every file again afterwards). Since each layer is searched, files that are overwritten or deleted in later layers are
+// searched as well (see Image.SquashedTree for which files are visible). Note: layers found within a layer tar cache
+// are read again in order to be searched (see WithLayerTarCache).
+func WithContentSearch(handler ContentMatchHandler, keywords ...string) ReadOption {
+	return func(image *Image) error {
+		if handler == nil {
+			return fmt.Errorf("no content match handler given")
+		}
+		search := &contentSearch{
+			handler: handler,
+		}
+		for _, keyword := range keywords {
+			if keyword == "" {
+				return fmt.Errorf("empty content search keyword")
+			}
+			search.keywords = append(search.keywords, []byte(keyword))
+			if len(keyword)-1 > search.overlap {
+				search.overlap = len(keyword) - 1
+			}
+		}
+		if len(search.keywords) == 0 {
+			return fmt.Errorf("no content search keywords given")
+		}
+		image.contentSearch = search
+		return nil
+	}
+}
+
+// newSearcher returns a writer that searches everything written to it.
+func (s *contentSearch) newSearcher() *contentSearcher {
+	return &contentSearcher{
+		search: s,
+	}
+}
+
+// contentSearcher searches the contents of a single file as written, recording all matches (the file reference is
+// only known once the file is added to the layer tree, see report).
+type contentSearcher struct {
+	search *contentSearch
+	// tail is the end of the previously written contents, which is searched again along with the next write
+	tail []byte
+	// written is the number of bytes written so far
+	written int64
+	matches []ContentMatch
+}
+
+func (s *contentSearcher) Write(p []byte) (int, error) {
+	buf := append(s.tail, p...)
+	// the byte offset of the buffer within the contents
+	base := s.written - int64(len(s.tail))
+
+	for _, keyword := range s.search.keywords {
+		start := 0
+		for {
+			pos := bytes.Index(buf[start:], keyword)
+			if pos < 0 {
+				break
+			}
+			pos += start
+			// matches entirely within the tail were found with the previous write
+			if pos+len(keyword) > len(s.tail) {
+				s.matches = append(s.matches, ContentMatch{
+					Keyword: string(keyword),
+					Offset:  base + int64(pos),
+				})
+			}
+			start = pos + 1
+		}
+	}
+
+	s.written += int64(len(p))
+	if len(buf) > s.search.overlap {
+		buf = buf[len(buf)-s.search.overlap:]
+	}
+	s.tail = append(s.tail[:0:0], buf...)
+	return len(p), nil
+}
+
+// report calls the handler for all matches found within the given file (in order of offset within the contents).
+func (s *contentSearcher) report(ref file.Reference, layer *Layer) error {
+	sort.SliceStable(s.matches, func(i, j int) bool {
+		return s.matches[i].Offset < s.matches[j].Offset
+	})
+	for _, match := range s.matches {
+		match.File = ref
+		match.Layer = layer
+		if err := s.search.handler(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
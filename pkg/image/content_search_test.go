@@ -0,0 +1,157 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestContentSearcher_Write(t *testing.T) {
+	search := &contentSearch{
+		keywords: [][]byte{[]byte("SECRET"), []byte("aa")},
+		overlap:  5,
+	}
+
+	tests := []struct {
+		name     string
+		chunks   []string
+		expected []string
+	}{
+		{
+			name:     "single write",
+			chunks:   []string{"a SECRET and another SECRET"},
+			expected: []string{"SECRET@2", "SECRET@21"},
+		},
+		{
+			name:     "keyword split across writes",
+			chunks:   []string{"xxSEC", "RETyy", "SE", "C", "RET"},
+			expected: []string{"SECRET@2", "SECRET@10"},
+		},
+		{
+			name:     "overlapping occurrences",
+			chunks:   []string{"aa", "a", "a"},
+			expected: []string{"aa@0", "aa@1", "aa@2"},
+		},
+		{
+			name:   "no match",
+			chunks: []string{"SECRE", "secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			searcher := search.newSearcher()
+			for _, chunk := range test.chunks {
+				if _, err := searcher.Write([]byte(chunk)); err != nil {
+					t.Fatalf("could not write: %+v", err)
+				}
+			}
+
+			var actual []string
+			search.handler = func(match ContentMatch) error {
+				actual = append(actual, fmt.Sprintf("%s@%d", match.Keyword, match.Offset))
+				return nil
+			}
+			if err := searcher.report(*file.NewFileReference("/etc/config"), nil); err != nil {
+				t.Fatalf("could not report: %+v", err)
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(test.expected) {
+				t.Errorf("unexpected matches: %+v != %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func contentSearchImage(t *testing.T, options ...ReadOption) (*Image, error) {
+	t.Helper()
+	base := newTestLayer(t, map[string]string{
+		"etc/config":  "password=hunter2\n",
+		"etc/removed": "token: abc\npassword=xyz\n",
+		"usr/readme":  "nothing to see here\n",
+	})
+	top := newTestLayer(t, map[string]string{
+		"etc/.wh.removed": "",
+		"app/main.sh":     "#!/bin/sh\nexport TOKEN=abc # token:\n",
+	})
+
+	img := newTestImage(t, []v1.Layer{base, top})
+	return img, img.Read(options...)
+}
+
+func TestImage_WithContentSearch(t *testing.T) {
+	var lock sync.Mutex
+	var actual []string
+	handler := func(match ContentMatch) error {
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, fmt.Sprintf("%d:%s:%s@%d", match.Layer.Metadata.Index, match.File.RealPath, match.Keyword, match.Offset))
+		return nil
+	}
+
+	img, err := contentSearchImage(t, WithContentSearch(handler, "password=", "token:"), WithFileDigests())
+	if err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	// note: files are searched in tar order within each layer
+	expected := []string{
+		"0:/etc/config:password=@0",
+		"0:/etc/removed:token:@0",
+		"0:/etc/removed:password=@11",
+		"1:/app/main.sh:token:@29",
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("unexpected matches: %+v != %+v", actual, expected)
+	}
+
+	// the searched contents are still digested and readable
+	reader, err := img.FileContentsFromSquash("/etc/config")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	assertContents(t, reader, "password=hunter2\n")
+}
+
+func TestImage_WithContentSearch_HandlerError(t *testing.T) {
+	stop := errors.New("stop")
+	_, err := contentSearchImage(t, WithContentSearch(func(ContentMatch) error {
+		return stop
+	}, "password="))
+	if !errors.Is(err, stop) {
+		t.Errorf("expected handler error, got %+v", err)
+	}
+}
+
+func TestWithContentSearch_InvalidOptions(t *testing.T) {
+	handler := func(ContentMatch) error { return nil }
+
+	tests := []struct {
+		name   string
+		option ReadOption
+	}{
+		{
+			name:   "no handler",
+			option: WithContentSearch(nil, "password="),
+		},
+		{
+			name:   "no keywords",
+			option: WithContentSearch(handler),
+		},
+		{
+			name:   "empty keyword",
+			option: WithContentSearch(handler, "password=", ""),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.option(&Image{}); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
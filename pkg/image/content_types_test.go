@@ -0,0 +1,161 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// testELFContents is a (truncated) little endian 64-bit ELF executable.
+var testELFContents = "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00\x01\x00\x00\x00" + string(make([]byte, 40))
+
+// testSharedLibContents is a (truncated) little endian 64-bit ELF shared object.
+var testSharedLibContents = "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x3e\x00\x01\x00\x00\x00" + string(make([]byte, 40))
+
+// contentTypesImage returns an image with executables, libraries, scripts, and text files (where some are replaced or
+// deleted in the top layer).
+func contentTypesImage(t *testing.T, options ...ReadOption) *Image {
+	t.Helper()
+	base := newTestLayer(t, map[string]string{
+		"bin/app":      testELFContents,
+		"bin/replaced": testELFContents,
+		"bin/removed":  testELFContents,
+		"lib/libc.so":  testSharedLibContents,
+		"etc/motd":     "welcome!\n",
+	})
+	top := newTestLayer(t, map[string]string{
+		"bin/replaced":    "#!/bin/sh\necho replaced\n",
+		"bin/.wh.removed": "",
+	})
+
+	img := newTestImage(t, []v1.Layer{base, top})
+	if err := img.Read(options...); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func refPaths(refs []file.Reference) []file.Path {
+	var paths []file.Path
+	for _, ref := range refs {
+		paths = append(paths, ref.RealPath)
+	}
+	return paths
+}
+
+func TestImage_FilesByMIMEType(t *testing.T) {
+	img := contentTypesImage(t, WithContentTypes())
+
+	tests := []struct {
+		name      string
+		mimeTypes []string
+		expected  []file.Path
+	}{
+		{
+			name:      "executables visible within the squash tree",
+			mimeTypes: []string{"application/x-executable"},
+			expected:  []file.Path{"/bin/app"},
+		},
+		{
+			name:      "multiple MIME types",
+			mimeTypes: []string{"application/x-sharedlib", "application/x-executable"},
+			expected:  []file.Path{"/bin/app", "/lib/libc.so"},
+		},
+		{
+			name:      "replacement in a later layer",
+			mimeTypes: []string{"text/x-shellscript"},
+			expected:  []file.Path{"/bin/replaced"},
+		},
+		{
+			name:      "unknown MIME type",
+			mimeTypes: []string{"image/png"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			refs, err := img.FilesByMIMEType(test.mimeTypes...)
+			if err != nil {
+				t.Fatalf("could not find files: %+v", err)
+			}
+			if actual := refPaths(refs); fmt.Sprint(actual) != fmt.Sprint(test.expected) {
+				t.Errorf("unexpected files: %+v != %+v", actual, test.expected)
+			}
+		})
+	}
+
+	// the catalog holds the files of all layers (including files that are not visible within the squash tree)
+	all := refPaths(img.FileCatalog.FilesByMIMEType("application/x-executable"))
+	expected := []file.Path{"/bin/app", "/bin/removed", "/bin/replaced"}
+	if fmt.Sprint(all) != fmt.Sprint(expected) {
+		t.Errorf("unexpected cataloged files: %+v != %+v", all, expected)
+	}
+}
+
+func TestImage_WithContentTypes_Metadata(t *testing.T) {
+	img := contentTypesImage(t, WithContentTypes(), WithFileDigests())
+
+	tests := []struct {
+		path     file.Path
+		contents string
+		expected file.ContentType
+	}{
+		{
+			path:     "/bin/app",
+			contents: testELFContents,
+			expected: file.ContentType{MIMEType: "application/x-executable", IsBinary: true, IsELF: true},
+		},
+		{
+			path:     "/etc/motd",
+			contents: "welcome!\n",
+			expected: file.ContentType{MIMEType: "text/plain"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			metadata, err := img.FileMetadataFromSquash(test.path)
+			if err != nil {
+				t.Fatalf("could not get metadata: %+v", err)
+			}
+			if metadata.ContentType != test.expected {
+				t.Errorf("unexpected content type: %+v != %+v", metadata.ContentType, test.expected)
+			}
+
+			// the sniffed bytes are still digested
+			expectedDigest := fmt.Sprintf("%x", sha256.Sum256([]byte(test.contents)))
+			if len(metadata.Digests) == 0 || metadata.Digests[0].Value != expectedDigest {
+				t.Errorf("unexpected digests: %+v", metadata.Digests)
+			}
+
+			reader, err := img.FileContentsFromSquash(test.path)
+			if err != nil {
+				t.Fatalf("could not fetch contents: %+v", err)
+			}
+			assertContents(t, reader, test.contents)
+		})
+	}
+}
+
+func TestImage_WithoutContentTypes(t *testing.T) {
+	img := contentTypesImage(t)
+
+	metadata, err := img.FileMetadataFromSquash("/bin/app")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.ContentType != (file.ContentType{}) {
+		t.Errorf("unexpected content type: %+v", metadata.ContentType)
+	}
+
+	refs, err := img.FilesByMIMEType("application/x-executable")
+	if err != nil {
+		t.Fatalf("could not find files: %+v", err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("unexpected files: %+v", refs)
+	}
+}
@@ -0,0 +1,140 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/image"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// DefaultEndpoint is the default CRI socket (overridden by the CONTAINER_RUNTIME_ENDPOINT environment variable, as for
+// crictl).
+const DefaultEndpoint = "unix:///run/containerd/containerd.sock"
+
+// maxMsgSize is the largest CRI response accepted (as for the kubelet, image listings can exceed the gRPC default).
+const maxMsgSize = 16 * 1024 * 1024
+
+// runtime names reported by the CRI runtime service
+const (
+	containerdRuntime = "containerd"
+	crioRuntime       = "cri-o"
+)
+
+// criImage is a single image as reported by the CRI image service.
+type criImage struct {
+	ID          string
+	RepoTags    []string
+	RepoDigests []string
+}
+
+func newCRIImage(img *runtimeapi.Image) criImage {
+	return criImage{
+		ID:          img.Id,
+		RepoTags:    img.RepoTags,
+		RepoDigests: img.RepoDigests,
+	}
+}
+
+// client queries the CRI image and runtime services at a single endpoint (over gRPC).
+type client struct {
+	endpoint string
+	conn     *grpc.ClientConn
+	images   runtimeapi.ImageServiceClient
+	runtime  runtimeapi.RuntimeServiceClient
+}
+
+// newClient connects to the CRI endpoint taken from the environment (see DefaultEndpoint). Connecting does not wait
+// for the endpoint, an unreachable endpoint is reported by the first query instead.
+func newClient(ctx context.Context) (*client, error) {
+	endpoint := os.Getenv("CONTAINER_RUNTIME_ENDPOINT")
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	c := &client{endpoint: endpoint}
+
+	log.Debugf("connecting to CRI (endpoint=%q)", endpoint)
+
+	conn, err := grpc.DialContext(ctx, c.socketPath(),
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", address)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)),
+	)
+	if err != nil {
+		return nil, image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to connect to CRI (endpoint=%q)", endpoint), err)
+	}
+	c.conn = conn
+	c.images = runtimeapi.NewImageServiceClient(conn)
+	c.runtime = runtimeapi.NewRuntimeServiceClient(conn)
+	return c, nil
+}
+
+// Close closes the connection to the CRI endpoint.
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// criError describes the given CRI failure, classifying an unreachable CRI endpoint (see image.ErrDaemonUnavailable)
+// and an unknown image (see image.ErrImageNotFound) by the gRPC status code.
+func criError(err error, description string) error {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return image.NewProviderError(image.ErrDaemonUnavailable, description, err)
+	case codes.NotFound:
+		return image.NewProviderError(image.ErrImageNotFound, description, err)
+	}
+	return fmt.Errorf("%s: %w", description, err)
+}
+
+// listImages lists all images known to the CRI image service.
+func (c *client) listImages(ctx context.Context) ([]criImage, error) {
+	response, err := c.images.ListImages(ctx, &runtimeapi.ListImagesRequest{})
+	if err != nil {
+		return nil, criError(err, fmt.Sprintf("unable to list CRI images (endpoint=%q)", c.endpoint))
+	}
+
+	var images []criImage
+	for _, img := range response.Images {
+		images = append(images, newCRIImage(img))
+	}
+	return images, nil
+}
+
+// inspectImage resolves the given image reference (or ID) with the CRI image service.
+func (c *client) inspectImage(ctx context.Context, imgStr string) (*criImage, error) {
+	response, err := c.images.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{
+		Image: &runtimeapi.ImageSpec{Image: imgStr},
+	})
+	if err != nil {
+		return nil, criError(err, fmt.Sprintf("unable to get status of CRI image=%q (endpoint=%q)", imgStr, c.endpoint))
+	}
+	// note: the image service reports an unknown image as a successful response without an image
+	if response.Image == nil || response.Image.Id == "" {
+		return nil, fmt.Errorf("%w: image=%q not found within CRI (endpoint=%q)", image.ErrImageNotFound, imgStr, c.endpoint)
+	}
+	img := newCRIImage(response.Image)
+	return &img, nil
+}
+
+// runtimeName returns the name of the container runtime behind the endpoint (e.g. "containerd" or "cri-o").
+func (c *client) runtimeName(ctx context.Context) (string, error) {
+	response, err := c.runtime.Version(ctx, &runtimeapi.VersionRequest{})
+	if err != nil {
+		return "", criError(err, fmt.Sprintf("unable to get CRI runtime version (endpoint=%q)", c.endpoint))
+	}
+	return response.RuntimeName, nil
+}
+
+// socketPath returns the path of a unix socket endpoint (as used by the runtime's own tools).
+func (c *client) socketPath() string {
+	return strings.TrimPrefix(c.endpoint, "unix://")
+}
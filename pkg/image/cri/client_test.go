@@ -0,0 +1,85 @@
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// fakeCRI is a CRI endpoint serving the image and runtime services (only the image status, image listing, and version
+// queries are supported).
+type fakeCRI struct {
+	runtimeapi.ImageServiceServer
+	runtimeapi.RuntimeServiceServer
+	runtimeName string
+	images      []*runtimeapi.Image
+	// err is returned for all queries (when set)
+	err error
+	// requests are the images requested by image status queries
+	requests []string
+}
+
+// useFakeCRI serves the given fake CRI on a temporary unix socket, pointing CONTAINER_RUNTIME_ENDPOINT to it (for the
+// duration of the test).
+func useFakeCRI(t *testing.T, fake *fakeCRI) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stereoscope-cri-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("could not listen on socket: %+v", err)
+	}
+
+	server := grpc.NewServer()
+	runtimeapi.RegisterImageServiceServer(server, fake)
+	runtimeapi.RegisterRuntimeServiceServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	endpoint := "unix://" + socket
+	t.Setenv("CONTAINER_RUNTIME_ENDPOINT", endpoint)
+	return endpoint
+}
+
+func (f *fakeCRI) ImageStatus(_ context.Context, request *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	f.requests = append(f.requests, request.Image.Image)
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, img := range f.images {
+		if img.Id == request.Image.Image {
+			return &runtimeapi.ImageStatusResponse{Image: img}, nil
+		}
+		for _, tag := range img.RepoTags {
+			if tag == request.Image.Image {
+				return &runtimeapi.ImageStatusResponse{Image: img}, nil
+			}
+		}
+	}
+	return &runtimeapi.ImageStatusResponse{}, nil
+}
+
+func (f *fakeCRI) ListImages(context.Context, *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &runtimeapi.ListImagesResponse{Images: f.images}, nil
+}
+
+func (f *fakeCRI) Version(context.Context, *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &runtimeapi.VersionResponse{RuntimeName: f.runtimeName}, nil
+}
@@ -0,0 +1,90 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/containerd"
+	"github.com/anchore/stereoscope/pkg/image/storage"
+)
+
+// containerdNamespace is the containerd namespace that the containerd CRI plugin stores images within.
+const containerdNamespace = "k8s.io"
+
+// ImageProvider is an image.Provider for an image known to the container runtime of a Kubernetes node (as used by
+// DaemonSet-style scanners). The image is resolved with the CRI image service, however since CRI does not provide image
+// content, the content is read from the store of the runtime behind the CRI socket (containerd or CRI-O).
+type ImageProvider struct {
+	imageStr  string
+	options   image.ProviderOptions
+	tmpDirGen *file.TempDirGenerator
+}
+
+// NewProviderFromCRI creates a new provider instance for a specific image (by reference or image ID) known to the CRI
+// image service (over gRPC). The CRI socket is taken from the environment (see DefaultEndpoint).
+func NewProviderFromCRI(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *ImageProvider {
+	return &ImageProvider{
+		imageStr:  imgStr,
+		options:   options,
+		tmpDirGen: tmpDirGen,
+	}
+}
+
+// Provide an image object that represents the image known to the CRI image service. For containerd the image is
+// exported from the "k8s.io" namespace (see containerd.DaemonImageProvider), for CRI-O the image is read from the
+// containers/storage store (see storage.ImageProvider).
+func (p *ImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	c, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	origin := image.Origin{
+		Source:             image.CRISource,
+		Location:           c.endpoint,
+		AcquisitionStarted: time.Now(),
+	}
+
+	resolved, err := c.inspectImage(ctx, p.imageStr)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimeName, err := c.runtimeName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch runtimeName {
+	case containerdRuntime:
+		imageName, err := resolved.name()
+		if err != nil {
+			return nil, err
+		}
+		provider := containerd.NewProviderFromDaemon(imageName, p.tmpDirGen, p.options)
+		provider.SetDaemon(c.socketPath(), containerdNamespace)
+		provider.SetOrigin(origin)
+		return provider.Provide(ctx)
+	case crioRuntime:
+		provider := storage.NewProviderFromStore(strings.TrimPrefix(resolved.ID, "sha256:"), p.tmpDirGen)
+		provider.SetOrigin(origin)
+		return provider.Provide(ctx)
+	}
+	return nil, fmt.Errorf("unsupported CRI runtime=%q (endpoint=%q)", runtimeName, c.endpoint)
+}
+
+// name returns a reference to the image that the runtime can resolve (a tag, otherwise a digest reference).
+func (i criImage) name() (string, error) {
+	if len(i.RepoTags) > 0 {
+		return i.RepoTags[0], nil
+	}
+	if len(i.RepoDigests) > 0 {
+		return i.RepoDigests[0], nil
+	}
+	return "", fmt.Errorf("CRI image=%q has no tags or digests to export it by", i.ID)
+}
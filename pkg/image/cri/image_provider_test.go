@@ -0,0 +1,132 @@
+package cri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestImageProvider_Provide_UnsupportedRuntime(t *testing.T) {
+	fake := &fakeCRI{
+		runtimeName: "other",
+		images: []*runtimeapi.Image{
+			{Id: "sha256:aaa", RepoTags: []string{"docker.io/library/alpine:3.12"}},
+		},
+	}
+	useFakeCRI(t, fake)
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	_, err := NewProviderFromCRI("docker.io/library/alpine:3.12", &tmpDirGen, image.ProviderOptions{}).Provide(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `unsupported CRI runtime="other"`) {
+		t.Errorf("unexpected error: %+v", err)
+	}
+	for _, d := range deep.Equal(fake.requests, []string{"docker.io/library/alpine:3.12"}) {
+		t.Errorf("diff: %+v", d)
+	}
+}
+
+func TestImageProvider_Provide_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "unknown image",
+			expected: image.ErrImageNotFound,
+		},
+		{
+			name:     "not found status",
+			err:      status.Error(codes.NotFound, "no such image"),
+			expected: image.ErrImageNotFound,
+		},
+		{
+			name:     "unavailable status",
+			err:      status.Error(codes.Unavailable, "shutting down"),
+			expected: image.ErrDaemonUnavailable,
+		},
+		{
+			name: "other failure",
+			err:  status.Error(codes.Internal, "something broke"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeCRI(t, &fakeCRI{runtimeName: containerdRuntime, err: test.err})
+
+			tmpDirGen := file.NewTempDirGenerator()
+			defer tmpDirGen.Cleanup()
+
+			_, err := NewProviderFromCRI("alpine:3.12", &tmpDirGen, image.ProviderOptions{}).Provide(context.Background())
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			for _, sentinel := range []error{image.ErrDaemonUnavailable, image.ErrImageNotFound} {
+				if errors.Is(err, sentinel) != (sentinel == test.expected) {
+					t.Errorf("unexpected classification of %q (as %q)", err, sentinel)
+				}
+			}
+		})
+	}
+}
+
+func TestImageProvider_Provide_NoEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-cri-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	t.Setenv("CONTAINER_RUNTIME_ENDPOINT", "unix://"+filepath.Join(dir, "cri.sock"))
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	_, err = NewProviderFromCRI("alpine:3.12", &tmpDirGen, image.ProviderOptions{}).Provide(context.Background())
+	if !errors.Is(err, image.ErrDaemonUnavailable) {
+		t.Errorf("expected daemon unavailable error, got %+v", err)
+	}
+}
+
+func TestCRIImage_Name(t *testing.T) {
+	tests := []struct {
+		image    criImage
+		expected string
+		wantErr  bool
+	}{
+		{
+			image:    criImage{ID: "sha256:aaa", RepoTags: []string{"alpine:3.12"}, RepoDigests: []string{"alpine@sha256:bbb"}},
+			expected: "alpine:3.12",
+		},
+		{
+			image:    criImage{ID: "sha256:aaa", RepoDigests: []string{"alpine@sha256:bbb"}},
+			expected: "alpine@sha256:bbb",
+		},
+		{
+			image:   criImage{ID: "sha256:aaa"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		actual, err := test.image.name()
+		if (err != nil) != test.wantErr {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if actual != test.expected {
+			t.Errorf("unexpected name: %q != %q", actual, test.expected)
+		}
+	}
+}
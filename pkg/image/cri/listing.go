@@ -0,0 +1,44 @@
+package cri
+
+import (
+	"context"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// ListImages lists all images known to the CRI image service of the node. The CRI socket is taken from the
+// environment (see DefaultEndpoint).
+func ListImages(ctx context.Context) ([]image.ListedImage, error) {
+	c, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	images, err := c.listImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed []image.ListedImage
+	for _, img := range images {
+		listed = append(listed, img.listed())
+	}
+	return listed, nil
+}
+
+// listed describes the image as a listed image (the manifest digest is taken from the first repo digest).
+func (i criImage) listed() image.ListedImage {
+	listed := image.ListedImage{
+		ID:   i.ID,
+		Tags: i.RepoTags,
+	}
+	for _, repoDigest := range i.RepoDigests {
+		if fields := strings.SplitN(repoDigest, "@", 2); len(fields) == 2 {
+			listed.ManifestDigest = fields[1]
+			break
+		}
+	}
+	return listed
+}
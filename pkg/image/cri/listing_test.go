@@ -0,0 +1,32 @@
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestListImages(t *testing.T) {
+	useFakeCRI(t, &fakeCRI{
+		images: []*runtimeapi.Image{
+			{Id: "sha256:aaa", RepoTags: []string{"docker.io/library/alpine:3.12"}, RepoDigests: []string{"docker.io/library/alpine@sha256:bbb"}},
+			{Id: "sha256:ccc"},
+		},
+	})
+
+	actual, err := ListImages(context.Background())
+	if err != nil {
+		t.Fatalf("could not list images: %+v", err)
+	}
+
+	expected := []image.ListedImage{
+		{ID: "sha256:aaa", ManifestDigest: "sha256:bbb", Tags: []string{"docker.io/library/alpine:3.12"}},
+		{ID: "sha256:ccc"},
+	}
+	for _, d := range deep.Equal(actual, expected) {
+		t.Errorf("diff: %+v", d)
+	}
+}
@@ -0,0 +1,33 @@
+package image
+
+import (
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// decompressedContents provides the decompressed contents of the given reader when the contents are compressed with a
+// supported algorithm, otherwise the contents are provided as-is. Closing the returned reader closes the given reader.
+func decompressedContents(reader io.ReadCloser) (io.ReadCloser, error) {
+	compression, buffered, err := file.DetectCompression(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	contents := &extentReadCloser{
+		Reader: buffered,
+		Closer: reader,
+	}
+
+	switch compression {
+	case file.GzipCompression, file.Bzip2Compression:
+		decompressed, _, err := file.NewDecompressedReadCloser(contents)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return decompressed, nil
+	default:
+		return contents, nil
+	}
+}
@@ -0,0 +1,119 @@
+package image
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestImage_Read_WithDecompressedContents(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write([]byte("kernel: booted")); err != nil {
+		t.Fatalf("could not compress contents: %+v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("could not compress contents: %+v", err)
+	}
+	compressed := buf.String()
+
+	// xz is not decoded, so this is provided as-is
+	xz := "\xfd7zXZ\x00not-really-xz"
+
+	tests := []struct {
+		name        string
+		options     []ReadOption
+		path        file.Path
+		expected    string
+		expectedRaw string
+	}{
+		{
+			name:        "gzip decompressed",
+			options:     []ReadOption{WithDecompressedContents()},
+			path:        "/var/log/boot.log.gz",
+			expected:    "kernel: booted",
+			expectedRaw: compressed,
+		},
+		{
+			name:        "gzip without option",
+			path:        "/var/log/boot.log.gz",
+			expected:    compressed,
+			expectedRaw: compressed,
+		},
+		{
+			name:        "uncompressed",
+			options:     []ReadOption{WithDecompressedContents()},
+			path:        "/etc/hostname",
+			expected:    "box",
+			expectedRaw: "box",
+		},
+		{
+			name:        "unsupported compression",
+			options:     []ReadOption{WithDecompressedContents()},
+			path:        "/usr/share/man/man1/ls.1.xz",
+			expected:    xz,
+			expectedRaw: xz,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := newTestImage(t, []v1.Layer{newTestLayer(t, map[string]string{
+				"var/log/boot.log.gz":        compressed,
+				"etc/hostname":               "box",
+				"usr/share/man/man1/ls.1.xz": xz,
+			})})
+			if err := img.Read(test.options...); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			reader, err := img.FileContentsFromSquash(test.path)
+			if err != nil {
+				t.Fatalf("could not fetch contents: %+v", err)
+			}
+			contents, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("could not read contents: %+v", err)
+			}
+			if string(contents) != test.expected {
+				t.Errorf("unexpected contents: %q != %q", string(contents), test.expected)
+			}
+
+			_, ref, err := squashedTreeOf(t, img).File(test.path)
+			if err != nil || ref == nil {
+				t.Fatalf("could not find file: %+v", err)
+			}
+
+			reader, err = img.FileContentsByReference(*ref)
+			if err != nil {
+				t.Fatalf("could not fetch contents by reference: %+v", err)
+			}
+			contents, err = ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("could not read contents: %+v", err)
+			}
+			if string(contents) != test.expected {
+				t.Errorf("unexpected contents by reference: %q != %q", string(contents), test.expected)
+			}
+
+			reader, err = img.FileCatalog.RawFileContents(*ref)
+			if err != nil {
+				t.Fatalf("could not fetch raw contents: %+v", err)
+			}
+			contents, err = ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("could not read raw contents: %+v", err)
+			}
+			if string(contents) != test.expectedRaw {
+				t.Errorf("unexpected raw contents: %q != %q", string(contents), test.expectedRaw)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// TreeDiff is the set of path changes between two squashed file trees (e.g. two layers or two images). All paths are
+// real paths (links are not resolved) and are sorted depth-first (parents before children).
+type TreeDiff struct {
+	// Added are the paths that exist only in the newer tree.
+	Added []file.Path
+	// Modified are the paths that exist in both trees but differ in type or metadata (mode, ownership, size, link
+	// destination, timestamps, xattrs, or content digests when available).
+	Modified []file.Path
+	// Removed are the paths that exist only in the older tree.
+	Removed []file.Path
+}
+
+// Empty indicates that there are no differences between the trees.
+func (d TreeDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+// diffSide is a squashed file tree and the catalog holding metadata for the files within it.
+type diffSide struct {
+	tree    *filetree.FileTree
+	catalog *FileCatalog
+}
+
+// Diff reports the paths added, modified, and removed by this layer relative to the given (lower) layer, comparing the
+// squashed trees of both layers. When previous is nil all paths of this layer's squashed tree are considered added.
+// The layers do not need to belong to the same image.
+func (l *Layer) Diff(previous *Layer) (TreeDiff, error) {
+	ctx := context.Background()
+	if err := l.squash(ctx); err != nil {
+		return TreeDiff{}, err
+	}
+
+	var before diffSide
+	if previous != nil {
+		if err := previous.squash(ctx); err != nil {
+			return TreeDiff{}, err
+		}
+		before = diffSide{tree: previous.SquashedTree, catalog: previous.fileCatalog}
+	}
+
+	return diffTrees(before, diffSide{tree: l.SquashedTree, catalog: l.fileCatalog})
+}
+
+// Compare reports the paths added, modified, and removed in image b relative to image a, comparing the squashed trees
+// of both images.
+func Compare(a, b *Image) (TreeDiff, error) {
+	ctx := context.Background()
+	for _, img := range []*Image{a, b} {
+		if err := img.IndexLayers(ctx); err != nil {
+			return TreeDiff{}, err
+		}
+	}
+
+	return diffTrees(
+		diffSide{tree: a.squashedTree(), catalog: &a.FileCatalog},
+		diffSide{tree: b.squashedTree(), catalog: &b.FileCatalog},
+	)
+}
+
+// diffTrees compares both trees by file reference (see filetree.FileTree.Diff), where paths referring to different files
+// are only considered modified if the file metadata differs.
+func diffTrees(before, after diffSide) (TreeDiff, error) {
+	beforeTree, afterTree := before.tree, after.tree
+	if beforeTree == nil {
+		beforeTree = filetree.NewFileTree()
+	}
+	if afterTree == nil {
+		afterTree = filetree.NewFileTree()
+	}
+
+	changes := beforeTree.Diff(afterTree)
+	diff := TreeDiff{
+		Added:   changes.Added,
+		Removed: changes.Removed,
+	}
+	if before.tree == nil {
+		// without a previous tree even the root is new
+		diff.Added = append([]file.Path{"/"}, diff.Added...)
+	}
+
+	for _, change := range changes.Changed {
+		modified, err := refModified(before, change.Before, after, change.After)
+		if err != nil {
+			return TreeDiff{}, err
+		}
+		if modified {
+			diff.Modified = append(diff.Modified, change.Path)
+		}
+	}
+
+	return diff, nil
+}
+
+// refModified indicates if two different files for the same path differ in metadata (directories implied by other
+// paths have no metadata, so these only match other implied directories).
+func refModified(before diffSide, beforeRef *file.Reference, after diffSide, afterRef *file.Reference) (bool, error) {
+	if beforeRef == nil || afterRef == nil {
+		return true, nil
+	}
+
+	beforeMetadata, beforeFound, err := diffMetadata(before.catalog, *beforeRef)
+	if err != nil {
+		return false, err
+	}
+	afterMetadata, afterFound, err := diffMetadata(after.catalog, *afterRef)
+	if err != nil {
+		return false, err
+	}
+	if !beforeFound || !afterFound {
+		return beforeFound != afterFound, nil
+	}
+
+	return !metadataEqual(beforeMetadata, afterMetadata), nil
+}
+
+// diffMetadata returns the catalog metadata for the given file (not found when the file has no catalog entry).
+func diffMetadata(catalog *FileCatalog, ref file.Reference) (file.Metadata, bool, error) {
+	if catalog == nil {
+		return file.Metadata{}, false, nil
+	}
+	metadata, err := catalog.Metadata(ref)
+	if errors.Is(err, ErrFileNotFound) {
+		return file.Metadata{}, false, nil
+	}
+	if err != nil {
+		return file.Metadata{}, false, err
+	}
+	return metadata, true, nil
+}
+
+// metadataEqual compares the attributes of two files that describe the file itself (not where it was found, e.g. the
+// tar header name or sequence). Content digests are only compared when available for both files.
+func metadataEqual(a, b file.Metadata) bool {
+	if a.TypeFlag != b.TypeFlag ||
+		a.IsDir != b.IsDir ||
+		a.Mode != b.Mode ||
+		a.UserID != b.UserID ||
+		a.GroupID != b.GroupID ||
+		a.Size != b.Size ||
+		a.Linkname != b.Linkname ||
+		!a.ModTime.Equal(b.ModTime) {
+		return false
+	}
+
+	if len(a.Xattrs) != 0 || len(b.Xattrs) != 0 {
+		if !reflect.DeepEqual(a.Xattrs, b.Xattrs) {
+			return false
+		}
+	}
+
+	if len(a.Digests) > 0 && len(b.Digests) > 0 {
+		return reflect.DeepEqual(a.Digests[0], b.Digests[0])
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package image
+
+import (
+	"archive/tar"
+	"reflect"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestLayer_Diff(t *testing.T) {
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/changed.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/removed.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/untouched.txt"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/changed.txt", Mode: 0o600},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.removed.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/added.txt"},
+	)
+
+	img := newTestImage(t, []v1.Layer{base, top})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	tests := []struct {
+		name     string
+		layer    *Layer
+		previous *Layer
+		expected TreeDiff
+	}{
+		{
+			name:     "changes from previous layer",
+			layer:    img.Layers[1],
+			previous: img.Layers[0],
+			expected: TreeDiff{
+				Added:    []file.Path{"/etc/added.txt"},
+				Modified: []file.Path{"/etc/changed.txt"},
+				Removed:  []file.Path{"/etc/removed.txt"},
+			},
+		},
+		{
+			name:  "no previous layer",
+			layer: img.Layers[0],
+			expected: TreeDiff{
+				Added: []file.Path{"/", "/etc", "/etc/changed.txt", "/etc/removed.txt", "/etc/untouched.txt"},
+			},
+		},
+		{
+			name:     "same layer",
+			layer:    img.Layers[1],
+			previous: img.Layers[1],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := test.layer.Diff(test.previous)
+			if err != nil {
+				t.Fatalf("could not diff layers: %+v", err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("unexpected diff:\n\texpected: %+v\n\tactual:   %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "same.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "owner.txt"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "same.txt"},
+	)
+	changed := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "same.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "owner.txt", Uid: 1000},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "owner.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "new.txt"},
+	)
+
+	a := newTestImage(t, []v1.Layer{base})
+	if err := a.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	b := newTestImage(t, []v1.Layer{changed})
+	if err := b.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	actual, err := Compare(a, b)
+	if err != nil {
+		t.Fatalf("could not compare images: %+v", err)
+	}
+	expected := TreeDiff{
+		Added:    []file.Path{"/new.txt"},
+		Modified: []file.Path{"/link", "/owner.txt"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected diff:\n\texpected: %+v\n\tactual:   %+v", expected, actual)
+	}
+
+	reversed, err := Compare(b, a)
+	if err != nil {
+		t.Fatalf("could not compare images: %+v", err)
+	}
+	if !reflect.DeepEqual(reversed.Removed, expected.Added) || !reflect.DeepEqual(reversed.Modified, expected.Modified) {
+		t.Errorf("unexpected reversed diff: %+v", reversed)
+	}
+
+	again := newTestImage(t, []v1.Layer{base})
+	if err := again.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	same, err := Compare(a, again)
+	if err != nil {
+		t.Fatalf("could not compare images: %+v", err)
+	}
+	if !same.Empty() {
+		t.Errorf("expected no differences: %+v", same)
+	}
+}
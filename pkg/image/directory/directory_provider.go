@@ -0,0 +1,124 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// rootfsTarName is the name of the synthetic layer tar within the content temp dir.
+const rootfsTarName = "rootfs.tar"
+
+// pseudoFilesystemDirs are the top-level dirs of a root filesystem that are typically mount points for pseudo
+// filesystems (e.g. within a live "/" or a chroot), whose contents are not captured (the dirs themselves are).
+var pseudoFilesystemDirs = []string{"proc", "sys"}
+
+// ImageProvider is an image.Provider for a plain directory (e.g. an unpacked root filesystem, a chroot, or a live "/")
+// represented as an image with a single synthetic layer.
+type ImageProvider struct {
+	path      string
+	tmpDirGen *file.TempDirGenerator
+}
+
+// NewProviderFromPath creates a new provider instance for the root filesystem directory at the given path.
+func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator) *ImageProvider {
+	return &ImageProvider{
+		path:      path,
+		tmpDirGen: tmpDirGen,
+	}
+}
+
+// Provide an image object with a single layer that contains the entire directory at the configured location on disk.
+// The directory is captured as an uncompressed tar within the content temp dir (so the image reflects the directory
+// as of when it was provided), which the layer is read from directly. The image has no tags and no history.
+func (p *ImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	origin := p.newOrigin()
+
+	info, err := os.Stat(p.path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: no directory at path=%q", image.ErrImageNotFound, p.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory=%q: %w", p.path, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("unable to provide image from path=%q: not a directory", p.path)
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	tarPath := filepath.Join(contentTempDir, rootfsTarName)
+	if err := writeRootfsTar(ctx, p.path, tarPath); err != nil {
+		return nil, err
+	}
+
+	layer, err := tarball.LayerFromFile(tarPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create layer from directory=%q: %w", p.path, err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create image from directory=%q: %w", p.path, err)
+	}
+
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create image manifest: %w", err)
+	}
+
+	origin.AcquisitionCompleted = time.Now()
+
+	return image.NewImage(img, contentTempDir,
+		image.WithManifest(rawManifest),
+		image.WithOrigin(origin),
+		// the layer tar is already uncompressed on disk, there is no need to copy it into the content temp dir
+		image.WithLayerOpener(func(v1.Layer) image.LayerOpener {
+			return image.NewLayerTarOpener(tarPath)
+		}),
+	), nil
+}
+
+// writeRootfsTar captures the directory at the given root as an uncompressed tar at the given path (the dir containing
+// the tar is never captured, e.g. the temp dir when capturing a live "/").
+func writeRootfsTar(ctx context.Context, root, tarPath string) error {
+	fh, err := os.Create(tarPath)
+	if err != nil {
+		return fmt.Errorf("unable to create rootfs tar=%q: %w", tarPath, err)
+	}
+	defer fh.Close()
+
+	err = file.WriteDirTar(ctx, root, fh, file.DirTarOptions{
+		Exclude:      []string{filepath.Dir(tarPath)},
+		SkipContents: pseudoFilesystemDirs,
+	})
+	if err != nil {
+		return err
+	}
+	return fh.Close()
+}
+
+func (p *ImageProvider) newOrigin() image.Origin {
+	location, err := filepath.Abs(p.path)
+	if err != nil {
+		location = p.path
+	}
+
+	return image.Origin{
+		Source:             image.DirectorySource,
+		Location:           location,
+		AcquisitionStarted: time.Now(),
+	}
+}
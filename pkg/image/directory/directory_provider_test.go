@@ -0,0 +1,114 @@
+package directory
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestImageProvider_Provide(t *testing.T) {
+	root, err := ioutil.TempDir("", "stereoscope-rootfs-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"etc", "proc/1", "usr/bin"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("could not create dir: %+v", err)
+		}
+	}
+	files := map[string]string{
+		"etc/os-release": "ID=test",
+		"proc/1/status":  "should not be captured",
+		"usr/bin/app":    "#!/bin/sh",
+	}
+	for p, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, p), []byte(contents), 0644); err != nil {
+			t.Fatalf("could not write file: %+v", err)
+		}
+	}
+	if err := os.Symlink("../etc/os-release", filepath.Join(root, "usr/os-release")); err != nil {
+		t.Fatalf("could not create symlink: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	img, err := NewProviderFromPath(root, &tmpDirGen).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if len(img.Layers) != 1 {
+		t.Fatalf("unexpected number of layers: %d", len(img.Layers))
+	}
+	if img.Metadata.Origin.Source != image.DirectorySource || img.Metadata.Origin.Location != root {
+		t.Errorf("unexpected origin: %+v", img.Metadata.Origin)
+	}
+
+	contents, err := img.FileContentsFromSquash("/usr/os-release")
+	if err != nil {
+		t.Fatalf("could not get contents: %+v", err)
+	}
+	defer contents.Close()
+	actual, err := ioutil.ReadAll(contents)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(actual) != files["etc/os-release"] {
+		t.Errorf("unexpected contents: %q", string(actual))
+	}
+
+	metadata, err := img.FileMetadataFromSquash("/usr/bin/app")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.TypeFlag != tar.TypeReg || metadata.Size != int64(len(files["usr/bin/app"])) {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+
+	// pseudo filesystem mount points are captured without their contents
+	if !img.SquashedTree().HasPath("/proc") {
+		t.Errorf("expected /proc to be captured")
+	}
+	if img.SquashedTree().HasPath("/proc/1/status") {
+		t.Errorf("expected the contents of /proc to be skipped")
+	}
+}
+
+func TestImageProvider_Provide_NotADirectory(t *testing.T) {
+	fh, err := ioutil.TempFile("", "stereoscope-rootfs-test-")
+	if err != nil {
+		t.Fatalf("could not create temp file: %+v", err)
+	}
+	fh.Close()
+	defer os.Remove(fh.Name())
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	if _, err := NewProviderFromPath(fh.Name(), &tmpDirGen).Provide(context.Background()); err == nil {
+		t.Errorf("expected an error for a file")
+	}
+}
+
+func TestImageProvider_Provide_NotFound(t *testing.T) {
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	_, err := NewProviderFromPath("/does/not/exist", &tmpDirGen).Provide(context.Background())
+	if !errors.Is(err, image.ErrImageNotFound) {
+		t.Errorf("expected an image not found error, got: %+v", err)
+	}
+}
@@ -0,0 +1,407 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal"
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// maxSpooledLinkDepth is the number of links followed when resolving an entry within a spooled archive.
+const maxSpooledLinkDepth = 16
+
+// maxBufferedEntrySize is the largest archive entry (other than a layer tar) held in memory instead of being spooled to
+// disk, which covers the manifest and config (and any legacy metadata entries).
+const maxBufferedEntrySize = 4 * file.MB
+
+// tarBlockSize is the size of a tar header, which is inspected to tell layer tars apart from other archive entries.
+const tarBlockSize = 512
+
+// spooledArchive is a docker archive (as from "docker save") that has been read from a stream. Each layer tar is
+// indexed while it is streamed and spooled to its own file within a dir (for file contents), while all other entries
+// (the manifest, config, etc) are held in memory. This way the archive as a whole is never written to disk, and layer
+// tars are neither copied nor read again to index the image.
+type spooledArchive struct {
+	// dir is where entries are spooled
+	dir string
+	// files are the paths on disk for each spooled file entry (by normalized entry name)
+	files map[string]string
+	// buffered are the contents of each file entry held in memory (by normalized entry name)
+	buffered map[string][]byte
+	// links are the targets of each link entry (by normalized entry name)
+	links map[string]string
+	// indexes are the indexes of each layer tar made while spooling (by path on disk)
+	indexes map[string]*spooledIndex
+	// size is the total size of all file entries
+	size int64
+}
+
+// spooledIndex is the index of a layer tar made while the layer tar was streamed.
+type spooledIndex struct {
+	// digest is the digest of the layer tar (to be matched with the diff ID)
+	digest  string
+	entries []file.Metadata
+	skipped []file.SkippedTarEntry
+}
+
+// spoolArchive reads the given docker archive stream, indexing and spooling each layer tar to its own file within the
+// given (existing, empty) dir.
+func spoolArchive(reader io.Reader, dir string) (*spooledArchive, error) {
+	archive := &spooledArchive{
+		dir:      dir,
+		files:    make(map[string]string),
+		buffered: make(map[string][]byte),
+		links:    make(map[string]string),
+		indexes:  make(map[string]*spooledIndex),
+	}
+
+	err := file.TarIterator(reader, func(header *tar.Header, contents io.Reader) error {
+		if detail := file.SuspiciousTarEntryName(header.Name); detail != "" {
+			return fmt.Errorf("%w: archive entry=%q is suspicious (%s)", image.ErrManifestInvalid, header.Name, detail)
+		}
+		name := normalizeEntryName(header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			archive.links[name] = normalizeEntryName(path.Join(path.Dir(name), header.Linkname))
+		case tar.TypeLink:
+			archive.links[name] = normalizeEntryName(header.Linkname)
+		case tar.TypeReg, tar.TypeRegA:
+			if err := archive.add(name, header.Size, contents); err != nil {
+				return fmt.Errorf("unable to spool archive entry=%q: %w", header.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// add reads the contents of a single file entry, where layer tars (and large entries) are spooled to disk and all other
+// entries are held in memory.
+func (a *spooledArchive) add(name string, size int64, contents io.Reader) error {
+	buffered := bufio.NewReaderSize(contents, tarBlockSize)
+	header, err := buffered.Peek(tarBlockSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	layerTar := isLayerTar(header)
+
+	if !layerTar && size <= maxBufferedEntrySize {
+		b, err := ioutil.ReadAll(buffered)
+		if err != nil {
+			return err
+		}
+		a.buffered[name] = b
+		a.size += int64(len(b))
+		return nil
+	}
+
+	// note: entries are spooled by sequence (not by name) so that the names never need to be trusted
+	spoolPath := filepath.Join(a.dir, strconv.Itoa(len(a.files)))
+	f, err := os.Create(spoolPath)
+	if err != nil {
+		return fmt.Errorf("unable to create spool file: %w", err)
+	}
+	var n int64
+	if layerTar {
+		var index *spooledIndex
+		n, index, err = spoolLayerTar(f, buffered)
+		if index != nil {
+			a.indexes[spoolPath] = index
+		}
+	} else {
+		// e.g. a compressed layer blob, which is indexed when the image is read
+		n, err = io.Copy(f, buffered)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	a.files[name] = spoolPath
+	a.size += n
+	return nil
+}
+
+// spoolLayerTar writes the given layer tar stream while indexing it. The index is nil if the layer tar cannot be fully
+// indexed (e.g. unsupported entries), in which case the layer tar is indexed again when the image is read (where the
+// tar entry policy of the image applies).
+func spoolLayerTar(w io.Writer, reader io.Reader) (int64, *spooledIndex, error) {
+	hasher := sha256.New()
+	counter := &byteCounter{}
+	contents := io.TeeReader(reader, io.MultiWriter(w, hasher, counter))
+
+	index := &spooledIndex{}
+	err := file.VisitFileMetadataAndContentsFromTarWithSkips(contents, file.StrictTarEntries, func(metadata file.Metadata, _ io.Reader) error {
+		index.entries = append(index.entries, metadata)
+		return nil
+	}, func(entry file.SkippedTarEntry) {
+		index.skipped = append(index.skipped, entry)
+	})
+	if err != nil {
+		log.Debugf("unable to index layer tar while spooling (will be indexed when read): %+v", err)
+		index = nil
+	}
+
+	// the tar iteration stops at the end-of-archive marker, the remainder is still part of the layer tar
+	if _, err := io.Copy(ioutil.Discard, contents); err != nil {
+		return counter.n, nil, err
+	}
+	if index != nil {
+		index.digest = fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+	}
+	return counter.n, index, nil
+}
+
+// byteCounter counts the bytes written to it.
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// isLayerTar indicates that the given leading bytes of an archive entry are of a tar (including an empty tar, which is
+// only the end-of-archive marker).
+func isLayerTar(header []byte) bool {
+	if len(header) < tarBlockSize {
+		return false
+	}
+	return file.IsTarHeader(header) || bytes.Equal(header, make([]byte, tarBlockSize))
+}
+
+// normalizeEntryName is the form of an archive entry name used for lookups (e.g. "./manifest.json" is
+// "manifest.json").
+func normalizeEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// resolve returns the name of the file entry with the given name (following links).
+func (a *spooledArchive) resolve(name string) (string, error) {
+	name = normalizeEntryName(name)
+	for i := 0; i < maxSpooledLinkDepth; i++ {
+		if _, ok := a.files[name]; ok {
+			return name, nil
+		}
+		if _, ok := a.buffered[name]; ok {
+			return name, nil
+		}
+		target, ok := a.links[name]
+		if !ok {
+			return "", fmt.Errorf("%w: no archive entry=%q", image.ErrManifestInvalid, name)
+		}
+		name = target
+	}
+	return "", fmt.Errorf("%w: too many links for archive entry=%q", image.ErrManifestInvalid, name)
+}
+
+// path returns the path on disk for the file entry with the given name (following links), spooling the entry if it is
+// held in memory (e.g. a small compressed layer blob).
+func (a *spooledArchive) path(name string) (string, error) {
+	name, err := a.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	if spoolPath, ok := a.files[name]; ok {
+		return spoolPath, nil
+	}
+
+	spoolPath := filepath.Join(a.dir, strconv.Itoa(len(a.files)))
+	if err := ioutil.WriteFile(spoolPath, a.buffered[name], 0600); err != nil {
+		return "", fmt.Errorf("unable to spool archive entry=%q: %w", name, err)
+	}
+	a.files[name] = spoolPath
+	delete(a.buffered, name)
+	return spoolPath, nil
+}
+
+// read returns the contents of the file entry with the given name (following links).
+func (a *spooledArchive) read(name string) ([]byte, error) {
+	name, err := a.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if contents, ok := a.buffered[name]; ok {
+		return contents, nil
+	}
+	return ioutil.ReadFile(a.files[name])
+}
+
+// spooledImage is the single image within a spooled archive.
+type spooledImage struct {
+	manifest  *dockerManifest
+	rawConfig []byte
+	// layerPaths are the paths on disk for each layer tar (by diff ID)
+	layerPaths map[v1.Hash]string
+	// layerIndexes are the indexes made while spooling of each layer tar that matches the diff ID (by diff ID)
+	layerIndexes map[v1.Hash]*spooledIndex
+	// layerSizes are the sizes of each layer tar (in manifest order)
+	layerSizes []int64
+}
+
+// image returns the single image within the archive (which must have a manifest.json, as with all archives saved by
+// a docker daemon since docker 1.10).
+func (a *spooledArchive) image() (*spooledImage, error) {
+	rawManifest, err := a.read("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := newManifest(rawManifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.parsed) != 1 {
+		return nil, ErrMultipleManifests
+	}
+	entry := manifest.parsed[0]
+
+	rawConfig, err := a.read(entry.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read docker config: %w", err)
+	}
+	cfg, err := v1.ParseConfigFile(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, image.NewProviderError(image.ErrManifestInvalid, "unable to parse docker config", err)
+	}
+	if len(cfg.RootFS.DiffIDs) != len(entry.Layers) {
+		return nil, fmt.Errorf("%w: config has %d diff IDs for %d layers", image.ErrManifestInvalid, len(cfg.RootFS.DiffIDs), len(entry.Layers))
+	}
+
+	img := &spooledImage{
+		manifest:     manifest,
+		rawConfig:    rawConfig,
+		layerPaths:   make(map[v1.Hash]string),
+		layerIndexes: make(map[v1.Hash]*spooledIndex),
+	}
+	for idx, layer := range entry.Layers {
+		layerPath, err := a.path(layer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find layer tar: %w", err)
+		}
+		info, err := os.Stat(layerPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find layer tar: %w", err)
+		}
+		diffID := cfg.RootFS.DiffIDs[idx]
+		img.layerPaths[diffID] = layerPath
+		if index, ok := a.indexes[layerPath]; ok {
+			if index.digest == diffID.String() {
+				img.layerIndexes[diffID] = index
+			} else {
+				log.Debugf("spooled layer tar=%q does not match diff ID=%q (will be indexed when read)", layer, diffID)
+			}
+		}
+		img.layerSizes = append(img.layerSizes, info.Size())
+	}
+	return img, nil
+}
+
+// RawConfigFile returns the config as found within the archive.
+func (i *spooledImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+// MediaType of the manifest for the image.
+func (i *spooledImage) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+// LayerByDiffID returns the layer with the given diff ID.
+func (i *spooledImage) LayerByDiffID(diffID v1.Hash) (partial.UncompressedLayer, error) {
+	layerPath, ok := i.layerPaths[diffID]
+	if !ok {
+		return nil, fmt.Errorf("no layer with diff ID=%q", diffID)
+	}
+	return &spooledLayer{
+		diffID: diffID,
+		path:   layerPath,
+	}, nil
+}
+
+// layerOpener reads each layer directly from the spooled layer tar, replaying the index made while spooling (see
+// image.WithLayerOpener).
+func (i *spooledImage) layerOpener(layer v1.Layer) image.LayerOpener {
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil
+	}
+	layerPath, ok := i.layerPaths[diffID]
+	if !ok {
+		return nil
+	}
+	if index, ok := i.layerIndexes[diffID]; ok {
+		return image.NewIndexedLayerTarOpener(layerPath, index.entries, index.skipped)
+	}
+	return image.NewLayerBlobOpener(layerPath)
+}
+
+// spooledLayer is a single layer tar within a spooled archive.
+type spooledLayer struct {
+	diffID v1.Hash
+	path   string
+}
+
+// DiffID returns the digest of the uncompressed layer tar (as recorded within the config).
+func (l *spooledLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+// Uncompressed returns the layer tar (decompressed as needed).
+func (l *spooledLayer) Uncompressed() (io.ReadCloser, error) {
+	return image.NewLayerBlobOpener(l.path).Open()
+}
+
+// MediaType returns the media type of the layer.
+func (l *spooledLayer) MediaType() (types.MediaType, error) {
+	return types.DockerLayer, nil
+}
+
+// metadata describes the image (the config, an OCI manifest, and all tags) on top of the given tags.
+func (i *spooledImage) metadata(extraTags []string) []image.AdditionalMetadata {
+	var tags = internal.NewStringSet()
+	for _, t := range append(extraTags, i.manifest.allTags()...) {
+		tags.Add(t)
+	}
+
+	metadata := []image.AdditionalMetadata{
+		image.WithConfig(i.rawConfig),
+	}
+
+	// make a best-effort to generate an OCI manifest, but ultimately this should be considered optional
+	ociManifest, err := assembleOCIManifest(i.rawConfig, i.layerSizes)
+	if err != nil {
+		log.Warnf("failed to generate OCI manifest from docker archive: %+v", err)
+	} else if rawOCIManifest, err := json.Marshal(ociManifest); err != nil {
+		log.Warnf("failed to serialize OCI manifest: %+v", err)
+	} else {
+		metadata = append(metadata, image.WithManifest(rawOCIManifest))
+	}
+
+	if len(tags) > 0 {
+		metadata = append(metadata, image.WithTags(tags.ToSlice()...))
+	}
+	return metadata
+}
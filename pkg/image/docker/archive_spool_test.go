@@ -0,0 +1,259 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func spoolDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stereoscope-spool-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func TestSpoolArchive(t *testing.T) {
+	expected, err := random.Image(512, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	ref, err := name.NewTag("example.com/spooled:latest")
+	if err != nil {
+		t.Fatalf("could not create tag: %+v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tarball.Write(ref, expected, buf); err != nil {
+		t.Fatalf("could not write archive: %+v", err)
+	}
+
+	archive, err := spoolArchive(buf, spoolDir(t))
+	if err != nil {
+		t.Fatalf("could not spool archive: %+v", err)
+	}
+	spooled, err := archive.image()
+	if err != nil {
+		t.Fatalf("could not find image: %+v", err)
+	}
+	if tags := spooled.manifest.allTags(); len(tags) != 1 || tags[0] != ref.String() {
+		t.Errorf("unexpected tags: %+v", tags)
+	}
+
+	actual, err := partial.UncompressedToImage(spooled)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	expectedID, _ := expected.ConfigName()
+	actualID, err := actual.ConfigName()
+	if err != nil || actualID != expectedID {
+		t.Errorf("unexpected image ID: %q != %q (%+v)", actualID, expectedID, err)
+	}
+
+	layers, err := actual.Layers()
+	if err != nil {
+		t.Fatalf("could not get layers: %+v", err)
+	}
+	expectedLayers, _ := expected.Layers()
+	if len(layers) != len(expectedLayers) {
+		t.Fatalf("unexpected number of layers: %d != %d", len(layers), len(expectedLayers))
+	}
+	for idx, layer := range layers {
+		opener := spooled.layerOpener(layer)
+		if opener == nil {
+			t.Fatalf("no opener for layer=%d", idx)
+		}
+		reader, err := opener.Open()
+		if err != nil {
+			t.Fatalf("could not open layer=%d: %+v", idx, err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read layer=%d: %+v", idx, err)
+		}
+
+		expectedReader, _ := expectedLayers[idx].Uncompressed()
+		expectedContents, _ := ioutil.ReadAll(expectedReader)
+		expectedReader.Close()
+		if !bytes.Equal(contents, expectedContents) {
+			t.Errorf("unexpected contents for layer=%d", idx)
+		}
+	}
+}
+
+func TestSpoolArchive_Links(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	headers := []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "./aaaa/layer.tar", Size: 5, Mode: 0o644},
+		// layers repeated within an archive are links to the first occurrence
+		{Typeflag: tar.TypeSymlink, Name: "bbbb/layer.tar", Linkname: "../aaaa/layer.tar"},
+		{Typeflag: tar.TypeLink, Name: "cccc/layer.tar", Linkname: "bbbb/layer.tar"},
+	}
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte("layer")); err != nil {
+				t.Fatalf("could not write contents: %+v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	spooled, err := spoolArchive(buf, spoolDir(t))
+	if err != nil {
+		t.Fatalf("could not spool archive: %+v", err)
+	}
+	for _, name := range []string{"bbbb/layer.tar", "cccc/layer.tar"} {
+		contents, err := spooled.read(name)
+		if err != nil {
+			t.Fatalf("could not read linked entry=%q: %+v", name, err)
+		}
+		if string(contents) != "layer" {
+			t.Errorf("unexpected contents for entry=%q: %q", name, contents)
+		}
+	}
+	if _, err := spooled.read("dddd/layer.tar"); !errors.Is(err, image.ErrManifestInvalid) {
+		t.Errorf("expected a missing entry to be an invalid manifest, got: %+v", err)
+	}
+}
+
+func TestSpoolArchive_SuspiciousEntry(t *testing.T) {
+	archive := testTar(t,
+		tarEntry{name: "../manifest.json", contents: []byte("[]")},
+	)
+	if _, err := spoolArchive(bytes.NewReader(archive), spoolDir(t)); !errors.Is(err, image.ErrManifestInvalid) {
+		t.Errorf("expected a suspicious entry to be an invalid manifest, got: %+v", err)
+	}
+}
+
+func TestSpoolArchive_IndexesLayerTars(t *testing.T) {
+	layers := [][]byte{
+		testTar(t, tarEntry{name: "etc/hosts", contents: []byte("127.0.0.1")}),
+		testTar(t, tarEntry{name: "app/run", contents: []byte("exit")}),
+	}
+	diffIDs := []string{
+		fmt.Sprintf("sha256:%x", sha256.Sum256(layers[0])),
+		fmt.Sprintf("sha256:%x", sha256.Sum256(layers[1])),
+	}
+
+	tests := []struct {
+		name    string
+		diffIDs []string
+		indexed []bool
+	}{
+		{
+			name:    "all layers match the diff IDs",
+			diffIDs: diffIDs,
+			indexed: []bool{true, true},
+		},
+		{
+			name:    "layer does not match the diff ID",
+			diffIDs: []string{diffIDs[0], fmt.Sprintf("sha256:%064x", 0)},
+			indexed: []bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["%s"]}}`, strings.Join(test.diffIDs, `","`))
+			archive := testTar(t,
+				tarEntry{name: "aaaa/layer.tar", contents: layers[0]},
+				tarEntry{name: "bbbb/layer.tar", contents: layers[1]},
+				tarEntry{name: "config.json", contents: []byte(config)},
+				tarEntry{name: "manifest.json", contents: []byte(`[{"Config":"config.json","RepoTags":["example.com/spooled:latest"],"Layers":["aaaa/layer.tar","bbbb/layer.tar"]}]`)},
+			)
+
+			dir := spoolDir(t)
+			spooled, err := spoolArchive(bytes.NewReader(archive), dir)
+			if err != nil {
+				t.Fatalf("could not spool archive: %+v", err)
+			}
+			// only the layer tars are spooled, everything else is held in memory
+			if len(spooled.files) != 2 || len(spooled.buffered) != 2 {
+				t.Errorf("unexpected spooled entries: files=%+v buffered=%d", spooled.files, len(spooled.buffered))
+			}
+
+			img, err := spooled.image()
+			if err != nil {
+				t.Fatalf("could not find image: %+v", err)
+			}
+			for idx, expected := range test.indexed {
+				diffID, err := v1.NewHash(test.diffIDs[idx])
+				if err != nil {
+					t.Fatalf("could not parse diff ID: %+v", err)
+				}
+				index, ok := img.layerIndexes[diffID]
+				if ok != expected {
+					t.Fatalf("unexpected index for layer=%d: %+v", idx, index)
+				}
+				if ok && len(index.entries) != 1 {
+					t.Errorf("unexpected index entries for layer=%d: %+v", idx, index.entries)
+				}
+			}
+		})
+	}
+}
+
+func TestSpoolArchive_ReadIndexedImage(t *testing.T) {
+	layer := testTar(t, tarEntry{name: "etc/hosts", contents: []byte("127.0.0.1")})
+	config := fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:%x"]}}`, sha256.Sum256(layer))
+	archive := testTar(t,
+		tarEntry{name: "aaaa/layer.tar", contents: layer},
+		tarEntry{name: "config.json", contents: []byte(config)},
+		tarEntry{name: "manifest.json", contents: []byte(`[{"Config":"config.json","Layers":["aaaa/layer.tar"]}]`)},
+	)
+
+	spooled, err := spoolArchive(bytes.NewReader(archive), spoolDir(t))
+	if err != nil {
+		t.Fatalf("could not spool archive: %+v", err)
+	}
+	spooledImg, err := spooled.image()
+	if err != nil {
+		t.Fatalf("could not find image: %+v", err)
+	}
+	v1Img, err := partial.UncompressedToImage(spooledImg)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	// the layer is indexed while spooling, so the spooled layer tar is only needed for file contents
+	layerPath, err := spooled.path("aaaa/layer.tar")
+	if err != nil {
+		t.Fatalf("could not find layer tar: %+v", err)
+	}
+	if err := ioutil.WriteFile(layerPath, make([]byte, len(layer)), 0600); err != nil {
+		t.Fatalf("could not clear layer tar: %+v", err)
+	}
+
+	img := image.NewImage(v1Img, spoolDir(t), append(spooledImg.metadata(nil), image.WithLayerOpener(spooledImg.layerOpener))...)
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	if !img.SquashedTree().HasPath(file.Path("/etc/hosts")) {
+		t.Errorf("expected the spooled index to be used")
+	}
+}
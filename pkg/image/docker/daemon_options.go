@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/anchore/stereoscope/internal/docker"
+	"github.com/anchore/stereoscope/pkg/image/registry"
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// PullPolicy determines when the daemon pulls the image before it is saved.
+type PullPolicy uint8
+
+const (
+	// PullIfMissing pulls the image only when the daemon does not have it (or has it for another platform than
+	// requested), as with the docker CLI.
+	PullIfMissing PullPolicy = iota
+	// PullNever fails when the daemon does not have the image (see image.ErrImageNotFound).
+	PullNever
+	// PullAlways pulls the image even when the daemon has it (refreshing a tag that may have moved).
+	PullAlways
+)
+
+// DaemonOptions selects the daemon to obtain images from (e.g. a remote daemon), overriding the environment (DOCKER_HOST
+// and DOCKER_CERT_PATH), and how images are pulled by the daemon. The zero value uses the environment and pulls
+// images missing from the daemon.
+type DaemonOptions struct {
+	// Host is the daemon endpoint: a unix socket (e.g. "unix:///var/run/docker.sock"), TCP (e.g. "tcp://host:2376"),
+	// SSH (e.g. "ssh://user@host", which requires the ssh CLI and the docker CLI on the remote host), or a windows named
+	// pipe (e.g. "npipe:////./pipe/docker_engine").
+	Host string
+	// CertPath is the directory with the TLS certificates for connecting to the daemon (ca.pem, cert.pem, and
+	// key.pem), where the daemon certificate is verified against ca.pem (e.g. for TCP).
+	CertPath string
+	// PullPolicy determines when the image is pulled by the daemon (PullIfMissing when not provided).
+	PullPolicy PullPolicy
+	// Credentials are used for pulling from matching registries (see registry.Credentials), taking precedence over
+	// the docker config (e.g. ~/.docker/config.json).
+	Credentials []registry.Credentials
+	// Stream reads the image as it is saved from the daemon, indexing and spooling each layer tar individually (the
+	// config and manifest are held in memory) instead of saving the whole image tar. Layer tars are then read in place
+	// for file contents instead of being copied within the content cache dir (and are not read again to index the
+	// image), which roughly halves the disk used for the image.
+	Stream bool
+}
+
+// getClient returns the client getter for the daemon selected by the options (nil when no daemon is selected, which is
+// the daemon selected by the environment).
+func (o DaemonOptions) getClient() func() (*client.Client, error) {
+	if o.Host == "" && o.CertPath == "" {
+		return nil
+	}
+	cfg := docker.Config{
+		Host:     o.Host,
+		CertPath: o.CertPath,
+	}
+	return func() (*client.Client, error) {
+		return docker.GetClientWithConfig(cfg)
+	}
+}
+
+// credentialsAuth returns the encoded registry auth for the pull options from the first credentials matching the given
+// registry hostname (empty if there are no matching credentials).
+func credentialsAuth(credentials []registry.Credentials, hostname string) string {
+	for _, c := range credentials {
+		// parsing the authority normalizes equivalent registry names (e.g. "docker.io" vs "index.docker.io")
+		authority, err := name.NewRegistry(c.Authority, name.WeakValidation)
+		if err != nil || authority.RegistryStr() != hostname {
+			continue
+		}
+		auth := map[string]string{
+			"username": c.Username,
+			"password": c.Password,
+		}
+		if c.Token != "" {
+			auth = map[string]string{
+				"registrytoken": c.Token,
+			}
+		}
+		jsonBytes, _ := json.Marshal(auth)
+		return base64.StdEncoding.EncodeToString(jsonBytes)
+	}
+	return ""
+}
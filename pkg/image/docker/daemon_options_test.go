@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image/registry"
+)
+
+func TestCredentialsAuth(t *testing.T) {
+	credentials := []registry.Credentials{
+		{Authority: "localhost:5000", Username: "user", Password: "pass"},
+		{Authority: "docker.io", Token: "token"},
+	}
+
+	tests := []struct {
+		hostname string
+		expected map[string]string
+	}{
+		{
+			hostname: "localhost:5000",
+			expected: map[string]string{"username": "user", "password": "pass"},
+		},
+		{
+			// equivalent registry names match
+			hostname: "index.docker.io",
+			expected: map[string]string{"registrytoken": "token"},
+		},
+		{
+			hostname: "ghcr.io",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hostname, func(t *testing.T) {
+			auth := credentialsAuth(credentials, test.hostname)
+			if test.expected == nil {
+				if auth != "" {
+					t.Fatalf("expected no auth, got %q", auth)
+				}
+				return
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(auth)
+			if err != nil {
+				t.Fatalf("unable to decode auth: %+v", err)
+			}
+			var actual map[string]string
+			if err := json.Unmarshal(decoded, &actual); err != nil {
+				t.Fatalf("unable to parse auth: %+v", err)
+			}
+			if len(actual) != len(test.expected) {
+				t.Fatalf("unexpected auth: %+v", actual)
+			}
+			for k, v := range test.expected {
+				if actual[k] != v {
+					t.Errorf("unexpected auth %q: %q != %q", k, actual[k], v)
+				}
+			}
+		})
+	}
+}
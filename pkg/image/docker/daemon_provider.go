@@ -16,43 +16,119 @@ import (
 
 	"github.com/docker/cli/cli/config/configfile"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 
 	"github.com/anchore/stereoscope/internal/bus"
 	"github.com/anchore/stereoscope/internal/docker"
 	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/internal/podman"
 	"github.com/anchore/stereoscope/pkg/event"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/registry"
 	"github.com/docker/cli/cli/config"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/wagoodman/go-partybus"
 	"github.com/wagoodman/go-progress"
 )
 
-// DaemonImageProvider is a image.Provider capable of fetching and representing a docker image from the docker daemon API.
+// DaemonImageProvider is a image.Provider capable of fetching and representing a docker image from the docker daemon API
+// (or any daemon that serves a docker-compatible API, such as podman).
 type DaemonImageProvider struct {
 	imageStr  string
 	tmpDirGen *file.TempDirGenerator
+	// daemonName is the name of the daemon for display purposes
+	daemonName string
+	// source is the image source reported for all images provided
+	source image.Source
+	// getClient provides the API client for the daemon
+	getClient func() (*client.Client, error)
+	// platform is the platform explicitly requested by the user (if any), otherwise whatever image the daemon has is
+	// used. If the daemon has the image for another platform then the image for the requested platform is pulled.
+	platform *image.Platform
+	// retry determines how daemon operations are retried upon transient failures
+	retry image.RetryPolicy
+	// pullPolicy determines when the image is pulled by the daemon
+	pullPolicy PullPolicy
+	// credentials are used for pulling from matching registries (before the docker config)
+	credentials []registry.Credentials
+	// stream indicates that the image is read as it is saved from the daemon (see DaemonOptions.Stream)
+	stream bool
 }
 
 // NewProviderFromDaemon creates a new provider instance for a specific image that will later be cached to the given directory.
-func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator) *DaemonImageProvider {
+func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *DaemonImageProvider {
 	return &DaemonImageProvider{
-		imageStr:  imgStr,
-		tmpDirGen: tmpDirGen,
+		imageStr:   imgStr,
+		tmpDirGen:  tmpDirGen,
+		platform:   options.Platform,
+		retry:      options.Retry,
+		daemonName: "docker",
+		source:     image.DockerDaemonSource,
+		getClient:  docker.GetClient,
 	}
 }
 
-func (p *DaemonImageProvider) trackSaveProgress() (*progress.TimedProgress, *progress.Writer, *progress.Stage, error) {
-	dockerClient, err := docker.GetClient()
+// NewProviderFromPodman creates a new provider instance for a specific image from the podman API (rootful or rootless),
+// which will later be cached to the given directory.
+func NewProviderFromPodman(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *DaemonImageProvider {
+	return &DaemonImageProvider{
+		imageStr:   imgStr,
+		tmpDirGen:  tmpDirGen,
+		platform:   options.Platform,
+		retry:      options.Retry,
+		daemonName: "podman",
+		source:     image.PodmanDaemonSource,
+		getClient:  podman.GetClient,
+	}
+}
+
+// SetDaemonOptions selects the daemon to obtain the image from, overriding the environment (the zero value keeps the
+// daemon selected by the environment), and how the image is pulled by the daemon. Note: podman serves a
+// docker-compatible API, so this applies to podman too.
+func (p *DaemonImageProvider) SetDaemonOptions(options DaemonOptions) {
+	if getClient := options.getClient(); getClient != nil {
+		p.getClient = getClient
+	}
+	p.pullPolicy = options.PullPolicy
+	p.credentials = options.Credentials
+	p.stream = options.Stream
+}
+
+// ResolveID inspects the image within the daemon, returning the image ID without saving the image (see
+// image.Resolver).
+func (p *DaemonImageProvider) ResolveID(ctx context.Context) (string, error) {
+	dockerClient, err := p.getClient()
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("unable to get docker client: %w", err)
+		return "", image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to get %s client", p.daemonName), err)
+	}
+	inspect, err := p.inspect(ctx, dockerClient)
+	if err != nil {
+		return "", daemonError(err, "unable to inspect image")
+	}
+	return inspect.ID, nil
+}
+
+// saveProgress is the progress of saving an image from the daemon (estimated until the daemon starts streaming the
+// image, then measured as the image is copied).
+type saveProgress struct {
+	estimate *progress.TimedProgress
+	copied   *progress.Writer
+	stage    *progress.Stage
+}
+
+func (p *DaemonImageProvider) trackSaveProgress(ctx context.Context) (*saveProgress, error) {
+	dockerClient, err := p.getClient()
+	if err != nil {
+		return nil, image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to get %s client", p.daemonName), err)
 	}
 
 	// fetch the expected image size to estimate and measure progress
-	inspect, _, err := dockerClient.ImageInspectWithRaw(context.Background(), p.imageStr)
+	inspect, err := p.inspect(ctx, dockerClient)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("unable to inspect image: %w", err)
+		return nil, daemonError(err, "unable to inspect image")
 	}
 
 	// docker image save clocks in at ~125MB/sec on my laptop... mileage may vary, of course :shrug:
@@ -79,7 +155,11 @@ func (p *DaemonImageProvider) trackSaveProgress() (*progress.TimedProgress, *pro
 		}),
 	})
 
-	return estimateSaveProgress, copyProgress, stage, nil
+	return &saveProgress{
+		estimate: estimateSaveProgress,
+		copied:   copyProgress,
+		stage:    stage,
+	}, nil
 }
 
 // pull a docker image
@@ -105,20 +185,36 @@ func (p *DaemonImageProvider) pull(ctx context.Context) error {
 		Value:  status,
 	})
 
-	dockerClient, err := docker.GetClient()
+	dockerClient, err := p.getClient()
 	if err != nil {
-		return fmt.Errorf("failed to load docker client: %w", err)
+		return image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("failed to load %s client", p.daemonName), err)
 	}
 
-	options, err := newPullOptions(p.imageStr, cfg)
+	options, err := newPullOptions(p.imageStr, cfg, p.credentials)
 	if err != nil {
 		return err
 	}
+	if p.platform != nil {
+		options.Platform = p.platform.String()
+	}
+
+	err = p.retry.Do(ctx, image.RetryDaemonPull, isTransientDaemonError, func() error {
+		return p.pullOnce(ctx, dockerClient, options, status)
+	})
+	if err != nil {
+		return daemonError(err, "pull failed")
+	}
+	return nil
+}
 
+// pullOnce makes a single attempt at pulling the image, recording the progress within the given status. Note: the
+// error from the client is not wrapped (so that it may be classified).
+func (p *DaemonImageProvider) pullOnce(ctx context.Context, dockerClient *client.Client, options types.ImagePullOptions, status *PullStatus) error {
 	resp, err := dockerClient.ImagePull(ctx, p.imageStr, options)
 	if err != nil {
-		return fmt.Errorf("pull failed: %w", err)
+		return err
 	}
+	defer resp.Close()
 
 	var thePullEvent *pullEvent
 	decoder := json.NewDecoder(resp)
@@ -142,81 +238,220 @@ func (p *DaemonImageProvider) pull(ctx context.Context) error {
 	return nil
 }
 
-// Provide an image object that represents the cached docker image tar fetched from a docker daemon.
-func (p *DaemonImageProvider) Provide() (*image.Image, error) {
-	imageTempDir, err := p.tmpDirGen.NewTempDir()
+// inspect fetches the details of the image from the daemon. Note: the error from the client is not wrapped (so that it
+// may be classified).
+func (p *DaemonImageProvider) inspect(ctx context.Context, dockerClient *client.Client) (types.ImageInspect, error) {
+	var inspect types.ImageInspect
+	err := p.retry.Do(ctx, image.RetryDaemonInspect, isTransientDaemonError, func() error {
+		var err error
+		inspect, _, err = dockerClient.ImageInspectWithRaw(ctx, p.imageStr)
+		return err
+	})
+	return inspect, err
+}
+
+// save writes the image from the daemon to the given (empty) file, returning the number of bytes written. Each attempt
+// starts over with an empty file, where only the bytes read by the successful attempt are recorded.
+func (p *DaemonImageProvider) save(ctx context.Context, dockerClient *client.Client, f *os.File, tracker *saveProgress, bytesRead *image.ByteCounter) (int64, error) {
+	var nBytes int64
+	err := p.retry.Do(ctx, image.RetryDaemonSave, isTransientDaemonError, func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("unable to reset temp file: %w", err)
+		}
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("unable to reset temp file: %w", err)
+		}
+
+		tracker.stage.Current = "requesting image from " + p.daemonName
+		readCloser, err := dockerClient.ImageSave(ctx, []string{p.imageStr})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := readCloser.Close()
+			if err != nil {
+				log.Errorf("unable to close image save stream (%s): %+v", f.Name(), err)
+			}
+		}()
+
+		// save the image contents to the temp file
+		// note: this is the same image that will be used to querying image content during analysis
+		tracker.estimate.SetCompleted()
+		tracker.stage.Current = "saving image to disk"
+		nBytes, err = io.Copy(io.MultiWriter(f, tracker.copied), file.NewContextReader(ctx, readCloser))
+		if err != nil {
+			return fmt.Errorf("unable to save image to tar: %w", err)
+		}
+		bytesRead.AddRemote(nBytes)
+		return nil
+	})
+	return nBytes, err
+}
+
+// spool reads the image from the daemon as it is saved, indexing and spooling each layer tar within the given dir (see
+// spoolArchive). Each attempt starts over with an empty dir, where only the bytes read by the successful attempt are
+// recorded.
+func (p *DaemonImageProvider) spool(ctx context.Context, dockerClient *client.Client, dir string, tracker *saveProgress, bytesRead *image.ByteCounter) (*spooledArchive, error) {
+	var archive *spooledArchive
+	err := p.retry.Do(ctx, image.RetryDaemonSave, isTransientDaemonError, func() error {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("unable to reset spool dir: %w", err)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("unable to create spool dir: %w", err)
+		}
+
+		tracker.stage.Current = "requesting image from " + p.daemonName
+		readCloser, err := dockerClient.ImageSave(ctx, []string{p.imageStr})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := readCloser.Close()
+			if err != nil {
+				log.Errorf("unable to close image save stream (%s): %+v", dir, err)
+			}
+		}()
+
+		tracker.estimate.SetCompleted()
+		tracker.stage.Current = "spooling image to disk"
+		attempt := image.NewByteCounter()
+		reader := io.TeeReader(attempt.RemoteReader(file.NewContextReader(ctx, readCloser)), tracker.copied)
+		archive, err = spoolArchive(reader, dir)
+		if err != nil {
+			return err
+		}
+		bytesRead.AddRemote(attempt.BytesRead().Remote)
+		return nil
+	})
+	return archive, err
+}
+
+// provideStreamed provides the image as it is saved from the daemon, where layer tars are indexed while streamed and
+// spooled individually to be read in place (instead of saving the whole archive, then copying each layer tar within the
+// content cache dir and reading it again to index the image).
+func (p *DaemonImageProvider) provideStreamed(ctx context.Context, dockerClient *client.Client, dir string, tracker *saveProgress, tags []string, origin image.Origin) (*image.Image, error) {
+	bytesRead := image.NewByteCounter()
+	archive, err := p.spool(ctx, dockerClient, path.Join(dir, "archive"), tracker, bytesRead)
+	if err != nil {
+		return nil, daemonError(err, "unable to stream image")
+	}
+	if archive.size == 0 {
+		return nil, fmt.Errorf("cannot provide an empty image")
+	}
+
+	spooled, err := archive.image()
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from stream: %w", err)
+	}
+	img, err := partial.UncompressedToImage(spooled)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from stream: %w", err)
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
 	if err != nil {
 		return nil, err
 	}
 
-	// create a file within the temp dir
-	tempTarFile, err := os.Create(path.Join(imageTempDir, "image.tar"))
+	origin.AcquisitionCompleted = time.Now()
+	metadata := append(spooled.metadata(tags),
+		image.WithOrigin(origin),
+		image.WithByteCounter(bytesRead),
+		image.WithLayerOpener(spooled.layerOpener),
+	)
+
+	return image.NewImage(img, contentTempDir, metadata...), nil
+}
+
+// Provide an image object that represents the cached docker image tar fetched from a docker daemon.
+func (p *DaemonImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	acquisitionStarted := time.Now()
+
+	imageTempDir, err := p.tmpDirGen.NewTempDir()
 	if err != nil {
-		return nil, fmt.Errorf("unable to create temp file for image: %w", err)
+		return nil, err
 	}
-	defer func() {
-		err := tempTarFile.Close()
-		if err != nil {
-			log.Errorf("unable to close temp file (%s): %w", tempTarFile.Name(), err)
-		}
-	}()
 
-	// obtain a Docker client
-	dockerClient, err := docker.GetClient()
+	// obtain a Docker (API compatible) client
+	dockerClient, err := p.getClient()
 	if err != nil {
-		return nil, fmt.Errorf("unable to create a docker client: %w", err)
+		return nil, image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to create a %s client", p.daemonName), err)
 	}
 
 	// check if the image exists locally
-	inspectResult, _, err := dockerClient.ImageInspectWithRaw(context.Background(), p.imageStr)
+	inspectResult, err := p.inspect(ctx, dockerClient)
+
+	var pull bool
+	switch {
+	case err != nil && client.IsErrNotFound(err) && p.pullPolicy != PullNever:
+		pull = true
+	case err != nil:
+		return nil, daemonError(err, "unable to inspect existing image")
+	case p.pullPolicy == PullAlways:
+		log.Debugf("existing image=%q is pulled again (pull policy is always)", p.imageStr)
+		pull = true
+	case p.platform != nil && !p.platform.Matches(&v1.Platform{OS: inspectResult.Os, Architecture: inspectResult.Architecture}):
+		log.Debugf("existing image=%q is for platform=%s/%s, pulling platform=%s", p.imageStr, inspectResult.Os, inspectResult.Architecture, p.platform)
+		pull = true
+	}
 
-	if err != nil {
-		if client.IsErrNotFound(err) {
-			if err = p.pull(context.Background()); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, fmt.Errorf("unable to inspect existing image: %w", err)
+	if pull {
+		if err = p.pull(ctx); err != nil {
+			return nil, err
+		}
+		// the pulled image may differ from what the daemon had (e.g. new tags or another platform)
+		inspectResult, err = p.inspect(ctx, dockerClient)
+		if err != nil {
+			return nil, daemonError(err, "unable to inspect pulled image")
 		}
 	}
 
-	// save the image from the docker daemon to a tar file
-	estimateSaveProgress, copyProgress, stage, err := p.trackSaveProgress()
+	// save the image from the docker daemon (to a tar file, unless streaming)
+	tracker, err := p.trackSaveProgress(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to trace image save progress: %w", err)
 	}
 
-	stage.Current = "requesting image from docker"
-	readCloser, err := dockerClient.ImageSave(context.Background(), []string{p.imageStr})
+	origin := image.Origin{
+		Source:             p.source,
+		Location:           dockerClient.DaemonHost(),
+		AcquisitionStarted: acquisitionStarted,
+	}
+
+	if p.stream {
+		return p.provideStreamed(ctx, dockerClient, imageTempDir, tracker, inspectResult.RepoTags, origin)
+	}
+
+	// create a file within the temp dir
+	tempTarFile, err := os.Create(path.Join(imageTempDir, "image.tar"))
 	if err != nil {
-		return nil, fmt.Errorf("unable to save image tar: %w", err)
+		return nil, fmt.Errorf("unable to create temp file for image: %w", err)
 	}
 	defer func() {
-		err := readCloser.Close()
+		err := tempTarFile.Close()
 		if err != nil {
-			log.Errorf("unable to close temp file (%s): %w", tempTarFile.Name(), err)
+			log.Errorf("unable to close temp file (%s): %+v", tempTarFile.Name(), err)
 		}
 	}()
 
-	// cancel indeterminate progress
-	estimateSaveProgress.SetCompleted()
-
-	// save the image contents to the temp file
-	// note: this is the same image that will be used to querying image content during analysis
-	stage.Current = "saving image to disk"
-	nBytes, err := io.Copy(io.MultiWriter(tempTarFile, copyProgress), readCloser)
+	bytesRead := image.NewByteCounter()
+	nBytes, err := p.save(ctx, dockerClient, tempTarFile, tracker, bytesRead)
 	if err != nil {
-		return nil, fmt.Errorf("unable to save image to tar: %w", err)
+		return nil, daemonError(err, "unable to save image tar")
 	}
 	if nBytes == 0 {
 		return nil, fmt.Errorf("cannot provide an empty image")
 	}
 
 	// use the existing tarball provider to process what was pulled from the docker daemon
-	return NewProviderFromTarball(tempTarFile.Name(), p.tmpDirGen, inspectResult.RepoTags...).Provide()
+	tarballProvider := NewProviderFromTarball(tempTarFile.Name(), p.tmpDirGen, inspectResult.RepoTags...)
+	tarballProvider.origin = &origin
+	tarballProvider.bytesRead = bytesRead
+	return tarballProvider.Provide(ctx)
 }
 
-func newPullOptions(image string, cfg *configfile.ConfigFile) (types.ImagePullOptions, error) {
+func newPullOptions(image string, cfg *configfile.ConfigFile, credentials []registry.Credentials) (types.ImagePullOptions, error) {
 	var options types.ImagePullOptions
 
 	ref, err := name.ParseReference(image)
@@ -226,6 +461,12 @@ func newPullOptions(image string, cfg *configfile.ConfigFile) (types.ImagePullOp
 
 	hostname := ref.Context().RegistryStr()
 
+	if auth := credentialsAuth(credentials, hostname); auth != "" {
+		log.Debugf("using provided credentials for %q", hostname)
+		options.RegistryAuth = auth
+		return options, nil
+	}
+
 	creds, err := cfg.GetAuthConfig(hostname)
 	if err != nil {
 		return options, fmt.Errorf("failed to fetch registry auth (hostname=%s): %w", hostname, err)
@@ -242,3 +483,21 @@ func newPullOptions(image string, cfg *configfile.ConfigFile) (types.ImagePullOp
 
 	return options, nil
 }
+
+// isTransientDaemonError indicates if the given daemon client error may not recur (e.g. the daemon is busy or the
+// connection was reset).
+func isTransientDaemonError(err error) bool {
+	return errdefs.IsUnavailable(err) || image.IsTransientNetworkError(err)
+}
+
+// daemonError describes the given daemon client error, classifying an unreachable daemon (see
+// image.ErrDaemonUnavailable) and an unknown image (see image.ErrImageNotFound).
+func daemonError(err error, description string) error {
+	switch {
+	case client.IsErrConnectionFailed(err):
+		return image.NewProviderError(image.ErrDaemonUnavailable, description, err)
+	case client.IsErrNotFound(err):
+		return image.NewProviderError(image.ErrImageNotFound, description, err)
+	}
+	return fmt.Errorf("%s: %w", description, err)
+}
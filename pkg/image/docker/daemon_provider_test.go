@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/docker/docker/client"
+	"github.com/wagoodman/go-progress"
+)
+
+// flakyDaemon serves a docker archive for every image save request, where the first response is cut short.
+func flakyDaemon(t *testing.T, archive []byte) (*client.Client, *int) {
+	t.Helper()
+	var saves int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/images/get") {
+			http.NotFound(w, r)
+			return
+		}
+		saves++
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		if saves > 1 {
+			_, _ = w.Write(archive)
+			return
+		}
+		// the connection is dropped midway through the response
+		_, _ = w.Write(archive[:len(archive)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("could not hijack connection: %+v", err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+
+	dockerClient, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatalf("could not create client: %+v", err)
+	}
+	return dockerClient, &saves
+}
+
+func testSaveProgress() *saveProgress {
+	return &saveProgress{
+		estimate: progress.NewTimedProgress(time.Second),
+		copied:   progress.NewSizedWriter(-1),
+		stage:    &progress.Stage{},
+	}
+}
+
+func TestDaemonImageProvider_RetriedSave_CountsBytesOnce(t *testing.T) {
+	layer := testTar(t, tarEntry{name: "etc/hosts", contents: []byte(strings.Repeat("127.0.0.1\n", 100))})
+	config := fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:%x"]}}`, sha256.Sum256(layer))
+	archive := testTar(t,
+		tarEntry{name: "aaaa/layer.tar", contents: layer},
+		tarEntry{name: "config.json", contents: []byte(config)},
+		tarEntry{name: "manifest.json", contents: []byte(`[{"Config":"config.json","Layers":["aaaa/layer.tar"]}]`)},
+	)
+
+	provider := &DaemonImageProvider{
+		imageStr:   "example.com/flaky:latest",
+		daemonName: "docker",
+		retry:      image.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+	}
+
+	t.Run("save", func(t *testing.T) {
+		dockerClient, saves := flakyDaemon(t, archive)
+		f, err := ioutil.TempFile(spoolDir(t), "image.tar")
+		if err != nil {
+			t.Fatalf("could not create temp file: %+v", err)
+		}
+		defer f.Close()
+
+		bytesRead := image.NewByteCounter()
+		n, err := provider.save(context.Background(), dockerClient, f, testSaveProgress(), bytesRead)
+		if err != nil {
+			t.Fatalf("could not save image: %+v", err)
+		}
+		if *saves != 2 {
+			t.Fatalf("expected the save to be retried, got %d saves", *saves)
+		}
+		if n != int64(len(archive)) || bytesRead.BytesRead().Remote != int64(len(archive)) {
+			t.Errorf("expected only the successful attempt to be counted: written=%d read=%+v archive=%d", n, bytesRead.BytesRead(), len(archive))
+		}
+	})
+
+	t.Run("spool", func(t *testing.T) {
+		dockerClient, saves := flakyDaemon(t, archive)
+
+		bytesRead := image.NewByteCounter()
+		spooled, err := provider.spool(context.Background(), dockerClient, filepath.Join(spoolDir(t), "archive"), testSaveProgress(), bytesRead)
+		if err != nil {
+			t.Fatalf("could not spool image: %+v", err)
+		}
+		if *saves != 2 {
+			t.Fatalf("expected the save to be retried, got %d saves", *saves)
+		}
+		if bytesRead.BytesRead().Remote != int64(len(archive)) {
+			t.Errorf("expected only the successful attempt to be counted: read=%+v archive=%d", bytesRead.BytesRead(), len(archive))
+		}
+		if _, err := spooled.image(); err != nil {
+			t.Errorf("could not find image: %+v", err)
+		}
+	})
+}
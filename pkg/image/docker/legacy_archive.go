@@ -0,0 +1,262 @@
+package docker
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+const (
+	legacyRepositoriesFile = "repositories"
+	legacyLayerJSONFile    = "json"
+	legacyLayerTarFile     = "layer.tar"
+)
+
+// legacyRepositories is the "repositories" file within a Docker V1 image archive, a mapping of
+// repository -> tag -> top layer ID.
+type legacyRepositories map[string]map[string]string
+
+// legacyLayer is the "json" file for each layer directory within a Docker V1 image archive. Each layer json is a
+// complete image config as of that layer (with a reference to the parent layer).
+type legacyLayer struct {
+	ID              string    `json:"id"`
+	Parent          string    `json:"parent"`
+	Created         v1.Time   `json:"created"`
+	Author          string    `json:"author"`
+	Comment         string    `json:"comment"`
+	Container       string    `json:"container"`
+	DockerVersion   string    `json:"docker_version"`
+	Architecture    string    `json:"architecture"`
+	OS              string    `json:"os"`
+	Config          v1.Config `json:"config"`
+	ContainerConfig struct {
+		Cmd []string `json:"Cmd"`
+	} `json:"container_config"`
+}
+
+// isLegacyArchive indicates if the given tar is a Docker V1 image archive (no manifest.json, but with a repositories file).
+func isLegacyArchive(tarPath string) (bool, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var hasManifest, hasRepositories bool
+	err = file.TarIterator(f, func(header *tar.Header, _ io.Reader) error {
+		switch header.Name {
+		case "manifest.json":
+			hasManifest = true
+			return file.ErrTarStopIteration
+		case legacyRepositoriesFile:
+			hasRepositories = true
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return hasRepositories && !hasManifest, nil
+}
+
+// legacyImageFromPath synthesizes a v1.Image (with a modern manifest and config) from a Docker V1 image archive, also
+// returning all tags that refer to the image.
+func legacyImageFromPath(tarPath string) (v1.Image, []string, error) {
+	repositories, err := extractLegacyRepositories(tarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	topLayerID, tags, err := repositories.image()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layers, err := extractLegacyLayers(tarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain, err := legacyLayerChain(layers, topLayerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var additions []mutate.Addendum
+	for _, layer := range chain {
+		v1Layer, err := tarball.LayerFromOpener(legacyLayerOpener(tarPath, path.Join(layer.ID, legacyLayerTarFile)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read legacy layer=%q: %w", layer.ID, err)
+		}
+		additions = append(additions, mutate.Addendum{
+			Layer: v1Layer,
+			History: v1.History{
+				Author:    layer.Author,
+				Created:   layer.Created,
+				CreatedBy: strings.Join(layer.ContainerConfig.Cmd, " "),
+				Comment:   layer.Comment,
+			},
+		})
+	}
+
+	img, err := mutate.Append(empty.Image, additions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to assemble legacy image: %w", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to assemble legacy image config: %w", err)
+	}
+
+	// the top layer json describes the image as a whole
+	top := chain[len(chain)-1]
+	cfg.Architecture = top.Architecture
+	cfg.OS = top.OS
+	cfg.Author = top.Author
+	cfg.Created = top.Created
+	cfg.Container = top.Container
+	cfg.DockerVersion = top.DockerVersion
+	cfg.Config = top.Config
+
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to assemble legacy image config: %w", err)
+	}
+
+	return img, tags, nil
+}
+
+// image returns the single top layer ID referenced by all repositories (and all tags referring to it).
+func (r legacyRepositories) image() (string, []string, error) {
+	var topLayerID string
+	var tags []string
+	for repo, repoTags := range r {
+		for tag, id := range repoTags {
+			if topLayerID != "" && topLayerID != id {
+				return "", nil, ErrMultipleManifests
+			}
+			topLayerID = id
+			tags = append(tags, fmt.Sprintf("%s:%s", repo, tag))
+		}
+	}
+	if topLayerID == "" {
+		return "", nil, fmt.Errorf("%w: no images found within legacy repositories file", image.ErrManifestInvalid)
+	}
+	sort.Strings(tags)
+	return topLayerID, tags, nil
+}
+
+// extractLegacyRepositories reads and parses the repositories file from a Docker V1 image archive.
+func extractLegacyRepositories(tarPath string) (legacyRepositories, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := file.ReaderFromTar(f, legacyRepositoriesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read legacy repositories file: %w", err)
+	}
+
+	var repositories legacyRepositories
+	if err := json.Unmarshal(contents, &repositories); err != nil {
+		return nil, image.NewProviderError(image.ErrManifestInvalid, "unable to parse legacy repositories file", err)
+	}
+	return repositories, nil
+}
+
+// extractLegacyLayers reads and parses all layer json files from a Docker V1 image archive (keyed by layer ID).
+func extractLegacyLayers(tarPath string) (map[string]legacyLayer, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var layers = make(map[string]legacyLayer)
+	err = file.TarIterator(f, func(header *tar.Header, reader io.Reader) error {
+		dir, name := path.Split(header.Name)
+		if name != legacyLayerJSONFile || strings.Count(dir, "/") != 1 {
+			return nil
+		}
+
+		contents, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		var layer legacyLayer
+		if err := json.Unmarshal(contents, &layer); err != nil {
+			return fmt.Errorf("unable to parse legacy layer json: %w", err)
+		}
+		if layer.ID == "" {
+			layer.ID = strings.TrimSuffix(dir, "/")
+		}
+		layers[layer.ID] = layer
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// legacyLayerChain returns all layers from the base layer to the given top layer (following parent references).
+func legacyLayerChain(layers map[string]legacyLayer, topLayerID string) ([]legacyLayer, error) {
+	var chain []legacyLayer
+	var visited = make(map[string]bool)
+	for id := topLayerID; id != ""; {
+		if visited[id] {
+			return nil, fmt.Errorf("legacy layer chain has a cycle (layer=%q)", id)
+		}
+		visited[id] = true
+
+		layer, ok := layers[id]
+		if !ok {
+			return nil, fmt.Errorf("legacy layer json not found (layer=%q)", id)
+		}
+		chain = append([]legacyLayer{layer}, chain...)
+		id = layer.Parent
+	}
+	return chain, nil
+}
+
+// legacyLayerOpener provides the layer tar for the given path within a Docker V1 image archive.
+func legacyLayerOpener(tarPath, layerPath string) tarball.Opener {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(tarPath)
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := file.ReaderFromTar(f, layerPath)
+		if err != nil {
+			if closeErr := f.Close(); closeErr != nil {
+				log.Errorf("unable to close tar file (%s): %+v", f.Name(), closeErr)
+			}
+			return nil, err
+		}
+		return reader, nil
+	}
+}
@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+)
+
+type tarEntry struct {
+	name     string
+	contents []byte
+}
+
+func testTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.name,
+			Size:     int64(len(entry.contents)),
+			Mode:     0o644,
+		}); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+		if _, err := tw.Write(entry.contents); err != nil {
+			t.Fatalf("could not write contents: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+func legacyArchive(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stereoscope-legacy-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	archivePath := filepath.Join(dir, "legacy.tar")
+	archive := testTar(t,
+		tarEntry{name: "repositories", contents: []byte(`{"busybox":{"latest":"bbbb","1.0":"bbbb"}}`)},
+		tarEntry{name: "aaaa/VERSION", contents: []byte("1.0")},
+		tarEntry{name: "aaaa/json", contents: []byte(`{"id":"aaaa","created":"2015-01-01T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file:1234 in /"]},"architecture":"amd64","os":"linux"}`)},
+		tarEntry{name: "aaaa/layer.tar", contents: testTar(t,
+			tarEntry{name: "bin/busybox", contents: []byte("busybox!")},
+			tarEntry{name: "etc/passwd", contents: []byte("root")},
+		)},
+		tarEntry{name: "bbbb/VERSION", contents: []byte("1.0")},
+		tarEntry{name: "bbbb/json", contents: []byte(`{"id":"bbbb","parent":"aaaa","created":"2015-01-02T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) CMD [\"sh\"]"]},"config":{"Cmd":["sh"]},"architecture":"amd64","os":"linux","docker_version":"1.4.1"}`)},
+		tarEntry{name: "bbbb/layer.tar", contents: testTar(t,
+			tarEntry{name: "etc/passwd", contents: []byte("root,user")},
+		)},
+	)
+	if err := ioutil.WriteFile(archivePath, archive, 0o644); err != nil {
+		t.Fatalf("could not write archive: %+v", err)
+	}
+	return archivePath
+}
+
+func TestTarballImageProvider_LegacyArchive(t *testing.T) {
+	archivePath := legacyArchive(t)
+
+	legacy, err := isLegacyArchive(archivePath)
+	if err != nil {
+		t.Fatalf("could not detect legacy archive: %+v", err)
+	}
+	if !legacy {
+		t.Fatalf("expected a legacy archive")
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	img, err := NewProviderFromTarball(archivePath, &tmpDirGen).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if len(img.Layers) != 2 {
+		t.Fatalf("unexpected number of layers: %d", len(img.Layers))
+	}
+
+	var tags []string
+	for _, tag := range img.Metadata.Tags {
+		tags = append(tags, tag.String())
+	}
+	for _, d := range deep.Equal([]string{"busybox:1.0", "busybox:latest"}, tags) {
+		t.Errorf("tag diff: %+v", d)
+	}
+
+	cfg := img.Metadata.Config
+	if cfg.Architecture != "amd64" || cfg.OS != "linux" || cfg.DockerVersion != "1.4.1" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	for _, d := range deep.Equal([]string{"sh"}, cfg.Config.Cmd) {
+		t.Errorf("cmd diff: %+v", d)
+	}
+	if len(cfg.History) != 2 || cfg.History[0].CreatedBy != "/bin/sh -c #(nop) ADD file:1234 in /" {
+		t.Errorf("unexpected history: %+v", cfg.History)
+	}
+	if img.Metadata.Origin.Source != image.DockerTarballSource || img.Metadata.Origin.Location != archivePath {
+		t.Errorf("unexpected origin: %+v", img.Metadata.Origin)
+	}
+	if img.Metadata.ManifestDigest == "" {
+		t.Errorf("expected a synthesized manifest")
+	}
+
+	reader, err := img.FileContentsFromSquash("/etc/passwd")
+	if err != nil {
+		t.Fatalf("could not get file contents: %+v", err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(contents) != "root,user" {
+		t.Errorf("unexpected contents: %q", string(contents))
+	}
+	if !img.SquashedTree().HasPath("/bin/busybox") {
+		t.Errorf("expected base layer file in squash")
+	}
+}
+
+func TestLegacyLayerChain(t *testing.T) {
+	layers := map[string]legacyLayer{
+		"a": {ID: "a"},
+		"b": {ID: "b", Parent: "a"},
+		"c": {ID: "c", Parent: "b"},
+		"x": {ID: "x", Parent: "y"},
+		"y": {ID: "y", Parent: "x"},
+	}
+
+	chain, err := legacyLayerChain(layers, "c")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	var ids []string
+	for _, layer := range chain {
+		ids = append(ids, layer.ID)
+	}
+	for _, d := range deep.Equal([]string{"a", "b", "c"}, ids) {
+		t.Errorf("chain diff: %+v", d)
+	}
+
+	if _, err := legacyLayerChain(layers, "x"); err == nil {
+		t.Errorf("expected an error for a cyclic chain")
+	}
+	if _, err := legacyLayerChain(layers, "missing"); err == nil {
+		t.Errorf("expected an error for a missing layer")
+	}
+}
@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/docker"
+	"github.com/anchore/stereoscope/internal/podman"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// untaggedRepoTag is reported by the docker daemon for images without any tags.
+const untaggedRepoTag = "<none>:<none>"
+
+// ListDaemonImages lists all (top-level) images available from the docker daemon.
+func ListDaemonImages(ctx context.Context) ([]image.ListedImage, error) {
+	return listDaemonImages(ctx, "docker", docker.GetClient)
+}
+
+// ListDaemonImagesWithOptions lists all (top-level) images available from the docker daemon selected by the given
+// options (see DaemonOptions).
+func ListDaemonImagesWithOptions(ctx context.Context, options DaemonOptions) ([]image.ListedImage, error) {
+	getClient := options.getClient()
+	if getClient == nil {
+		getClient = docker.GetClient
+	}
+	return listDaemonImages(ctx, "docker", getClient)
+}
+
+// ListPodmanImages lists all (top-level) images available from the podman API (rootful or rootless).
+func ListPodmanImages(ctx context.Context) ([]image.ListedImage, error) {
+	return listDaemonImages(ctx, "podman", podman.GetClient)
+}
+
+func listDaemonImages(ctx context.Context, daemonName string, getClient func() (*client.Client, error)) ([]image.ListedImage, error) {
+	daemonClient, err := getClient()
+	if err != nil {
+		return nil, image.NewProviderError(image.ErrDaemonUnavailable, fmt.Sprintf("unable to get %s client", daemonName), err)
+	}
+
+	summaries, err := daemonClient.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, daemonError(err, fmt.Sprintf("unable to list %s images", daemonName))
+	}
+
+	images := make([]image.ListedImage, len(summaries))
+	for idx, summary := range summaries {
+		images[idx] = image.ListedImage{
+			ID: summary.ID,
+		}
+		for _, tag := range summary.RepoTags {
+			if tag != untaggedRepoTag {
+				images[idx].Tags = append(images[idx].Tags, tag)
+			}
+		}
+		// note: repo digests are in the form "repository@digest", all referring to the same manifest
+		for _, repoDigest := range summary.RepoDigests {
+			if fields := strings.SplitN(repoDigest, "@", 2); len(fields) == 2 {
+				images[idx].ManifestDigest = fields[1]
+				break
+			}
+		}
+	}
+	return images, nil
+}
+
+// ListTarballImages lists all images within the docker image archive at the given path (including older V1 archives).
+func ListTarballImages(tarPath string) ([]image.ListedImage, error) {
+	manifest, err := extractManifest(tarPath)
+	if err != nil {
+		if legacy, legacyErr := isLegacyArchive(tarPath); legacyErr == nil && legacy {
+			return listLegacyTarballImages(tarPath)
+		}
+		return nil, fmt.Errorf("unable to list images from tarball: %w", err)
+	}
+
+	images := make([]image.ListedImage, len(manifest.parsed))
+	for idx, entry := range manifest.parsed {
+		images[idx] = image.ListedImage{
+			ID:   configID(entry.Config),
+			Tags: entry.RepoTags,
+		}
+	}
+	return images, nil
+}
+
+// listLegacyTarballImages lists all images within a Docker V1 image archive (one for each distinct top layer).
+func listLegacyTarballImages(tarPath string) ([]image.ListedImage, error) {
+	repositories, err := extractLegacyRepositories(tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagsByTopLayer = make(map[string][]string)
+	for repo, repoTags := range repositories {
+		for tag, id := range repoTags {
+			tagsByTopLayer[id] = append(tagsByTopLayer[id], fmt.Sprintf("%s:%s", repo, tag))
+		}
+	}
+
+	var images []image.ListedImage
+	for _, tags := range tagsByTopLayer {
+		sort.Strings(tags)
+		images = append(images, image.ListedImage{
+			Tags: tags,
+		})
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Tags[0] < images[j].Tags[0]
+	})
+	return images, nil
+}
+
+// configID derives the image ID from the config path within a docker image archive, which is named after the digest of
+// the config (e.g. "<hex>.json" or "blobs/sha256/<hex>"). An empty string is returned if there is no such digest.
+func configID(configPath string) string {
+	hex := strings.TrimSuffix(path.Base(configPath), ".json")
+	if len(hex) != 64 {
+		return ""
+	}
+	return "sha256:" + hex
+}
@@ -0,0 +1,21 @@
+package docker
+
+import (
+	"testing"
+)
+
+func TestConfigID(t *testing.T) {
+	hex := "a24bb4013296f61e89ba57005a7b3e52274d8edd3ae2077d04395f806b63d83e"
+	tests := map[string]string{
+		hex + ".json":              "sha256:" + hex,
+		"blobs/sha256/" + hex:      "sha256:" + hex,
+		"config.json":              "",
+		"blobs/sha256/" + hex[:12]: "",
+	}
+
+	for input, expected := range tests {
+		if actual := configID(input); actual != expected {
+			t.Errorf("unexpected ID for %q: %q != %q", input, actual, expected)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -23,11 +24,11 @@ type dockerManifest struct {
 func newManifest(raw []byte) (*dockerManifest, error) {
 	var parsed tarball.Manifest
 	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return nil, fmt.Errorf("unable to parse manifest.json: %w", err)
+		return nil, image.NewProviderError(image.ErrManifestInvalid, "unable to parse manifest.json", err)
 	}
 
 	if len(parsed) == 0 {
-		return nil, fmt.Errorf("no valid manifest.json found")
+		return nil, fmt.Errorf("%w: no valid manifest.json found", image.ErrManifestInvalid)
 	}
 
 	return &dockerManifest{
@@ -53,7 +54,7 @@ func extractManifest(tarPath string) (*dockerManifest, error) {
 	defer func() {
 		err := f.Close()
 		if err != nil {
-			log.Errorf("unable to close tar file (%s): %w", f.Name(), err)
+			log.Errorf("unable to close tar file (%s): %+v", f.Name(), err)
 		}
 	}()
 
@@ -79,7 +80,7 @@ func generateOCIManifest(tarPath string, manifest *dockerManifest) (*v1.Manifest
 	defer func() {
 		err := f.Close()
 		if err != nil {
-			log.Errorf("unable to close tar file (%s): %w", f.Name(), err)
+			log.Errorf("unable to close tar file (%s): %+v", f.Name(), err)
 		}
 	}()
 
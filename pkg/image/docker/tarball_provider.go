@@ -1,25 +1,34 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/anchore/stereoscope/pkg/file"
 
 	"github.com/anchore/stereoscope/internal"
+	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/image"
-	"github.com/apex/log"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
 var ErrMultipleManifests = fmt.Errorf("cannot process multiple docker manifests")
 
-// TarballImageProvider is a image.Provider for a docker image (V2) for an existing tar on disk (the output from a "docker image save ..." command).
+// TarballImageProvider is a image.Provider for a docker image (V2, or legacy V1) for an existing tar on disk (the output from a "docker image save ..." command).
 type TarballImageProvider struct {
 	path      string
 	extraTags []string
 	tmpDirGen *file.TempDirGenerator
+	// origin overrides where the image is reported to be from (when another provider delegates to this one)
+	origin *image.Origin
+	// bytesRead are the bytes already read to obtain the tarball (when another provider delegates to this one)
+	bytesRead *image.ByteCounter
 }
 
 // NewProviderFromTarball creates a new provider instance for the specific image already at the given path.
@@ -32,14 +41,28 @@ func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator, tags
 }
 
 // Provide an image object that represents the docker image tar at the configured location on disk.
-func (p *TarballImageProvider) Provide() (*image.Image, error) {
+func (p *TarballImageProvider) Provide(_ context.Context) (*image.Image, error) {
+	origin := p.newOrigin()
+
 	img, err := tarball.ImageFromPath(p.path, nil)
 	if err != nil {
+		// older "docker save" archives (V1) have no manifest.json, but can still be processed
+		if legacy, legacyErr := isLegacyArchive(p.path); legacyErr == nil && legacy {
+			return p.provideLegacy(origin)
+		}
 		// raise a more controlled error for when there are multiple images within the given tar (from https://github.com/anchore/grype/issues/215)
 		if err.Error() == "tarball must contain only a single image to be used with tarball.Image" {
 			return nil, ErrMultipleManifests
 		}
-		return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
+		if _, statErr := os.Stat(p.path); os.IsNotExist(statErr) {
+			return nil, fmt.Errorf("%w: no tarball at path=%q", image.ErrImageNotFound, p.path)
+		}
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			// the tarball could not be read (e.g. permission denied), which says nothing about the manifest
+			return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
+		}
+		return nil, image.NewProviderError(image.ErrManifestInvalid, "unable to provide image from tarball", err)
 	}
 
 	// make a best-effort to generate an OCI manifest and gets tags, but ultimately this should be considered optional
@@ -94,5 +117,74 @@ func (p *TarballImageProvider) Provide() (*image.Image, error) {
 		return nil, err
 	}
 
+	origin.AcquisitionCompleted = time.Now()
+	metadata = append(metadata, image.WithOrigin(origin))
+	if p.bytesRead != nil {
+		metadata = append(metadata, image.WithByteCounter(p.bytesRead))
+	}
+
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
+
+// provideLegacy provides an image object for a Docker V1 image archive (with a synthesized manifest and config).
+func (p *TarballImageProvider) provideLegacy(origin image.Origin) (*image.Image, error) {
+	img, legacyTags, err := legacyImageFromPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from legacy tarball: %w", err)
+	}
+
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate manifest for legacy tarball: %w", err)
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate config for legacy tarball: %w", err)
+	}
+
+	var tags = internal.NewStringSet()
+	for _, t := range append(p.extraTags, legacyTags...) {
+		tags.Add(t)
+	}
+
+	metadata := []image.AdditionalMetadata{
+		image.WithManifest(rawManifest),
+		image.WithConfig(rawConfig),
+	}
+
+	if len(tags) > 0 {
+		metadata = append(metadata, image.WithTags(tags.ToSlice()...))
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	origin.AcquisitionCompleted = time.Now()
+	metadata = append(metadata, image.WithOrigin(origin))
+	if p.bytesRead != nil {
+		metadata = append(metadata, image.WithByteCounter(p.bytesRead))
+	}
+
+	return image.NewImage(img, contentTempDir, metadata...), nil
+}
+
+// newOrigin describes where the image is being obtained from, starting from now.
+func (p *TarballImageProvider) newOrigin() image.Origin {
+	if p.origin != nil {
+		return *p.origin
+	}
+
+	location, err := filepath.Abs(p.path)
+	if err != nil {
+		location = p.path
+	}
+
+	return image.Origin{
+		Source:             image.DockerTarballSource,
+		Location:           location,
+		AcquisitionStarted: time.Now(),
+	}
+}
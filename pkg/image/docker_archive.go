@@ -0,0 +1,55 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// untaggedArchiveRepository names the reference for an image without tags when writing a docker archive (only tags
+// are recorded within the archive, so this name does not appear in the archive).
+const untaggedArchiveRepository = "untagged"
+
+// WriteDockerArchive writes the image as a docker archive tarball (as from "docker save") to the given path, regardless
+// of the source the image was obtained from. The archive contains the config, each layer blob in manifest order, and a
+// manifest.json that records all tags of the image (no repo tags for an untagged image), so it may be loaded with
+// "docker load" or provided again as a docker archive.
+func (i *Image) WriteDockerArchive(path string) error {
+	if i.image == nil {
+		return fmt.Errorf("unable to write docker archive: no image")
+	}
+
+	refs, err := i.dockerArchiveRefs()
+	if err != nil {
+		return err
+	}
+
+	if err := tarball.MultiRefWriteToFile(path, refs); err != nil {
+		return fmt.Errorf("unable to write docker archive=%q: %w", path, err)
+	}
+	return nil
+}
+
+// dockerArchiveRefs returns the references to record for the image within a docker archive.
+func (i *Image) dockerArchiveRefs() (map[name.Reference]v1.Image, error) {
+	var refs = make(map[name.Reference]v1.Image)
+	for _, tag := range i.Metadata.Tags {
+		refs[tag] = i.image
+	}
+	if len(refs) > 0 {
+		return refs, nil
+	}
+
+	digest, err := i.image.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get image digest: %w", err)
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s@%s", untaggedArchiveRepository, digest))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create image reference: %w", err)
+	}
+	refs[ref] = i.image
+	return refs, nil
+}
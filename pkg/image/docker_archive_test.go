@@ -0,0 +1,140 @@
+package image
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestImage_WriteDockerArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		loadWith string
+	}{
+		{
+			name: "untagged",
+		},
+		{
+			name:     "tagged",
+			tags:     []string{"example.com/some/image:latest", "example.com/some/image:v1"},
+			loadWith: "example.com/some/image:v1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := linkedImage(t)
+			for _, tagStr := range test.tags {
+				tag, err := name.NewTag(tagStr)
+				if err != nil {
+					t.Fatalf("could not parse tag: %+v", err)
+				}
+				img.Metadata.Tags = append(img.Metadata.Tags, tag)
+			}
+			archivePath := filepath.Join(testTempDir(t), "image.tar")
+
+			if err := img.WriteDockerArchive(archivePath); err != nil {
+				t.Fatalf("could not write docker archive: %+v", err)
+			}
+
+			manifest := readArchiveManifest(t, archivePath)
+			if len(manifest) != 1 {
+				t.Fatalf("unexpected number of archive manifests: %d", len(manifest))
+			}
+			var actualTags = make(map[string]bool)
+			for _, tag := range manifest[0].RepoTags {
+				actualTags[tag] = true
+			}
+			if len(actualTags) != len(test.tags) {
+				t.Errorf("unexpected repo tags: %+v", manifest[0].RepoTags)
+			}
+			for _, tag := range test.tags {
+				if !actualTags[tag] {
+					t.Errorf("missing repo tag=%q: %+v", tag, manifest[0].RepoTags)
+				}
+			}
+
+			// the image read back from the archive has the same config and layers (in the same order)
+			var loadTag *name.Tag
+			if test.loadWith != "" {
+				tag, err := name.NewTag(test.loadWith)
+				if err != nil {
+					t.Fatalf("could not parse tag: %+v", err)
+				}
+				loadTag = &tag
+			}
+			v1Img, err := tarball.ImageFromPath(archivePath, loadTag)
+			if err != nil {
+				t.Fatalf("could not read archive: %+v", err)
+			}
+
+			expectedConfig, err := img.image.ConfigName()
+			if err != nil {
+				t.Fatalf("could not get config digest: %+v", err)
+			}
+			actualConfig, err := v1Img.ConfigName()
+			if err != nil {
+				t.Fatalf("could not get config digest: %+v", err)
+			}
+			if actualConfig != expectedConfig {
+				t.Errorf("unexpected config: %q != %q", actualConfig, expectedConfig)
+			}
+
+			roundTrip := NewImage(v1Img, testTempDir(t))
+			if err := roundTrip.Read(); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+			if len(roundTrip.Layers) != len(img.Layers) {
+				t.Fatalf("unexpected number of layers: %d", len(roundTrip.Layers))
+			}
+			for idx, layer := range roundTrip.Layers {
+				if layer.Metadata.Digest != img.Layers[idx].Metadata.Digest {
+					t.Errorf("unexpected layer=%d: %q != %q", idx, layer.Metadata.Digest, img.Layers[idx].Metadata.Digest)
+				}
+			}
+			reader, err := roundTrip.FileContentsFromSquash("/etc/config.txt")
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			assertContents(t, reader, "opt/app/config.txt")
+		})
+	}
+}
+
+// readArchiveManifest returns the manifest.json within the given docker archive.
+func readArchiveManifest(t *testing.T, archivePath string) tarball.Manifest {
+	t.Helper()
+	fh, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("could not open archive: %+v", err)
+	}
+	defer fh.Close()
+
+	reader := tar.NewReader(fh)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read archive: %+v", err)
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+		var manifest tarball.Manifest
+		if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+			t.Fatalf("could not decode archive manifest: %+v", err)
+		}
+		return manifest
+	}
+	t.Fatalf("no manifest within archive")
+	return nil
+}
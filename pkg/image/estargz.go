@@ -0,0 +1,388 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	// estargzFooterSize is the size of the footer of an eStargz blob (a gzip member with the TOC offset within the
+	// extra field, as a "SG" subfield), which is the most that is fetched to find the footer (the footers of legacy
+	// stargz blobs are shorter, as the extra field is not a subfield).
+	estargzFooterSize = 51
+	// estargzTOCName is the name of the tar entry holding the table of contents.
+	estargzTOCName = "stargz.index.json"
+	// estargzTOCMaxSize bounds the (compressed) size of the table of contents that is fetched.
+	estargzTOCMaxSize = 64 * 1024 * 1024
+)
+
+// gzipMagic is the start of each gzip member header.
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// errNotEstargz indicates that a layer blob is not a (seekable) eStargz blob.
+var errNotEstargz = errors.New("layer blob is not eStargz")
+
+// BlobRangeFetcher fetches (at most) size bytes of a compressed layer blob starting at the given offset (e.g. with an
+// HTTP range request against the registry).
+type BlobRangeFetcher func(ctx context.Context, offset, size int64) (io.ReadCloser, error)
+
+// BlobRangeFetcherFn returns the BlobRangeFetcher for the given layer (nil when ranges of the blob cannot be fetched).
+type BlobRangeFetcherFn func(layer v1.Layer) BlobRangeFetcher
+
+// WithBlobRangeFetcher indicates that ranges of the layer blobs can be fetched with the given fetchers, which allows
+// for reading seekable layers without fetching entire blobs (see WithSeekableLayers).
+func WithBlobRangeFetcher(fn BlobRangeFetcherFn) AdditionalMetadata {
+	return func(image *Image) error {
+		image.blobRangeFetcher = fn
+		return nil
+	}
+}
+
+// estargzTOC is the table of contents of an eStargz blob.
+type estargzTOC struct {
+	Version int            `json:"version"`
+	Entries []estargzEntry `json:"entries"`
+}
+
+// estargzEntry is a single entry within the table of contents of an eStargz blob. Regular files with large contents
+// are followed by additional "chunk" entries for the same name.
+type estargzEntry struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Size        int64             `json:"size,omitempty"`
+	ModTime3339 string            `json:"modtime,omitempty"`
+	LinkName    string            `json:"linkName,omitempty"`
+	Mode        int64             `json:"mode,omitempty"`
+	UID         int               `json:"uid,omitempty"`
+	GID         int               `json:"gid,omitempty"`
+	Uname       string            `json:"userName,omitempty"`
+	Gname       string            `json:"groupName,omitempty"`
+	Offset      int64             `json:"offset,omitempty"`
+	DevMajor    int64             `json:"devMajor,omitempty"`
+	DevMinor    int64             `json:"devMinor,omitempty"`
+	Xattrs      map[string][]byte `json:"xattrs,omitempty"`
+	Digest      string            `json:"digest,omitempty"`
+	ChunkOffset int64             `json:"chunkOffset,omitempty"`
+	ChunkSize   int64             `json:"chunkSize,omitempty"`
+}
+
+// estargzChunk is the location of a single chunk of file contents within an eStargz blob, where the chunk contents
+// are at the start of the gzip member at the given offset.
+type estargzChunk struct {
+	// offset is where the gzip member holding the chunk starts within the blob.
+	offset int64
+	// end is where the next gzip member holding file contents (or the table of contents) starts within the blob.
+	end int64
+	// size is the number of uncompressed bytes within the chunk.
+	size int64
+}
+
+// estargzLayer provides the entries and file contents of an eStargz layer blob by fetching ranges of the blob.
+type estargzLayer struct {
+	fetch  BlobRangeFetcher
+	toc    *estargzTOC
+	chunks map[string][]estargzChunk
+}
+
+// estargzTarTypes maps the entry types of the table of contents to tar entry types.
+var estargzTarTypes = map[string]byte{
+	"dir":      tar.TypeDir,
+	"reg":      tar.TypeReg,
+	"symlink":  tar.TypeSymlink,
+	"hardlink": tar.TypeLink,
+	"char":     tar.TypeChar,
+	"block":    tar.TypeBlock,
+	"fifo":     tar.TypeFifo,
+}
+
+// openEstargz reads the footer and the table of contents of the given blob (of the given compressed size), returning
+// errNotEstargz if the blob is not eStargz.
+func openEstargz(ctx context.Context, fetch BlobRangeFetcher, blobSize int64) (*estargzLayer, error) {
+	if blobSize < estargzFooterSize {
+		return nil, errNotEstargz
+	}
+
+	footer, err := fetchRange(ctx, fetch, blobSize-estargzFooterSize, estargzFooterSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch eStargz footer: %w", err)
+	}
+
+	// the footer is the last gzip member of the blob, which may be shorter than expected depending on the encoder (and is
+	// shorter for legacy stargz blobs), so every gzip header within the fetched range is a candidate
+	var footerSize, tocOffset int64
+	err = errNotEstargz
+	for idx := 0; idx < len(footer) && err != nil; idx++ {
+		if !bytes.HasPrefix(footer[idx:], gzipMagic) {
+			continue
+		}
+		footerSize = int64(len(footer) - idx)
+		tocOffset, err = parseEstargzFooter(footer[idx:])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tocSize := blobSize - footerSize - tocOffset
+	if tocOffset <= 0 || tocSize <= 0 || tocSize > estargzTOCMaxSize {
+		return nil, fmt.Errorf("%w: invalid TOC offset=%d", errNotEstargz, tocOffset)
+	}
+
+	rawTOC, err := fetchRange(ctx, fetch, tocOffset, tocSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch eStargz TOC: %w", err)
+	}
+
+	toc, err := parseEstargzTOC(rawTOC)
+	if err != nil {
+		return nil, err
+	}
+
+	return &estargzLayer{
+		fetch:  fetch,
+		toc:    toc,
+		chunks: estargzChunks(toc, tocOffset),
+	}, nil
+}
+
+// parseEstargzFooter returns the offset of the table of contents from the given (eStargz or legacy stargz) footer.
+func parseEstargzFooter(footer []byte) (int64, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(footer))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errNotEstargz, err)
+	}
+	defer zr.Close()
+
+	extra := zr.Header.Extra
+	// eStargz footers hold the payload within a "SG" subfield, legacy stargz footers hold the payload directly
+	if len(extra) == 26 && extra[0] == 'S' && extra[1] == 'G' && int(extra[2])|int(extra[3])<<8 == 22 {
+		extra = extra[4:]
+	}
+	if len(extra) != 22 || !strings.HasSuffix(string(extra), "STARGZ") {
+		return 0, errNotEstargz
+	}
+
+	tocOffset, err := strconv.ParseInt(string(extra[:16]), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid TOC offset: %v", errNotEstargz, err)
+	}
+	return tocOffset, nil
+}
+
+// parseEstargzTOC reads the table of contents from the given gzip member (holding a tar with a single TOC entry).
+func parseEstargzTOC(rawTOC []byte) (*estargzTOC, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(rawTOC))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read eStargz TOC: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read eStargz TOC: %w", err)
+	}
+	if header.Name != estargzTOCName {
+		return nil, fmt.Errorf("unexpected eStargz TOC entry=%q", header.Name)
+	}
+
+	var toc estargzTOC
+	if err := json.NewDecoder(tr).Decode(&toc); err != nil {
+		return nil, fmt.Errorf("unable to decode eStargz TOC: %w", err)
+	}
+	return &toc, nil
+}
+
+// estargzChunks locates the contents of each regular file within the blob. The compressed extent of each chunk ends
+// where the next gzip member holding file contents starts (or where the table of contents starts).
+func estargzChunks(toc *estargzTOC, tocOffset int64) map[string][]estargzChunk {
+	var offsets []int64
+	for _, entry := range toc.Entries {
+		if (entry.Type == "reg" || entry.Type == "chunk") && entry.Offset > 0 {
+			offsets = append(offsets, entry.Offset)
+		}
+	}
+	offsets = append(offsets, tocOffset)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	nextOffset := func(offset int64) int64 {
+		idx := sort.Search(len(offsets), func(i int) bool { return offsets[i] > offset })
+		if idx == len(offsets) {
+			return tocOffset
+		}
+		return offsets[idx]
+	}
+
+	chunks := make(map[string][]estargzChunk)
+	sizes := make(map[string]int64)
+	for _, entry := range toc.Entries {
+		switch entry.Type {
+		case "reg":
+			sizes[entry.Name] = entry.Size
+			// a regular file without a chunk size is a single chunk with all of the contents
+			if entry.Size == 0 {
+				chunks[entry.Name] = nil
+				continue
+			}
+		case "chunk":
+		default:
+			continue
+		}
+
+		size := entry.ChunkSize
+		if size == 0 {
+			size = sizes[entry.Name] - entry.ChunkOffset
+		}
+		chunks[entry.Name] = append(chunks[entry.Name], estargzChunk{
+			offset: entry.Offset,
+			end:    nextOffset(entry.Offset),
+			size:   size,
+		})
+	}
+	return chunks
+}
+
+// metadata returns the file metadata for every entry within the table of contents (in TOC order).
+func (e *estargzLayer) metadata() []file.Metadata {
+	var entries []file.Metadata
+	var sequence int64
+	for _, entry := range e.toc.Entries {
+		typeFlag, ok := estargzTarTypes[entry.Type]
+		if !ok {
+			continue
+		}
+
+		header := &tar.Header{
+			Name:     entry.Name,
+			Typeflag: typeFlag,
+			Linkname: entry.LinkName,
+			Size:     entry.Size,
+			Mode:     entry.Mode,
+			Uid:      entry.UID,
+			Gid:      entry.GID,
+			Uname:    entry.Uname,
+			Gname:    entry.Gname,
+			Devmajor: entry.DevMajor,
+			Devminor: entry.DevMinor,
+		}
+		if modTime, err := time.Parse(time.RFC3339, entry.ModTime3339); err == nil {
+			header.ModTime = modTime
+		}
+		if len(entry.Xattrs) > 0 {
+			header.PAXRecords = make(map[string]string)
+			for key, value := range entry.Xattrs {
+				header.PAXRecords["SCHILY.xattr."+key] = string(value)
+			}
+		}
+		if typeFlag != tar.TypeReg {
+			header.Size = 0
+		}
+
+		entries = append(entries, file.MetadataFromTarHeader(header, sequence))
+		sequence++
+	}
+	return entries
+}
+
+// open provides the contents of the regular file with the given name (as found within the table of contents), where
+// each chunk is only fetched once the previous chunk has been read.
+func (e *estargzLayer) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	chunks, ok := e.chunks[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: path=%q not found within eStargz TOC", ErrFileNotFound, name)
+	}
+	return &estargzContentsReader{ctx: ctx, fetch: e.fetch, chunks: chunks}, nil
+}
+
+// estargzContentsReader reads all chunks of a single file in order.
+type estargzContentsReader struct {
+	ctx     context.Context
+	fetch   BlobRangeFetcher
+	chunks  []estargzChunk
+	current io.Reader
+	closers []io.Closer
+}
+
+func (r *estargzContentsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// next fetches the next chunk and positions the reader at the start of the chunk contents.
+func (r *estargzContentsReader) next() error {
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+
+	blob, err := r.fetch(r.ctx, chunk.offset, chunk.end-chunk.offset)
+	if err != nil {
+		return fmt.Errorf("unable to fetch eStargz chunk at offset=%d: %w", chunk.offset, err)
+	}
+	r.closers = append(r.closers, blob)
+
+	zr, err := gzip.NewReader(blob)
+	if err != nil {
+		return fmt.Errorf("unable to read eStargz chunk at offset=%d: %w", chunk.offset, err)
+	}
+	r.current = io.LimitReader(zr, chunk.size)
+	return nil
+}
+
+func (r *estargzContentsReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+// fetchRange reads the entire range from the given fetcher.
+func fetchRange(ctx context.Context, fetch BlobRangeFetcher, offset, size int64) ([]byte, error) {
+	reader, err := fetch(ctx, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(io.LimitReader(reader, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(contents)) != size {
+		return nil, fmt.Errorf("short read of range offset=%d size=%d (read %d bytes)", offset, size, len(contents))
+	}
+	return contents, nil
+}
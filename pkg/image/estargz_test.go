@@ -0,0 +1,296 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// estargzTestEntry is a single entry of a test eStargz blob, where regular file contents are split into chunks of the
+// given chunk size (a single chunk when zero).
+type estargzTestEntry struct {
+	header    tar.Header
+	contents  []byte
+	chunkSize int
+}
+
+// memberWriter writes all tar content to the current gzip member (a new member is started with next).
+type memberWriter struct {
+	blob *bytes.Buffer
+	gz   *gzip.Writer
+}
+
+func (w *memberWriter) Write(p []byte) (int, error) {
+	return w.gz.Write(p)
+}
+
+// next closes the current gzip member and starts a new one, returning the offset of the new member.
+func (w *memberWriter) next(t *testing.T) int64 {
+	t.Helper()
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			t.Fatalf("could not close gzip member: %+v", err)
+		}
+	}
+	w.gz = gzip.NewWriter(w.blob)
+	return int64(w.blob.Len())
+}
+
+// newEstargzBlob creates an eStargz blob for the given entries, where file contents start new gzip members (as created
+// by the eStargz tooling) and the TOC is followed by the footer.
+func newEstargzBlob(t *testing.T, entries ...estargzTestEntry) []byte {
+	t.Helper()
+	w := &memberWriter{blob: &bytes.Buffer{}}
+	w.next(t)
+	tw := tar.NewWriter(w)
+
+	var toc estargzTOC
+	toc.Version = 1
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.contents))
+		if header.Mode == 0 {
+			header.Mode = 0o644
+		}
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+
+		tocEntry := estargzEntry{
+			Name:     header.Name,
+			Mode:     header.Mode,
+			LinkName: header.Linkname,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			tocEntry.Type = "dir"
+		case tar.TypeSymlink:
+			tocEntry.Type = "symlink"
+		case tar.TypeLink:
+			tocEntry.Type = "hardlink"
+		default:
+			tocEntry.Type = "reg"
+			tocEntry.Size = header.Size
+		}
+
+		chunkSize := entry.chunkSize
+		if chunkSize == 0 {
+			chunkSize = len(entry.contents)
+		}
+		for chunkOffset := 0; chunkOffset < len(entry.contents); chunkOffset += chunkSize {
+			end := chunkOffset + chunkSize
+			if end > len(entry.contents) {
+				end = len(entry.contents)
+			}
+			chunkEntry := tocEntry
+			if chunkOffset > 0 {
+				chunkEntry = estargzEntry{Name: header.Name, Type: "chunk"}
+			}
+			chunkEntry.Offset = w.next(t)
+			chunkEntry.ChunkOffset = int64(chunkOffset)
+			if entry.chunkSize != 0 {
+				chunkEntry.ChunkSize = int64(end - chunkOffset)
+			}
+			if _, err := tw.Write(entry.contents[chunkOffset:end]); err != nil {
+				t.Fatalf("could not write contents: %+v", err)
+			}
+			toc.Entries = append(toc.Entries, chunkEntry)
+		}
+		if len(entry.contents) == 0 {
+			toc.Entries = append(toc.Entries, tocEntry)
+		}
+		if err := tw.Flush(); err != nil {
+			t.Fatalf("could not flush tar: %+v", err)
+		}
+	}
+
+	rawTOC, err := json.Marshal(toc)
+	if err != nil {
+		t.Fatalf("could not encode TOC: %+v", err)
+	}
+	tocOffset := w.next(t)
+	if err := tw.WriteHeader(&tar.Header{Name: estargzTOCName, Typeflag: tar.TypeReg, Size: int64(len(rawTOC)), Mode: 0o444}); err != nil {
+		t.Fatalf("could not write TOC header: %+v", err)
+	}
+	if _, err := tw.Write(rawTOC); err != nil {
+		t.Fatalf("could not write TOC: %+v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		t.Fatalf("could not close gzip member: %+v", err)
+	}
+
+	footer, err := gzip.NewWriterLevel(w.blob, gzip.NoCompression)
+	if err != nil {
+		t.Fatalf("could not create footer: %+v", err)
+	}
+	footer.Header.Extra = append([]byte{'S', 'G', 22, 0}, []byte(fmt.Sprintf("%016xSTARGZ", tocOffset))...)
+	if err := footer.Close(); err != nil {
+		t.Fatalf("could not close footer: %+v", err)
+	}
+	return w.blob.Bytes()
+}
+
+// rangeFetcherCounter serves ranges of a blob, recording the number of bytes fetched.
+type rangeFetcherCounter struct {
+	blob    []byte
+	fetched int64
+}
+
+func (c *rangeFetcherCounter) fetch(_ context.Context, offset, size int64) (io.ReadCloser, error) {
+	if offset < 0 || offset+size > int64(len(c.blob)) {
+		return nil, fmt.Errorf("invalid range offset=%d size=%d", offset, size)
+	}
+	c.fetched += size
+	return ioutil.NopCloser(bytes.NewReader(c.blob[offset : offset+size])), nil
+}
+
+// blobImage creates an image with a single layer with the given (compressed) blob, where blob ranges are served by the
+// given counter.
+func blobImage(t *testing.T, blob []byte, counter *rangeFetcherCounter, options ...ReadOption) *Image {
+	t.Helper()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(blob)), nil
+	})
+	if err != nil {
+		t.Fatalf("could not create layer: %+v", err)
+	}
+	img := newTestImage(t, []v1.Layer{layer}, WithBlobRangeFetcher(func(v1.Layer) BlobRangeFetcher {
+		return counter.fetch
+	}))
+	if err := img.Read(options...); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func TestImage_SeekableLayers(t *testing.T) {
+	large := make([]byte, 256*1024)
+	rand.New(rand.NewSource(42)).Read(large)
+
+	blob := newEstargzBlob(t,
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755}},
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "etc/small.txt"}, contents: []byte("small contents")},
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "large.bin"}, contents: large, chunkSize: 100 * 1024},
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: "empty.txt"}},
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeSymlink, Name: "link.txt", Linkname: "etc/small.txt"}},
+		estargzTestEntry{header: tar.Header{Typeflag: tar.TypeLink, Name: "hard.txt", Linkname: "etc/small.txt"}},
+	)
+
+	tests := []struct {
+		name         string
+		options      []ReadOption
+		wantSeekable bool
+	}{
+		{
+			name: "seekable layers disabled",
+		},
+		{
+			name:         "seekable layers",
+			options:      []ReadOption{WithSeekableLayers()},
+			wantSeekable: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := &rangeFetcherCounter{blob: blob}
+			img := blobImage(t, blob, counter, test.options...)
+
+			if seekable := img.Layers[0].estargz != nil; seekable != test.wantSeekable {
+				t.Fatalf("unexpected seekable layer: %v", seekable)
+			}
+			if !test.wantSeekable && counter.fetched != 0 {
+				t.Errorf("expected no ranges fetched, got %d bytes", counter.fetched)
+			}
+			// only the footer and the TOC are fetched while reading
+			if test.wantSeekable && counter.fetched >= int64(len(blob))/2 {
+				t.Errorf("expected only the TOC to be fetched, got %d of %d bytes", counter.fetched, len(blob))
+			}
+
+			metadata, err := img.FileMetadataFromSquash("/etc/small.txt")
+			if err != nil {
+				t.Fatalf("could not get metadata: %+v", err)
+			}
+			if metadata.Size != int64(len("small contents")) || metadata.TarHeaderName != "etc/small.txt" {
+				t.Errorf("unexpected metadata: %+v", metadata)
+			}
+
+			before := counter.fetched
+			reader, err := img.FileContentsFromSquash("/link.txt")
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			assertContents(t, reader, "small contents")
+			if test.wantSeekable && counter.fetched-before >= int64(len(blob))/2 {
+				t.Errorf("expected only the file range to be fetched, got %d of %d bytes", counter.fetched-before, len(blob))
+			}
+
+			for path, expected := range map[file.Path]string{
+				"/large.bin": string(large),
+				"/empty.txt": "",
+				"/hard.txt":  "small contents",
+			} {
+				reader, err := img.FileContentsFromSquash(path)
+				if err != nil {
+					t.Fatalf("could not get contents for %q: %+v", path, err)
+				}
+				assertContents(t, reader, expected)
+			}
+
+			// all contents are fetched in a single request as well
+			var refs []file.Reference
+			for _, path := range []file.Path{"/etc/small.txt", "/large.bin", "/hard.txt"} {
+				_, ref, err := squashedTreeOf(t, img).File(path)
+				if err != nil || ref == nil {
+					t.Fatalf("could not find %q: %+v", path, err)
+				}
+				refs = append(refs, *ref)
+			}
+			contents, err := img.MultipleFileContentsByRef(refs...)
+			if err != nil {
+				t.Fatalf("could not get multiple contents: %+v", err)
+			}
+			assertContents(t, contents[refs[0]], "small contents")
+			assertContents(t, contents[refs[1]], string(large))
+			assertContents(t, contents[refs[2]], "small contents")
+		})
+	}
+}
+
+func TestImage_SeekableLayers_NotEstargz(t *testing.T) {
+	layer := newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "some/file.txt"})
+	compressed, err := layer.Compressed()
+	if err != nil {
+		t.Fatalf("could not get compressed layer: %+v", err)
+	}
+	blob, err := ioutil.ReadAll(compressed)
+	if err != nil {
+		t.Fatalf("could not read compressed layer: %+v", err)
+	}
+
+	counter := &rangeFetcherCounter{blob: blob}
+	img := blobImage(t, blob, counter, WithSeekableLayers())
+
+	if img.Layers[0].estargz != nil {
+		t.Fatalf("expected the layer not to be seekable")
+	}
+	reader, err := img.FileContentsFromSquash("/some/file.txt")
+	if err != nil {
+		t.Fatalf("could not get contents: %+v", err)
+	}
+	assertContents(t, reader, "some/file.txt")
+}
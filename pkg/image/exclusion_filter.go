@@ -0,0 +1,103 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/bmatcuk/doublestar/v2"
+)
+
+// exclusionRule is a single pattern from an exclusion spec (see newPathExclusions).
+type exclusionRule struct {
+	// pattern is the glob pattern relative to the root (without a leading separator).
+	pattern string
+	// negate indicates that paths matching the pattern are included again (a "!" prefixed pattern).
+	negate bool
+}
+
+// pathExclusions are the rules from an exclusion spec (in the order given), where the last rule matching a path decides
+// if the path is excluded (no exclusions when empty).
+type pathExclusions []exclusionRule
+
+// newPathExclusions parses an exclusion spec in .dockerignore syntax: one glob pattern per line (supporting "**" to
+// match any number of directories), lines starting with "#" are comments, and patterns starting with "!" include
+// paths that were excluded by an earlier pattern.
+func newPathExclusions(reader io.Reader) (pathExclusions, error) {
+	var exclusions pathExclusions
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule exclusionRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+
+		rule.pattern = strings.TrimPrefix(path.Clean(file.DirSeparator+line), file.DirSeparator)
+		if rule.pattern == "" {
+			// the root matches every path
+			rule.pattern = "**"
+		}
+
+		// note: matching the pattern against itself visits every segment of the pattern
+		if _, err := doublestar.Match(rule.pattern, rule.pattern); err != nil {
+			return nil, fmt.Errorf("invalid exclusion pattern=%q: %w", line, err)
+		}
+		exclusions = append(exclusions, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read exclusions: %w", err)
+	}
+	return exclusions, nil
+}
+
+// excludes indicates if the given path should not be indexed. A pattern that matches a directory matches all paths
+// within the directory. Whiteouts are considered by the path they remove, so that squashing still removes included
+// paths from lower layers.
+func (e pathExclusions) excludes(p file.Path) bool {
+	if len(e) == 0 {
+		return false
+	}
+
+	target := p
+	if p.IsWhiteout() {
+		unWhiteout, err := p.UnWhiteoutPath()
+		if err != nil {
+			// this whiteout is for the root directory, which affects every path
+			return false
+		}
+		target = unWhiteout
+	}
+
+	relative := strings.TrimPrefix(path.Clean(string(target)), file.DirSeparator)
+	if relative == "" {
+		return false
+	}
+
+	var excluded bool
+	for _, rule := range e {
+		if rule.matches(relative) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// matches indicates if the rule pattern matches the given relative path (or any of its parent directories).
+func (r exclusionRule) matches(relative string) bool {
+	for candidate := relative; candidate != "." && candidate != ""; candidate = path.Dir(candidate) {
+		// note: the pattern was validated when parsed
+		if matched, _ := doublestar.Match(r.pattern, candidate); matched {
+			return true
+		}
+	}
+	return false
+}
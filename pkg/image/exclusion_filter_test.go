@@ -0,0 +1,57 @@
+package image
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestPathExclusions_Excludes(t *testing.T) {
+	spec := `
+# secrets should never be analyzed
+/etc/shadow
+**/*.key
+var/cache
+!var/cache/keep
+`
+	exclusions, err := newPathExclusions(strings.NewReader(spec))
+	if err != nil {
+		t.Fatalf("could not parse exclusions: %+v", err)
+	}
+
+	tests := []struct {
+		path     file.Path
+		expected bool
+	}{
+		{path: "/", expected: false},
+		{path: "/etc", expected: false},
+		{path: "/etc/shadow", expected: true},
+		{path: "/etc/passwd", expected: false},
+		{path: "/srv/tls/server.key", expected: true},
+		{path: "/server.key", expected: true},
+		{path: "/var/cache", expected: true},
+		{path: "/var/cache/apk/index", expected: true},
+		{path: "/var/cache/keep", expected: false},
+		{path: "/var/cache/keep/thing", expected: false},
+		{path: "/var/log/messages", expected: false},
+		// whiteouts are considered by the path they remove
+		{path: "/etc/.wh.shadow", expected: true},
+		{path: "/etc/.wh.passwd", expected: false},
+		{path: "/.wh..wh..opq", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			if actual := exclusions.excludes(test.path); actual != test.expected {
+				t.Errorf("unexpected result for %q: %v", test.path, actual)
+			}
+		})
+	}
+}
+
+func TestPathExclusions_InvalidPattern(t *testing.T) {
+	if _, err := newPathExclusions(strings.NewReader("etc/[")); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
@@ -3,10 +3,17 @@ package image
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 
+	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
 )
 
@@ -14,14 +21,51 @@ var ErrFileNotFound = fmt.Errorf("could not find file")
 
 var cacheFileSizeThreshold int64 = 5 * file.MB
 
+// maxHardlinkHops is the maximum number of individual followed to find the content of a single file.
+const maxHardlinkHops = 32
+
 // FileCatalog represents all file metadata and source tracing for all files contained within the image layer
-// blobs (i.e. everything except for the image index/manifest/metadata files).
+// blobs (i.e. everything except for the image index/manifest/metadata files). A catalog is safe for concurrent use:
+// entries may be fetched (along with file contents) from multiple goroutines, even while other goroutines add entries.
 type FileCatalog struct {
-	catalog          map[file.ID]*FileCatalogEntry
+	// lock guards the store, the contents cache paths, the hardlink targets, and the MIME type index (note: this is a pointer so that
+	// catalogs may still be passed by value).
+	lock             *sync.RWMutex
+	store            fileCatalogStore
 	contentsCacheDir string
+	// diskStoreThreshold is the number of entries at which the catalog moves all entries to a disk-backed store
+	// (a value of zero keeps all entries in memory).
+	diskStoreThreshold int
 	// contentsCachePath is a mapping of the paths for each file ID already previously requested by a caller. This is
 	// to prevent duplicated or unnecessary tar content requests (which can be expensive)
 	contentsCachePath map[file.ID]string
+	// hardlinkTargets maps the ID of each hardlink to the ID of the file it links to, for targets within the same layer
+	// tar (targets within lower layers are resolved relative to the layer squash tree upon read instead).
+	hardlinkTargets map[file.ID]file.ID
+	// mimeTypeIndex holds the references of all files with sniffed contents by MIME type (see WithContentTypes).
+	mimeTypeIndex map[string]map[file.ID]file.Reference
+	// streamContents indicates that large file contents are streamed from the layer tar for every read instead of
+	// being cached within the contents cache dir (see WithStreamingLayers).
+	streamContents bool
+	// decompressContents indicates that compressed file contents are decompressed by FileContents (see
+	// WithDecompressedContents).
+	decompressContents bool
+	// nestedArchiveMembers locates the contents of all entries found within archives (see WithNestedArchives).
+	nestedArchiveMembers map[file.ID]nestedArchiveMember
+	// tempWriteHook observes (and may veto or redirect) the writes of the disk-backed store and of cached file contents.
+	tempWriteHook TempWriteHook
+}
+
+// FileCatalogStats describes the (approximate) resources used to hold all entries within a FileCatalog.
+type FileCatalogStats struct {
+	// Entries is the number of files cataloged.
+	Entries int
+	// MemoryBytes is the approximate number of bytes held in memory for all entries.
+	MemoryBytes int64
+	// DiskBytes is the number of bytes persisted to disk for all entries (only for disk-backed catalogs).
+	DiskBytes int64
+	// InternedStrings is the number of unique strings shared between entries.
+	InternedStrings int
 }
 
 // FileCatalogEntry represents all stored metadata for a single file reference.
@@ -34,49 +78,375 @@ type FileCatalogEntry struct {
 // NewFileCatalog returns an empty FileCatalog.
 func NewFileCatalog(contentsCacheDir string) FileCatalog {
 	return FileCatalog{
-		catalog:           make(map[file.ID]*FileCatalogEntry),
+		lock:              &sync.RWMutex{},
+		store:             newMemoryFileCatalogStore(),
 		contentsCachePath: make(map[file.ID]string),
 		contentsCacheDir:  contentsCacheDir,
+		hardlinkTargets:   make(map[file.ID]file.ID),
+	}
+}
+
+// replace swaps all entries (and settings) of this catalog for those of the given catalog, which is no longer used
+// afterwards. The lock of this catalog is kept, so that all holders of this catalog observe the swap at once.
+func (c *FileCatalog) replace(other *FileCatalog) {
+	lock := c.lock
+	lock.Lock()
+	defer lock.Unlock()
+
+	other.lock.Lock()
+	defer other.lock.Unlock()
+
+	previous := c.store
+	*c = *other
+	c.lock = lock
+
+	if previous != nil && previous != c.store {
+		if err := previous.close(); err != nil {
+			log.Warnf("unable to close replaced file catalog store: %+v", err)
+		}
+	}
+}
+
+// close releases the resources held by the store of the catalog (e.g. the entries file of a disk-backed store), after
+// which no entries can be fetched.
+func (c *FileCatalog) close() error {
+	if c.lock == nil {
+		// the zero value catalog holds nothing
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.store == nil {
+		return nil
 	}
+	return c.store.close()
 }
 
 // Add creates a new FileCatalogEntry for the given file reference and metadata, cataloged by the ID of the
 // file reference (overwriting any existing entries without warning).
 func (c *FileCatalog) Add(f file.Reference, m file.Metadata, s *Layer) {
-	c.catalog[f.ID()] = &FileCatalogEntry{
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.switchToDiskStore()
+
+	entry := FileCatalogEntry{
 		File:     f,
 		Metadata: m,
 		Layer:    s,
 	}
+
+	if err := c.store.add(entry); err != nil {
+		log.Warnf("unable to add file catalog entry (keeping entry in memory): %+v", err)
+		c.fallbackToMemoryStore()
+		// the memory store cannot fail
+		_ = c.store.add(entry)
+	}
+
+	c.trackHardlink(entry)
+	c.indexMIMEType(entry)
+}
+
+// trackHardlink records the target of the given entry if it is a hardlink to an earlier entry within the same layer tar.
+func (c *FileCatalog) trackHardlink(entry FileCatalogEntry) {
+	if entry.Metadata.TypeFlag != tar.TypeLink || entry.Layer == nil || entry.Layer.Tree == nil {
+		return
+	}
+	_, target, err := entry.Layer.Tree.File(hardlinkTargetPath(entry.Metadata.Linkname))
+	if err != nil || target == nil || target.ID() == entry.File.ID() {
+		return
+	}
+	if c.hardlinkTargets == nil {
+		c.hardlinkTargets = make(map[file.ID]file.ID)
+	}
+	c.hardlinkTargets[entry.File.ID()] = target.ID()
+}
+
+// indexMIMEType records the given entry by MIME type if the content type of the entry was sniffed.
+func (c *FileCatalog) indexMIMEType(entry FileCatalogEntry) {
+	mimeType := entry.Metadata.ContentType.MIMEType
+	if mimeType == "" {
+		return
+	}
+	if c.mimeTypeIndex == nil {
+		c.mimeTypeIndex = make(map[string]map[file.ID]file.Reference)
+	}
+	if _, ok := c.mimeTypeIndex[mimeType]; !ok {
+		c.mimeTypeIndex[mimeType] = make(map[file.ID]file.Reference)
+	}
+	c.mimeTypeIndex[mimeType][entry.File.ID()] = entry.File
+}
+
+// FilesByMIMEType returns the references of all cataloged files (across all layers) with any of the given MIME types
+// (e.g. "application/x-executable"), sorted by path. This is only populated for images read with WithContentTypes.
+func (c *FileCatalog) FilesByMIMEType(mimeTypes ...string) []file.Reference {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var refs []file.Reference
+	for _, mimeType := range mimeTypes {
+		for _, ref := range c.mimeTypeIndex[mimeType] {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].RealPath == refs[j].RealPath {
+			return refs[i].ID() < refs[j].ID()
+		}
+		return refs[i].RealPath < refs[j].RealPath
+	})
+	return refs
+}
+
+// resolveHardlink returns the entry for the file that the given entry links to if the entry is a hardlink (since tar
+// hardlink entries have no content of their own), otherwise the given entry is returned.
+func (c *FileCatalog) resolveHardlink(entry *FileCatalogEntry) (*FileCatalogEntry, error) {
+	for hops := 0; entry.Metadata.TypeFlag == tar.TypeLink; hops++ {
+		if hops >= maxHardlinkHops {
+			return nil, fmt.Errorf("too many individual while resolving path=%q", entry.File.RealPath)
+		}
+
+		targetPath := hardlinkTargetPath(entry.Metadata.Linkname)
+		c.lock.RLock()
+		targetID, ok := c.hardlinkTargets[entry.File.ID()]
+		c.lock.RUnlock()
+		if !ok {
+			// the target is within a lower layer (or the catalog was loaded without tracking individual)
+			if entry.Layer == nil || entry.Layer.SquashedTree == nil {
+				return nil, fmt.Errorf("%w: hardlink=%q target=%q", ErrFileNotFound, entry.File.RealPath, targetPath)
+			}
+			_, target, err := entry.Layer.SquashedTree.File(targetPath)
+			if err != nil {
+				return nil, err
+			}
+			if target == nil || target.ID() == entry.File.ID() {
+				return nil, fmt.Errorf("%w: hardlink=%q target=%q", ErrFileNotFound, entry.File.RealPath, targetPath)
+			}
+			targetID = target.ID()
+		}
+
+		target, err := c.get(targetID)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil {
+			return nil, fmt.Errorf("%w: hardlink=%q target=%q", ErrFileNotFound, entry.File.RealPath, targetPath)
+		}
+		entry = target
+	}
+	return entry, nil
+}
+
+// hardlinkTargetPath is the absolute path of the given tar hardlink name (which is relative to the root of the tar).
+func hardlinkTargetPath(linkname string) file.Path {
+	return file.Path(file.DirSeparator + linkname).Normalize()
+}
+
+// switchToDiskStore moves all existing entries into a disk-backed store once the configured threshold is reached.
+func (c *FileCatalog) switchToDiskStore() {
+	if c.diskStoreThreshold <= 0 || c.store.len() < c.diskStoreThreshold {
+		return
+	}
+	if _, ok := c.store.(*boltFileCatalogStore); ok {
+		return
+	}
+
+	dir, ok := tempWritePath(c.tempWriteHook, TempWrite{
+		Kind:          FileCatalogIndexWrite,
+		Path:          c.contentsCacheDir,
+		ProjectedSize: -1,
+	})
+	if !ok {
+		c.diskStoreThreshold = 0
+		return
+	}
+
+	diskStore, err := newBoltFileCatalogStore(dir)
+	if err != nil {
+		log.Warnf("unable to create disk-backed file catalog (keeping entries in memory): %+v", err)
+		c.diskStoreThreshold = 0
+		return
+	}
+
+	if err := moveFileCatalogEntries(c.store, diskStore); err != nil {
+		log.Warnf("unable to move entries to disk-backed file catalog (keeping entries in memory): %+v", err)
+		c.diskStoreThreshold = 0
+		if err := diskStore.close(); err != nil {
+			log.Warnf("unable to close disk-backed file catalog: %+v", err)
+		}
+		return
+	}
+
+	log.Debugf("moved %d file catalog entries to disk-backed store", diskStore.len())
+	c.store = diskStore
+}
+
+// fallbackToMemoryStore moves all existing entries back into memory and stops using a disk-backed store.
+func (c *FileCatalog) fallbackToMemoryStore() {
+	c.diskStoreThreshold = 0
+	if _, ok := c.store.(*boltFileCatalogStore); !ok {
+		return
+	}
+	memoryStore := newMemoryFileCatalogStore()
+	if err := moveFileCatalogEntries(c.store, memoryStore); err != nil {
+		log.Errorf("unable to move file catalog entries back into memory: %+v", err)
+	}
+	if err := c.store.close(); err != nil {
+		log.Warnf("unable to close disk-backed file catalog: %+v", err)
+	}
+	c.store = memoryStore
+}
+
+// moveFileCatalogEntries copies all entries from one store into another.
+func moveFileCatalogEntries(from, to fileCatalogStore) error {
+	for _, id := range from.ids() {
+		entry, err := from.get(id)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := to.add(*entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persist writes all entries (along with the layers the entries were cataloged from, as described by the given
+// function) to a self-contained database at the given path, replacing any existing file. The catalog can be opened
+// again with openFileCatalog (e.g. by another process).
+func (c *FileCatalog) persist(path string, describe func(*Layer) savedFileCatalogLayer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if store, ok := c.store.(*boltFileCatalogStore); ok && !store.readOnly {
+		return store.persist(path, describe)
+	}
+
+	// the entries are held in memory (or within a database opened read-only), which are copied into a new database
+	store, err := newBoltFileCatalogStore(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := store.close(); err != nil {
+			log.Warnf("unable to close file catalog store: %+v", err)
+		}
+	}()
+	if err := moveFileCatalogEntries(c.store, store); err != nil {
+		return err
+	}
+	return store.persist(path, describe)
+}
+
+// openFileCatalog opens the catalog persisted at the given path (see persist) without loading the entries into memory.
+// Any content requested from the catalog is cached within the given contents cache dir.
+func openFileCatalog(path, contentsCacheDir string) (FileCatalog, error) {
+	store, err := openBoltFileCatalogStore(path)
+	if err != nil {
+		return FileCatalog{}, err
+	}
+
+	catalog := NewFileCatalog(contentsCacheDir)
+	catalog.store = store
+
+	// note: only the references of files with a sniffed content type are held in memory (as when adding entries)
+	if err := store.each(catalog.indexMIMEType); err != nil {
+		store.close()
+		return FileCatalog{}, err
+	}
+	return catalog, nil
+}
+
+// Stats returns the (approximate) resources used to hold all entries within the catalog.
+func (c *FileCatalog) Stats() FileCatalogStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.store.stats()
 }
 
 // Exists indicates if the given file reference exists in the catalog.
 func (c *FileCatalog) Exists(f file.Reference) bool {
-	_, ok := c.catalog[f.ID()]
-	return ok
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.store.exists(f.ID())
+}
+
+// get fetches the entry for the given file ID from the store (nil if the ID has not been added).
+func (c *FileCatalog) get(id file.ID) (*FileCatalogEntry, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.store.get(id)
+}
+
+// ids returns the IDs of all entries within the catalog.
+func (c *FileCatalog) ids() []file.ID {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.store.ids()
+}
+
+// cachedContentsPath returns the path of the previously cached contents for the given file ID (if any).
+func (c *FileCatalog) cachedContentsPath(id file.ID) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	p, ok := c.contentsCachePath[id]
+	return p, ok
 }
 
 // Get fetches a FileCatalogEntry for the given file reference, or returns an error if the file reference has not
 // been added to the catalog.
 func (c *FileCatalog) Get(f file.Reference) (FileCatalogEntry, error) {
-	value, ok := c.catalog[f.ID()]
-	if !ok {
+	return c.GetByID(f.ID())
+}
+
+// GetByID fetches a FileCatalogEntry for the file reference with the given ID, or returns an error if the ID has not
+// been added to the catalog.
+func (c *FileCatalog) GetByID(id file.ID) (FileCatalogEntry, error) {
+	value, err := c.get(id)
+	if err != nil {
+		return FileCatalogEntry{}, err
+	}
+	if value == nil {
 		return FileCatalogEntry{}, ErrFileNotFound
 	}
 	return *value, nil
 }
 
+// Metadata returns the file metadata captured from the tar header of the given file reference (e.g. permission bits,
+// owner and group, timestamps, link target, and type), without reading the layer tar again. An ErrFileNotFound error
+// is returned if the file reference has not been added to the catalog.
+func (c *FileCatalog) Metadata(f file.Reference) (file.Metadata, error) {
+	entry, err := c.Get(f)
+	if err != nil {
+		return file.Metadata{}, fmt.Errorf("%w: path=%q", err, f.RealPath)
+	}
+	return entry.Metadata, nil
+}
+
 // handleContentResponse returns a io.ReadCloser for the given file reference that does not take up precious file
 // descriptors until the first Read() call on the io.ReadCloser. This function is additionally responsible for handling
 // caching of previous results into a cache directory in case future calls are interested in the results as well as
-// provide a non-memory-intensive Reader for the file reference by storing to disk.
-func (c *FileCatalog) handleContentResponse(ref file.Reference, tarReader io.Reader) (io.ReadCloser, error) {
+// provide a non-memory-intensive Reader for the file reference by storing to disk. Only the first limit bytes of the
+// contents are provided when the limit is not negative (see ContentLimits).
+func (c *FileCatalog) handleContentResponse(ref file.Reference, tarReader io.Reader, limit int64) (io.ReadCloser, error) {
 	entry, err := c.Get(ref)
 	if err != nil {
 		return nil, err
 	}
 
-	if entry.Metadata.Size <= cacheFileSizeThreshold {
+	// truncated contents are never cached, since later requests may be for the complete contents
+	size := entry.Metadata.Size
+	truncated := limit >= 0 && limit < size
+	if truncated {
+		size = limit
+		tarReader = io.LimitReader(tarReader, limit)
+	}
+
+	if size <= cacheFileSizeThreshold {
 		// this is a small file, read the contents into memory and return a reader
 		theBytes, err := ioutil.ReadAll(tarReader)
 		if err != nil {
@@ -86,13 +456,33 @@ func (c *FileCatalog) handleContentResponse(ref file.Reference, tarReader io.Rea
 	}
 
 	// check to see if this is already in the cache, if so, return a reader to the cache reference instead
-	if p, ok := c.contentsCachePath[ref.ID()]; ok {
+	if p, ok := c.cachedContentsPath(ref.ID()); ok && !truncated {
 		return file.NewDeferredReadCloser(p), nil
 	}
 
+	var dir string
+	var ok bool
+	if !c.streamContents {
+		dir, ok = tempWritePath(c.tempWriteHook, TempWrite{
+			Kind:          FileContentsWrite,
+			Path:          c.contentsCacheDir,
+			ProjectedSize: size,
+		})
+	}
+	if !ok {
+		// nothing is persisted, the contents are streamed from the layer tar again once the caller reads them
+		return file.NewDeferredReadCloserFromOpener(func() (io.ReadCloser, error) {
+			reader, err := c.openTarEntry(context.Background(), entry)
+			if err != nil || !truncated {
+				return reader, err
+			}
+			return limitReadCloser(reader, limit), nil
+		}), nil
+	}
+
 	// cache the result to a directory and return a DeferredReadCloser to not allocate file handles unless they are
 	// actively being used.
-	tempFile, err := ioutil.TempFile(c.contentsCacheDir, ref.RealPath.Basename()+"-")
+	tempFile, err := ioutil.TempFile(dir, ref.RealPath.Basename()+"-")
 	if err != nil {
 		return nil, fmt.Errorf("unable to create content response cache: %w", err)
 	}
@@ -103,10 +493,20 @@ func (c *FileCatalog) handleContentResponse(ref file.Reference, tarReader io.Rea
 		return nil, fmt.Errorf("unable to copy content response to cache: %w", err)
 	}
 
+	if truncated {
+		return file.NewDeferredReadCloser(tempFile.Name()), nil
+	}
+
 	// keep track of the reference in the file catalog cache
-	if _, ok := c.contentsCachePath[ref.ID()]; ok {
-		// the ref should not have already existed! this implies a potential race condition
-		return nil, fmt.Errorf("found duplicate file catalog cache entry: %+v", ref)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p, ok := c.contentsCachePath[ref.ID()]; ok {
+		// another goroutine cached the same contents in the meantime, which is used instead
+		tempFile.Close()
+		if err := os.Remove(tempFile.Name()); err != nil {
+			log.Debugf("unable to remove duplicate cached contents=%q: %+v", tempFile.Name(), err)
+		}
+		return file.NewDeferredReadCloser(p), nil
 	}
 	c.contentsCachePath[ref.ID()] = tempFile.Name()
 
@@ -115,55 +515,187 @@ func (c *FileCatalog) handleContentResponse(ref file.Reference, tarReader io.Rea
 }
 
 // FetchContents reads the file contents for the given file reference from the underlying image/layer blob. An error
-// is returned if there is no file at the given path and layer or the read operation cannot continue.
+// is returned if there is no file at the given path and layer or the read operation cannot continue. Compressed
+// contents are decompressed when the image was read with WithDecompressedContents (see RawFileContents otherwise).
 func (c *FileCatalog) FileContents(f file.Reference) (io.ReadCloser, error) {
-	entry, ok := c.catalog[f.ID()]
-	if !ok {
+	reader, err := c.RawFileContents(f)
+	if err != nil {
+		return nil, err
+	}
+	if c.decompressContents {
+		return decompressedContents(reader)
+	}
+	return reader, nil
+}
+
+// RawFileContents reads the file contents for the given file reference as found within the layer tar (never
+// decompressed, regardless of WithDecompressedContents).
+func (c *FileCatalog) RawFileContents(f file.Reference) (io.ReadCloser, error) {
+	reader, err := c.OpenByID(f.ID())
+	if errors.Is(err, ErrFileNotFound) {
 		return nil, fmt.Errorf("could not find file: %+v", f.RealPath)
 	}
+	return reader, err
+}
+
+// OpenByID reads the file contents for the file reference with the given ID from the underlying layer blob (whichever
+// layer the file was cataloged from). This allows for fetching contents for references obtained from earlier queries
+// (e.g. globs, walks, or tree diffs) without resolving the path again. An ErrFileNotFound error is returned if the
+// ID has not been cataloged.
+func (c *FileCatalog) OpenByID(id file.ID) (io.ReadCloser, error) {
+	return c.OpenByIDWithContext(context.Background(), id)
+}
+
+// OpenByIDWithContext is the same as OpenByID, however, reading the layer tar is aborted once the given context is
+// done.
+func (c *FileCatalog) OpenByIDWithContext(ctx context.Context, id file.ID) (io.ReadCloser, error) {
+	entry, err := c.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: id=%d", ErrFileNotFound, id)
+	}
+	entry, err = c.resolveHardlink(entry)
+	if err != nil {
+		return nil, err
+	}
+	f := entry.File
+	id = f.ID()
 
 	// check and see if there is a cache hit for the current file, if so, use that
-	if cacheValue, exists := c.contentsCachePath[f.ID()]; exists {
+	if cacheValue, exists := c.cachedContentsPath(id); exists {
 		return file.NewDeferredReadCloser(cacheValue), nil
 	}
 
+	fileReader, err := c.openTarEntry(ctx, *entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.streamContents && entry.Metadata.Size > cacheFileSizeThreshold {
+		// closing the file reader closes the layer tar
+		return fileReader, nil
+	}
+	defer fileReader.Close()
+
+	return c.handleContentResponse(f, fileReader, -1)
+}
+
+// openTarEntry provides the contents of the given entry directly from the layer tar the entry was cataloged from.
+func (c *FileCatalog) openTarEntry(ctx context.Context, entry FileCatalogEntry) (io.ReadCloser, error) {
+	if member, ok := c.nestedArchiveMember(entry.File.ID()); ok {
+		return c.openNestedArchiveMember(ctx, member)
+	}
+
+	if entry.Layer != nil && entry.Layer.estargz != nil {
+		// only the ranges of the layer blob holding the file contents are fetched
+		return entry.Layer.estargz.open(ctx, entry.Metadata.TarHeaderName)
+	}
+
 	// get the (potentially) cached layer tar
-	sourceTarReader, err := entry.Layer.content()
+	sourceTarReader, err := entry.Layer.opener.Open()
 	if err != nil {
 		return nil, err
 	}
 
-	fileReader, err := file.ReaderFromTar(sourceTarReader, entry.Metadata.TarHeaderName)
+	contextTarReader := struct {
+		io.Reader
+		io.Closer
+	}{file.NewContextReader(ctx, sourceTarReader), sourceTarReader}
+
+	return file.ReaderFromTar(contextTarReader, entry.Metadata.TarHeaderName)
+}
+
+// TarHeader returns the raw tar header for the given file reference, as found within the layer tar the file was
+// cataloged from. This is useful for uncommon header fields that are not captured within file.Metadata (note: this
+// requires a read of the layer tar up to the entry).
+func (c *FileCatalog) TarHeader(f file.Reference) (*tar.Header, error) {
+	entry, err := c.Get(f)
 	if err != nil {
 		return nil, err
 	}
-	defer fileReader.Close()
 
-	return c.handleContentResponse(f, fileReader)
+	sourceTarReader, err := entry.Layer.opener.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain layer tar reader: %w", err)
+	}
+	defer sourceTarReader.Close()
+
+	header, err := file.HeaderFromTar(sourceTarReader, entry.Metadata.TarSequence)
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != entry.Metadata.TarHeaderName {
+		return nil, fmt.Errorf("mismatched tar header at sequence=%d: expected %q but found %q", entry.Metadata.TarSequence, entry.Metadata.TarHeaderName, header.Name)
+	}
+	return header, nil
 }
 
 // MultipleFileContents returns the contents of all provided file references. Returns an error if any of the file
-// references does not exist in the underlying layer tars.
+// references does not exist in the underlying layer tars. Reads are ordered by layer and by position within each layer
+// tar, so each layer tar is read at most once in a single sequential pass (regardless of the order of the references).
 func (c *FileCatalog) MultipleFileContents(files ...file.Reference) (map[file.Reference]io.ReadCloser, error) {
-	requestsByLayer, err := c.buildTarContentsRequests(files...)
+	return c.MultipleFileContentsWithContext(context.Background(), files...)
+}
+
+// MultipleFileContentsWithContext is the same as MultipleFileContents, however, reading the layer tars is aborted once
+// the given context is done.
+func (c *FileCatalog) MultipleFileContentsWithContext(ctx context.Context, files ...file.Reference) (map[file.Reference]io.ReadCloser, error) {
+	return c.multipleFileContents(ctx, nil, files...)
+}
+
+// multipleFileContents reads the contents of all given file references, where the contents of files with a limit (by
+// file ID) are cut short after the given number of bytes.
+func (c *FileCatalog) multipleFileContents(ctx context.Context, limits map[file.ID]int64, files ...file.Reference) (map[file.Reference]io.ReadCloser, error) {
+	// hardlinks are read one at a time (the target may also be requested, which cannot share a single content reader),
+	// as are files from seekable layers (which are fetched by range instead of reading the layer tar) and files within
+	// nested archives (which are not layer tar entries)
+	var individual, regular []file.Reference
+	for _, f := range files {
+		entry, err := c.Get(f)
+		if err != nil {
+			return nil, err
+		}
+		_, nested := c.nestedArchiveMember(f.ID())
+		if entry.Metadata.TypeFlag == tar.TypeLink || (entry.Layer != nil && entry.Layer.estargz != nil) || nested {
+			individual = append(individual, f)
+		} else {
+			regular = append(regular, f)
+		}
+	}
+
+	requests, err := c.buildTarContentsRequests(regular...)
 	if err != nil {
 		return nil, err
 	}
 
 	results := make(map[file.Reference]io.ReadCloser)
-	for layer, tarHeaderNameToFileReference := range requestsByLayer {
-		sourceTarReader, err := layer.content()
+	for _, f := range individual {
+		if limit, ok := limits[f.ID()]; ok {
+			results[f], err = c.openTruncated(ctx, f, limit)
+		} else {
+			results[f], err = c.OpenByIDWithContext(ctx, f.ID())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, request := range requests {
+		sourceTarReader, err := request.layer.opener.Open()
 		if err != nil {
 			return nil, fmt.Errorf("unable to obtain layer tar reader: %w", err)
 		}
 		discoveredFiles := 0
+		var sequence int64 = -1
 
 		// we generate the TarVisitor dynamically to prevent usage of the loop variables within the function literal
-		visitor := func(tarHeaderNameToFileReference file.TarContentsRequest) file.TarVisitor {
+		visitor := func(request layerContentsRequest) file.TarVisitor {
 			// create a visitor function tailored for reading the contents of files in the current request and
 			// handling the content request via the FileCatalog (for caching and normalizing the io.ReadCloser returned)
 			return func(header *tar.Header, contents io.Reader) error {
-				if fileRef, ok := tarHeaderNameToFileReference[header.Name]; ok {
+				sequence++
+				if fileRef, ok := request.files[header.Name]; ok {
 					discoveredFiles++
 					// process the given tar entry
 					if _, ok := results[fileRef]; ok {
@@ -171,20 +703,27 @@ func (c *FileCatalog) MultipleFileContents(files ...file.Reference) (map[file.Re
 					}
 
 					// read the bytes from the tar or use previously cached contents
-					results[fileRef], err = c.handleContentResponse(fileRef, contents)
+					limit, ok := limits[fileRef.ID()]
+					if !ok {
+						limit = -1
+					}
+					results[fileRef], err = c.handleContentResponse(fileRef, contents, limit)
 					if err != nil {
 						return err
 					}
 				}
 
-				if discoveredFiles == len(tarHeaderNameToFileReference) {
+				// stop as soon as all files have been found or there are no more requested entries further in the tar
+				if discoveredFiles == len(request.files) || (request.lastSequence > 0 && sequence >= request.lastSequence) {
 					return file.ErrTarStopIteration
 				}
 				return nil
 			}
-		}(tarHeaderNameToFileReference)
+		}(request)
 
-		if err := file.TarIterator(sourceTarReader, visitor); err != nil {
+		err = file.TarIterator(file.NewContextReader(ctx, sourceTarReader), visitor)
+		sourceTarReader.Close()
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -192,20 +731,43 @@ func (c *FileCatalog) MultipleFileContents(files ...file.Reference) (map[file.Re
 	return results, nil
 }
 
+// layerContentsRequest is the set of files to read from a single layer tar.
+type layerContentsRequest struct {
+	layer *Layer
+	files file.TarContentsRequest
+	// lastSequence is the highest tar sequence of all requested files (no entries after this need to be read).
+	lastSequence int64
+}
+
 // buildTarContentsRequests orders the set of file references for each layer to optimize the image tar reading process
-// to be consisted of only sequential reads, so read requests are only a single pass through the image tar.
-func (c *FileCatalog) buildTarContentsRequests(files ...file.Reference) (map[*Layer]file.TarContentsRequest, error) {
-	allRequests := make(map[*Layer]file.TarContentsRequest)
+// to be consisted of only sequential reads, so read requests are only a single pass through each layer tar (and layer
+// tars are visited in layer order).
+func (c *FileCatalog) buildTarContentsRequests(files ...file.Reference) ([]layerContentsRequest, error) {
+	var requests []layerContentsRequest
+	requestsByLayer := make(map[*Layer]int)
 	for _, f := range files {
 		record, err := c.Get(f)
 		if err != nil {
 			return nil, err
 		}
-		layer := record.Layer
-		if _, ok := allRequests[layer]; !ok {
-			allRequests[layer] = make(file.TarContentsRequest)
+		idx, ok := requestsByLayer[record.Layer]
+		if !ok {
+			idx = len(requests)
+			requestsByLayer[record.Layer] = idx
+			requests = append(requests, layerContentsRequest{
+				layer: record.Layer,
+				files: make(file.TarContentsRequest),
+			})
+		}
+		requests[idx].files[record.Metadata.TarHeaderName] = f
+		if record.Metadata.TarSequence > requests[idx].lastSequence {
+			requests[idx].lastSequence = record.Metadata.TarSequence
 		}
-		allRequests[layer][record.Metadata.TarHeaderName] = f
 	}
-	return allRequests, nil
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].layer.Metadata.Index < requests[j].layer.Metadata.Index
+	})
+
+	return requests, nil
 }
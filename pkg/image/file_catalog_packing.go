@@ -0,0 +1,277 @@
+package image
+
+import (
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+const (
+	// packedPathFromRef indicates the metadata path is the same as the real path of the file reference.
+	packedPathFromRef uint16 = 1 << iota
+	// packedTarHeaderNameFromPath indicates the tar header name is the metadata path without the leading separator.
+	packedTarHeaderNameFromPath
+	// packedTarHeaderNameFromDirPath indicates the tar header name is the metadata path without the leading separator
+	// and with a trailing separator (as is typical for directory entries).
+	packedTarHeaderNameFromDirPath
+	packedIsDir
+	packedHasModTime
+	packedHasAccessTime
+	packedHasChangeTime
+	packedIsBinary
+	packedIsELF
+	// packedSizeIsDevice indicates the size holds the device numbers of a device (which have no contents), where the
+	// major number is held in the upper 32 bits and the minor number in the lower 32 bits.
+	packedSizeIsDevice
+)
+
+// packedTime is a UTC timestamp without the location and monotonic clock information held by a time.Time.
+type packedTime struct {
+	sec  int64
+	nsec int32
+}
+
+func packTime(t time.Time) packedTime {
+	return packedTime{
+		sec:  t.Unix(),
+		nsec: int32(t.Nanosecond()),
+	}
+}
+
+func (t packedTime) unpack() time.Time {
+	return time.Unix(t.sec, int64(t.nsec)).UTC()
+}
+
+// packedFileCatalogEntry is a compact representation of a FileCatalogEntry. Strings that can be derived from other
+// fields are not stored at all (noted by flags) and strings that are commonly shared between entries (such as owner
+// names and link targets) are interned, so that common values are only held in memory once across all entries.
+type packedFileCatalogEntry struct {
+	ref           file.Reference
+	path          string
+	tarHeaderName string
+	linkname      string
+	size          int64
+	tarSequence   int64
+	userID        int
+	groupID       int
+	userName      string
+	groupName     string
+	modTime       packedTime
+	accessTime    packedTime
+	changeTime    packedTime
+	digests       []file.Digest
+	xattrs        map[string]string
+	mimeType      string
+	mode          os.FileMode
+	layer         uint32
+	typeFlag      byte
+	flags         uint16
+}
+
+var packedFileCatalogEntrySize = int64(unsafe.Sizeof(packedFileCatalogEntry{}))
+
+var digestSize = int64(unsafe.Sizeof(file.Digest{}))
+
+// xattrEntrySize is the size of a single extended attribute map entry (the name and value string headers).
+var xattrEntrySize = 2 * int64(unsafe.Sizeof(""))
+
+// stringInterner ensures that equal strings share the same underlying memory.
+type stringInterner struct {
+	values map[string]string
+	bytes  int64
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{
+		values: make(map[string]string),
+	}
+}
+
+func (i *stringInterner) intern(s string) string {
+	if s == "" {
+		return s
+	}
+	if existing, ok := i.values[s]; ok {
+		return existing
+	}
+	i.values[s] = s
+	i.bytes += int64(len(s))
+	return s
+}
+
+func (i *stringInterner) len() int {
+	return len(i.values)
+}
+
+// fileCatalogLayers assigns a compact index to each layer referenced by catalog entries.
+type fileCatalogLayers struct {
+	layers []*Layer
+	index  map[*Layer]uint32
+}
+
+func newFileCatalogLayers() *fileCatalogLayers {
+	return &fileCatalogLayers{
+		index: make(map[*Layer]uint32),
+	}
+}
+
+func (l *fileCatalogLayers) add(layer *Layer) uint32 {
+	idx, ok := l.index[layer]
+	if !ok {
+		idx = uint32(len(l.layers))
+		l.layers = append(l.layers, layer)
+		l.index[layer] = idx
+	}
+	return idx
+}
+
+func (l *fileCatalogLayers) get(idx uint32) *Layer {
+	return l.layers[idx]
+}
+
+func packFileCatalogEntry(entry FileCatalogEntry, layers *fileCatalogLayers, strs *stringInterner) packedFileCatalogEntry {
+	m := entry.Metadata
+	packed := packedFileCatalogEntry{
+		ref:         entry.File,
+		linkname:    strs.intern(m.Linkname),
+		size:        m.Size,
+		tarSequence: m.TarSequence,
+		userID:      m.UserID,
+		groupID:     m.GroupID,
+		userName:    strs.intern(m.UserName),
+		groupName:   strs.intern(m.GroupName),
+		mode:        m.Mode,
+		layer:       layers.add(entry.Layer),
+		typeFlag:    m.TypeFlag,
+		digests:     m.Digests,
+		mimeType:    strs.intern(m.ContentType.MIMEType),
+	}
+
+	if len(m.Xattrs) > 0 {
+		// note: attribute names and values (e.g. SELinux labels) are commonly shared between many entries
+		packed.xattrs = make(map[string]string, len(m.Xattrs))
+		for name, value := range m.Xattrs {
+			packed.xattrs[strs.intern(name)] = strs.intern(value)
+		}
+	}
+
+	if m.Path == string(entry.File.RealPath) {
+		packed.flags |= packedPathFromRef
+	} else {
+		packed.path = m.Path
+	}
+
+	relativePath := strings.TrimPrefix(m.Path, file.DirSeparator)
+	switch {
+	case m.TarHeaderName == relativePath:
+		packed.flags |= packedTarHeaderNameFromPath
+	case m.TarHeaderName == relativePath+file.DirSeparator:
+		packed.flags |= packedTarHeaderNameFromDirPath
+	default:
+		packed.tarHeaderName = m.TarHeaderName
+	}
+
+	if m.IsDir {
+		packed.flags |= packedIsDir
+	}
+	if m.Size == 0 && (m.DevMajor != 0 || m.DevMinor != 0) && fitsUint32(m.DevMajor) && fitsUint32(m.DevMinor) {
+		packed.flags |= packedSizeIsDevice
+		packed.size = m.DevMajor<<32 | m.DevMinor
+	}
+	if m.ContentType.IsBinary {
+		packed.flags |= packedIsBinary
+	}
+	if m.ContentType.IsELF {
+		packed.flags |= packedIsELF
+	}
+	if !m.ModTime.IsZero() {
+		packed.flags |= packedHasModTime
+		packed.modTime = packTime(m.ModTime)
+	}
+	if !m.AccessTime.IsZero() {
+		packed.flags |= packedHasAccessTime
+		packed.accessTime = packTime(m.AccessTime)
+	}
+	if !m.ChangeTime.IsZero() {
+		packed.flags |= packedHasChangeTime
+		packed.changeTime = packTime(m.ChangeTime)
+	}
+
+	return packed
+}
+
+func (p packedFileCatalogEntry) unpack(layers *fileCatalogLayers) FileCatalogEntry {
+	m := file.Metadata{
+		Path:          p.path,
+		TarHeaderName: p.tarHeaderName,
+		TarSequence:   p.tarSequence,
+		Linkname:      p.linkname,
+		Size:          p.size,
+		UserID:        p.userID,
+		GroupID:       p.groupID,
+		UserName:      p.userName,
+		GroupName:     p.groupName,
+		TypeFlag:      p.typeFlag,
+		IsDir:         p.flags&packedIsDir != 0,
+		Mode:          p.mode,
+		Digests:       p.digests,
+		Xattrs:        p.xattrs,
+		ContentType: file.ContentType{
+			MIMEType: p.mimeType,
+			IsBinary: p.flags&packedIsBinary != 0,
+			IsELF:    p.flags&packedIsELF != 0,
+		},
+	}
+
+	if p.flags&packedPathFromRef != 0 {
+		m.Path = string(p.ref.RealPath)
+	}
+
+	if p.flags&packedSizeIsDevice != 0 {
+		m.Size = 0
+		m.DevMajor = int64(uint64(p.size) >> 32)
+		m.DevMinor = p.size & 0xffffffff
+	}
+
+	switch {
+	case p.flags&packedTarHeaderNameFromPath != 0:
+		m.TarHeaderName = strings.TrimPrefix(m.Path, file.DirSeparator)
+	case p.flags&packedTarHeaderNameFromDirPath != 0:
+		m.TarHeaderName = strings.TrimPrefix(m.Path, file.DirSeparator) + file.DirSeparator
+	}
+
+	if p.flags&packedHasModTime != 0 {
+		m.ModTime = p.modTime.unpack()
+	}
+	if p.flags&packedHasAccessTime != 0 {
+		m.AccessTime = p.accessTime.unpack()
+	}
+	if p.flags&packedHasChangeTime != 0 {
+		m.ChangeTime = p.changeTime.unpack()
+	}
+
+	return FileCatalogEntry{
+		File:     p.ref,
+		Metadata: m,
+		Layer:    layers.get(p.layer),
+	}
+}
+
+// memoryBytes is the approximate number of bytes held by the entry (not including interned strings).
+func (p packedFileCatalogEntry) memoryBytes() int64 {
+	size := packedFileCatalogEntrySize + int64(len(p.ref.RealPath)+len(p.path)+len(p.tarHeaderName))
+	for _, digest := range p.digests {
+		size += digestSize + int64(len(digest.Algorithm)+len(digest.Value))
+	}
+	// note: the names and values are interned, only the map entries are held by the entry
+	size += int64(len(p.xattrs)) * xattrEntrySize
+	return size
+}
+
+// fitsUint32 indicates that the given value can be held in 32 bits (unsigned).
+func fitsUint32(v int64) bool {
+	return v >= 0 && v <= 0xffffffff
+}
@@ -0,0 +1,263 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/go-test/deep"
+)
+
+func TestPackFileCatalogEntry_RoundTrip(t *testing.T) {
+	layer := &Layer{Metadata: LayerMetadata{Index: 3}}
+	modTime := time.Date(2020, 10, 1, 12, 30, 45, 123456789, time.UTC)
+
+	tests := []struct {
+		name     string
+		ref      *file.Reference
+		metadata file.Metadata
+	}{
+		{
+			name: "regular file",
+			ref:  file.NewFileReference("/etc/passwd"),
+			metadata: file.Metadata{
+				Path:          "/etc/passwd",
+				TarHeaderName: "etc/passwd",
+				TarSequence:   12,
+				Size:          1024,
+				UserID:        1,
+				GroupID:       2,
+				TypeFlag:      '0',
+				Mode:          0644,
+				ModTime:       modTime,
+			},
+		},
+		{
+			name: "owner names",
+			ref:  file.NewFileReference("/home/app/.profile"),
+			metadata: file.Metadata{
+				Path:          "/home/app/.profile",
+				TarHeaderName: "home/app/.profile",
+				Size:          12,
+				UserID:        1000,
+				GroupID:       1000,
+				UserName:      "app",
+				GroupName:     "staff",
+				TypeFlag:      '0',
+				Mode:          0644,
+			},
+		},
+		{
+			name: "directory",
+			ref:  file.NewFileReference("/etc"),
+			metadata: file.Metadata{
+				Path:          "/etc",
+				TarHeaderName: "etc/",
+				TypeFlag:      '5',
+				IsDir:         true,
+				Mode:          os.ModeDir | 0755,
+				ModTime:       modTime,
+				AccessTime:    modTime.Add(time.Second),
+				ChangeTime:    modTime.Add(time.Minute),
+			},
+		},
+		{
+			name: "symlink",
+			ref:  file.NewFileReference("/bin/sh"),
+			metadata: file.Metadata{
+				Path:          "/bin/sh",
+				TarHeaderName: "./bin/sh",
+				Linkname:      "/bin/busybox",
+				TypeFlag:      '2',
+				Mode:          os.ModeSymlink | 0777,
+			},
+		},
+		{
+			name: "extended attributes",
+			ref:  file.NewFileReference("/bin/ping"),
+			metadata: file.Metadata{
+				Path:          "/bin/ping",
+				TarHeaderName: "bin/ping",
+				TypeFlag:      '0',
+				Mode:          0755,
+				Xattrs: map[string]string{
+					file.CapabilityXattr: "\x01\x00\x00\x02\x00\x20\x00\x00",
+					"user.comment":       "ping",
+				},
+			},
+		},
+		{
+			name: "content type",
+			ref:  file.NewFileReference("/bin/busybox"),
+			metadata: file.Metadata{
+				Path:          "/bin/busybox",
+				TarHeaderName: "bin/busybox",
+				TypeFlag:      '0',
+				Size:          1024,
+				Mode:          0755,
+				ContentType: file.ContentType{
+					MIMEType: "application/x-executable",
+					IsBinary: true,
+					IsELF:    true,
+				},
+			},
+		},
+		{
+			name: "device",
+			ref:  file.NewFileReference("/dev/null"),
+			metadata: file.Metadata{
+				Path:          "/dev/null",
+				TarHeaderName: "dev/null",
+				TypeFlag:      '3',
+				Mode:          os.ModeDevice | os.ModeCharDevice | 0666,
+				DevMajor:      1,
+				DevMinor:      3,
+			},
+		},
+		{
+			name: "path different than reference",
+			ref:  file.NewFileReference("/somepath"),
+			metadata: file.Metadata{
+				Path:          "a",
+				TarHeaderName: "b",
+				Linkname:      "c",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layers := newFileCatalogLayers()
+			expected := FileCatalogEntry{
+				File:     *test.ref,
+				Metadata: test.metadata,
+				Layer:    layer,
+			}
+
+			actual := packFileCatalogEntry(expected, layers, newStringInterner()).unpack(layers)
+
+			for _, d := range deep.Equal(expected, actual) {
+				t.Errorf("diff: %+v", d)
+			}
+		})
+	}
+}
+
+func TestPackFileCatalogEntry_InternsLinknames(t *testing.T) {
+	layers := newFileCatalogLayers()
+	strs := newStringInterner()
+	layer := &Layer{}
+
+	for _, p := range []file.Path{"/bin/sh", "/bin/ls", "/bin/cat"} {
+		packFileCatalogEntry(FileCatalogEntry{
+			File: *file.NewFileReference(p),
+			Metadata: file.Metadata{
+				Path:     string(p),
+				Linkname: fmt.Sprintf("/bin/%s", "busybox"),
+			},
+			Layer: layer,
+		}, layers, strs)
+	}
+
+	if strs.len() != 1 {
+		t.Errorf("expected a single interned string, got %d", strs.len())
+	}
+	if strs.bytes != int64(len("/bin/busybox")) {
+		t.Errorf("unexpected interned bytes: %d", strs.bytes)
+	}
+}
+
+func TestPackFileCatalogEntry_InternsOwnerNames(t *testing.T) {
+	layers := newFileCatalogLayers()
+	strs := newStringInterner()
+	layer := &Layer{}
+
+	var packed []packedFileCatalogEntry
+	for _, p := range []file.Path{"/etc/passwd", "/etc/group", "/etc/shadow"} {
+		packed = append(packed, packFileCatalogEntry(FileCatalogEntry{
+			File: *file.NewFileReference(p),
+			Metadata: file.Metadata{
+				Path:      string(p),
+				UserName:  "root",
+				GroupName: "root",
+			},
+			Layer: layer,
+		}, layers, strs))
+	}
+
+	// the user and group names are the same value, which is held once across all entries
+	if strs.len() != 1 || strs.bytes != int64(len("root")) {
+		t.Errorf("expected a single interned string, got %d (%d bytes)", strs.len(), strs.bytes)
+	}
+	for idx, p := range packed {
+		if m := p.unpack(layers).Metadata; m.UserName != "root" || m.GroupName != "root" {
+			t.Errorf("unexpected owner names for entry=%d: %q/%q", idx, m.UserName, m.GroupName)
+		}
+	}
+}
+
+func TestFileCatalog_Stats(t *testing.T) {
+	catalog := testFileCatalog(t)
+	layer := &Layer{}
+
+	for _, p := range testFilePaths {
+		catalog.Add(*file.NewFileReference(p), file.Metadata{Path: string(p), Linkname: "/shared"}, layer)
+	}
+
+	stats := catalog.Stats()
+	if stats.Entries != len(testFilePaths) {
+		t.Errorf("unexpected entries: %d", stats.Entries)
+	}
+	if stats.InternedStrings != 1 {
+		t.Errorf("unexpected interned strings: %d", stats.InternedStrings)
+	}
+	if stats.MemoryBytes <= 0 {
+		t.Errorf("expected memory usage, got %d", stats.MemoryBytes)
+	}
+	if stats.DiskBytes != 0 {
+		t.Errorf("expected no disk usage, got %d", stats.DiskBytes)
+	}
+}
+
+func heapBytes() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func BenchmarkFileCatalog_Add(b *testing.B) {
+	const entries = 100000
+	layer := &Layer{}
+	modTime := time.Now().UTC()
+
+	var refs []file.Reference
+	for idx := 0; idx < entries; idx++ {
+		refs = append(refs, *file.NewFileReference(file.Path(fmt.Sprintf("/usr/lib/python3.8/site-packages/pkg-%d/file-%d.py", idx/100, idx))))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := heapBytes()
+		catalog := NewFileCatalog("")
+		for idx, ref := range refs {
+			// as with metadata read from a tar, the tar header name and link name are separate allocations
+			catalog.Add(ref, file.Metadata{
+				Path:          string(ref.RealPath),
+				TarHeaderName: fmt.Sprintf("usr/lib/python3.8/site-packages/pkg-%d/file-%d.py", idx/100, idx),
+				Linkname:      fmt.Sprintf("/usr/lib/python3.8/site-packages/shared-%d.py", idx%10),
+				Size:          int64(idx),
+				Mode:          0644,
+				ModTime:       modTime,
+			}, layer)
+		}
+		after := heapBytes()
+
+		b.ReportMetric(float64(after-before)/entries, "heap-bytes/entry")
+		b.ReportMetric(float64(catalog.Stats().MemoryBytes)/entries, "estimated-bytes/entry")
+		runtime.KeepAlive(catalog)
+	}
+}
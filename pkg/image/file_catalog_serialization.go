@@ -0,0 +1,168 @@
+package image
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// fileCatalogSchemaVersion is the version of the persisted file catalog format (bumped on incompatible changes).
+const fileCatalogSchemaVersion = 1
+
+var ErrFileCatalogSchemaVersion = fmt.Errorf("unsupported file catalog schema version")
+
+// savedFileCatalog is the persisted form of a FileCatalog.
+type savedFileCatalog struct {
+	SchemaVersion int
+	Layers        []savedFileCatalogLayer
+	Entries       []savedFileCatalogEntry
+}
+
+// savedFileCatalogLayer is the persisted form of a layer referenced by catalog entries. Only layer content that is
+// on disk (a cached layer tar or a layer blob) can be referenced by path, all other layers cannot provide content
+// once loaded.
+type savedFileCatalogLayer struct {
+	Metadata LayerMetadata
+	TarPath  string
+	BlobPath string
+}
+
+// savedFileCatalogEntry is the persisted form of a single FileCatalogEntry.
+type savedFileCatalogEntry struct {
+	ID       file.ID
+	RealPath file.Path
+	Metadata file.Metadata
+	Layer    int
+}
+
+// Save writes all catalog entries (along with the layers the entries were cataloged from) to the given writer, such
+// that the catalog can be loaded again via LoadFileCatalog (e.g. by another process). File references keep their IDs,
+// so IDs obtained from the original catalog can be used with the loaded catalog. Layer content is not included, only
+// the location of the layer tar or blob on disk (e.g. within the content cache dir); the content must remain at the
+// same location for content requests to succeed with the loaded catalog.
+func (c *FileCatalog) Save(w io.Writer) error {
+	saved := savedFileCatalog{
+		SchemaVersion: fileCatalogSchemaVersion,
+	}
+
+	ids := c.ids()
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	layers := make(map[*Layer]int)
+	for _, id := range ids {
+		entry, err := c.get(id)
+		if err != nil {
+			return fmt.Errorf("unable to save file catalog entry: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+
+		layerIdx, ok := layers[entry.Layer]
+		if !ok {
+			layerIdx = len(saved.Layers)
+			layers[entry.Layer] = layerIdx
+			saved.Layers = append(saved.Layers, newSavedFileCatalogLayer(entry.Layer))
+		}
+
+		saved.Entries = append(saved.Entries, savedFileCatalogEntry{
+			ID:       id,
+			RealPath: entry.File.RealPath,
+			Metadata: entry.Metadata,
+			Layer:    layerIdx,
+		})
+	}
+
+	if err := gob.NewEncoder(w).Encode(saved); err != nil {
+		return fmt.Errorf("unable to save file catalog: %w", err)
+	}
+	return nil
+}
+
+func newSavedFileCatalogLayer(layer *Layer) savedFileCatalogLayer {
+	if layer == nil {
+		return savedFileCatalogLayer{}
+	}
+	saved := savedFileCatalogLayer{
+		Metadata: layer.Metadata,
+	}
+	opener := layer.opener
+	if counting, ok := opener.(countingLayerOpener); ok {
+		opener = counting.LayerOpener
+	}
+	switch opener := opener.(type) {
+	case layerTarOpener:
+		saved.TarPath = opener.path
+	case layerBlobOpener:
+		saved.BlobPath = opener.path
+	}
+	return saved
+}
+
+// LoadFileCatalog reads a catalog previously written with FileCatalog.Save. Metadata queries (and content requests
+// for files within layers that are still on disk) can be answered without reading the image again. Any content
+// requested from the loaded catalog is cached within the given contents cache dir.
+func LoadFileCatalog(r io.Reader, contentsCacheDir string) (FileCatalog, error) {
+	var saved savedFileCatalog
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return FileCatalog{}, fmt.Errorf("unable to load file catalog: %w", err)
+	}
+
+	if saved.SchemaVersion != fileCatalogSchemaVersion {
+		return FileCatalog{}, fmt.Errorf("%w: %d", ErrFileCatalogSchemaVersion, saved.SchemaVersion)
+	}
+
+	layers := make([]*Layer, len(saved.Layers))
+	for idx, savedLayer := range saved.Layers {
+		layers[idx] = restoreFileCatalogLayer(savedLayer)
+	}
+
+	catalog := NewFileCatalog(contentsCacheDir)
+	for _, entry := range saved.Entries {
+		if entry.Layer < 0 || entry.Layer >= len(layers) {
+			return FileCatalog{}, fmt.Errorf("unable to load file catalog: invalid layer=%d for id=%d", entry.Layer, entry.ID)
+		}
+		catalog.Add(*file.RestoreFileReference(entry.ID, entry.RealPath), entry.Metadata, layers[entry.Layer])
+	}
+
+	return catalog, nil
+}
+
+// restoreFileCatalogLayer returns a layer that reads content from where the given persisted layer was located on disk.
+func restoreFileCatalogLayer(saved savedFileCatalogLayer) *Layer {
+	layer := &Layer{
+		Metadata:  saved.Metadata,
+		indexLock: &sync.Mutex{},
+	}
+	switch {
+	case saved.TarPath != "":
+		layer.opener = layerTarOpener{path: saved.TarPath}
+	case saved.BlobPath != "":
+		// note: the compression of the blob is detected upon first read (the recorded media type may not reflect the
+		// blob, e.g. a tar spooled from a docker archive)
+		layer.opener = NewLayerBlobOpener(saved.BlobPath)
+	default:
+		layer.opener = unavailableLayerOpener{digest: saved.Metadata.Digest}
+	}
+	return layer
+}
+
+// unavailableLayerOpener is a LayerOpener for a layer whose content cannot be located (e.g. a layer that was only
+// available as a stream when the file catalog was saved).
+type unavailableLayerOpener struct {
+	digest string
+}
+
+func (o unavailableLayerOpener) Open() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("content for layer=%q is not available", o.digest)
+}
+
+func (o unavailableLayerOpener) OpenExtent(int64, int64) (io.ReadCloser, error) {
+	return o.Open()
+}
@@ -0,0 +1,104 @@
+package image
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/go-test/deep"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestFileCatalog_SaveAndLoad(t *testing.T) {
+	cacheDir := testTempDir(t)
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "contents!"})
+
+	catalog := NewFileCatalog(cacheDir)
+	layer := NewLayer(&fakeLayer{uncompressed: tarBytes, mediaType: types.DockerLayer})
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, cacheDir); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	// an entry from a layer that can only be streamed (which cannot provide content once loaded)
+	streamRef := file.NewFileReference("/streamed.txt")
+	streamLayer := &Layer{
+		Metadata: LayerMetadata{Index: 1, Digest: "sha256:streamed"},
+		opener:   layerStreamOpener((&fakeLayer{uncompressed: tarBytes}).Uncompressed),
+	}
+	catalog.Add(*streamRef, file.Metadata{Path: "/streamed.txt", TarHeaderName: "streamed.txt"}, streamLayer)
+
+	_, ref, err := layer.Tree.File("/some/file.txt")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find file: %+v", err)
+	}
+	expected, err := catalog.Get(*ref)
+	if err != nil {
+		t.Fatalf("could not get entry: %+v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := catalog.Save(&buf); err != nil {
+		t.Fatalf("could not save catalog: %+v", err)
+	}
+
+	loaded, err := LoadFileCatalog(&buf, testTempDir(t))
+	if err != nil {
+		t.Fatalf("could not load catalog: %+v", err)
+	}
+
+	if loaded.Stats().Entries != catalog.Stats().Entries {
+		t.Errorf("unexpected number of entries: %d != %d", loaded.Stats().Entries, catalog.Stats().Entries)
+	}
+
+	actual, err := loaded.GetByID(ref.ID())
+	if err != nil {
+		t.Fatalf("could not get loaded entry: %+v", err)
+	}
+	for _, d := range deep.Equal(expected.File, actual.File) {
+		t.Errorf("file diff: %+v", d)
+	}
+	for _, d := range deep.Equal(expected.Metadata, actual.Metadata) {
+		t.Errorf("metadata diff: %+v", d)
+	}
+	for _, d := range deep.Equal(expected.Layer.Metadata, actual.Layer.Metadata) {
+		t.Errorf("layer metadata diff: %+v", d)
+	}
+
+	reader, err := loaded.OpenByID(ref.ID())
+	if err != nil {
+		t.Fatalf("could not open loaded entry: %+v", err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(contents) != "contents!" {
+		t.Errorf("unexpected contents: %q", string(contents))
+	}
+
+	if _, err := loaded.GetByID(streamRef.ID()); err != nil {
+		t.Errorf("could not get loaded stream entry: %+v", err)
+	}
+	if _, err := loaded.OpenByID(streamRef.ID()); err == nil {
+		t.Errorf("expected an error for content from a layer that is not on disk")
+	}
+
+	// references created after loading must not collide with loaded references
+	if newRef := file.NewFileReference("/new"); newRef.ID() <= streamRef.ID() {
+		t.Errorf("new reference ID=%d collides with loaded references", newRef.ID())
+	}
+}
+
+func TestLoadFileCatalog_SchemaVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(savedFileCatalog{SchemaVersion: fileCatalogSchemaVersion + 1}); err != nil {
+		t.Fatalf("could not encode: %+v", err)
+	}
+
+	if _, err := LoadFileCatalog(&buf, testTempDir(t)); !errors.Is(err, ErrFileCatalogSchemaVersion) {
+		t.Errorf("expected schema version error, got %+v", err)
+	}
+}
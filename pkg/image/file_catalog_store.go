@@ -0,0 +1,456 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fileCatalogStore is the storage backend for all FileCatalogEntries within a FileCatalog.
+type fileCatalogStore interface {
+	// add stores the given entry, cataloged by the ID of the file reference (overwriting any existing entry).
+	add(entry FileCatalogEntry) error
+	// get fetches the entry for the given file ID (returning nil if the ID has not been stored).
+	get(id file.ID) (*FileCatalogEntry, error)
+	// exists indicates if there is an entry for the given file ID.
+	exists(id file.ID) bool
+	// ids returns all file IDs that have been stored.
+	ids() []file.ID
+	// len is the number of entries stored.
+	len() int
+	// stats describes the resources used to store all entries.
+	stats() FileCatalogStats
+	// close releases all resources held by the store (including anything persisted), after which the store is no
+	// longer used.
+	close() error
+}
+
+var _ fileCatalogStore = (*memoryFileCatalogStore)(nil)
+var _ fileCatalogStore = (*boltFileCatalogStore)(nil)
+
+// memoryFileCatalogStore keeps all entries in memory (packed into a compact representation).
+type memoryFileCatalogStore struct {
+	entries map[file.ID]packedFileCatalogEntry
+	layers  *fileCatalogLayers
+	strings *stringInterner
+	bytes   int64
+}
+
+func newMemoryFileCatalogStore() *memoryFileCatalogStore {
+	return &memoryFileCatalogStore{
+		entries: make(map[file.ID]packedFileCatalogEntry),
+		layers:  newFileCatalogLayers(),
+		strings: newStringInterner(),
+	}
+}
+
+func (s *memoryFileCatalogStore) add(entry FileCatalogEntry) error {
+	id := entry.File.ID()
+	if existing, ok := s.entries[id]; ok {
+		s.bytes -= existing.memoryBytes()
+	}
+	packed := packFileCatalogEntry(entry, s.layers, s.strings)
+	s.entries[id] = packed
+	s.bytes += packed.memoryBytes()
+	return nil
+}
+
+func (s *memoryFileCatalogStore) get(id file.ID) (*FileCatalogEntry, error) {
+	packed, ok := s.entries[id]
+	if !ok {
+		return nil, nil
+	}
+	entry := packed.unpack(s.layers)
+	return &entry, nil
+}
+
+func (s *memoryFileCatalogStore) exists(id file.ID) bool {
+	_, ok := s.entries[id]
+	return ok
+}
+
+func (s *memoryFileCatalogStore) ids() []file.ID {
+	ids := make([]file.ID, 0, len(s.entries))
+	for id := range s.entries {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *memoryFileCatalogStore) len() int {
+	return len(s.entries)
+}
+
+func (s *memoryFileCatalogStore) stats() FileCatalogStats {
+	return FileCatalogStats{
+		Entries:         len(s.entries),
+		MemoryBytes:     s.bytes + s.strings.bytes,
+		InternedStrings: s.strings.len(),
+	}
+}
+
+func (s *memoryFileCatalogStore) close() error {
+	return nil
+}
+
+// fileCatalogDBSchemaVersion is the version of the file catalog database format (bumped on incompatible changes).
+const fileCatalogDBSchemaVersion = 1
+
+// boltWriteBatchSize is the number of added entries held in memory before these are written to the database at once
+// (a transaction per entry would be far slower).
+const boltWriteBatchSize = 1024
+
+// bucket names within the file catalog database
+var (
+	boltEntriesBucket = []byte("entries")
+	boltLayersBucket  = []byte("layers")
+	boltMetaBucket    = []byte("meta")
+	boltSchemaKey     = []byte("schema")
+)
+
+var errFileCatalogReadOnly = errors.New("file catalog is read-only")
+
+var boltPendingEntrySize = int64(unsafe.Sizeof(savedFileCatalogEntry{}))
+
+// boltFileCatalogStore keeps all entries within an embedded (bolt) database on disk, where only the layers referenced
+// by entries and a bounded batch of entries not yet written are held in memory. This keeps memory usage flat for
+// images with a very large number of files at the cost of a disk read for each lookup. Entries keep their file IDs
+// and each layer is recorded by the location of its content on disk, so the database can be persisted (see persist)
+// and opened again by another process (see openBoltFileCatalogStore).
+type boltFileCatalogStore struct {
+	db   *bolt.DB
+	path string
+	// readOnly indicates that the store was opened from a persisted database (no entries can be added)
+	readOnly bool
+	// keep indicates that the database file is left in place once the store is closed
+	keep   bool
+	count  int
+	layers *fileCatalogLayers
+	// pending are the entries added since the last write to the database
+	pending map[file.ID]savedFileCatalogEntry
+}
+
+// newBoltFileCatalogStore creates a new store within a new database file within the given directory, which is removed
+// once the store is closed.
+func newBoltFileCatalogStore(dir string) (*boltFileCatalogStore, error) {
+	fh, err := ioutil.TempFile(dir, "file-catalog-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file catalog store: %w", err)
+	}
+	path := fh.Name()
+	fh.Close()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("unable to create file catalog store: %w", err)
+	}
+	// note: the store is private to the catalog until persisted (which syncs a complete copy), so there is nothing to
+	// recover after a crash
+	db.NoSync = true
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltEntriesBucket, boltLayersBucket, boltMetaBucket} {
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltMetaBucket).Put(boltSchemaKey, encodeBoltKey(fileCatalogDBSchemaVersion))
+	})
+	if err != nil {
+		db.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("unable to create file catalog store: %w", err)
+	}
+
+	return &boltFileCatalogStore{
+		db:      db,
+		path:    path,
+		layers:  newFileCatalogLayers(),
+		pending: make(map[file.ID]savedFileCatalogEntry),
+	}, nil
+}
+
+// openBoltFileCatalogStore opens the persisted database at the given path (see persist) for reading. The database may
+// be opened by multiple processes at the same time.
+func openBoltFileCatalogStore(path string) (*boltFileCatalogStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file catalog=%q: %w", path, err)
+	}
+
+	s := &boltFileCatalogStore{
+		db:       db,
+		path:     path,
+		readOnly: true,
+		keep:     true,
+		layers:   newFileCatalogLayers(),
+		pending:  make(map[file.ID]savedFileCatalogEntry),
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		meta, layers, entries := tx.Bucket(boltMetaBucket), tx.Bucket(boltLayersBucket), tx.Bucket(boltEntriesBucket)
+		if meta == nil || layers == nil || entries == nil {
+			return fmt.Errorf("missing buckets")
+		}
+		if version := meta.Get(boltSchemaKey); len(version) != 8 || binary.BigEndian.Uint64(version) != fileCatalogDBSchemaVersion {
+			return ErrFileCatalogSchemaVersion
+		}
+
+		// note: layers are keyed by their index within the catalog, so the cursor visits them in order
+		err := layers.ForEach(func(_, value []byte) error {
+			var saved savedFileCatalogLayer
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&saved); err != nil {
+				return err
+			}
+			s.layers.add(restoreFileCatalogLayer(saved))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		s.count = entries.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open file catalog=%q: %w", path, err)
+	}
+	return s, nil
+}
+
+// encodeBoltKey returns the big endian form of the given value (so that keys are ordered by value).
+func encodeBoltKey(value uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, value)
+	return key
+}
+
+func (s *boltFileCatalogStore) add(entry FileCatalogEntry) error {
+	if s.readOnly {
+		return errFileCatalogReadOnly
+	}
+	id := entry.File.ID()
+	if !s.exists(id) {
+		s.count++
+	}
+	s.pending[id] = savedFileCatalogEntry{
+		ID:       id,
+		RealPath: entry.File.RealPath,
+		Metadata: entry.Metadata,
+		Layer:    int(s.layers.add(entry.Layer)),
+	}
+	if len(s.pending) < boltWriteBatchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush writes all pending entries to the database.
+func (s *boltFileCatalogStore) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEntriesBucket)
+		for id, record := range s.pending {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+				return fmt.Errorf("unable to encode file catalog entry: %w", err)
+			}
+			if err := bucket.Put(encodeBoltKey(uint64(id)), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write file catalog entries: %w", err)
+	}
+	s.pending = make(map[file.ID]savedFileCatalogEntry)
+	return nil
+}
+
+func (s *boltFileCatalogStore) get(id file.ID) (*FileCatalogEntry, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+
+	var entry FileCatalogEntry
+	var err error
+	if record, ok := s.pending[id]; ok {
+		entry, err = s.entry(record)
+	} else {
+		var value []byte
+		err = s.db.View(func(tx *bolt.Tx) error {
+			// note: the value is only valid within the transaction
+			value = append(value, tx.Bucket(boltEntriesBucket).Get(encodeBoltKey(uint64(id)))...)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file catalog entry: %w", err)
+		}
+		if value == nil {
+			return nil, nil
+		}
+		entry, err = s.decode(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// decode returns the entry for the given database value.
+func (s *boltFileCatalogStore) decode(value []byte) (FileCatalogEntry, error) {
+	var record savedFileCatalogEntry
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&record); err != nil {
+		return FileCatalogEntry{}, fmt.Errorf("unable to decode file catalog entry: %w", err)
+	}
+	return s.entry(record)
+}
+
+// entry returns the entry for the given record, referencing the layer the entry was cataloged from.
+func (s *boltFileCatalogStore) entry(record savedFileCatalogEntry) (FileCatalogEntry, error) {
+	if record.Layer < 0 || record.Layer >= len(s.layers.layers) {
+		return FileCatalogEntry{}, fmt.Errorf("invalid layer=%d for file catalog entry=%d", record.Layer, record.ID)
+	}
+	return FileCatalogEntry{
+		File:     *file.RestoreFileReference(record.ID, record.RealPath),
+		Metadata: record.Metadata,
+		Layer:    s.layers.get(uint32(record.Layer)),
+	}, nil
+}
+
+func (s *boltFileCatalogStore) exists(id file.ID) bool {
+	if s.db == nil {
+		return false
+	}
+	if _, ok := s.pending[id]; ok {
+		return true
+	}
+	var found bool
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(boltEntriesBucket).Get(encodeBoltKey(uint64(id))) != nil
+		return nil
+	})
+	return found
+}
+
+func (s *boltFileCatalogStore) ids() []file.ID {
+	ids := make([]file.ID, 0, s.count)
+	if s.db == nil {
+		return ids
+	}
+	for id := range s.pending {
+		ids = append(ids, id)
+	}
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEntriesBucket).ForEach(func(key, _ []byte) error {
+			id := file.ID(binary.BigEndian.Uint64(key))
+			if _, ok := s.pending[id]; !ok {
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	})
+	return ids
+}
+
+// each calls the given function for every entry written to the database (in file ID order).
+func (s *boltFileCatalogStore) each(fn func(FileCatalogEntry)) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEntriesBucket).ForEach(func(_, value []byte) error {
+			entry, err := s.decode(value)
+			if err != nil {
+				return err
+			}
+			fn(entry)
+			return nil
+		})
+	})
+}
+
+func (s *boltFileCatalogStore) len() int {
+	return s.count
+}
+
+func (s *boltFileCatalogStore) stats() FileCatalogStats {
+	var diskBytes int64
+	if info, err := os.Stat(s.path); err == nil {
+		diskBytes = info.Size()
+	}
+	return FileCatalogStats{
+		Entries:     s.count,
+		MemoryBytes: int64(len(s.pending))*boltPendingEntrySize + int64(len(s.layers.layers))*int64(unsafe.Sizeof(&Layer{})),
+		DiskBytes:   diskBytes,
+	}
+}
+
+// persist writes a complete copy of the database to the given path (replacing any existing file), recording each layer
+// as described by the given function, such that the copy can be opened with openBoltFileCatalogStore.
+func (s *boltFileCatalogStore) persist(path string, describe func(*Layer) savedFileCatalogLayer) error {
+	if s.readOnly {
+		return errFileCatalogReadOnly
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltLayersBucket)
+		for idx, layer := range s.layers.layers {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(describe(layer)); err != nil {
+				return fmt.Errorf("unable to encode file catalog layer: %w", err)
+			}
+			if err := bucket.Put(encodeBoltKey(uint64(idx)), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write file catalog layers: %w", err)
+	}
+
+	return file.WriteFileAtomic(path, func(w io.Writer) error {
+		return s.db.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(w)
+			return err
+		})
+	})
+}
+
+func (s *boltFileCatalogStore) close() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	if !s.keep {
+		if removeErr := os.Remove(s.path); err == nil && !os.IsNotExist(removeErr) {
+			err = removeErr
+		}
+	}
+	s.db = nil
+	s.count = 0
+	s.pending = make(map[file.ID]savedFileCatalogEntry)
+	if err != nil {
+		return fmt.Errorf("unable to close file catalog store: %w", err)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package image
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"github.com/go-test/deep"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"io"
 	"io/ioutil"
@@ -12,6 +15,8 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
@@ -167,6 +172,118 @@ func TestFileCatalog_Add(t *testing.T) {
 	}
 }
 
+func TestFileCatalog_DiskBackedStore(t *testing.T) {
+	layer := &Layer{
+		Metadata: LayerMetadata{
+			Index:  1,
+			Digest: "y",
+		},
+	}
+
+	catalog := testFileCatalog(t)
+	catalog.diskStoreThreshold = 2
+
+	var expected []FileCatalogEntry
+	for idx, p := range testFilePaths {
+		ref := file.NewFileReference(p)
+		metadata := file.Metadata{
+			Path:          string(p),
+			TarHeaderName: string(p),
+			Size:          int64(idx),
+			Mode:          0644,
+		}
+		catalog.Add(*ref, metadata, layer)
+		expected = append(expected, FileCatalogEntry{
+			File:     *ref,
+			Metadata: metadata,
+			Layer:    layer,
+		})
+	}
+
+	if _, ok := catalog.store.(*boltFileCatalogStore); !ok {
+		t.Fatalf("expected disk-backed store, got %T", catalog.store)
+	}
+
+	for _, e := range expected {
+		if !catalog.Exists(e.File) {
+			t.Errorf("expected ref to exist: %+v", e.File)
+		}
+
+		actual, err := catalog.Get(e.File)
+		if err != nil {
+			t.Fatalf("could not get by ref: %+v", err)
+		}
+
+		for _, d := range deep.Equal(e, actual) {
+			t.Errorf("diff: %+v", d)
+		}
+	}
+
+	if _, err := catalog.Get(*file.NewFileReference("/missing")); err != ErrFileNotFound {
+		t.Errorf("expected ErrFileNotFound, got %+v", err)
+	}
+
+	// closing removes the database (the catalog is only persisted within a layer tar cache, see WithDiskBackedFileCatalog)
+	entriesPath := catalog.store.(*boltFileCatalogStore).path
+	if err := catalog.close(); err != nil {
+		t.Fatalf("could not close catalog: %+v", err)
+	}
+	if _, err := os.Stat(entriesPath); !os.IsNotExist(err) {
+		t.Errorf("expected the entries file to be removed: %+v", err)
+	}
+	if _, err := catalog.Get(expected[0].File); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound after close, got %+v", err)
+	}
+	if err := catalog.close(); err != nil {
+		t.Errorf("expected closing again to be a no-op: %+v", err)
+	}
+}
+
+func TestFileCatalog_DiskBackedStore_FlatMemory(t *testing.T) {
+	catalog := testFileCatalog(t)
+	catalog.diskStoreThreshold = 1
+	defer catalog.close()
+
+	layer := &Layer{Metadata: LayerMetadata{Digest: "sha256:layer"}}
+	var refs []file.Reference
+	for idx := 0; idx < 5*boltWriteBatchSize; idx++ {
+		ref := file.NewFileReference(file.Path(fmt.Sprintf("/usr/share/doc/file-%d", idx)))
+		catalog.Add(*ref, file.Metadata{Path: string(ref.RealPath), Size: int64(idx)}, layer)
+		refs = append(refs, *ref)
+	}
+	// adding an entry again replaces it
+	catalog.Add(refs[0], file.Metadata{Path: string(refs[0].RealPath), Size: -1}, layer)
+
+	// only a bounded batch of entries is held in memory, regardless of the number of entries
+	stats := catalog.Stats()
+	if stats.Entries != len(refs) {
+		t.Errorf("unexpected number of entries: %d", stats.Entries)
+	}
+	if limit := boltWriteBatchSize * boltPendingEntrySize; stats.MemoryBytes > limit {
+		t.Errorf("unexpected memory usage: %d > %d", stats.MemoryBytes, limit)
+	}
+	if stats.DiskBytes == 0 {
+		t.Errorf("expected entries on disk")
+	}
+	if len(catalog.ids()) != len(refs) {
+		t.Errorf("unexpected number of IDs: %d", len(catalog.ids()))
+	}
+
+	for idx, ref := range refs {
+		entry, err := catalog.Get(ref)
+		if err != nil {
+			t.Fatalf("could not get entry=%d: %+v", idx, err)
+		}
+		expected := int64(idx)
+		if idx == 0 {
+			expected = -1
+		}
+		if entry.Metadata.Size != expected || entry.Layer != layer || entry.File != ref {
+			t.Fatalf("unexpected entry=%d: %+v", idx, entry)
+		}
+	}
+}
+
 type testLayerContent struct {
 	content io.ReadCloser
 }
@@ -211,8 +328,8 @@ func TestFileCatalog_FileContents(t *testing.T) {
 
 	v1Layer := testLayerContent{content: actualReadCloser}
 	layer := &Layer{
-		layer:   &v1Layer,
-		content: v1Layer.Uncompressed,
+		layer:  &v1Layer,
+		opener: layerStreamOpener(v1Layer.Uncompressed),
 	}
 
 	catalog := testFileCatalog(t)
@@ -233,6 +350,69 @@ func TestFileCatalog_FileContents(t *testing.T) {
 	}
 }
 
+func TestFileCatalog_OpenByID(t *testing.T) {
+	actualReadCloser, cleanup := getTarFixture(t, "fixture-1")
+	defer cleanup()
+
+	p := "path/branch/two/file-2.txt"
+	ref := file.NewFileReference(file.Path(p))
+
+	v1Layer := testLayerContent{content: actualReadCloser}
+	layer := &Layer{
+		layer:  &v1Layer,
+		opener: layerStreamOpener(v1Layer.Uncompressed),
+	}
+
+	catalog := testFileCatalog(t)
+	catalog.Add(*ref, file.Metadata{Path: p, TarHeaderName: p}, layer)
+
+	reader, err := catalog.OpenByID(ref.ID())
+	if err != nil {
+		t.Fatalf("could not get contents by id: %+v", err)
+	}
+
+	actual, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read content reader: %+v", err)
+	}
+
+	for _, d := range deep.Equal([]byte("second file\n"), actual) {
+		t.Errorf("diff: %+v", d)
+	}
+
+	missing := file.NewFileReference("/missing")
+	if _, err := catalog.OpenByID(missing.ID()); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected file not found error, got %+v", err)
+	}
+}
+
+func TestFileCatalog_TarHeader(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "contents!"})
+
+	catalog := NewFileCatalog(testTempDir(t))
+	layer := NewLayer(&fakeLayer{uncompressed: tarBytes, mediaType: types.DockerLayer})
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, ""); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	_, ref, err := layer.Tree.File("/some/file.txt")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find file: %+v", err)
+	}
+
+	header, err := catalog.TarHeader(*ref)
+	if err != nil {
+		t.Fatalf("could not get tar header: %+v", err)
+	}
+	if header.Name != "some/file.txt" || header.Size != int64(len("contents!")) {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	if _, err := catalog.TarHeader(*file.NewFileReference("/missing")); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected file not found error, got %+v", err)
+	}
+}
+
 func setupMultipleFileContents(t *testing.T, fileSize int64) (FileCatalog, map[file.Reference]string, []file.Reference) {
 	// a real path & contents from the fixture
 	ref1 := file.NewFileReference("path/branch/one/file-1.txt")
@@ -259,8 +439,8 @@ func setupMultipleFileContents(t *testing.T, fileSize int64) (FileCatalog, map[f
 		layer := &Layer{
 			// note: since this test is using the same tar, it is as if it is a request for two files in the same layer
 
-			layer:   &v1Layer,
-			content: v1Layer.Uncompressed,
+			layer:  &v1Layer,
+			opener: layerStreamOpener(v1Layer.Uncompressed),
 		}
 
 		catalog.Add(ref, metadata, layer)
@@ -324,8 +504,8 @@ func TestFileCatalog_MultipleFileContents_WithCache(t *testing.T) {
 			t.Fatalf("could not read cache file=%+v : %+v", cacheID, err)
 		}
 
-		entry, ok := catalog.catalog[cacheID]
-		if !ok {
+		entry, err := catalog.store.get(cacheID)
+		if err != nil || entry == nil {
 			t.Fatalf("could not find entry for ID=%+v", cacheID)
 		}
 
@@ -342,3 +522,353 @@ func TestFileCatalog_MultipleFileContents_WithCache(t *testing.T) {
 	// ensure contents are expected via the API (not verifying manually)
 	assertMultipleFileContents(t, expected, actual)
 }
+
+func TestFileCatalog_MultipleFileContents_OrderedByLayer(t *testing.T) {
+	catalog := testFileCatalog(t)
+
+	var layers []*Layer
+	var refs []file.Reference
+	for idx := uint(0); idx < 3; idx++ {
+		layer := &Layer{Metadata: LayerMetadata{Index: idx}}
+		layers = append(layers, layer)
+		for seq, p := range []string{"a.txt", "b.txt"} {
+			ref := file.NewFileReference(file.Path(fmt.Sprintf("/%d/%s", idx, p)))
+			catalog.Add(*ref, file.Metadata{TarHeaderName: p, TarSequence: int64(seq)}, layer)
+			refs = append(refs, *ref)
+		}
+	}
+
+	// request the references in reverse order
+	for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+		refs[i], refs[j] = refs[j], refs[i]
+	}
+
+	requests, err := catalog.buildTarContentsRequests(refs...)
+	if err != nil {
+		t.Fatalf("could not build requests: %+v", err)
+	}
+
+	if len(requests) != len(layers) {
+		t.Fatalf("unexpected number of requests: %d", len(requests))
+	}
+
+	for idx, request := range requests {
+		if request.layer != layers[idx] {
+			t.Errorf("unexpected layer order at %d: %+v", idx, request.layer.Metadata)
+		}
+		if len(request.files) != 2 {
+			t.Errorf("unexpected number of files for layer %d: %d", idx, len(request.files))
+		}
+		if request.lastSequence != 1 {
+			t.Errorf("unexpected last sequence for layer %d: %d", idx, request.lastSequence)
+		}
+	}
+}
+
+// readRecordingOpener records the bytes read from each layer tar reader opened.
+type readRecordingOpener struct {
+	LayerOpener
+	reads *[]*ByteCounter
+}
+
+func (o readRecordingOpener) Open() (io.ReadCloser, error) {
+	counter := &ByteCounter{}
+	*o.reads = append(*o.reads, counter)
+	return countingLayerOpener{LayerOpener: o.LayerOpener, counter: counter}.Open()
+}
+
+func TestFileCatalog_MultipleFileContents_StopsAfterLastRequestedEntry(t *testing.T) {
+	// every layer tar ends with a large entry that is never requested (and should never be read)
+	large := strings.Repeat("0123456789", 100000)
+
+	tests := []struct {
+		name     string
+		image    func(t *testing.T) *Image
+		expected map[file.Path]string
+		// unread is the number of bytes at the end of the layer tar that are never requested
+		unread int64
+	}{
+		{
+			name: "directory",
+			image: func(t *testing.T) *Image {
+				root := testTempDir(t)
+				for p, contents := range map[string]string{"a/first.txt": "first", "b/second.txt": "second", "z/large": large} {
+					if err := os.MkdirAll(filepath.Join(root, filepath.Dir(p)), 0755); err != nil {
+						t.Fatalf("could not create dir: %+v", err)
+					}
+					if err := ioutil.WriteFile(filepath.Join(root, p), []byte(contents), 0644); err != nil {
+						t.Fatalf("could not write file: %+v", err)
+					}
+				}
+
+				// as captured by the directory provider (a tar of the dir that the layer is read from directly)
+				tarPath := filepath.Join(testTempDir(t), "rootfs.tar")
+				fh, err := os.Create(tarPath)
+				if err != nil {
+					t.Fatalf("could not create tar: %+v", err)
+				}
+				defer fh.Close()
+				if err := file.WriteDirTar(context.Background(), root, fh, file.DirTarOptions{}); err != nil {
+					t.Fatalf("could not write tar: %+v", err)
+				}
+				if err := fh.Close(); err != nil {
+					t.Fatalf("could not write tar: %+v", err)
+				}
+
+				layer, err := tarball.LayerFromFile(tarPath)
+				if err != nil {
+					t.Fatalf("could not create layer: %+v", err)
+				}
+				img := newTestImage(t, []v1.Layer{layer}, WithLayerOpener(func(v1.Layer) LayerOpener {
+					return NewLayerTarOpener(tarPath)
+				}))
+				if err := img.Read(); err != nil {
+					t.Fatalf("could not read image: %+v", err)
+				}
+				return img
+			},
+			expected: map[file.Path]string{
+				"/a/first.txt":  "first",
+				"/b/second.txt": "second",
+			},
+			unread: int64(len(large)),
+		},
+		{
+			name: "squashfs",
+			image: func(t *testing.T) *Image {
+				// the layer tar (converted from the squashfs image) ends with /usr/app (10000 bytes)
+				blob, err := ioutil.ReadFile("test-fixtures/squashfs/rootfs.sqfs")
+				if err != nil {
+					t.Fatalf("could not read fixture: %+v", err)
+				}
+				img := newTestImage(t, []v1.Layer{squashfsTestLayer{blob: blob}})
+				if err := img.Read(); err != nil {
+					t.Fatalf("could not read image: %+v", err)
+				}
+				return img
+			},
+			expected: map[file.Path]string{
+				"/etc/os-release": "ID=test\n",
+			},
+			unread: 10000,
+		},
+		{
+			name: "nested archive",
+			image: func(t *testing.T) *Image {
+				jar := zipContents(t, map[string]string{"META-INF/MANIFEST.MF": "Main-Class: app.Main"})
+				img := newTestImage(t, []v1.Layer{newTestLayer(t, map[string]string{
+					"app/app.jar": jar,
+					"opt/plain":   "plain",
+					"zz/large":    large,
+				})})
+				if err := img.Read(WithNestedArchives()); err != nil {
+					t.Fatalf("could not read image: %+v", err)
+				}
+				return img
+			},
+			expected: map[file.Path]string{
+				"/app/app.jar!/META-INF/MANIFEST.MF": "Main-Class: app.Main",
+				"/opt/plain":                         "plain",
+			},
+			unread: int64(len(large)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := test.image(t)
+			if len(img.Layers) != 1 || img.Layers[0].opener == nil {
+				t.Fatalf("expected a single layer with a layer tar opener")
+			}
+			layer := img.Layers[0]
+
+			full, err := layer.opener.Open()
+			if err != nil {
+				t.Fatalf("could not open layer tar: %+v", err)
+			}
+			fullSize, err := io.Copy(ioutil.Discard, full)
+			full.Close()
+			if err != nil {
+				t.Fatalf("could not read layer tar: %+v", err)
+			}
+
+			var reads []*ByteCounter
+			layer.opener = readRecordingOpener{LayerOpener: layer.opener, reads: &reads}
+
+			var refs []file.Reference
+			for p := range test.expected {
+				_, ref, err := squashedTreeOf(t, img).File(p)
+				if err != nil || ref == nil {
+					t.Fatalf("could not find path=%q: %+v", p, err)
+				}
+				refs = append(refs, *ref)
+			}
+
+			readers, err := img.FileCatalog.MultipleFileContents(refs...)
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			actual := make(map[file.Path]string)
+			for ref, reader := range readers {
+				contents, err := ioutil.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatalf("could not read contents for path=%q: %+v", ref.RealPath, err)
+				}
+				actual[ref.RealPath] = string(contents)
+			}
+			for _, d := range deep.Equal(actual, test.expected) {
+				t.Errorf("unexpected contents: %s", d)
+			}
+
+			// no read of the layer tar continues past the last requested entry
+			if len(reads) == 0 {
+				t.Fatalf("expected the layer tar to be read")
+			}
+			for idx, counter := range reads {
+				if read := counter.BytesRead().Disk; read > fullSize-test.unread {
+					t.Errorf("read %d of %d layer tar bytes (read %d)", read, fullSize, idx)
+				}
+			}
+		})
+	}
+}
+
+func setupLargeLayerFileCatalog(b *testing.B, count int) (FileCatalog, []file.Reference) {
+	files := make(map[string]string)
+	for i := 0; i < count; i++ {
+		files[fmt.Sprintf("path/file-%d.txt", i)] = fmt.Sprintf("contents of file %d", i)
+	}
+
+	tarPath := filepath.Join(testTempDir(b), "layer.tar")
+	if err := ioutil.WriteFile(tarPath, newTestTar(b, files), 0644); err != nil {
+		b.Fatalf("could not write layer tar: %+v", err)
+	}
+
+	layer := &Layer{opener: layerTarOpener{path: tarPath}}
+	catalog := NewFileCatalog(testTempDir(b))
+
+	fh, err := os.Open(tarPath)
+	if err != nil {
+		b.Fatalf("could not open layer tar: %+v", err)
+	}
+	defer fh.Close()
+
+	var refs []file.Reference
+	for metadata := range file.EnumerateFileMetadataFromTar(fh) {
+		ref := file.NewFileReference(file.Path(metadata.Path))
+		catalog.Add(*ref, metadata, layer)
+		refs = append(refs, *ref)
+	}
+
+	// callers typically request files in an order unrelated to the tar layout
+	for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+		refs[i], refs[j] = refs[j], refs[i]
+	}
+
+	return catalog, refs
+}
+
+func BenchmarkFileCatalog_MultipleFileContents(b *testing.B) {
+	catalog, refs := setupLargeLayerFileCatalog(b, 500)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := catalog.MultipleFileContents(refs...); err != nil {
+				b.Fatalf("could not get contents: %+v", err)
+			}
+		}
+	})
+
+	b.Run("individual", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, ref := range refs {
+				reader, err := catalog.FileContents(ref)
+				if err != nil {
+					b.Fatalf("could not get contents: %+v", err)
+				}
+				reader.Close()
+			}
+		}
+	})
+}
+
+func TestFileCatalog_ConcurrentUse(t *testing.T) {
+	// treat all files as large files (which are cached on disk)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	img := linkedImage(t)
+	_, ref, err := squashedTreeOf(t, img).File("/usr/local.txt")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find file: %+v", err)
+	}
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 8; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := img.FileCatalog.OpenByID(ref.ID())
+			if err != nil {
+				t.Errorf("could not fetch contents: %+v", err)
+				return
+			}
+			defer reader.Close()
+			contents, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Errorf("could not read contents: %+v", err)
+				return
+			}
+			if string(contents) != "usr/local.txt" {
+				t.Errorf("unexpected contents: %q", string(contents))
+			}
+		}()
+	}
+
+	// entries may be added while other goroutines fetch contents
+	var added []file.Reference
+	for _, p := range testFilePaths {
+		added = append(added, *file.NewFileReference(p))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, f := range added {
+			img.FileCatalog.Add(f, file.Metadata{Path: string(f.RealPath)}, nil)
+		}
+	}()
+	wg.Wait()
+
+	if len(img.FileCatalog.contentsCachePath) != 1 {
+		t.Errorf("expected a single cached contents path, got %d", len(img.FileCatalog.contentsCachePath))
+	}
+	for _, f := range added {
+		if !img.FileCatalog.Exists(f) {
+			t.Errorf("expected ref to exist: %+v", f)
+		}
+	}
+}
+
+func TestFileCatalog_Replace_ClosesPreviousStore(t *testing.T) {
+	catalog := testFileCatalog(t)
+	catalog.diskStoreThreshold = 1
+	for _, p := range testFilePaths {
+		catalog.Add(*file.NewFileReference(p), file.Metadata{Path: string(p)}, nil)
+	}
+	entriesPath := catalog.store.(*boltFileCatalogStore).path
+
+	fresh := testFileCatalog(t)
+	ref := file.NewFileReference("/fresh")
+	fresh.Add(*ref, file.Metadata{Path: "/fresh"}, nil)
+
+	catalog.replace(&fresh)
+
+	if _, err := os.Stat(entriesPath); !os.IsNotExist(err) {
+		t.Errorf("expected the replaced entries file to be removed: %+v", err)
+	}
+	if !catalog.Exists(*ref) {
+		t.Errorf("expected the fresh entries to be kept")
+	}
+}
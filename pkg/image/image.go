@@ -1,9 +1,16 @@
 package image
 
 import (
+	"archive/tar"
+	"context"
+	"crypto"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/anchore/stereoscope/pkg/filetree"
 
@@ -13,6 +20,7 @@ import (
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
 	"github.com/wagoodman/go-partybus"
 	"github.com/wagoodman/go-progress"
 )
@@ -23,6 +31,61 @@ type Image struct {
 	image v1.Image
 	// contentCacheDir is where all layer tar cache is stored.
 	contentCacheDir string
+	// layoutPath is the OCI image layout directory that contains all layer blobs (if there is one).
+	layoutPath string
+	// layerOpener selects the source of the uncompressed tar content for each layer (when not using the default).
+	layerOpener LayerOpenerFn
+	// indexFilter restricts which paths are indexed within each layer (all paths when empty).
+	indexFilter indexPathFilter
+	// exclusions are the paths that are never indexed within each layer (no paths when empty).
+	exclusions pathExclusions
+	// tarEntryPolicy determines how unsupported tar entries and malformed headers are handled within each layer.
+	tarEntryPolicy file.TarEntryPolicy
+	// pathPolicy determines how tar entries with suspicious names are handled within each layer (see WithPathPolicy).
+	pathPolicy file.PathPolicy
+	// skipSquash indicates that no squash trees should be created (only the layer diff trees).
+	skipSquash bool
+	// squashPolicy determines how the layer trees are combined into the squash trees (see WithSquashPolicy).
+	squashPolicy SquashPolicy
+	// layerOrderPolicy determines how a disagreement between the manifest layer order and the config diff IDs is handled.
+	layerOrderPolicy LayerOrderPolicy
+	// lazyLayers indicates that layer tars are only read upon first access (see WithLazyLayers).
+	lazyLayers bool
+	// indexed indicates that all layer tars have been read and the squash trees have been created.
+	indexed bool
+	// indexErr is the error that lazily indexing all layers failed with after the layer trees were modified (see
+	// IndexLayers), which is returned for all later attempts.
+	indexErr error
+	// layerConcurrency is the number of layers read at the same time (layers are read sequentially when not above one).
+	layerConcurrency int
+	// fileDigests are the hash algorithms to digest the contents of each regular file with (none when empty).
+	fileDigests []crypto.Hash
+	// sniffContentTypes indicates that the content type of each regular file is sniffed while reading layer tars.
+	sniffContentTypes bool
+	// contentSearch is the set of keywords to search the contents of each regular file for (see WithContentSearch).
+	contentSearch *contentSearch
+	// streamLayers indicates that uncompressed layer tars are never persisted (see WithStreamingLayers).
+	streamLayers bool
+	// tempWriteHook observes (and may veto or redirect) each temp artifact written while reading the image.
+	tempWriteHook TempWriteHook
+	// blobRangeFetcher selects how ranges of each compressed layer blob are fetched (nil when not supported by the source).
+	blobRangeFetcher BlobRangeFetcherFn
+	// layerDigestPolicy determines how layer content that does not match the recorded digests is handled.
+	layerDigestPolicy LayerDigestPolicy
+	// layerCache is where layer blobs are cached across images (nil when not caching layers, see WithLayerCache).
+	layerCache cache.Cache
+	// uncachedImage is the image as provided, before reading through the layer cache (nil when not caching layers).
+	uncachedImage v1.Image
+	// layerTarCache is where layer tars and indexes are cached across images (nil when not caching, see
+	// WithLayerTarCache).
+	layerTarCache *LayerTarCache
+	// cacheFileCatalog indicates that the file catalog is persisted within the layer tar cache once all layers are
+	// indexed (see WithDiskBackedFileCatalog).
+	cacheFileCatalog bool
+	// seekableLayers indicates that eStargz layers are read by range instead of entirely (see WithSeekableLayers).
+	seekableLayers bool
+	// nestedArchives indicates that the entries of archives within layers are indexed (see WithNestedArchives).
+	nestedArchives bool
 	// Metadata contains select image attributes
 	Metadata Metadata
 	// Layers contains the rich layer objects in build order
@@ -31,6 +94,26 @@ type Image struct {
 	FileCatalog FileCatalog
 
 	overrideMetadata []AdditionalMetadata
+	// provider is where the image was obtained from (used to refresh the image)
+	provider Provider
+	// sourceDetection is how the source was detected (nil when the source was selected explicitly)
+	sourceDetection *SourceDetection
+	// readOptions are the options last used to read the image (used to refresh the image)
+	readOptions []ReadOption
+	// cleanup removes all temp dirs of the image (nil when the image has no temp dirs of its own, see WithCleanup)
+	cleanup func() error
+	// tempDirs is the generator of all temp dirs of the image (nil when not known, see WithTempDirs)
+	tempDirs *file.TempDirGenerator
+	// lock guards the read state (the layers, the squash trees, and the metadata) while it is lazily indexed (see
+	// IndexLayers). Refresh replaces the read state without the lock, since it must not run concurrently with any other
+	// use of the image.
+	lock sync.Mutex
+	// stats is the summary of the image and layer trees (computed on first use)
+	stats *Stats
+	// bytesRead tracks all bytes read for the image (by the provider and for layer content)
+	bytesRead *ByteCounter
+	// bytesReadHooks are notified of all bytes read for the image
+	bytesReadHooks []BytesReadHook
 }
 
 type AdditionalMetadata func(*Image) error
@@ -65,6 +148,15 @@ func WithManifestDigest(digest string) AdditionalMetadata {
 	}
 }
 
+// WithLayoutBlobs indicates that the layer blobs are available within the given OCI image layout directory, so layers
+// can be read directly from the blobs instead of making an uncompressed copy of each layer in the content cache dir.
+func WithLayoutBlobs(layoutPath string) AdditionalMetadata {
+	return func(image *Image) error {
+		image.layoutPath = layoutPath
+		return nil
+	}
+}
+
 func WithConfig(config []byte) AdditionalMetadata {
 	return func(image *Image) error {
 		image.Metadata.RawConfig = config
@@ -80,10 +172,19 @@ func NewImage(image v1.Image, contentCacheDir string, additionalMetadata ...Addi
 		contentCacheDir:  contentCacheDir,
 		FileCatalog:      NewFileCatalog(contentCacheDir),
 		overrideMetadata: additionalMetadata,
+		bytesRead:        NewByteCounter(),
 	}
 	return imgObj
 }
 
+// layerCacheDir is where uncompressed layer tars are cached (none when layers are streamed).
+func (i *Image) layerCacheDir() string {
+	if i.streamLayers {
+		return ""
+	}
+	return i.contentCacheDir
+}
+
 func (i *Image) IDs() []string {
 	var ids = make([]string, len(i.Metadata.Tags))
 	for idx, t := range i.Metadata.Tags {
@@ -117,11 +218,33 @@ func (i *Image) applyOverrideMetadata() error {
 	return nil
 }
 
+func (i *Image) applyReadOptions(options []ReadOption) error {
+	for _, optionFn := range options {
+		if err := optionFn(i); err != nil {
+			return fmt.Errorf("unable to apply read option: %w", err)
+		}
+	}
+	return nil
+}
+
 // Read parses information from the underlying image tar into this struct. This includes image metadata, layer
 // metadata, layer file trees, and layer squash trees (which implies the image squash tree).
-func (i *Image) Read() error {
+func (i *Image) Read(options ...ReadOption) error {
+	return i.ReadWithContext(context.Background(), options...)
+}
+
+// ReadWithContext is the same as Read, however, reading is aborted (returning the context error) once the given
+// context is done. Note: an image that failed to be read should not be used.
+func (i *Image) ReadWithContext(ctx context.Context, options ...ReadOption) error {
 	var layers = make([]*Layer, 0)
 	var err error
+
+	i.bytesReadHooks = nil
+	if err = i.applyReadOptions(options); err != nil {
+		return err
+	}
+	i.readOptions = options
+
 	i.Metadata, err = readImageMetadata(i.image)
 	if err != nil {
 		return err
@@ -131,6 +254,8 @@ func (i *Image) Read() error {
 	if err = i.applyOverrideMetadata(); err != nil {
 		return err
 	}
+	i.Metadata.Origin.Detection = i.sourceDetection
+	i.bytesRead.addHooks(i.bytesReadHooks...)
 
 	log.Debugf("image metadata: digest=%+v mediaType=%+v tags=%+v",
 		i.Metadata.ID,
@@ -145,49 +270,322 @@ func (i *Image) Read() error {
 	// let consumers know of a monitorable event (image save + copy stages)
 	readProg := i.trackReadProgress(i.Metadata)
 
+	switch {
+	case i.lazyLayers:
+		layers, err = i.readLayersLazily(v1Layers)
+	case i.layerConcurrency > 1 && len(v1Layers) > 1:
+		layers, err = i.readLayersConcurrently(ctx, v1Layers, readProg)
+	default:
+		layers, err = i.readLayers(ctx, v1Layers, readProg)
+	}
+	if err != nil {
+		return err
+	}
+
+	i.stats = nil
+	i.indexed = false
+
+	if i.lazyLayers {
+		i.Layers = layers
+		readProg.SetCompleted()
+		i.Metadata.BytesRead = i.bytesRead.BytesRead()
+		return nil
+	}
+
+	layers, err = i.applyLayerOrderPolicy(layers)
+	if err != nil {
+		return err
+	}
+
+	i.Layers = layers
+
+	// in order to resolve symlinks all squashed trees must be available
+	if err = i.squash(readProg); err != nil {
+		return err
+	}
+	if i.nestedArchives {
+		if err = i.indexNestedArchives(ctx); err != nil {
+			return err
+		}
+	}
+	i.indexed = true
+	i.putCachedFileCatalog()
+
+	i.Metadata.BytesRead = i.bytesRead.BytesRead()
+	return nil
+}
+
+// readLayers reads all layers in order, one at a time.
+func (i *Image) readLayers(ctx context.Context, v1Layers []v1.Layer, prog *progress.Manual) ([]*Layer, error) {
+	var layers = make([]*Layer, 0, len(v1Layers))
 	for idx, v1Layer := range v1Layers {
-		layer := NewLayer(v1Layer)
-		err := layer.Read(&i.FileCatalog, i.Metadata, idx, i.contentCacheDir)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		layer := i.newLayer(v1Layer)
+		err := layer.read(ctx, &i.FileCatalog, i.Metadata, idx, i.layerCacheDir())
 		if err != nil {
-			return err
+			return nil, err
 		}
 		i.Metadata.Size += layer.Metadata.Size
 		layers = append(layers, layer)
 
-		readProg.N++
+		prog.N++
 	}
+	return layers, nil
+}
 
-	i.Layers = layers
-
-	// in order to resolve symlinks all squashed trees must be available
-	return i.squash(readProg)
+// readLayersLazily only reads the metadata for all layers (see WithLazyLayers).
+func (i *Image) readLayersLazily(v1Layers []v1.Layer) ([]*Layer, error) {
+	var layers = make([]*Layer, 0, len(v1Layers))
+	for idx, v1Layer := range v1Layers {
+		layer := i.newLayer(v1Layer)
+		layer.squashLazily = i.IndexLayers
+		if err := layer.readLazily(&i.FileCatalog, i.Metadata, idx, i.layerCacheDir()); err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
 }
 
-// squash generates a squash tree for each layer in the image. For instance, layer 2 squash =
-// squash(layer 0, layer 1, layer 2), layer 3 squash = squash(layer 0, layer 1, layer 2, layer 3), and so on.
-func (i *Image) squash(prog *progress.Manual) error {
-	var lastSquashTree *filetree.FileTree
+// readLayersConcurrently reads all layers with a pool of workers (see WithLayerConcurrency). The file catalog entries
+// for each layer are added in layer order once all layers have been read, so the result is the same as reading the
+// layers one at a time. The first layer to fail stops all other workers.
+func (i *Image) readLayersConcurrently(ctx context.Context, v1Layers []v1.Layer, prog *progress.Manual) ([]*Layer, error) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var layers = make([]*Layer, len(v1Layers))
+	var errs = make([]error, len(v1Layers))
+	var progLock sync.Mutex
+	var wg sync.WaitGroup
+
+	workers := i.layerConcurrency
+	if workers > len(v1Layers) {
+		workers = len(v1Layers)
+	}
 
-	for idx, layer := range i.Layers {
-		if idx == 0 {
-			lastSquashTree = layer.Tree
-			layer.SquashedTree = layer.Tree
+	indexes := make(chan int, len(v1Layers))
+	for idx := range v1Layers {
+		indexes <- idx
+	}
+	close(indexes)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				if workerCtx.Err() != nil {
+					return
+				}
+
+				layer := i.newLayer(v1Layers[idx])
+				layer.bufferEntries = true
+				if err := layer.read(workerCtx, &i.FileCatalog, i.Metadata, idx, i.layerCacheDir()); err != nil {
+					errs[idx] = err
+					cancel()
+					return
+				}
+				layers[idx] = layer
+
+				progLock.Lock()
+				prog.N++
+				progLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// report the failure that stopped the other workers, not the cancellation of the other workers
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
 			continue
 		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	for _, layer := range layers {
+		layer.addPendingEntries()
+		i.Metadata.Size += layer.Metadata.Size
+	}
+	return layers, nil
+}
+
+// IndexLayers reads all layer tars into the layer trees and the file catalog and creates the squash trees, unless this
+// has already been done. This is only needed for images read with WithLazyLayers, where this is otherwise done upon
+// first access of the squash trees (e.g. SquashedTree or FileContentsFromSquash). This is safe to call concurrently.
+// Once indexing fails after the layer trees were modified, the same error is returned for all later calls (the trees
+// may be partially populated). Note: the layer order check (see WithLayerOrderPolicy) requires the content of every
+// layer, so this is not done for lazily read images.
+func (i *Image) IndexLayers(ctx context.Context) error {
+	if !i.lazyLayers {
+		return nil
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.indexed {
+		return nil
+	}
+	if i.indexErr != nil {
+		return i.indexErr
+	}
+
+	var size int64
+	for _, layer := range i.Layers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// note: each layer remembers its own indexing failure
+		if err := layer.index(ctx); err != nil {
+			return err
+		}
+		size += layer.Metadata.Size
+	}
+	i.Metadata.Size = size
+	i.stats = nil
+
+	if err := i.squashAndIndexNestedArchives(ctx); err != nil {
+		i.indexErr = err
+		return err
+	}
+	i.indexed = true
+	i.putCachedFileCatalog()
+
+	i.Metadata.BytesRead = i.bytesRead.BytesRead()
+	return nil
+}
+
+// putCachedFileCatalog persists the file catalog within the layer tar cache (see WithDiskBackedFileCatalog), where
+// failing to do so does not fail reading the image.
+func (i *Image) putCachedFileCatalog() {
+	if !i.cacheFileCatalog || i.layerTarCache == nil || i.Metadata.ID == "" {
+		return
+	}
+	if err := i.layerTarCache.putFileCatalog(i.Metadata.ID, &i.FileCatalog); err != nil {
+		log.Warnf("unable to add the file catalog to the layer tar cache: %+v", err)
+	}
+}
+
+// squashAndIndexNestedArchives creates the squash trees of all indexed layers and, if enabled, indexes the archives
+// nested within the layers.
+func (i *Image) squashAndIndexNestedArchives(ctx context.Context) error {
+	if err := i.squash(&progress.Manual{}); err != nil {
+		return err
+	}
+	if i.nestedArchives {
+		return i.indexNestedArchives(ctx)
+	}
+	return nil
+}
+
+// newLayer creates an unread layer for the given layer from the GCR lib, configured by the image read options.
+func (i *Image) newLayer(v1Layer v1.Layer) *Layer {
+	layer := NewLayer(v1Layer)
+	layer.opener = i.layerOpenerFor(v1Layer)
+	layer.indexFilter = i.indexFilter
+	layer.exclusions = i.exclusions
+	layer.tarEntryPolicy = i.tarEntryPolicy
+	layer.pathPolicy = i.pathPolicy
+	layer.digestHashes = i.fileDigests
+	layer.sniffContentTypes = i.sniffContentTypes
+	layer.contentSearch = i.contentSearch
+	layer.tempWriteHook = i.tempWriteHook
+	layer.digestPolicy = i.layerDigestPolicy
+	layer.tarCache = i.layerTarCache
+	if i.seekableLayers && i.blobRangeFetcher != nil {
+		layer.rangeFetcher = i.blobRangeFetcher(v1Layer)
+	}
+	layer.bytesRead = i.bytesRead
+	// registry layer content is transferred on demand, where the provider records the bytes downloaded instead
+	layer.countSourceReads = i.Metadata.Origin.Source != RegistrySource
+	return layer
+}
 
-		var unionTree = filetree.NewUnionFileTree()
-		unionTree.PushTree(lastSquashTree)
-		unionTree.PushTree(layer.Tree)
+// BytesRead returns the bytes read for the image so far (by the provider, while reading the image, and for any file
+// contents fetched since).
+func (i *Image) BytesRead() BytesRead {
+	return i.bytesRead.BytesRead()
+}
 
-		squashedTree, err := unionTree.Squash()
+// layerOpenerFor returns the LayerOpener for the given layer, or nil if the layer should be read (and cached) via the
+// GCR lib.
+func (i *Image) layerOpenerFor(layer v1.Layer) LayerOpener {
+	if i.layerOpener != nil {
+		if opener := i.layerOpener(layer); opener != nil {
+			return opener
+		}
+	}
+	if blobPath := i.layoutBlobPath(layer); blobPath != "" {
+		// there is no need to duplicate a blob that is already on disk, read from it directly (decompressing as indicated
+		// by the media type within the manifest)
+		mediaType, err := layer.MediaType()
 		if err != nil {
-			return fmt.Errorf("failed to squash tree %d: %w", idx, err)
+			mediaType = ""
 		}
+		return countingLayerOpener{LayerOpener: newLayerBlobOpener(blobPath, mediaType), counter: i.bytesRead}
+	}
+	return nil
+}
 
-		layer.SquashedTree = squashedTree
-		lastSquashTree = squashedTree
+// layoutBlobPath returns the path to the given layer blob within the OCI image layout (or an empty string if there is
+// no layout or the blob could not be found).
+func (i *Image) layoutBlobPath(layer v1.Layer) string {
+	if i.layoutPath == "" {
+		return ""
+	}
 
-		prog.N++
+	digest, err := layer.Digest()
+	if err != nil {
+		log.Debugf("unable to determine layer digest (will use layer cache): %+v", err)
+		return ""
+	}
+
+	blobPath := filepath.Join(i.layoutPath, "blobs", digest.Algorithm, digest.Hex)
+	if _, err := os.Stat(blobPath); err != nil {
+		log.Debugf("unable to find layer blob=%q (will use layer cache): %+v", blobPath, err)
+		return ""
+	}
+	return blobPath
+}
+
+// squash generates a squash tree for each layer in the image. For instance, layer 2 squash =
+// squash(layer 0, layer 1, layer 2), layer 3 squash = squash(layer 0, layer 1, layer 2, layer 3), and so on (as tailored
+// by the squash policy).
+func (i *Image) squash(prog *progress.Manual) error {
+	if i.skipSquash {
+		for _, layer := range i.Layers {
+			layer.SquashedTree = filetree.NewFileTree()
+		}
+		prog.SetCompleted()
+		return nil
+	}
+
+	err := i.squashPolicy.squash(i.Layers, func(idx int, squashedTree *filetree.FileTree) {
+		i.Layers[idx].SquashedTree = squashedTree
+		if idx > 0 {
+			prog.N++
+		}
+	})
+	if err != nil {
+		return err
 	}
 
 	prog.SetCompleted()
@@ -195,8 +593,28 @@ func (i *Image) squash(prog *progress.Manual) error {
 	return nil
 }
 
-// SquashedTree returns the pre-computed image squash file tree.
+// SquashedTree returns the pre-computed image squash file tree. For lazily read images all layers are indexed first,
+// where an empty tree is returned if this fails (see SquashedTreeWithError or IndexLayers to handle the error instead).
 func (i *Image) SquashedTree() *filetree.FileTree {
+	tree, err := i.SquashedTreeWithError()
+	if err != nil {
+		log.Errorf("%+v", err)
+		return filetree.NewFileTree()
+	}
+	return tree
+}
+
+// SquashedTreeWithError is the same as SquashedTree, however, an error is returned if indexing the layers of a lazily
+// read image fails.
+func (i *Image) SquashedTreeWithError() (*filetree.FileTree, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, fmt.Errorf("unable to index layers for image=%q: %w", i.Metadata.ID, err)
+	}
+	return i.squashedTree(), nil
+}
+
+// squashedTree returns the image squash file tree, which must already be indexed (see IndexLayers).
+func (i *Image) squashedTree() *filetree.FileTree {
 	layerCount := len(i.Layers)
 
 	if layerCount == 0 {
@@ -207,25 +625,167 @@ func (i *Image) SquashedTree() *filetree.FileTree {
 	return topLayer.SquashedTree
 }
 
-// FileContentsFromSquash fetches file contents for a single path, relative to the image squash tree.
-// If the path does not exist an error is returned.
-func (i *Image) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
-	return fetchFileContentsByPath(i.SquashedTree(), &i.FileCatalog, path)
+// FileContentsFromSquash fetches file contents for a single path, relative to the image squash tree. Links are
+// resolved regardless of the layer that the link or its target was added in, including chains of links and relative
+// links. If the path does not exist an error is returned, where a path that is a dead link results in an ErrDeadLink
+// error. Given filetree.DoNotFollowDeadBasenameLinks, the contents of the last link before the dead end are returned
+// instead (which are empty for symlinks).
+func (i *Image) FileContentsFromSquash(path file.Path, options ...filetree.LinkResolutionOption) (io.ReadCloser, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+	return fetchFileContentsByPath(i.squashedTree(), &i.FileCatalog, path, options...)
 }
 
 // MultipleFileContentsFromSquash fetches file contents for all given paths, relative to the image squash tree.
 // If any one path does not exist an error is returned for the entire request.
 func (i *Image) MultipleFileContentsFromSquash(paths ...file.Path) (map[file.Reference]io.ReadCloser, error) {
-	return fetchMultipleFileContentsByPath(i.SquashedTree(), &i.FileCatalog, paths...)
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+	return fetchMultipleFileContentsByPath(i.squashedTree(), &i.FileCatalog, paths...)
+}
+
+// MultipleFileContentsFromSquashWithLimits is the same as MultipleFileContentsFromSquash, however, the contents of each
+// file are cut short according to the given limits (see FileCatalog.MultipleFileContentsWithLimits).
+func (i *Image) MultipleFileContentsFromSquashWithLimits(limits ContentLimits, paths ...file.Path) (map[file.Reference]LimitedFileContents, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+	refs, err := resolveContentReferences(i.squashedTree(), &i.FileCatalog, paths...)
+	if err != nil {
+		return nil, err
+	}
+	return i.FileCatalog.MultipleFileContentsWithLimits(context.Background(), limits, refs...)
+}
+
+// FileMetadataFromSquash returns the file metadata (see FileCatalog.Metadata) for a single path, relative to the image
+// squash tree. Ancestor links are always resolved, however, a path that is a link describes the link itself (including
+// the link target) unless filetree.FollowBasenameLinks is given. If the path does not exist an error is returned.
+func (i *Image) FileMetadataFromSquash(path file.Path, options ...filetree.LinkResolutionOption) (file.Metadata, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return file.Metadata{}, err
+	}
+	exists, ref, err := i.squashedTree().File(path, options...)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	if !exists || ref == nil {
+		return file.Metadata{}, fmt.Errorf("%w: path=%q", ErrFileNotFound, path)
+	}
+	return i.FileCatalog.Metadata(*ref)
+}
+
+// SquashedListing describes all paths within the image squash tree along with the size and digest of each file (see
+// filetree.Listing for the stable JSON form). Digests are only included for images read with WithFileDigests.
+func (i *Image) SquashedListing() (filetree.Listing, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return filetree.Listing{}, err
+	}
+	return i.squashedTree().Listing(func(ref file.Reference) (*file.Metadata, error) {
+		entry, err := i.FileCatalog.Get(ref)
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &entry.Metadata, nil
+	})
+}
+
+// FilesByGlobFromSquash returns all files matching the given glob pattern (e.g. "**/*.so"), relative to the image
+// squash tree (considers symlinks).
+func (i *Image) FilesByGlobFromSquash(pattern string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+	return i.squashedTree().FilesByGlob(pattern, options...)
+}
+
+// FilesByMIMEType returns all files with any of the given MIME types (e.g. "application/x-executable"), relative to
+// the image squash tree (files overwritten or deleted in later layers are not included), sorted by path. This requires
+// the image to be read with WithContentTypes.
+func (i *Image) FilesByMIMEType(mimeTypes ...string) ([]file.Reference, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+
+	tree := i.squashedTree()
+	var refs []file.Reference
+	for _, ref := range i.FileCatalog.FilesByMIMEType(mimeTypes...) {
+		_, visible, err := tree.File(ref.RealPath)
+		if err != nil {
+			return nil, err
+		}
+		if visible != nil && visible.ID() == ref.ID() {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// FilesByGlobFromLayer returns all files matching the given glob pattern (e.g. "**/*.so"), relative to the diff tree of
+// the layer at the given index (see Layer.FilesByGlobFromSquash for the layer squash tree).
+func (i *Image) FilesByGlobFromLayer(layer int, pattern string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	if layer < 0 || layer >= len(i.Layers) {
+		return nil, fmt.Errorf("invalid layer index=%d (image has %d layers)", layer, len(i.Layers))
+	}
+	return i.Layers[layer].FilesByGlob(pattern, options...)
+}
+
+// SquashedTreeAtLayer returns the squash tree of the layer at the given index, which is the filesystem as of that layer
+// (the combination of the diff trees of the layer and all lower layers, see Layer.SquashedTree). For lazily read images
+// all layers are indexed first. An error is returned if the image was read without squash trees (see WithoutSquash).
+func (i *Image) SquashedTreeAtLayer(layer int) (*filetree.FileTree, error) {
+	if layer < 0 || layer >= len(i.Layers) {
+		return nil, fmt.Errorf("invalid layer index=%d (image has %d layers)", layer, len(i.Layers))
+	}
+	if i.skipSquash {
+		return nil, fmt.Errorf("image was read without squash trees")
+	}
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+	return i.Layers[layer].SquashedTree, nil
 }
 
 // FileContentsByRef fetches file contents for a single file reference, irregardless of the source layer.
 // If the path does not exist an error is returned.
 // This is a convenience function provided by the FileCatalog.
+//
+// Deprecated: use FileContentsByReference instead.
 func (i *Image) FileContentsByRef(ref file.Reference) (io.ReadCloser, error) {
 	return i.FileCatalog.FileContents(ref)
 }
 
+// FileContentsByReference fetches file contents for a single file reference directly from the layer the file was
+// cataloged from, without resolving the path again (so references from earlier queries, such as globs, walks, or
+// tree diffs, can be used as-is). An ErrFileNotFound error is returned if the reference is not within the image.
+// Compressed contents are decompressed when the image was read with WithDecompressedContents.
+func (i *Image) FileContentsByReference(ref file.Reference) (io.ReadCloser, error) {
+	reader, err := i.FileCatalog.OpenByID(ref.ID())
+	if err != nil {
+		return nil, err
+	}
+	if i.FileCatalog.decompressContents {
+		return decompressedContents(reader)
+	}
+	return reader, nil
+}
+
+// SeekableFileContentsByReference provides random access to the contents of the given file reference (see
+// FileCatalog.OpenSeekableByID). An ErrFileNotFound error is returned if the reference is not within the image.
+func (i *Image) SeekableFileContentsByReference(ref file.Reference) (SeekableContents, error) {
+	return i.FileCatalog.OpenSeekableByID(ref.ID())
+}
+
+// TarHeaderByReference returns the raw tar header for the given file reference from the layer the file was cataloged
+// from. This is a convenience function provided by the FileCatalog.
+func (i *Image) TarHeaderByReference(ref file.Reference) (*tar.Header, error) {
+	return i.FileCatalog.TarHeader(ref)
+}
+
 // FileContentsByRef fetches file contents for all file references given, irregardless of the source layer.
 // If any one path does not exist an error is returned for the entire request.
 func (i *Image) MultipleFileContentsByRef(refs ...file.Reference) (map[file.Reference]io.ReadCloser, error) {
@@ -236,6 +796,9 @@ func (i *Image) MultipleFileContentsByRef(refs ...file.Reference) (map[file.Refe
 // the layer squash of the given layer index argument.
 // If the given file reference is not a link type, or is a unresolvable (dead) link, then the given file reference is returned.
 func (i *Image) ResolveLinkByLayerSquash(ref file.Reference, layer int, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
 	allOptions := append([]filetree.LinkResolutionOption{filetree.FollowBasenameLinks}, options...)
 	_, resolvedRef, err := i.Layers[layer].SquashedTree.File(ref.RealPath, allOptions...)
 	return resolvedRef, err
@@ -244,6 +807,9 @@ func (i *Image) ResolveLinkByLayerSquash(ref file.Reference, layer int, options
 // ResolveLinkByLayerSquash resolves a symlink or hardlink for the given file reference relative to the result from the image squash.
 // If the given file reference is not a link type, or is a unresolvable (dead) link, then the given file reference is returned.
 func (i *Image) ResolveLinkByImageSquash(ref file.Reference, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
 	allOptions := append([]filetree.LinkResolutionOption{filetree.FollowBasenameLinks}, options...)
 	_, resolvedRef, err := i.Layers[len(i.Layers)-1].SquashedTree.File(ref.RealPath, allOptions...)
 	return resolvedRef, err
@@ -1,6 +1,9 @@
 package image
 
 import (
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	v1Types "github.com/google/go-containerregistry/pkg/v1/types"
@@ -11,14 +14,89 @@ type Metadata struct {
 	// ID is the sha256 of this image config json (not manifest)
 	ID string
 	// Size in bytes of all the image layer content sizes (does not include config / manifest / index metadata sizes)
-	Size      int64
-	Config    v1.ConfigFile
+	Size int64
+	// Config is the parsed image config, including the runtime config of containers from the image (e.g. environment,
+	// entrypoint, cmd, labels, user, and working dir within Config.Config).
+	Config v1.ConfigFile
+	// History is each step of the image build from the image config history (in build order), mapped to the layers
+	// created by each step.
+	History   []HistoryEntry
 	MediaType v1Types.MediaType
 	// --- below fields are optional metadata
 	Tags           []name.Tag
 	RawManifest    []byte
 	ManifestDigest string
 	RawConfig      []byte
+	// Origin describes the provider and location the image was obtained from
+	Origin Origin
+	// LayerOrderMismatches describes any layers whose manifest position disagrees with the config diff IDs (only when
+	// the image was read with a policy that trusts one of the sources, see WithLayerOrderPolicy).
+	LayerOrderMismatches []LayerOrderMismatch
+	// BytesRead is the number of bytes read to provide and read the image (as of when the image was read, see
+	// Image.BytesRead for a running total).
+	BytesRead BytesRead
+}
+
+// HistoryEntry is a single step of the image build, as recorded within the image config history.
+type HistoryEntry struct {
+	// Created is when the step was run (zero if not provided).
+	Created time.Time
+	// CreatedBy is the command of the step (e.g. a Dockerfile instruction).
+	CreatedBy string
+	// Author is the author of the step (empty if not provided).
+	Author string
+	// Comment is a comment for the step (empty if not provided).
+	Comment string
+	// EmptyLayer indicates that the step did not create a layer (e.g. ENV or CMD instructions).
+	EmptyLayer bool
+	// LayerIndex is the index of the layer created by the step (-1 for empty layer steps, as well as steps without a
+	// corresponding layer when the history does not agree with the layers of the image).
+	LayerIndex int
+}
+
+// newHistory maps each image config history entry to the layer created by the entry, where entries are matched to
+// layers in order (skipping entries for empty layers).
+func newHistory(config v1.ConfigFile) []HistoryEntry {
+	if len(config.History) == 0 {
+		return nil
+	}
+
+	layerCount := len(config.RootFS.DiffIDs)
+	var history = make([]HistoryEntry, len(config.History))
+	var layerIdx int
+	for idx, h := range config.History {
+		entry := HistoryEntry{
+			Created:    h.Created.Time,
+			CreatedBy:  h.CreatedBy,
+			Author:     h.Author,
+			Comment:    h.Comment,
+			EmptyLayer: h.EmptyLayer,
+			LayerIndex: -1,
+		}
+		if !h.EmptyLayer {
+			if layerIdx < layerCount {
+				entry.LayerIndex = layerIdx
+			}
+			layerIdx++
+		}
+		history[idx] = entry
+	}
+
+	if layerIdx != layerCount {
+		log.Debugf("image config history describes %d layers, but the image has %d layers", layerIdx, layerCount)
+	}
+	return history
+}
+
+// LayerHistory returns the history entry of the build step that created the layer at the given index (false if the
+// history does not describe the layer).
+func (m Metadata) LayerHistory(layerIdx int) (HistoryEntry, bool) {
+	for _, entry := range m.History {
+		if !entry.EmptyLayer && entry.LayerIndex == layerIdx {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
 }
 
 // readImageMetadata extracts the most pertinent information from the underlying image tar.
@@ -46,6 +124,7 @@ func readImageMetadata(img v1.Image) (Metadata, error) {
 	return Metadata{
 		ID:        id.String(),
 		Config:    *config,
+		History:   newHistory(*config),
 		MediaType: mediaType,
 		RawConfig: rawConfig,
 	}, nil
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func TestNewHistory(t *testing.T) {
+	created := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	diffIDs := func(count int) []v1.Hash {
+		var hashes []v1.Hash
+		for idx := 0; idx < count; idx++ {
+			hashes = append(hashes, v1.Hash{Algorithm: "sha256", Hex: "abc"})
+		}
+		return hashes
+	}
+
+	tests := []struct {
+		name     string
+		config   v1.ConfigFile
+		expected []HistoryEntry
+	}{
+		{
+			name: "empty layers between layers",
+			config: v1.ConfigFile{
+				RootFS: v1.RootFS{DiffIDs: diffIDs(2)},
+				History: []v1.History{
+					{Created: v1.Time{Time: created}, CreatedBy: "ADD rootfs.tar /", Author: "someone"},
+					{CreatedBy: "ENV PATH=/bin", EmptyLayer: true},
+					{CreatedBy: "COPY main /app/main", Comment: "buildkit.dockerfile.v0"},
+					{CreatedBy: "CMD [\"/app/main\"]", EmptyLayer: true},
+				},
+			},
+			expected: []HistoryEntry{
+				{Created: created, CreatedBy: "ADD rootfs.tar /", Author: "someone", LayerIndex: 0},
+				{CreatedBy: "ENV PATH=/bin", EmptyLayer: true, LayerIndex: -1},
+				{CreatedBy: "COPY main /app/main", Comment: "buildkit.dockerfile.v0", LayerIndex: 1},
+				{CreatedBy: "CMD [\"/app/main\"]", EmptyLayer: true, LayerIndex: -1},
+			},
+		},
+		{
+			name: "more history entries than layers",
+			config: v1.ConfigFile{
+				RootFS: v1.RootFS{DiffIDs: diffIDs(1)},
+				History: []v1.History{
+					{CreatedBy: "ADD rootfs.tar /"},
+					{CreatedBy: "RUN make"},
+				},
+			},
+			expected: []HistoryEntry{
+				{CreatedBy: "ADD rootfs.tar /", LayerIndex: 0},
+				{CreatedBy: "RUN make", LayerIndex: -1},
+			},
+		},
+		{
+			name: "no history",
+			config: v1.ConfigFile{
+				RootFS: v1.RootFS{DiffIDs: diffIDs(1)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, d := range deep.Equal(test.expected, newHistory(test.config)) {
+				t.Errorf("diff: %+v", d)
+			}
+		})
+	}
+}
+
+func TestReadImageMetadata_ConfigAndHistory(t *testing.T) {
+	v1Img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:   newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "app/main"}),
+		History: v1.History{CreatedBy: "COPY main /app/main"},
+	})
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	v1Img, err = mutate.Config(v1Img, v1.Config{
+		Env:        []string{"PATH=/bin"},
+		Entrypoint: []string{"/app/main"},
+		Cmd:        []string{"--help"},
+		Labels:     map[string]string{"maintainer": "someone"},
+		User:       "app",
+		WorkingDir: "/app",
+	})
+	if err != nil {
+		t.Fatalf("could not set config: %+v", err)
+	}
+
+	metadata, err := readImageMetadata(v1Img)
+	if err != nil {
+		t.Fatalf("could not read metadata: %+v", err)
+	}
+
+	config := metadata.Config.Config
+	if config.User != "app" || config.WorkingDir != "/app" || config.Labels["maintainer"] != "someone" {
+		t.Errorf("unexpected config: %+v", config)
+	}
+	for _, d := range deep.Equal([]string{"/app/main"}, config.Entrypoint) {
+		t.Errorf("entrypoint diff: %+v", d)
+	}
+
+	expected := []HistoryEntry{
+		{CreatedBy: "COPY main /app/main", LayerIndex: 0},
+	}
+	for _, d := range deep.Equal(expected, metadata.History) {
+		t.Errorf("history diff: %+v", d)
+	}
+}
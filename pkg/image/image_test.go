@@ -1,14 +1,24 @@
 package image
 
 import (
+	"archive/tar"
+	"context"
+	"crypto"
+	"crypto/sha1"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
 	"github.com/go-test/deep"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 )
 
 func TestImageAdditionalMetadata(t *testing.T) {
@@ -20,19 +30,19 @@ func TestImageAdditionalMetadata(t *testing.T) {
 	tests := []struct {
 		name    string
 		options []AdditionalMetadata
-		image   Image
+		image   *Image
 	}{
 		{
 			name:    "no options",
 			options: []AdditionalMetadata{},
-			image:   Image{},
+			image:   &Image{},
 		},
 		{
 			name: "with tags",
 			options: []AdditionalMetadata{
 				WithTags(theTag.String()),
 			},
-			image: Image{
+			image: &Image{
 				Metadata: Metadata{
 					Tags: []name.Tag{theTag},
 				},
@@ -43,7 +53,7 @@ func TestImageAdditionalMetadata(t *testing.T) {
 			options: []AdditionalMetadata{
 				WithManifest([]byte("some bytes")),
 			},
-			image: Image{
+			image: &Image{
 				Metadata: Metadata{
 					RawManifest:    []byte("some bytes"),
 					ManifestDigest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("some bytes"))),
@@ -55,7 +65,7 @@ func TestImageAdditionalMetadata(t *testing.T) {
 			options: []AdditionalMetadata{
 				WithManifestDigest("the-digest"),
 			},
-			image: Image{
+			image: &Image{
 				Metadata: Metadata{
 					ManifestDigest: "the-digest",
 				},
@@ -66,7 +76,7 @@ func TestImageAdditionalMetadata(t *testing.T) {
 			options: []AdditionalMetadata{
 				WithConfig([]byte("some bytes")),
 			},
-			image: Image{
+			image: &Image{
 				Metadata: Metadata{
 					RawConfig: []byte("some bytes"),
 					ID:        fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("some bytes"))),
@@ -91,7 +101,7 @@ func TestImageAdditionalMetadata(t *testing.T) {
 			if err != nil {
 				t.Fatalf("could not create image: %+v", err)
 			}
-			for _, d := range deep.Equal(img, &test.image) {
+			for _, d := range deep.Equal(img, test.image) {
 				t.Errorf("diff: %+v", d)
 			}
 		})
@@ -100,7 +110,7 @@ func TestImageAdditionalMetadata(t *testing.T) {
 
 func TestImage_SquashedTree(t *testing.T) {
 	t.Run("zero layers", func(t *testing.T) {
-		i := Image{
+		i := &Image{
 			Layers: []*Layer{},
 		}
 
@@ -111,10 +121,479 @@ func TestImage_SquashedTree(t *testing.T) {
 		}()
 
 		// Asserting that this call doesn't panic (regression: https://github.com/anchore/stereoscope/issues/56)
-		result := i.SquashedTree()
+		result := squashedTreeOf(t, i)
 
 		if result == nil {
 			t.Error("expected an initialized, empty FileTree, but got a nil FileTree")
 		}
 	})
 }
+
+func TestImage_ReadWithContext_Cancelled(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = NewImage(randomImg, testTempDir(t)).ReadWithContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got: %+v", err)
+	}
+}
+
+func TestImage_Read_WithoutSquash(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	img := NewImage(randomImg, testTempDir(t))
+	if err := img.Read(WithoutSquash()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	for idx, layer := range img.Layers {
+		if len(layer.Tree.AllFiles()) == 0 {
+			t.Errorf("expected files within layer=%d tree", idx)
+		}
+		if layer.SquashedTree == nil || len(layer.SquashedTree.AllFiles()) != 0 {
+			t.Errorf("expected an empty squash tree for layer=%d", idx)
+		}
+	}
+}
+
+func TestImage_Read_WithLazyLayers(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	img := NewImage(randomImg, testTempDir(t))
+	if err := img.Read(WithLazyLayers()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if len(img.Layers) != 2 {
+		t.Fatalf("unexpected number of layers: %d", len(img.Layers))
+	}
+	for idx, layer := range img.Layers {
+		if len(layer.Tree.AllFiles()) != 0 {
+			t.Errorf("expected no files within unindexed layer=%d tree", idx)
+		}
+		if layer.Metadata.Digest == "" {
+			t.Errorf("expected metadata for unindexed layer=%d", idx)
+		}
+	}
+
+	// indexing a single layer does not index any other layers
+	if err := img.Layers[0].Index(context.Background()); err != nil {
+		t.Fatalf("could not index layer: %+v", err)
+	}
+	if len(img.Layers[0].Tree.AllFiles()) == 0 {
+		t.Errorf("expected files within indexed layer tree")
+	}
+	if len(img.Layers[1].Tree.AllFiles()) != 0 {
+		t.Errorf("expected no files within unindexed layer tree")
+	}
+
+	// accessing the squash tree indexes all remaining layers
+	squashed := squashedTreeOf(t, img)
+	expected := len(img.Layers[0].Tree.AllFiles()) + len(img.Layers[1].Tree.AllFiles())
+	if len(img.Layers[1].Tree.AllFiles()) == 0 || len(squashed.AllFiles()) != expected {
+		t.Errorf("unexpected squash tree files: %d != %d", len(squashed.AllFiles()), expected)
+	}
+	if img.Metadata.Size == 0 {
+		t.Errorf("expected the image size once all layers are indexed")
+	}
+}
+
+func TestImage_IndexLayers_Concurrent(t *testing.T) {
+	randomImg, err := random.Image(1024, 4)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	img := NewImage(randomImg, testTempDir(t))
+	if err := img.Read(WithLazyLayers()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	// the squash tree and each layer are indexed on first access from any of these
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*len(img.Layers))
+	for n := 0; n < 4; n++ {
+		for _, layer := range img.Layers {
+			wg.Add(1)
+			go func(layer *Layer) {
+				defer wg.Done()
+				if _, err := layer.FilesByGlob("**"); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := img.SquashedTreeWithError(); err != nil {
+					errs <- err
+				}
+			}(layer)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("could not index concurrently: %+v", err)
+	}
+
+	var expected int
+	for idx, layer := range img.Layers {
+		count := len(layer.Tree.AllFiles())
+		if count == 0 {
+			t.Errorf("expected files within layer=%d tree", idx)
+		}
+		expected += count
+	}
+	if actual := len(squashedTreeOf(t, img).AllFiles()); actual != expected {
+		t.Errorf("unexpected squash tree files: %d != %d", actual, expected)
+	}
+	if actual := len(img.FileCatalog.ids()); actual != expected {
+		t.Errorf("unexpected file catalog entries (indexed more than once?): %d != %d", actual, expected)
+	}
+}
+
+func TestImage_IndexLayers_RemembersError(t *testing.T) {
+	bogus, err := v1.NewHash("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	if err != nil {
+		t.Fatalf("could not create hash: %+v", err)
+	}
+	layers := randomLayers(t, 1)
+	img := newTestImage(t, []v1.Layer{tamperedLayer{Layer: layers[0], diffID: &bogus}})
+	if err := img.Read(WithLazyLayers(), WithLayerDigestPolicy(FailOnLayerDigestMismatch)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	tree, err := img.SquashedTreeWithError()
+	if err == nil || tree != nil {
+		t.Fatalf("expected an indexing error, got tree=%+v", tree)
+	}
+	files := len(img.Layers[0].Tree.AllFiles())
+
+	// the partially indexed layer is not indexed again
+	if _, again := img.SquashedTreeWithError(); again == nil || again.Error() != err.Error() {
+		t.Errorf("expected the same error, got %+v", again)
+	}
+	if tree := img.SquashedTree(); tree == nil || len(tree.AllFiles()) != 0 {
+		t.Errorf("expected an empty squash tree, got %+v", tree)
+	}
+	if err := img.Layers[0].Index(context.Background()); err == nil {
+		t.Errorf("expected the layer to remember the indexing error")
+	}
+	if actual := len(img.Layers[0].Tree.AllFiles()); actual != files {
+		t.Errorf("expected the layer to not be indexed again: %d != %d", actual, files)
+	}
+}
+
+func TestImage_Read_WithLayerConcurrency(t *testing.T) {
+	randomImg, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	sequential := NewImage(randomImg, testTempDir(t))
+	if err := sequential.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	concurrent := NewImage(randomImg, testTempDir(t))
+	if err := concurrent.Read(WithLayerConcurrency(3)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if len(concurrent.Layers) != len(sequential.Layers) {
+		t.Fatalf("unexpected number of layers: %d != %d", len(concurrent.Layers), len(sequential.Layers))
+	}
+	for idx, layer := range concurrent.Layers {
+		if layer.Metadata.Digest != sequential.Layers[idx].Metadata.Digest {
+			t.Errorf("unexpected layer at index=%d: %q", idx, layer.Metadata.Digest)
+		}
+		for _, ref := range layer.Tree.AllFiles() {
+			entry, err := concurrent.FileCatalog.Get(ref)
+			if err != nil {
+				t.Fatalf("could not get catalog entry: %+v", err)
+			}
+			if entry.Layer != layer {
+				t.Errorf("unexpected layer for path=%q", ref.RealPath)
+			}
+		}
+	}
+
+	if concurrent.Metadata.Size != sequential.Metadata.Size {
+		t.Errorf("unexpected image size: %d != %d", concurrent.Metadata.Size, sequential.Metadata.Size)
+	}
+	if extra, missing := squashedTreeOf(t, concurrent).PathDiff(squashedTreeOf(t, sequential)); len(extra) != 0 || len(missing) != 0 {
+		t.Errorf("unexpected squash tree differences: extra=%+v missing=%+v", extra, missing)
+	}
+	if concurrent.FileCatalog.Stats().Entries != sequential.FileCatalog.Stats().Entries {
+		t.Errorf("unexpected number of catalog entries")
+	}
+}
+
+func TestImage_Read_WithFileDigests(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	img := NewImage(randomImg, testTempDir(t))
+	if err := img.Read(WithFileDigests(crypto.SHA1)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	var digested int
+	for _, ref := range squashedTreeOf(t, img).AllFiles() {
+		entry, err := img.FileCatalog.Get(ref)
+		if err != nil {
+			t.Fatalf("could not get catalog entry: %+v", err)
+		}
+		if entry.Metadata.IsDir {
+			continue
+		}
+
+		reader, err := img.FileContentsByReference(ref)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+
+		expected := []file.Digest{
+			{Algorithm: "sha256", Value: fmt.Sprintf("%x", sha256.Sum256(contents))},
+			{Algorithm: "sha1", Value: fmt.Sprintf("%x", sha1.Sum(contents))},
+		}
+		for _, d := range deep.Equal(entry.Metadata.Digests, expected) {
+			t.Errorf("unexpected digests for path=%q: %s", ref.RealPath, d)
+		}
+		digested++
+	}
+
+	if digested == 0 {
+		t.Errorf("expected files to be digested")
+	}
+}
+
+func TestImage_FilesByGlob(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	img := NewImage(randomImg, testTempDir(t))
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	squashed, err := img.FilesByGlobFromSquash("**/*")
+	if err != nil {
+		t.Fatalf("could not glob: %+v", err)
+	}
+
+	var layerMatches int
+	for idx, layer := range img.Layers {
+		results, err := img.FilesByGlobFromLayer(idx, "**/*")
+		if err != nil {
+			t.Fatalf("could not glob layer=%d: %+v", idx, err)
+		}
+		if len(results) != len(layer.Tree.AllFiles()) {
+			t.Errorf("unexpected matches for layer=%d: %d != %d", idx, len(results), len(layer.Tree.AllFiles()))
+		}
+		layerMatches += len(results)
+	}
+
+	if len(squashed) == 0 || len(squashed) != layerMatches {
+		t.Errorf("unexpected squash matches: %d != %d", len(squashed), layerMatches)
+	}
+
+	if _, err := img.FilesByGlobFromLayer(len(img.Layers), "**/*"); err == nil {
+		t.Errorf("expected an error for an invalid layer index")
+	}
+}
+
+func TestImage_Read_WithStreamingLayers(t *testing.T) {
+	// treat all files as large files (which would otherwise be cached on disk)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	img := newTestImage(t, []v1.Layer{
+		newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts"}),
+		newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd"}),
+	})
+	dir := img.contentCacheDir
+	if err := img.Read(WithStreamingLayers(), WithFileDigests()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	for _, layer := range img.Layers {
+		if layer.contentDigest != layer.Metadata.Digest {
+			t.Errorf("unexpected content digest: %q != %q", layer.contentDigest, layer.Metadata.Digest)
+		}
+	}
+
+	for _, p := range []file.Path{"/etc/hosts", "/etc/passwd"} {
+		reader, err := img.FileContentsFromSquash(p)
+		if err != nil {
+			t.Fatalf("could not fetch contents for path=%q: %+v", p, err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read contents for path=%q: %+v", p, err)
+		}
+		if "/"+string(contents) != string(p) {
+			t.Errorf("unexpected contents for path=%q: %q", p, string(contents))
+		}
+	}
+
+	readers, err := img.MultipleFileContentsFromSquash("/etc/hosts", "/etc/passwd")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	for ref, reader := range readers {
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read contents for path=%q: %+v", ref.RealPath, err)
+		}
+		if "/"+string(contents) != string(ref.RealPath) {
+			t.Errorf("unexpected contents for path=%q: %q", ref.RealPath, string(contents))
+		}
+	}
+
+	// nothing is persisted: no layer tars nor file contents
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("could not list cache dir: %+v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("unexpected cache dir entry: %q", entry.Name())
+	}
+}
+
+func TestImage_SquashedListing(t *testing.T) {
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/removed"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.removed"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "usr/hosts", Linkname: "../etc/hosts"},
+	)
+	img := newTestImage(t, []v1.Layer{base, top})
+	if err := img.Read(WithFileDigests()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	listing, err := img.SquashedListing()
+	if err != nil {
+		t.Fatalf("could not list image: %+v", err)
+	}
+
+	hostsSize := int64(len("etc/hosts"))
+	dirSize := int64(0)
+	symlinkSize := int64(0)
+	expected := []filetree.ListingEntry{
+		{Path: "/", Type: filetree.ListingTypeDir},
+		{Path: "/etc", Type: filetree.ListingTypeDir, Size: &dirSize},
+		{
+			Path:   "/etc/hosts",
+			Type:   filetree.ListingTypeFile,
+			Size:   &hostsSize,
+			Digest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("etc/hosts"))),
+		},
+		// implied by the symlink, so there is no metadata
+		{Path: "/usr", Type: filetree.ListingTypeDir},
+		{Path: "/usr/hosts", Type: filetree.ListingTypeSymlink, LinkTarget: "../etc/hosts", Size: &symlinkSize},
+	}
+	if listing.SchemaVersion != filetree.ListingSchemaVersion {
+		t.Errorf("unexpected schema version: %d", listing.SchemaVersion)
+	}
+	for _, d := range deep.Equal(listing.Entries, expected) {
+		t.Errorf("unexpected listing: %s", d)
+	}
+}
+
+func TestImage_SquashedTreeAtLayer(t *testing.T) {
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.hosts"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/resolv.conf", Mode: 0o600},
+	)
+	img := newTestImage(t, []v1.Layer{base, top})
+	if err := img.Read(WithLazyLayers()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	tests := []struct {
+		layer   int
+		present []file.Path
+		absent  []file.Path
+	}{
+		{layer: 0, present: []file.Path{"/etc/hosts"}, absent: []file.Path{"/etc/resolv.conf"}},
+		{layer: 1, present: []file.Path{"/etc/resolv.conf"}, absent: []file.Path{"/etc/hosts"}},
+	}
+	for _, test := range tests {
+		tree, err := img.SquashedTreeAtLayer(test.layer)
+		if err != nil {
+			t.Fatalf("could not get squash tree for layer=%d: %+v", test.layer, err)
+		}
+		for _, p := range test.present {
+			if !tree.HasPath(p) {
+				t.Errorf("expected path=%q as of layer=%d", p, test.layer)
+			}
+		}
+		for _, p := range test.absent {
+			if tree.HasPath(p) {
+				t.Errorf("unexpected path=%q as of layer=%d", p, test.layer)
+			}
+		}
+	}
+
+	metadata, err := img.Layers[1].FileMetadataFromSquash("/etc/resolv.conf")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.Mode.Perm() != 0o600 {
+		t.Errorf("unexpected mode: %v", metadata.Mode)
+	}
+	if _, err := img.Layers[1].FileMetadataFromSquash("/etc/hosts"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected a not found error for a removed path, got %+v", err)
+	}
+
+	if _, err := img.SquashedTreeAtLayer(2); err == nil {
+		t.Errorf("expected an error for an invalid layer index")
+	}
+
+	unsquashed := newTestImage(t, []v1.Layer{base, top})
+	if err := unsquashed.Read(WithoutSquash()); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	if _, err := unsquashed.SquashedTreeAtLayer(0); err == nil {
+		t.Errorf("expected an error for an image without squash trees")
+	}
+}
+
+// squashedTreeOf returns the squash tree of the given image, failing the test if the image cannot be indexed.
+func squashedTreeOf(t testing.TB, img *Image) *filetree.FileTree {
+	t.Helper()
+	tree, err := img.SquashedTreeWithError()
+	if err != nil {
+		t.Fatalf("could not get squash tree: %+v", err)
+	}
+	return tree
+}
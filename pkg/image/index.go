@@ -0,0 +1,180 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/hashicorp/go-multierror"
+)
+
+// IndexImageProvider returns the provider for the image with the given manifest digest within an image index.
+type IndexImageProvider func(digest string) Provider
+
+// Index is a multi-platform image (an image index or manifest list), where the image for each platform is only
+// provided and read once requested (see IndexManifest.Image).
+type Index struct {
+	// Digest is the digest of the index manifest.
+	Digest string
+	// MediaType is the media type of the index manifest.
+	MediaType string
+	// RawManifest is the raw index manifest document.
+	RawManifest []byte
+	// Manifests are all image manifests within the index (nested indexes are not included).
+	Manifests []*IndexManifest
+
+	// cleanup removes all temp dirs created for the index (nil when not known, see SetCleanup)
+	cleanup func() error
+}
+
+// IndexManifest is a single image manifest within an image index.
+type IndexManifest struct {
+	// Digest is the digest of the image manifest.
+	Digest string
+	// MediaType is the media type of the image manifest.
+	MediaType string
+	// Size is the size of the image manifest in bytes.
+	Size int64
+	// Platform is the platform the image is for (nil if the index does not specify one).
+	Platform *Platform
+	// Annotations are the annotations for the image manifest within the index.
+	Annotations map[string]string
+
+	provider    IndexImageProvider
+	readOptions []ReadOption
+
+	lock  sync.Mutex
+	image *Image
+}
+
+// NewIndex describes all image manifests within the given index, where the image for each manifest is obtained with
+// the given provider and read with the given options once requested.
+func NewIndex(index v1.ImageIndex, provider IndexImageProvider, readOptions ...ReadOption) (*Index, error) {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse index manifest: %w", err)
+	}
+
+	result := &Index{
+		MediaType: string(indexManifest.MediaType),
+	}
+
+	if digest, err := index.Digest(); err == nil {
+		result.Digest = digest.String()
+	} else {
+		log.Debugf("unable to get index manifest digest: %+v", err)
+	}
+	if rawManifest, err := index.RawManifest(); err == nil {
+		result.RawManifest = rawManifest
+	} else {
+		log.Debugf("unable to get raw index manifest: %+v", err)
+	}
+
+	for _, descriptor := range indexManifest.Manifests {
+		if descriptor.MediaType == types.OCIImageIndex || descriptor.MediaType == types.DockerManifestList {
+			log.Debugf("skipping nested index=%q", descriptor.Digest)
+			continue
+		}
+		result.Manifests = append(result.Manifests, &IndexManifest{
+			Digest:      descriptor.Digest.String(),
+			MediaType:   string(descriptor.MediaType),
+			Size:        descriptor.Size,
+			Platform:    PlatformFromV1(descriptor.Platform),
+			Annotations: descriptor.Annotations,
+			provider:    provider,
+			readOptions: readOptions,
+		})
+	}
+
+	return result, nil
+}
+
+// SetCleanup associates the function that removes all temp dirs created for the index (including those of every image
+// read from the index), see Index.Cleanup.
+func (i *Index) SetCleanup(fn func() error) {
+	i.cleanup = fn
+}
+
+// Cleanup cleans up every image read from the index (see Image.Cleanup) and removes all temp dirs created for the
+// index (see SetCleanup), after which no file contents can be read from these images.
+func (i *Index) Cleanup() error {
+	var allErrors error
+	for _, manifest := range i.Manifests {
+		manifest.lock.Lock()
+		img := manifest.image
+		manifest.lock.Unlock()
+		if img == nil {
+			continue
+		}
+		if err := img.Cleanup(); err != nil {
+			allErrors = multierror.Append(allErrors, err)
+		}
+	}
+	if i.cleanup != nil {
+		if err := i.cleanup(); err != nil {
+			allErrors = multierror.Append(allErrors, err)
+		}
+	}
+	return allErrors
+}
+
+// Platforms returns the platforms of all image manifests within the index (in index order, manifests without a
+// platform are not included).
+func (i *Index) Platforms() []Platform {
+	var platforms []Platform
+	for _, manifest := range i.Manifests {
+		if manifest.Platform != nil {
+			platforms = append(platforms, *manifest.Platform)
+		}
+	}
+	return platforms
+}
+
+// Manifest returns the first image manifest within the index that satisfies the given platform (nil if none do).
+func (i *Index) Manifest(platform Platform) *IndexManifest {
+	for _, manifest := range i.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		if candidate := manifest.Platform.V1(); platform.Matches(&candidate) {
+			return manifest
+		}
+	}
+	return nil
+}
+
+// Image provides and reads the image for this manifest upon the first call, later calls return the same image.
+func (m *IndexManifest) Image() (*Image, error) {
+	return m.ImageWithContext(context.Background())
+}
+
+// ImageWithContext is the same as Image, however, providing and reading the image is aborted once the given context is
+// done (a later call will try again).
+func (m *IndexManifest) ImageWithContext(ctx context.Context) (*Image, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.image != nil {
+		return m.image, nil
+	}
+	if m.provider == nil {
+		return nil, fmt.Errorf("no provider for manifest=%q", m.Digest)
+	}
+
+	provider := m.provider(m.Digest)
+	img, err := provider.Provide(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = img.ReadWithContext(ctx, append([]ReadOption{WithProvider(provider)}, m.readOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image for manifest=%q: %w", m.Digest, err)
+	}
+
+	m.image = img
+	return img, nil
+}
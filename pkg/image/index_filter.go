@@ -0,0 +1,62 @@
+package image
+
+import (
+	"path"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// indexPathFilter is the set of path prefixes that should be indexed within each layer (an empty filter indexes all
+// paths).
+type indexPathFilter []file.Path
+
+func newIndexPathFilter(paths ...string) indexPathFilter {
+	var filter indexPathFilter
+	for _, p := range paths {
+		normalized := file.Path(path.Clean(file.DirSeparator + strings.TrimSpace(p)))
+		if normalized == file.DirSeparator {
+			// everything is under the root, there is nothing to filter
+			return nil
+		}
+		filter = append(filter, normalized)
+	}
+	return filter
+}
+
+// includes indicates if the given path should be indexed. Paths that are within one of the prefixes (or are ancestors
+// of a prefix) are included. Whiteouts are included when the path they remove would be included, so that squashing
+// still removes included paths from lower layers.
+func (f indexPathFilter) includes(p file.Path) bool {
+	if len(f) == 0 {
+		return true
+	}
+
+	target := p
+	if p.IsWhiteout() {
+		unWhiteout, err := p.UnWhiteoutPath()
+		if err != nil {
+			// this whiteout is for the root directory, which affects every path
+			return true
+		}
+		target = unWhiteout
+	}
+
+	if target == file.DirSeparator {
+		return true
+	}
+
+	for _, prefix := range f {
+		switch {
+		case target == prefix:
+			return true
+		case strings.HasPrefix(string(target), string(prefix)+file.DirSeparator):
+			// the path is within the prefix
+			return true
+		case strings.HasPrefix(string(prefix), string(target)+file.DirSeparator):
+			// the path is an ancestor of the prefix
+			return true
+		}
+	}
+	return false
+}
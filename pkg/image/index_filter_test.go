@@ -0,0 +1,50 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestIndexPathFilter_Includes(t *testing.T) {
+	filter := newIndexPathFilter("/usr/lib", "etc/")
+
+	tests := []struct {
+		path     file.Path
+		expected bool
+	}{
+		{path: "/", expected: true},
+		{path: "/usr", expected: true},
+		{path: "/usr/lib", expected: true},
+		{path: "/usr/lib/libc.so", expected: true},
+		{path: "/usr/libexec/thing", expected: false},
+		{path: "/usr/bin/ls", expected: false},
+		{path: "/etc", expected: true},
+		{path: "/etc/passwd", expected: true},
+		{path: "/var/log/messages", expected: false},
+		// whiteouts are considered by the path they remove
+		{path: "/usr/lib/.wh.libc.so", expected: true},
+		{path: "/usr/.wh.lib", expected: true},
+		{path: "/.wh.usr", expected: true},
+		{path: "/usr/bin/.wh.ls", expected: false},
+		{path: "/usr/lib/.wh..wh..opq", expected: true},
+		{path: "/var/.wh..wh..opq", expected: false},
+		{path: "/.wh..wh..opq", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			if actual := filter.includes(test.path); actual != test.expected {
+				t.Errorf("unexpected result for %q: %v", test.path, actual)
+			}
+		})
+	}
+}
+
+func TestIndexPathFilter_Empty(t *testing.T) {
+	for _, filter := range []indexPathFilter{newIndexPathFilter(), newIndexPathFilter("/usr", "/")} {
+		if !filter.includes("/var/log/messages") {
+			t.Errorf("expected all paths to be included by filter: %+v", filter)
+		}
+	}
+}
@@ -2,10 +2,16 @@ package image
 
 import (
 	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
 	"path"
+	"sync"
 
 	"github.com/anchore/stereoscope/internal/bus"
 	"github.com/anchore/stereoscope/internal/log"
@@ -13,6 +19,7 @@ import (
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/wagoodman/go-partybus"
 	"github.com/wagoodman/go-progress"
 )
@@ -21,23 +28,91 @@ import (
 type Layer struct {
 	// layer is the raw layer metadata and content provider from the GCR lib
 	layer v1.Layer
-	// content provides an io.ReadCloser for the underlying layer tar (either directly from the GCR lib or a cache dir)
-	content file.OpenerFn
+	// opener provides the underlying layer tar (either directly from the GCR lib, a cache dir, or another backend)
+	opener LayerOpener
 	// Metadata contains select layer attributes
 	Metadata LayerMetadata
 	// Tree is a filetree that represents the structure of the layer tar contents ("diff tree")
 	Tree *filetree.FileTree
 	// SquashedTree is a filetree that represents the combination of this layers diff tree and all diff trees
-	// in lower layers relative to this one.
+	// in lower layers relative to this one (the filesystem as of this layer). This is empty until a lazily read layer
+	// is squashed (see Image.SquashedTreeAtLayer).
 	SquashedTree *filetree.FileTree
 	// fileCatalog contains all file metadata for all files in all layers (not just this layer)
 	fileCatalog *FileCatalog
+	// contentCompression is the compression of the layer content that is not indicated by the media type (see
+	// detectContentCompression)
+	contentCompression file.Compression
+	// compressionDetected indicates that the layer content has been inspected for compression (see
+	// detectContentCompression)
+	compressionDetected bool
+	// indexFilter restricts which paths are added to the layer tree and file catalog (all paths when empty)
+	indexFilter indexPathFilter
+	// exclusions are the paths that are never added to the layer tree and file catalog (no paths when empty)
+	exclusions pathExclusions
+	// tarEntryPolicy determines how unsupported tar entries and malformed headers are handled
+	tarEntryPolicy file.TarEntryPolicy
+	// pathPolicy determines how tar entries with suspicious names are handled
+	pathPolicy file.PathPolicy
+	// bytesRead records all layer content read from disk (or from the layer source)
+	bytesRead *ByteCounter
+	// countSourceReads indicates that reads from the layer source (via the GCR lib) should be recorded as disk reads
+	countSourceReads bool
+	// contentDigest is the digest of the uncompressed layer tar as read (empty if the tar could not be fully read),
+	// which should match the diff ID from the image config at the same index
+	contentDigest string
+	// uncompressedLayersCacheDir is where the uncompressed layer tar is cached once a lazily read layer is indexed
+	uncompressedLayersCacheDir string
+	// indexLock guards indexing the layer tar (shared by all copies of the layer, see copy)
+	indexLock *sync.Mutex
+	// indexed indicates that the layer tar has been read into the layer tree and file catalog
+	indexed bool
+	// indexErr is the error that reading the layer content failed with (see Index), which is returned for all later
+	// attempts
+	indexErr error
+	// squashLazily indexes all layers of a lazily read image and creates the squash trees (nil for eagerly read images)
+	squashLazily func(ctx context.Context) error
+	// bufferEntries indicates that file catalog entries are held (see pendingEntries) instead of added to the catalog
+	// while indexing, since the catalog is not safe for concurrent use (layers may be read concurrently)
+	bufferEntries bool
+	// pendingEntries are the file catalog entries not yet added to the catalog (see addPendingEntries)
+	pendingEntries []FileCatalogEntry
+	// digestHashes are the hash algorithms to digest the contents of each regular file with (none when empty)
+	digestHashes []crypto.Hash
+	// sniffContentTypes indicates that the content type of each regular file is sniffed (see WithContentTypes)
+	sniffContentTypes bool
+	// contentSearch is the set of keywords to search the contents of each regular file for (nil when not searching,
+	// see WithContentSearch)
+	contentSearch *contentSearch
+	// tempWriteHook observes (and may veto or redirect) the write of the uncompressed layer tar to the cache dir
+	tempWriteHook TempWriteHook
+	// skippedEntries are all tar entries not indexed as found within the layer tar (see SkippedEntries)
+	skippedEntries []file.SkippedTarEntry
+	// rangeFetcher fetches ranges of the compressed layer blob, allowing for seekable (eStargz) layers to be read
+	// without fetching the entire blob (nil when seekable layers are not enabled)
+	rangeFetcher BlobRangeFetcher
+	// estargz provides the entries and file contents of a seekable layer (nil for all other layers)
+	estargz *estargzLayer
+	// digestPolicy determines how layer content that does not match the recorded digests is handled
+	digestPolicy LayerDigestPolicy
+	// digestMismatch is the first digest mismatch found while reading the layer content (see FailOnLayerDigestMismatch)
+	digestMismatch error
+	// squashfs indicates that the layer content is a squashfs image that is converted into a tar when read (so the
+	// digest of the tar does not correspond to the diff ID)
+	squashfs bool
+	// tarCache is where the layer tar and index are cached across images (nil when not caching, see WithLayerTarCache)
+	tarCache *LayerTarCache
+	// cachedIndex is the index of the layer tar found within the layer tar cache (nil when not found)
+	cachedIndex *savedLayerIndex
+	// cleanup removes all temp dirs created for a layer read on its own (nil for layers of an image, see SetCleanup)
+	cleanup func() error
 }
 
 // NewLayer provides a new, unread layer object.
 func NewLayer(layer v1.Layer) *Layer {
 	return &Layer{
-		layer: layer,
+		layer:     layer,
+		indexLock: &sync.Mutex{},
 	}
 }
 
@@ -54,7 +129,26 @@ func (l *Layer) trackReadProgress(metadata LayerMetadata) *progress.Manual {
 }
 
 // readMetadata populates layer metadata from the underlying layer tar.
-func (l *Layer) readMetadata(imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
+func (l *Layer) readMetadata(ctx context.Context, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
+	if err := l.describe(imgMetadata, idx); err != nil {
+		return err
+	}
+	return l.prepareOpener(ctx, uncompressedLayersCacheDir)
+}
+
+// readLazily populates the layer metadata without reading the layer tar, which is deferred until the layer is indexed
+// (see Layer.Index).
+func (l *Layer) readLazily(catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
+	if err := l.describe(imgMetadata, idx); err != nil {
+		return err
+	}
+	l.fileCatalog = catalog
+	l.uncompressedLayersCacheDir = uncompressedLayersCacheDir
+	return nil
+}
+
+// describe populates the layer metadata from the image and layer descriptors (not the layer tar) with an empty tree.
+func (l *Layer) describe(imgMetadata Metadata, idx int) error {
 	metadata, err := readLayerMetadata(imgMetadata, l.layer, idx)
 	if err != nil {
 		return err
@@ -67,47 +161,251 @@ func (l *Layer) readMetadata(imgMetadata Metadata, idx int, uncompressedLayersCa
 
 	l.Metadata = metadata
 	l.Tree = filetree.NewFileTree()
+	l.contentCompression = file.NoCompression
+	l.compressionDetected = false
+	return nil
+}
 
-	if uncompressedLayersCacheDir != "" {
-		rawReader, err := l.layer.Uncompressed()
-		if err != nil {
+// prepareOpener selects the source of the uncompressed layer tar, caching the tar within the given dir (if provided).
+func (l *Layer) prepareOpener(ctx context.Context, uncompressedLayersCacheDir string) error {
+	if l.opener == nil && l.tarCache != nil {
+		if tarPath, index, ok := l.tarCache.get(l.Metadata.Digest); ok {
+			// the layer has been read before (possibly within another image), there is no need to fetch it again
+			l.opener = countingLayerOpener{LayerOpener: layerTarOpener{path: tarPath}, counter: l.bytesRead}
+			l.cachedIndex = index
+			return nil
+		}
+	}
+
+	if l.cachedIndex == nil {
+		if index := providedIndex(l.opener); index != nil {
+			// the provider has already indexed the layer tar, there is no need to read it again
+			l.cachedIndex = index
+		}
+	}
+
+	if l.opener == nil && !l.compressionDetected {
+		if err := l.detectContentCompression(); err != nil {
 			return err
 		}
+		l.compressionDetected = true
+	}
+
+	if l.opener == nil && l.rangeFetcher != nil {
+		if err := l.openEstargz(ctx); err == nil {
+			// file contents are fetched by range, the entire layer tar is only streamed when needed (e.g. extraction)
+			l.opener = layerStreamOpener(l.uncompressedReader)
+			return nil
+		} else if errors.Is(err, errNotEstargz) {
+			log.Debugf("layer=%q is not seekable (will read the entire layer): %+v", l.Metadata.Digest, err)
+		} else {
+			log.Warnf("unable to read layer=%q as eStargz (will read the entire layer): %+v", l.Metadata.Digest, err)
+		}
+	}
 
+	switch {
+	case l.opener != nil:
+		// the layer content is provided by another backend (e.g. a blob already on disk within an OCI layout), there
+		// is no need to duplicate it (unless random access into a compressed blob is needed)
+		if uncompressedLayersCacheDir != "" {
+			bindUncompressedCopy(l.opener, path.Join(uncompressedLayersCacheDir, l.Metadata.Digest+".tar"), l.tempWriteHook)
+		}
+	case uncompressedLayersCacheDir != "":
 		tarPath := path.Join(uncompressedLayersCacheDir, l.Metadata.Digest+".tar")
+		if l.tempWriteHook != nil {
+			var ok bool
+			tarPath, ok = tempWritePath(l.tempWriteHook, TempWrite{
+				Kind:          LayerTarWrite,
+				Path:          tarPath,
+				ProjectedSize: l.projectedTarSize(),
+			})
+			if !ok {
+				l.opener = layerStreamOpener(l.uncompressedReader)
+				return nil
+			}
+		}
 
-		fh, err := os.Create(tarPath)
+		rawReader, err := l.uncompressedReader()
 		if err != nil {
-			return fmt.Errorf("unable to create layer cache dir=%q : %w", tarPath, err)
+			return err
 		}
+		defer rawReader.Close()
 
-		if _, err := io.Copy(fh, rawReader); err != nil {
+		// note: the same layer may appear more than once within an image (and layers may be read concurrently), so the
+		// cached tar is only moved into place once complete
+		err = file.WriteFileAtomic(tarPath, func(w io.Writer) error {
+			_, err := io.Copy(w, file.NewContextReader(ctx, rawReader))
+			return err
+		})
+		if err != nil {
 			return fmt.Errorf("unable to populate layer cache dir=%q : %w", tarPath, err)
 		}
 
-		l.content = file.OpenerFromPath{Path: tarPath}.Open
-	} else {
-		l.content = l.layer.Uncompressed
+		l.opener = countingLayerOpener{LayerOpener: layerTarOpener{path: tarPath}, counter: l.bytesRead}
+	default:
+		l.opener = layerStreamOpener(l.uncompressedReader)
 	}
 	return nil
 }
 
+// projectedTarSize is the size of the uncompressed layer tar if known up front (the blob is not compressed), otherwise -1.
+func (l *Layer) projectedTarSize() int64 {
+	if !isUncompressedLayer(l.Metadata.MediaType) {
+		return -1
+	}
+	size, err := l.layer.Size()
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// uncompressedReader provides the uncompressed layer tar stream, decompressing the layer content as indicated by the
+// media type (or as detected when the layer was read, see detectContentCompression).
+func (l *Layer) uncompressedReader() (io.ReadCloser, error) {
+	rawReader, fromBlob, err := l.rawReader()
+	if err != nil {
+		return nil, err
+	}
+	if l.countSourceReads {
+		rawReader = &extentReadCloser{
+			Reader: l.bytesRead.DiskReader(rawReader),
+			Closer: rawReader,
+		}
+	}
+
+	reader, err := l.decompressStream(rawReader, fromBlob)
+	if err != nil {
+		return nil, err
+	}
+	return l.squashfsAsTar(reader)
+}
+
+// rawReader provides the layer content from the image source, which is the (compressed) layer blob when verifying
+// layer digests (see WithLayerDigestPolicy), otherwise the content as uncompressed by the GCR lib.
+func (l *Layer) rawReader() (io.ReadCloser, bool, error) {
+	if l.digestPolicy == IgnoreLayerDigests {
+		if isSquashfsLayer(l.Metadata.MediaType) || l.Metadata.MediaType == OCIZstdLayerMediaType {
+			// note: the blob is not a (gzipped) tar, which the GCR lib cannot uncompress
+			reader, err := l.layer.Compressed()
+			return reader, true, err
+		}
+		reader, err := l.layer.Uncompressed()
+		return reader, false, err
+	}
+
+	expected, err := l.layer.Digest()
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to determine layer blob digest: %w", err)
+	}
+	reader, err := l.layer.Compressed()
+	if err != nil {
+		return nil, false, err
+	}
+	return newDigestVerifyingReader(reader, func(actual string) error {
+		if err := l.checkDigest("blob digest", expected.String(), actual); err != nil {
+			l.digestMismatch = err
+			return err
+		}
+		return nil
+	}), true, nil
+}
+
+// isUncompressedLayer indicates that the media type is for an uncompressed layer blob.
+func isUncompressedLayer(mediaType types.MediaType) bool {
+	return mediaType == types.DockerUncompressedLayer || mediaType == types.OCIUncompressedLayer
+}
+
 // Read parses information from the underlying layer tar into this struct. This includes layer metadata, the layer
 // file tree, and the layer squash tree.
 func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
-	if err := l.readMetadata(imgMetadata, idx, uncompressedLayersCacheDir); err != nil {
+	return l.read(context.Background(), catalog, imgMetadata, idx, uncompressedLayersCacheDir)
+}
+
+// read is the same as Read, however, reading is aborted once the given context is done.
+func (l *Layer) read(ctx context.Context, catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
+	if err := l.readMetadata(ctx, imgMetadata, idx, uncompressedLayersCacheDir); err != nil {
 		return err
 	}
 
 	l.fileCatalog = catalog
+	l.indexed = false
+	l.indexErr = nil
+
+	return l.index(ctx)
+}
+
+// copy returns a shallow copy of the layer that shares the layer tree and content with this layer (e.g. to reuse an
+// unchanged layer within a refreshed image without modifying the original).
+func (l *Layer) copy() *Layer {
+	copied := *l
+	return &copied
+}
+
+// Index reads the layer tar into the layer tree and the file catalog, unless this has already been done. This is only
+// needed for layers of images read with WithLazyLayers, where each layer is otherwise indexed upon first access of
+// the layer content helpers. This is safe to call concurrently. Once reading the layer content fails, the same error is
+// returned for all later calls (the layer tree may be partially populated).
+func (l *Layer) Index(ctx context.Context) error {
+	return l.index(ctx)
+}
+
+// index reads the layer tar into the layer tree and the file catalog (once).
+func (l *Layer) index(ctx context.Context) error {
+	l.indexLock.Lock()
+	defer l.indexLock.Unlock()
+
+	if l.indexed {
+		return nil
+	}
+	if l.indexErr != nil {
+		return l.indexErr
+	}
+
+	// note: nothing has been indexed when the layer content cannot be obtained, so this may be attempted again
+	if err := l.prepareOpener(ctx, l.uncompressedLayersCacheDir); err != nil {
+		return err
+	}
+
+	if err := l.indexContent(ctx); err != nil {
+		l.indexErr = err
+		return err
+	}
+	return nil
+}
+
+// indexContent reads the prepared layer content into the layer tree and the file catalog.
+func (l *Layer) indexContent(ctx context.Context) error {
+
+	if l.estargz != nil {
+		return l.indexEstargz(ctx)
+	}
+
+	// note: only indexes of layers read with the default path policy are cached
+	if l.cachedIndex != nil && len(l.digestHashes) == 0 && !l.sniffContentTypes && l.contentSearch == nil && l.pathPolicy == file.NormalizePaths {
+		return l.indexCached(ctx)
+	}
 
-	reader, err := l.content()
+	reader, err := l.opener.Open()
 	if err != nil {
 		return fmt.Errorf("unable to obtail layer=%q tar: %w", l.Metadata.Digest, err)
 	}
+	defer reader.Close()
+
 	monitor := l.trackReadProgress(l.Metadata)
 
-	for metadata := range file.EnumerateFileMetadataFromTar(reader) {
+	hasher := sha256.New()
+	contents := io.TeeReader(file.NewContextReader(ctx, reader), hasher)
+
+	l.skippedEntries = nil
+	skip := func(entry file.SkippedTarEntry) {
+		l.skippedEntries = append(l.skippedEntries, entry)
+	}
+
+	// the index is only retained to be added to the layer tar cache (along with the layer tar)
+	var entries []file.Metadata
+
+	err = file.VisitFileMetadataAndContentsFromTarWithPathPolicy(contents, l.tarEntryPolicy, l.pathPolicy, func(metadata file.Metadata, fileContents io.Reader) error {
 		// note: the tar header name is independent of surrounding structure, for example, there may be a tar header entry
 		// for /some/path/to/file.txt without any entries to constituent paths (/some, /some/path, /some/path/to ).
 		// This is ok, and the FileTree will account for this by automatically adding directories for non-existing
@@ -118,48 +416,283 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 		//
 		// In summary: the set of all FileTrees can have NON-leaf nodes that don't exist in the FileCatalog, but
 		// the FileCatalog should NEVER have entries that don't appear in one (or more) FileTree(s).
-		var fileReference *file.Reference
-		switch metadata.TypeFlag {
-		case tar.TypeSymlink:
-			fileReference, err = l.Tree.AddSymLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeLink:
-			fileReference, err = l.Tree.AddHardLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeDir:
-			fileReference, err = l.Tree.AddDir(file.Path(metadata.Path))
-			if err != nil {
-				return err
-			}
-		default:
-			fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
-			if err != nil {
-				return err
-			}
+		monitor.N++
+		if l.tarCache != nil {
+			entries = append(entries, metadata)
+		}
+		return l.indexEntry(metadata, fileContents, skip)
+	}, skip)
+	if err == nil {
+		// note: a lenient tar entry policy tolerates read errors, which must not hide a cancellation
+		err = ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read layer=%q tar: %w", l.Metadata.Digest, err)
+	}
+
+	// the tar iteration may stop before the end of the stream (e.g. at the end-of-archive marker), the remainder is
+	// still part of the layer content digest
+	if _, err := io.Copy(ioutil.Discard, contents); err != nil {
+		log.Debugf("unable to determine content digest for layer=%q: %+v", l.Metadata.Digest, err)
+	} else {
+		l.contentDigest = fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+		if l.squashfs {
+			log.Debugf("not verifying the diff ID of squashfs layer=%q", l.Metadata.Digest)
+		} else if err := l.checkDigest("diff ID", l.Metadata.Digest, l.contentDigest); err != nil {
+			l.digestMismatch = err
+		}
+	}
+	// note: a mismatch may be found while reading the tar, which must not be tolerated by a lenient tar entry policy
+	if l.digestMismatch != nil {
+		return fmt.Errorf("unable to read layer=%q: %w", l.Metadata.Digest, l.digestMismatch)
+	}
+
+	if l.tarCache != nil && l.contentDigest == l.Metadata.Digest && l.pathPolicy == file.NormalizePaths {
+		l.addToTarCache(entries)
+	}
+
+	monitor.SetCompleted()
+	l.indexed = true
+
+	return nil
+}
+
+// indexCached replays the index of the layer tar from the layer tar cache into the layer tree and the file catalog,
+// without reading the layer tar.
+func (l *Layer) indexCached(ctx context.Context) error {
+	monitor := l.trackReadProgress(l.Metadata)
+
+	l.skippedEntries = append([]file.SkippedTarEntry{}, l.cachedIndex.Skipped...)
+	skip := func(entry file.SkippedTarEntry) {
+		l.skippedEntries = append(l.skippedEntries, entry)
+	}
+
+	for _, metadata := range l.cachedIndex.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		monitor.N++
+		if err := l.indexEntry(metadata, nil, skip); err != nil {
+			return fmt.Errorf("unable to read cached layer=%q index: %w", l.Metadata.Digest, err)
 		}
-		if fileReference == nil {
-			return fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+	}
+
+	// note: only layer tars that match the diff ID are cached
+	l.contentDigest = l.Metadata.Digest
+
+	monitor.SetCompleted()
+	l.indexed = true
+	return nil
+}
+
+// addToTarCache adds the layer tar (when on disk) and the given index to the layer tar cache. Failing to cache the layer
+// does not fail reading the layer.
+func (l *Layer) addToTarCache(entries []file.Metadata) {
+	opener := l.opener
+	if counting, ok := opener.(countingLayerOpener); ok {
+		opener = counting.LayerOpener
+	}
+	tarOpener, ok := opener.(layerTarOpener)
+	if !ok {
+		return
+	}
+
+	var skipped []file.SkippedTarEntry
+	for _, entry := range l.skippedEntries {
+		// note: filtered entries depend on the read options, which are applied again when the index is replayed
+		if entry.Reason != file.FilteredTarEntry {
+			skipped = append(skipped, entry)
 		}
+	}
+
+	err := l.tarCache.put(l.Metadata.Digest, tarOpener.path, savedLayerIndex{
+		Entries: entries,
+		Skipped: skipped,
+	})
+	if err != nil {
+		log.Warnf("unable to add layer=%q to the layer tar cache: %+v", l.Metadata.Digest, err)
+	}
+}
 
-		l.Metadata.Size += metadata.Size
-		catalog.Add(*fileReference, metadata, l)
+// indexEstargz reads the table of contents of a seekable layer into the layer tree and the file catalog, where file
+// contents are only fetched when digesting, sniffing, or searching files (see WithFileDigests, WithContentTypes, and
+// WithContentSearch). Since the layer tar is never read entirely, no content digest is determined for the layer.
+func (l *Layer) indexEstargz(ctx context.Context) error {
+	monitor := l.trackReadProgress(l.Metadata)
 
+	l.skippedEntries = nil
+	skip := func(entry file.SkippedTarEntry) {
+		l.skippedEntries = append(l.skippedEntries, entry)
+	}
+
+	for _, metadata := range l.estargz.metadata() {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("unable to read layer=%q TOC: %w", l.Metadata.Digest, err)
+		}
 		monitor.N++
+
+		suspicious, err := file.CheckTarEntryPath(metadata, l.pathPolicy)
+		if err != nil {
+			return fmt.Errorf("unable to read layer=%q TOC: %w", l.Metadata.Digest, err)
+		}
+		if suspicious != nil {
+			skip(*suspicious)
+			if suspicious.Reason == file.QuarantinedTarEntry {
+				continue
+			}
+		}
+
+		name := metadata.TarHeaderName
+		contents := file.NewDeferredReadCloserFromOpener(func() (io.ReadCloser, error) {
+			return l.estargz.open(ctx, name)
+		})
+		err = l.indexEntry(metadata, contents, skip)
+		contents.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read layer=%q TOC: %w", l.Metadata.Digest, err)
+		}
 	}
 
 	monitor.SetCompleted()
+	l.indexed = true
 
 	return nil
 }
 
+// openEstargz reads the table of contents of the layer blob (by range), returning an error wrapping errNotEstargz if
+// the layer is not seekable.
+func (l *Layer) openEstargz(ctx context.Context) error {
+	blobSize, err := l.layer.Size()
+	if err != nil {
+		return fmt.Errorf("unable to determine layer blob size: %w", err)
+	}
+	estargz, err := openEstargz(ctx, l.rangeFetcher, blobSize)
+	if err != nil {
+		return err
+	}
+	l.estargz = estargz
+	return nil
+}
+
+// indexEntry adds a single tar entry to the layer tree and the file catalog, unless the entry is filtered (digesting
+// and sniffing the given contents as needed).
+func (l *Layer) indexEntry(metadata file.Metadata, fileContents io.Reader, skip func(file.SkippedTarEntry)) error {
+	l.Metadata.Size += metadata.Size
+
+	if !l.indexFilter.includes(file.Path(metadata.Path)) || l.exclusions.excludes(file.Path(metadata.Path)) {
+		skip(file.SkippedTarEntry{
+			Path:          metadata.Path,
+			TarHeaderName: metadata.TarHeaderName,
+			TarSequence:   metadata.TarSequence,
+			TypeFlag:      metadata.TypeFlag,
+			Reason:        file.FilteredTarEntry,
+			Detail:        "excluded by the index filter or path exclusions",
+		})
+		return nil
+	}
+
+	isRegular := metadata.TypeFlag == tar.TypeReg || metadata.TypeFlag == tar.TypeRegA
+
+	if l.sniffContentTypes && isRegular {
+		contentType, head, err := file.ContentTypeFromReader(fileContents)
+		if err != nil {
+			return fmt.Errorf("unable to sniff content type of path=%q: %w", metadata.Path, err)
+		}
+		metadata.ContentType = contentType
+		// the sniffed bytes are still part of the contents to digest
+		fileContents = io.MultiReader(bytes.NewReader(head), fileContents)
+	}
+
+	var searcher *contentSearcher
+	if l.contentSearch != nil && isRegular && fileContents != nil {
+		// the contents are searched while being digested (in a single read)
+		searcher = l.contentSearch.newSearcher()
+		fileContents = io.TeeReader(fileContents, searcher)
+	}
+
+	if len(l.digestHashes) > 0 && isRegular {
+		digests, err := file.DigestsFromReader(fileContents, l.digestHashes...)
+		if err != nil {
+			return fmt.Errorf("unable to digest path=%q: %w", metadata.Path, err)
+		}
+		metadata.Digests = digests
+	} else if searcher != nil {
+		if _, err := io.Copy(ioutil.Discard, fileContents); err != nil {
+			return fmt.Errorf("unable to search path=%q: %w", metadata.Path, err)
+		}
+	}
+
+	fileReference, err := l.addEntry(l.fileCatalog, metadata)
+	if err != nil || searcher == nil {
+		return err
+	}
+	return searcher.report(*fileReference, l)
+}
+
+// addEntry adds a single tar entry to the layer tree and the file catalog, returning the reference of the entry.
+func (l *Layer) addEntry(catalog *FileCatalog, metadata file.Metadata) (*file.Reference, error) {
+	var fileReference *file.Reference
+	var err error
+	switch metadata.TypeFlag {
+	case tar.TypeSymlink:
+		fileReference, err = l.Tree.AddSymLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeLink:
+		fileReference, err = l.Tree.AddHardLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeDir:
+		fileReference, err = l.Tree.AddDir(file.Path(metadata.Path))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		fileReference, err = l.Tree.AddSpecialFile(file.Path(metadata.Path), file.Type(metadata.TypeFlag))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fileReference == nil {
+		return nil, fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+	}
+
+	if l.bufferEntries {
+		l.pendingEntries = append(l.pendingEntries, FileCatalogEntry{
+			File:     *fileReference,
+			Metadata: metadata,
+			Layer:    l,
+		})
+		return fileReference, nil
+	}
+
+	catalog.Add(*fileReference, metadata, l)
+	return fileReference, nil
+}
+
+// addPendingEntries adds all buffered entries to the file catalog and stops buffering entries.
+func (l *Layer) addPendingEntries() {
+	for _, entry := range l.pendingEntries {
+		l.fileCatalog.Add(entry.File, entry.Metadata, entry.Layer)
+	}
+	l.pendingEntries = nil
+	l.bufferEntries = false
+}
+
 // FetchContents reads the file contents for the given path from the underlying layer blob, relative to the layers "diff tree".
 // An error is returned if there is no file at the given path and layer or the read operation cannot continue.
 // This is a convenience function provided by the FileCatalog.
 func (l *Layer) FileContents(path file.Path) (io.ReadCloser, error) {
+	if err := l.index(context.Background()); err != nil {
+		return nil, err
+	}
 	return fetchFileContentsByPath(l.Tree, l.fileCatalog, path)
 }
 
@@ -167,19 +700,96 @@ func (l *Layer) FileContents(path file.Path) (io.ReadCloser, error) {
 // An error is returned if any one file path does not exist or the read operation cannot continue.
 // This is a convenience function provided by the FileCatalog.
 func (l *Layer) MultipleFileContents(paths ...file.Path) (map[file.Reference]io.ReadCloser, error) {
+	if err := l.index(context.Background()); err != nil {
+		return nil, err
+	}
 	return fetchMultipleFileContentsByPath(l.Tree, l.fileCatalog, paths...)
 }
 
 // FileContentsFromSquash reads the file contents for the given path from the underlying layer blob, relative to the layers squashed file tree.
+// Links are resolved across all layers up to this layer (see Image.FileContentsFromSquash for the link resolution options).
 // An error is returned if there is no file at the given path and layer or the read operation cannot continue.
 // This is a convenience function provided by the FileCatalog.
-func (l *Layer) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
-	return fetchFileContentsByPath(l.SquashedTree, l.fileCatalog, path)
+func (l *Layer) FileContentsFromSquash(path file.Path, options ...filetree.LinkResolutionOption) (io.ReadCloser, error) {
+	if err := l.squash(context.Background()); err != nil {
+		return nil, err
+	}
+	return fetchFileContentsByPath(l.SquashedTree, l.fileCatalog, path, options...)
+}
+
+// FileMetadataFromSquash returns the file metadata for a single path, relative to the layers squashed file tree (see
+// Image.FileMetadataFromSquash for the link resolution options). If the path does not exist an error is returned.
+func (l *Layer) FileMetadataFromSquash(path file.Path, options ...filetree.LinkResolutionOption) (file.Metadata, error) {
+	if err := l.squash(context.Background()); err != nil {
+		return file.Metadata{}, err
+	}
+	exists, ref, err := l.SquashedTree.File(path, options...)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	if !exists || ref == nil {
+		return file.Metadata{}, fmt.Errorf("%w: path=%q", ErrFileNotFound, path)
+	}
+	return l.fileCatalog.Metadata(*ref)
 }
 
 // MultipleFileContents reads the file contents for all given paths from the underlying layer blob, relative to the layers squashed file tree.
 // An error is returned if any one file path does not exist or the read operation cannot continue.
 // This is a convenience function provided by the FileCatalog.
 func (l *Layer) MultipleFileContentsFromSquash(paths ...file.Path) (map[file.Reference]io.ReadCloser, error) {
+	if err := l.squash(context.Background()); err != nil {
+		return nil, err
+	}
 	return fetchMultipleFileContentsByPath(l.SquashedTree, l.fileCatalog, paths...)
 }
+
+// FilesByGlob returns all files matching the given glob pattern, relative to the layers "diff tree" (considers symlinks).
+func (l *Layer) FilesByGlob(pattern string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	if err := l.index(context.Background()); err != nil {
+		return nil, err
+	}
+	return l.Tree.FilesByGlob(pattern, options...)
+}
+
+// FilesByGlobFromSquash returns all files matching the given glob pattern, relative to the layers squashed file tree
+// (considers symlinks).
+func (l *Layer) FilesByGlobFromSquash(pattern string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	if err := l.squash(context.Background()); err != nil {
+		return nil, err
+	}
+	return l.SquashedTree.FilesByGlob(pattern, options...)
+}
+
+// squash ensures the squash tree is available for a lazily read layer (a no-op otherwise).
+func (l *Layer) squash(ctx context.Context) error {
+	if l.squashLazily == nil {
+		return nil
+	}
+	return l.squashLazily(ctx)
+}
+
+// SkippedEntries returns all tar entries that were not indexed as found within the layer tar (in tar order): entries
+// with unsupported types, entries excluded by an index filter or path exclusions, entries with suspicious names
+// (indexed at the sanitized path or quarantined, see WithPathPolicy), and a malformed header (after which all
+// remaining entries are skipped). This is useful for reporting coverage gaps. Nothing is reported until the layer has
+// been indexed.
+func (l *Layer) SkippedEntries() []file.SkippedTarEntry {
+	return l.skippedEntries
+}
+
+// SuspiciousEntries returns all tar entries with suspicious names within the layer tar (in tar order), whether these
+// were indexed at the sanitized path or quarantined (see WithPathPolicy and file.SuspiciousTarEntryName).
+func (l *Layer) SuspiciousEntries() []file.SkippedTarEntry {
+	var entries []file.SkippedTarEntry
+	for _, entry := range l.skippedEntries {
+		if entry.Reason == file.SanitizedTarEntry || entry.Reason == file.QuarantinedTarEntry {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Opener provides access to the uncompressed layer tar (only available once the layer has been read).
+func (l *Layer) Opener() LayerOpener {
+	return l.opener
+}
@@ -0,0 +1,281 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/filelock"
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// NewLayerCache returns a digest-keyed cache of layer blobs that is persisted within the given directory. A single
+// cache can be shared across all images read within a process (see WithLayerCache), so a layer blob is fetched at
+// most once regardless of how many times (or from how many images) it is read. The directory may also be shared by
+// multiple processes on the same host: blobs are only ever moved into place once complete, and processes adding the
+// same blob wait on each other (so the blob is fetched once).
+func NewLayerCache(dir string) cache.Cache {
+	return &sharedLayerCache{dir: dir}
+}
+
+// WithLayerCache reads all layer blobs through the given cache, only fetching blobs from the image source that have
+// not already been cached. This is most useful for images where fetching blobs is expensive (e.g. remote registries).
+func WithLayerCache(c cache.Cache) ReadOption {
+	return func(image *Image) error {
+		if c == nil {
+			return nil
+		}
+		// note: the option is applied again for every read (and refresh), so the image as provided is only wrapped once
+		if image.uncachedImage == nil {
+			image.uncachedImage = image.image
+		}
+		image.image = cache.Image(image.uncachedImage, c)
+		image.layerCache = c
+		return nil
+	}
+}
+
+// sharedLayerCache is a cache.Cache of (compressed) layer blobs within a directory that may be shared by multiple
+// processes. Each blob is stored alongside a small metadata file (written first), and a blob is only considered cached
+// once the blob itself has been atomically renamed into place. Blobs may also be found by diff ID, which is recorded as
+// a file containing the blob digest (written last).
+type sharedLayerCache struct {
+	dir string
+}
+
+// cachedLayerMetadata is everything about a cached layer that cannot be cheaply derived from the blob itself.
+type cachedLayerMetadata struct {
+	DiffID    string          `json:"diffID"`
+	MediaType types.MediaType `json:"mediaType"`
+}
+
+// blobPath is the path of the blob for the given digest (note: ":" is not a valid filename character on all platforms).
+func (c *sharedLayerCache) blobPath(h v1.Hash) string {
+	return filepath.Join(c.dir, h.Algorithm+"-"+h.Hex)
+}
+
+// diffIDPath is the path of the file containing the blob digest for the given diff ID.
+func (c *sharedLayerCache) diffIDPath(h v1.Hash) string {
+	return c.blobPath(h) + ".digest"
+}
+
+// Get returns the cached layer for the given blob digest or diff ID.
+func (c *sharedLayerCache) Get(h v1.Hash) (v1.Layer, error) {
+	layer, err := c.load(h)
+	if os.IsNotExist(err) {
+		layer, err = c.loadByDiffID(h)
+	}
+	if os.IsNotExist(err) {
+		return nil, cache.ErrNotFound
+	}
+	return layer, err
+}
+
+// Put adds the given layer to the cache, unless it has already been cached (possibly by another process).
+func (c *sharedLayerCache) Put(l v1.Layer) (v1.Layer, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	if layer, err := c.load(digest); err == nil {
+		return layer, nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create layer cache dir=%q: %w", c.dir, err)
+	}
+
+	// serialize all writers of the same blob (across processes), so the blob is only fetched once
+	lock, err := filelock.Acquire(c.blobPath(digest) + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	// another process may have added the blob while this process was waiting on the lock
+	if layer, err := c.load(digest); err == nil {
+		return layer, nil
+	}
+
+	if err := c.write(digest, l); err != nil {
+		return nil, err
+	}
+	return c.load(digest)
+}
+
+// Delete removes the cached layer for the given blob digest or diff ID.
+func (c *sharedLayerCache) Delete(h v1.Hash) error {
+	if layer, err := c.loadByDiffID(h); err == nil {
+		if err := os.Remove(c.diffIDPath(h)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		h, _ = layer.Digest()
+	}
+
+	path := c.blobPath(h)
+	// note: the blob is removed first so that it is no longer considered cached before the metadata is removed
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(path + ".json"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// write adds the blob and metadata for the given layer to the cache (the blob last, marking the layer as cached).
+func (c *sharedLayerCache) write(digest v1.Hash, l v1.Layer) error {
+	diffID, err := l.DiffID()
+	if err != nil {
+		return err
+	}
+	mediaType, err := l.MediaType()
+	if err != nil {
+		return err
+	}
+
+	path := c.blobPath(digest)
+
+	err = file.WriteFileAtomic(path+".json", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(cachedLayerMetadata{
+			DiffID:    diffID.String(),
+			MediaType: mediaType,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to cache layer=%q metadata: %w", digest, err)
+	}
+
+	err = file.WriteFileAtomic(path, func(w io.Writer) error {
+		reader, err := l.Compressed()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		hasher, err := newHasher(digest)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(io.MultiWriter(w, hasher), reader); err != nil {
+			return err
+		}
+
+		// never cache a blob that does not match the digest, since all other processes would trust it
+		if actual := fmt.Sprintf("%s:%x", digest.Algorithm, hasher.Sum(nil)); actual != digest.String() {
+			return fmt.Errorf("unexpected blob digest: %q", actual)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to cache layer=%q blob: %w", digest, err)
+	}
+
+	err = file.WriteFileAtomic(c.diffIDPath(diffID), func(w io.Writer) error {
+		_, err := io.WriteString(w, digest.String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to cache layer=%q diff ID: %w", digest, err)
+	}
+	return nil
+}
+
+// load returns the cached layer for the given digest (or an error satisfying os.IsNotExist if it is not cached).
+func (c *sharedLayerCache) load(digest v1.Hash) (v1.Layer, error) {
+	path := c.blobPath(digest)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataBytes, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata cachedLayerMetadata
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to read cached layer=%q metadata: %w", digest, err)
+	}
+
+	diffID, err := v1.NewHash(metadata.DiffID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cached layer=%q metadata: %w", digest, err)
+	}
+
+	return &cachedLayer{
+		digest:    digest,
+		diffID:    diffID,
+		mediaType: metadata.MediaType,
+		size:      info.Size(),
+		path:      path,
+	}, nil
+}
+
+// loadByDiffID returns the cached layer for the given diff ID (or an error satisfying os.IsNotExist if it is not cached).
+func (c *sharedLayerCache) loadByDiffID(diffID v1.Hash) (v1.Layer, error) {
+	contents, err := ioutil.ReadFile(c.diffIDPath(diffID))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := v1.NewHash(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cached layer for diff ID=%q: %w", diffID, err)
+	}
+	return c.load(digest)
+}
+
+// newHasher returns the hash implementation for the given digest algorithm.
+func newHasher(digest v1.Hash) (hash.Hash, error) {
+	if digest.Algorithm != "sha256" {
+		return nil, errors.New("unsupported digest algorithm: " + digest.Algorithm)
+	}
+	return sha256.New(), nil
+}
+
+// cachedLayer is a v1.Layer for a blob within the layer cache.
+type cachedLayer struct {
+	digest    v1.Hash
+	diffID    v1.Hash
+	mediaType types.MediaType
+	size      int64
+	path      string
+}
+
+func (l *cachedLayer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+func (l *cachedLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(l.path)
+}
+
+func (l *cachedLayer) Uncompressed() (io.ReadCloser, error) {
+	return newLayerBlobOpener(l.path, l.mediaType).Open()
+}
+
+func (l *cachedLayer) Size() (int64, error) {
+	return l.size, nil
+}
+
+func (l *cachedLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
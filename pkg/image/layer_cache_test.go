@@ -0,0 +1,178 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// countingCache tracks the number of layers that have been added to (or found within) the wrapped cache.
+type countingCache struct {
+	cache.Cache
+	puts int
+	hits int
+}
+
+func (c *countingCache) Put(l v1.Layer) (v1.Layer, error) {
+	c.puts++
+	return c.Cache.Put(l)
+}
+
+func (c *countingCache) Get(h v1.Hash) (v1.Layer, error) {
+	l, err := c.Cache.Get(h)
+	if err == nil {
+		c.hits++
+	}
+	return l, err
+}
+
+func TestWithLayerCache(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	layerCache := &countingCache{Cache: NewLayerCache(testTempDir(t))}
+
+	// the first read fetches all layers from the source, populating the cache
+	first := NewImage(img, testTempDir(t))
+	if err := first.Read(WithLayerCache(layerCache)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if layerCache.puts != 3 {
+		t.Errorf("expected all layers to be cached, got %d", layerCache.puts)
+	}
+
+	// a subsequent read of the same image should be served entirely from the cache
+	layerCache.puts = 0
+	second := NewImage(img, testTempDir(t))
+	if err := second.Read(WithLayerCache(layerCache)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if layerCache.puts != 0 {
+		t.Errorf("expected no additional layers to be cached, got %d", layerCache.puts)
+	}
+	if layerCache.hits < 3 {
+		t.Errorf("expected all layers to be read from the cache, got %d hits", layerCache.hits)
+	}
+
+	if len(second.Layers) != len(first.Layers) {
+		t.Errorf("unexpected number of layers: %d != %d", len(second.Layers), len(first.Layers))
+	}
+}
+
+func TestWithLayerCache_AppliedAgain(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	var counts [][2]int
+	for _, applied := range []int{1, 3} {
+		layerCache := &countingCache{Cache: NewLayerCache(testTempDir(t))}
+		subject := NewImage(img, testTempDir(t))
+		option := WithLayerCache(layerCache)
+		// each read (and refresh) applies the read options again
+		for i := 0; i < applied; i++ {
+			if err := option(subject); err != nil {
+				t.Fatalf("could not apply option: %+v", err)
+			}
+		}
+		if subject.uncachedImage != img {
+			t.Fatalf("expected the image as provided to be retained")
+		}
+		if err := subject.Read(); err != nil {
+			t.Fatalf("could not read image: %+v", err)
+		}
+		counts = append(counts, [2]int{layerCache.puts, layerCache.hits})
+	}
+
+	// the image is only wrapped once, so the cache is used the same regardless of how many times the option is applied
+	if counts[0] != counts[1] {
+		t.Errorf("unexpected cache use (puts, hits) when applied again: %v != %v", counts[1], counts[0])
+	}
+}
+
+// fetchCountingLayer tracks the number of times the compressed layer blob is fetched.
+type fetchCountingLayer struct {
+	v1.Layer
+	fetches *int32
+}
+
+func (l *fetchCountingLayer) Compressed() (io.ReadCloser, error) {
+	atomic.AddInt32(l.fetches, 1)
+	return l.Layer.Compressed()
+}
+
+func TestLayerCache_SharedDir(t *testing.T) {
+	layer, err := random.Layer(1024, "")
+	if err != nil {
+		t.Fatalf("could not create layer: %+v", err)
+	}
+	digest, err := layer.Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+
+	// each cache is independent (as with separate processes) but shares the same dir
+	dir := testTempDir(t)
+	var fetches int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewLayerCache(dir).Put(&fetchCountingLayer{Layer: layer, fetches: &fetches}); err != nil {
+				t.Errorf("could not cache layer: %+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("expected the layer blob to be fetched once, got %d", fetches)
+	}
+
+	cached, err := NewLayerCache(dir).Get(digest)
+	if err != nil {
+		t.Fatalf("could not get cached layer: %+v", err)
+	}
+
+	expected, err := layer.Uncompressed()
+	if err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+	expectedBytes, err := ioutil.ReadAll(expected)
+	if err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	actual, err := cached.Uncompressed()
+	if err != nil {
+		t.Fatalf("could not read cached layer: %+v", err)
+	}
+	defer actual.Close()
+	actualBytes, err := ioutil.ReadAll(actual)
+	if err != nil {
+		t.Fatalf("could not read cached layer: %+v", err)
+	}
+
+	if string(actualBytes) != string(expectedBytes) {
+		t.Errorf("cached layer content does not match the layer content")
+	}
+
+	if err := NewLayerCache(dir).Delete(digest); err != nil {
+		t.Fatalf("could not delete cached layer: %+v", err)
+	}
+	if _, err := NewLayerCache(dir).Get(digest); err != cache.ErrNotFound {
+		t.Errorf("expected the layer to no longer be cached: %+v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// OCIZstdLayerMediaType is the media type of a zstd compressed OCI layer blob (not known to the GCR lib).
+const OCIZstdLayerMediaType types.MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+
+// layerBlobCompression returns the compression of a layer blob as indicated by the media type, or false when the media
+// type does not indicate a compression (e.g. an unknown media type).
+func layerBlobCompression(mediaType types.MediaType) (file.Compression, bool) {
+	switch mediaType {
+	case types.DockerLayer, types.DockerForeignLayer, types.OCILayer, types.OCIRestrictedLayer:
+		return file.GzipCompression, true
+	case OCIZstdLayerMediaType:
+		return file.ZstdCompression, true
+	case types.DockerUncompressedLayer, types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer, SquashfsLayerMediaType:
+		return file.NoCompression, true
+	}
+	return file.NoCompression, false
+}
+
+// detectContentCompression determines the compression of the layer content that is not accounted for by the media
+// type, which is done once when the layer is read (not for every read of the content). Some daemon/export combinations
+// produce layers with a media type indicating the blob is uncompressed while the blob is in fact still compressed (e.g.
+// gzipped), which is recorded as a warning on the layer metadata. Content with a media type that indicates a
+// compression is never inspected.
+func (l *Layer) detectContentCompression() error {
+	l.contentCompression = file.NoCompression
+	if l.layer == nil {
+		return nil
+	}
+	compression, known := layerBlobCompression(l.Metadata.MediaType)
+	if known && (compression != file.NoCompression || isSquashfsLayer(l.Metadata.MediaType)) {
+		return nil
+	}
+
+	rawReader, _, err := l.rawReader()
+	if err != nil {
+		return err
+	}
+	defer rawReader.Close()
+
+	detected, _, err := file.DetectCompression(rawReader)
+	if err != nil {
+		return fmt.Errorf("unable to read layer=%q content: %w", l.Metadata.Digest, err)
+	}
+	if detected == file.NoCompression {
+		return nil
+	}
+
+	l.contentCompression = detected
+	if known {
+		warning := fmt.Sprintf("layer content is %s compressed but the media type (%s) indicates it is uncompressed", detected, l.Metadata.MediaType)
+		l.Metadata.Warnings = append(l.Metadata.Warnings, warning)
+		log.Warnf("layer=%q: %s", l.Metadata.Digest, warning)
+	} else {
+		log.Debugf("layer=%q content is %s compressed (media type=%q)", l.Metadata.Digest, detected, l.Metadata.MediaType)
+	}
+	return nil
+}
+
+// streamCompression returns the compression of the raw layer content stream, which is either the blob (compressed as
+// indicated by the media type) or the content as uncompressed by the GCR lib, plus any compression found by
+// detectContentCompression.
+func (l *Layer) streamCompression(fromBlob bool) file.Compression {
+	if l.contentCompression != file.NoCompression {
+		return l.contentCompression
+	}
+	if fromBlob {
+		compression, _ := layerBlobCompression(l.Metadata.MediaType)
+		return compression
+	}
+	return file.NoCompression
+}
+
+// decompressStream decompresses the raw layer content stream (see streamCompression). Closing the returned reader closes
+// the given reader.
+func (l *Layer) decompressStream(rawReader io.ReadCloser, fromBlob bool) (io.ReadCloser, error) {
+	reader, err := file.NewDecompressingReadCloser(rawReader, l.streamCompression(fromBlob))
+	if err != nil {
+		rawReader.Close()
+		return nil, fmt.Errorf("unable to read layer=%q content: %w", l.Metadata.Digest, err)
+	}
+	return reader, nil
+}
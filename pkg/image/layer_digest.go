@@ -0,0 +1,112 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+const (
+	// IgnoreLayerDigests does not verify layer content against the recorded digests (the default).
+	IgnoreLayerDigests LayerDigestPolicy = iota
+	// WarnOnLayerDigestMismatch records a warning on the layer metadata for each digest that does not match the content.
+	WarnOnLayerDigestMismatch
+	// FailOnLayerDigestMismatch fails the read as soon as a digest does not match the content (see
+	// ErrLayerDigestMismatch).
+	FailOnLayerDigestMismatch
+)
+
+// LayerDigestPolicy determines how layer content that does not match the digests recorded for the layer is handled.
+type LayerDigestPolicy uint8
+
+// ErrLayerDigestMismatch is returned when reading a layer whose content does not match a recorded digest (see
+// WithLayerDigestPolicy).
+type ErrLayerDigestMismatch struct {
+	// Layer is the position of the layer within the image manifest.
+	Layer uint
+	// Subject is the digest that was checked (e.g. "blob digest" or "diff ID").
+	Subject string
+	// Expected is the recorded digest (from the manifest or the config).
+	Expected string
+	// Actual is the digest of the content as read.
+	Actual string
+}
+
+func (e *ErrLayerDigestMismatch) Error() string {
+	return fmt.Sprintf("layer=%d %s mismatch: expected %q but found %q", e.Layer, e.Subject, e.Expected, e.Actual)
+}
+
+// WithLayerDigestPolicy verifies the content of each layer against the digests recorded for the layer while the layer is
+// read: the digest of the (compressed) layer blob against the manifest (when the blob is read from the image source)
+// and the digest of the uncompressed layer tar against the diff ID from the config (when the entire layer tar is read,
+// which excludes seekable layers). With FailOnLayerDigestMismatch reading fails as soon as a mismatch is found, with
+// WarnOnLayerDigestMismatch the mismatch is recorded as a layer warning. Note: this is checked before the layer order
+// policy, so layers that disagree with the layer order of the config are mismatched as well.
+func WithLayerDigestPolicy(policy LayerDigestPolicy) ReadOption {
+	return func(image *Image) error {
+		image.layerDigestPolicy = policy
+		return nil
+	}
+}
+
+// checkDigest handles a mismatch between the expected and actual digest according to the layer digest policy (a
+// mismatch is only reported once per subject).
+func (l *Layer) checkDigest(subject, expected, actual string) error {
+	if l.digestPolicy == IgnoreLayerDigests || expected == actual {
+		return nil
+	}
+
+	mismatch := &ErrLayerDigestMismatch{
+		Layer:    l.Metadata.Index,
+		Subject:  subject,
+		Expected: expected,
+		Actual:   actual,
+	}
+	if l.digestPolicy == FailOnLayerDigestMismatch {
+		return mismatch
+	}
+
+	warning := mismatch.Error()
+	for _, existing := range l.Metadata.Warnings {
+		if existing == warning {
+			return nil
+		}
+	}
+	l.Metadata.Warnings = append(l.Metadata.Warnings, warning)
+	log.Warnf("layer=%q: %s", l.Metadata.Digest, warning)
+	return nil
+}
+
+// digestVerifyingReader digests all content read, checking the digest once the end of the content is reached.
+type digestVerifyingReader struct {
+	io.ReadCloser
+	hasher hash.Hash
+	verify func(actual string) error
+}
+
+// newDigestVerifyingReader checks the sha256 digest of all content from the given reader with the given function once
+// the end of the content is reached (an error from the function is returned instead of io.EOF).
+func newDigestVerifyingReader(reader io.ReadCloser, verify func(actual string) error) io.ReadCloser {
+	return &digestVerifyingReader{
+		ReadCloser: reader,
+		hasher:     sha256.New(),
+		verify:     verify,
+	}
+}
+
+func (r *digestVerifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hasher.Write(p[:n])
+	if err == io.EOF && r.verify != nil {
+		verify := r.verify
+		// the content is only verified once (further reads are still at the end of the content)
+		r.verify = nil
+		if verifyErr := verify(fmt.Sprintf("sha256:%x", r.hasher.Sum(nil))); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
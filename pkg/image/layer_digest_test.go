@@ -0,0 +1,132 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// tamperedLayer reports the given digests instead of the digests of the layer content.
+type tamperedLayer struct {
+	v1.Layer
+	digest *v1.Hash
+	diffID *v1.Hash
+}
+
+func (l tamperedLayer) Digest() (v1.Hash, error) {
+	if l.digest != nil {
+		return *l.digest, nil
+	}
+	return l.Layer.Digest()
+}
+
+func (l tamperedLayer) DiffID() (v1.Hash, error) {
+	if l.diffID != nil {
+		return *l.diffID, nil
+	}
+	return l.Layer.DiffID()
+}
+
+func TestWithLayerDigestPolicy(t *testing.T) {
+	bogus, err := v1.NewHash("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	if err != nil {
+		t.Fatalf("could not create hash: %+v", err)
+	}
+
+	tests := []struct {
+		name        string
+		tamper      func(layer v1.Layer) v1.Layer
+		policy      LayerDigestPolicy
+		cacheLayers bool
+		wantSubject string
+		wantWarning bool
+	}{
+		{
+			name:   "matching digests",
+			tamper: func(layer v1.Layer) v1.Layer { return layer },
+			policy: FailOnLayerDigestMismatch,
+		},
+		{
+			name:   "mismatched blob digest ignored by default",
+			tamper: func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, digest: &bogus} },
+			policy: IgnoreLayerDigests,
+		},
+		{
+			name:        "mismatched blob digest fails",
+			tamper:      func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, digest: &bogus} },
+			policy:      FailOnLayerDigestMismatch,
+			wantSubject: "blob digest",
+		},
+		{
+			name:        "mismatched blob digest fails while caching",
+			tamper:      func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, digest: &bogus} },
+			policy:      FailOnLayerDigestMismatch,
+			cacheLayers: true,
+			wantSubject: "blob digest",
+		},
+		{
+			name:        "mismatched blob digest warns",
+			tamper:      func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, digest: &bogus} },
+			policy:      WarnOnLayerDigestMismatch,
+			wantWarning: true,
+		},
+		{
+			name:        "mismatched diff ID fails",
+			tamper:      func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, diffID: &bogus} },
+			policy:      FailOnLayerDigestMismatch,
+			wantSubject: "diff ID",
+		},
+		{
+			name:        "mismatched diff ID warns",
+			tamper:      func(layer v1.Layer) v1.Layer { return tamperedLayer{Layer: layer, diffID: &bogus} },
+			policy:      WarnOnLayerDigestMismatch,
+			wantWarning: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layer := test.tamper(newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "some/file.txt"}))
+			options := []ReadOption{WithLayerDigestPolicy(test.policy)}
+			if !test.cacheLayers {
+				options = append(options, WithStreamingLayers())
+			}
+
+			img := newTestImage(t, []v1.Layer{layer})
+			err := img.Read(options...)
+
+			if test.wantSubject != "" {
+				var mismatch *ErrLayerDigestMismatch
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("expected a digest mismatch error, got: %+v", err)
+				}
+				if mismatch.Subject != test.wantSubject || mismatch.Expected != bogus.String() || mismatch.Actual == "" {
+					t.Errorf("unexpected mismatch: %+v", mismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			var warned bool
+			for _, warning := range img.Layers[0].Metadata.Warnings {
+				if strings.Contains(warning, "mismatch") {
+					warned = true
+				}
+			}
+			if warned != test.wantWarning {
+				t.Errorf("unexpected warnings: %+v", img.Layers[0].Metadata.Warnings)
+			}
+
+			reader, err := img.FileContentsFromSquash("/some/file.txt")
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			assertContents(t, reader, "some/file.txt")
+		})
+	}
+}
@@ -13,6 +13,12 @@ type LayerMetadata struct {
 	MediaType v1Types.MediaType
 	// Size in bytes of the layer content size
 	Size int64
+	// CreatedBy is the command of the build step that created the layer (e.g. "RUN apt-get install -y curl"), from the
+	// image config history (empty if not provided).
+	CreatedBy string
+	// Warnings are notable (but recoverable) issues found while reading the layer (e.g. a layer blob that is
+	// compressed even though the media type indicates it is not).
+	Warnings []string
 }
 
 // readLayerMetadata extracts the most pertinent information from the underlying layer tar.
@@ -24,9 +30,11 @@ func readLayerMetadata(imgMetadata Metadata, layer v1.Layer, idx int) (LayerMeta
 
 	// digest = diff-id = a digest of the uncompressed layer content
 	diffIDHash := imgMetadata.Config.RootFS.DiffIDs[idx]
+	history, _ := imgMetadata.LayerHistory(idx)
 	return LayerMetadata{
 		Index:     uint(idx),
 		Digest:    diffIDHash.String(),
 		MediaType: mediaType,
+		CreatedBy: history.CreatedBy,
 	}, nil
 }
@@ -0,0 +1,328 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// LayerOpener provides the uncompressed tar content of a single layer, wherever that content is stored (a tar within
+// the content cache dir, a blob within an OCI layout, etc). Layer sources only need to implement this interface to get
+// full file tree and file content support.
+type LayerOpener interface {
+	// Open provides the entire uncompressed layer tar stream.
+	Open() (io.ReadCloser, error)
+	// OpenExtent provides (at most) size bytes of the uncompressed layer tar stream, starting at the given offset.
+	OpenExtent(offset, size int64) (io.ReadCloser, error)
+}
+
+// LayerOpenerFn selects the LayerOpener for the given layer, returning nil to use the default behavior (reading the
+// layer through the GCR lib, caching the uncompressed tar within the content cache dir).
+type LayerOpenerFn func(layer v1.Layer) LayerOpener
+
+// WithLayerOpener sets the source for the uncompressed tar content of each layer.
+func WithLayerOpener(fn LayerOpenerFn) AdditionalMetadata {
+	return func(image *Image) error {
+		image.layerOpener = fn
+		return nil
+	}
+}
+
+// extentReadCloser limits a reader to a single extent while still closing the underlying source.
+type extentReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newExtentFromStream provides an extent from a stream that cannot seek by discarding all content before the offset.
+func newExtentFromStream(reader io.ReadCloser, offset, size int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("unable to seek to offset=%d: %w", offset, err)
+	}
+	return &extentReadCloser{
+		Reader: io.LimitReader(reader, size),
+		Closer: reader,
+	}, nil
+}
+
+// newExtentFromFile provides an extent from a file that is already uncompressed.
+func newExtentFromFile(path string, offset, size int64) (io.ReadCloser, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &extentReadCloser{
+		Reader: io.NewSectionReader(fh, offset, size),
+		Closer: fh,
+	}, nil
+}
+
+// layerTarOpener is a LayerOpener for an uncompressed layer tar on disk (e.g. within the content cache dir).
+type layerTarOpener struct {
+	path string
+	// index is the index of the tar already made by the provider (nil when the tar must be read to index the layer)
+	index *savedLayerIndex
+}
+
+// NewLayerTarOpener provides a LayerOpener for an uncompressed layer tar already on disk (e.g. a tar a provider has
+// written itself), so the layer is read directly from the tar instead of making a copy within the content cache dir.
+func NewLayerTarOpener(path string) LayerOpener {
+	return layerTarOpener{path: path}
+}
+
+// NewIndexedLayerTarOpener is the same as NewLayerTarOpener, however, the tar has already been indexed by the provider
+// (e.g. while the tar was streamed from the image source), so the layer tar is only read for file contents. The given
+// entries are all tar entries (as visited with file.LenientTarEntries and file.NormalizePaths) and the skipped entries
+// are those reported while visiting. The tar must match the layer diff ID, since the index is replayed as-is (as with
+// the layer tar cache).
+func NewIndexedLayerTarOpener(path string, entries []file.Metadata, skipped []file.SkippedTarEntry) LayerOpener {
+	return layerTarOpener{
+		path: path,
+		index: &savedLayerIndex{
+			Entries: entries,
+			Skipped: skipped,
+		},
+	}
+}
+
+func (o layerTarOpener) Open() (io.ReadCloser, error) {
+	return os.Open(o.path)
+}
+
+func (o layerTarOpener) OpenExtent(offset, size int64) (io.ReadCloser, error) {
+	return newExtentFromFile(o.path, offset, size)
+}
+
+// providedIndex returns the index of the layer tar made by the provider (see NewIndexedLayerTarOpener), or nil if the
+// layer tar must be read to index the layer.
+func providedIndex(opener LayerOpener) *savedLayerIndex {
+	if counting, ok := opener.(countingLayerOpener); ok {
+		opener = counting.LayerOpener
+	}
+	if tarOpener, ok := opener.(layerTarOpener); ok {
+		return tarOpener.index
+	}
+	return nil
+}
+
+// layerBlobOpener is a LayerOpener for a (potentially compressed) layer blob on disk (e.g. within an OCI layout). The
+// blob is decompressed as indicated by the media type (the blob is only inspected, once, when the media type does not
+// indicate a compression). Random access into a compressed blob is served from an uncompressed copy of the blob, which
+// is written upon the first extent request (when a cache path is bound, see bindUncompressedCopy).
+type layerBlobOpener struct {
+	path      string
+	mediaType types.MediaType
+	// state is shared by all copies of the opener
+	state *layerBlobState
+}
+
+// layerBlobState is the compression and uncompressed copy of a layer blob, resolved once.
+type layerBlobState struct {
+	lock                sync.Mutex
+	compression         file.Compression
+	compressionResolved bool
+	// copyPath is where the uncompressed copy of the blob is written (empty to stream extents from the blob instead)
+	copyPath string
+	// copyHook is consulted before the uncompressed copy is written (see TempWriteHook)
+	copyHook TempWriteHook
+	// copied indicates that the uncompressed copy has been written to copyPath
+	copied bool
+}
+
+// NewLayerBlobOpener provides a LayerOpener for a (potentially compressed) layer blob already on disk (e.g. a blob a
+// provider has spooled itself), so the layer is read directly from the blob instead of making a copy within the content
+// cache dir. The compression of the blob is detected once, upon first read.
+func NewLayerBlobOpener(path string) LayerOpener {
+	return newLayerBlobOpener(path, "")
+}
+
+// newLayerBlobOpener provides a LayerOpener for a layer blob with the given media type (which may be empty if unknown).
+func newLayerBlobOpener(path string, mediaType types.MediaType) layerBlobOpener {
+	return layerBlobOpener{
+		path:      path,
+		mediaType: mediaType,
+		state:     &layerBlobState{},
+	}
+}
+
+// bindUncompressedCopy sets where the uncompressed copy of a compressed layer blob is written when random access is
+// needed (if the given opener reads a layer blob). The copy is only written when the first extent is requested.
+func bindUncompressedCopy(opener LayerOpener, path string, hook TempWriteHook) {
+	if counting, ok := opener.(countingLayerOpener); ok {
+		opener = counting.LayerOpener
+	}
+	blob, ok := opener.(layerBlobOpener)
+	if !ok || blob.state == nil {
+		return
+	}
+	blob.state.lock.Lock()
+	defer blob.state.lock.Unlock()
+	if blob.state.copyPath == "" {
+		blob.state.copyPath = path
+		blob.state.copyHook = hook
+	}
+}
+
+// compression returns the compression of the blob, as indicated by the media type or otherwise as detected from the
+// leading bytes of the blob (which is only done once).
+func (o layerBlobOpener) compression() (file.Compression, error) {
+	if compression, known := layerBlobCompression(o.mediaType); known && compression != file.NoCompression {
+		return compression, nil
+	}
+	if o.state == nil {
+		return o.detectCompression()
+	}
+
+	o.state.lock.Lock()
+	defer o.state.lock.Unlock()
+	if !o.state.compressionResolved {
+		compression, err := o.detectCompression()
+		if err != nil {
+			return file.NoCompression, err
+		}
+		o.state.compression = compression
+		o.state.compressionResolved = true
+	}
+	return o.state.compression, nil
+}
+
+func (o layerBlobOpener) detectCompression() (file.Compression, error) {
+	fh, err := os.Open(o.path)
+	if err != nil {
+		return file.NoCompression, fmt.Errorf("unable to open layer blob=%q : %w", o.path, err)
+	}
+	defer fh.Close()
+
+	compression, _, err := file.DetectCompression(fh)
+	if err != nil {
+		return file.NoCompression, fmt.Errorf("unable to read layer blob=%q : %w", o.path, err)
+	}
+	return compression, nil
+}
+
+// uncompressedCopy returns the path to the uncompressed copy of the blob (with the given compression), writing the copy
+// if needed, or an empty string if there is no copy (no cache path is bound or the write was vetoed).
+func (o layerBlobOpener) uncompressedCopy(compression file.Compression) (string, error) {
+	if o.state == nil {
+		return "", nil
+	}
+	o.state.lock.Lock()
+	defer o.state.lock.Unlock()
+	if o.state.copied || o.state.copyPath == "" {
+		return o.state.copyPath, nil
+	}
+
+	copyPath, ok := tempWritePath(o.state.copyHook, TempWrite{
+		Kind:          LayerTarWrite,
+		Path:          o.state.copyPath,
+		ProjectedSize: -1,
+	})
+	if !ok {
+		// don't ask again, every extent is streamed from the blob instead
+		o.state.copyPath = ""
+		return "", nil
+	}
+
+	reader, err := o.decompress(compression)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// note: the same blob may be shared by more than one image, so the copy is only moved into place once complete
+	err = file.WriteFileAtomic(copyPath, func(w io.Writer) error {
+		_, err := io.Copy(w, reader)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to write uncompressed copy of layer blob=%q : %w", o.path, err)
+	}
+	o.state.copyPath = copyPath
+	o.state.copied = true
+	return copyPath, nil
+}
+
+// copyPathIfWritten returns the path to the uncompressed copy of the blob, or an empty string if it has not been written.
+func (o layerBlobOpener) copyPathIfWritten() string {
+	if o.state == nil {
+		return ""
+	}
+	o.state.lock.Lock()
+	defer o.state.lock.Unlock()
+	if !o.state.copied {
+		return ""
+	}
+	return o.state.copyPath
+}
+
+// decompress provides the uncompressed blob stream, given the compression of the blob.
+func (o layerBlobOpener) decompress(compression file.Compression) (io.ReadCloser, error) {
+	fh, err := os.Open(o.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open layer blob=%q : %w", o.path, err)
+	}
+
+	reader, err := file.NewDecompressingReadCloser(fh, compression)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("unable to read layer blob=%q : %w", o.path, err)
+	}
+	return reader, nil
+}
+
+func (o layerBlobOpener) Open() (io.ReadCloser, error) {
+	if copyPath := o.copyPathIfWritten(); copyPath != "" {
+		return os.Open(copyPath)
+	}
+	compression, err := o.compression()
+	if err != nil {
+		return nil, err
+	}
+	return o.decompress(compression)
+}
+
+func (o layerBlobOpener) OpenExtent(offset, size int64) (io.ReadCloser, error) {
+	compression, err := o.compression()
+	if err != nil {
+		return nil, err
+	}
+	if compression == file.NoCompression {
+		return newExtentFromFile(o.path, offset, size)
+	}
+
+	copyPath, err := o.uncompressedCopy(compression)
+	if err != nil {
+		return nil, err
+	}
+	if copyPath != "" {
+		return newExtentFromFile(copyPath, offset, size)
+	}
+
+	reader, err := o.decompress(compression)
+	if err != nil {
+		return nil, err
+	}
+	return newExtentFromStream(reader, offset, size)
+}
+
+// layerStreamOpener is a LayerOpener for a layer tar that can only be streamed from the start.
+type layerStreamOpener file.OpenerFn
+
+func (o layerStreamOpener) Open() (io.ReadCloser, error) {
+	return o()
+}
+
+func (o layerStreamOpener) OpenExtent(offset, size int64) (io.ReadCloser, error) {
+	reader, err := o()
+	if err != nil {
+		return nil, err
+	}
+	return newExtentFromStream(reader, offset, size)
+}
@@ -0,0 +1,254 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestLayerOpeners(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	dir := testTempDir(t)
+	tarPath := filepath.Join(dir, "layer.tar")
+	if err := ioutil.WriteFile(tarPath, content, 0644); err != nil {
+		t.Fatalf("could not write tar: %+v", err)
+	}
+	gzipBlobPath := filepath.Join(dir, "blob.gz")
+	if err := ioutil.WriteFile(gzipBlobPath, gzipBytes(t, content), 0644); err != nil {
+		t.Fatalf("could not write blob: %+v", err)
+	}
+	zstdBlobPath := filepath.Join(dir, "blob.zst")
+	if err := ioutil.WriteFile(zstdBlobPath, zstdBytes(t, content), 0644); err != nil {
+		t.Fatalf("could not write blob: %+v", err)
+	}
+	copiedBlobOpener := newLayerBlobOpener(gzipBlobPath, types.OCILayer)
+	bindUncompressedCopy(copiedBlobOpener, filepath.Join(dir, "copy.tar"), nil)
+
+	tests := []struct {
+		name   string
+		opener LayerOpener
+	}{
+		{
+			name:   "tar",
+			opener: layerTarOpener{path: tarPath},
+		},
+		{
+			name:   "uncompressed blob",
+			opener: layerBlobOpener{path: tarPath},
+		},
+		{
+			name:   "gzipped blob",
+			opener: layerBlobOpener{path: gzipBlobPath},
+		},
+		{
+			name:   "gzipped blob (by media type)",
+			opener: newLayerBlobOpener(gzipBlobPath, types.DockerLayer),
+		},
+		{
+			name:   "gzipped blob (with uncompressed copy)",
+			opener: copiedBlobOpener,
+		},
+		{
+			name:   "zstd blob (by media type)",
+			opener: newLayerBlobOpener(zstdBlobPath, OCIZstdLayerMediaType),
+		},
+		{
+			name:   "zstd blob (detected)",
+			opener: NewLayerBlobOpener(zstdBlobPath),
+		},
+		{
+			name: "stream",
+			opener: layerStreamOpener(func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(content)), nil
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := test.opener.Open()
+			if err != nil {
+				t.Fatalf("could not open: %+v", err)
+			}
+			actual, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("could not read: %+v", err)
+			}
+			if !bytes.Equal(content, actual) {
+				t.Errorf("unexpected content: %q", string(actual))
+			}
+
+			for _, extent := range []struct {
+				offset, size int64
+				expected     string
+			}{
+				{offset: 0, size: 4, expected: "0123"},
+				{offset: 10, size: 5, expected: "abcde"},
+				{offset: 15, size: 100, expected: "fghij"},
+			} {
+				reader, err := test.opener.OpenExtent(extent.offset, extent.size)
+				if err != nil {
+					t.Fatalf("could not open extent: %+v", err)
+				}
+				actual, err := ioutil.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatalf("could not read extent: %+v", err)
+				}
+				if string(actual) != extent.expected {
+					t.Errorf("unexpected extent content (offset=%d size=%d): %q", extent.offset, extent.size, string(actual))
+				}
+			}
+		})
+	}
+}
+
+func TestLayerBlobOpener_UncompressedCopy(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	dir := testTempDir(t)
+	blobPath := filepath.Join(dir, "blob")
+	if err := ioutil.WriteFile(blobPath, zstdBytes(t, content), 0644); err != nil {
+		t.Fatalf("could not write blob: %+v", err)
+	}
+	copyPath := filepath.Join(dir, "copy.tar")
+
+	var writes []TempWrite
+	opener := countingLayerOpener{LayerOpener: newLayerBlobOpener(blobPath, OCIZstdLayerMediaType), counter: &ByteCounter{}}
+	bindUncompressedCopy(opener, copyPath, func(write TempWrite) (string, error) {
+		writes = append(writes, write)
+		return "", nil
+	})
+
+	for _, offset := range []int64{10, 0, 15} {
+		reader, err := opener.OpenExtent(offset, 5)
+		if err != nil {
+			t.Fatalf("could not open extent: %+v", err)
+		}
+		actual, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read extent: %+v", err)
+		}
+		if string(actual) != string(content[offset:offset+5]) {
+			t.Errorf("unexpected extent content (offset=%d): %q", offset, string(actual))
+		}
+	}
+
+	// the blob is decompressed once, after which all reads are served from the copy
+	if len(writes) != 1 || writes[0].Kind != LayerTarWrite || writes[0].Path != copyPath {
+		t.Fatalf("expected a single layer tar write: %+v", writes)
+	}
+	copied, err := ioutil.ReadFile(copyPath)
+	if err != nil {
+		t.Fatalf("could not read copy: %+v", err)
+	}
+	if !bytes.Equal(copied, content) {
+		t.Errorf("unexpected copy content: %q", string(copied))
+	}
+	if err := os.Remove(blobPath); err != nil {
+		t.Fatalf("could not remove blob: %+v", err)
+	}
+	reader, err := opener.Open()
+	if err != nil {
+		t.Fatalf("could not open from the copy: %+v", err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("could not read: %+v", err)
+	}
+	if !bytes.Equal(actual, content) {
+		t.Errorf("unexpected content: %q", string(actual))
+	}
+}
+
+func TestLayerBlobOpener_UncompressedCopyVetoed(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	dir := testTempDir(t)
+	blobPath := filepath.Join(dir, "blob")
+	if err := ioutil.WriteFile(blobPath, gzipBytes(t, content), 0644); err != nil {
+		t.Fatalf("could not write blob: %+v", err)
+	}
+	copyPath := filepath.Join(dir, "copy.tar")
+
+	var writes int
+	opener := newLayerBlobOpener(blobPath, types.OCILayer)
+	bindUncompressedCopy(opener, copyPath, func(TempWrite) (string, error) {
+		writes++
+		return "", fmt.Errorf("no space left")
+	})
+
+	for _, offset := range []int64{10, 0} {
+		reader, err := opener.OpenExtent(offset, 5)
+		if err != nil {
+			t.Fatalf("could not open extent: %+v", err)
+		}
+		actual, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read extent: %+v", err)
+		}
+		if string(actual) != string(content[offset:offset+5]) {
+			t.Errorf("unexpected extent content (offset=%d): %q", offset, string(actual))
+		}
+	}
+
+	// a vetoed copy is not requested again, extents are streamed from the blob instead
+	if writes != 1 {
+		t.Errorf("expected a single write request, got %d", writes)
+	}
+	if _, err := os.Stat(copyPath); !os.IsNotExist(err) {
+		t.Errorf("expected no copy to be written: %+v", err)
+	}
+}
+
+func TestImage_WithLayerOpener(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "from the custom backend"})
+
+	randomImg, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	var opened int
+	img := NewImage(randomImg, testTempDir(t),
+		WithLayerOpener(func(v1.Layer) LayerOpener {
+			return layerStreamOpener(func() (io.ReadCloser, error) {
+				opened++
+				return ioutil.NopCloser(bytes.NewReader(tarBytes)), nil
+			})
+		}),
+	)
+
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	if opened == 0 {
+		t.Fatalf("expected the custom layer opener to be used")
+	}
+
+	reader, err := img.FileContentsFromSquash(file.Path("/some/file.txt"))
+	if err != nil {
+		t.Fatalf("could not get file contents: %+v", err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(actual) != "from the custom backend" {
+		t.Errorf("unexpected contents: %q", string(actual))
+	}
+}
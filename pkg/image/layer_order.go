@@ -0,0 +1,158 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+const (
+	// FailOnLayerOrderMismatch fails the read when the layer order of the manifest and the config disagree (the default).
+	FailOnLayerOrderMismatch LayerOrderPolicy = iota
+	// TrustManifestLayerOrder keeps the layers in manifest order, describing each layer by the digest of its content.
+	TrustManifestLayerOrder
+	// TrustConfigLayerOrder reorders the layers to match the order of the diff IDs within the image config.
+	TrustConfigLayerOrder
+)
+
+// LayerOrderPolicy determines how a disagreement between the layer order of the image manifest and the order of the
+// diff IDs within the image config is handled (which is only possible for corrupted or hand-edited images).
+type LayerOrderPolicy uint8
+
+// LayerOrderMismatch describes a single layer whose position within the image manifest does not agree with the
+// position of its diff ID within the image config.
+type LayerOrderMismatch struct {
+	// ManifestIndex is the position of the layer within the image manifest.
+	ManifestIndex int
+	// ConfigIndex is the position within the image config diff IDs that matches the layer content.
+	ConfigIndex int
+	// DiffID is the digest of the uncompressed layer content.
+	DiffID string
+	// ExpectedDiffID is the diff ID found within the image config at the manifest position of the layer.
+	ExpectedDiffID string
+}
+
+// ErrLayerOrderMismatch is returned when reading an image whose manifest layer order disagrees with the config diff IDs
+// (see WithLayerOrderPolicy to trust one source instead).
+type ErrLayerOrderMismatch struct {
+	Mismatches []LayerOrderMismatch
+}
+
+func (e *ErrLayerOrderMismatch) Error() string {
+	var descriptions = make([]string, len(e.Mismatches))
+	for idx, mismatch := range e.Mismatches {
+		descriptions[idx] = mismatch.String()
+	}
+	return fmt.Sprintf("image manifest and config disagree on layer order: %s", strings.Join(descriptions, ", "))
+}
+
+// String returns a convenient display string for the mismatch.
+func (m LayerOrderMismatch) String() string {
+	return fmt.Sprintf("layer=%q is at manifest index=%d but config index=%d", m.DiffID, m.ManifestIndex, m.ConfigIndex)
+}
+
+// WithLayerOrderPolicy determines how an image whose manifest layer order disagrees with the config diff IDs is read. By
+// default such an image fails to be read (see ErrLayerOrderMismatch), otherwise the given source is trusted and the
+// disagreement is recorded on the image metadata (Metadata.LayerOrderMismatches) and on the affected layers.
+func WithLayerOrderPolicy(policy LayerOrderPolicy) ReadOption {
+	return func(image *Image) error {
+		image.layerOrderPolicy = policy
+		return nil
+	}
+}
+
+// findLayerOrderMismatches compares the content digest of each layer (in manifest order) to the config diff IDs. Only
+// layers whose content matches a diff ID at another position are considered mismatched (content that does not match
+// any diff ID is not a question of order, so such layers are left in place).
+func findLayerOrderMismatches(layers []*Layer, diffIDs []string) ([]LayerOrderMismatch, error) {
+	if len(layers) != len(diffIDs) {
+		return nil, nil
+	}
+
+	var known = make(map[string]bool)
+	for _, diffID := range diffIDs {
+		known[diffID] = true
+	}
+
+	isMismatched := func(idx int) bool {
+		digest := layers[idx].contentDigest
+		return digest != "" && digest != diffIDs[idx] && known[digest]
+	}
+
+	// claim all config positions for layers that stay in place, mismatched layers may only take the remainder
+	var claimed = make([]bool, len(diffIDs))
+	for idx := range layers {
+		claimed[idx] = !isMismatched(idx)
+	}
+
+	var mismatches []LayerOrderMismatch
+	for idx, layer := range layers {
+		if !isMismatched(idx) {
+			continue
+		}
+		configIdx := -1
+		for candidateIdx, diffID := range diffIDs {
+			if diffID == layer.contentDigest && !claimed[candidateIdx] {
+				configIdx = candidateIdx
+				break
+			}
+		}
+		if configIdx < 0 {
+			return nil, fmt.Errorf("unable to determine the config position for layer=%q at manifest index=%d", layer.contentDigest, idx)
+		}
+		claimed[configIdx] = true
+		mismatches = append(mismatches, LayerOrderMismatch{
+			ManifestIndex:  idx,
+			ConfigIndex:    configIdx,
+			DiffID:         layer.contentDigest,
+			ExpectedDiffID: diffIDs[idx],
+		})
+	}
+	return mismatches, nil
+}
+
+// applyLayerOrderPolicy detects any disagreement between the manifest layer order and the config diff IDs, returning
+// the layers in the order to be squashed according to the layer order policy.
+func (i *Image) applyLayerOrderPolicy(layers []*Layer) ([]*Layer, error) {
+	var diffIDs = make([]string, len(i.Metadata.Config.RootFS.DiffIDs))
+	for idx, diffID := range i.Metadata.Config.RootFS.DiffIDs {
+		diffIDs[idx] = diffID.String()
+	}
+
+	mismatches, err := findLayerOrderMismatches(layers, diffIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(mismatches) == 0 {
+		return layers, nil
+	}
+
+	if i.layerOrderPolicy == FailOnLayerOrderMismatch {
+		return nil, &ErrLayerOrderMismatch{Mismatches: mismatches}
+	}
+
+	i.Metadata.LayerOrderMismatches = mismatches
+	for _, mismatch := range mismatches {
+		layer := layers[mismatch.ManifestIndex]
+		warning := fmt.Sprintf("layer order mismatch: %s", mismatch)
+		layer.Metadata.Warnings = append(layer.Metadata.Warnings, warning)
+		log.Warnf("image=%q: %s", i.Metadata.ID, warning)
+		// the layer is always described by what it contains, not by what the config claims is at its position
+		layer.Metadata.Digest = mismatch.DiffID
+	}
+
+	if i.layerOrderPolicy != TrustConfigLayerOrder {
+		return layers, nil
+	}
+
+	var ordered = make([]*Layer, len(layers))
+	copy(ordered, layers)
+	for _, mismatch := range mismatches {
+		ordered[mismatch.ConfigIndex] = layers[mismatch.ManifestIndex]
+	}
+	for idx, layer := range ordered {
+		layer.Metadata.Index = uint(idx)
+	}
+	return ordered, nil
+}
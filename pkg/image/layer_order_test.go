@@ -0,0 +1,127 @@
+package image
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// swappedConfigImage is an image whose config does not agree with the layers of the underlying image.
+type swappedConfigImage struct {
+	v1.Image
+	config *v1.ConfigFile
+}
+
+func (i *swappedConfigImage) ConfigFile() (*v1.ConfigFile, error) {
+	return i.config, nil
+}
+
+// swappedDiffIDsImage returns an image where the config diff IDs for the first and last layer are swapped relative to
+// the manifest, along with the diff IDs of the layers in manifest order.
+func swappedDiffIDsImage(t *testing.T) (v1.Image, []v1.Hash) {
+	t.Helper()
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	config, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("could not get config: %+v", err)
+	}
+	original := append([]v1.Hash{}, config.RootFS.DiffIDs...)
+
+	config = config.DeepCopy()
+	config.RootFS.DiffIDs[0], config.RootFS.DiffIDs[2] = config.RootFS.DiffIDs[2], config.RootFS.DiffIDs[0]
+
+	return &swappedConfigImage{Image: img, config: config}, original
+}
+
+func TestImage_Read_LayerOrderMismatch(t *testing.T) {
+	img, _ := swappedDiffIDsImage(t)
+
+	err := NewImage(img, testTempDir(t)).Read()
+
+	var mismatchErr *ErrLayerOrderMismatch
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected a layer order mismatch error, got: %+v", err)
+	}
+	if len(mismatchErr.Mismatches) != 2 {
+		t.Fatalf("unexpected mismatches: %+v", mismatchErr.Mismatches)
+	}
+	for _, mismatch := range mismatchErr.Mismatches {
+		if mismatch.ManifestIndex+mismatch.ConfigIndex != 2 || mismatch.ManifestIndex == 1 {
+			t.Errorf("unexpected mismatch: %+v", mismatch)
+		}
+	}
+}
+
+func TestImage_Read_LayerOrderPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   LayerOrderPolicy
+		expected []int
+	}{
+		{
+			name:     "trust manifest",
+			policy:   TrustManifestLayerOrder,
+			expected: []int{0, 1, 2},
+		},
+		{
+			name:     "trust config",
+			policy:   TrustConfigLayerOrder,
+			expected: []int{2, 1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, manifestDiffIDs := swappedDiffIDsImage(t)
+
+			subject := NewImage(img, testTempDir(t))
+			if err := subject.Read(WithLayerOrderPolicy(test.policy)); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			if len(subject.Metadata.LayerOrderMismatches) != 2 {
+				t.Errorf("unexpected mismatches: %+v", subject.Metadata.LayerOrderMismatches)
+			}
+
+			for idx, layer := range subject.Layers {
+				expected := manifestDiffIDs[test.expected[idx]].String()
+				if layer.Metadata.Digest != expected {
+					t.Errorf("unexpected layer at index=%d: %q != %q", idx, layer.Metadata.Digest, expected)
+				}
+				if layer.Metadata.Index != uint(idx) {
+					t.Errorf("unexpected layer index: %d != %d", layer.Metadata.Index, idx)
+				}
+				if idx != 1 && len(layer.Metadata.Warnings) != 1 {
+					t.Errorf("expected a warning for layer=%d: %+v", idx, layer.Metadata.Warnings)
+				}
+			}
+		})
+	}
+}
+
+func TestImage_Read_NoLayerOrderMismatch(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	subject := NewImage(img, testTempDir(t))
+	if err := subject.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	if len(subject.Metadata.LayerOrderMismatches) != 0 {
+		t.Errorf("unexpected mismatches: %+v", subject.Metadata.LayerOrderMismatches)
+	}
+	for _, layer := range subject.Layers {
+		if layer.contentDigest != layer.Metadata.Digest {
+			t.Errorf("unexpected content digest: %q != %q", layer.contentDigest, layer.Metadata.Digest)
+		}
+	}
+}
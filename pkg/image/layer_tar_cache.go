@@ -0,0 +1,310 @@
+package image
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/filelock"
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// layerTarCacheSchemaVersion is the version of the persisted layer index format (bumped on incompatible changes, and when
+// metadata is added to the index, so that older indexes are not replayed without it).
+const layerTarCacheSchemaVersion = 2
+
+const (
+	layerTarCacheTarSuffix     = ".tar"
+	layerTarCacheIndexSuffix   = ".index"
+	layerTarCacheCatalogSuffix = ".catalog"
+)
+
+var ErrFileCatalogNotCached = fmt.Errorf("file catalog is not cached")
+
+// LayerTarCacheOptions tailors how long layers are retained within a layer tar cache (see NewLayerTarCache).
+type LayerTarCacheOptions struct {
+	// TTL is how long a layer remains cached since it was last used (layers never expire when zero).
+	TTL time.Duration
+	// MaxSize is the total size (in bytes) of all cached layer tars, beyond which the least recently used layers are
+	// evicted (no limit when zero).
+	MaxSize int64
+}
+
+// LayerTarCache is a persistent cache of uncompressed layer tars, along with the index of the entries within each tar,
+// keyed by diff ID. Unlike the layer blob cache (see NewLayerCache), a cached layer is neither fetched nor
+// decompressed nor scanned again: reading a layer that shares a diff ID with a cached layer (e.g. a common base layer,
+// within another image or another process run) only replays the index. Only layer tars that match the diff ID are
+// cached. The file catalogs of images read with WithDiskBackedFileCatalog are cached as well, keyed by image ID (see
+// LayerTarCache.FileCatalog). The dir may be shared by multiple processes on the same host (all files are moved into
+// place once complete).
+type LayerTarCache struct {
+	dir     string
+	options LayerTarCacheOptions
+}
+
+// savedLayerIndex is the persisted index of all entries within a cached layer tar.
+type savedLayerIndex struct {
+	SchemaVersion int
+	// Entries are all indexed tar entries, as found within the tar (before any index filter or path exclusions).
+	Entries []file.Metadata
+	// Skipped are all tar entries that could not be indexed (e.g. unsupported entry types).
+	Skipped []file.SkippedTarEntry
+}
+
+// NewLayerTarCache returns a cache of uncompressed layer tars that is persisted within the given dir (see
+// WithLayerTarCache), evicting layers as configured by the given options.
+func NewLayerTarCache(dir string, options LayerTarCacheOptions) *LayerTarCache {
+	return &LayerTarCache{
+		dir:     dir,
+		options: options,
+	}
+}
+
+// WithLayerTarCache reads all layers through the given cache: layers already within the cache are read from the cached
+// tar and index, all other layers are added to the cache once read.
+func WithLayerTarCache(c *LayerTarCache) ReadOption {
+	return func(image *Image) error {
+		image.layerTarCache = c
+		return nil
+	}
+}
+
+// paths returns the path of the cached tar and index for the given diff ID (note: ":" is not a valid filename
+// character on all platforms).
+func (c *LayerTarCache) paths(diffID string) (string, string) {
+	base := filepath.Join(c.dir, strings.Replace(diffID, ":", "-", 1))
+	return base + layerTarCacheTarSuffix, base + layerTarCacheIndexSuffix
+}
+
+// catalogPath returns the path of the cached file catalog for the given image ID.
+func (c *LayerTarCache) catalogPath(imageID string) string {
+	return filepath.Join(c.dir, strings.Replace(imageID, ":", "-", 1)+layerTarCacheCatalogSuffix)
+}
+
+// FileCatalog opens the file catalog cached for the image with the given ID (by an earlier read of the image with
+// WithDiskBackedFileCatalog, possibly within another process), returning ErrFileCatalogNotCached if there is none.
+// The entries remain on disk (only read upon lookup) and file references keep their IDs (as with LoadFileCatalog).
+// Content is read from the cached layer tars, where content of layers that are not cached cannot be read. Any content
+// requested from the catalog is cached within the given contents cache dir. The catalog cannot be added to without
+// moving all entries into memory.
+func (c *LayerTarCache) FileCatalog(imageID, contentsCacheDir string) (FileCatalog, error) {
+	path := c.catalogPath(imageID)
+	if _, err := os.Stat(path); err != nil {
+		return FileCatalog{}, fmt.Errorf("%w: image=%q", ErrFileCatalogNotCached, imageID)
+	}
+
+	catalog, err := openFileCatalog(path, contentsCacheDir)
+	if err != nil {
+		return FileCatalog{}, err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		log.Debugf("unable to mark cached file catalog for image=%q as used: %+v", imageID, err)
+	}
+	return catalog, nil
+}
+
+// putFileCatalog adds the given file catalog of the image with the given ID to the cache (replacing any earlier
+// catalog for the image), evicting cached items as needed.
+func (c *LayerTarCache) putFileCatalog(imageID string, catalog *FileCatalog) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create layer tar cache dir=%q: %w", c.dir, err)
+	}
+	if err := catalog.persist(c.catalogPath(imageID), c.describeLayer); err != nil {
+		return fmt.Errorf("unable to cache file catalog for image=%q: %w", imageID, err)
+	}
+	return c.Prune()
+}
+
+// describeLayer records the given layer for a cached file catalog, where layers within the cache are read from the
+// cached tar (the tar the layer was read from is typically removed along with the image).
+func (c *LayerTarCache) describeLayer(layer *Layer) savedFileCatalogLayer {
+	saved := newSavedFileCatalogLayer(layer)
+	if layer == nil || layer.Metadata.Digest == "" {
+		return saved
+	}
+	tarPath, _ := c.paths(layer.Metadata.Digest)
+	if _, err := os.Stat(tarPath); err == nil {
+		saved.TarPath = tarPath
+		saved.BlobPath = ""
+	}
+	return saved
+}
+
+// get returns the path of the cached tar and the index for the given diff ID (false if the layer is not cached),
+// marking the layer as recently used.
+func (c *LayerTarCache) get(diffID string) (string, *savedLayerIndex, bool) {
+	tarPath, indexPath := c.paths(diffID)
+	if _, err := os.Stat(tarPath); err != nil {
+		return "", nil, false
+	}
+
+	fh, err := os.Open(indexPath)
+	if err != nil {
+		return "", nil, false
+	}
+	defer fh.Close()
+
+	var index savedLayerIndex
+	if err := gob.NewDecoder(fh).Decode(&index); err != nil || index.SchemaVersion != layerTarCacheSchemaVersion {
+		log.Debugf("ignoring unreadable layer tar cache index=%q: %+v", indexPath, err)
+		return "", nil, false
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(indexPath, now, now); err != nil {
+		log.Debugf("unable to mark cached layer=%q as used: %+v", diffID, err)
+	}
+	return tarPath, &index, true
+}
+
+// put adds the given layer tar (and index) to the cache, evicting layers as needed. The tar is hard linked into the
+// cache when possible (otherwise copied).
+func (c *LayerTarCache) put(diffID, sourcePath string, index savedLayerIndex) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create layer tar cache dir=%q: %w", c.dir, err)
+	}
+
+	tarPath, indexPath := c.paths(diffID)
+	if err := linkOrCopyFile(sourcePath, tarPath); err != nil {
+		return fmt.Errorf("unable to cache layer=%q tar: %w", diffID, err)
+	}
+
+	// note: the index is written last, marking the layer as cached
+	index.SchemaVersion = layerTarCacheSchemaVersion
+	err := file.WriteFileAtomic(indexPath, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(index)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to cache layer=%q index: %w", diffID, err)
+	}
+
+	return c.Prune()
+}
+
+// linkOrCopyFile places the given file at the given destination (replacing any existing file), hard linking the file
+// when possible.
+func linkOrCopyFile(source, destination string) error {
+	linkPath := filepath.Join(filepath.Dir(destination), fmt.Sprintf(".%s.link-%d", filepath.Base(destination), time.Now().UnixNano()))
+	if err := os.Link(source, linkPath); err == nil {
+		if err := os.Rename(linkPath, destination); err != nil {
+			os.Remove(linkPath)
+			return err
+		}
+		return nil
+	}
+
+	return file.WriteFileAtomic(destination, func(w io.Writer) error {
+		fh, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		_, err = io.Copy(w, fh)
+		return err
+	})
+}
+
+// cachedItem is a single layer (or file catalog) within the cache (as considered for eviction).
+type cachedItem struct {
+	// paths are all files of the item, removed in order (the first file marks the item as cached)
+	paths    []string
+	size     int64
+	lastUsed time.Time
+}
+
+// Prune evicts all layers and file catalogs that have not been used within the TTL, followed by the least recently
+// used items until the total size of the cache is within the max size. This is done after each layer (or catalog) is
+// added, so it is only needed to apply changed options (or to evict items without reading images).
+func (c *LayerTarCache) Prune() error {
+	if c.options.TTL <= 0 && c.options.MaxSize <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create layer tar cache dir=%q: %w", c.dir, err)
+	}
+
+	// serialize all processes pruning the same cache
+	lock, err := filelock.Acquire(filepath.Join(c.dir, "prune.lock"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	items, err := c.items()
+	if err != nil {
+		return err
+	}
+
+	// most recently used first
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].lastUsed.After(items[j].lastUsed)
+	})
+
+	var total int64
+	for _, item := range items {
+		total += item.size
+		expired := c.options.TTL > 0 && time.Since(item.lastUsed) > c.options.TTL
+		oversize := c.options.MaxSize > 0 && total > c.options.MaxSize
+		if !expired && !oversize {
+			continue
+		}
+		total -= item.size
+
+		for _, path := range item.paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to evict cached item=%q: %w", path, err)
+			}
+		}
+		log.Debugf("evicted cached item=%q (expired=%t)", item.paths[len(item.paths)-1], expired)
+	}
+	return nil
+}
+
+// items returns all (complete) layers and file catalogs within the cache.
+func (c *LayerTarCache) items() ([]cachedItem, error) {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read layer tar cache dir=%q: %w", c.dir, err)
+	}
+
+	var items []cachedItem
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(c.dir, name)
+		switch {
+		case strings.HasSuffix(name, layerTarCacheIndexSuffix):
+			tarPath := strings.TrimSuffix(path, layerTarCacheIndexSuffix) + layerTarCacheTarSuffix
+			tarInfo, err := os.Stat(tarPath)
+			if err != nil {
+				continue
+			}
+			items = append(items, cachedItem{
+				// note: the index is removed first so that the layer is no longer considered cached before the tar is
+				// removed
+				paths:    []string{path, tarPath},
+				size:     tarInfo.Size(),
+				lastUsed: info.ModTime(),
+			})
+		case strings.HasSuffix(name, layerTarCacheCatalogSuffix):
+			items = append(items, cachedItem{
+				paths:    []string{path},
+				size:     info.Size(),
+				lastUsed: info.ModTime(),
+			})
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,255 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// sourcelessImage is an image whose layer content cannot be obtained from the image source.
+type sourcelessImage struct {
+	v1.Image
+}
+
+func (i sourcelessImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for idx, layer := range layers {
+		layers[idx] = sourcelessLayer{Layer: layer}
+	}
+	return layers, nil
+}
+
+type sourcelessLayer struct {
+	v1.Layer
+}
+
+func (sourcelessLayer) Compressed() (io.ReadCloser, error) {
+	return nil, errors.New("layer content is not available")
+}
+
+func (sourcelessLayer) Uncompressed() (io.ReadCloser, error) {
+	return nil, errors.New("layer content is not available")
+}
+
+func TestWithLayerTarCache(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	cacheDir := testTempDir(t)
+	tarCache := NewLayerTarCache(cacheDir, LayerTarCacheOptions{})
+
+	// the first read fetches all layers from the source, populating the cache
+	first := NewImage(img, testTempDir(t))
+	if err := first.Read(WithLayerTarCache(tarCache)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	indexes, err := filepath.Glob(filepath.Join(cacheDir, "*"+layerTarCacheIndexSuffix))
+	if err != nil {
+		t.Fatalf("could not list cache: %+v", err)
+	}
+	if len(indexes) != 2 {
+		t.Errorf("expected all layers to be cached, got %d", len(indexes))
+	}
+
+	// a subsequent read (e.g. by another process) is served entirely from the cache without the layer source
+	second := NewImage(sourcelessImage{Image: img}, testTempDir(t))
+	if err := second.Read(WithLayerTarCache(tarCache)); err != nil {
+		t.Fatalf("could not read image from the cache: %+v", err)
+	}
+
+	for idx, layer := range first.Layers {
+		expected := layer.Tree.AllRealPaths()
+		actual := second.Layers[idx].Tree.AllRealPaths()
+		if len(actual) != len(expected) {
+			t.Fatalf("layer=%d: unexpected paths: %+v != %+v", idx, actual, expected)
+		}
+		if second.Layers[idx].Metadata.Size != layer.Metadata.Size {
+			t.Errorf("layer=%d: unexpected size: %d != %d", idx, second.Layers[idx].Metadata.Size, layer.Metadata.Size)
+		}
+
+		for _, ref := range layer.Tree.AllFiles() {
+			metadata, err := first.FileCatalog.Get(ref)
+			if err != nil || metadata.Metadata.IsDir {
+				continue
+			}
+			expectedContents := readLayerFile(t, layer, ref.RealPath)
+			actualContents := readLayerFile(t, second.Layers[idx], ref.RealPath)
+			if actualContents != expectedContents {
+				t.Errorf("layer=%d: unexpected contents for %q", idx, ref.RealPath)
+			}
+		}
+	}
+}
+
+func readLayerFile(t *testing.T, layer *Layer, path file.Path) string {
+	t.Helper()
+	reader, err := layer.FileContents(path)
+	if err != nil {
+		t.Fatalf("could not get contents of %q: %+v", path, err)
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents of %q: %+v", path, err)
+	}
+	return string(contents)
+}
+
+func TestLayerTarCache_Prune(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  LayerTarCacheOptions
+		expected []string
+	}{
+		{
+			name:     "no limits",
+			expected: []string{"sha256:new", "sha256:recent", "sha256:old"},
+		},
+		{
+			name:     "max size evicts least recently used",
+			options:  LayerTarCacheOptions{MaxSize: 20},
+			expected: []string{"sha256:new", "sha256:recent"},
+		},
+		{
+			name:     "ttl evicts expired",
+			options:  LayerTarCacheOptions{TTL: time.Hour},
+			expected: []string{"sha256:new"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testTempDir(t)
+			// note: layers are added without limits, so that nothing is evicted before the layers are aged
+			tarCache := NewLayerTarCache(dir, LayerTarCacheOptions{})
+
+			source := filepath.Join(testTempDir(t), "layer.tar")
+			if err := ioutil.WriteFile(source, []byte("0123456789"), 0644); err != nil {
+				t.Fatalf("could not write tar: %+v", err)
+			}
+
+			ages := map[string]time.Duration{
+				"sha256:old":    3 * time.Hour,
+				"sha256:recent": 2 * time.Hour,
+				"sha256:new":    0,
+			}
+			for diffID, age := range ages {
+				if err := tarCache.put(diffID, source, savedLayerIndex{}); err != nil {
+					t.Fatalf("could not cache layer: %+v", err)
+				}
+				_, indexPath := tarCache.paths(diffID)
+				used := time.Now().Add(-age)
+				if err := os.Chtimes(indexPath, used, used); err != nil {
+					t.Fatalf("could not set times: %+v", err)
+				}
+			}
+
+			if err := NewLayerTarCache(dir, test.options).Prune(); err != nil {
+				t.Fatalf("could not prune: %+v", err)
+			}
+
+			for diffID := range ages {
+				_, _, ok := tarCache.get(diffID)
+				if ok != contains(test.expected, diffID) {
+					t.Errorf("unexpected cached state for %q: %t", diffID, ok)
+				}
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLayerTarCache_FileCatalog(t *testing.T) {
+	tarCache := NewLayerTarCache(testTempDir(t), LayerTarCacheOptions{})
+
+	first := newTestImage(t, []v1.Layer{newTestLayer(t, map[string]string{
+		"etc/app.conf": "setting=on",
+		"usr/bin/app":  "#!/bin/sh",
+	})})
+	if err := first.Read(WithLayerTarCache(tarCache), WithDiskBackedFileCatalog(1)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	_, ref, err := squashedTreeOf(t, first).File("/etc/app.conf")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find file: %+v", err)
+	}
+	expected, err := first.FileCatalog.Get(*ref)
+	if err != nil {
+		t.Fatalf("could not get entry: %+v", err)
+	}
+	entries := first.FileCatalog.Stats().Entries
+	if err := first.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup image: %+v", err)
+	}
+
+	if _, err := tarCache.FileCatalog("sha256:missing", testTempDir(t)); !errors.Is(err, ErrFileCatalogNotCached) {
+		t.Errorf("expected ErrFileCatalogNotCached, got %+v", err)
+	}
+
+	// a later process opens the catalog without reading the image, where references keep their IDs
+	catalog, err := tarCache.FileCatalog(first.Metadata.ID, testTempDir(t))
+	if err != nil {
+		t.Fatalf("could not open cached catalog: %+v", err)
+	}
+	defer catalog.close()
+
+	if _, ok := catalog.store.(*boltFileCatalogStore); !ok {
+		t.Fatalf("expected the entries to remain on disk, got %T", catalog.store)
+	}
+	if catalog.Stats().Entries != entries {
+		t.Errorf("unexpected number of entries: %d", catalog.Stats().Entries)
+	}
+
+	actual, err := catalog.Get(*ref)
+	if err != nil {
+		t.Fatalf("could not get entry from cached catalog: %+v", err)
+	}
+	for _, d := range deep.Equal(actual.Metadata, expected.Metadata) {
+		t.Errorf("unexpected metadata: %s", d)
+	}
+
+	// the content is read from the cached layer tar (the tar the image was read from is removed along with the image)
+	if opener, ok := actual.Layer.opener.(layerTarOpener); !ok || filepath.Dir(opener.path) != tarCache.dir {
+		t.Errorf("expected the layer to be read from the cache, got %+v", actual.Layer.opener)
+	}
+	reader, err := catalog.FileContents(*ref)
+	if err != nil {
+		t.Fatalf("could not get contents: %+v", err)
+	}
+	assertContents(t, reader, "setting=on")
+
+	// the catalog is evicted along with the layers
+	used := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(tarCache.catalogPath(first.Metadata.ID), used, used); err != nil {
+		t.Fatalf("could not set times: %+v", err)
+	}
+	if err := NewLayerTarCache(tarCache.dir, LayerTarCacheOptions{TTL: time.Hour}).Prune(); err != nil {
+		t.Fatalf("could not prune: %+v", err)
+	}
+	if _, err := tarCache.FileCatalog(first.Metadata.ID, testTempDir(t)); !errors.Is(err, ErrFileCatalogNotCached) {
+		t.Errorf("expected the catalog to be evicted, got %+v", err)
+	}
+}
@@ -0,0 +1,591 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+)
+
+// fakeLayer is a v1.Layer that provides the given bytes as the uncompressed layer content (and optionally as the
+// layer blob).
+type fakeLayer struct {
+	testLayerContent
+	uncompressed []byte
+	compressed   []byte
+	mediaType    types.MediaType
+}
+
+func (f *fakeLayer) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(f.uncompressed)), nil
+}
+
+func (f *fakeLayer) Compressed() (io.ReadCloser, error) {
+	if f.compressed == nil {
+		return f.testLayerContent.Compressed()
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.compressed)), nil
+}
+
+func (f *fakeLayer) MediaType() (types.MediaType, error) {
+	return f.mediaType, nil
+}
+
+// newTestTar writes a tar with a regular file for each of the given files (in name order), followed by the given
+// entries (in order). All entries without a mode are given mode 0644, and each regular file entry holds its name as
+// the contents.
+func newTestTar(t testing.TB, files map[string]string, entries ...tar.Header) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	write := func(header tar.Header, contents string) {
+		if header.Mode == 0 {
+			header.Mode = 0o644
+		}
+		header.Size = int64(len(contents))
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("could not write contents: %+v", err)
+		}
+	}
+
+	// note: files are written in name order, so the tar is the same for the same files
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(tar.Header{Typeflag: tar.TypeReg, Name: name}, files[name])
+	}
+	for _, entry := range entries {
+		var contents string
+		if entry.Typeflag == tar.TypeReg {
+			contents = entry.Name
+		}
+		write(entry, contents)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+// newTestLayer provides the tar written by newTestTar (for the given files and entries) as a layer.
+func newTestLayer(t testing.TB, files map[string]string, entries ...tar.Header) v1.Layer {
+	t.Helper()
+	tarBytes := newTestTar(t, files, entries...)
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(tarBytes)), nil
+	})
+	if err != nil {
+		t.Fatalf("could not create layer: %+v", err)
+	}
+	return layer
+}
+
+// newTestImage provides an (unread) image made of the given layers (the first layer is the base layer) with the given
+// metadata, where the image content is cached within a temp dir removed with the test.
+func newTestImage(t testing.TB, layers []v1.Layer, metadata ...AdditionalMetadata) *Image {
+	t.Helper()
+	v1Img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	return NewImage(v1Img, testTempDir(t), metadata...)
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(b); err != nil {
+		t.Fatalf("could not gzip: %+v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("could not close gzip writer: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t testing.TB, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatalf("could not create zstd writer: %+v", err)
+	}
+	if _, err := zw.Write(b); err != nil {
+		t.Fatalf("could not zstd: %+v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("could not close zstd writer: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+func testTempDir(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stereoscope-layer-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func testImageMetadata(t *testing.T) Metadata {
+	t.Helper()
+	diffID, err := v1.NewHash("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatalf("could not create hash: %+v", err)
+	}
+	var metadata Metadata
+	metadata.Config.RootFS.DiffIDs = []v1.Hash{diffID}
+	return metadata
+}
+
+func TestLayer_Read_CompressedContentWithUncompressedMediaType(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "contents!"})
+
+	tests := []struct {
+		name             string
+		content          []byte
+		cacheDir         bool
+		expectedWarnings int
+	}{
+		{
+			name:             "uncompressed",
+			content:          tarBytes,
+			expectedWarnings: 0,
+		},
+		{
+			name:             "gzipped",
+			content:          gzipBytes(t, tarBytes),
+			expectedWarnings: 1,
+		},
+		{
+			name:             "gzipped with cache dir",
+			content:          gzipBytes(t, tarBytes),
+			cacheDir:         true,
+			expectedWarnings: 1,
+		},
+		{
+			name:             "zstd compressed",
+			content:          zstdBytes(t, tarBytes),
+			expectedWarnings: 1,
+		},
+		{
+			name:             "first entry name is the bzip2 magic",
+			content:          newTestTar(t, map[string]string{"BZh91AY&SY": "", "some/file.txt": "contents!"}),
+			expectedWarnings: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cacheDir string
+			if test.cacheDir {
+				cacheDir = testTempDir(t)
+			}
+			catalog := NewFileCatalog(testTempDir(t))
+			layer := NewLayer(&fakeLayer{uncompressed: test.content, mediaType: types.DockerUncompressedLayer})
+
+			if err := layer.Read(&catalog, testImageMetadata(t), 0, cacheDir); err != nil {
+				t.Fatalf("could not read layer: %+v", err)
+			}
+
+			if len(layer.Metadata.Warnings) != test.expectedWarnings {
+				t.Errorf("unexpected warnings: %+v", layer.Metadata.Warnings)
+			}
+
+			// content is read concurrently without inspecting (or modifying) the layer again
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					reader, err := layer.FileContents(file.Path("/some/file.txt"))
+					if err != nil {
+						t.Errorf("could not get file contents: %+v", err)
+						return
+					}
+					actual, err := ioutil.ReadAll(reader)
+					if err != nil {
+						t.Errorf("could not read contents: %+v", err)
+					}
+					if string(actual) != "contents!" {
+						t.Errorf("unexpected contents: %q", string(actual))
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(layer.Metadata.Warnings) != test.expectedWarnings {
+				t.Errorf("unexpected warnings after reading contents: %+v", layer.Metadata.Warnings)
+			}
+		})
+	}
+}
+
+func TestLayer_Read_ZstdMediaType(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "contents!"})
+
+	// note: the GCR lib cannot uncompress zstd blobs, so the blob is decompressed as indicated by the media type
+	catalog := NewFileCatalog(testTempDir(t))
+	layer := NewLayer(&fakeLayer{compressed: zstdBytes(t, tarBytes), mediaType: OCIZstdLayerMediaType})
+
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, testTempDir(t)); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+	if len(layer.Metadata.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %+v", layer.Metadata.Warnings)
+	}
+
+	reader, err := layer.FileContents(file.Path("/some/file.txt"))
+	if err != nil {
+		t.Fatalf("could not get file contents: %+v", err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(actual) != "contents!" {
+		t.Errorf("unexpected contents: %q", string(actual))
+	}
+}
+
+func TestLayer_Read_FromBlob(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "contents!"})
+
+	blobPath := filepath.Join(testTempDir(t), "blob")
+	if err := ioutil.WriteFile(blobPath, gzipBytes(t, tarBytes), 0644); err != nil {
+		t.Fatalf("could not write blob: %+v", err)
+	}
+
+	cacheDir := testTempDir(t)
+	catalog := NewFileCatalog(testTempDir(t))
+	layer := NewLayer(&fakeLayer{mediaType: types.OCILayer})
+	layer.opener = layerBlobOpener{path: blobPath}
+
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, cacheDir); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	cached, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("could not read cache dir: %+v", err)
+	}
+	if len(cached) != 0 {
+		t.Errorf("expected no cached layer content, found %d entries", len(cached))
+	}
+
+	reader, err := layer.FileContents(file.Path("/some/file.txt"))
+	if err != nil {
+		t.Fatalf("could not get file contents: %+v", err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(actual) != "contents!" {
+		t.Errorf("unexpected contents: %q", string(actual))
+	}
+}
+
+func TestLayer_Read_IndexOnlyPaths(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{
+		"usr/bin/ls":       "ls",
+		"etc/passwd":       "root",
+		"var/log/messages": "log",
+		"etc/.wh.shadow":   "",
+	})
+
+	catalog := NewFileCatalog(testTempDir(t))
+	layer := NewLayer(&fakeLayer{uncompressed: tarBytes, mediaType: types.DockerLayer})
+	layer.indexFilter = newIndexPathFilter("/etc")
+
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, ""); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	for p, expected := range map[file.Path]bool{
+		"/etc/passwd":       true,
+		"/etc/.wh.shadow":   true,
+		"/usr/bin/ls":       false,
+		"/var/log/messages": false,
+	} {
+		if actual := layer.Tree.HasPath(p); actual != expected {
+			t.Errorf("unexpected presence of %q in tree: %v", p, actual)
+		}
+	}
+
+	if layer.Metadata.Size != int64(len("ls")+len("root")+len("log")) {
+		t.Errorf("expected layer size to account for all files, got %d", layer.Metadata.Size)
+	}
+}
+
+func TestLayer_FilesByGlob(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{
+		"etc/passwd":   "root",
+		"etc/group":    "wheel",
+		"usr/bin/ls":   "ls",
+		"etc/os/alpha": "alpha",
+	})
+
+	catalog := NewFileCatalog(testTempDir(t))
+	layer := NewLayer(&fakeLayer{uncompressed: tarBytes, mediaType: types.DockerLayer})
+	if err := layer.Read(&catalog, testImageMetadata(t), 0, ""); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	results, err := layer.FilesByGlob("/etc/*")
+	if err != nil {
+		t.Fatalf("could not glob: %+v", err)
+	}
+
+	var actual []string
+	for _, result := range results {
+		actual = append(actual, string(result.MatchPath))
+	}
+	sort.Strings(actual)
+
+	expected := []string{"/etc/group", "/etc/passwd"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected matches: %+v", actual)
+	}
+
+	for _, result := range results {
+		if result.MatchPath != "/etc/passwd" {
+			continue
+		}
+		reader, err := layer.FileContents(result.RealPath)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("could not read file: %+v", err)
+		}
+		if string(contents) != "root" {
+			t.Errorf("unexpected contents: %q", string(contents))
+		}
+	}
+}
+
+func TestLayer_Read_StrictTarEntries(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "some/file.txt", Mode: 0o644},
+		{Typeflag: 'Z', Name: "some/unknown", Mode: 0o644},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	lenient := NewLayer(&fakeLayer{uncompressed: buf.Bytes(), mediaType: types.DockerLayer})
+	catalog := NewFileCatalog(testTempDir(t))
+	if err := lenient.Read(&catalog, testImageMetadata(t), 0, ""); err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+	if !lenient.Tree.HasPath("/some/file.txt") || lenient.Tree.HasPath("/some/unknown") {
+		t.Errorf("expected the unknown entry to be skipped")
+	}
+
+	strict := NewLayer(&fakeLayer{uncompressed: buf.Bytes(), mediaType: types.DockerLayer})
+	strict.tarEntryPolicy = file.StrictTarEntries
+	catalog = NewFileCatalog(testTempDir(t))
+	if err := strict.Read(&catalog, testImageMetadata(t), 0, ""); !errors.Is(err, file.ErrUnsupportedTarEntry) {
+		t.Errorf("expected an unsupported tar entry error, got %+v", err)
+	}
+}
+
+func TestLayer_SkippedEntries(t *testing.T) {
+	layer := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/shadow"},
+		tar.Header{Typeflag: 'Z', Name: "unknown"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "../escape.txt"},
+	)
+
+	img := newTestImage(t, []v1.Layer{layer})
+	if err := img.Read(WithExclusions(strings.NewReader("/etc/shadow"))); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	expected := map[string]file.SkipReason{
+		"/etc/shadow": file.FilteredTarEntry,
+		"/unknown":    file.UnsupportedTarEntry,
+		"/escape.txt": file.SanitizedTarEntry,
+	}
+
+	skipped := img.Layers[0].SkippedEntries()
+	if len(skipped) != len(expected) {
+		t.Fatalf("unexpected skipped entries: %+v", skipped)
+	}
+	for _, entry := range skipped {
+		if reason, ok := expected[entry.Path]; !ok || reason != entry.Reason {
+			t.Errorf("unexpected skipped entry: %+v", entry)
+		}
+	}
+
+	// sanitized entries are still indexed (at the sanitized path), other skipped entries are not
+	if !img.Layers[0].Tree.HasPath("/escape.txt") {
+		t.Errorf("expected the sanitized entry to be indexed")
+	}
+	if img.Layers[0].Tree.HasPath("/etc/shadow") || img.Layers[0].Tree.HasPath("/unknown") {
+		t.Errorf("expected skipped entries to not be indexed")
+	}
+}
+
+func TestLayer_Read_SpecialFiles(t *testing.T) {
+	img := newTestImage(t, []v1.Layer{newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "dev/"},
+		tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0o666, Devmajor: 1, Devminor: 3},
+		tar.Header{Typeflag: tar.TypeBlock, Name: "dev/sda", Mode: 0o660, Devmajor: 8},
+		tar.Header{Typeflag: tar.TypeFifo, Name: "run/initctl", Mode: 0o600},
+	)})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	tests := []struct {
+		path     file.Path
+		fileType file.Type
+		major    int64
+		minor    int64
+	}{
+		{path: "/dev/null", fileType: file.TypeCharacterDevice, major: 1, minor: 3},
+		{path: "/dev/sda", fileType: file.TypeBlockDevice, major: 8},
+		{path: "/run/initctl", fileType: file.TypeFifo},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			var nodeType file.Type
+			err := img.Layers[0].Tree.WalkNodes(func(p file.Path, n filenode.FileNode) error {
+				if p == test.path {
+					nodeType = n.FileType
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("could not walk tree: %+v", err)
+			}
+			if nodeType != test.fileType {
+				t.Errorf("unexpected node type: %q != %q", nodeType, test.fileType)
+			}
+
+			metadata, err := img.FileMetadataFromSquash(test.path)
+			if err != nil {
+				t.Fatalf("could not fetch metadata: %+v", err)
+			}
+			if metadata.DevMajor != test.major || metadata.DevMinor != test.minor {
+				t.Errorf("unexpected device numbers: %d/%d", metadata.DevMajor, metadata.DevMinor)
+			}
+		})
+	}
+}
+
+func TestImage_Read_WithPathPolicy(t *testing.T) {
+	layer := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "../../etc/shadow"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc//hosts"},
+	)
+
+	tests := []struct {
+		name       string
+		policy     file.PathPolicy
+		indexed    []file.Path
+		notIndexed []file.Path
+		reason     file.SkipReason
+		wantErr    bool
+	}{
+		{
+			name:    "normalize",
+			policy:  file.NormalizePaths,
+			indexed: []file.Path{"/etc/passwd", "/etc/shadow", "/etc/hosts"},
+			reason:  file.SanitizedTarEntry,
+		},
+		{
+			name:       "quarantine",
+			policy:     file.QuarantineSuspiciousPaths,
+			indexed:    []file.Path{"/etc/passwd"},
+			notIndexed: []file.Path{"/etc/shadow", "/etc/hosts"},
+			reason:     file.QuarantinedTarEntry,
+		},
+		{
+			name:    "reject",
+			policy:  file.RejectSuspiciousPaths,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := newTestImage(t, []v1.Layer{layer})
+			err := img.Read(WithPathPolicy(test.policy))
+			if test.wantErr {
+				if !errors.Is(err, file.ErrSuspiciousTarEntry) {
+					t.Errorf("expected a suspicious tar entry error, got %+v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			for _, p := range test.indexed {
+				if !squashedTreeOf(t, img).HasPath(p) {
+					t.Errorf("expected path to be indexed: %q", p)
+				}
+			}
+			for _, p := range test.notIndexed {
+				if squashedTreeOf(t, img).HasPath(p) {
+					t.Errorf("expected path to not be indexed: %q", p)
+				}
+			}
+
+			suspicious := img.Layers[0].SuspiciousEntries()
+			if len(suspicious) != 2 {
+				t.Fatalf("unexpected suspicious entries: %+v", suspicious)
+			}
+			for _, entry := range suspicious {
+				if entry.Reason != test.reason {
+					t.Errorf("unexpected reason: %+v", entry)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+const (
+	// SymlinkFarm links each regular file within the farm to the extracted layer file with an absolute symlink.
+	SymlinkFarm LinkFarmMode = iota
+	// HardlinkFarm links each regular file within the farm to the extracted layer file with a hardlink (the farm must be
+	// on the same filesystem as the content cache dir).
+	HardlinkFarm
+)
+
+// extractedLayersDir is the directory within the content cache dir where layers are extracted (see ExportLinkFarm).
+const extractedLayersDir = "extracted"
+
+// LinkFarmMode is how regular files within a link farm refer to the extracted layer files.
+type LinkFarmMode uint8
+
+// ExportLinkFarm materializes the squashed tree of the image within the given destination directory without copying
+// file contents: each layer that provides a file to the squashed tree is extracted once into the content cache dir (and
+// reused on later exports), and each regular file within the farm is a link to the extracted file from the layer that
+// provides it. Directories are created as real directories, symlinks are recreated (absolute symlinks are rewritten
+// relative to the farm root so they resolve within the farm), and hardlinks are linked to the extracted file they
+// resolve to. Other entry types (e.g. devices) are skipped. Extracted files are read-only so that the originals cannot
+// be changed through the farm. This is intended for browsing an image on the host while debugging.
+func (i *Image) ExportLinkFarm(ctx context.Context, dest string, mode LinkFarmMode) error {
+	if i.contentCacheDir == "" {
+		return fmt.Errorf("unable to export link farm: no content cache dir to extract layers into")
+	}
+	if err := i.IndexLayers(ctx); err != nil {
+		return err
+	}
+
+	squashedTree := i.squashedTree()
+	if squashedTree == nil {
+		return fmt.Errorf("unable to export link farm: image has not been read")
+	}
+
+	var nodes []*filenode.FileNode
+	for _, n := range squashedTree.Reader().Nodes() {
+		if fn, ok := n.(*filenode.FileNode); ok && fn != nil {
+			nodes = append(nodes, fn)
+		}
+	}
+	// parents must be created before children
+	sort.Slice(nodes, func(a, b int) bool {
+		return nodes[a].RealPath < nodes[b].RealPath
+	})
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("unable to create link farm dir=%q: %w", dest, err)
+	}
+
+	extracted := make(map[*Layer]string)
+	for _, node := range nodes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := i.exportLinkFarmNode(ctx, dest, mode, node, extracted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportLinkFarmNode creates the entry within the link farm for the given squashed tree node, extracting the providing
+// layer as needed (extracted layer dirs are tracked in the given map).
+func (i *Image) exportLinkFarmNode(ctx context.Context, dest string, mode LinkFarmMode, node *filenode.FileNode, extracted map[*Layer]string) error {
+	target := filepath.Join(dest, filepath.FromSlash(string(node.RealPath)))
+
+	if node.Reference == nil || node.FileType == file.TypeDir {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("unable to create link farm dir=%q: %w", target, err)
+		}
+		return nil
+	}
+
+	entry, err := i.FileCatalog.Get(*node.Reference)
+	if err != nil {
+		return fmt.Errorf("unable to export path=%q: %w", node.RealPath, err)
+	}
+
+	switch entry.Metadata.TypeFlag {
+	case tar.TypeSymlink:
+		linkname := entry.Metadata.Linkname
+		if path.IsAbs(linkname) {
+			linkname, err = filepath.Rel(path.Dir(string(node.RealPath)), linkname)
+			if err != nil {
+				return fmt.Errorf("unable to export symlink=%q: %w", node.RealPath, err)
+			}
+		}
+		if err := os.Symlink(linkname, target); err != nil {
+			return fmt.Errorf("unable to create link farm symlink=%q: %w", target, err)
+		}
+		return nil
+	case tar.TypeLink:
+		resolved, err := i.FileCatalog.resolveHardlink(&entry)
+		if err != nil {
+			return fmt.Errorf("unable to export hardlink=%q: %w", node.RealPath, err)
+		}
+		entry = *resolved
+	case tar.TypeReg, tar.TypeRegA:
+	default:
+		return nil
+	}
+
+	if entry.Layer == nil {
+		return fmt.Errorf("unable to export path=%q: no layer provides the file", node.RealPath)
+	}
+	layerDir, ok := extracted[entry.Layer]
+	if !ok {
+		layerDir, err = entry.Layer.extract(ctx, filepath.Join(i.contentCacheDir, extractedLayersDir))
+		if err != nil {
+			return err
+		}
+		extracted[entry.Layer] = layerDir
+	}
+
+	source := filepath.Join(layerDir, filepath.FromSlash(entry.Metadata.Path))
+	switch mode {
+	case HardlinkFarm:
+		err = os.Link(source, target)
+	default:
+		err = os.Symlink(source, target)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to link path=%q to extracted file=%q: %w", node.RealPath, source, err)
+	}
+	return nil
+}
+
+// extract writes all regular files from the layer tar into a directory (named by the layer digest) within the given
+// dir, returning the layer directory. Layers that have already been extracted are not extracted again: the layer is
+// extracted into a temp dir that is only moved into place once complete.
+func (l *Layer) extract(ctx context.Context, dir string) (string, error) {
+	layerDir := filepath.Join(dir, strings.ReplaceAll(l.Metadata.Digest, ":", "-"))
+	if _, err := os.Stat(layerDir); err == nil {
+		return layerDir, nil
+	}
+
+	if l.opener == nil {
+		return "", fmt.Errorf("unable to extract layer=%q: layer has not been read", l.Metadata.Digest)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("unable to create layer extraction dir=%q: %w", dir, err)
+	}
+	tempDir, err := ioutil.TempDir(dir, "."+filepath.Base(layerDir)+".partial-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create layer extraction dir=%q: %w", dir, err)
+	}
+
+	if err := l.extractTo(ctx, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return "", fmt.Errorf("unable to extract layer=%q: %w", l.Metadata.Digest, err)
+	}
+
+	if err := os.Rename(tempDir, layerDir); err != nil {
+		os.RemoveAll(tempDir)
+		// another export may have extracted the same layer concurrently
+		if _, statErr := os.Stat(layerDir); statErr == nil {
+			return layerDir, nil
+		}
+		return "", fmt.Errorf("unable to move extracted layer to dir=%q: %w", layerDir, err)
+	}
+	return layerDir, nil
+}
+
+// extractTo writes all regular files from the layer tar into the given dir (read-only, later entries for the same path
+// overwrite earlier entries). Whiteouts are not extracted.
+func (l *Layer) extractTo(ctx context.Context, dir string) error {
+	reader, err := l.opener.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return file.VisitFileMetadataAndContentsFromTarWithPathPolicy(file.NewContextReader(ctx, reader), l.tarEntryPolicy, l.pathPolicy, func(metadata file.Metadata, contents io.Reader) error {
+		if metadata.TypeFlag != tar.TypeReg && metadata.TypeFlag != tar.TypeRegA {
+			return nil
+		}
+		if file.Path(metadata.Path).IsWhiteout() {
+			return nil
+		}
+
+		// note: the metadata path is always cleaned and absolute, so the target cannot be outside of the given dir
+		target := filepath.Join(dir, filepath.FromSlash(metadata.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		// a previous entry for the same path is read-only
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, (metadata.Mode.Perm()&^0222)|0400)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, contents); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil)
+}
@@ -0,0 +1,93 @@
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImage_ExportLinkFarm(t *testing.T) {
+	tests := []struct {
+		name string
+		mode LinkFarmMode
+	}{
+		{
+			name: "symlinks",
+			mode: SymlinkFarm,
+		},
+		{
+			name: "hardlinks",
+			mode: HardlinkFarm,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := linkedImage(t)
+			dest := filepath.Join(testTempDir(t), "farm")
+
+			if err := img.ExportLinkFarm(context.Background(), dest, test.mode); err != nil {
+				t.Fatalf("could not export link farm: %+v", err)
+			}
+
+			// contents are readable through the farm (including through links across layers)
+			expectedContents := map[string]string{
+				"opt/app/config.txt": "opt/app/config.txt",
+				"etc/config.txt":     "opt/app/config.txt",
+				"usr/config.txt":     "opt/app/config.txt",
+				"usr/hard.txt":       "opt/app/config.txt",
+				"usr/local.txt":      "usr/local.txt",
+				"usr/local-hard.txt": "usr/local.txt",
+			}
+			for p, expected := range expectedContents {
+				actual, err := ioutil.ReadFile(filepath.Join(dest, p))
+				if err != nil {
+					t.Fatalf("could not read path=%q: %+v", p, err)
+				}
+				if string(actual) != expected {
+					t.Errorf("unexpected contents for path=%q: %q", p, string(actual))
+				}
+			}
+
+			// regular files are links into the extracted layers (not copies)
+			info, err := os.Lstat(filepath.Join(dest, "opt/app/config.txt"))
+			if err != nil {
+				t.Fatalf("could not stat file: %+v", err)
+			}
+			switch test.mode {
+			case SymlinkFarm:
+				if info.Mode()&os.ModeSymlink == 0 {
+					t.Fatalf("expected a symlink: %+v", info.Mode())
+				}
+				source, err := os.Readlink(filepath.Join(dest, "opt/app/config.txt"))
+				if err != nil {
+					t.Fatalf("could not read link: %+v", err)
+				}
+				if !strings.HasPrefix(source, filepath.Join(img.contentCacheDir, extractedLayersDir)) {
+					t.Errorf("unexpected link source: %q", source)
+				}
+			case HardlinkFarm:
+				if !info.Mode().IsRegular() || info.Mode().Perm()&0222 != 0 {
+					t.Errorf("expected a read-only regular file: %+v", info.Mode())
+				}
+			}
+
+			// absolute symlinks from the image resolve within the farm
+			linkname, err := os.Readlink(filepath.Join(dest, "current"))
+			if err != nil {
+				t.Fatalf("could not read link: %+v", err)
+			}
+			if linkname != "opt/app" {
+				t.Errorf("unexpected link destination: %q", linkname)
+			}
+
+			// exporting again reuses the extracted layers
+			if err := img.ExportLinkFarm(context.Background(), filepath.Join(testTempDir(t), "again"), test.mode); err != nil {
+				t.Fatalf("could not export link farm again: %+v", err)
+			}
+		})
+	}
+}
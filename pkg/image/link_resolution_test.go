@@ -0,0 +1,211 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// linkedImage returns an image where links in the top layer resolve to files (and through links) in earlier layers.
+func linkedImage(t *testing.T) *Image {
+	t.Helper()
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "opt/"},
+		tar.Header{Typeflag: tar.TypeDir, Name: "opt/app/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "opt/app/config.txt", Mode: 0o755},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "current", Linkname: "/opt/app"},
+	)
+	middle := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "etc/config.txt", Linkname: "../current/config.txt"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "usr/"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "usr/config.txt", Linkname: "../etc/config.txt"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "usr/dead", Linkname: "/nowhere"},
+		tar.Header{Typeflag: tar.TypeLink, Name: "usr/hard.txt", Linkname: "opt/app/config.txt"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "usr/local.txt"},
+		tar.Header{Typeflag: tar.TypeLink, Name: "usr/local-hard.txt", Linkname: "usr/local.txt"},
+	)
+
+	img := newTestImage(t, []v1.Layer{base, middle, top})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func TestImage_FileContentsFromSquash_Links(t *testing.T) {
+	img := linkedImage(t)
+
+	tests := []struct {
+		name     string
+		path     file.Path
+		options  []filetree.LinkResolutionOption
+		expected string
+		err      error
+	}{
+		{
+			name:     "absolute link to directory in an earlier layer",
+			path:     "/current/config.txt",
+			expected: "opt/app/config.txt",
+		},
+		{
+			name:     "relative link through a link in an earlier layer",
+			path:     "/etc/config.txt",
+			expected: "opt/app/config.txt",
+		},
+		{
+			name:     "chain of links across all layers",
+			path:     "/usr/config.txt",
+			expected: "opt/app/config.txt",
+		},
+		{
+			name:     "hardlink to a file in an earlier layer",
+			path:     "/usr/hard.txt",
+			expected: "opt/app/config.txt",
+		},
+		{
+			name: "follow dead link",
+			path: "/usr/dead",
+			err:  ErrDeadLink,
+		},
+		{
+			name:     "do not follow dead link",
+			path:     "/usr/dead",
+			options:  []filetree.LinkResolutionOption{filetree.DoNotFollowDeadBasenameLinks},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := img.FileContentsFromSquash(test.path, test.options...)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error=%v, got: %+v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not fetch contents: %+v", err)
+			}
+			defer reader.Close()
+
+			contents, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("could not read contents: %+v", err)
+			}
+			if string(contents) != test.expected {
+				t.Errorf("unexpected contents: %q != %q", string(contents), test.expected)
+			}
+		})
+	}
+
+	if _, err := img.FileContentsFromSquash("/usr/missing"); err == nil || errors.Is(err, ErrDeadLink) {
+		t.Errorf("expected a not found error, got: %+v", err)
+	}
+}
+
+func TestFileCatalog_HardlinkContents(t *testing.T) {
+	img := linkedImage(t)
+	top := img.Layers[len(img.Layers)-1]
+
+	// relative to the layer diff tree the target of the hardlink is within a lower layer
+	reader, err := top.FileContents("/usr/hard.txt")
+	if err != nil {
+		t.Fatalf("could not fetch hardlink contents from the layer: %+v", err)
+	}
+	assertContents(t, reader, "opt/app/config.txt")
+
+	refs := make(map[file.Path]file.Reference)
+	for _, p := range []file.Path{"/usr/hard.txt", "/usr/local.txt", "/usr/local-hard.txt"} {
+		_, ref, err := top.Tree.File(p)
+		if err != nil || ref == nil {
+			t.Fatalf("could not find path=%q: %+v", p, err)
+		}
+		refs[p] = *ref
+	}
+
+	// the target within the same layer tar is tracked when cataloged
+	hardlink, target := refs["/usr/local-hard.txt"], refs["/usr/local.txt"]
+	if actual, ok := img.FileCatalog.hardlinkTargets[hardlink.ID()]; !ok || actual != target.ID() {
+		t.Errorf("expected hardlink target to be tracked: %+v", img.FileCatalog.hardlinkTargets)
+	}
+
+	expected := map[file.Path]string{
+		"/usr/hard.txt":       "opt/app/config.txt",
+		"/usr/local.txt":      "usr/local.txt",
+		"/usr/local-hard.txt": "usr/local.txt",
+	}
+
+	for p, ref := range refs {
+		reader, err := img.FileContentsByReference(ref)
+		if err != nil {
+			t.Fatalf("could not fetch contents for path=%q: %+v", p, err)
+		}
+		assertContents(t, reader, expected[p])
+	}
+
+	readers, err := img.MultipleFileContentsByRef(refs["/usr/hard.txt"], refs["/usr/local.txt"], refs["/usr/local-hard.txt"])
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	for ref, reader := range readers {
+		assertContents(t, reader, expected[ref.RealPath])
+	}
+}
+
+func assertContents(t *testing.T, reader io.ReadCloser, expected string) {
+	t.Helper()
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(contents) != expected {
+		t.Errorf("unexpected contents: %q != %q", string(contents), expected)
+	}
+}
+
+func TestImage_FileMetadataFromSquash(t *testing.T) {
+	img := linkedImage(t)
+
+	metadata, err := img.FileMetadataFromSquash("/usr/config.txt")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.TypeFlag != tar.TypeSymlink || metadata.Linkname != "../etc/config.txt" {
+		t.Errorf("unexpected link metadata: %+v", metadata)
+	}
+
+	metadata, err = img.FileMetadataFromSquash("/usr/config.txt", filetree.FollowBasenameLinks)
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.Path != "/opt/app/config.txt" || metadata.TypeFlag != tar.TypeReg {
+		t.Errorf("unexpected target metadata: %+v", metadata)
+	}
+	if metadata.Mode.Perm() != 0o755 || metadata.UserID != 0 || metadata.GroupID != 0 {
+		t.Errorf("unexpected ownership or permissions: %+v", metadata)
+	}
+
+	// ancestor links are always resolved
+	metadata, err = img.FileMetadataFromSquash("/current/config.txt")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.Path != "/opt/app/config.txt" {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+
+	if _, err := img.FileMetadataFromSquash("/usr/missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected a not found error, got: %+v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package image
+
+import (
+	"fmt"
+)
+
+// ErrListingNotSupported is returned when listing the images of a source that cannot enumerate its images.
+var ErrListingNotSupported = fmt.Errorf("listing images is not supported for this source")
+
+// ListedImage describes a single image available from an image source, without providing (or reading) the image.
+type ListedImage struct {
+	// ID is the digest of the image config (empty if not known without reading the image).
+	ID string
+	// ManifestDigest is the digest of the image manifest, or of the image index for multi-platform images (empty if not
+	// known).
+	ManifestDigest string
+	// Tags are all tags that refer to the image (empty for untagged images).
+	Tags []string
+	// Platform is the platform of the image (nil if not known).
+	Platform *Platform
+}
@@ -0,0 +1,368 @@
+package image
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// NestedArchiveSeparator separates the path of an archive from the paths of the entries within the archive, for
+// example, /app/app.jar!/META-INF/MANIFEST.MF (see WithNestedArchives).
+const NestedArchiveSeparator = "!"
+
+// maxNestedArchiveDepth is the maximum number of archives within archives that are descended into.
+const maxNestedArchiveDepth = 8
+
+const (
+	tarNestedArchive nestedArchiveFormat = iota + 1
+	gzipTarNestedArchive
+	zipNestedArchive
+)
+
+// nestedArchiveFormat is the format of an archive found within a layer, as determined by the archive file name.
+type nestedArchiveFormat int
+
+// nestedArchiveSuffixes maps the file name suffixes of all archives that are descended into to the archive format.
+var nestedArchiveSuffixes = []struct {
+	suffix string
+	format nestedArchiveFormat
+}{
+	{".tar", tarNestedArchive},
+	{".tar.gz", gzipTarNestedArchive},
+	{".tgz", gzipTarNestedArchive},
+	{".zip", zipNestedArchive},
+	{".jar", zipNestedArchive},
+	{".war", zipNestedArchive},
+	{".ear", zipNestedArchive},
+}
+
+// nestedArchiveFormatOf returns the format of the archive at the given path (false if the path is not an archive).
+func nestedArchiveFormatOf(p file.Path) (nestedArchiveFormat, bool) {
+	basename := strings.ToLower(p.Basename())
+	for _, candidate := range nestedArchiveSuffixes {
+		if strings.HasSuffix(basename, candidate.suffix) && len(basename) > len(candidate.suffix) {
+			return candidate.format, true
+		}
+	}
+	return 0, false
+}
+
+// nestedArchiveMember locates a single entry within an archive that is cataloged within the file catalog.
+type nestedArchiveMember struct {
+	// archive is the ID of the file catalog entry of the archive (which may be a nested archive member itself).
+	archive file.ID
+	format  nestedArchiveFormat
+	// name is the exact entry name within the archive.
+	name string
+}
+
+// indexNestedArchives adds the entries of all archives found within the layer trees to a virtual sub-tree of each
+// archive (see WithNestedArchives), within the layer tree of the archive and within every squash tree that includes
+// the archive. Archives that cannot be read are skipped (and logged).
+func (i *Image) indexNestedArchives(ctx context.Context) error {
+	for idx, layer := range i.Layers {
+		var archives []file.Reference
+		err := layer.Tree.WalkNodes(func(p file.Path, n filenode.FileNode) error {
+			if n.FileType != file.TypeReg || n.Reference == nil || p.IsWhiteout() {
+				return nil
+			}
+			if _, ok := nestedArchiveFormatOf(p); ok {
+				archives = append(archives, *n.Reference)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, archive := range archives {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			members := filetree.NewFileTree()
+			if err := i.FileCatalog.indexNestedArchive(ctx, layer, members, archive, 1); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				// note: any entries read before the failure are still part of the virtual sub-tree
+				log.Warnf("unable to index nested archive=%q: %+v", archive.RealPath, err)
+			}
+
+			if err := layer.Tree.Merge(members); err != nil {
+				return fmt.Errorf("unable to add nested archive=%q to the layer tree: %w", archive.RealPath, err)
+			}
+			for _, squashed := range i.Layers[idx:] {
+				if squashed.SquashedTree == nil {
+					continue
+				}
+				// only squash trees that include this archive (not a replacement or a deletion of it)
+				_, ref, err := squashed.SquashedTree.File(archive.RealPath)
+				if err != nil || ref == nil || ref.ID() != archive.ID() {
+					continue
+				}
+				if err := squashed.SquashedTree.Merge(members); err != nil {
+					return fmt.Errorf("unable to add nested archive=%q to the squash tree: %w", archive.RealPath, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// indexNestedArchive adds all entries of the given archive to the given tree and the file catalog (cataloged from the
+// given layer), descending into archives within the archive up to maxNestedArchiveDepth.
+func (c *FileCatalog) indexNestedArchive(ctx context.Context, layer *Layer, members *filetree.FileTree, archive file.Reference, depth int) error {
+	format, _ := nestedArchiveFormatOf(archive.RealPath)
+	root := file.Path(string(archive.RealPath) + NestedArchiveSeparator)
+
+	var nested []file.Reference
+	add := func(name string, metadata file.Metadata) error {
+		ref, err := c.addNestedArchiveMember(layer, members, root, nestedArchiveMember{
+			archive: archive.ID(),
+			format:  format,
+			name:    name,
+		}, metadata)
+		if err != nil || ref == nil {
+			return err
+		}
+		if _, ok := nestedArchiveFormatOf(ref.RealPath); ok && metadata.TypeFlag == tar.TypeReg {
+			nested = append(nested, *ref)
+		}
+		return nil
+	}
+
+	var err error
+	switch format {
+	case zipNestedArchive:
+		err = c.visitNestedZip(ctx, archive.ID(), add)
+	default:
+		err = c.visitNestedTar(ctx, archive.ID(), format, add)
+	}
+	if err != nil {
+		return err
+	}
+
+	if depth >= maxNestedArchiveDepth {
+		if len(nested) > 0 {
+			log.Debugf("not indexing archives within nested archive=%q (max depth reached)", archive.RealPath)
+		}
+		return nil
+	}
+	for _, ref := range nested {
+		if err := c.indexNestedArchive(ctx, layer, members, ref, depth+1); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			log.Warnf("unable to index nested archive=%q: %+v", ref.RealPath, err)
+		}
+	}
+	return nil
+}
+
+// visitNestedTar calls the given function for every supported entry within the tar archive with the given ID.
+func (c *FileCatalog) visitNestedTar(ctx context.Context, id file.ID, format nestedArchiveFormat, fn func(name string, metadata file.Metadata) error) error {
+	reader, err := c.openNestedTar(ctx, id, format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var sequence int64 = -1
+	return file.TarIterator(reader, func(header *tar.Header, _ io.Reader) error {
+		sequence++
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+			metadata := file.MetadataFromTarHeader(header, sequence)
+			if metadata.TypeFlag == tar.TypeRegA {
+				metadata.TypeFlag = tar.TypeReg
+			}
+			return fn(header.Name, metadata)
+		default:
+			return nil
+		}
+	})
+}
+
+// visitNestedZip calls the given function for every file and directory within the zip archive with the given ID.
+func (c *FileCatalog) visitNestedZip(ctx context.Context, id file.ID, fn func(name string, metadata file.Metadata) error) error {
+	contents, err := c.OpenSeekableByIDWithContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	zipReader, err := zip.NewReader(contents, contents.Size())
+	if err != nil {
+		return err
+	}
+
+	for sequence, f := range zipReader.File {
+		info := f.FileInfo()
+		metadata := file.Metadata{
+			TarHeaderName: f.Name,
+			TarSequence:   int64(sequence),
+			Mode:          info.Mode(),
+			ModTime:       f.Modified.UTC(),
+		}
+		switch {
+		case info.IsDir():
+			metadata.TypeFlag = tar.TypeDir
+			metadata.IsDir = true
+		case info.Mode().IsRegular():
+			metadata.TypeFlag = tar.TypeReg
+			metadata.Size = int64(f.UncompressedSize64)
+		default:
+			// zip symlinks (and other special files) are rare and not supported
+			continue
+		}
+		if err := fn(f.Name, metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNestedArchiveMember adds a single archive entry beneath the given root to the given tree and the file catalog,
+// returning the reference of the entry (nil for entries that are not added, such as the archive root).
+func (c *FileCatalog) addNestedArchiveMember(layer *Layer, members *filetree.FileTree, root file.Path, member nestedArchiveMember, metadata file.Metadata) (*file.Reference, error) {
+	name := path.Clean(file.DirSeparator + member.name)
+	if name == file.DirSeparator {
+		return nil, nil
+	}
+	p := file.Path(string(root) + name)
+	metadata.Path = string(p)
+
+	var ref *file.Reference
+	var err error
+	switch metadata.TypeFlag {
+	case tar.TypeSymlink:
+		ref, err = members.AddSymLink(p, file.Path(metadata.Linkname))
+	case tar.TypeLink:
+		// hardlink names are relative to the root of the archive
+		metadata.Linkname = string(root) + path.Clean(file.DirSeparator+metadata.Linkname)
+		ref, err = members.AddHardLink(p, file.Path(metadata.Linkname))
+	case tar.TypeDir:
+		ref, err = members.AddDir(p)
+	default:
+		ref, err = members.AddFile(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("could not add nested archive path=%q", p)
+	}
+
+	c.Add(*ref, metadata, layer)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.nestedArchiveMembers == nil {
+		c.nestedArchiveMembers = make(map[file.ID]nestedArchiveMember)
+	}
+	c.nestedArchiveMembers[ref.ID()] = member
+
+	if metadata.TypeFlag == tar.TypeLink {
+		// the target is not part of the layer tree yet (see trackHardlink)
+		_, target, err := members.File(file.Path(metadata.Linkname))
+		if err == nil && target != nil && target.ID() != ref.ID() {
+			if c.hardlinkTargets == nil {
+				c.hardlinkTargets = make(map[file.ID]file.ID)
+			}
+			c.hardlinkTargets[ref.ID()] = target.ID()
+		}
+	}
+	return ref, nil
+}
+
+// nestedArchiveMember returns the location of the given entry within an archive (false if the entry is not a nested
+// archive member).
+func (c *FileCatalog) nestedArchiveMember(id file.ID) (nestedArchiveMember, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	member, ok := c.nestedArchiveMembers[id]
+	return member, ok
+}
+
+// openNestedArchiveMember provides the contents of the given entry from the (already cataloged) archive.
+func (c *FileCatalog) openNestedArchiveMember(ctx context.Context, member nestedArchiveMember) (io.ReadCloser, error) {
+	if member.format != zipNestedArchive {
+		reader, err := c.openNestedTar(ctx, member.archive, member.format)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := file.ReaderFromTar(reader, member.name)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return contents, nil
+	}
+
+	archive, err := c.OpenSeekableByIDWithContext(ctx, member.archive)
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.NewReader(archive, archive.Size())
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+	for _, f := range zipReader.File {
+		if f.Name != member.name {
+			continue
+		}
+		contents, err := f.Open()
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		return &nestedZipMemberReader{
+			ReadCloser: contents,
+			archive:    archive,
+		}, nil
+	}
+	archive.Close()
+	return nil, fmt.Errorf("%w: nested archive entry=%q", ErrFileNotFound, member.name)
+}
+
+// openNestedTar provides the (decompressed) tar stream of the archive with the given ID.
+func (c *FileCatalog) openNestedTar(ctx context.Context, id file.ID, format nestedArchiveFormat) (io.ReadCloser, error) {
+	reader, err := c.OpenByIDWithContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if format != gzipTarNestedArchive {
+		return reader, nil
+	}
+	decompressed, _, err := file.NewDecompressedReadCloser(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return decompressed, nil
+}
+
+// nestedZipMemberReader provides the contents of a zip entry, closing the zip archive once closed.
+type nestedZipMemberReader struct {
+	io.ReadCloser
+	archive io.Closer
+}
+
+func (r *nestedZipMemberReader) Close() error {
+	err := r.ReadCloser.Close()
+	if archiveErr := r.archive.Close(); err == nil {
+		err = archiveErr
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package image
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// zipContents returns a zip with a file for each of the given paths and contents.
+func zipContents(t *testing.T, contents map[string]string) string {
+	t.Helper()
+	var names []string
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("could not create zip entry: %+v", err)
+		}
+		if _, err := w.Write([]byte(contents[name])); err != nil {
+			t.Fatalf("could not write zip entry: %+v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("could not close zip: %+v", err)
+	}
+	return buf.String()
+}
+
+func nestedArchivesTestImage(t *testing.T, options ...ReadOption) *Image {
+	t.Helper()
+
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	if _, err := gw.Write(newTestTar(t, map[string]string{"bin/tool": "tool"})); err != nil {
+		t.Fatalf("could not compress tar: %+v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("could not compress tar: %+v", err)
+	}
+
+	jar := zipContents(t, map[string]string{
+		"META-INF/":            "",
+		"META-INF/MANIFEST.MF": "Main-Class: app.Main",
+		"lib/data.tar":         string(newTestTar(t, map[string]string{"etc/data.txt": "data"})),
+	})
+
+	img := newTestImage(t, []v1.Layer{
+		newTestLayer(t, map[string]string{
+			"app/app.jar":        jar,
+			"opt/bundle.tar.gz":  gzipped.String(),
+			"opt/not-an-archive": "plain",
+		}),
+		newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "opt/.wh.bundle.tar.gz"}),
+	})
+	if err := img.Read(options...); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func TestImage_Read_WithNestedArchives(t *testing.T) {
+	img := nestedArchivesTestImage(t, WithNestedArchives())
+
+	expected := map[file.Path]string{
+		"/app/app.jar!/META-INF/MANIFEST.MF":       "Main-Class: app.Main",
+		"/app/app.jar!/lib/data.tar!/etc/data.txt": "data",
+		"/opt/not-an-archive":                      "plain",
+	}
+	for p, contents := range expected {
+		reader, err := img.FileContentsFromSquash(p)
+		if err != nil {
+			t.Fatalf("could not fetch contents for path=%q: %+v", p, err)
+		}
+		actual, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read contents for path=%q: %+v", p, err)
+		}
+		if string(actual) != contents {
+			t.Errorf("unexpected contents for path=%q: %q", p, string(actual))
+		}
+	}
+
+	// the contents of multiple nested entries may be fetched at once
+	readers, err := img.MultipleFileContentsFromSquash("/app/app.jar!/META-INF/MANIFEST.MF", "/app/app.jar!/lib/data.tar!/etc/data.txt")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	for ref, reader := range readers {
+		actual, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read contents for path=%q: %+v", ref.RealPath, err)
+		}
+		if string(actual) != expected[ref.RealPath] {
+			t.Errorf("unexpected contents for path=%q: %q", ref.RealPath, string(actual))
+		}
+	}
+
+	// the deleted archive is only part of the lower squash tree (and layer tree)
+	bundled := file.Path("/opt/bundle.tar.gz!/bin/tool")
+	if squashedTreeOf(t, img).HasPath(bundled) {
+		t.Errorf("unexpected path within deleted archive: %q", bundled)
+	}
+	if !img.Layers[0].SquashedTree.HasPath(bundled) {
+		t.Errorf("missing path within archive from lower squash tree: %q", bundled)
+	}
+	if !img.Layers[0].Tree.HasPath(bundled) {
+		t.Errorf("missing path within archive from layer tree: %q", bundled)
+	}
+	reader, err := img.Layers[0].FileContentsFromSquash(bundled)
+	if err != nil {
+		t.Fatalf("could not fetch contents for path=%q: %+v", bundled, err)
+	}
+	actual, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(actual) != "tool" {
+		t.Errorf("unexpected contents for path=%q: %q (%v)", bundled, string(actual), err)
+	}
+
+	if squashedTreeOf(t, img).HasPath("/opt/not-an-archive!") {
+		t.Errorf("unexpected virtual sub-tree for a file that is not an archive")
+	}
+}
+
+func TestImage_Read_WithoutNestedArchives(t *testing.T) {
+	img := nestedArchivesTestImage(t)
+
+	if squashedTreeOf(t, img).HasPath("/app/app.jar!") {
+		t.Errorf("unexpected virtual sub-tree without nested archive indexing")
+	}
+}
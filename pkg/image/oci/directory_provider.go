@@ -1,42 +1,63 @@
 package oci
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // DirectoryImageProvider is an image.Provider for an OCI image (V1) for an existing tar on disk (from a buildah push <img> oci:<img> command).
 type DirectoryImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	options   image.ProviderOptions
+	// origin overrides where the image is reported to be from (when another provider delegates to this one)
+	origin *image.Origin
+	// bytesRead are the bytes already read to obtain the layout (when another provider delegates to this one)
+	bytesRead *image.ByteCounter
 }
 
 // NewProviderFromPath creates a new provider instance for the specific image already at the given path.
-func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator) *DirectoryImageProvider {
+func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *DirectoryImageProvider {
 	return &DirectoryImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		options:   options,
 	}
 }
 
 // Provide an image object that represents the OCI image as a directory.
-func (p *DirectoryImageProvider) Provide() (*image.Image, error) {
+func (p *DirectoryImageProvider) Provide(_ context.Context) (*image.Image, error) {
+	origin := p.newOrigin()
+
 	pathObj, err := layout.FromPath(p.path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory path=%q : %w", p.path, err)
+		if _, statErr := os.Stat(p.path); os.IsNotExist(statErr) {
+			return nil, fmt.Errorf("%w: no OCI directory at path=%q", image.ErrImageNotFound, p.path)
+		}
+		if os.IsNotExist(err) {
+			return nil, image.NewProviderError(image.ErrManifestInvalid, fmt.Sprintf("no index.json within OCI directory path=%q", p.path), err)
+		}
+		return nil, fmt.Errorf("unable to read OCI directory path=%q: %w", p.path, err)
 	}
 
 	index, err := layout.ImageIndexFromPath(p.path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory index: %w", err)
+		return nil, manifestError(err, "unable to parse OCI directory index")
 	}
 
 	indexManifest, err := index.IndexManifest()
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
+		return nil, manifestError(err, "unable to parse OCI directory indexManifest")
 	}
 
 	// for now, lets only support one image indexManifest (it is not clear how to handle multiple manifests)
@@ -44,14 +65,15 @@ func (p *DirectoryImageProvider) Provide() (*image.Image, error) {
 		return nil, fmt.Errorf("unexpected number of OCI directory manifests (found %d)", len(indexManifest.Manifests))
 	}
 
-	manifest := indexManifest.Manifests[0]
-	img, err := pathObj.Image(manifest.Digest)
+	img, manifest, err := resolveImage(pathObj, p.options.SelectedPlatform(), index, indexManifest.Manifests[0])
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory as an image: %w", err)
+		return nil, err
 	}
 
 	var metadata = []image.AdditionalMetadata{
 		image.WithManifestDigest(manifest.Digest.String()),
+		// the layer blobs are already on disk, there is no need to copy them into the content temp dir
+		image.WithLayoutBlobs(p.path),
 	}
 
 	// make a best-effort attempt at getting the raw indexManifest
@@ -65,5 +87,99 @@ func (p *DirectoryImageProvider) Provide() (*image.Image, error) {
 		return nil, err
 	}
 
+	origin.AcquisitionCompleted = time.Now()
+	metadata = append(metadata, image.WithOrigin(origin))
+	if p.bytesRead != nil {
+		metadata = append(metadata, image.WithByteCounter(p.bytesRead))
+	}
+
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
+
+// SetOrigin overrides where the image is reported to be from, which is useful for providers that obtain an OCI
+// directory from another source and delegate to this provider.
+func (p *DirectoryImageProvider) SetOrigin(origin image.Origin) {
+	p.origin = &origin
+}
+
+// SetByteCounter records the bytes read to obtain the OCI directory (by a provider that delegates to this provider) as
+// part of the bytes read for the image.
+func (p *DirectoryImageProvider) SetByteCounter(counter *image.ByteCounter) {
+	p.bytesRead = counter
+}
+
+// resolveImage returns the image (and the descriptor of the image manifest) for a descriptor within the given index. A
+// nested index (e.g. a multi-platform image) is resolved to the image for the given platform, considering only
+// manifests that are present within the layout (an export may only include a single platform).
+func resolveImage(pathObj layout.Path, platform image.Platform, parent v1.ImageIndex, descriptor v1.Descriptor) (v1.Image, v1.Descriptor, error) {
+	if isUnsupportedManifest(descriptor.MediaType) {
+		return nil, v1.Descriptor{}, fmt.Errorf("%w: OCI directory manifest=%q has media type=%q", image.ErrUnsupportedMediaType, descriptor.Digest, descriptor.MediaType)
+	}
+	if !isIndex(descriptor.MediaType) {
+		img, err := parent.Image(descriptor.Digest)
+		if err != nil {
+			return nil, v1.Descriptor{}, fmt.Errorf("unable to parse OCI directory as an image: %w", err)
+		}
+		return img, descriptor, nil
+	}
+
+	index, err := parent.ImageIndex(descriptor.Digest)
+	if err != nil {
+		return nil, v1.Descriptor{}, manifestError(err, "unable to parse OCI directory nested index")
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, v1.Descriptor{}, manifestError(err, "unable to parse OCI directory nested indexManifest")
+	}
+
+	var candidates []v1.Descriptor
+	for _, manifest := range indexManifest.Manifests {
+		if _, err := os.Stat(filepath.Join(string(pathObj), "blobs", manifest.Digest.Algorithm, manifest.Digest.Hex)); err != nil {
+			continue
+		}
+		if platform.Matches(manifest.Platform) {
+			return resolveImage(pathObj, platform, index, manifest)
+		}
+		candidates = append(candidates, manifest)
+	}
+
+	if len(candidates) != 1 {
+		return nil, v1.Descriptor{}, fmt.Errorf("unable to select a single image for platform=%q from OCI directory nested index (found %d candidates)", platform, len(candidates))
+	}
+	return resolveImage(pathObj, platform, index, candidates[0])
+}
+
+// newOrigin describes where the image is being obtained from, starting from now.
+func (p *DirectoryImageProvider) newOrigin() image.Origin {
+	if p.origin != nil {
+		return *p.origin
+	}
+
+	location, err := filepath.Abs(p.path)
+	if err != nil {
+		location = p.path
+	}
+
+	return image.Origin{
+		Source:             image.OciDirectorySource,
+		Location:           location,
+		AcquisitionStarted: time.Now(),
+	}
+}
+
+// isUnsupportedManifest indicates if the given media type is for a manifest that cannot be read as an image (e.g. a
+// docker schema 1 manifest). Note: an unknown media type is read as an image manifest (since not all tools set it).
+func isUnsupportedManifest(mediaType types.MediaType) bool {
+	return mediaType == types.DockerManifestSchema1 || mediaType == types.DockerManifestSchema1Signed
+}
+
+// manifestError describes the given failure to obtain an index or manifest. Failures to read the layout files are
+// reported as they are, all other failures (e.g. unparsable JSON) are classified as image.ErrManifestInvalid.
+func manifestError(err error, description string) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Errorf("%s: %w", description, err)
+	}
+	return image.NewProviderError(image.ErrManifestInvalid, description, err)
+}
@@ -0,0 +1,232 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestDirectoryImageProvider_NestedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-oci-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	other, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	expected, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	platformIndex := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{
+			Add: other,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "linux", Architecture: "not-" + runtime.GOARCH},
+			},
+		},
+		mutate.IndexAddendum{
+			Add: expected,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "linux", Architecture: runtime.GOARCH},
+			},
+		},
+	)
+
+	if _, err := layout.Write(dir, mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: platformIndex})); err != nil {
+		t.Fatalf("could not write layout: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	img, err := NewProviderFromPath(dir, &tmpDirGen, image.ProviderOptions{}).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	expectedDigest, err := expected.Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+	if img.Metadata.ManifestDigest != expectedDigest.String() {
+		t.Errorf("unexpected image selected: %q != %q", img.Metadata.ManifestDigest, expectedDigest.String())
+	}
+	if len(img.Layers) != 2 {
+		t.Errorf("unexpected number of layers: %d", len(img.Layers))
+	}
+}
+
+func TestDirectoryImageProvider_Platform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-oci-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	host, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	arm, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	armV7, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	platformIndex := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{
+			Add:        host,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: runtime.GOARCH}},
+		},
+		mutate.IndexAddendum{
+			Add:        arm,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+		},
+		mutate.IndexAddendum{
+			Add:        armV7,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		},
+	)
+
+	if _, err := layout.Write(dir, mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: platformIndex})); err != nil {
+		t.Fatalf("could not write layout: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	tests := []struct {
+		platform string
+		expected v1.Image
+		wantErr  bool
+	}{
+		{platform: "linux/arm/v7", expected: armV7},
+		{platform: "linux/arm/v6", expected: arm},
+		{platform: "linux/" + runtime.GOARCH, expected: host},
+		{platform: "windows/amd64", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.platform, func(t *testing.T) {
+			platform, err := image.NewPlatform(test.platform)
+			if err != nil {
+				t.Fatalf("could not parse platform: %+v", err)
+			}
+
+			img, err := NewProviderFromPath(dir, &tmpDirGen, image.ProviderOptions{Platform: &platform}).Provide(context.Background())
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not provide image: %+v", err)
+			}
+			if err := img.Read(); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			expectedDigest, err := test.expected.Digest()
+			if err != nil {
+				t.Fatalf("could not get digest: %+v", err)
+			}
+			if img.Metadata.ManifestDigest != expectedDigest.String() {
+				t.Errorf("unexpected image selected: %q != %q", img.Metadata.ManifestDigest, expectedDigest.String())
+			}
+		})
+	}
+}
+
+func TestDirectoryImageProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name            string
+		setup           func(t *testing.T, dir string)
+		manifestInvalid bool
+		notFound        bool
+	}{
+		{
+			name:     "missing directory",
+			setup:    func(t *testing.T, dir string) { os.RemoveAll(dir) },
+			notFound: true,
+		},
+		{
+			name:            "missing index",
+			setup:           func(t *testing.T, dir string) {},
+			manifestInvalid: true,
+		},
+		{
+			name: "unparsable index",
+			setup: func(t *testing.T, dir string) {
+				if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), []byte("{"), 0600); err != nil {
+					t.Fatalf("could not write index: %+v", err)
+				}
+			},
+			manifestInvalid: true,
+		},
+		{
+			name: "unreadable index",
+			setup: func(t *testing.T, dir string) {
+				if err := os.Mkdir(filepath.Join(dir, "index.json"), 0700); err != nil {
+					t.Fatalf("could not create dir: %+v", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "stereoscope-oci-test-")
+			if err != nil {
+				t.Fatalf("could not create temp dir: %+v", err)
+			}
+			defer os.RemoveAll(dir)
+			test.setup(t, dir)
+
+			tmpDirGen := file.NewTempDirGenerator()
+			defer tmpDirGen.Cleanup()
+
+			_, err = NewProviderFromPath(dir, &tmpDirGen, image.ProviderOptions{}).Provide(context.Background())
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			if errors.Is(err, image.ErrManifestInvalid) != test.manifestInvalid {
+				t.Errorf("unexpected manifest classification: %+v", err)
+			}
+			if errors.Is(err, image.ErrImageNotFound) != test.notFound {
+				t.Errorf("unexpected not found classification: %+v", err)
+			}
+			if !test.notFound {
+				var pathErr *os.PathError
+				var syntaxErr *json.SyntaxError
+				if !errors.As(err, &pathErr) && !errors.As(err, &syntaxErr) {
+					t.Errorf("expected the underlying error to remain available: %+v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package oci
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// refNameAnnotation is the annotation holding the tag (or name) of a manifest within an OCI image layout index.
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// ListDirectoryImages lists all images within the index of the OCI image layout at the given path.
+func ListDirectoryImages(path string) ([]image.ListedImage, error) {
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI directory index: %w", err)
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
+	}
+
+	images := listIndexManifest(indexManifest)
+
+	// the config of each (single platform) image is on disk, so the image ID is cheap to determine
+	for idx, descriptor := range indexManifest.Manifests {
+		if isIndex(descriptor.MediaType) {
+			continue
+		}
+		img, err := index.Image(descriptor.Digest)
+		if err != nil {
+			continue
+		}
+		if id, err := img.ConfigName(); err == nil {
+			images[idx].ID = id.String()
+		}
+	}
+
+	return images, nil
+}
+
+// ListTarballImages lists all images within the index of the OCI archive at the given path (without unpacking the
+// archive).
+func ListTarballImages(path string) ([]image.ListedImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open OCI tarball: %w", err)
+	}
+
+	reader, err := file.ReaderFromTar(f, "index.json")
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to find OCI tarball index: %w", err)
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read OCI tarball index: %w", err)
+	}
+
+	indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI tarball index: %w", err)
+	}
+
+	return listIndexManifest(indexManifest), nil
+}
+
+// listIndexManifest describes each manifest within the given OCI image layout index.
+func listIndexManifest(indexManifest *v1.IndexManifest) []image.ListedImage {
+	images := make([]image.ListedImage, len(indexManifest.Manifests))
+	for idx, descriptor := range indexManifest.Manifests {
+		images[idx] = image.ListedImage{
+			ManifestDigest: descriptor.Digest.String(),
+			Platform:       image.PlatformFromV1(descriptor.Platform),
+		}
+		if tag := descriptor.Annotations[refNameAnnotation]; tag != "" {
+			images[idx].Tags = []string{tag}
+		}
+	}
+	return images
+}
+
+// isIndex indicates if the given media type is for a multi-platform image (an image index or manifest list).
+func isIndex(mediaType types.MediaType) bool {
+	return mediaType == types.OCIImageIndex || mediaType == types.DockerManifestList
+}
@@ -0,0 +1,76 @@
+package oci
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestListDirectoryImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stereoscope-oci-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tagged, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	untagged, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{
+			Add: tagged,
+			Descriptor: v1.Descriptor{
+				Annotations: map[string]string{refNameAnnotation: "latest"},
+				Platform:    &v1.Platform{OS: "linux", Architecture: "arm64"},
+			},
+		},
+		mutate.IndexAddendum{Add: untagged},
+	)
+	if _, err := layout.Write(dir, index); err != nil {
+		t.Fatalf("could not write layout: %+v", err)
+	}
+
+	var expected []image.ListedImage
+	for idx, img := range []v1.Image{tagged, untagged} {
+		id, err := img.ConfigName()
+		if err != nil {
+			t.Fatalf("could not get config name: %+v", err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("could not get digest: %+v", err)
+		}
+		listed := image.ListedImage{
+			ID:             id.String(),
+			ManifestDigest: digest.String(),
+		}
+		if idx == 0 {
+			listed.Tags = []string{"latest"}
+			listed.Platform = &image.Platform{OS: "linux", Architecture: "arm64"}
+		}
+		expected = append(expected, listed)
+	}
+
+	actual, err := ListDirectoryImages(dir)
+	if err != nil {
+		t.Fatalf("could not list images: %+v", err)
+	}
+
+	for _, d := range deep.Equal(actual, expected) {
+		t.Errorf("unexpected listing: %s", d)
+	}
+}
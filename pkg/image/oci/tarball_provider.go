@@ -1,8 +1,11 @@
 package oci
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
@@ -12,21 +15,28 @@ import (
 type TarballImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	options   image.ProviderOptions
 }
 
 // NewProviderFromTarball creates a new provider instance for the specific image tarball already at the given path.
-func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator) *TarballImageProvider {
+func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions) *TarballImageProvider {
 	return &TarballImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		options:   options,
 	}
 }
 
 // Provide an image object that represents the OCI image from a tarball.
-func (p *TarballImageProvider) Provide() (*image.Image, error) {
+func (p *TarballImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	acquisitionStarted := time.Now()
+
 	// note: we are untaring the image and using the existing directory provider, we could probably enhance the google
 	// container registry lib to do this without needing to untar to a temp dir (https://github.com/google/go-containerregistry/issues/726)
 	f, err := os.Open(p.path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: no OCI tarball at path=%q", image.ErrImageNotFound, p.path)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to open OCI tarball: %w", err)
 	}
@@ -36,9 +46,22 @@ func (p *TarballImageProvider) Provide() (*image.Image, error) {
 		return nil, err
 	}
 
-	if err = file.UntarToDirectory(f, tempDir); err != nil {
+	bytesRead := image.NewByteCounter()
+	if err = file.UntarToDirectory(bytesRead.DiskReader(file.NewContextReader(ctx, f)), tempDir); err != nil {
 		return nil, err
 	}
 
-	return NewProviderFromPath(tempDir, p.tmpDirGen).Provide()
+	location, err := filepath.Abs(p.path)
+	if err != nil {
+		location = p.path
+	}
+
+	directoryProvider := NewProviderFromPath(tempDir, p.tmpDirGen, p.options)
+	directoryProvider.bytesRead = bytesRead
+	directoryProvider.origin = &image.Origin{
+		Source:             image.OciTarballSource,
+		Location:           location,
+		AcquisitionStarted: acquisitionStarted,
+	}
+	return directoryProvider.Provide(ctx)
 }
@@ -0,0 +1,55 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// ociRefNameAnnotation is the OCI index annotation that names the image reference of a manifest.
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// WriteOCILayout writes the image (manifest, config, and layer blobs) as an OCI image layout within the given directory,
+// regardless of the source the image was obtained from (e.g. a daemon or a tarball). The layout contains this image
+// only (annotated with the first tag and the config platform, if any), so it may be provided again as an OCI directory.
+// The directory must not already contain an OCI image layout.
+func (i *Image) WriteOCILayout(dir string) error {
+	if i.image == nil {
+		return fmt.Errorf("unable to write OCI layout: no image")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return fmt.Errorf("unable to write OCI layout: dir=%q already contains an OCI layout", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create OCI layout dir=%q: %w", dir, err)
+	}
+
+	layoutPath, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return fmt.Errorf("unable to write OCI layout: %w", err)
+	}
+
+	var options []layout.Option
+	if len(i.Metadata.Tags) > 0 {
+		options = append(options, layout.WithAnnotations(map[string]string{
+			ociRefNameAnnotation: i.Metadata.Tags[0].String(),
+		}))
+	}
+	if config := i.Metadata.Config; config.OS != "" && config.Architecture != "" {
+		options = append(options, layout.WithPlatform(v1.Platform{
+			OS:           config.OS,
+			Architecture: config.Architecture,
+			OSVersion:    config.OSVersion,
+		}))
+	}
+
+	if err := layoutPath.AppendImage(i.image, options...); err != nil {
+		return fmt.Errorf("unable to write image to OCI layout: %w", err)
+	}
+	return nil
+}
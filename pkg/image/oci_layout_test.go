@@ -0,0 +1,78 @@
+package image
+
+import (
+	"archive/tar"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+func TestImage_WriteOCILayout(t *testing.T) {
+	img := linkedImage(t)
+	tag, err := name.NewTag("example.com/some/image:latest")
+	if err != nil {
+		t.Fatalf("could not parse tag: %+v", err)
+	}
+	img.Metadata.Tags = []name.Tag{tag}
+	dir := filepath.Join(testTempDir(t), "layout")
+
+	if err := img.WriteOCILayout(dir); err != nil {
+		t.Fatalf("could not write OCI layout: %+v", err)
+	}
+
+	index, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		t.Fatalf("could not read OCI layout: %+v", err)
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatalf("could not read OCI layout index: %+v", err)
+	}
+	if len(indexManifest.Manifests) != 1 {
+		t.Fatalf("unexpected number of manifests: %d", len(indexManifest.Manifests))
+	}
+	descriptor := indexManifest.Manifests[0]
+	if ref := descriptor.Annotations[ociRefNameAnnotation]; ref != tag.String() {
+		t.Errorf("unexpected ref name annotation: %q", ref)
+	}
+
+	expectedDigest, err := img.image.Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+	if descriptor.Digest != expectedDigest {
+		t.Errorf("unexpected manifest digest: %q != %q", descriptor.Digest, expectedDigest)
+	}
+
+	// the image read back from the layout has the same contents
+	v1Img, err := index.Image(descriptor.Digest)
+	if err != nil {
+		t.Fatalf("could not read image from OCI layout: %+v", err)
+	}
+	roundTrip := NewImage(v1Img, testTempDir(t), WithLayoutBlobs(dir))
+	if err := roundTrip.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	if len(roundTrip.Layers) != 3 {
+		t.Fatalf("unexpected number of layers: %d", len(roundTrip.Layers))
+	}
+	metadata, err := roundTrip.FileMetadataFromSquash("/usr/local.txt")
+	if err != nil {
+		t.Fatalf("could not get metadata: %+v", err)
+	}
+	if metadata.TypeFlag != tar.TypeReg {
+		t.Errorf("unexpected type: %+v", metadata.TypeFlag)
+	}
+	reader, err := roundTrip.FileContentsFromSquash("/etc/config.txt")
+	if err != nil {
+		t.Fatalf("could not get contents: %+v", err)
+	}
+	assertContents(t, reader, "opt/app/config.txt")
+
+	// an existing layout is never overwritten
+	if err := img.WriteOCILayout(dir); err == nil {
+		t.Errorf("expected an error when writing over an existing layout")
+	}
+}
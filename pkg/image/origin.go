@@ -0,0 +1,27 @@
+package image
+
+import "time"
+
+// Origin describes where the image content was obtained from.
+type Origin struct {
+	// Source is the kind of provider that produced the image.
+	Source Source
+	// Location is where the image was obtained from (e.g. the docker daemon host, an absolute file path, or a
+	// registry URL).
+	Location string
+	// AcquisitionStarted is when the provider started fetching the image.
+	AcquisitionStarted time.Time
+	// AcquisitionCompleted is when the provider finished fetching the image (before the image is read).
+	AcquisitionCompleted time.Time
+	// Detection describes how the source was detected for a user string without a scheme (nil when the source was
+	// selected explicitly).
+	Detection *SourceDetection
+}
+
+// WithOrigin records where the image content was obtained from.
+func WithOrigin(origin Origin) AdditionalMetadata {
+	return func(image *Image) error {
+		image.Metadata.Origin = origin
+		return nil
+	}
+}
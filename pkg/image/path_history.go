@@ -0,0 +1,99 @@
+package image
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+const (
+	// PathUntouched indicates the layer did not change the path (the path may or may not exist as of the layer).
+	PathUntouched PathChange = iota
+	// PathAdded indicates the path did not exist in any lower layer and was added by the layer.
+	PathAdded
+	// PathModified indicates the path existed in a lower layer and was replaced by the layer.
+	PathModified
+	// PathDeleted indicates the path existed in a lower layer and was removed by the layer (via a whiteout).
+	PathDeleted
+)
+
+var pathChangeStr = [...]string{
+	"Untouched",
+	"Added",
+	"Modified",
+	"Deleted",
+}
+
+// PathChange describes how a single layer affected a path.
+type PathChange uint8
+
+// String returns a convenient display string for the change.
+func (c PathChange) String() string {
+	return pathChangeStr[c]
+}
+
+// PathHistoryEntry describes the state of a path as of a single layer.
+type PathHistoryEntry struct {
+	// Layer is the layer this entry describes.
+	Layer *Layer
+	// Change is how the layer affected the path.
+	Change PathChange
+	// Reference is the file as of this layer (relative to the squash tree of the layer), or nil if the path does not
+	// exist as of this layer.
+	Reference *file.Reference
+	// Metadata is the file metadata as of this layer, or nil if the path does not exist as of this layer (or is a
+	// directory that is only implied by other paths, without a tar entry).
+	Metadata *file.Metadata
+}
+
+// PathHistory returns, for every layer (in build order), how the layer affected the given path along with the state of
+// the path as of that layer.
+func (i *Image) PathHistory(path file.Path) ([]PathHistoryEntry, error) {
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+
+	var history = make([]PathHistoryEntry, 0, len(i.Layers))
+	var existedBefore bool
+
+	for _, layer := range i.Layers {
+		exists, ref, err := layer.SquashedTree.File(path)
+		if err != nil {
+			return nil, err
+		}
+		exists = exists && ref != nil
+
+		entry := PathHistoryEntry{
+			Layer: layer,
+		}
+
+		if exists {
+			entry.Reference = ref
+			catalogEntry, err := i.FileCatalog.Get(*ref)
+			if err != nil && !errors.Is(err, ErrFileNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				entry.Metadata = &catalogEntry.Metadata
+			}
+			// the file catalog tracks which layer last provided the file, so this layer changed the path if it is the
+			// layer that provided it
+			changed := err == nil && catalogEntry.Layer == layer
+
+			switch {
+			case !existedBefore:
+				entry.Change = PathAdded
+			case changed:
+				entry.Change = PathModified
+			}
+		} else if existedBefore {
+			entry.Change = PathDeleted
+		}
+
+		history = append(history, entry)
+		existedBefore = exists
+	}
+
+	return history, nil
+}
@@ -0,0 +1,83 @@
+package image
+
+import (
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestImage_PathHistory(t *testing.T) {
+	img := newTestImage(t, []v1.Layer{
+		newTestLayer(t, map[string]string{"etc/passwd": "root"}),
+		newTestLayer(t, map[string]string{"etc/group": "root"}),
+		newTestLayer(t, map[string]string{"etc/passwd": "root,user"}),
+		newTestLayer(t, map[string]string{"etc/.wh.passwd": ""}),
+		newTestLayer(t, map[string]string{"etc/hosts": "localhost"}),
+		newTestLayer(t, map[string]string{"etc/passwd": "user"}),
+	})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	history, err := img.PathHistory("/etc/passwd")
+	if err != nil {
+		t.Fatalf("could not get path history: %+v", err)
+	}
+
+	expected := []struct {
+		change   PathChange
+		contents string
+	}{
+		{change: PathAdded, contents: "root"},
+		{change: PathUntouched, contents: "root"},
+		{change: PathModified, contents: "root,user"},
+		{change: PathDeleted},
+		{change: PathUntouched},
+		{change: PathAdded, contents: "user"},
+	}
+
+	if len(history) != len(expected) {
+		t.Fatalf("unexpected history length: %d", len(history))
+	}
+
+	for idx, entry := range history {
+		if entry.Layer != img.Layers[idx] {
+			t.Errorf("unexpected layer for entry %d", idx)
+		}
+		if entry.Change != expected[idx].change {
+			t.Errorf("unexpected change for layer %d: %s", idx, entry.Change)
+		}
+		if expected[idx].contents == "" {
+			if entry.Reference != nil || entry.Metadata != nil {
+				t.Errorf("expected no file for layer %d: %+v", idx, entry)
+			}
+			continue
+		}
+		if entry.Metadata == nil || entry.Metadata.Size != int64(len(expected[idx].contents)) {
+			t.Errorf("unexpected metadata for layer %d: %+v", idx, entry.Metadata)
+		}
+		reader, err := img.FileContentsByReference(*entry.Reference)
+		if err != nil {
+			t.Fatalf("could not get contents for layer %d: %+v", idx, err)
+		}
+		actual, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("could not read contents: %+v", err)
+		}
+		if string(actual) != expected[idx].contents {
+			t.Errorf("unexpected contents for layer %d: %q", idx, string(actual))
+		}
+	}
+
+	// paths that never exist are untouched in every layer
+	history, err = img.PathHistory("/does/not/exist")
+	if err != nil {
+		t.Fatalf("could not get path history: %+v", err)
+	}
+	for idx, entry := range history {
+		if entry.Change != PathUntouched || entry.Reference != nil {
+			t.Errorf("unexpected entry for layer %d: %+v", idx, entry)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/anchore/stereoscope/internal/log"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	// FetchFromSource indicates that the blob would be transferred from the image source (e.g. pulled from a registry).
+	FetchFromSource BlobFetch = "source"
+	// FetchFromLayerCache indicates that the blob would be served from the layer cache (see WithLayerCache).
+	FetchFromLayerCache BlobFetch = "layer-cache"
+	// FetchFromLocal indicates that the blob is already on local disk and would be read in place (e.g. within an OCI
+	// layout or from another layer backend, see WithLayerOpener).
+	FetchFromLocal BlobFetch = "local"
+)
+
+// BlobFetch is where the content of a blob would be obtained from when reading an image.
+type BlobFetch string
+
+// PlannedBlob is a single layer blob that reading the image would need.
+type PlannedBlob struct {
+	// Digest is the digest of the (compressed) layer blob.
+	Digest string
+	// MediaType is the media type of the layer blob.
+	MediaType string
+	// Size is the size of the (compressed) layer blob in bytes, as described by the manifest.
+	Size int64
+	// Fetch is where the blob content would be obtained from.
+	Fetch BlobFetch
+}
+
+// AcquisitionPlan describes what reading an image would fetch, without transferring any layer data. This is useful
+// for pre-flight cost checks (e.g. in CI) before committing to pulling an image.
+type AcquisitionPlan struct {
+	// Provider is the scheme of the image source that would provide the image (e.g. "registry").
+	Provider string
+	// Location is where the image would be obtained from (e.g. the fully qualified registry reference).
+	Location string
+	// ManifestDigest is the digest of the resolved image manifest (empty if unknown).
+	ManifestDigest string
+	// Blobs are all layer blobs of the image (in manifest order).
+	Blobs []PlannedBlob
+	// BytesToFetch is the total size of all blobs that would be transferred from the image source.
+	BytesToFetch int64
+	// CachedBytes is the total size of all blobs that would be served from the layer cache or local disk.
+	CachedBytes int64
+}
+
+// Plan resolves what reading the image with the given options would fetch (which layer blobs would be transferred from
+// the image source versus served from the layer cache or local disk) without reading any layer data. Only the
+// manifest and config (already obtained by the provider) are consulted. Note: the image should not be read after
+// planning, instead a new image should be provided.
+func (i *Image) Plan(options ...ReadOption) (*AcquisitionPlan, error) {
+	var err error
+	if err = i.applyReadOptions(options); err != nil {
+		return nil, err
+	}
+
+	i.Metadata, err = readImageMetadata(i.image)
+	if err != nil {
+		return nil, err
+	}
+	if err = i.applyOverrideMetadata(); err != nil {
+		return nil, err
+	}
+
+	plan := &AcquisitionPlan{
+		Provider:       i.Metadata.Origin.Source.Scheme(),
+		Location:       i.Metadata.Origin.Location,
+		ManifestDigest: i.Metadata.ManifestDigest,
+	}
+
+	// note: listing the layers of an image read through the layer cache adds every layer to the cache
+	source := i.image
+	if i.uncachedImage != nil {
+		source = i.uncachedImage
+	}
+	v1Layers, err := source.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v1Layer := range v1Layers {
+		blob, err := i.planBlob(v1Layer)
+		if err != nil {
+			return nil, err
+		}
+		if blob.Fetch == FetchFromSource {
+			plan.BytesToFetch += blob.Size
+		} else {
+			plan.CachedBytes += blob.Size
+		}
+		plan.Blobs = append(plan.Blobs, blob)
+	}
+
+	return plan, nil
+}
+
+// planBlob describes where the given layer blob would be obtained from, using only the layer descriptor.
+func (i *Image) planBlob(layer v1.Layer) (PlannedBlob, error) {
+	digest, err := layer.Digest()
+	if err != nil {
+		return PlannedBlob{}, fmt.Errorf("unable to determine layer digest: %w", err)
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return PlannedBlob{}, fmt.Errorf("unable to determine size of layer=%q: %w", digest, err)
+	}
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return PlannedBlob{}, fmt.Errorf("unable to determine media type of layer=%q: %w", digest, err)
+	}
+
+	blob := PlannedBlob{
+		Digest:    digest.String(),
+		MediaType: string(mediaType),
+		Size:      size,
+		Fetch:     FetchFromSource,
+	}
+
+	switch {
+	case i.layerOpenerFor(layer) != nil:
+		blob.Fetch = FetchFromLocal
+	case i.layerCache != nil:
+		if _, err := i.layerCache.Get(digest); err == nil {
+			blob.Fetch = FetchFromLayerCache
+		} else {
+			log.Debugf("layer=%q is not within the layer cache: %+v", digest, err)
+		}
+	}
+	return blob, nil
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestImage_Plan(t *testing.T) {
+	v1Img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	layers, err := v1Img.Layers()
+	if err != nil {
+		t.Fatalf("could not get layers: %+v", err)
+	}
+
+	layerCache := NewLayerCache(testTempDir(t))
+	if _, err := layerCache.Put(layers[1]); err != nil {
+		t.Fatalf("could not cache layer: %+v", err)
+	}
+
+	localDigest, err := layers[2].Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+
+	img := NewImage(v1Img, testTempDir(t),
+		WithOrigin(Origin{Source: RegistrySource, Location: "registry.example.com/some/image:latest"}),
+		WithManifestDigest("sha256:abc"),
+		WithLayerOpener(func(layer v1.Layer) LayerOpener {
+			if digest, err := layer.Digest(); err == nil && digest == localDigest {
+				return layerStreamOpener(layer.Uncompressed)
+			}
+			return nil
+		}),
+	)
+
+	plan, err := img.Plan(WithLayerCache(layerCache))
+	if err != nil {
+		t.Fatalf("could not plan: %+v", err)
+	}
+
+	if plan.Provider != "registry" || plan.Location != "registry.example.com/some/image:latest" || plan.ManifestDigest != "sha256:abc" {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+
+	expectedFetches := []BlobFetch{FetchFromSource, FetchFromLayerCache, FetchFromLocal}
+	if len(plan.Blobs) != len(expectedFetches) {
+		t.Fatalf("unexpected number of blobs: %d", len(plan.Blobs))
+	}
+
+	var toFetch, cached int64
+	for idx, blob := range plan.Blobs {
+		digest, err := layers[idx].Digest()
+		if err != nil {
+			t.Fatalf("could not get digest: %+v", err)
+		}
+		size, err := layers[idx].Size()
+		if err != nil {
+			t.Fatalf("could not get size: %+v", err)
+		}
+		if blob.Digest != digest.String() || blob.Size != size || blob.MediaType == "" {
+			t.Errorf("unexpected blob at index=%d: %+v", idx, blob)
+		}
+		if blob.Fetch != expectedFetches[idx] {
+			t.Errorf("unexpected fetch for blob at index=%d: %q != %q", idx, blob.Fetch, expectedFetches[idx])
+		}
+		if idx == 0 {
+			toFetch += size
+		} else {
+			cached += size
+		}
+	}
+
+	if plan.BytesToFetch != toFetch || plan.CachedBytes != cached {
+		t.Errorf("unexpected plan totals: fetch=%d cached=%d", plan.BytesToFetch, plan.CachedBytes)
+	}
+	if len(img.Layers) != 0 {
+		t.Errorf("expected no layers to be read")
+	}
+}
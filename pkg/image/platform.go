@@ -0,0 +1,82 @@
+package image
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Platform identifies the single image to select from a manifest list / image index (e.g. "linux/arm64/v8").
+type Platform struct {
+	OS           string
+	Architecture string
+	// Variant is optional, when not provided any variant of the architecture is selected.
+	Variant string
+}
+
+// NewPlatform parses a platform string in the form "os/arch[/variant]".
+func NewPlatform(platform string) (Platform, error) {
+	fields := strings.Split(strings.TrimSpace(platform), "/")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform=%q: expected os/arch[/variant]", platform)
+	}
+
+	p := Platform{
+		OS:           fields[0],
+		Architecture: fields[1],
+	}
+	if len(fields) == 3 {
+		p.Variant = fields[2]
+	}
+	return p, nil
+}
+
+// DefaultPlatform is the platform of the current host (for linux images).
+func DefaultPlatform() Platform {
+	return Platform{
+		OS:           "linux",
+		Architecture: runtime.GOARCH,
+	}
+}
+
+// PlatformFromV1 converts a platform from the GCR lib (nil if not provided).
+func PlatformFromV1(platform *v1.Platform) *Platform {
+	if platform == nil || (platform.OS == "" && platform.Architecture == "") {
+		return nil
+	}
+	return &Platform{
+		OS:           platform.OS,
+		Architecture: platform.Architecture,
+		Variant:      platform.Variant,
+	}
+}
+
+// String returns the platform in the form "os/arch[/variant]".
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Matches indicates if the given image index entry platform satisfies this platform.
+func (p Platform) Matches(platform *v1.Platform) bool {
+	if platform == nil {
+		return false
+	}
+	if platform.OS != p.OS || platform.Architecture != p.Architecture {
+		return false
+	}
+	return p.Variant == "" || platform.Variant == p.Variant
+}
+
+// V1 returns the platform as understood by the GCR lib.
+func (p Platform) V1() v1.Platform {
+	return v1.Platform{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+	}
+}
@@ -0,0 +1,101 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestNewPlatform(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Platform
+		wantErr  bool
+	}{
+		{
+			input:    "linux/amd64",
+			expected: Platform{OS: "linux", Architecture: "amd64"},
+		},
+		{
+			input:    "linux/arm64/v8",
+			expected: Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		},
+		{
+			input:   "linux",
+			wantErr: true,
+		},
+		{
+			input:   "linux//v8",
+			wantErr: true,
+		},
+		{
+			input:   "linux/arm/v7/extra",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actual, err := NewPlatform(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("unexpected platform: %+v", actual)
+			}
+			if actual.String() != test.input {
+				t.Errorf("unexpected string: %q", actual.String())
+			}
+		})
+	}
+}
+
+func TestPlatform_Matches(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		other    *v1.Platform
+		expected bool
+	}{
+		{
+			name:     "match",
+			platform: Platform{OS: "linux", Architecture: "arm64"},
+			other:    &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			expected: true,
+		},
+		{
+			name:     "variant match",
+			platform: Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			other:    &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			expected: true,
+		},
+		{
+			name:     "variant mismatch",
+			platform: Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			other:    &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		},
+		{
+			name:     "architecture mismatch",
+			platform: Platform{OS: "linux", Architecture: "amd64"},
+			other:    &v1.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name:     "no platform",
+			platform: Platform{OS: "linux", Architecture: "amd64"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := test.platform.Matches(test.other); actual != test.expected {
+				t.Errorf("unexpected match: %v", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// PrefetchResult tracks a background prefetch started by Image.Prefetch.
+type PrefetchResult struct {
+	done chan struct{}
+	err  error
+}
+
+// Done is closed when the prefetch has completed (successfully or not).
+func (p *PrefetchResult) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the prefetch has completed and returns the first error encountered (if any).
+func (p *PrefetchResult) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Prefetch warms the layer content for the given paths (relative to the image squash tree) in the background, so
+// that later content requests for these paths are cheaper (e.g. lazily fetched layers are downloaded and the tar
+// regions holding the files are paged in). Paths that do not exist (or have no content within any layer, such as
+// implied directories) are ignored. Note: prefetching only reads from the layer openers and does not populate the
+// file catalog contents cache, so it is safe to request file contents while the prefetch is running.
+func (i *Image) Prefetch(paths ...file.Path) *PrefetchResult {
+	result := &PrefetchResult{
+		done: make(chan struct{}),
+	}
+
+	// resolve all paths up front so that the trees and catalog are not accessed in the background
+	requests, err := i.prefetchRequests(paths...)
+	if err != nil {
+		result.err = err
+		close(result.done)
+		return result
+	}
+
+	go func() {
+		defer close(result.done)
+		for _, request := range requests {
+			if err := prefetchLayer(request); err != nil {
+				log.Debugf("unable to prefetch layer=%q: %+v", request.layer.Metadata.Digest, err)
+				result.err = err
+				return
+			}
+		}
+	}()
+
+	return result
+}
+
+// prefetchRequests resolves the given paths to per-layer content requests (in layer order).
+func (i *Image) prefetchRequests(paths ...file.Path) ([]layerContentsRequest, error) {
+	squashedTree, err := i.SquashedTreeWithError()
+	if err != nil {
+		return nil, err
+	}
+	if squashedTree == nil {
+		return nil, nil
+	}
+
+	var refs []file.Reference
+	for _, p := range paths {
+		exists, ref, err := squashedTree.File(p, filetree.FollowBasenameLinks)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve path=%q for prefetch: %w", p, err)
+		}
+		if !exists || ref == nil || !i.FileCatalog.Exists(*ref) {
+			continue
+		}
+		refs = append(refs, *ref)
+	}
+
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	return i.FileCatalog.buildTarContentsRequests(refs...)
+}
+
+// prefetchLayer reads the layer tar up to (and including) the last requested entry, reading (and discarding) the
+// content of all requested entries.
+func prefetchLayer(request layerContentsRequest) error {
+	reader, err := request.layer.opener.Open()
+	if err != nil {
+		return fmt.Errorf("unable to obtain layer tar reader: %w", err)
+	}
+	defer reader.Close()
+
+	var sequence int64 = -1
+	return file.TarIterator(reader, func(header *tar.Header, contents io.Reader) error {
+		sequence++
+		if _, ok := request.files[header.Name]; ok {
+			if _, err := io.Copy(ioutil.Discard, contents); err != nil {
+				return err
+			}
+		}
+		if sequence >= request.lastSequence {
+			return file.ErrTarStopIteration
+		}
+		return nil
+	})
+}
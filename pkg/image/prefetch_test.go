@@ -0,0 +1,84 @@
+package image
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestImage_Prefetch(t *testing.T) {
+	tarBytes := newTestTar(t, map[string]string{"some/file.txt": "some contents"})
+
+	randomImg, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	var lock sync.Mutex
+	var opened int
+	img := NewImage(randomImg, testTempDir(t),
+		WithLayerOpener(func(v1.Layer) LayerOpener {
+			return layerStreamOpener(func() (io.ReadCloser, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				opened++
+				return ioutil.NopCloser(bytes.NewReader(tarBytes)), nil
+			})
+		}),
+	)
+
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	tests := []struct {
+		name       string
+		paths      []file.Path
+		wantOpened int
+	}{
+		{
+			name:       "no paths",
+			wantOpened: 0,
+		},
+		{
+			name:       "missing and implied paths are ignored",
+			paths:      []file.Path{"/does/not/exist", "/some"},
+			wantOpened: 0,
+		},
+		{
+			name:       "existing path",
+			paths:      []file.Path{"/some/file.txt", "/does/not/exist"},
+			wantOpened: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock.Lock()
+			opened = 0
+			lock.Unlock()
+
+			result := img.Prefetch(test.paths...)
+			if err := result.Wait(); err != nil {
+				t.Fatalf("unexpected prefetch error: %+v", err)
+			}
+			select {
+			case <-result.Done():
+			default:
+				t.Fatalf("expected prefetch to be done")
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			if opened != test.wantOpened {
+				t.Errorf("unexpected layer opens: %d != %d", opened, test.wantOpened)
+			}
+		})
+	}
+}
@@ -1,7 +1,82 @@
 package image
 
+import (
+	"context"
+	"fmt"
+)
+
+// ErrImageNotFound indicates that the requested image does not exist within the source (e.g. it is unknown to the
+// daemon or registry, or there is nothing at the given path).
+var ErrImageNotFound = fmt.Errorf("image not found")
+
+// ErrDaemonUnavailable indicates that the daemon (or container runtime) to obtain the image from cannot be reached.
+var ErrDaemonUnavailable = fmt.Errorf("daemon unavailable")
+
+// ErrUnsupportedMediaType indicates that the image (or a manifest describing it) has a media type that cannot be
+// processed (e.g. a docker schema 1 manifest).
+var ErrUnsupportedMediaType = fmt.Errorf("unsupported media type")
+
+// ErrManifestInvalid indicates that the manifest (or index) describing the image is missing or cannot be parsed.
+var ErrManifestInvalid = fmt.Errorf("invalid manifest")
+
+// ErrProvider is a provider failure classified as one of the provider errors above (e.g. ErrImageNotFound). The
+// classification matches with errors.Is while the underlying cause remains available to errors.Is and errors.As (e.g.
+// os.ErrPermission or context.Canceled).
+type ErrProvider struct {
+	// Kind is the provider error the failure is classified as (e.g. ErrDaemonUnavailable).
+	Kind error
+	// Description is what the provider was doing when it failed.
+	Description string
+	// Err is the underlying cause (nil when there is none).
+	Err error
+}
+
+// NewProviderError classifies the given failure (which may be nil) as the given kind of provider error.
+func NewProviderError(kind error, description string, err error) error {
+	return &ErrProvider{Kind: kind, Description: description, Err: err}
+}
+
+func (e *ErrProvider) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Description)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Kind, e.Description, e.Err)
+}
+
+func (e *ErrProvider) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *ErrProvider) Unwrap() error {
+	return e.Err
+}
+
 // Provider is an abstraction for any object that provides image objects (e.g. the docker daemon API, a tar file of
-// an OCI image, podman varlink API, etc.).
+// an OCI image, podman varlink API, etc.). Providing an image may be aborted by cancelling the given context.
 type Provider interface {
-	Provide() (*Image, error)
+	Provide(ctx context.Context) (*Image, error)
+}
+
+// Resolver is implemented by providers that can cheaply resolve the ID (config digest) of the image they would provide,
+// without providing the image. This allows Image.Refresh to skip providing an image that has not changed.
+type Resolver interface {
+	ResolveID(ctx context.Context) (string, error)
+}
+
+// ProviderOptions tailors how a provider obtains an image. The zero value is the default behavior for all providers,
+// and options that do not apply to a provider are ignored (e.g. a platform for a single-image archive).
+type ProviderOptions struct {
+	// Platform selects the image from a multi-platform image. When not provided the host platform is selected (or for
+	// daemons, whichever image the daemon already has).
+	Platform *Platform
+	// Retry determines how daemon and registry operations are retried upon transient failures (never by default).
+	Retry RetryPolicy
+}
+
+// SelectedPlatform returns the platform to select from a multi-platform image (the host platform by default).
+func (o ProviderOptions) SelectedPlatform() Platform {
+	if o.Platform != nil {
+		return *o.Platform
+	}
+	return DefaultPlatform()
 }
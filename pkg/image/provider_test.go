@@ -0,0 +1,35 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestErrProvider(t *testing.T) {
+	cause := &os.PathError{Op: "open", Path: "/some/path", Err: os.ErrPermission}
+	err := NewProviderError(ErrDaemonUnavailable, "unable to reach daemon", cause)
+
+	if !errors.Is(err, ErrDaemonUnavailable) {
+		t.Errorf("expected the classification to match: %+v", err)
+	}
+	if errors.Is(err, ErrImageNotFound) {
+		t.Errorf("unexpected classification: %+v", err)
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the cause to match: %+v", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr != cause {
+		t.Errorf("expected the cause to be available: %+v", err)
+	}
+	if expected := "daemon unavailable: unable to reach daemon: open /some/path: permission denied"; err.Error() != expected {
+		t.Errorf("unexpected message: %q != %q", err.Error(), expected)
+	}
+
+	err = NewProviderError(ErrImageNotFound, "no image", nil)
+	if errors.Is(err, context.Canceled) || err.Error() != "image not found: no image" {
+		t.Errorf("unexpected error without a cause: %+v", err)
+	}
+}
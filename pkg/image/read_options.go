@@ -0,0 +1,200 @@
+package image
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ReadOption is a functional option that tailors how an image is indexed by Image.Read().
+type ReadOption func(*Image) error
+
+// WithDiskBackedFileCatalog moves all file catalog entries to an embedded database on disk (within the image content
+// cache dir) once the number of cataloged files reaches the given threshold. This keeps memory usage flat for images
+// with a very large number of files at the cost of slower catalog lookups. The database lives as long as the image (it
+// is removed by Image.Cleanup). When reading through a layer tar cache (see WithLayerTarCache), the catalog is also
+// persisted within the cache once all layers are indexed, so that it can be reused across process restarts with
+// LayerTarCache.FileCatalog.
+func WithDiskBackedFileCatalog(threshold int) ReadOption {
+	return func(image *Image) error {
+		image.FileCatalog.diskStoreThreshold = threshold
+		image.cacheFileCatalog = true
+		return nil
+	}
+}
+
+// WithIndexOnlyPaths restricts the layer file trees and file catalog to the given path prefixes (e.g. "/usr", "/etc"),
+// skipping all other paths within every layer. Whiteouts that affect the included paths are still honored when
+// squashing. Note: links are not followed outside of the given prefixes, so link destinations outside of these
+// prefixes will not be found.
+func WithIndexOnlyPaths(paths ...string) ReadOption {
+	return func(image *Image) error {
+		image.indexFilter = newIndexPathFilter(paths...)
+		return nil
+	}
+}
+
+// WithExclusions never indexes the paths matching the given exclusion spec (in .dockerignore syntax) within any layer,
+// so these paths are not found within the layer trees, the squash trees, or the file catalog. Whiteouts that affect
+// excluded paths are excluded too.
+func WithExclusions(reader io.Reader) ReadOption {
+	return func(image *Image) error {
+		exclusions, err := newPathExclusions(reader)
+		if err != nil {
+			return err
+		}
+		image.exclusions = append(image.exclusions, exclusions...)
+		return nil
+	}
+}
+
+// WithExclusionsFile is the same as WithExclusions, however, the exclusion spec is read from the given file (e.g. an
+// existing .dockerignore file).
+func WithExclusionsFile(path string) ReadOption {
+	return func(image *Image) error {
+		fh, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("unable to open exclusions file: %w", err)
+		}
+		defer fh.Close()
+		return WithExclusions(fh)(image)
+	}
+}
+
+// WithoutSquash skips creating the squash trees, which saves time and memory when only the layer diff trees
+// (Layer.Tree) are of interest. Note: all squash trees are left empty, so squash-relative queries (e.g. contents from
+// the squash or link resolution relative to a squash) will not find any paths.
+func WithoutSquash() ReadOption {
+	return func(image *Image) error {
+		image.skipSquash = true
+		return nil
+	}
+}
+
+// WithLazyLayers defers reading each layer tar until the layer content is first accessed, so reading the image only
+// fetches the image and layer metadata. A single layer is indexed by Layer.Index (or the layer content helpers, such as
+// Layer.FileContents), while all layers are indexed and squashed by Image.IndexLayers (or the squash-relative helpers,
+// such as Image.SquashedTree). This greatly reduces the time to read an image when only a few layers (or paths) are of
+// interest. Note: until indexed the layer trees are empty and the image (and layer) sizes are not known.
+func WithLazyLayers() ReadOption {
+	return func(image *Image) error {
+		image.lazyLayers = true
+		return nil
+	}
+}
+
+// WithLayerConcurrency reads up to the given number of layers at the same time, which speeds up reading images with
+// many layers on multi-core machines (at the cost of holding the file catalog entries for all layers in memory until
+// all layers have been read). By default layers are read one at a time. This does not apply to lazily read images
+// (see WithLazyLayers).
+func WithLayerConcurrency(concurrency int) ReadOption {
+	return func(image *Image) error {
+		if concurrency < 0 {
+			return fmt.Errorf("invalid layer concurrency: %d", concurrency)
+		}
+		image.layerConcurrency = concurrency
+		return nil
+	}
+}
+
+// WithFileDigests computes the SHA-256 digest (along with any given additional hash algorithms) of each regular file
+// while the layer tars are read, recording these on the file catalog entries (see file.Metadata.Digests), so that file
+// digests are available without reading the file contents again. Note: additional hash algorithms must be available
+// (e.g. crypto.SHA1 requires importing "crypto/sha1").
+func WithFileDigests(additional ...crypto.Hash) ReadOption {
+	return func(image *Image) error {
+		hashes := []crypto.Hash{crypto.SHA256}
+		for _, h := range additional {
+			if !h.Available() {
+				return fmt.Errorf("unavailable file digest algorithm: %s", h)
+			}
+			if h != crypto.SHA256 {
+				hashes = append(hashes, h)
+			}
+		}
+		image.fileDigests = hashes
+		return nil
+	}
+}
+
+// WithContentTypes sniffs the content type (MIME type, along with binary and ELF hints) of each regular file from the
+// leading bytes of the contents while the layer tars are read, recording these on the file catalog entries (see
+// file.Metadata.ContentType), so that files can be classified (see Image.FilesByMIMEType) without reading the file
+// contents again.
+func WithContentTypes() ReadOption {
+	return func(image *Image) error {
+		image.sniffContentTypes = true
+		return nil
+	}
+}
+
+// WithTarEntryPolicy determines how layer tar entries that cannot be represented (unsupported entry types and malformed
+// headers) are handled: file.LenientTarEntries (the default) skips such entries with a warning, while
+// file.StrictTarEntries fails the read, which is useful for refusing images that cannot be fully represented.
+func WithTarEntryPolicy(policy file.TarEntryPolicy) ReadOption {
+	return func(image *Image) error {
+		image.tarEntryPolicy = policy
+		return nil
+	}
+}
+
+// WithPathPolicy determines how tar entries with suspicious names (e.g. names escaping the layer root, see
+// file.SuspiciousTarEntryName) are handled: file.NormalizePaths (the default) indexes such entries at the sanitized
+// path, file.RejectSuspiciousPaths fails the read, and file.QuarantineSuspiciousPaths does not index such entries. All
+// suspicious entries are reported by Layer.SuspiciousEntries (unless rejected).
+func WithPathPolicy(policy file.PathPolicy) ReadOption {
+	return func(image *Image) error {
+		image.pathPolicy = policy
+		return nil
+	}
+}
+
+// WithStreamingLayers never persists uncompressed layer tars (or large file contents) to disk, which is useful where
+// disk space is scarce (e.g. nodes with tiny ephemeral disks) or layers are larger than the available disk. The layer
+// trees and digests are computed in a single streaming pass over each layer, at the cost of streaming the layer from
+// the image source again for every later content read (e.g. Image.FileContentsFromSquash).
+func WithStreamingLayers() ReadOption {
+	return func(image *Image) error {
+		image.streamLayers = true
+		image.FileCatalog.streamContents = true
+		return nil
+	}
+}
+
+// WithDecompressedContents transparently decompresses gzip and bzip2 compressed file contents (e.g. compressed logs and
+// man pages) for all content fetches through FileCatalog.FileContents (e.g. Image.FileContentsFromSquash), where the
+// raw contents remain available through FileCatalog.RawFileContents. Note: xz and zstd compressed contents are provided
+// as-is, since there are no decoders for these within the standard library.
+func WithDecompressedContents() ReadOption {
+	return func(image *Image) error {
+		image.FileCatalog.decompressContents = true
+		return nil
+	}
+}
+
+// WithNestedArchives descends into tar, zip, and jar archives (by file name: .tar, .tar.gz, .tgz, .zip, .jar, .war,
+// and .ear) found within the layers, adding the entries of each archive to a virtual sub-tree next to the archive (e.g.
+// /app/app.jar!/META-INF/MANIFEST.MF, see NestedArchiveSeparator), including archives within archives. These entries
+// are part of the layer tree of the archive and of all squash trees that include the archive, where the contents are
+// read from the archive on demand. Note: nested archive entries are not digested, sniffed, or searched while reading
+// the image, and archives that cannot be read are skipped (and logged).
+func WithNestedArchives() ReadOption {
+	return func(image *Image) error {
+		image.nestedArchives = true
+		return nil
+	}
+}
+
+// WithSeekableLayers reads eStargz (seekable tar.gz) layers by fetching only the table of contents of each layer blob
+// (and later only the ranges holding requested file contents) instead of fetching entire layer blobs, which greatly
+// speeds up targeted content reads of large images. This only applies to sources that can fetch blob ranges (e.g. the
+// registry source), all other layers are read entirely as usual.
+func WithSeekableLayers() ReadOption {
+	return func(image *Image) error {
+		image.seekableLayers = true
+		return nil
+	}
+}
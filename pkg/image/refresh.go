@@ -0,0 +1,244 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+var ErrNoProvider = fmt.Errorf("image has no provider to refresh from")
+
+// WithProvider associates the provider that the image was obtained from, allowing for the image to be refreshed later
+// (see Image.Refresh).
+func WithProvider(provider Provider) ReadOption {
+	return func(image *Image) error {
+		image.provider = provider
+		return nil
+	}
+}
+
+// Refresh re-resolves the image from its original provider and, if the underlying image has changed (e.g. a mutable
+// tag now points to a new image), re-reads the image in place. Providers that can resolve the image ID cheaply (see
+// Resolver) are only asked to provide the image when the ID has changed. Layers that are unchanged (by diff ID) are
+// reused as-is, only new layers are read. The same read options given to Image.Read are used again. Returns true if
+// the image changed. If an error is returned the image is left unchanged. Note: callers holding the file catalog of the
+// image observe the refreshed entries, while layers obtained before the refresh remain as they were. Refresh is not safe
+// for concurrent use: it must not run concurrently with any other use of the image (e.g. reading file contents, the
+// layers, the squash trees, or the metadata, or another Refresh), so callers that share the image across goroutines
+// must hold off all other use of the image until Refresh returns.
+func (i *Image) Refresh(ctx context.Context) (bool, error) {
+	if i.provider == nil {
+		return false, ErrNoProvider
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	if resolver, ok := i.provider.(Resolver); ok {
+		id, err := resolver.ResolveID(ctx)
+		switch {
+		case err != nil:
+			log.Debugf("unable to resolve image ID on refresh (providing the image instead): %+v", err)
+		case id == i.Metadata.ID:
+			log.Debugf("image unchanged on refresh: digest=%+v", i.Metadata.ID)
+			return false, nil
+		}
+	}
+
+	// all temp dirs created from here on belong to the fresh image
+	previousTempDirs := i.ownTempDirs()
+
+	fresh, reused, err := i.provideFresh(ctx)
+	if err != nil || fresh == nil {
+		i.removeTempDirs(newTempDirs(i.ownTempDirs(), previousTempDirs))
+		return false, err
+	}
+
+	i.replaceReadState(fresh)
+
+	if !reused {
+		// nothing from the previous read is used anymore
+		i.removeTempDirs(previousTempDirs)
+	}
+
+	return true, nil
+}
+
+// provideFresh provides and reads the image again (reusing the unchanged layers of this image), returning whether any
+// layers were reused. No image is returned when the image has not changed.
+func (i *Image) provideFresh(ctx context.Context) (*Image, bool, error) {
+	fresh, err := i.provider.Provide(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to refresh image: %w", err)
+	}
+
+	fresh.provider = i.provider
+	fresh.readOptions = i.readOptions
+
+	if err = fresh.applyReadOptions(fresh.readOptions); err != nil {
+		return nil, false, err
+	}
+
+	fresh.Metadata, err = readImageMetadata(fresh.image)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = fresh.applyOverrideMetadata(); err != nil {
+		return nil, false, err
+	}
+	fresh.bytesRead.addHooks(fresh.bytesReadHooks...)
+
+	if fresh.Metadata.ID == i.Metadata.ID && fresh.Metadata.ManifestDigest == i.Metadata.ManifestDigest {
+		log.Debugf("image unchanged on refresh: digest=%+v", i.Metadata.ID)
+		return nil, false, nil
+	}
+
+	log.Debugf("image changed on refresh: digest=%+v -> %+v", i.Metadata.ID, fresh.Metadata.ID)
+
+	reused, err := fresh.refreshLayers(ctx, i)
+	if err != nil {
+		return nil, false, err
+	}
+	fresh.Metadata.BytesRead = fresh.bytesRead.BytesRead()
+
+	return fresh, reused, nil
+}
+
+// replaceReadState swaps the read state of this image (the image source, metadata, layers, and file catalog entries)
+// for that of the given refreshed image, leaving everything else (e.g. the read options) as-is. This is done without
+// holding the image lock, since Refresh must not run concurrently with any other use of the image.
+func (i *Image) replaceReadState(fresh *Image) {
+	i.image = fresh.image
+	i.uncachedImage = fresh.uncachedImage
+	i.contentCacheDir = fresh.contentCacheDir
+	i.layoutPath = fresh.layoutPath
+	i.layerOpener = fresh.layerOpener
+	i.blobRangeFetcher = fresh.blobRangeFetcher
+	i.overrideMetadata = fresh.overrideMetadata
+	i.bytesRead = fresh.bytesRead
+	i.Metadata = fresh.Metadata
+	i.Metadata.Origin.Detection = i.sourceDetection
+	i.Layers = fresh.Layers
+	i.indexed = fresh.indexed
+	i.stats = nil
+	i.FileCatalog.replace(&fresh.FileCatalog)
+
+	// all layers (new and reused) must reference the file catalog of this image, not the discarded one
+	for _, layer := range i.Layers {
+		layer.fileCatalog = &i.FileCatalog
+	}
+}
+
+// ownTempDirs returns all temp dirs of this image (none when not known, see WithTempDirs).
+func (i *Image) ownTempDirs() []string {
+	if i.tempDirs == nil {
+		return nil
+	}
+	return i.tempDirs.TempDirs()
+}
+
+// removeTempDirs removes the given temp dirs of this image, which are no longer used.
+func (i *Image) removeTempDirs(dirs []string) {
+	if i.tempDirs == nil || len(dirs) == 0 {
+		return
+	}
+	if err := i.tempDirs.Remove(dirs...); err != nil {
+		log.Warnf("unable to remove unused temp dirs for image=%q: %+v", i.Metadata.ID, err)
+	}
+}
+
+// newTempDirs returns the temp dirs that are not within the given previous temp dirs.
+func newTempDirs(dirs, previous []string) []string {
+	existing := make(map[string]bool)
+	for _, dir := range previous {
+		existing[dir] = true
+	}
+	var result []string
+	for _, dir := range dirs {
+		if !existing[dir] {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+// refreshLayers reads all layers for the (unread) image, reusing layers from the previous image where the diff ID
+// matches, and squashes the result. Returns whether any layers were reused.
+func (i *Image) refreshLayers(ctx context.Context, previous *Image) (bool, error) {
+	var candidates = make(map[string]*Layer)
+	for _, layer := range previous.Layers {
+		candidates[layer.Metadata.Digest] = layer
+	}
+
+	v1Layers, err := i.image.Layers()
+	if err != nil {
+		return false, err
+	}
+
+	readProg := i.trackReadProgress(i.Metadata)
+
+	var layers = make([]*Layer, 0)
+	// reused maps each reused layer of the previous image to the copy used by this image (the layers of the previous
+	// image are never modified, since they may still be in use)
+	var reused = make(map[*Layer]*Layer)
+	for idx, v1Layer := range v1Layers {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		digest := i.Metadata.Config.RootFS.DiffIDs[idx].String()
+		if existing, ok := candidates[digest]; ok {
+			// note: a layer may only be reused once, since each layer has a distinct squash tree
+			delete(candidates, digest)
+
+			// a lazily read layer must be indexed to carry over its catalog entries
+			if err := existing.index(ctx); err != nil {
+				return false, err
+			}
+
+			layer := existing.copy()
+			layer.Metadata.Index = uint(idx)
+			layer.fileCatalog = &i.FileCatalog
+			reused[existing] = layer
+
+			i.Metadata.Size += layer.Metadata.Size
+			layers = append(layers, layer)
+			readProg.N++
+			continue
+		}
+
+		layer := i.newLayer(v1Layer)
+		if err := layer.read(ctx, &i.FileCatalog, i.Metadata, idx, i.layerCacheDir()); err != nil {
+			return false, err
+		}
+		i.Metadata.Size += layer.Metadata.Size
+		layers = append(layers, layer)
+
+		readProg.N++
+	}
+
+	// carry over all catalog entries for the reused layers
+	for _, id := range previous.FileCatalog.ids() {
+		entry, err := previous.FileCatalog.get(id)
+		if err != nil {
+			return false, fmt.Errorf("unable to carry over file catalog entry: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+		if layer, ok := reused[entry.Layer]; ok {
+			i.FileCatalog.Add(entry.File, entry.Metadata, layer)
+		}
+	}
+
+	i.Layers = layers
+	if err := i.squash(readProg); err != nil {
+		return false, err
+	}
+	i.indexed = true
+
+	return len(reused) > 0, nil
+}
@@ -0,0 +1,250 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// sequenceProvider provides a new image object for each of the given v1 images in turn (repeating the last one).
+type sequenceProvider struct {
+	t      *testing.T
+	images []v1.Image
+	calls  int
+}
+
+func (p *sequenceProvider) Provide(_ context.Context) (*Image, error) {
+	idx := p.calls
+	if idx >= len(p.images) {
+		idx = len(p.images) - 1
+	}
+	p.calls++
+	return NewImage(p.images[idx], testTempDir(p.t)), nil
+}
+
+func randomLayers(t *testing.T, count int64) []v1.Layer {
+	t.Helper()
+	img, err := random.Image(1024, count)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("could not get layers: %+v", err)
+	}
+	return layers
+}
+
+func TestImage_Refresh(t *testing.T) {
+	base := randomLayers(t, 3)
+	updated := randomLayers(t, 1)
+
+	provider := &sequenceProvider{
+		t: t,
+		images: []v1.Image{
+			newTestImage(t, base).image,
+			newTestImage(t, base).image,
+			newTestImage(t, []v1.Layer{base[0], base[1], updated[0]}).image,
+		},
+	}
+
+	img, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(WithProvider(provider)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	original := append([]*Layer{}, img.Layers...)
+	originalID := img.Metadata.ID
+	originalLock := img.FileCatalog.lock
+
+	// the same image is provided, nothing should change
+	changed, err := img.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("could not refresh image: %+v", err)
+	}
+	if changed {
+		t.Errorf("expected image to be unchanged")
+	}
+	for idx, layer := range img.Layers {
+		if layer != original[idx] {
+			t.Errorf("expected layer %d to be unchanged", idx)
+		}
+	}
+
+	// the top layer is replaced, only that layer should be read
+	changed, err = img.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("could not refresh image: %+v", err)
+	}
+	if !changed {
+		t.Fatalf("expected image to be changed")
+	}
+	if img.Metadata.ID == originalID {
+		t.Errorf("expected a new image ID")
+	}
+	if len(img.Layers) != 3 {
+		t.Fatalf("unexpected number of layers: %d", len(img.Layers))
+	}
+	if img.Layers[0].Tree != original[0].Tree || img.Layers[1].Tree != original[1].Tree {
+		t.Errorf("expected lower layers to be reused")
+	}
+	if img.Layers[2].Tree == original[2].Tree {
+		t.Errorf("expected top layer to be re-read")
+	}
+	if img.FileCatalog.lock != originalLock {
+		t.Errorf("expected the file catalog lock to be kept")
+	}
+	// layers obtained before the refresh must not be modified
+	for idx, layer := range original {
+		if layer.Metadata.Index != uint(idx) {
+			t.Errorf("expected original layer %d to keep its index: %d", idx, layer.Metadata.Index)
+		}
+		if layer == img.Layers[idx] {
+			t.Errorf("expected layer %d to be a copy", idx)
+		}
+	}
+
+	// all files from the squash must be resolvable from the refreshed catalog
+	for _, ref := range squashedTreeOf(t, img).AllFiles() {
+		entry, err := img.FileCatalog.Get(ref)
+		if err != nil {
+			t.Fatalf("could not find catalog entry for %+v: %+v", ref, err)
+		}
+		if entry.Layer != img.Layers[entry.Layer.Metadata.Index] {
+			t.Errorf("catalog entry references a layer not within the image: %+v", ref)
+		}
+		if entry.Layer.Tree == original[2].Tree {
+			t.Errorf("catalog entry references the replaced layer: %+v", ref)
+		}
+	}
+	for _, layer := range img.Layers {
+		if layer.fileCatalog != &img.FileCatalog {
+			t.Errorf("layer %d references a stale file catalog", layer.Metadata.Index)
+		}
+	}
+
+	reader, err := img.FileContentsByRef(img.Layers[0].Tree.AllFiles()[0])
+	if err != nil {
+		t.Fatalf("could not read reused layer contents: %+v", err)
+	}
+	reader.Close()
+}
+
+func TestImage_Refresh_NoProvider(t *testing.T) {
+	img := NewImage(empty.Image, testTempDir(t))
+	if _, err := img.Refresh(context.Background()); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("expected no provider error, got %+v", err)
+	}
+}
+
+// resolvingProvider resolves the image ID without providing the image.
+type resolvingProvider struct {
+	sequenceProvider
+	id string
+}
+
+func (p *resolvingProvider) ResolveID(_ context.Context) (string, error) {
+	return p.id, nil
+}
+
+func TestImage_Refresh_Resolver(t *testing.T) {
+	provider := &resolvingProvider{
+		sequenceProvider: sequenceProvider{
+			t:      t,
+			images: []v1.Image{newTestImage(t, randomLayers(t, 1)).image},
+		},
+	}
+
+	img, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(WithProvider(provider)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	provider.id = img.Metadata.ID
+
+	changed, err := img.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("could not refresh image: %+v", err)
+	}
+	if changed {
+		t.Errorf("expected image to be unchanged")
+	}
+	if provider.calls != 1 {
+		t.Errorf("expected the image to not be provided again: %d calls", provider.calls)
+	}
+}
+
+// tempDirProvider provides each image with a content cache dir from the given generator.
+type tempDirProvider struct {
+	sequenceProvider
+	generator *file.TempDirGenerator
+}
+
+func (p *tempDirProvider) Provide(_ context.Context) (*Image, error) {
+	img, err := p.sequenceProvider.Provide(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	dir, err := p.generator.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+	img.contentCacheDir = dir
+	return img, nil
+}
+
+func TestImage_Refresh_RemovesUnusedTempDirs(t *testing.T) {
+	tempDirs := file.NewTempDirGenerator()
+	generator := &tempDirs
+	defer generator.Cleanup()
+
+	provider := &tempDirProvider{
+		sequenceProvider: sequenceProvider{
+			t: t,
+			images: []v1.Image{
+				newTestImage(t, randomLayers(t, 1)).image,
+				newTestImage(t, randomLayers(t, 1)).image,
+				newTestImage(t, randomLayers(t, 1)).image,
+			},
+		},
+		generator: generator,
+	}
+
+	img, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(WithProvider(provider), WithTempDirs(generator)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	first := img.contentCacheDir
+
+	// no layers are reused, the previous temp dirs are removed
+	changed, err := img.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("could not refresh image: %+v", err)
+	}
+	if !changed {
+		t.Fatalf("expected image to be changed")
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("expected previous temp dir to be removed: %+v", err)
+	}
+	if _, err := os.Stat(img.contentCacheDir); err != nil {
+		t.Errorf("expected current temp dir to remain: %+v", err)
+	}
+	if dirs := generator.TempDirs(); len(dirs) != 1 || dirs[0] != img.contentCacheDir {
+		t.Errorf("unexpected temp dirs: %+v", dirs)
+	}
+}
@@ -0,0 +1,17 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextTransport binds all registry requests to the given context, so that they are abandoned once the context is
+// cancelled.
+type contextTransport struct {
+	inner http.RoundTripper
+	ctx   context.Context
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.inner.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ImageProvider is an image.Provider for an image pulled directly from an OCI/Docker registry (no daemon is required).
+type ImageProvider struct {
+	imageStr        string
+	options         image.ProviderOptions
+	registryOptions Options
+	tmpDirGen       *file.TempDirGenerator
+}
+
+// NewProviderFromRegistry creates a new provider instance for the given image reference (e.g. "alpine:latest" or
+// "registry.example.com/repo@sha256:..."), using the given registry options (e.g. credentials).
+func NewProviderFromRegistry(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions, registryOptions Options) *ImageProvider {
+	return &ImageProvider{
+		imageStr:        imgStr,
+		options:         options,
+		registryOptions: registryOptions,
+		tmpDirGen:       tmpDirGen,
+	}
+}
+
+// Provide an image object that represents the image as found within the registry. Only the manifest and config are
+// fetched here, layer blobs are fetched when the image is read.
+func (p *ImageProvider) Provide(ctx context.Context) (*image.Image, error) {
+	origin := image.Origin{
+		Source:             image.RegistrySource,
+		AcquisitionStarted: time.Now(),
+	}
+
+	ref, err := p.registryOptions.parseReference(p.imageStr)
+	if err != nil {
+		return nil, err
+	}
+	origin.Location = ref.Name()
+
+	bytesRead := image.NewByteCounter()
+	remoteOptions, err := p.remoteOptions(ctx, ref, bytesRead)
+	if err != nil {
+		return nil, err
+	}
+	// note: this is what remote.Image does, however, the manifest media type is checked first
+	descriptor, err := remote.Get(ref, remoteOptions...)
+	if err != nil {
+		return nil, registryError(err, "unable to fetch image from registry")
+	}
+	if descriptor.MediaType == types.DockerManifestSchema1 || descriptor.MediaType == types.DockerManifestSchema1Signed {
+		return nil, fmt.Errorf("%w: unable to fetch image from registry: manifest has media type=%q", image.ErrUnsupportedMediaType, descriptor.MediaType)
+	}
+	img, err := descriptor.Image()
+	if err != nil {
+		return nil, registryError(err, "unable to fetch image from registry")
+	}
+
+	var metadata []image.AdditionalMetadata
+
+	if tag, ok := ref.(name.Tag); ok {
+		metadata = append(metadata, image.WithTags(tag.String()))
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get image manifest digest: %w", err)
+	}
+	metadata = append(metadata, image.WithManifestDigest(digest.String()))
+
+	// make a best-effort attempt at getting the raw manifest and config
+	if rawManifest, err := img.RawManifest(); err == nil {
+		metadata = append(metadata, image.WithManifest(rawManifest))
+	} else {
+		log.Debugf("unable to get raw manifest for image=%q: %+v", ref.Name(), err)
+	}
+	if rawConfig, err := img.RawConfigFile(); err == nil {
+		metadata = append(metadata, image.WithConfig(rawConfig))
+	} else {
+		log.Debugf("unable to get raw config for image=%q: %+v", ref.Name(), err)
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	origin.AcquisitionCompleted = time.Now()
+	metadata = append(metadata, image.WithOrigin(origin), image.WithByteCounter(bytesRead))
+
+	// layer blob ranges are only fetched for seekable layers (see image.WithSeekableLayers)
+	rangeFetcher := &blobRangeFetcher{repo: ref.Context(), registryOptions: p.registryOptions, retry: p.options.Retry, bytesRead: bytesRead}
+	metadata = append(metadata, image.WithBlobRangeFetcher(rangeFetcher.forLayer))
+
+	return image.NewImage(img, contentTempDir, metadata...), nil
+}
+
+// remoteOptions selects the platform, the transport, and the authentication to use for the registry of the given
+// reference. All registry requests (including layer blob fetches when the image is read) are bound to the given context
+// and all bytes transferred are recorded with the given counter.
+func (p *ImageProvider) remoteOptions(ctx context.Context, ref name.Reference, bytesRead *image.ByteCounter) ([]remote.Option, error) {
+	tr, err := p.registryOptions.transport(p.options.Retry)
+	if err != nil {
+		return nil, err
+	}
+	return []remote.Option{
+		remote.WithPlatform(p.options.SelectedPlatform().V1()),
+		remote.WithTransport(&contextTransport{inner: &countingTransport{inner: tr, counter: bytesRead}, ctx: ctx}),
+		p.registryOptions.authOption(ref.Context().Registry),
+	}, nil
+}
+
+// countingTransport records the size of all registry response bodies as bytes read from the registry.
+type countingTransport struct {
+	inner   http.RoundTripper
+	counter *image.ByteCounter
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{
+		Reader: t.counter.RemoteReader(resp.Body),
+		Closer: resp.Body,
+	}
+	return resp, nil
+}
+
+// countingBody is a response body that records all bytes read.
+type countingBody struct {
+	io.Reader
+	io.Closer
+}
+
+// registryError describes the given registry failure, classifying an unknown repository or manifest (see
+// image.ErrImageNotFound).
+func registryError(err error, description string) error {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		notFound := transportErr.StatusCode == http.StatusNotFound
+		for _, diagnostic := range transportErr.Errors {
+			if diagnostic.Code == transport.ManifestUnknownErrorCode || diagnostic.Code == transport.NameUnknownErrorCode {
+				notFound = true
+			}
+		}
+		if notFound {
+			return image.NewProviderError(image.ErrImageNotFound, description, err)
+		}
+	}
+	return fmt.Errorf("%s: %w", description, err)
+}
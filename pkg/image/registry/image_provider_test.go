@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrRegistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// basicAuthHandler only allows requests with the given basic auth credentials through to the registry.
+func basicAuthHandler(username, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestImageProvider_Provide(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		options  Options
+		wantErr  bool
+	}{
+		{
+			name: "anonymous",
+		},
+		{
+			name:     "credentials",
+			username: "user",
+			password: "pass",
+			options: Options{
+				Credentials: []Credentials{{Username: "user", Password: "pass"}},
+			},
+		},
+		{
+			name:     "missing credentials",
+			username: "user",
+			password: "pass",
+			wantErr:  true,
+		},
+		{
+			name:     "wrong credentials",
+			username: "user",
+			password: "pass",
+			options: Options{
+				Credentials: []Credentials{{Username: "user", Password: "wrong"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := ggcrRegistry.New()
+			if test.username != "" {
+				handler = basicAuthHandler(test.username, test.password, handler)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("could not parse server url: %+v", err)
+			}
+			for idx := range test.options.Credentials {
+				test.options.Credentials[idx].Authority = u.Host
+			}
+
+			imgStr := u.Host + "/some/image:latest"
+			ref, err := name.ParseReference(imgStr)
+			if err != nil {
+				t.Fatalf("could not parse reference: %+v", err)
+			}
+
+			expected, err := random.Image(1024, 2)
+			if err != nil {
+				t.Fatalf("could not create image: %+v", err)
+			}
+			if err := remote.Write(ref, expected, remote.WithAuth(&authn.Basic{Username: test.username, Password: test.password})); err != nil {
+				t.Fatalf("could not push image: %+v", err)
+			}
+
+			tmpDirGen := file.NewTempDirGenerator()
+			defer tmpDirGen.Cleanup()
+
+			img, err := NewProviderFromRegistry(imgStr, &tmpDirGen, image.ProviderOptions{}, test.options).Provide(context.Background())
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not provide image: %+v", err)
+			}
+
+			if err := img.Read(); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			expectedDigest, err := expected.Digest()
+			if err != nil {
+				t.Fatalf("could not get digest: %+v", err)
+			}
+			if img.Metadata.ManifestDigest != expectedDigest.String() {
+				t.Errorf("unexpected manifest digest: %q != %q", img.Metadata.ManifestDigest, expectedDigest.String())
+			}
+			if len(img.Layers) != 2 {
+				t.Errorf("unexpected number of layers: %d", len(img.Layers))
+			}
+			if img.Metadata.Origin.Source != image.RegistrySource {
+				t.Errorf("unexpected origin source: %+v", img.Metadata.Origin.Source)
+			}
+			if img.Metadata.Origin.Location != ref.Name() {
+				t.Errorf("unexpected origin location: %q", img.Metadata.Origin.Location)
+			}
+			if len(img.Metadata.Tags) != 1 || img.Metadata.Tags[0].String() != ref.Name() {
+				t.Errorf("unexpected tags: %+v", img.Metadata.Tags)
+			}
+
+			// all layer blobs (and the manifest and config) are transferred from the registry
+			var blobsSize int64
+			layers, err := expected.Layers()
+			if err != nil {
+				t.Fatalf("could not get layers: %+v", err)
+			}
+			for _, layer := range layers {
+				size, err := layer.Size()
+				if err != nil {
+					t.Fatalf("could not get layer size: %+v", err)
+				}
+				blobsSize += size
+			}
+			if img.Metadata.BytesRead.Remote < blobsSize {
+				t.Errorf("unexpected remote bytes read: %d < %d", img.Metadata.BytesRead.Remote, blobsSize)
+			}
+		})
+	}
+}
+
+func TestImageProvider_Provide_NotFound(t *testing.T) {
+	server := httptest.NewServer(ggcrRegistry.New())
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse server url: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	_, err = NewProviderFromRegistry(u.Host+"/some/missing:latest", &tmpDirGen, image.ProviderOptions{}, Options{}).Provide(context.Background())
+	if !errors.Is(err, image.ErrImageNotFound) {
+		t.Errorf("expected an image not found error, got: %+v", err)
+	}
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) || transportErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the registry error to remain available, got: %+v", err)
+	}
+}
+
+func TestImageProvider_Provide_Retry(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   image.RetryPolicy
+		wantErr bool
+	}{
+		{
+			name:    "without retries",
+			wantErr: true,
+		},
+		{
+			name:  "with retries",
+			retry: image.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the registry rate limits the first two requests for each path
+			registryHandler := ggcrRegistry.New()
+			failures := make(map[string]int)
+			var failing bool
+			var lock sync.Mutex
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					lock.Lock()
+					failures[r.URL.Path]++
+					fail := failing && failures[r.URL.Path] <= 2
+					lock.Unlock()
+					if fail {
+						w.WriteHeader(http.StatusTooManyRequests)
+						return
+					}
+				}
+				registryHandler.ServeHTTP(w, r)
+			})
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("could not parse server url: %+v", err)
+			}
+			imgStr := u.Host + "/some/image:latest"
+			ref, err := name.ParseReference(imgStr)
+			if err != nil {
+				t.Fatalf("could not parse reference: %+v", err)
+			}
+
+			expected, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatalf("could not create image: %+v", err)
+			}
+			if err := remote.Write(ref, expected); err != nil {
+				t.Fatalf("could not push image: %+v", err)
+			}
+			// only requests while providing the image are made to fail
+			lock.Lock()
+			failing = true
+			failures = make(map[string]int)
+			lock.Unlock()
+
+			tmpDirGen := file.NewTempDirGenerator()
+			defer tmpDirGen.Cleanup()
+
+			img, err := NewProviderFromRegistry(imgStr, &tmpDirGen, image.ProviderOptions{Retry: test.retry}, Options{}).Provide(context.Background())
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not provide image: %+v", err)
+			}
+			if err := img.Read(); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+			if len(img.Layers) != 1 {
+				t.Errorf("unexpected number of layers: %d", len(img.Layers))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// IndexProvider provides a multi-platform image (an image index or manifest list) pulled directly from an OCI/Docker
+// registry, where the image for each platform is pulled by digest only once requested.
+type IndexProvider struct {
+	imageStr        string
+	options         image.ProviderOptions
+	registryOptions Options
+	tmpDirGen       *file.TempDirGenerator
+}
+
+// NewIndexProviderFromRegistry creates a new provider instance for the image index with the given reference (e.g.
+// "alpine:latest" or "registry.example.com/repo@sha256:...").
+func NewIndexProviderFromRegistry(imgStr string, tmpDirGen *file.TempDirGenerator, options image.ProviderOptions, registryOptions Options) *IndexProvider {
+	return &IndexProvider{
+		imageStr:        imgStr,
+		options:         options,
+		registryOptions: registryOptions,
+		tmpDirGen:       tmpDirGen,
+	}
+}
+
+// Provide an index object describing all image manifests within the image index. Only the index manifest is fetched
+// here, each image is pulled (and read with the given options) when requested from the index.
+func (p *IndexProvider) Provide(ctx context.Context, readOptions ...image.ReadOption) (*image.Index, error) {
+	ref, err := p.registryOptions.parseReference(p.imageStr)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, err := p.registryOptions.transport(p.options.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := remote.Index(ref,
+		remote.WithTransport(&contextTransport{inner: tr, ctx: ctx}),
+		p.registryOptions.authOption(ref.Context().Registry),
+	)
+	if err != nil {
+		return nil, registryError(err, "unable to fetch image index from registry")
+	}
+
+	// each image is referenced by digest within the same repository, so the index reference is not resolved again
+	imageProvider := func(digest string) image.Provider {
+		return NewProviderFromRegistry(ref.Context().Name()+"@"+digest, p.tmpDirGen, p.options, p.registryOptions)
+	}
+
+	return image.NewIndex(index, imageProvider, readOptions...)
+}
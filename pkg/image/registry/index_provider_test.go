@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrRegistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestIndexProvider_Provide(t *testing.T) {
+	server := httptest.NewServer(ggcrRegistry.New())
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse server url: %+v", err)
+	}
+
+	imgStr := u.Host + "/some/image:latest"
+	ref, err := name.ParseReference(imgStr)
+	if err != nil {
+		t.Fatalf("could not parse reference: %+v", err)
+	}
+
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}
+
+	var index v1.ImageIndex = empty.Index
+	var digests []v1.Hash
+	for _, platform := range platforms {
+		platform := platform
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("could not create image: %+v", err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("could not get image digest: %+v", err)
+		}
+		digests = append(digests, digest)
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &platform,
+			},
+		})
+	}
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatalf("could not push index: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	scope, err := tmpDirGen.NewScope()
+	if err != nil {
+		t.Fatalf("could not create temp dir scope: %+v", err)
+	}
+
+	subject, err := NewIndexProviderFromRegistry(imgStr, scope, image.ProviderOptions{}, Options{}).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide index: %+v", err)
+	}
+	subject.SetCleanup(scope.Cleanup)
+
+	if len(subject.Manifests) != len(platforms) {
+		t.Fatalf("unexpected number of manifests: %d", len(subject.Manifests))
+	}
+	if len(subject.Platforms()) != len(platforms) {
+		t.Errorf("unexpected platforms: %+v", subject.Platforms())
+	}
+
+	manifest := subject.Manifest(image.Platform{OS: "linux", Architecture: "arm64"})
+	if manifest == nil {
+		t.Fatalf("expected a manifest for linux/arm64")
+	}
+	if manifest.Digest != digests[1].String() {
+		t.Errorf("unexpected manifest digest: %q != %q", manifest.Digest, digests[1].String())
+	}
+
+	img, err := manifest.Image()
+	if err != nil {
+		t.Fatalf("could not get image: %+v", err)
+	}
+	if img.Metadata.ManifestDigest != digests[1].String() {
+		t.Errorf("unexpected image manifest digest: %q", img.Metadata.ManifestDigest)
+	}
+	if len(img.Layers) != 1 {
+		t.Errorf("unexpected number of layers: %d", len(img.Layers))
+	}
+
+	again, err := manifest.Image()
+	if err != nil {
+		t.Fatalf("could not get image again: %+v", err)
+	}
+	if again != img {
+		t.Errorf("expected the same image to be returned")
+	}
+
+	if subject.Manifest(image.Platform{OS: "windows", Architecture: "amd64"}) != nil {
+		t.Errorf("expected no manifest for windows/amd64")
+	}
+
+	dirs := scope.TempDirs()
+	if len(dirs) == 0 {
+		t.Fatalf("expected temp dirs for the image read from the index")
+	}
+	if err := subject.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup index: %+v", err)
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected temp dir=%q to be removed: %+v", dir, err)
+		}
+	}
+}
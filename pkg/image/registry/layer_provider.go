@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// LayerProvider provides a single layer blob pulled directly from an OCI/Docker registry by digest, without fetching
+// the manifest or config of any image the layer belongs to.
+type LayerProvider struct {
+	imageStr        string
+	layerDigest     string
+	registryOptions Options
+	retry           image.RetryPolicy
+	tmpDirGen       *file.TempDirGenerator
+}
+
+// NewLayerProviderFromRegistry creates a new provider instance for the layer blob with the given digest within the
+// repository of the given image reference (e.g. "alpine:latest", only the repository is considered).
+func NewLayerProviderFromRegistry(imgStr, layerDigest string, tmpDirGen *file.TempDirGenerator, registryOptions Options) *LayerProvider {
+	return &LayerProvider{
+		imageStr:        imgStr,
+		layerDigest:     layerDigest,
+		registryOptions: registryOptions,
+		tmpDirGen:       tmpDirGen,
+	}
+}
+
+// Provide a layer object with the layer tree and file catalog built for just the layer blob. The blob is fetched from
+// the registry while the layer is read.
+func (p *LayerProvider) Provide(ctx context.Context) (*image.Layer, error) {
+	if _, err := v1.NewHash(p.layerDigest); err != nil {
+		return nil, fmt.Errorf("invalid layer digest=%q: %w", p.layerDigest, err)
+	}
+
+	ref, err := p.registryOptions.parseReference(p.imageStr)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, err := p.registryOptions.transport(p.retry)
+	if err != nil {
+		return nil, err
+	}
+
+	digestRef, err := name.NewDigest(ref.Context().Name()+"@"+p.layerDigest, name.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reference layer=%q within repository=%q: %w", p.layerDigest, ref.Context().Name(), err)
+	}
+
+	layer, err := remote.Layer(digestRef,
+		remote.WithTransport(&contextTransport{inner: tr, ctx: ctx}),
+		p.registryOptions.authOption(ref.Context().Registry),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch layer from registry: %w", err)
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return image.ReadLayer(ctx, layer, contentTempDir)
+}
+
+// SetRetryPolicy determines how registry requests are retried upon transient failures (never by default).
+func (p *LayerProvider) SetRetryPolicy(policy image.RetryPolicy) {
+	p.retry = policy
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrRegistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestLayerProvider_Provide(t *testing.T) {
+	server := httptest.NewServer(ggcrRegistry.New())
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse server url: %+v", err)
+	}
+
+	imgStr := u.Host + "/some/image:latest"
+	ref, err := name.ParseReference(imgStr)
+	if err != nil {
+		t.Fatalf("could not parse reference: %+v", err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("could not push image: %+v", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("could not get layers: %+v", err)
+	}
+	digest, err := layers[1].Digest()
+	if err != nil {
+		t.Fatalf("could not get layer digest: %+v", err)
+	}
+	diffID, err := layers[1].DiffID()
+	if err != nil {
+		t.Fatalf("could not get layer diff ID: %+v", err)
+	}
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	layer, err := NewLayerProviderFromRegistry(imgStr, digest.String(), &tmpDirGen, Options{}).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide layer: %+v", err)
+	}
+
+	if layer.Metadata.Digest != diffID.String() {
+		t.Errorf("unexpected layer digest: %q != %q", layer.Metadata.Digest, diffID.String())
+	}
+	if len(layer.Tree.AllFiles()) == 0 {
+		t.Errorf("expected layer files")
+	}
+
+	if _, err := NewLayerProviderFromRegistry(imgStr, "not-a-digest", &tmpDirGen, Options{}).Provide(context.Background()); err == nil {
+		t.Errorf("expected an error for an invalid digest")
+	}
+}
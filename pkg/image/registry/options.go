@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Options tailors how images are pulled from a registry.
+type Options struct {
+	// Credentials are used for authenticating with specific registries. Registries without matching credentials are
+	// authenticated via the keychain, falling back to anonymous access.
+	Credentials []Credentials
+	// Keychain resolves credentials for registries without matching Credentials. When not provided the default
+	// keychain is used (the docker config file, e.g. ~/.docker/config.json, including credential helpers).
+	Keychain authn.Keychain
+	// InsecureSkipTLSVerify disables verification of the registry TLS certificate (e.g. self-signed certificates).
+	InsecureSkipTLSVerify bool
+	// InsecureUseHTTP allows falling back to plain HTTP for registries that do not serve HTTPS (registries on
+	// localhost or private networks already allow this).
+	InsecureUseHTTP bool
+	// CAFileOrDir is a PEM file (or a directory of PEM files) of additional certificate authorities to trust for the
+	// registry TLS certificate, on top of the system certificate authorities.
+	CAFileOrDir string
+}
+
+// Credentials are the authentication details for a single registry. Either a username and password or a (bearer)
+// token should be provided.
+type Credentials struct {
+	// Authority is the registry host (and optionally the port) these credentials are for (e.g. "docker.io" or
+	// "localhost:5000").
+	Authority string
+	Username  string
+	Password  string
+	Token     string
+}
+
+// authenticator returns the authenticator for the given registry (nil if there are no matching credentials).
+func (o Options) authenticator(registry name.Registry) authn.Authenticator {
+	for _, c := range o.Credentials {
+		// parsing the authority normalizes equivalent registry names (e.g. "docker.io" vs "index.docker.io")
+		authority, err := name.NewRegistry(c.Authority, name.WeakValidation)
+		if err != nil || authority.RegistryStr() != registry.RegistryStr() {
+			continue
+		}
+		if c.Token != "" {
+			return &authn.Bearer{Token: c.Token}
+		}
+		return &authn.Basic{Username: c.Username, Password: c.Password}
+	}
+	return nil
+}
+
+// keychain returns the keychain for registries without matching credentials (the default keychain when not provided).
+func (o Options) keychain() authn.Keychain {
+	if o.Keychain != nil {
+		return o.Keychain
+	}
+	return authn.DefaultKeychain
+}
+
+// resolveAuthenticator returns the authenticator for the given registry, falling back to the keychain when there are
+// no matching credentials.
+func (o Options) resolveAuthenticator(registry name.Registry) (authn.Authenticator, error) {
+	if auth := o.authenticator(registry); auth != nil {
+		return auth, nil
+	}
+	auth, err := o.keychain().Resolve(registry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve registry credentials: %w", err)
+	}
+	return auth, nil
+}
+
+// authOption selects the authentication to use for the given registry, falling back to the keychain when there are no
+// matching credentials.
+func (o Options) authOption(registry name.Registry) remote.Option {
+	if auth := o.authenticator(registry); auth != nil {
+		return remote.WithAuth(auth)
+	}
+	return remote.WithAuthFromKeychain(o.keychain())
+}
+
+// parseReference parses the given image reference, allowing plain HTTP for the registry if configured.
+func (o Options) parseReference(imgStr string) (name.Reference, error) {
+	nameOptions := []name.Option{name.WeakValidation}
+	if o.InsecureUseHTTP {
+		nameOptions = append(nameOptions, name.Insecure)
+	}
+	ref, err := name.ParseReference(imgStr, nameOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse registry reference=%q: %w", imgStr, err)
+	}
+	return ref, nil
+}
+
+// transport returns the HTTP transport for registry requests, configured with the TLS options (the default transport
+// when there are none) and retrying transient failures per the given policy.
+func (o Options) transport(retry image.RetryPolicy) (http.RoundTripper, error) {
+	tr, err := o.tlsTransport()
+	if err != nil {
+		return nil, err
+	}
+	if !retry.Retries() {
+		return tr, nil
+	}
+	return &retryTransport{inner: tr, policy: retry}, nil
+}
+
+// tlsTransport returns the HTTP transport configured with the TLS options (the default transport when there are none).
+func (o Options) tlsTransport() (http.RoundTripper, error) {
+	if !o.InsecureSkipTLSVerify && o.CAFileOrDir == "" {
+		return http.DefaultTransport, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipTLSVerify,
+	}
+
+	if o.CAFileOrDir != "" {
+		rootCAs, err := o.rootCAs()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unable to configure registry TLS: unexpected default transport=%T", http.DefaultTransport)
+	}
+	tr := defaultTransport.Clone()
+	tr.TLSClientConfig = tlsConfig
+	return tr, nil
+}
+
+// rootCAs returns the system certificate authorities along with all certificate authorities within CAFileOrDir.
+func (o Options) rootCAs() (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	info, err := os.Stat(o.CAFileOrDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registry CA=%q: %w", o.CAFileOrDir, err)
+	}
+
+	paths := []string{o.CAFileOrDir}
+	if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(o.CAFileOrDir, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read registry CA dir=%q: %w", o.CAFileOrDir, err)
+		}
+	}
+
+	var found bool
+	for _, p := range paths {
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			continue
+		}
+		pem, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read registry CA=%q: %w", p, err)
+		}
+		if pool.AppendCertsFromPEM(pem) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no certificates found within registry CA=%q", o.CAFileOrDir)
+	}
+	return pool, nil
+}
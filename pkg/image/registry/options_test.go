@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// staticKeychain resolves the same authenticator for all registries.
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.auth, nil
+}
+
+func TestOptions_transport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "stereoscope-registry-ca")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	caPath := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caPath, caPEM, 0600); err != nil {
+		t.Fatalf("could not write CA: %+v", err)
+	}
+	emptyPath := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(emptyPath, nil, 0600); err != nil {
+		t.Fatalf("could not write CA: %+v", err)
+	}
+
+	tests := []struct {
+		name       string
+		options    Options
+		wantErr    bool
+		wantReqErr bool
+	}{
+		{
+			name:       "default transport does not trust the server",
+			wantReqErr: true,
+		},
+		{
+			name:    "skip TLS verify",
+			options: Options{InsecureSkipTLSVerify: true},
+		},
+		{
+			name:    "CA file",
+			options: Options{CAFileOrDir: caPath},
+		},
+		{
+			name:    "CA dir",
+			options: Options{CAFileOrDir: dir},
+		},
+		{
+			name:    "CA file without certificates",
+			options: Options{CAFileOrDir: emptyPath},
+			wantErr: true,
+		},
+		{
+			name:    "missing CA file",
+			options: Options{CAFileOrDir: filepath.Join(dir, "missing.pem")},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr, err := test.options.transport(image.RetryPolicy{})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not create transport: %+v", err)
+			}
+
+			resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+			if test.wantReqErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected a request error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not make request: %+v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestOptions_parseReference(t *testing.T) {
+	ref, err := Options{}.parseReference("registry.example.com/some/image:latest")
+	if err != nil {
+		t.Fatalf("could not parse reference: %+v", err)
+	}
+	if scheme := ref.Context().Registry.Scheme(); scheme != "https" {
+		t.Errorf("unexpected scheme: %q", scheme)
+	}
+
+	ref, err = Options{InsecureUseHTTP: true}.parseReference("registry.example.com/some/image:latest")
+	if err != nil {
+		t.Fatalf("could not parse reference: %+v", err)
+	}
+	if scheme := ref.Context().Registry.Scheme(); scheme != "http" {
+		t.Errorf("unexpected scheme: %q", scheme)
+	}
+}
+
+func TestOptions_resolveAuthenticator(t *testing.T) {
+	registry, err := name.NewRegistry("registry.example.com")
+	if err != nil {
+		t.Fatalf("could not parse registry: %+v", err)
+	}
+	keychainAuth := &authn.Bearer{Token: "from-keychain"}
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected authn.Authenticator
+	}{
+		{
+			name: "matching credentials",
+			options: Options{
+				Credentials: []Credentials{{Authority: "registry.example.com", Token: "explicit"}},
+				Keychain:    staticKeychain{auth: keychainAuth},
+			},
+			expected: &authn.Bearer{Token: "explicit"},
+		},
+		{
+			name: "keychain for other registries",
+			options: Options{
+				Credentials: []Credentials{{Authority: "other.example.com", Token: "explicit"}},
+				Keychain:    staticKeychain{auth: keychainAuth},
+			},
+			expected: keychainAuth,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := test.options.resolveAuthenticator(registry)
+			if err != nil {
+				t.Fatalf("could not resolve authenticator: %+v", err)
+			}
+			actual, ok := auth.(*authn.Bearer)
+			if !ok || *actual != *test.expected.(*authn.Bearer) {
+				t.Errorf("unexpected authenticator: %+v", auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// blobRangeFetcher fetches ranges of layer blobs from the repository of an image with HTTP range requests (see
+// image.WithSeekableLayers). The authenticated transport is only created upon the first fetch.
+type blobRangeFetcher struct {
+	repo            name.Repository
+	registryOptions Options
+	retry           image.RetryPolicy
+	bytesRead       *image.ByteCounter
+
+	lock      sync.Mutex
+	transport http.RoundTripper
+}
+
+// forLayer returns the image.BlobRangeFetcher for the blob of the given layer (nil if the blob digest is unknown).
+func (f *blobRangeFetcher) forLayer(layer v1.Layer) image.BlobRangeFetcher {
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil
+	}
+	return func(ctx context.Context, offset, size int64) (io.ReadCloser, error) {
+		return f.fetch(ctx, digest, offset, size)
+	}
+}
+
+// fetch requests (at most) size bytes of the given blob starting at the given offset. Registries that do not support
+// range requests respond with the entire blob, which is then skipped up to the offset.
+func (f *blobRangeFetcher) fetch(ctx context.Context, digest v1.Hash, offset, size int64) (io.ReadCloser, error) {
+	rt, err := f.roundTripper()
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s://%s/v2/%s/blobs/%s", f.repo.Registry.Scheme(), f.repo.RegistryStr(), f.repo.RepositoryStr(), digest)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch blob=%q range: %w", digest, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		return newBodyExtent(resp.Body, offset, size)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to fetch blob=%q range: unexpected status=%q", digest, resp.Status)
+	}
+}
+
+// roundTripper returns the transport authenticated for pulling from the repository (created once).
+func (f *blobRangeFetcher) roundTripper() (http.RoundTripper, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.transport != nil {
+		return f.transport, nil
+	}
+
+	auth, err := f.registryOptions.resolveAuthenticator(f.repo.Registry)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := f.registryOptions.transport(f.retry)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := transport.New(f.repo.Registry, auth, &countingTransport{inner: inner, counter: f.bytesRead}, []string{f.repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create registry transport: %w", err)
+	}
+	f.transport = rt
+	return rt, nil
+}
+
+// newBodyExtent provides a single extent of an entire blob response body by discarding all content before the offset.
+func newBodyExtent(body io.ReadCloser, offset, size int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(ioutil.Discard, body, offset); err != nil {
+		body.Close()
+		return nil, fmt.Errorf("unable to seek to offset=%d: %w", offset, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(body, size), body}, nil
+}
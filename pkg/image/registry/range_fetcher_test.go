@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrRegistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestBlobRangeFetcher(t *testing.T) {
+	server := httptest.NewServer(ggcrRegistry.New())
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse server url: %+v", err)
+	}
+
+	ref, err := name.ParseReference(u.Host + "/some/image:latest")
+	if err != nil {
+		t.Fatalf("could not parse reference: %+v", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("could not push image: %+v", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("could not get layers: %+v", err)
+	}
+	compressed, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("could not get compressed layer: %+v", err)
+	}
+	blob, err := ioutil.ReadAll(compressed)
+	if err != nil {
+		t.Fatalf("could not read compressed layer: %+v", err)
+	}
+
+	bytesRead := image.NewByteCounter()
+	fetcher := &blobRangeFetcher{repo: ref.Context(), bytesRead: bytesRead}
+	fetch := fetcher.forLayer(layers[0])
+	if fetch == nil {
+		t.Fatalf("expected a range fetcher for the layer")
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		size   int64
+	}{
+		{
+			name: "start of blob",
+			size: 10,
+		},
+		{
+			name:   "middle of blob",
+			offset: 100,
+			size:   200,
+		},
+		{
+			name:   "end of blob",
+			offset: int64(len(blob)) - 51,
+			size:   51,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := fetch(context.Background(), test.offset, test.size)
+			if err != nil {
+				t.Fatalf("could not fetch range: %+v", err)
+			}
+			defer reader.Close()
+
+			contents, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("could not read range: %+v", err)
+			}
+			if string(contents) != string(blob[test.offset:test.offset+test.size]) {
+				t.Errorf("unexpected range contents (%d bytes)", len(contents))
+			}
+		})
+	}
+
+	if bytesRead.BytesRead().Remote == 0 {
+		t.Errorf("expected fetched ranges to be recorded as remote bytes read")
+	}
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// retryTransport retries registry requests that fail transiently (rate limiting, server errors, or network failures)
+// per the retry policy, waiting at least as long as requested by a Retry-After header. Only requests without a body are
+// retried, and only until the response is received (reading the response body is never retried).
+type retryTransport struct {
+	inner  http.RoundTripper
+	policy image.RetryPolicy
+}
+
+// transientStatusError is a response with a status that may not recur (e.g. 429 or 503).
+type transientStatusError struct {
+	resp *http.Response
+}
+
+func (e *transientStatusError) Error() string {
+	return fmt.Sprintf("unexpected status=%q", e.resp.Status)
+}
+
+// RetryAfter is the delay requested by the Retry-After header of a 429 or 503 response (see image.RetryAfterError).
+func (e *transientStatusError) RetryAfter() time.Duration {
+	switch e.resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return parseRetryAfter(e.resp.Header.Get("Retry-After"), time.Now())
+	}
+	return 0
+}
+
+// parseRetryAfter returns the delay for the given Retry-After header value, either in seconds or as an HTTP date
+// (relative to the given time). Zero is returned for a missing or invalid value.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		switch {
+		case seconds <= 0:
+			return 0
+		case seconds > int64(math.MaxInt64/time.Second):
+			// the delay is capped by the retry policy regardless
+			return math.MaxInt64
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		return t.inner.RoundTrip(req)
+	}
+
+	var resp *http.Response
+	err := t.policy.Do(req.Context(), registryOperation(req), isTransientRegistryError, func() error {
+		if resp != nil {
+			// discard the response of the previous attempt
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		var err error
+		resp, err = t.inner.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		if isTransientStatus(resp.StatusCode) {
+			return &transientStatusError{resp: resp}
+		}
+		return nil
+	})
+
+	var statusErr *transientStatusError
+	if errors.As(err, &statusErr) {
+		// there are no attempts left, the response is handled as if there were no retries
+		return statusErr.resp, nil
+	}
+	return resp, err
+}
+
+// registryOperation is the retry operation for the given registry request (see the registry API, e.g.
+// "/v2/<name>/manifests/<reference>").
+func registryOperation(req *http.Request) image.RetryOperation {
+	switch {
+	case strings.Contains(req.URL.Path, "/manifests/"):
+		return image.RetryRegistryManifest
+	case strings.Contains(req.URL.Path, "/blobs/"):
+		return image.RetryRegistryBlob
+	}
+	return image.RetryRegistryOther
+}
+
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isTransientRegistryError(err error) bool {
+	var statusErr *transientStatusError
+	return errors.As(err, &statusErr) || image.IsTransientNetworkError(err)
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "120", expected: 2 * time.Minute},
+		{value: " 3 ", expected: 3 * time.Second},
+		{value: "0", expected: 0},
+		{value: "-1", expected: 0},
+		{value: "Sat, 01 Aug 2020 12:00:30 GMT", expected: 30 * time.Second},
+		{value: "Sat, 01 Aug 2020 11:00:00 GMT", expected: 0},
+		{value: "soon", expected: 0},
+	}
+	for _, test := range tests {
+		if actual := parseRetryAfter(test.value, now); actual != test.expected {
+			t.Errorf("unexpected delay for value=%q: %s != %s", test.value, actual, test.expected)
+		}
+	}
+}
+
+func TestTransientStatusError_RetryAfter(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected time.Duration
+	}{
+		{status: http.StatusTooManyRequests, expected: 2 * time.Second},
+		{status: http.StatusServiceUnavailable, expected: 2 * time.Second},
+		// the header is only meaningful for rate limiting and unavailability
+		{status: http.StatusBadGateway, expected: 0},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: http.Header{"Retry-After": []string{"2"}}}
+		var err image.RetryAfterError = &transientStatusError{resp: resp}
+		if actual := err.RetryAfter(); actual != test.expected {
+			t.Errorf("unexpected delay for status=%d: %s != %s", test.status, actual, test.expected)
+		}
+	}
+}
+
+func TestRetryTransport_HonorsRetryAfter(t *testing.T) {
+	var requests []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		if len(requests) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// the requested delay (1s) is capped by the max backoff
+	transport := &retryTransport{
+		inner:  http.DefaultTransport,
+		policy: image.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: 200 * time.Millisecond},
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %+v", err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("could not make request: %+v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(requests) != 2 {
+		t.Fatalf("expected a single retry: status=%d requests=%d", resp.StatusCode, len(requests))
+	}
+	if delay := requests[1].Sub(requests[0]); delay < 200*time.Millisecond || delay >= time.Second {
+		t.Errorf("expected the retry after the capped requested delay, got %s", delay)
+	}
+}
@@ -0,0 +1,166 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+const (
+	// DefaultRetryBackoff is the delay before the second attempt of an operation (when not configured).
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// DefaultMaxRetryBackoff caps the delay between attempts of an operation (when not configured).
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// RetryOperation identifies a daemon or registry operation that may be retried (each with its own attempts).
+type RetryOperation string
+
+const (
+	// RetryDaemonInspect is inspecting an image with the daemon (docker or podman).
+	RetryDaemonInspect RetryOperation = "daemon-inspect"
+	// RetryDaemonPull is pulling an image with the daemon (docker or podman).
+	RetryDaemonPull RetryOperation = "daemon-pull"
+	// RetryDaemonSave is saving an image from the daemon (docker or podman) to a tar.
+	RetryDaemonSave RetryOperation = "daemon-save"
+	// RetryRegistryManifest is a registry request for a manifest (or index).
+	RetryRegistryManifest RetryOperation = "registry-manifest"
+	// RetryRegistryBlob is a registry request for a blob (e.g. a config or layer). Note: only establishing the
+	// response is retried, not reading the response body.
+	RetryRegistryBlob RetryOperation = "registry-blob"
+	// RetryRegistryOther is any other registry request (e.g. for a token).
+	RetryRegistryOther RetryOperation = "registry-other"
+)
+
+// RetryPolicy determines how daemon and registry operations are retried upon transient failures (e.g. a busy daemon,
+// registry rate limiting and server errors, or network resets), with exponential backoff between attempts. The zero
+// value never retries.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts for each operation, including the first (one or less never retries).
+	MaxAttempts int
+	// OperationAttempts overrides MaxAttempts for specific operations.
+	OperationAttempts map[RetryOperation]int
+	// Backoff is the delay before the second attempt, which doubles for each attempt after (DefaultRetryBackoff when
+	// not provided).
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts (DefaultMaxRetryBackoff when not provided), including any delay
+	// requested by the source of the failure (e.g. a Retry-After header, see RetryAfterError).
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy makes up to three attempts of each operation with the default backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+	}
+}
+
+// Attempts returns the number of attempts for the given operation (at least one).
+func (p RetryPolicy) Attempts(operation RetryOperation) int {
+	attempts := p.MaxAttempts
+	if override, ok := p.OperationAttempts[operation]; ok {
+		attempts = override
+	}
+	if attempts < 1 {
+		return 1
+	}
+	return attempts
+}
+
+// Retries indicates if any operation may be attempted more than once.
+func (p RetryPolicy) Retries() bool {
+	if p.MaxAttempts > 1 {
+		return true
+	}
+	for _, attempts := range p.OperationAttempts {
+		if attempts > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfterError is a transient error that indicates how long to wait before the next attempt (e.g. a registry
+// response with a Retry-After header).
+type RetryAfterError interface {
+	error
+	// RetryAfter is the delay requested before the next attempt (zero when none was requested).
+	RetryAfter() time.Duration
+}
+
+// maxBackoff caps the delay between attempts.
+func (p RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return DefaultMaxRetryBackoff
+	}
+	return p.MaxBackoff
+}
+
+// retryDelay is the delay after the given (failed) attempt, which is at least the delay requested by the error (see
+// RetryAfterError), still capped by the max backoff.
+func (p RetryPolicy) retryDelay(attempt int, err error) time.Duration {
+	delay := p.backoff(attempt)
+	var retryAfter RetryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.RetryAfter() > delay {
+		delay = retryAfter.RetryAfter()
+		if maxDelay := p.maxBackoff(); delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+	return delay
+}
+
+// backoff is the delay after the given (failed) attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay, maxDelay := p.Backoff, p.maxBackoff()
+	if delay <= 0 {
+		delay = DefaultRetryBackoff
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// Do calls the given function until it succeeds, fails with an error that is not transient (per the given function),
+// or the attempts for the operation are exhausted, returning the last error. Retries are abandoned when the context
+// is cancelled.
+func (p RetryPolicy) Do(ctx context.Context, operation RetryOperation, isTransient func(error) bool, fn func() error) error {
+	attempts := p.Attempts(operation)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return err
+		}
+
+		delay := p.retryDelay(attempt, err)
+		log.Debugf("retrying %s in %s (attempt %d of %d): %+v", operation, delay, attempt+1, attempts, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// IsTransientNetworkError indicates if the given error is from a network failure that may not recur (e.g. a reset
+// connection or a timeout).
+func IsTransientNetworkError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
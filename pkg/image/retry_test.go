@@ -0,0 +1,170 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+var errTransient = fmt.Errorf("transient")
+
+func isTestTransient(err error) bool {
+	return err == errTransient
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           RetryPolicy
+		operation        RetryOperation
+		failures         []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{
+			name:             "zero value never retries",
+			failures:         []error{errTransient},
+			expectedAttempts: 1,
+			expectedErr:      errTransient,
+		},
+		{
+			name:             "succeeds after transient failures",
+			policy:           RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			failures:         []error{errTransient, errTransient},
+			expectedAttempts: 3,
+		},
+		{
+			name:             "attempts exhausted",
+			policy:           RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			failures:         []error{errTransient, errTransient, errTransient},
+			expectedAttempts: 2,
+			expectedErr:      errTransient,
+		},
+		{
+			name:             "not transient",
+			policy:           RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			failures:         []error{io.EOF},
+			expectedAttempts: 1,
+			expectedErr:      io.EOF,
+		},
+		{
+			name: "operation override",
+			policy: RetryPolicy{
+				MaxAttempts:       5,
+				OperationAttempts: map[RetryOperation]int{RetryDaemonSave: 2},
+				Backoff:           time.Millisecond,
+			},
+			operation:        RetryDaemonSave,
+			failures:         []error{errTransient, errTransient, errTransient},
+			expectedAttempts: 2,
+			expectedErr:      errTransient,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := test.operation
+			if operation == "" {
+				operation = RetryDaemonPull
+			}
+
+			var attempts int
+			err := test.policy.Do(context.Background(), operation, isTestTransient, func() error {
+				attempts++
+				if attempts <= len(test.failures) {
+					return test.failures[attempts-1]
+				}
+				return nil
+			})
+			if err != test.expectedErr {
+				t.Errorf("unexpected error: %+v", err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("unexpected attempts: %d != %d", attempts, test.expectedAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var attempts int
+	err := RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}.Do(ctx, RetryDaemonPull, isTestTransient, func() error {
+		attempts++
+		return errTransient
+	})
+	if err != errTransient || attempts != 1 {
+		t.Errorf("expected no retries once cancelled: attempts=%d err=%+v", attempts, err)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for idx, delay := range expected {
+		if actual := policy.backoff(idx + 1); actual != delay {
+			t.Errorf("unexpected backoff after attempt=%d: %s != %s", idx+1, actual, delay)
+		}
+	}
+
+	if actual := (RetryPolicy{}).backoff(1); actual != DefaultRetryBackoff {
+		t.Errorf("unexpected default backoff: %s", actual)
+	}
+}
+
+// retryAfterErr is a transient error that requests a delay before the next attempt.
+type retryAfterErr time.Duration
+
+func (e retryAfterErr) Error() string {
+	return "retry later"
+}
+
+func (e retryAfterErr) RetryAfter() time.Duration {
+	return time.Duration(e)
+}
+
+func TestRetryPolicy_retryDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		name     string
+		attempt  int
+		err      error
+		expected time.Duration
+	}{
+		{
+			name:     "backoff without a requested delay",
+			attempt:  2,
+			err:      errTransient,
+			expected: 2 * time.Second,
+		},
+		{
+			name:     "requested delay beyond the backoff",
+			attempt:  1,
+			err:      retryAfterErr(5 * time.Second),
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "requested delay within the backoff",
+			attempt:  3,
+			err:      fmt.Errorf("wrapped: %w", retryAfterErr(time.Second)),
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "requested delay is capped",
+			attempt:  1,
+			err:      retryAfterErr(time.Hour),
+			expected: 10 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := policy.retryDelay(test.attempt, test.err); actual != test.expected {
+				t.Errorf("unexpected delay: %s != %s", actual, test.expected)
+			}
+		})
+	}
+}
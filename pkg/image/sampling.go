@@ -0,0 +1,172 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+const (
+	// SampleUniformly samples from all regular files at once (the default).
+	SampleUniformly SampleStrata = iota
+	// SampleByDirectory samples from each parent directory proportionally to the number of files within it (each
+	// directory is represented at least once while the sample size allows).
+	SampleByDirectory
+	// SampleByExtension samples from each file extension proportionally to the number of files with it (files without an
+	// extension are a single stratum).
+	SampleByExtension
+)
+
+// SampleStrata is how files are grouped before sampling (see SampleOptions).
+type SampleStrata uint8
+
+// SampleOptions tailors how files are sampled from the squashed tree (see Image.SampleFilesFromSquash).
+type SampleOptions struct {
+	// Seed determines which files are sampled: the same seed yields the same sample for the same image.
+	Seed int64
+	// Strata is how files are grouped before sampling.
+	Strata SampleStrata
+}
+
+// sampleCandidate is a regular file within the squashed tree that may be sampled.
+type sampleCandidate struct {
+	path file.Path
+	ref  file.Reference
+}
+
+// SampleFilesFromSquash returns a deterministic pseudo-random sample of (at most) n regular files from the squashed
+// tree, sorted by path. The same image, sample size, and options always yield the same sample, which allows heuristic
+// classifiers to run on a bounded subset of very large images reproducibly. All regular files are returned when there
+// are no more than n.
+func (i *Image) SampleFilesFromSquash(n int, options SampleOptions) ([]file.Reference, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid sample size=%d", n)
+	}
+
+	// note: the walk is in a stable path order, so the candidates (and the strata) are the same for every call
+	var strata = make(map[string][]sampleCandidate)
+	var keys []string
+	err := i.SquashedWalk(func(p file.Path, ref file.Reference, metadata file.Metadata, _ file.OpenerFn) error {
+		if metadata.TypeFlag != tar.TypeReg && metadata.TypeFlag != tar.TypeRegA {
+			return nil
+		}
+		key := sampleStratum(p, options.Strata)
+		if _, ok := strata[key]; !ok {
+			keys = append(keys, key)
+		}
+		strata[key] = append(strata[key], sampleCandidate{path: p, ref: ref})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	rng := rand.New(rand.NewSource(options.Seed))
+	var sampled []sampleCandidate
+	for idx, size := range sampleAllocation(keys, strata, n) {
+		candidates := strata[keys[idx]]
+		for _, candidateIdx := range rng.Perm(len(candidates))[:size] {
+			sampled = append(sampled, candidates[candidateIdx])
+		}
+	}
+
+	sort.Slice(sampled, func(a, b int) bool {
+		return sampled[a].path < sampled[b].path
+	})
+	var refs = make([]file.Reference, len(sampled))
+	for idx, candidate := range sampled {
+		refs[idx] = candidate.ref
+	}
+	return refs, nil
+}
+
+// sampleStratum returns the group of the given path for the given strata.
+func sampleStratum(p file.Path, strata SampleStrata) string {
+	switch strata {
+	case SampleByDirectory:
+		return path.Dir(string(p))
+	case SampleByExtension:
+		return path.Ext(string(p))
+	default:
+		return ""
+	}
+}
+
+// sampleAllocation divides the sample size across all strata (in key order): each stratum is first represented once
+// (in order of size, while the sample size allows), then the remainder is divided proportionally to the number of
+// files within each stratum (largest remainders first).
+func sampleAllocation(keys []string, strata map[string][]sampleCandidate, n int) []int {
+	var allocation = make([]int, len(keys))
+	var total int
+	for _, key := range keys {
+		total += len(strata[key])
+	}
+	if total <= n {
+		for idx, key := range keys {
+			allocation[idx] = len(strata[key])
+		}
+		return allocation
+	}
+
+	// strata ordered by size (largest first, ties in key order)
+	var order = make([]int, len(keys))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(strata[keys[order[a]]]) > len(strata[keys[order[b]]])
+	})
+
+	remaining := n
+	for _, idx := range order {
+		if remaining == 0 {
+			return allocation
+		}
+		allocation[idx] = 1
+		remaining--
+	}
+
+	type share struct {
+		idx       int
+		remainder float64
+	}
+	var shares []share
+	budget := remaining
+	for _, idx := range order {
+		available := len(strata[keys[idx]]) - allocation[idx]
+		exact := float64(budget) * float64(len(strata[keys[idx]])) / float64(total)
+		whole := int(exact)
+		if whole > available {
+			whole = available
+		}
+		allocation[idx] += whole
+		remaining -= whole
+		shares = append(shares, share{idx: idx, remainder: exact - float64(whole)})
+	}
+
+	sort.SliceStable(shares, func(a, b int) bool {
+		return shares[a].remainder > shares[b].remainder
+	})
+	for remaining > 0 {
+		progressed := false
+		for _, s := range shares {
+			if remaining == 0 {
+				break
+			}
+			if allocation[s.idx] < len(strata[keys[s.idx]]) {
+				allocation[s.idx]++
+				remaining--
+				progressed = true
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+	return allocation
+}
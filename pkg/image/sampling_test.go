@@ -0,0 +1,149 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// samplingImage creates an image with many regular files across a few directories and extensions (along with entries
+// that are never sampled).
+func samplingImage(t *testing.T) *Image {
+	t.Helper()
+	headers := []tar.Header{
+		{Typeflag: tar.TypeDir, Name: "big/"},
+		{Typeflag: tar.TypeSymlink, Name: "big/link", Linkname: "/big/file-0.txt"},
+	}
+	for idx := 0; idx < 40; idx++ {
+		headers = append(headers, tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("big/file-%d.txt", idx)})
+	}
+	for idx := 0; idx < 5; idx++ {
+		headers = append(headers, tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("small/file-%d.so", idx)})
+	}
+	headers = append(headers, tar.Header{Typeflag: tar.TypeReg, Name: "lonely/README"})
+
+	img := newTestImage(t, []v1.Layer{newTestLayer(t, nil, headers...)})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func samplePaths(refs []file.Reference) []string {
+	var paths []string
+	for _, ref := range refs {
+		paths = append(paths, string(ref.RealPath))
+	}
+	return paths
+}
+
+func TestImage_SampleFilesFromSquash(t *testing.T) {
+	img := samplingImage(t)
+
+	tests := []struct {
+		name     string
+		n        int
+		options  SampleOptions
+		expected int
+		stratum  func(p string) string
+	}{
+		{
+			name:     "uniform",
+			n:        10,
+			expected: 10,
+		},
+		{
+			name:     "by directory",
+			n:        6,
+			options:  SampleOptions{Strata: SampleByDirectory},
+			expected: 6,
+			stratum:  path.Dir,
+		},
+		{
+			name:     "by extension",
+			n:        6,
+			options:  SampleOptions{Strata: SampleByExtension, Seed: 7},
+			expected: 6,
+			stratum:  path.Ext,
+		},
+		{
+			name:     "more than all files",
+			n:        100,
+			expected: 46,
+		},
+		{
+			name: "empty sample",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			refs, err := img.SampleFilesFromSquash(test.n, test.options)
+			if err != nil {
+				t.Fatalf("could not sample: %+v", err)
+			}
+			paths := samplePaths(refs)
+			if len(paths) != test.expected {
+				t.Fatalf("unexpected sample size: %d != %d (%+v)", len(paths), test.expected, paths)
+			}
+			if !sort.StringsAreSorted(paths) {
+				t.Errorf("expected sorted paths: %+v", paths)
+			}
+
+			seen := make(map[string]bool)
+			for _, p := range paths {
+				if seen[p] {
+					t.Errorf("duplicate sampled path: %q", p)
+				}
+				seen[p] = true
+				if p == "/big/link" || p == "/big" {
+					t.Errorf("unexpected non-regular file sampled: %q", p)
+				}
+			}
+
+			again, err := img.SampleFilesFromSquash(test.n, test.options)
+			if err != nil {
+				t.Fatalf("could not sample: %+v", err)
+			}
+			if !reflect.DeepEqual(paths, samplePaths(again)) {
+				t.Errorf("expected a deterministic sample: %+v != %+v", paths, samplePaths(again))
+			}
+
+			if test.stratum != nil {
+				strata := make(map[string]bool)
+				for _, p := range paths {
+					strata[test.stratum(p)] = true
+				}
+				if len(strata) != 3 {
+					t.Errorf("expected every stratum to be sampled: %+v", paths)
+				}
+			}
+		})
+	}
+}
+
+func TestImage_SampleFilesFromSquash_Seed(t *testing.T) {
+	img := samplingImage(t)
+
+	first, err := img.SampleFilesFromSquash(10, SampleOptions{Seed: 1})
+	if err != nil {
+		t.Fatalf("could not sample: %+v", err)
+	}
+	second, err := img.SampleFilesFromSquash(10, SampleOptions{Seed: 2})
+	if err != nil {
+		t.Fatalf("could not sample: %+v", err)
+	}
+	if reflect.DeepEqual(samplePaths(first), samplePaths(second)) {
+		t.Errorf("expected different seeds to yield different samples: %+v", samplePaths(first))
+	}
+
+	if _, err := img.SampleFilesFromSquash(-1, SampleOptions{}); err == nil {
+		t.Errorf("expected an error for a negative sample size")
+	}
+}
@@ -0,0 +1,286 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// SeekableContents provides random access to the contents of a single file (e.g. to parse ELF headers or a zip central
+// directory without reading the entire file). ReadAt calls are safe for concurrent use (also alongside Read and Seek
+// calls) and do not affect the offset for Read and Seek calls, while Read and Seek calls are not safe for concurrent use
+// (since they share the offset).
+type SeekableContents interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	// Size is the size of the contents in bytes.
+	Size() int64
+}
+
+// OpenSeekableByID provides random access to the contents of the file reference with the given ID (see OpenByID).
+// Contents that are cached within the contents cache dir (or that are small enough to be held in memory) are read by
+// range directly, otherwise the contents are cached first (so no more than the requested ranges are read afterwards).
+// When contents are streamed (see WithStreamingLayers) reads forward continue from an already opened source, while the
+// layer tar is read again for every read backwards.
+func (c *FileCatalog) OpenSeekableByID(id file.ID) (SeekableContents, error) {
+	return c.OpenSeekableByIDWithContext(context.Background(), id)
+}
+
+// OpenSeekableByIDWithContext is the same as OpenSeekableByID, however, reading the layer tar is aborted once the given
+// context is done.
+func (c *FileCatalog) OpenSeekableByIDWithContext(ctx context.Context, id file.ID) (SeekableContents, error) {
+	entry, err := c.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: id=%d", ErrFileNotFound, id)
+	}
+	entry, err = c.resolveHardlink(entry)
+	if err != nil {
+		return nil, err
+	}
+	size := entry.Metadata.Size
+
+	if p, ok := c.cachedContentsPath(entry.File.ID()); ok {
+		return newSeekableContents(size, func(offset int64) (io.ReadCloser, error) {
+			return newExtentFromFile(p, offset, size-offset)
+		}), nil
+	}
+
+	if size <= cacheFileSizeThreshold || !c.streamContents {
+		// the contents are either held in memory or cached within the contents cache dir once read
+		reader, err := c.OpenByIDWithContext(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := c.cachedContentsPath(entry.File.ID()); ok {
+			reader.Close()
+			return newSeekableContents(size, func(offset int64) (io.ReadCloser, error) {
+				return newExtentFromFile(p, offset, size-offset)
+			}), nil
+		}
+		if size <= cacheFileSizeThreshold {
+			contents, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				return nil, err
+			}
+			return newSeekableContents(size, func(offset int64) (io.ReadCloser, error) {
+				if offset > int64(len(contents)) {
+					offset = int64(len(contents))
+				}
+				return ioutil.NopCloser(bytes.NewReader(contents[offset:])), nil
+			}), nil
+		}
+		// the contents could not be cached (e.g. a vetoed temp write), so these are streamed instead
+		reader.Close()
+	}
+
+	return newStreamedSeekableContents(size, func(offset int64) (io.ReadCloser, error) {
+		reader, err := c.openTarEntry(ctx, *entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("unable to seek to offset=%d: %w", offset, err)
+		}
+		return reader, nil
+	}), nil
+}
+
+// maxIdleSources is the number of opened sources kept by seekableContents for later reads (e.g. one per concurrent
+// sequential reader).
+const maxIdleSources = 4
+
+// seekableContents provides random access to contents that can be opened at any offset, where a source is only opened
+// upon the first read and reused by later reads that continue where it left off. Concurrent ReadAt calls each use
+// their own source.
+type seekableContents struct {
+	size int64
+	// open provides the contents starting at the given offset (which is always within the contents)
+	open func(offset int64) (io.ReadCloser, error)
+	// streamed indicates that opening a source reads the contents from the start (e.g. the layer tar is streamed), so a
+	// source before the offset is read forward instead of opening another source
+	streamed bool
+	// offset is the offset for the next Read call (Read and Seek calls are not safe for concurrent use)
+	offset int64
+
+	// lock guards the idle sources (shared by Read and ReadAt calls)
+	lock sync.Mutex
+	// idle are the opened sources that are not being read from
+	idle []*seekableSource
+	// closed indicates that Close has been called, so any source returned afterwards is closed
+	closed bool
+}
+
+// seekableSource is an opened source along with the offset of the next byte read from it.
+type seekableSource struct {
+	io.ReadCloser
+	offset int64
+}
+
+func newSeekableContents(size int64, open func(offset int64) (io.ReadCloser, error)) *seekableContents {
+	return &seekableContents{
+		size: size,
+		open: open,
+	}
+}
+
+// newStreamedSeekableContents is the same as newSeekableContents, however, opening a source reads the contents from
+// the start (so sources are read forward whenever possible).
+func newStreamedSeekableContents(size int64, open func(offset int64) (io.ReadCloser, error)) *seekableContents {
+	s := newSeekableContents(size, open)
+	s.streamed = true
+	return s
+}
+
+func (s *seekableContents) Size() int64 {
+	return s.size
+}
+
+func (s *seekableContents) Read(p []byte) (int, error) {
+	n, err := s.readAt(p, s.offset, false)
+	s.offset += int64(n)
+	return n, err
+}
+
+func (s *seekableContents) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative read offset: %d", offset)
+	}
+	return s.readAt(p, offset, true)
+}
+
+// readAt reads from a source at the given offset, opening a source at the offset when there is no idle source to
+// continue from. When full is given, the read only returns early on an error (as required for io.ReaderAt).
+func (s *seekableContents) readAt(p []byte, offset int64, full bool) (int, error) {
+	if offset >= s.size {
+		return 0, io.EOF
+	}
+	source, err := s.acquire(offset)
+	if err != nil {
+		return 0, err
+	}
+
+	if remaining := s.size - offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	var n int
+	if full {
+		n, err = io.ReadFull(source, p)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+	} else {
+		n, err = source.Read(p)
+	}
+	source.offset += int64(n)
+
+	if err != nil {
+		// the source cannot be continued from
+		source.Close()
+	} else {
+		s.release(source)
+	}
+
+	if err == nil && offset+int64(n) >= s.size && full {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// acquire takes an idle source at the given offset (or, when streamed, the closest idle source before the offset,
+// which is read forward), otherwise a new source is opened at the offset.
+func (s *seekableContents) acquire(offset int64) (*seekableSource, error) {
+	s.lock.Lock()
+	var source *seekableSource
+	candidate := -1
+	for idx, idle := range s.idle {
+		if idle.offset == offset {
+			candidate = idx
+			break
+		}
+		if s.streamed && idle.offset < offset && (candidate < 0 || idle.offset > s.idle[candidate].offset) {
+			candidate = idx
+		}
+	}
+	if candidate >= 0 {
+		source = s.idle[candidate]
+		s.idle = append(s.idle[:candidate], s.idle[candidate+1:]...)
+	}
+	s.lock.Unlock()
+
+	if source != nil {
+		if _, err := io.CopyN(ioutil.Discard, source, offset-source.offset); err != nil {
+			source.Close()
+			return nil, fmt.Errorf("unable to seek to offset=%d: %w", offset, err)
+		}
+		source.offset = offset
+		return source, nil
+	}
+
+	reader, err := s.open(offset)
+	if err != nil {
+		return nil, err
+	}
+	return &seekableSource{ReadCloser: reader, offset: offset}, nil
+}
+
+// release returns the given source to be continued from by later reads, closing the least recently used idle source
+// when there are too many.
+func (s *seekableContents) release(source *seekableSource) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || source.offset >= s.size {
+		source.Close()
+		return
+	}
+	if len(s.idle) >= maxIdleSources {
+		s.idle[0].Close()
+		s.idle = s.idle[1:]
+	}
+	s.idle = append(s.idle, source)
+}
+
+func (s *seekableContents) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek offset: %d", offset)
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *seekableContents) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	var err error
+	for _, source := range s.idle {
+		if closeErr := source.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	s.idle = nil
+	return err
+}
@@ -0,0 +1,327 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestFileCatalog_OpenSeekableByID(t *testing.T) {
+	const contents = "0123456789abcdefghij"
+
+	tests := []struct {
+		name string
+		// threshold is the cache file size threshold (0 for the default)
+		threshold int64
+		options   []ReadOption
+	}{
+		{
+			name: "in memory",
+		},
+		{
+			name:      "cached",
+			threshold: 1,
+		},
+		{
+			name:      "streamed",
+			threshold: 1,
+			options:   []ReadOption{WithStreamingLayers()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.threshold > 0 {
+				originalThreshold := cacheFileSizeThreshold
+				cacheFileSizeThreshold = test.threshold
+				defer func() { cacheFileSizeThreshold = originalThreshold }()
+			}
+
+			img := newTestImage(t, []v1.Layer{newTestLayer(t, map[string]string{"file.txt": contents})})
+			if err := img.Read(test.options...); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			_, ref, err := squashedTreeOf(t, img).File("/file.txt")
+			if err != nil || ref == nil {
+				t.Fatalf("could not find file: %+v", err)
+			}
+
+			s, err := img.SeekableFileContentsByReference(*ref)
+			if err != nil {
+				t.Fatalf("could not open contents: %+v", err)
+			}
+			defer s.Close()
+
+			if s.Size() != int64(len(contents)) {
+				t.Errorf("unexpected size: %d", s.Size())
+			}
+
+			buf := make([]byte, 4)
+			if n, err := s.ReadAt(buf, 10); err != nil || n != 4 || string(buf) != "abcd" {
+				t.Errorf("unexpected read at offset: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+			}
+
+			// read at the end of the contents
+			if n, err := s.ReadAt(buf, 18); err != io.EOF || n != 2 || string(buf[:n]) != "ij" {
+				t.Errorf("unexpected read at end: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+			}
+
+			// read at an earlier offset (after a later one)
+			if n, err := s.ReadAt(buf, 2); err != nil || string(buf[:n]) != "2345" {
+				t.Errorf("unexpected read at earlier offset: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+			}
+
+			if _, err := s.ReadAt(buf, int64(len(contents))); err != io.EOF {
+				t.Errorf("expected EOF beyond the contents: %v", err)
+			}
+
+			// ReadAt calls do not affect the offset for Read calls
+			if n, err := io.ReadFull(s, buf); err != nil || string(buf[:n]) != "0123" {
+				t.Errorf("unexpected read: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+			}
+
+			if pos, err := s.Seek(-5, io.SeekEnd); err != nil || pos != 15 {
+				t.Fatalf("unexpected seek from end: pos=%d err=%v", pos, err)
+			}
+			rest, err := ioutil.ReadAll(s)
+			if err != nil || string(rest) != "fghij" {
+				t.Errorf("unexpected read after seek: err=%v contents=%q", err, string(rest))
+			}
+
+			// seek backwards
+			if pos, err := s.Seek(1, io.SeekStart); err != nil || pos != 1 {
+				t.Fatalf("unexpected seek from start: pos=%d err=%v", pos, err)
+			}
+			if pos, err := s.Seek(2, io.SeekCurrent); err != nil || pos != 3 {
+				t.Fatalf("unexpected seek from current: pos=%d err=%v", pos, err)
+			}
+			if n, err := io.ReadFull(s, buf); err != nil || string(buf[:n]) != "3456" {
+				t.Errorf("unexpected read after seek: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+			}
+
+			if _, err := s.Seek(-1, io.SeekStart); err == nil {
+				t.Errorf("expected an error for a negative offset")
+			}
+		})
+	}
+}
+
+func TestFileCatalog_OpenSeekableByID_Hardlink(t *testing.T) {
+	img := linkedImage(t)
+
+	_, ref, err := squashedTreeOf(t, img).File("/usr/hard.txt")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find hardlink: %+v", err)
+	}
+
+	s, err := img.FileCatalog.OpenSeekableByID(ref.ID())
+	if err != nil {
+		t.Fatalf("could not open contents: %+v", err)
+	}
+	defer s.Close()
+
+	// the contents are those of the target (opt/app/config.txt)
+	buf := make([]byte, 3)
+	if n, err := s.ReadAt(buf, 4); err != nil || string(buf[:n]) != "app" {
+		t.Errorf("unexpected read: n=%d err=%v contents=%q", n, err, string(buf[:n]))
+	}
+}
+
+func TestFileCatalog_OpenSeekableByID_NotFound(t *testing.T) {
+	img := linkedImage(t)
+
+	if _, err := img.FileCatalog.OpenSeekableByID(file.ID(1 << 40)); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestSeekableContents_ReadAt(t *testing.T) {
+	const contents = "0123456789abcdefghij"
+
+	tests := []struct {
+		name     string
+		streamed bool
+		// offsets are read in order (4 bytes each)
+		offsets []int64
+		// expectedOpens are the offsets that a source is opened at
+		expectedOpens []int64
+	}{
+		{
+			name:          "sequential reads continue from the source",
+			offsets:       []int64{0, 4, 8, 12},
+			expectedOpens: []int64{0},
+		},
+		{
+			name:          "reads forward open a source",
+			offsets:       []int64{0, 10},
+			expectedOpens: []int64{0, 10},
+		},
+		{
+			name:          "streamed reads forward continue from the source",
+			streamed:      true,
+			offsets:       []int64{0, 10, 16},
+			expectedOpens: []int64{0},
+		},
+		{
+			name:          "streamed reads backwards open a source",
+			streamed:      true,
+			offsets:       []int64{10, 2},
+			expectedOpens: []int64{10, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opens []int64
+			open := func(offset int64) (io.ReadCloser, error) {
+				opens = append(opens, offset)
+				return ioutil.NopCloser(strings.NewReader(contents[offset:])), nil
+			}
+			s := newSeekableContents(int64(len(contents)), open)
+			if test.streamed {
+				s = newStreamedSeekableContents(int64(len(contents)), open)
+			}
+			defer s.Close()
+
+			for _, offset := range test.offsets {
+				buf := make([]byte, 4)
+				n, err := s.ReadAt(buf, offset)
+				if err != nil && err != io.EOF {
+					t.Fatalf("could not read at offset=%d: %+v", offset, err)
+				}
+				if string(buf[:n]) != contents[offset:offset+int64(n)] || n != 4 {
+					t.Errorf("unexpected contents at offset=%d: %q", offset, string(buf[:n]))
+				}
+			}
+			for _, d := range deep.Equal(opens, test.expectedOpens) {
+				t.Errorf("unexpected opens: %s", d)
+			}
+		})
+	}
+}
+
+func TestSeekableContents_ConcurrentReadAt(t *testing.T) {
+	contents := strings.Repeat("0123456789", 1000)
+
+	var lock sync.Mutex
+	var opened, closed int
+	s := newStreamedSeekableContents(int64(len(contents)), func(offset int64) (io.ReadCloser, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		opened++
+		return &closeCounter{Reader: strings.NewReader(contents[offset:]), closed: func() {
+			lock.Lock()
+			defer lock.Unlock()
+			closed++
+		}}, nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			buf := make([]byte, 10)
+			for offset := int64(worker * 1000); offset < int64(worker*1000+1000); offset += 10 {
+				if _, err := s.ReadAt(buf, offset); err != nil && err != io.EOF {
+					errs <- err
+					return
+				}
+				if string(buf) != "0123456789" {
+					errs <- fmt.Errorf("unexpected contents at offset=%d: %q", offset, string(buf))
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("could not close: %+v", err)
+	}
+	if opened != closed {
+		t.Errorf("not all sources were closed: opened=%d closed=%d", opened, closed)
+	}
+}
+
+// closeCounter reports each close of the reader.
+type closeCounter struct {
+	io.Reader
+	closed func()
+}
+
+func (c *closeCounter) Close() error {
+	c.closed()
+	return nil
+}
+
+func BenchmarkFileCatalog_OpenSeekableByID_ReadAt(b *testing.B) {
+	// treat all files as large files (which are either cached on disk or streamed from the layer tar)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	const size = 4 * file.MB
+	const readSize = 4096
+	contents := strings.Repeat("0123456789abcdef", size/16)
+
+	// reads jump around the file (e.g. an archive index at the end followed by its entries)
+	random := rand.New(rand.NewSource(1))
+	offsets := make([]int64, 256)
+	for idx := range offsets {
+		offsets[idx] = random.Int63n(size - readSize)
+	}
+
+	for _, test := range []struct {
+		name    string
+		options []ReadOption
+	}{
+		{
+			name: "cached",
+		},
+		{
+			name:    "streamed",
+			options: []ReadOption{WithStreamingLayers()},
+		},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			img := newTestImage(b, []v1.Layer{newTestLayer(b, map[string]string{"file.bin": contents})})
+			if err := img.Read(test.options...); err != nil {
+				b.Fatalf("could not read image: %+v", err)
+			}
+			_, ref, err := squashedTreeOf(b, img).File("/file.bin")
+			if err != nil || ref == nil {
+				b.Fatalf("could not find file: %+v", err)
+			}
+
+			buf := make([]byte, readSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s, err := img.FileCatalog.OpenSeekableByID(ref.ID())
+				if err != nil {
+					b.Fatalf("could not open contents: %+v", err)
+				}
+				for _, offset := range offsets {
+					if _, err := s.ReadAt(buf, offset); err != nil {
+						b.Fatalf("could not read at offset=%d: %+v", offset, err)
+					}
+				}
+				s.Close()
+			}
+		})
+	}
+}
@@ -1,14 +1,11 @@
 package image
 
 import (
-	"errors"
 	"fmt"
-	"io"
-	"os"
-	"path"
+	"net/url"
+	"path/filepath"
 	"strings"
 
-	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/afero"
@@ -20,16 +17,46 @@ const (
 	DockerDaemonSource
 	OciDirectorySource
 	OciTarballSource
+	RegistrySource
+	ContainerdDaemonSource
+	PodmanDaemonSource
+	DirectorySource
+	ContainersStorageSource
+	CRISource
 )
 
 const SchemeSeparator = ":"
 
+// fileURLPrefix is the prefix of a URL referring to a path on disk (e.g. "file:///path/to/image.tar").
+const fileURLPrefix = "file://"
+
 var sourceStr = [...]string{
 	"UnknownSource",
 	"DockerTarball",
 	"DockerDaemon",
 	"OciDirectory",
 	"OciTarball",
+	"Registry",
+	"ContainerdDaemon",
+	"PodmanDaemon",
+	"Directory",
+	"ContainersStorage",
+	"CRI",
+}
+
+// sourceSchemeStr are the schemes that select each source within a user string (e.g. "docker:alpine:latest").
+var sourceSchemeStr = [...]string{
+	"",
+	"docker-archive",
+	"docker",
+	"oci-dir",
+	"oci-archive",
+	"registry",
+	"containerd",
+	"podman",
+	"dir",
+	"containers-storage",
+	"cri",
 }
 
 var AllSources = []Source{
@@ -37,6 +64,12 @@ var AllSources = []Source{
 	DockerDaemonSource,
 	OciDirectorySource,
 	OciTarballSource,
+	RegistrySource,
+	ContainerdDaemonSource,
+	PodmanDaemonSource,
+	DirectorySource,
+	ContainersStorageSource,
+	CRISource,
 }
 
 // Source is a concrete a selection of valid concrete image providers.
@@ -53,15 +86,10 @@ func isDockerReference(imageSpec string) bool {
 // ParseSourceScheme attempts to resolve a concrete image source selection from a scheme in a user string.
 func ParseSourceScheme(source string) Source {
 	source = strings.ToLower(source)
-	switch source {
-	case "docker-archive":
-		return DockerTarballSource
-	case "docker":
-		return DockerDaemonSource
-	case "oci-dir":
-		return OciDirectorySource
-	case "oci-archive":
-		return OciTarballSource
+	for _, candidate := range AllSources {
+		if candidate.Scheme() == source {
+			return candidate
+		}
 	}
 	return UnknownSource
 }
@@ -75,6 +103,22 @@ func DetectSource(userInput string) (Source, string, error) {
 // DetectSource takes a user string and determines the image source (e.g. the docker daemon, a tar file, etc.) returning the string subset representing the image (or nothing if it is unknown).
 // note: parsing is done relative to the given string and environmental evidence (i.e. the given filesystem) to determine the actual source.
 func detectSource(fs afero.Fs, userInput string) (Source, string, error) {
+	if isFileURL(userInput) {
+		// a file URL always refers to a path on disk, so there is no scheme to consider
+		location, err := normalizeImagePath(userInput)
+		if err != nil {
+			return UnknownSource, "", err
+		}
+		source, err := detectSourceFromPath(fs, location)
+		if err != nil {
+			return UnknownSource, "", err
+		}
+		if source == UnknownSource {
+			location = ""
+		}
+		return source, location, nil
+	}
+
 	candidates := strings.SplitN(userInput, SchemeSeparator, 2)
 
 	var source Source
@@ -98,11 +142,14 @@ func detectSource(fs afero.Fs, userInput string) (Source, string, error) {
 	}
 
 	switch source {
-	case OciDirectorySource, OciTarballSource, DockerTarballSource:
+	case OciDirectorySource, OciTarballSource, DockerTarballSource, DirectorySource:
 		// since the scheme was explicitly given, that means that home dir tilde expansion would not have been done by the shell (so we have to)
-		location, err = homedir.Expand(location)
+		location, err = normalizeImagePath(location)
 		if err != nil {
-			return UnknownSource, "", fmt.Errorf("unable to expand potential home dir expression: %w", err)
+			return UnknownSource, "", err
+		}
+		if err = checkPathKind(fs, source, location); err != nil {
+			return UnknownSource, "", err
 		}
 	case UnknownSource:
 		if isDockerReference(userInput) {
@@ -116,73 +163,78 @@ func detectSource(fs afero.Fs, userInput string) (Source, string, error) {
 	return source, location, nil
 }
 
-// DetectSourceFromPath will distinguish between a oci-layout dir, oci-archive, and a docker-archive for a given filesystem.
-func DetectSourceFromPath(imgPath string) (Source, error) {
-	return detectSourceFromPath(afero.NewOsFs(), imgPath)
+// isFileURL indicates if the given user input is a file URL (e.g. "file:///path/to/image.tar").
+func isFileURL(userInput string) bool {
+	return strings.HasPrefix(strings.ToLower(userInput), fileURLPrefix)
 }
 
-// detectSourceFromPath will distinguish between a oci-layout dir, oci-archive, and a docker-archive for a given filesystem.
-func detectSourceFromPath(fs afero.Fs, imgPath string) (Source, error) {
-	imgPath, err := homedir.Expand(imgPath)
-	if err != nil {
-		return UnknownSource, fmt.Errorf("unable to expand potential home dir expression: %w", err)
+// normalizeImagePath converts a user provided path (which may be a file URL, relative, or use a home dir tilde) into a
+// clean path on disk. Relative paths remain relative to the current working directory.
+func normalizeImagePath(location string) (string, error) {
+	if isFileURL(location) {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse file URL=%q: %w", location, err)
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return "", fmt.Errorf("unsupported file URL=%q: only local files are supported", location)
+		}
+		location = u.Path
 	}
 
-	pathStat, err := fs.Stat(imgPath)
-	if os.IsNotExist(err) {
-		return UnknownSource, nil
-	} else if err != nil {
-		return UnknownSource, fmt.Errorf("failed to open path=%s: %w", imgPath, err)
+	location, err := homedir.Expand(location)
+	if err != nil {
+		return "", fmt.Errorf("unable to expand potential home dir expression: %w", err)
 	}
 
-	if pathStat.IsDir() {
-		//  check for oci-directory
-		if _, err := fs.Stat(path.Join(imgPath, "oci-layout")); !os.IsNotExist(err) {
-			return OciDirectorySource, nil
-		}
-
-		// there are no other directory-based source formats supported
-		return UnknownSource, nil
+	if location == "" {
+		return "", fmt.Errorf("no image path provided")
 	}
 
-	// assume this is an archive...
-	archive, err := fs.Open(imgPath)
+	return filepath.Clean(location), nil
+}
+
+// checkPathKind raises an error when an existing path is a directory but the source expects a file (or vice versa).
+// A path that does not exist is not checked here (the provider raises an error for this).
+func checkPathKind(fs afero.Fs, source Source, location string) error {
+	pathStat, err := fs.Stat(location)
 	if err != nil {
-		return UnknownSource, fmt.Errorf("unable to open archive=%s: %w", imgPath, err)
+		return nil
 	}
 
-	for _, pair := range []struct {
-		path   string
-		source Source
-	}{
-		{
-			"manifest.json",
-			DockerTarballSource,
-		},
-		{
-			"oci-layout",
-			OciTarballSource,
-		},
-	} {
-		if _, err = archive.Seek(0, io.SeekStart); err != nil {
-			return UnknownSource, fmt.Errorf("unable to seek archive=%s: %w", imgPath, err)
+	switch source {
+	case OciDirectorySource, DirectorySource:
+		if !pathStat.IsDir() {
+			return fmt.Errorf("%s source requires a directory, but path=%q is a file", source, location)
 		}
-
-		var fileErr *file.ErrFileNotFound
-		_, err = file.ReaderFromTar(archive, pair.path)
-		if err == nil {
-			return pair.source, nil
-		} else if !errors.As(err, &fileErr) {
-			// short-circuit, there is something wrong with the tar reading process
-			return UnknownSource, err
+	case OciTarballSource, DockerTarballSource:
+		if pathStat.IsDir() {
+			return fmt.Errorf("%s source requires an archive file, but path=%q is a directory", source, location)
 		}
 	}
+	return nil
+}
 
-	// there are no other archive-based formats supported
-	return UnknownSource, nil
+// DetectSourceFromPath will distinguish between a oci-layout dir, oci-archive, and a docker-archive for a given filesystem.
+func DetectSourceFromPath(imgPath string) (Source, error) {
+	return detectSourceFromPath(afero.NewOsFs(), imgPath)
+}
+
+// detectSourceFromPath will distinguish between a oci-layout dir, oci-archive, and a docker-archive for a given filesystem.
+func detectSourceFromPath(fs afero.Fs, imgPath string) (Source, error) {
+	archiveType, err := detectArchiveType(fs, imgPath)
+	if err != nil {
+		return UnknownSource, err
+	}
+	return archiveType.Source(), nil
 }
 
 // String returns a convenient display string for the source.
 func (t Source) String() string {
 	return sourceStr[t]
 }
+
+// Scheme returns the scheme that selects the source within a user string (empty for UnknownSource).
+func (t Source) Scheme() string {
+	return sourceSchemeStr[t]
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultSourceDetectionOrder is the order sources are considered in for a user string without a scheme: an archive or
+// OCI layout on disk, then the docker daemon, then the registry.
+var DefaultSourceDetectionOrder = []Source{
+	DockerTarballSource,
+	OciTarballSource,
+	OciDirectorySource,
+	DockerDaemonSource,
+	RegistrySource,
+}
+
+// SourceDetection describes how the source was detected for a user string without a scheme.
+type SourceDetection struct {
+	// Order is the order sources were considered in (see DefaultSourceDetectionOrder).
+	Order []Source
+	// Skipped are the sources attempted before the source the image was obtained from (in order), where the image
+	// was unavailable.
+	Skipped []SkippedSource
+}
+
+// SkippedSource is a source the image was unavailable from during detection (e.g. the daemon is not running).
+type SkippedSource struct {
+	Source Source
+	// Reason describes why the image was unavailable from the source.
+	Reason string
+}
+
+// WithSourceDetection records how the source was detected for the image (see Origin.Detection).
+func WithSourceDetection(detection SourceDetection) ReadOption {
+	return func(image *Image) error {
+		image.sourceDetection = &detection
+		return nil
+	}
+}
+
+// CheckSourceDetectionOrder raises an error for a detection order that is empty or has sources that cannot be
+// detected from a user string without a scheme (see DetectSourceCandidates).
+func CheckSourceDetectionOrder(order []Source) error {
+	if len(order) == 0 {
+		return fmt.Errorf("no sources to detect")
+	}
+	for _, source := range order {
+		if !isPathSource(source) && !isReferenceSource(source) {
+			return fmt.Errorf("source=%s cannot be detected without a scheme", source)
+		}
+	}
+	return nil
+}
+
+// HasSourceScheme indicates if the given user string selects the source explicitly (with a scheme, e.g.
+// "registry:alpine:latest", or as a file URL), in which case no detection is done.
+func HasSourceScheme(userInput string) bool {
+	if isFileURL(userInput) {
+		return true
+	}
+	candidates := strings.SplitN(userInput, SchemeSeparator, 2)
+	return len(candidates) == 2 && ParseSourceScheme(candidates[0]) != UnknownSource
+}
+
+// DetectSourceCandidates is the same as DetectSource, however, a user string without a scheme may be provided by any
+// of several sources, which are returned in the given order (DefaultSourceDetectionOrder when not provided). Archive
+// and OCI layout sources are candidates when the path on disk is of that kind, while daemon and registry sources are
+// candidates when the user string is an image reference. There is a single candidate when a scheme is given (none when
+// the source is unknown).
+func DetectSourceCandidates(userInput string, order []Source) ([]Source, string, error) {
+	return detectSourceCandidates(afero.NewOsFs(), userInput, order)
+}
+
+func detectSourceCandidates(fs afero.Fs, userInput string, order []Source) ([]Source, string, error) {
+	if HasSourceScheme(userInput) {
+		source, location, err := detectSource(fs, userInput)
+		if err != nil || source == UnknownSource {
+			return nil, "", err
+		}
+		return []Source{source}, location, nil
+	}
+
+	if len(order) == 0 {
+		order = DefaultSourceDetectionOrder
+	}
+
+	pathSource, err := detectSourceFromPath(fs, userInput)
+	if err != nil {
+		return nil, "", err
+	}
+	isReference := isDockerReference(userInput)
+
+	var candidates []Source
+	for _, source := range order {
+		switch {
+		case isPathSource(source) && source == pathSource:
+			candidates = append(candidates, source)
+		case isReferenceSource(source) && isReference:
+			candidates = append(candidates, source)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, "", nil
+	}
+	return candidates, userInput, nil
+}
+
+// isPathSource indicates if the source can be detected from the content of a path on disk.
+func isPathSource(source Source) bool {
+	switch source {
+	case DockerTarballSource, OciTarballSource, OciDirectorySource:
+		return true
+	}
+	return false
+}
+
+// isReferenceSource indicates if the source provides images by image reference (e.g. "alpine:latest").
+func isReferenceSource(source Source) bool {
+	switch source {
+	case DockerDaemonSource, PodmanDaemonSource, ContainerdDaemonSource, RegistrySource, ContainersStorageSource, CRISource:
+		return true
+	}
+	return false
+}
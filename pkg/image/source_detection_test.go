@@ -0,0 +1,90 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/afero"
+)
+
+func TestDetectSourceCandidates(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		order            []Source
+		tarPaths         []string
+		expected         []Source
+		expectedLocation string
+	}{
+		{
+			name:             "reference",
+			input:            "alpine:3.12",
+			expected:         []Source{DockerDaemonSource, RegistrySource},
+			expectedLocation: "alpine:3.12",
+		},
+		{
+			name:             "reference with custom order",
+			input:            "alpine:3.12",
+			order:            []Source{RegistrySource, PodmanDaemonSource, OciTarballSource},
+			expected:         []Source{RegistrySource, PodmanDaemonSource},
+			expectedLocation: "alpine:3.12",
+		},
+		{
+			name:             "docker archive",
+			input:            "image.tar",
+			tarPaths:         []string{"manifest.json"},
+			expected:         []Source{DockerTarballSource, DockerDaemonSource, RegistrySource},
+			expectedLocation: "image.tar",
+		},
+		{
+			name:             "oci archive",
+			input:            "image.tar",
+			tarPaths:         []string{"oci-layout"},
+			order:            []Source{DockerTarballSource, OciTarballSource},
+			expected:         []Source{OciTarballSource},
+			expectedLocation: "image.tar",
+		},
+		{
+			name:             "explicit scheme",
+			input:            "registry:alpine:3.12",
+			expected:         []Source{RegistrySource},
+			expectedLocation: "alpine:3.12",
+		},
+		{
+			name:  "unknown",
+			input: "a5E",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if test.tarPaths != nil {
+				getDummyTar(t, fs.(*afero.MemMapFs), test.input, test.tarPaths...)
+			}
+
+			actual, location, err := detectSourceCandidates(fs, test.input, test.order)
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			for _, d := range deep.Equal(actual, test.expected) {
+				t.Errorf("diff: %+v", d)
+			}
+			if location != test.expectedLocation {
+				t.Errorf("unexpected location: %q != %q", location, test.expectedLocation)
+			}
+		})
+	}
+}
+
+func TestCheckSourceDetectionOrder(t *testing.T) {
+	if err := CheckSourceDetectionOrder(DefaultSourceDetectionOrder); err != nil {
+		t.Errorf("unexpected error for the default order: %+v", err)
+	}
+	if err := CheckSourceDetectionOrder(nil); err == nil {
+		t.Errorf("expected an error for an empty order")
+	}
+	if err := CheckSourceDetectionOrder([]Source{RegistrySource, DirectorySource}); err == nil {
+		t.Errorf("expected an error for a source that cannot be detected")
+	}
+}
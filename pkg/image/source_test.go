@@ -120,6 +120,66 @@ func TestDetectSource(t *testing.T) {
 			tarPath:          "~/a-potential/path",
 			tarPaths:         []string{"oci-layout"},
 		},
+		{
+			name:             "registry-explicit",
+			input:            "registry:some/image:latest",
+			source:           RegistrySource,
+			expectedLocation: "some/image:latest",
+		},
+		{
+			name:             "file-url",
+			input:            "file:///a-potential/path",
+			source:           DockerTarballSource,
+			expectedLocation: "/a-potential/path",
+			tarPath:          "/a-potential/path",
+			tarPaths:         []string{"manifest.json"},
+		},
+		{
+			name:             "file-url-explicit",
+			input:            "oci-archive:file:///a-potential/path",
+			source:           OciTarballSource,
+			expectedLocation: "/a-potential/path",
+			tarPath:          "/a-potential/path",
+			tarPaths:         []string{"oci-layout"},
+		},
+		{
+			name:             "file-url-unknown",
+			input:            "file:///does/not/exist",
+			source:           UnknownSource,
+			expectedLocation: "",
+		},
+		{
+			name:             "relative-path-explicit",
+			input:            "docker-archive:./somewhere/../a-potential/path",
+			source:           DockerTarballSource,
+			expectedLocation: "a-potential/path",
+			tarPath:          "a-potential/path",
+			tarPaths:         []string{"manifest.json"},
+		},
+		{
+			name:             "podman-explicit",
+			input:            "podman:myimage:tag",
+			source:           PodmanDaemonSource,
+			expectedLocation: "myimage:tag",
+		},
+		{
+			name:             "containerd-explicit",
+			input:            "containerd:some/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			source:           ContainerdDaemonSource,
+			expectedLocation: "some/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			name:             "containers-storage-explicit",
+			input:            "containers-storage:[/var/lib/containers/storage]alpine:latest",
+			source:           ContainersStorageSource,
+			expectedLocation: "[/var/lib/containers/storage]alpine:latest",
+		},
+		{
+			name:             "cri-explicit",
+			input:            "cri:registry.k8s.io/pause:3.9",
+			source:           CRISource,
+			expectedLocation: "registry.k8s.io/pause:3.9",
+		},
 		{
 			name:             "oci-tar-path-explicit",
 			input:            "oci-archive:~/a-potential/path",
@@ -217,6 +277,26 @@ func TestParseScheme(t *testing.T) {
 			source:   "oci-archive",
 			expected: OciTarballSource,
 		},
+		{
+			source:   "registry",
+			expected: RegistrySource,
+		},
+		{
+			source:   "containerd",
+			expected: ContainerdDaemonSource,
+		},
+		{
+			source:   "Podman",
+			expected: PodmanDaemonSource,
+		},
+		{
+			source:   "containers-storage",
+			expected: ContainersStorageSource,
+		},
+		{
+			source:   "CRI",
+			expected: CRISource,
+		},
 		{
 			// regression for unsupported behavior
 			source:   "oci-tar",
@@ -241,6 +321,10 @@ func TestParseScheme(t *testing.T) {
 			source:   "oci-directory",
 			expected: UnknownSource,
 		},
+		{
+			source:   "dir",
+			expected: DirectorySource,
+		},
 		{
 			source:   "",
 			expected: UnknownSource,
@@ -258,6 +342,20 @@ func TestParseScheme(t *testing.T) {
 	}
 }
 
+func TestSource_Scheme(t *testing.T) {
+	for _, source := range AllSources {
+		if source.Scheme() == "" {
+			t.Errorf("missing scheme for source=%s", source)
+		}
+		if actual := ParseSourceScheme(source.Scheme()); actual != source {
+			t.Errorf("scheme=%q does not round trip: %s != %s", source.Scheme(), actual, source)
+		}
+	}
+	if UnknownSource.Scheme() != "" {
+		t.Errorf("unexpected scheme for unknown source: %q", UnknownSource.Scheme())
+	}
+}
+
 func TestDetectSourceFromPath(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -416,3 +514,68 @@ func getDummyPath(t *testing.T, fs *afero.MemMapFs, dirPath string, paths ...str
 
 	return dirPath
 }
+
+func TestDetectSource_PathKindMismatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:    "archive is a directory",
+			input:   "docker-archive:some/dir",
+			wantErr: true,
+		},
+		{
+			name:    "oci archive is a directory",
+			input:   "oci-archive:file:///abs/dir",
+			wantErr: true,
+		},
+		{
+			name:    "directory is a file",
+			input:   "oci-dir:some/file.tar",
+			wantErr: true,
+		},
+		{
+			name:  "directory is a directory",
+			input: "oci-dir:some/dir",
+		},
+		{
+			name:  "missing path",
+			input: "oci-dir:does/not/exist",
+		},
+		{
+			name:    "root filesystem is a file",
+			input:   "dir:some/file.tar",
+			wantErr: true,
+		},
+		{
+			name:  "root filesystem is a directory",
+			input: "dir:/abs/dir",
+		},
+		{
+			name:    "remote file url",
+			input:   "file://somehost/some/file.tar",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			for _, dir := range []string{"some/dir", "/abs/dir"} {
+				if err := fs.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("could not create dir: %+v", err)
+				}
+			}
+			getDummyTar(t, fs.(*afero.MemMapFs), "some/file.tar", "manifest.json")
+
+			_, _, err := detectSource(fs, c.input)
+			if c.wantErr && err == nil {
+				t.Fatalf("expected an error but got none")
+			} else if !c.wantErr && err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+		})
+	}
+}
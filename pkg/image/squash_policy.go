@@ -0,0 +1,108 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// SquashPolicy determines how the layer trees are combined into the squash trees. The zero value is the standard OCI
+// whiteout semantics over all layers (the default).
+type SquashPolicy struct {
+	// IncludeDeleted keeps all paths removed by whiteouts (or opaque whiteouts) of later layers within the squash trees,
+	// which is a union of all layers where the topmost layer providing a path is preferred. This is useful for
+	// inspecting files deleted in later layers (the contents of deleted files remain available). Note: paths beneath a
+	// directory that a later layer replaces with a non-directory are still removed.
+	IncludeDeleted bool
+	// TopLayers only considers the given number of topmost layers for the squash trees (all layers when zero), so the
+	// squash tree of the image only describes the paths provided by these layers. The squash trees of all lower layers
+	// are unaffected.
+	TopLayers int
+}
+
+// WithSquashPolicy tailors how the layer trees are combined into the squash trees (see SquashPolicy), which affects all
+// squash-relative queries (e.g. Image.SquashedTree or Image.FileContentsFromSquash). See Image.Squash for creating a
+// squash tree with another policy after the image has been read.
+func WithSquashPolicy(policy SquashPolicy) ReadOption {
+	return func(image *Image) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		image.squashPolicy = policy
+		return nil
+	}
+}
+
+// Squash creates the image squash tree for the given policy (without changing the squash trees of the image, which are
+// created by the policy the image was read with). File contents and metadata for all paths within the returned tree
+// are available from the image file catalog.
+func (i *Image) Squash(policy SquashPolicy) (*filetree.FileTree, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return nil, err
+	}
+
+	squashedTree := filetree.NewFileTree()
+	err := policy.squash(i.Layers, func(idx int, tree *filetree.FileTree) {
+		if idx == len(i.Layers)-1 {
+			squashedTree = tree
+		}
+	})
+	return squashedTree, err
+}
+
+func (p SquashPolicy) validate() error {
+	if p.TopLayers < 0 {
+		return fmt.Errorf("invalid number of top layers to squash: %d", p.TopLayers)
+	}
+	return nil
+}
+
+// squash creates the squash tree of each of the given layers (in order), handing each tree to the given function.
+func (p SquashPolicy) squash(layers []*Layer, fn func(idx int, squashedTree *filetree.FileTree)) error {
+	// squashing starts over at the first of the top layers
+	start := 0
+	if p.TopLayers > 0 && p.TopLayers < len(layers) {
+		start = len(layers) - p.TopLayers
+	}
+
+	var options []filetree.MergeOption
+	if p.IncludeDeleted {
+		options = append(options, filetree.IgnoreWhiteouts)
+	}
+
+	var lastSquashTree *filetree.FileTree
+	for idx, layer := range layers {
+		if idx == 0 {
+			lastSquashTree = layer.Tree
+			fn(idx, layer.Tree)
+			continue
+		}
+
+		var unionTree = filetree.NewUnionFileTree()
+		if idx == start {
+			// the first of the top layers is squashed onto nothing (so whiteouts are not part of the squash tree)
+			unionTree.PushTree(filetree.NewFileTree())
+		} else {
+			unionTree.PushTree(lastSquashTree)
+		}
+		unionTree.PushTree(layer.Tree)
+
+		// the squash of the lower layers is always standard, regardless of the policy for the top layers
+		var layerOptions []filetree.MergeOption
+		if idx > start {
+			layerOptions = options
+		}
+		squashedTree, err := unionTree.Squash(layerOptions...)
+		if err != nil {
+			return fmt.Errorf("failed to squash tree %d: %w", idx, err)
+		}
+
+		lastSquashTree = squashedTree
+		fn(idx, squashedTree)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func squashPolicyTestImage(t *testing.T, options ...ReadOption) *Image {
+	t.Helper()
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/secret"},
+		tar.Header{Typeflag: tar.TypeDir, Name: "var/cache/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/old"},
+	)
+	middle := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.secret"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/.wh..wh..opq"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/new"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "app/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "app/main"},
+	)
+	img := newTestImage(t, []v1.Layer{base, middle, top})
+	if err := img.Read(options...); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	return img
+}
+
+func assertSquashPaths(t *testing.T, tree *filetree.FileTree, present, absent []file.Path) {
+	t.Helper()
+	for _, p := range present {
+		if !tree.HasPath(p) {
+			t.Errorf("expected path=%q", p)
+		}
+	}
+	for _, p := range absent {
+		if tree.HasPath(p) {
+			t.Errorf("unexpected path=%q", p)
+		}
+	}
+}
+
+func TestSquashPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  SquashPolicy
+		present []file.Path
+		absent  []file.Path
+	}{
+		{
+			name:    "standard",
+			present: []file.Path{"/app/main", "/var/cache/new"},
+			absent:  []file.Path{"/etc/secret", "/var/cache/old", "/etc/.wh.secret", "/var/cache/.wh..wh..opq"},
+		},
+		{
+			name:    "include deleted",
+			policy:  SquashPolicy{IncludeDeleted: true},
+			present: []file.Path{"/app/main", "/var/cache/new", "/etc/secret", "/var/cache/old"},
+			absent:  []file.Path{"/etc/.wh.secret", "/var/cache/.wh..wh..opq"},
+		},
+		{
+			name:    "top layers",
+			policy:  SquashPolicy{TopLayers: 1},
+			present: []file.Path{"/app/main"},
+			absent:  []file.Path{"/var/cache/new", "/etc/secret", "/var/cache/old"},
+		},
+		{
+			name:    "more top layers than the image has",
+			policy:  SquashPolicy{TopLayers: 10},
+			present: []file.Path{"/app/main", "/var/cache/new"},
+			absent:  []file.Path{"/etc/secret", "/var/cache/old"},
+		},
+		{
+			name:   "include deleted within top layers",
+			policy: SquashPolicy{IncludeDeleted: true, TopLayers: 2},
+			// the whiteouts of the middle layer have nothing to remove within the top layers
+			present: []file.Path{"/app/main", "/var/cache/new"},
+			absent:  []file.Path{"/etc/secret", "/var/cache/old", "/etc/.wh.secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := squashPolicyTestImage(t, WithSquashPolicy(test.policy))
+			assertSquashPaths(t, squashedTreeOf(t, img), test.present, test.absent)
+
+			// the same tree is available on demand
+			tree, err := squashPolicyTestImage(t).Squash(test.policy)
+			if err != nil {
+				t.Fatalf("could not squash image: %+v", err)
+			}
+			assertSquashPaths(t, tree, test.present, test.absent)
+		})
+	}
+}
+
+func TestImage_Squash_IncludeDeletedContents(t *testing.T) {
+	img := squashPolicyTestImage(t)
+
+	tree, err := img.Squash(SquashPolicy{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("could not squash image: %+v", err)
+	}
+	_, ref, err := tree.File("/etc/secret")
+	if err != nil || ref == nil {
+		t.Fatalf("could not find deleted file: %+v", err)
+	}
+	reader, err := img.FileContentsByReference(*ref)
+	if err != nil {
+		t.Fatalf("could not open deleted file: %+v", err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read deleted file: %+v", err)
+	}
+	if string(contents) != "etc/secret" {
+		t.Errorf("unexpected contents: %q", contents)
+	}
+
+	// the image squash trees are unchanged
+	assertSquashPaths(t, squashedTreeOf(t, img), nil, []file.Path{"/etc/secret"})
+	if len(img.Layers[1].SquashedTree.AllFiles()) == 0 {
+		t.Errorf("expected layer squash trees to remain")
+	}
+
+	if _, err := img.Squash(SquashPolicy{TopLayers: -1}); err == nil {
+		t.Errorf("expected an error for a negative number of top layers")
+	}
+}
@@ -0,0 +1,176 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// SquashedTarReader streams a single tar of the squashed filesystem of the image (the effective filesystem, without
+// whiteouts), e.g. to pipe the filesystem to other tools or to write a flattened archive. Entries are written in
+// depth-first path order as the tar is read, where file contents are read from the file catalog on demand (so the
+// tar is never held in memory or on disk as a whole). Directories only implied by other paths (without a tar entry)
+// are not included. Hardlinks are written as links when the target is part of the tar already, otherwise as regular
+// files with the contents of the target. Any error while writing the tar is returned from Read. Closing the reader
+// early stops writing the tar.
+func (i *Image) SquashedTarReader() io.ReadCloser {
+	return i.SquashedTarReaderWithContext(context.Background())
+}
+
+// SquashedTarReaderWithContext is the same as SquashedTarReader, however, writing the tar is aborted once the given
+// context is done.
+func (i *Image) SquashedTarReaderWithContext(ctx context.Context) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	go func() {
+		defer cancel()
+		writer.CloseWithError(i.writeSquashedTar(ctx, writer))
+	}()
+	return &squashedTarReader{
+		PipeReader: reader,
+		cancel:     cancel,
+	}
+}
+
+// squashedTarReader stops writing the tar once closed.
+type squashedTarReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *squashedTarReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// writeSquashedTar writes all files of the squashed tree to the given writer as a tar.
+func (i *Image) writeSquashedTar(ctx context.Context, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	// the tar entry name of each file with contents written to the tar (for writing hardlinks)
+	written := make(map[file.ID]string)
+
+	err := i.SquashedWalkWithContext(ctx, func(path file.Path, ref file.Reference, metadata file.Metadata, contents file.OpenerFn) error {
+		if path == file.DirSeparator {
+			return nil
+		}
+		name := strings.TrimPrefix(string(path), file.DirSeparator)
+
+		switch metadata.TypeFlag {
+		case tar.TypeReg, tar.TypeRegA:
+			written[ref.ID()] = name
+			return writeSquashedTarFile(tw, squashedTarHeader(name, metadata), contents)
+		case tar.TypeLink:
+			entry, err := i.FileCatalog.Get(ref)
+			if err != nil {
+				return err
+			}
+			target, err := i.FileCatalog.resolveHardlink(&entry)
+			if errors.Is(err, ErrFileNotFound) {
+				// a dangling hardlink is written as found within the layer tar
+				return tw.WriteHeader(squashedTarHeader(name, metadata))
+			}
+			if err != nil {
+				return err
+			}
+
+			if targetName, ok := written[target.File.ID()]; ok {
+				header := squashedTarHeader(name, metadata)
+				header.Linkname = targetName
+				return tw.WriteHeader(header)
+			}
+
+			// the target is not part of the tar (yet), so this is written as the file the hardlink refers to
+			written[target.File.ID()] = name
+			header := squashedTarHeader(name, target.Metadata)
+			return writeSquashedTarFile(tw, header, contents)
+		default:
+			return tw.WriteHeader(squashedTarHeader(name, metadata))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write squashed tar: %w", err)
+	}
+	return tw.Close()
+}
+
+// writeSquashedTarFile writes the given header along with the file contents.
+func writeSquashedTarFile(tw *tar.Writer, header *tar.Header, contents file.OpenerFn) error {
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	reader, err := contents()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(tw, reader)
+	if err != nil {
+		return err
+	}
+	if n != header.Size {
+		return fmt.Errorf("unexpected size for path=%q: %d != %d", header.Name, n, header.Size)
+	}
+	return nil
+}
+
+// squashedTarHeader returns the tar header for a file of the squashed tree with the given tar entry name.
+func squashedTarHeader(name string, metadata file.Metadata) *tar.Header {
+	header := &tar.Header{
+		Typeflag: metadata.TypeFlag,
+		Name:     name,
+		Linkname: metadata.Linkname,
+		Mode:     tarMode(metadata.Mode),
+		Uid:      metadata.UserID,
+		Gid:      metadata.GroupID,
+		ModTime:  metadata.ModTime,
+	}
+
+	switch metadata.TypeFlag {
+	case tar.TypeReg, tar.TypeRegA:
+		header.Typeflag = tar.TypeReg
+		header.Size = metadata.Size
+	case tar.TypeDir:
+		header.Name += file.DirSeparator
+	case tar.TypeChar, tar.TypeBlock:
+		header.Devmajor = metadata.DevMajor
+		header.Devminor = metadata.DevMinor
+	}
+
+	if !metadata.AccessTime.IsZero() || !metadata.ChangeTime.IsZero() {
+		header.AccessTime = metadata.AccessTime
+		header.ChangeTime = metadata.ChangeTime
+		header.Format = tar.FormatPAX
+	}
+
+	if len(metadata.Xattrs) > 0 {
+		header.PAXRecords = make(map[string]string, len(metadata.Xattrs))
+		for key, value := range metadata.Xattrs {
+			header.PAXRecords["SCHILY.xattr."+key] = value
+		}
+		header.Format = tar.FormatPAX
+	}
+
+	return header
+}
+
+// tarMode returns the tar header mode (permission and special bits) for the given file mode.
+func tarMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
@@ -0,0 +1,99 @@
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+type squashedTarEntry struct {
+	Type     byte
+	Linkname string
+	Contents string
+}
+
+func TestImage_SquashedTarReader(t *testing.T) {
+	img := linkedImage(t)
+
+	reader := img.SquashedTarReader()
+	defer reader.Close()
+
+	var names []string
+	actual := make(map[string]squashedTarEntry)
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read tar: %+v", err)
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("could not read tar entry: %+v", err)
+		}
+		names = append(names, header.Name)
+		actual[header.Name] = squashedTarEntry{
+			Type:     header.Typeflag,
+			Linkname: header.Linkname,
+			Contents: string(contents),
+		}
+	}
+
+	expectedNames := []string{
+		"current",
+		"etc/",
+		"etc/config.txt",
+		"opt/",
+		"opt/app/",
+		"opt/app/config.txt",
+		"usr/",
+		"usr/config.txt",
+		"usr/dead",
+		"usr/hard.txt",
+		"usr/local-hard.txt",
+		"usr/local.txt",
+	}
+	for _, d := range deep.Equal(names, expectedNames) {
+		t.Errorf("unexpected tar entries: %s", d)
+	}
+
+	expected := map[string]squashedTarEntry{
+		"current":            {Type: tar.TypeSymlink, Linkname: "/opt/app"},
+		"etc/":               {Type: tar.TypeDir},
+		"etc/config.txt":     {Type: tar.TypeSymlink, Linkname: "../current/config.txt"},
+		"opt/":               {Type: tar.TypeDir},
+		"opt/app/":           {Type: tar.TypeDir},
+		"opt/app/config.txt": {Type: tar.TypeReg, Contents: "opt/app/config.txt"},
+		"usr/":               {Type: tar.TypeDir},
+		"usr/config.txt":     {Type: tar.TypeSymlink, Linkname: "../etc/config.txt"},
+		"usr/dead":           {Type: tar.TypeSymlink, Linkname: "/nowhere"},
+		// the target was written already
+		"usr/hard.txt": {Type: tar.TypeLink, Linkname: "opt/app/config.txt"},
+		// the target is written afterwards, so the contents of the target are written instead
+		"usr/local-hard.txt": {Type: tar.TypeReg, Contents: "usr/local.txt"},
+		"usr/local.txt":      {Type: tar.TypeReg, Contents: "usr/local.txt"},
+	}
+	for _, d := range deep.Equal(actual, expected) {
+		t.Errorf("unexpected tar entry: %s", d)
+	}
+}
+
+func TestImage_SquashedTarReader_Close(t *testing.T) {
+	img := linkedImage(t)
+
+	reader := img.SquashedTarReader()
+	if _, err := reader.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("could not read tar: %+v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("could not close reader: %+v", err)
+	}
+	if _, err := reader.Read(make([]byte, 10)); err == nil {
+		t.Errorf("expected an error reading a closed tar")
+	}
+}
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// SquashedWalkFn is called for each cataloged file within the squashed tree (see Image.SquashedWalk). The contents
+// function opens the file contents on demand (resolving hardlinks), which is only meaningful for regular files and
+// hardlinks. The reader may be used after the visitor returns, but must be closed by the caller.
+type SquashedWalkFn func(path file.Path, ref file.Reference, metadata file.Metadata, contents file.OpenerFn) error
+
+// SquashedWalk invokes the given visitor for each file within the squashed tree in depth-first path order (the same
+// order for every walk of the same image), without resolving links. Directories only implied by other paths (without a
+// tar entry) are not visited since there is no metadata for them. Any error from the visitor stops the walk and is
+// returned. This is the same as iterating all files of the squashed tree and fetching the metadata and contents for each
+// separately, without requiring callers to do so.
+func (i *Image) SquashedWalk(fn SquashedWalkFn) error {
+	return i.SquashedWalkWithContext(context.Background(), fn)
+}
+
+// SquashedWalkWithContext is the same as SquashedWalk, however, the walk (and reading file contents) is aborted once the
+// given context is done.
+func (i *Image) SquashedWalkWithContext(ctx context.Context, fn SquashedWalkFn) error {
+	if err := i.IndexLayers(ctx); err != nil {
+		return err
+	}
+
+	squashedTree := i.squashedTree()
+	if squashedTree == nil {
+		return fmt.Errorf("unable to walk squashed tree: image has not been read")
+	}
+
+	return squashedTree.WalkNodes(func(path file.Path, node filenode.FileNode) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if node.Reference == nil {
+			return nil
+		}
+		ref := *node.Reference
+
+		metadata, err := i.FileCatalog.Metadata(ref)
+		if errors.Is(err, ErrFileNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return fn(path, ref, metadata, func() (io.ReadCloser, error) {
+			return i.FileCatalog.OpenByIDWithContext(ctx, ref.ID())
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_SquashedWalk(t *testing.T) {
+	img := linkedImage(t)
+
+	expectedContents := map[file.Path]string{
+		"/opt/app/config.txt": "opt/app/config.txt",
+		"/usr/hard.txt":       "opt/app/config.txt",
+		"/usr/local.txt":      "usr/local.txt",
+		"/usr/local-hard.txt": "usr/local.txt",
+	}
+
+	var paths []file.Path
+	err := img.SquashedWalk(func(path file.Path, ref file.Reference, metadata file.Metadata, contents file.OpenerFn) error {
+		paths = append(paths, path)
+		if ref.RealPath != path || metadata.Path != string(path) {
+			t.Errorf("unexpected reference or metadata for path=%q: %+v %+v", path, ref, metadata)
+		}
+		if metadata.TypeFlag != tar.TypeReg && metadata.TypeFlag != tar.TypeLink {
+			return nil
+		}
+		reader, err := contents()
+		if err != nil {
+			return err
+		}
+		assertContents(t, reader, expectedContents[path])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+
+	expected := []file.Path{
+		"/current",
+		"/etc",
+		"/etc/config.txt",
+		"/opt",
+		"/opt/app",
+		"/opt/app/config.txt",
+		"/usr",
+		"/usr/config.txt",
+		"/usr/dead",
+		"/usr/hard.txt",
+		"/usr/local-hard.txt",
+		"/usr/local.txt",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("unexpected paths:\n\texpected: %+v\n\tactual:   %+v", expected, paths)
+	}
+
+	stop := errors.New("stop")
+	var visited int
+	err = img.SquashedWalk(func(file.Path, file.Reference, file.Metadata, file.OpenerFn) error {
+		visited++
+		return stop
+	})
+	if !errors.Is(err, stop) || visited != 1 {
+		t.Errorf("expected the walk to stop on the first error: visited=%d err=%+v", visited, err)
+	}
+}
@@ -0,0 +1,89 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/filesystem/squashfs"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// SquashfsLayerMediaType is the media type of a layer blob that is a squashfs image instead of a tar (e.g. within a
+// SIF image). Layers with squashfs content are detected from the content regardless of the media type.
+const SquashfsLayerMediaType types.MediaType = "application/vnd.sylabs.sif.layer.v1.squashfs"
+
+// isSquashfsLayer indicates that the media type is for a squashfs layer blob.
+func isSquashfsLayer(mediaType types.MediaType) bool {
+	return mediaType == SquashfsLayerMediaType
+}
+
+// squashfsTarReader provides the tar stream converted from a squashfs image that was spooled to disk (squashfs
+// requires random access). Closing the reader removes the spooled image.
+type squashfsTarReader struct {
+	*io.PipeReader
+	spool *os.File
+	done  chan struct{}
+}
+
+func (r *squashfsTarReader) Close() error {
+	r.PipeReader.Close()
+	<-r.done
+	r.spool.Close()
+	return os.Remove(r.spool.Name())
+}
+
+// squashfsAsTar provides the given (uncompressed) layer content as a tar stream: squashfs content is converted to a
+// tar, any other content is provided as-is.
+func (l *Layer) squashfsAsTar(reader io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+	// note: a short read (e.g. an empty layer) is not an error, the content is simply not squashfs
+	header, err := buffered.Peek(4)
+	if err != nil && err != io.EOF {
+		reader.Close()
+		return nil, fmt.Errorf("unable to inspect layer=%q content: %w", l.Metadata.Digest, err)
+	}
+	if !squashfs.IsSquashfs(header) {
+		return &extentReadCloser{Reader: buffered, Closer: reader}, nil
+	}
+	defer reader.Close()
+
+	spool, err := ioutil.TempFile(l.uncompressedLayersCacheDir, "squashfs-layer-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to spool squashfs layer=%q: %w", l.Metadata.Digest, err)
+	}
+	fs, err := spoolSquashfs(spool, buffered)
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("unable to read squashfs layer=%q: %w", l.Metadata.Digest, err)
+	}
+
+	if !l.squashfs {
+		l.squashfs = true
+		log.Debugf("layer=%q is a squashfs image (compression=%s), converting to a tar", l.Metadata.Digest, fs.Compression())
+	}
+
+	pr, pw := io.Pipe()
+	converted := &squashfsTarReader{
+		PipeReader: pr,
+		spool:      spool,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(converted.done)
+		pw.CloseWithError(fs.WriteTar(pw))
+	}()
+	return converted, nil
+}
+
+// spoolSquashfs writes the given squashfs content to the given file and opens the squashfs image within it.
+func spoolSquashfs(spool *os.File, content io.Reader) (*squashfs.Reader, error) {
+	if _, err := io.Copy(spool, content); err != nil {
+		return nil, err
+	}
+	return squashfs.NewReader(spool)
+}
@@ -0,0 +1,107 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// squashfsTestLayer is a layer whose blob is a squashfs image (which the GCR lib cannot uncompress).
+type squashfsTestLayer struct {
+	blob []byte
+}
+
+func (l squashfsTestLayer) Digest() (v1.Hash, error) {
+	return v1.NewHash(fmt.Sprintf("sha256:%x", sha256.Sum256(l.blob)))
+}
+
+func (l squashfsTestLayer) DiffID() (v1.Hash, error) {
+	return l.Digest()
+}
+
+func (l squashfsTestLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.blob)), nil
+}
+
+func (l squashfsTestLayer) Uncompressed() (io.ReadCloser, error) {
+	return nil, errors.New("gzip: invalid header")
+}
+
+func (l squashfsTestLayer) Size() (int64, error) {
+	return int64(len(l.blob)), nil
+}
+
+func (l squashfsTestLayer) MediaType() (types.MediaType, error) {
+	return SquashfsLayerMediaType, nil
+}
+
+func TestImage_SquashfsLayer(t *testing.T) {
+	// a gzip compressed squashfs image with:
+	//   /dev/null (char device), /dev/pipe (fifo), /dev/sock (socket)
+	//   /etc/empty, /etc/os-release ("ID=test\n")
+	//   /usr/app (10000 bytes), /usr/app-link (hardlink to /usr/app), /usr/release (symlink to ../etc/os-release)
+	blob, err := ioutil.ReadFile("test-fixtures/squashfs/rootfs.sqfs")
+	if err != nil {
+		t.Fatalf("could not read fixture: %+v", err)
+	}
+
+	tests := []struct {
+		name    string
+		options []ReadOption
+	}{
+		{
+			name: "cached layer tar",
+		},
+		{
+			name:    "streamed layer tar",
+			options: []ReadOption{WithStreamingLayers()},
+		},
+		{
+			name:    "verified layer digests",
+			options: []ReadOption{WithLayerDigestPolicy(FailOnLayerDigestMismatch)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := newTestImage(t, []v1.Layer{squashfsTestLayer{blob: blob}})
+			if err := img.Read(test.options...); err != nil {
+				t.Fatalf("could not read image: %+v", err)
+			}
+
+			reader, err := img.FileContentsFromSquash("/usr/release")
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			assertContents(t, reader, "ID=test\n")
+
+			reader, err = img.FileContentsFromSquash("/usr/app-link")
+			if err != nil {
+				t.Fatalf("could not get contents: %+v", err)
+			}
+			assertContents(t, reader, string(bytes.Repeat([]byte("0123456789"), 1000)))
+
+			metadata, err := img.FileMetadataFromSquash("/dev/null")
+			if err != nil {
+				t.Fatalf("could not get metadata: %+v", err)
+			}
+			if metadata.TypeFlag != tar.TypeChar {
+				t.Errorf("unexpected type: %+v", metadata.TypeFlag)
+			}
+			if squashedTreeOf(t, img).HasPath("/dev/sock") {
+				t.Errorf("expected sockets to be skipped")
+			}
+			if len(img.Layers[0].Metadata.Warnings) != 0 {
+				t.Errorf("unexpected warnings: %+v", img.Layers[0].Metadata.Warnings)
+			}
+		})
+	}
+}
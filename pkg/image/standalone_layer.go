@@ -0,0 +1,59 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/filetree"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ReadLayer reads a single layer blob on its own (without the image the layer belongs to), building the layer tree
+// and a file catalog for just this blob. This is useful for tracking results per layer (keyed by the layer digest)
+// without reading every image that contains the layer. Since no lower layers are known, the layer is at index 0 and
+// the squash tree is the layer tree (so links into lower layers cannot be resolved). The uncompressed layer tar is
+// cached within the given dir.
+func ReadLayer(ctx context.Context, layer v1.Layer, contentCacheDir string) (*Layer, error) {
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get layer diff ID: %w", err)
+	}
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get layer=%q media type: %w", diffID, err)
+	}
+
+	catalog := NewFileCatalog(contentCacheDir)
+
+	l := NewLayer(layer)
+	l.Metadata = LayerMetadata{
+		Digest:    diffID.String(),
+		MediaType: mediaType,
+	}
+	l.Tree = filetree.NewFileTree()
+	l.fileCatalog = &catalog
+	l.uncompressedLayersCacheDir = contentCacheDir
+
+	if err := l.index(ctx); err != nil {
+		return nil, err
+	}
+	l.SquashedTree = l.Tree
+
+	return l, nil
+}
+
+// SetCleanup associates the function that removes all temp dirs created for a layer read on its own (e.g. the cached
+// uncompressed layer tar), see Layer.Cleanup.
+func (l *Layer) SetCleanup(fn func() error) {
+	l.cleanup = fn
+}
+
+// Cleanup removes all temp dirs created for a layer read on its own (see SetCleanup), after which no file contents can
+// be read from the layer. Layers of an image are left as-is (these are removed along with the image, see
+// Image.Cleanup).
+func (l *Layer) Cleanup() error {
+	if l.cleanup == nil {
+		return nil
+	}
+	return l.cleanup()
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadLayer(t *testing.T) {
+	v1Layer := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts"},
+		tar.Header{Typeflag: tar.TypeSymlink, Name: "hosts", Linkname: "/etc/hosts"},
+	)
+
+	layer, err := ReadLayer(context.Background(), v1Layer, testTempDir(t))
+	if err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	diffID, err := v1Layer.DiffID()
+	if err != nil {
+		t.Fatalf("could not get diff ID: %+v", err)
+	}
+	if layer.Metadata.Digest != diffID.String() {
+		t.Errorf("unexpected digest: %q != %q", layer.Metadata.Digest, diffID.String())
+	}
+	if layer.Metadata.Index != 0 {
+		t.Errorf("unexpected index: %d", layer.Metadata.Index)
+	}
+	if len(layer.Tree.AllFiles()) != 1 {
+		t.Errorf("unexpected files: %+v", layer.Tree.AllFiles())
+	}
+
+	reader, err := layer.FileContentsFromSquash("/hosts")
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	if string(contents) != "etc/hosts" {
+		t.Errorf("unexpected contents: %q", string(contents))
+	}
+}
+
+func TestReadLayer_Cleanup(t *testing.T) {
+	layer, err := ReadLayer(context.Background(), newTestLayer(t, nil, tar.Header{Typeflag: tar.TypeReg, Name: "file"}), testTempDir(t))
+	if err != nil {
+		t.Fatalf("could not read layer: %+v", err)
+	}
+
+	// note: nothing is removed for layers without temp dirs of their own
+	if err := layer.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup layer: %+v", err)
+	}
+
+	var calls int
+	layer.SetCleanup(func() error {
+		calls++
+		return nil
+	})
+	if err := layer.Cleanup(); err != nil {
+		t.Fatalf("could not cleanup layer: %+v", err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected cleanup calls: %d", calls)
+	}
+}
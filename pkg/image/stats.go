@@ -0,0 +1,132 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// Stats summarizes the contents of the image squash tree and each layer tree.
+type Stats struct {
+	// Squashed describes the image squash tree (the final filesystem of the image).
+	Squashed TreeStats
+	// Layers describes what each layer tree contributes to the image (in build order).
+	Layers []LayerStats
+}
+
+// TreeStats summarizes the paths within a single file tree.
+type TreeStats struct {
+	// Files is the number of regular files (and other non-directory, non-link entries such as devices or FIFOs).
+	Files int
+	// Dirs is the number of directories (including directories only implied by other paths).
+	Dirs int
+	// Symlinks is the number of symbolic links.
+	Symlinks int
+	// HardLinks is the number of hard links.
+	HardLinks int
+	// RegularFileBytes is the sum of the sizes of all regular files.
+	RegularFileBytes int64
+}
+
+// LayerStats summarizes the paths within a single layer tree.
+type LayerStats struct {
+	TreeStats
+	// Whiteouts is the number of whiteout entries (paths the layer removes from lower layers), which are not counted
+	// as files.
+	Whiteouts int
+	// OpaqueWhiteouts is the number of opaque whiteout entries (directories the layer clears of all lower layer
+	// content), which are not counted as files or as whiteouts.
+	OpaqueWhiteouts int
+}
+
+// Stats returns counts of all paths by type (and the total size of all regular files) for the image squash tree and
+// each layer tree. The result is computed on first use and reused for all later calls.
+func (i *Image) Stats() (Stats, error) {
+	if i.stats != nil {
+		return i.stats.copy(), nil
+	}
+
+	if err := i.IndexLayers(context.Background()); err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Layers: make([]LayerStats, len(i.Layers)),
+	}
+
+	for idx, layer := range i.Layers {
+		layerStats, err := i.layerStats(layer.Tree)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Layers[idx] = layerStats
+	}
+
+	if squashedTree := i.squashedTree(); squashedTree != nil {
+		squashedStats, err := i.layerStats(squashedTree)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Squashed = squashedStats.TreeStats
+	}
+
+	i.stats = &stats
+	return stats.copy(), nil
+}
+
+// copy returns a copy of the stats that does not share the per-layer stats.
+func (s Stats) copy() Stats {
+	layers := make([]LayerStats, len(s.Layers))
+	copy(layers, s.Layers)
+	s.Layers = layers
+	return s
+}
+
+// layerStats tallies all paths within the given tree (whiteouts are only expected within layer trees).
+func (i *Image) layerStats(tree *filetree.FileTree) (LayerStats, error) {
+	var stats LayerStats
+	if tree == nil {
+		return stats, nil
+	}
+
+	for _, n := range tree.Reader().Nodes() {
+		fn := n.(*filenode.FileNode)
+		switch fn.FileType {
+		case file.TypeDir:
+			stats.Dirs++
+		case file.TypeSymlink:
+			stats.Symlinks++
+		case file.TypeHardLink:
+			stats.HardLinks++
+		default:
+			switch {
+			case fn.RealPath.IsDirWhiteout():
+				stats.OpaqueWhiteouts++
+				continue
+			case fn.RealPath.IsWhiteout():
+				stats.Whiteouts++
+				continue
+			}
+			stats.Files++
+
+			if fn.Reference == nil {
+				continue
+			}
+			entry, err := i.FileCatalog.Get(*fn.Reference)
+			if errors.Is(err, ErrFileNotFound) {
+				continue
+			} else if err != nil {
+				return LayerStats{}, err
+			}
+			if entry.Metadata.TypeFlag == tar.TypeReg || entry.Metadata.TypeFlag == tar.TypeRegA {
+				stats.RegularFileBytes += entry.Metadata.Size
+			}
+		}
+	}
+
+	return stats, nil
+}
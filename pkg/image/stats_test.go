@@ -0,0 +1,64 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestImage_Stats(t *testing.T) {
+	img := newTestImage(t, []v1.Layer{
+		newTestLayer(t, map[string]string{"etc/passwd": "root", "etc/group": "root", "usr/lib/a": "aaaa"}),
+		newTestLayer(t, map[string]string{"etc/.wh.group": "", "usr/lib/.wh..wh..opq": "", "usr/lib/b": "bb"}),
+	})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	expected := Stats{
+		Squashed: TreeStats{
+			Files:            2,
+			Dirs:             4,
+			RegularFileBytes: 6,
+		},
+		Layers: []LayerStats{
+			{
+				TreeStats: TreeStats{
+					Files:            3,
+					Dirs:             4,
+					RegularFileBytes: 12,
+				},
+			},
+			{
+				TreeStats: TreeStats{
+					Files:            1,
+					Dirs:             4,
+					RegularFileBytes: 2,
+				},
+				Whiteouts:       1,
+				OpaqueWhiteouts: 1,
+			},
+		},
+	}
+
+	actual, err := img.Stats()
+	if err != nil {
+		t.Fatalf("could not get stats: %+v", err)
+	}
+	for _, d := range deep.Equal(expected, actual) {
+		t.Errorf("diff: %+v", d)
+	}
+
+	// the result is reused for later calls
+	if img.stats == nil {
+		t.Fatalf("expected stats to be cached")
+	}
+	again, err := img.Stats()
+	if err != nil {
+		t.Fatalf("could not get stats: %+v", err)
+	}
+	for _, d := range deep.Equal(actual, again) {
+		t.Errorf("diff: %+v", d)
+	}
+}
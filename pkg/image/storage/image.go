@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// whiteoutPrefix marks a path deleted by a layer within a tar (the overlay driver uses a 0/0 char device instead).
+	whiteoutPrefix = ".wh."
+	// opaqueWhiteout marks a dir whose lower layer contents are hidden within a tar (the overlay driver uses an xattr).
+	opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// storageImage is a v1.Image for an image within a containers/storage store, built from the stored manifest and config
+// with layers that are read from the unpacked layer content within the store.
+type storageImage struct {
+	rawManifest []byte
+	rawConfig   []byte
+	manifest    *v1.Manifest
+	layers      []*storageLayer
+}
+
+var _ v1.Image = (*storageImage)(nil)
+
+// newStorageImage creates the image for the given record, pairing the stored layers with the layers of the manifest.
+func newStorageImage(s store, record *imageRecord) (*storageImage, error) {
+	rawManifest, err := s.manifest(record)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse containers-storage image=%q manifest: %w", record.ID, err)
+	}
+	rawConfig, err := s.bigData(record, "sha256:"+record.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := s.layerChain(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) != len(manifest.Layers) {
+		return nil, fmt.Errorf("containers-storage image=%q has %d stored layers but %d manifest layers", record.ID, len(chain), len(manifest.Layers))
+	}
+
+	img := &storageImage{
+		rawManifest: rawManifest,
+		rawConfig:   rawConfig,
+		manifest:    manifest,
+	}
+	for idx, layer := range chain {
+		diffID, err := v1.NewHash(layer.DiffDigest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid containers-storage layer=%q diff digest: %w", layer.ID, err)
+		}
+		img.layers = append(img.layers, &storageLayer{
+			descriptor: manifest.Layers[idx],
+			diffID:     diffID,
+			diffDir:    s.diffDir(layer.ID),
+		})
+	}
+	return img, nil
+}
+
+func (i *storageImage) Layers() ([]v1.Layer, error) {
+	var layers = make([]v1.Layer, len(i.layers))
+	for idx, layer := range i.layers {
+		layers[idx] = layer
+	}
+	return layers, nil
+}
+
+func (i *storageImage) MediaType() (types.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *storageImage) Size() (int64, error) {
+	return int64(len(i.rawManifest)), nil
+}
+
+func (i *storageImage) ConfigName() (v1.Hash, error) {
+	return partial.ConfigName(i)
+}
+
+func (i *storageImage) ConfigFile() (*v1.ConfigFile, error) {
+	return partial.ConfigFile(i)
+}
+
+func (i *storageImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+func (i *storageImage) Digest() (v1.Hash, error) {
+	return partial.Digest(i)
+}
+
+func (i *storageImage) Manifest() (*v1.Manifest, error) {
+	return i.manifest, nil
+}
+
+func (i *storageImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *storageImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	for _, layer := range i.layers {
+		if layer.descriptor.Digest == h {
+			return layer, nil
+		}
+	}
+	return nil, fmt.Errorf("containers-storage layer with digest=%q not found", h)
+}
+
+func (i *storageImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	for _, layer := range i.layers {
+		if layer.diffID == h {
+			return layer, nil
+		}
+	}
+	return nil, fmt.Errorf("containers-storage layer with diffID=%q not found", h)
+}
+
+// storageLayer is a v1.Layer whose content is the unpacked layer dir within a containers/storage store. The digests and
+// size are as recorded by the store, however the content is reconstructed from the unpacked dir (as a tar with overlay
+// whiteouts translated to tar whiteouts), so it will typically not match the recorded digests byte for byte.
+type storageLayer struct {
+	descriptor v1.Descriptor
+	diffID     v1.Hash
+	diffDir    string
+}
+
+var _ v1.Layer = (*storageLayer)(nil)
+
+func (l *storageLayer) Digest() (v1.Hash, error) {
+	return l.descriptor.Digest, nil
+}
+
+func (l *storageLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *storageLayer) Size() (int64, error) {
+	return l.descriptor.Size, nil
+}
+
+func (l *storageLayer) MediaType() (types.MediaType, error) {
+	return l.descriptor.MediaType, nil
+}
+
+// Uncompressed returns the unpacked layer dir as an uncompressed tar.
+func (l *storageLayer) Uncompressed() (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		err := file.WriteDirTar(context.Background(), l.diffDir, writer, file.DirTarOptions{
+			Rewrite: rewriteOverlayWhiteout,
+		})
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// Compressed returns the unpacked layer dir as a gzipped tar.
+func (l *storageLayer) Compressed() (io.ReadCloser, error) {
+	uncompressed, err := l.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		defer uncompressed.Close()
+		gz := gzip.NewWriter(writer)
+		if _, err := io.Copy(gz, uncompressed); err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		writer.CloseWithError(gz.Close())
+	}()
+	return reader, nil
+}
+
+// rewriteOverlayWhiteout translates overlay whiteouts (a 0/0 char device for a deleted path and an opaque xattr for a
+// dir that hides lower layer contents) into the equivalent tar whiteout entries.
+func rewriteOverlayWhiteout(p string, header *tar.Header) []*tar.Header {
+	switch header.Typeflag {
+	case tar.TypeChar:
+		if header.Devmajor != 0 || header.Devminor != 0 {
+			break
+		}
+		dir, base := path.Split(header.Name)
+		return []*tar.Header{whiteoutHeader(header, dir+whiteoutPrefix+base)}
+	case tar.TypeDir:
+		if !isOpaqueDir(p) {
+			break
+		}
+		return []*tar.Header{header, whiteoutHeader(header, header.Name+opaqueWhiteout)}
+	}
+	return []*tar.Header{header}
+}
+
+// whiteoutHeader creates an (empty) whiteout file entry with the given name, owned as the given entry.
+func whiteoutHeader(header *tar.Header, name string) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Uid:      header.Uid,
+		Gid:      header.Gid,
+		ModTime:  header.ModTime,
+		Format:   header.Format,
+	}
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// ListImages lists all images within the containers/storage store at the given root (the store of the current user
+// when empty, see DefaultRoot), reading only the image records of the store (no manifests, configs, or layers).
+func ListImages(root string) ([]image.ListedImage, error) {
+	if root == "" {
+		root = DefaultRoot()
+	}
+
+	s := store{root: root}
+	if _, err := os.Stat(s.imagesDir()); err != nil {
+		return nil, fmt.Errorf("unable to read containers-storage store=%q (only the %s driver is supported): %w", root, overlayDriver, err)
+	}
+
+	records, err := s.images()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]image.ListedImage, len(records))
+	for idx, record := range records {
+		images[idx] = image.ListedImage{
+			// note: the image ID within the store is the (hex) digest of the image config
+			ID:             "sha256:" + record.ID,
+			ManifestDigest: record.Digest,
+			Tags:           record.tags(),
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+)
+
+func TestListImages(t *testing.T) {
+	root := newTestStore(t, []string{"docker.io/library/test:latest", "docker.io/library/test@" + testManifestDigest, "localhost/built:1.0"},
+		testLayer{id: "base"},
+	)
+
+	images, err := ListImages(root)
+	if err != nil {
+		t.Fatalf("could not list images: %+v", err)
+	}
+
+	expected := []image.ListedImage{
+		{
+			ID:             "sha256:" + testImageID,
+			ManifestDigest: testManifestDigest,
+			// note: names that are not tags (e.g. by digest) are not listed
+			Tags: []string{"docker.io/library/test:latest", "localhost/built:1.0"},
+		},
+	}
+	for _, d := range deep.Equal(expected, images) {
+		t.Errorf("unexpected listed images: %s", d)
+	}
+}
+
+func TestListImages_MissingStore(t *testing.T) {
+	_, err := ListImages("/does/not/exist")
+	if err == nil || !strings.Contains(err.Error(), "only the overlay driver is supported") {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import "syscall"
+
+// opaqueXattrs mark an overlay dir as opaque (the user namespace variant is used by rootless stores).
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// isOpaqueDir indicates if the given overlay dir hides the contents of the same dir within lower layers.
+func isOpaqueDir(path string) bool {
+	value := make([]byte, 1)
+	for _, attr := range opaqueXattrs {
+		n, err := syscall.Getxattr(path, attr, value)
+		if err == nil && n == 1 && value[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package storage
+
+// isOpaqueDir indicates if the given overlay dir hides the contents of the same dir within lower layers (overlay
+// stores only exist on linux, so there are no opaque dirs elsewhere).
+func isOpaqueDir(string) bool {
+	return false
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/mitchellh/go-homedir"
+)
+
+const (
+	// overlayDriver is the only storage driver supported (the default for podman and CRI-O).
+	overlayDriver = "overlay"
+	// manifestBigDataKey is the key of the image manifest stored alongside an image.
+	manifestBigDataKey = "manifest"
+	// localhostRegistry is the registry podman assigns to images built locally without a registry.
+	localhostRegistry = "localhost"
+)
+
+// hexPattern matches (part of) an image ID.
+var hexPattern = regexp.MustCompile(`^[a-f0-9]{3,64}$`)
+
+// imageRecord is a single image within the images.json of a store.
+type imageRecord struct {
+	ID           string   `json:"id"`
+	Digest       string   `json:"digest,omitempty"`
+	Digests      []string `json:"digests,omitempty"`
+	Names        []string `json:"names,omitempty"`
+	TopLayer     string   `json:"layer,omitempty"`
+	BigDataNames []string `json:"big-data-names,omitempty"`
+}
+
+// layerRecord is a single layer within the layers.json of a store.
+type layerRecord struct {
+	ID         string `json:"id"`
+	Parent     string `json:"parent,omitempty"`
+	DiffDigest string `json:"diff-digest,omitempty"`
+	DiffSize   int64  `json:"diff-size,omitempty"`
+}
+
+// store is a containers/storage store (as used by podman and CRI-O) with the overlay driver.
+type store struct {
+	root string
+}
+
+// DefaultRoot returns the containers/storage root of the current user (the system store for root, otherwise the
+// rootless store within the user data dir).
+func DefaultRoot() string {
+	if os.Geteuid() == 0 {
+		return "/var/lib/containers/storage"
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "containers", "storage")
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return filepath.Join(".local", "share", "containers", "storage")
+	}
+	return filepath.Join(home, ".local", "share", "containers", "storage")
+}
+
+// parseStoreReference splits an optional store specification from the given image reference, as in
+// "[overlay@/var/lib/containers/storage+/run/containers/storage]alpine:latest" (the driver and run root are optional
+// and ignored), returning the store root (empty when not specified) and the image reference.
+func parseStoreReference(imgStr string) (string, string, error) {
+	if !strings.HasPrefix(imgStr, "[") {
+		return "", imgStr, nil
+	}
+	end := strings.Index(imgStr, "]")
+	if end < 0 {
+		return "", "", fmt.Errorf("invalid containers-storage reference=%q: unterminated store specification", imgStr)
+	}
+	spec, ref := imgStr[1:end], imgStr[end+1:]
+
+	if idx := strings.Index(spec, "@"); idx >= 0 {
+		if driver := spec[:idx]; driver != overlayDriver {
+			return "", "", fmt.Errorf("unsupported containers-storage driver=%q (only %q is supported)", driver, overlayDriver)
+		}
+		spec = spec[idx+1:]
+	}
+	if idx := strings.Index(spec, "+"); idx >= 0 {
+		spec = spec[:idx]
+	}
+	return spec, ref, nil
+}
+
+func (s store) imagesDir() string {
+	return filepath.Join(s.root, overlayDriver+"-images")
+}
+
+func (s store) layersDir() string {
+	return filepath.Join(s.root, overlayDriver+"-layers")
+}
+
+// diffDir is where the (unpacked) content of the given layer is stored.
+func (s store) diffDir(layerID string) string {
+	return filepath.Join(s.root, overlayDriver, layerID, "diff")
+}
+
+func (s store) images() ([]imageRecord, error) {
+	var records []imageRecord
+	if err := readStoreJSON(filepath.Join(s.imagesDir(), "images.json"), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s store) layers() (map[string]layerRecord, error) {
+	var records []layerRecord
+	if err := readStoreJSON(filepath.Join(s.layersDir(), "layers.json"), &records); err != nil {
+		return nil, err
+	}
+	var byID = make(map[string]layerRecord)
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+	return byID, nil
+}
+
+func readStoreJSON(path string, v interface{}) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no containers-storage %s store at=%q: %w", overlayDriver, filepath.Dir(filepath.Dir(path)), err)
+		}
+		return fmt.Errorf("unable to read containers-storage file=%q: %w", path, err)
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		return fmt.Errorf("unable to parse containers-storage file=%q: %w", path, err)
+	}
+	return nil
+}
+
+// findImage returns the image for the given reference, which is an image ID (or a unique prefix of one), or an
+// image name (short names also match images built locally, which are named under "localhost/").
+func (s store) findImage(ref string) (*imageRecord, error) {
+	records, err := s.images()
+	if err != nil {
+		return nil, err
+	}
+
+	id := strings.TrimPrefix(ref, "sha256:")
+	if hexPattern.MatchString(id) {
+		var matches []*imageRecord
+		for idx := range records {
+			if strings.HasPrefix(records[idx].ID, id) {
+				matches = append(matches, &records[idx])
+			}
+		}
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("ambiguous containers-storage image ID=%q (matches %d images)", id, len(matches))
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+	}
+
+	candidates := []string{ref}
+	if !hasRegistry(ref) {
+		candidates = append(candidates, localhostRegistry+"/"+ref)
+	}
+	for _, candidate := range candidates {
+		parsed, err := name.ParseReference(candidate, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		for idx := range records {
+			if records[idx].matches(parsed) {
+				return &records[idx], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no containers-storage image found for reference=%q", ref)
+}
+
+// hasRegistry indicates if the given image reference starts with a registry (as opposed to a short name).
+func hasRegistry(ref string) bool {
+	parts := strings.SplitN(ref, "/", 2)
+	return len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == localhostRegistry)
+}
+
+// matches indicates if the image is named by the given reference (by tag, or by repository and manifest digest).
+func (r imageRecord) matches(ref name.Reference) bool {
+	for _, n := range r.Names {
+		parsed, err := name.ParseReference(n, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		if parsed.Name() == ref.Name() {
+			return true
+		}
+		if digest, ok := ref.(name.Digest); ok && parsed.Context().Name() == digest.Context().Name() {
+			for _, d := range append([]string{r.Digest}, r.Digests...) {
+				if d == digest.DigestStr() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// tags returns all names of the image that are tags.
+func (r imageRecord) tags() []string {
+	var tags []string
+	for _, n := range r.Names {
+		if _, err := name.NewTag(n, name.WeakValidation); err == nil {
+			tags = append(tags, n)
+		}
+	}
+	return tags
+}
+
+// bigData reads the data stored alongside the given image under the given key (e.g. the manifest or the config).
+func (s store) bigData(record *imageRecord, key string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(s.imagesDir(), record.ID, bigDataFileName(key)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read containers-storage image=%q data=%q: %w", record.ID, key, err)
+	}
+	return contents, nil
+}
+
+// manifest reads the manifest stored alongside the given image (stores may key manifests by digest instead).
+func (s store) manifest(record *imageRecord) ([]byte, error) {
+	key := manifestBigDataKey
+	for _, n := range record.BigDataNames {
+		if n == manifestBigDataKey {
+			key = n
+			break
+		}
+		if strings.HasPrefix(n, manifestBigDataKey+"-") {
+			key = n
+		}
+	}
+	return s.bigData(record, key)
+}
+
+// bigDataFileName is the file name for the given data key, where keys with characters outside of [0-9a-z.] are
+// base64 encoded (as by containers/storage).
+func bigDataFileName(key string) string {
+	for _, ch := range key {
+		if ch != '.' && !(ch >= '0' && ch <= '9') && !(ch >= 'a' && ch <= 'z') {
+			return "=" + base64.StdEncoding.EncodeToString([]byte(key))
+		}
+	}
+	return key
+}
+
+// layerChain returns the layers of the image from the base layer to the top layer.
+func (s store) layerChain(record *imageRecord) ([]layerRecord, error) {
+	layers, err := s.layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []layerRecord
+	for id := record.TopLayer; id != ""; {
+		layer, ok := layers[id]
+		if !ok {
+			return nil, fmt.Errorf("containers-storage layer=%q of image=%q not found", id, record.ID)
+		}
+		if len(chain) > len(layers) {
+			return nil, fmt.Errorf("containers-storage layer=%q has a cyclic parent chain", id)
+		}
+		chain = append([]layerRecord{layer}, chain...)
+		id = layer.Parent
+	}
+	return chain, nil
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	testImageID        = "3f53bb00af943dfdf815650be70c0fa7b426e56a66f5e3362b47a129d57d5991"
+	testManifestDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+)
+
+// testLayer is a single layer of the test store, with the given files written to the unpacked layer dir.
+type testLayer struct {
+	id    string
+	files map[string]string
+}
+
+// newTestStore creates a containers/storage store (overlay driver) with a single image made of the given layers.
+func newTestStore(t *testing.T, names []string, layers ...testLayer) string {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "stereoscope-containers-storage-test-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	s := store{root: root}
+	var layerRecords []layerRecord
+	var config v1.ConfigFile
+	var manifest = v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.DockerManifestSchema2,
+	}
+	config.OS = "linux"
+	config.Architecture = "amd64"
+	config.RootFS.Type = "layers"
+
+	for idx, layer := range layers {
+		for p, contents := range layer.files {
+			dest := filepath.Join(s.diffDir(layer.id), p)
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				t.Fatalf("could not create dir: %+v", err)
+			}
+			if err := ioutil.WriteFile(dest, []byte(contents), 0644); err != nil {
+				t.Fatalf("could not write file: %+v", err)
+			}
+		}
+
+		diffID := v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%064x", idx+1)}
+		record := layerRecord{ID: layer.id, DiffDigest: diffID.String()}
+		if idx > 0 {
+			record.Parent = layers[idx-1].id
+		}
+		layerRecords = append(layerRecords, record)
+
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+		manifest.Layers = append(manifest.Layers, v1.Descriptor{
+			MediaType: types.DockerLayer,
+			Digest:    v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%064x", idx+100)},
+			Size:      100,
+		})
+	}
+
+	images := []imageRecord{
+		{
+			ID:           testImageID,
+			Digest:       testManifestDigest,
+			Names:        names,
+			TopLayer:     layers[len(layers)-1].id,
+			BigDataNames: []string{manifestBigDataKey, "sha256:" + testImageID},
+		},
+	}
+
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("could not encode config: %+v", err)
+	}
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(rawConfig))
+	if err != nil {
+		t.Fatalf("could not digest config: %+v", err)
+	}
+	manifest.Config = v1.Descriptor{
+		MediaType: types.DockerConfigJSON,
+		Digest:    configDigest,
+		Size:      configSize,
+	}
+
+	writeTestJSON(t, filepath.Join(s.imagesDir(), "images.json"), images)
+	writeTestJSON(t, filepath.Join(s.layersDir(), "layers.json"), layerRecords)
+	writeTestJSON(t, filepath.Join(s.imagesDir(), testImageID, bigDataFileName(manifestBigDataKey)), manifest)
+	writeTestFile(t, filepath.Join(s.imagesDir(), testImageID, bigDataFileName("sha256:"+testImageID)), rawConfig)
+	return root
+}
+
+func writeTestJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	contents, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("could not encode json: %+v", err)
+	}
+	writeTestFile(t, path, contents)
+}
+
+func writeTestFile(t *testing.T, path string, contents []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("could not create dir: %+v", err)
+	}
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+}
+
+func TestImageProvider_Provide(t *testing.T) {
+	root := newTestStore(t, []string{"docker.io/library/test:latest"},
+		testLayer{id: "base", files: map[string]string{"etc/os-release": "ID=base", "usr/bin/app": "v1"}},
+		testLayer{id: "top", files: map[string]string{"usr/bin/app": "v2"}},
+	)
+
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	img, err := NewProviderFromStore("["+root+"]test", &tmpDirGen).Provide(context.Background())
+	if err != nil {
+		t.Fatalf("could not provide image: %+v", err)
+	}
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	if len(img.Layers) != 2 {
+		t.Fatalf("unexpected number of layers: %d", len(img.Layers))
+	}
+	if img.Metadata.Origin.Source != image.ContainersStorageSource || img.Metadata.Origin.Location != root {
+		t.Errorf("unexpected origin: %+v", img.Metadata.Origin)
+	}
+	if len(img.Metadata.Tags) != 1 || img.Metadata.Tags[0].TagStr() != "latest" {
+		t.Errorf("unexpected tags: %+v", img.Metadata.Tags)
+	}
+
+	for p, expected := range map[string]string{"/etc/os-release": "ID=base", "/usr/bin/app": "v2"} {
+		contents, err := img.FileContentsFromSquash(file.Path(p))
+		if err != nil {
+			t.Fatalf("could not get contents of %q: %+v", p, err)
+		}
+		actual, err := ioutil.ReadAll(contents)
+		contents.Close()
+		if err != nil {
+			t.Fatalf("could not read contents of %q: %+v", p, err)
+		}
+		if string(actual) != expected {
+			t.Errorf("unexpected contents of %q: %q", p, string(actual))
+		}
+	}
+}
+
+func TestImageProvider_Provide_MissingStore(t *testing.T) {
+	tmpDirGen := file.NewTempDirGenerator()
+	defer tmpDirGen.Cleanup()
+
+	_, err := NewProviderFromStore("[/does/not/exist]test", &tmpDirGen).Provide(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "only the overlay driver is supported") {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+func TestStore_FindImage(t *testing.T) {
+	root := newTestStore(t, []string{"docker.io/library/test:latest", "localhost/built:1.0"},
+		testLayer{id: "base"},
+	)
+	s := store{root: root}
+
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "test"},
+		{ref: "test:latest"},
+		{ref: "docker.io/library/test:latest"},
+		{ref: "index.docker.io/library/test"},
+		{ref: "built:1.0"},
+		{ref: "localhost/built:1.0"},
+		{ref: "test@" + testManifestDigest},
+		{ref: testImageID},
+		{ref: testImageID[:12]},
+		{ref: "sha256:" + testImageID},
+		{ref: "test:other", wantErr: true},
+		{ref: "built", wantErr: true},
+		{ref: "other@" + testManifestDigest, wantErr: true},
+		{ref: "abcdef", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			record, err := s.findImage(test.ref)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, found image=%q", record.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not find image: %+v", err)
+			}
+			if record.ID != testImageID {
+				t.Errorf("unexpected image: %q", record.ID)
+			}
+		})
+	}
+}
+
+func TestParseStoreReference(t *testing.T) {
+	tests := []struct {
+		input   string
+		root    string
+		ref     string
+		wantErr bool
+	}{
+		{input: "alpine:latest", ref: "alpine:latest"},
+		{input: "[/var/lib/containers/storage]alpine", root: "/var/lib/containers/storage", ref: "alpine"},
+		{input: "[overlay@/store+/run/store]alpine", root: "/store", ref: "alpine"},
+		{input: "[vfs@/store]alpine", wantErr: true},
+		{input: "[/store alpine", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			root, ref, err := parseStoreReference(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if root != test.root || ref != test.ref {
+				t.Errorf("unexpected root=%q ref=%q", root, ref)
+			}
+		})
+	}
+}
+
+func TestBigDataFileName(t *testing.T) {
+	if actual := bigDataFileName("manifest"); actual != "manifest" {
+		t.Errorf("unexpected file name: %q", actual)
+	}
+	if actual := bigDataFileName("sha256:abc"); actual != "=c2hhMjU2OmFiYw==" {
+		t.Errorf("unexpected file name: %q", actual)
+	}
+}
+
+func TestRewriteOverlayWhiteout(t *testing.T) {
+	deleted := &tar.Header{Typeflag: tar.TypeChar, Name: "etc/removed", Uid: 1, Gid: 2}
+	headers := rewriteOverlayWhiteout("/unused", deleted)
+	if len(headers) != 1 || headers[0].Typeflag != tar.TypeReg || headers[0].Name != "etc/.wh.removed" || headers[0].Uid != 1 {
+		t.Errorf("unexpected whiteout headers: %+v", headers)
+	}
+
+	device := &tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Devmajor: 1, Devminor: 3}
+	if headers := rewriteOverlayWhiteout("/unused", device); len(headers) != 1 || headers[0] != device {
+		t.Errorf("unexpected device headers: %+v", headers)
+	}
+
+	dir := &tar.Header{Typeflag: tar.TypeDir, Name: "etc/"}
+	if headers := rewriteOverlayWhiteout(os.TempDir(), dir); len(headers) != 1 || headers[0] != dir {
+		t.Errorf("unexpected dir headers: %+v", headers)
+	}
+}
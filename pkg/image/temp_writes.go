@@ -0,0 +1,75 @@
+package image
+
+import (
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+const (
+	// LayerTarWrite is an uncompressed layer tar cached within the content cache dir while reading the image.
+	LayerTarWrite TempWriteKind = iota
+	// FileCatalogIndexWrite is the file catalog entries moved to disk (see WithDiskBackedFileCatalog).
+	FileCatalogIndexWrite
+	// FileContentsWrite is the contents of a large file cached upon the first read of the file.
+	FileContentsWrite
+)
+
+// TempWriteKind is the kind of temp artifact written while reading an image (or fetching file contents).
+type TempWriteKind uint8
+
+// TempWrite describes a single temp artifact that is about to be written.
+type TempWrite struct {
+	Kind TempWriteKind
+	// Path is where the artifact will be written. For file catalog indexes and file contents this is the directory that
+	// a new temp file is created within.
+	Path string
+	// ProjectedSize is the expected size of the artifact in bytes, or -1 when not known up front (e.g. compressed layer
+	// tars or the file catalog index, which grows with each entry).
+	ProjectedSize int64
+}
+
+// TempWriteHook is called before each temp artifact is written while reading an image (and fetching file contents),
+// which allows callers to account for (or restrict) disk usage, e.g. in sandboxes with strict per-directory quotas.
+// Returning an error vetoes the write, where the artifact is not persisted at all: the layer tar is streamed from the
+// image source for every read, the file catalog entries are kept in memory, or the file contents are streamed from the
+// layer tar for every read. Returning a non-empty path redirects the write (for file catalog indexes and file contents
+// this must be a directory). Hooks may be called concurrently (see WithLayerConcurrency).
+type TempWriteHook func(write TempWrite) (string, error)
+
+// WithTempWriteHook calls the given hook before each temp artifact is written (see TempWriteHook). Note: artifacts
+// written by providers (e.g. an image saved from a daemon) are written before the image is read and are not observed.
+func WithTempWriteHook(hook TempWriteHook) ReadOption {
+	return func(image *Image) error {
+		image.tempWriteHook = hook
+		image.FileCatalog.tempWriteHook = hook
+		return nil
+	}
+}
+
+// String returns a convenient display string for the kind of temp write.
+func (k TempWriteKind) String() string {
+	switch k {
+	case LayerTarWrite:
+		return "layer tar"
+	case FileCatalogIndexWrite:
+		return "file catalog index"
+	case FileContentsWrite:
+		return "file contents"
+	}
+	return "unknown"
+}
+
+// tempWritePath returns the path to write the given artifact to, or false if the write has been vetoed by the hook.
+func tempWritePath(hook TempWriteHook, write TempWrite) (string, bool) {
+	if hook == nil {
+		return write.Path, true
+	}
+	redirect, err := hook(write)
+	if err != nil {
+		log.Debugf("%s write to path=%q vetoed: %+v", write.Kind, write.Path, err)
+		return "", false
+	}
+	if redirect != "" {
+		return redirect, true
+	}
+	return write.Path, true
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestImage_Read_WithTempWriteHook(t *testing.T) {
+	// treat all files as large files (which are cached on disk upon read)
+	originalThreshold := cacheFileSizeThreshold
+	cacheFileSizeThreshold = 1
+	defer func() { cacheFileSizeThreshold = originalThreshold }()
+
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	dir := testTempDir(t)
+	redirectDir := testTempDir(t)
+
+	var lock sync.Mutex
+	var writes []TempWrite
+	hook := func(write TempWrite) (string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		writes = append(writes, write)
+		switch write.Kind {
+		case LayerTarWrite:
+			return "", errors.New("no room for layer tars")
+		case FileCatalogIndexWrite:
+			return redirectDir, nil
+		}
+		return "", nil
+	}
+
+	img := NewImage(randomImg, dir)
+	if err := img.Read(WithTempWriteHook(hook), WithDiskBackedFileCatalog(1)); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	files := squashedTreeOf(t, img).AllFiles()
+	if len(files) == 0 {
+		t.Fatalf("expected files")
+	}
+	reader, err := img.FileContentsByReference(files[0])
+	if err != nil {
+		t.Fatalf("could not fetch contents: %+v", err)
+	}
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatalf("could not read contents: %+v", err)
+	}
+	reader.Close()
+
+	counts := make(map[TempWriteKind]int)
+	for _, write := range writes {
+		counts[write.Kind]++
+		if write.Kind == LayerTarWrite && !strings.HasPrefix(write.Path, dir) {
+			t.Errorf("unexpected layer tar path: %q", write.Path)
+		}
+	}
+	if counts[LayerTarWrite] != len(img.Layers) || counts[FileCatalogIndexWrite] != 1 || counts[FileContentsWrite] != 1 {
+		t.Errorf("unexpected writes: %+v", writes)
+	}
+
+	// vetoed layer tars are not written, the catalog index is redirected, and file contents are cached as usual
+	if tars, _ := filepath.Glob(filepath.Join(dir, "*.tar")); len(tars) != 0 {
+		t.Errorf("unexpected layer tars: %+v", tars)
+	}
+	if indexes, _ := filepath.Glob(filepath.Join(redirectDir, "file-catalog-*")); len(indexes) != 1 {
+		t.Errorf("expected a redirected catalog index: %+v", indexes)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only cached file contents: %+v", entries)
+	}
+}
@@ -0,0 +1,215 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// VerificationCheck is the result of comparing a single recorded digest (or size) against the actual content.
+type VerificationCheck struct {
+	// Subject describes what was checked (e.g. "manifest digest" or "layer=1 diff ID").
+	Subject string
+	// Expected is the recorded value (from the manifest, the config, or the provider).
+	Expected string
+	// Actual is the value computed from the content (empty if the content could not be read).
+	Actual string
+	// Err is the reason the content could not be read (the check does not pass).
+	Err error
+}
+
+// VerificationReport is the result of all checks made while verifying an image.
+type VerificationReport struct {
+	Checks []VerificationCheck
+}
+
+// Passed indicates that the actual value matches the expected value.
+func (c VerificationCheck) Passed() bool {
+	return c.Err == nil && c.Expected == c.Actual
+}
+
+// String returns a convenient display string for the check.
+func (c VerificationCheck) String() string {
+	switch {
+	case c.Err != nil:
+		return fmt.Sprintf("%s: unable to verify: %+v", c.Subject, c.Err)
+	case c.Passed():
+		return fmt.Sprintf("%s: ok", c.Subject)
+	}
+	return fmt.Sprintf("%s: expected %q but found %q", c.Subject, c.Expected, c.Actual)
+}
+
+// Passed indicates that all checks passed.
+func (r VerificationReport) Passed() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures returns all checks that did not pass.
+func (r VerificationReport) Failures() []VerificationCheck {
+	var failures []VerificationCheck
+	for _, check := range r.Checks {
+		if !check.Passed() {
+			failures = append(failures, check)
+		}
+	}
+	return failures
+}
+
+// Verify re-checks the manifest and config digests, the digest and size of each layer blob, and the diff ID of each
+// layer against the content as it is currently stored (e.g. within the content cache dir, an OCI layout, or a layer
+// cache), which is useful for auditing long-lived caches for corruption. All checks are made (a failed check does not
+// stop verification) and the results are returned as a report, where an error is only returned if the context is
+// done. Note: layer blobs are read from the image source, which may require fetching the blobs again (e.g. for images
+// from a registry without a layer cache).
+func (i *Image) Verify(ctx context.Context) (VerificationReport, error) {
+	var report VerificationReport
+
+	report.Checks = append(report.Checks, VerificationCheck{
+		Subject:  "config digest",
+		Expected: i.Metadata.ID,
+		Actual:   sha256Digest(i.Metadata.RawConfig),
+	})
+
+	var manifest *v1.Manifest
+	if len(i.Metadata.RawManifest) > 0 {
+		if i.Metadata.ManifestDigest != "" {
+			report.Checks = append(report.Checks, VerificationCheck{
+				Subject:  "manifest digest",
+				Expected: i.Metadata.ManifestDigest,
+				Actual:   sha256Digest(i.Metadata.RawManifest),
+			})
+		}
+
+		var err error
+		manifest, err = v1.ParseManifest(bytes.NewReader(i.Metadata.RawManifest))
+		if err != nil {
+			report.Checks = append(report.Checks, VerificationCheck{
+				Subject: "manifest",
+				Err:     fmt.Errorf("unable to parse manifest: %w", err),
+			})
+			manifest = nil
+		}
+	}
+
+	if manifest != nil {
+		report.Checks = append(report.Checks,
+			VerificationCheck{
+				Subject:  "manifest config digest",
+				Expected: manifest.Config.Digest.String(),
+				Actual:   sha256Digest(i.Metadata.RawConfig),
+			},
+			VerificationCheck{
+				Subject:  "manifest config size",
+				Expected: strconv.FormatInt(manifest.Config.Size, 10),
+				Actual:   strconv.Itoa(len(i.Metadata.RawConfig)),
+			},
+		)
+	}
+
+	for _, layer := range i.Layers {
+		checks, err := layer.verify(ctx, manifest)
+		if err != nil {
+			return report, err
+		}
+		report.Checks = append(report.Checks, checks...)
+	}
+
+	return report, nil
+}
+
+// verify checks the layer blob against the manifest (if available) and the uncompressed layer content against the
+// diff ID from the image config.
+func (l *Layer) verify(ctx context.Context, manifest *v1.Manifest) ([]VerificationCheck, error) {
+	prefix := fmt.Sprintf("layer=%d", l.Metadata.Index)
+
+	var checks []VerificationCheck
+
+	expectedDigest, err := l.layer.Digest()
+	if err != nil {
+		checks = append(checks, VerificationCheck{
+			Subject: prefix + " blob digest",
+			Err:     fmt.Errorf("unable to get layer digest: %w", err),
+		})
+	} else {
+		blobCheck := VerificationCheck{
+			Subject:  prefix + " blob digest",
+			Expected: expectedDigest.String(),
+		}
+		blobSize, actual, err := digestContent(ctx, l.layer.Compressed)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		blobCheck.Actual, blobCheck.Err = actual, err
+		checks = append(checks, blobCheck)
+
+		if descriptor := manifestLayer(manifest, expectedDigest); manifest != nil && descriptor == nil {
+			checks = append(checks, VerificationCheck{
+				Subject:  prefix + " manifest descriptor",
+				Expected: expectedDigest.String(),
+				Err:      fmt.Errorf("layer blob is not referenced by the manifest"),
+			})
+		} else if descriptor != nil && err == nil {
+			checks = append(checks, VerificationCheck{
+				Subject:  prefix + " blob size",
+				Expected: strconv.FormatInt(descriptor.Size, 10),
+				Actual:   strconv.FormatInt(blobSize, 10),
+			})
+		}
+	}
+
+	// the uncompressed content is read from wherever it is stored for the image (e.g. the content cache dir)
+	open := l.uncompressedReader
+	if l.opener != nil {
+		open = l.opener.Open
+	}
+	diffIDCheck := VerificationCheck{
+		Subject:  prefix + " diff ID",
+		Expected: l.Metadata.Digest,
+	}
+	_, diffIDCheck.Actual, diffIDCheck.Err = digestContent(ctx, open)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return append(checks, diffIDCheck), nil
+}
+
+// manifestLayer returns the manifest descriptor for the layer blob with the given digest (nil if not found).
+func manifestLayer(manifest *v1.Manifest, digest v1.Hash) *v1.Descriptor {
+	if manifest == nil {
+		return nil
+	}
+	for idx, descriptor := range manifest.Layers {
+		if descriptor.Digest == digest {
+			return &manifest.Layers[idx]
+		}
+	}
+	return nil
+}
+
+// digestContent returns the size and sha256 digest of the content from the given opener.
+func digestContent(ctx context.Context, open file.OpenerFn) (int64, string, error) {
+	reader, err := open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file.NewContextReader(ctx, reader))
+	if err != nil {
+		return 0, "", err
+	}
+	return size, fmt.Sprintf("sha256:%x", hasher.Sum(nil)), nil
+}
+
+// sha256Digest returns the sha256 digest of the given document.
+func sha256Digest(contents []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(contents))
+}
@@ -0,0 +1,71 @@
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestImage_Verify(t *testing.T) {
+	randomImg, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+	rawManifest, err := randomImg.RawManifest()
+	if err != nil {
+		t.Fatalf("could not get manifest: %+v", err)
+	}
+	digest, err := randomImg.Digest()
+	if err != nil {
+		t.Fatalf("could not get digest: %+v", err)
+	}
+
+	dir := testTempDir(t)
+	img := NewImage(randomImg, dir, WithManifest(rawManifest), WithManifestDigest(digest.String()))
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	report, err := img.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("could not verify image: %+v", err)
+	}
+	if !report.Passed() {
+		t.Errorf("unexpected failures: %+v", report.Failures())
+	}
+	// config digest + manifest digest + manifest config digest and size + 3 checks per layer
+	if len(report.Checks) != 4+3*len(img.Layers) {
+		t.Errorf("unexpected number of checks: %d", len(report.Checks))
+	}
+
+	// corrupt the cached layer tar and the config
+	tarPath := path.Join(dir, img.Layers[1].Metadata.Digest+".tar")
+	if err := ioutil.WriteFile(tarPath, []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("could not corrupt layer tar: %+v", err)
+	}
+	img.Metadata.RawConfig = append(img.Metadata.RawConfig, ' ')
+
+	report, err = img.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("could not verify image: %+v", err)
+	}
+
+	var failed []string
+	for _, check := range report.Failures() {
+		failed = append(failed, check.Subject)
+	}
+	expected := "config digest, manifest config digest, manifest config size, layer=1 diff ID"
+	if strings.Join(failed, ", ") != expected {
+		t.Errorf("unexpected failures: %+v", report.Failures())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := img.Verify(ctx); err == nil {
+		t.Errorf("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,51 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+const (
+	// VirtualConfigPath is the virtual path of the raw image config document (see Image.VirtualFileContents).
+	VirtualConfigPath file.Path = "/.stereoscope/config.json"
+	// VirtualManifestPath is the virtual path of the raw image manifest document (see Image.VirtualFileContents).
+	VirtualManifestPath file.Path = "/.stereoscope/manifest.json"
+)
+
+// VirtualFiles returns the virtual paths of all image documents that are available for this image (the manifest is
+// not available for all sources). These paths are not part of any file tree or the file catalog.
+func (i *Image) VirtualFiles() []file.Path {
+	var paths []file.Path
+	for _, p := range []file.Path{VirtualConfigPath, VirtualManifestPath} {
+		if len(i.virtualFile(p)) > 0 {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// VirtualFileContents returns the raw image document for the given virtual path (see VirtualConfigPath and
+// VirtualManifestPath), so that image documents can be handled by the same code as file contents from the image.
+// An ErrFileNotFound error is returned if the path is not a virtual path or the document is not available.
+func (i *Image) VirtualFileContents(path file.Path) (io.ReadCloser, error) {
+	contents := i.virtualFile(path)
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("%w: virtual path=%q", ErrFileNotFound, path)
+	}
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// virtualFile returns the raw image document for the given virtual path (nil if not available).
+func (i *Image) virtualFile(path file.Path) []byte {
+	switch path {
+	case VirtualConfigPath:
+		return i.Metadata.RawConfig
+	case VirtualManifestPath:
+		return i.Metadata.RawManifest
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_VirtualFileContents(t *testing.T) {
+	img := Image{
+		Metadata: Metadata{
+			RawConfig: []byte(`{"config":true}`),
+		},
+	}
+
+	if actual := img.VirtualFiles(); !reflect.DeepEqual(actual, []file.Path{VirtualConfigPath}) {
+		t.Errorf("unexpected virtual files: %+v", actual)
+	}
+
+	reader, err := img.VirtualFileContents(VirtualConfigPath)
+	if err != nil {
+		t.Fatalf("could not get config: %+v", err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not read config: %+v", err)
+	}
+	if string(contents) != `{"config":true}` {
+		t.Errorf("unexpected config: %q", string(contents))
+	}
+
+	for _, p := range []file.Path{VirtualManifestPath, "/etc/passwd"} {
+		if _, err := img.VirtualFileContents(p); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("expected file not found for path=%q: %+v", p, err)
+		}
+	}
+}
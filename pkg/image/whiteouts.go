@@ -0,0 +1,86 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// Whiteout is a single whiteout entry within a layer tar, which removes lower layer content when the layers are
+// squashed.
+type Whiteout struct {
+	// Path is the path of the whiteout entry within the layer tree (e.g. "/etc/.wh.hosts" or "/var/.wh..wh..opq").
+	Path file.Path
+	// Opaque indicates an opaque whiteout, which removes all lower layer content within the Target directory (the
+	// directory itself remains), instead of removing the Target path itself.
+	Opaque bool
+	// Target is the path removed by the whiteout (e.g. "/etc/hosts"), or the directory cleared by an opaque whiteout.
+	Target file.Path
+	// Shadowed are all real paths of the lower layers removed by the whiteout (the target and all paths beneath it, or
+	// only the paths beneath the target for opaque whiteouts), sorted depth-first. This is empty when the whiteout
+	// does not remove anything (or when no previous layer is given).
+	Shadowed []file.Path
+}
+
+// Whiteouts returns all whiteouts within this layer (sorted depth-first by whiteout path), where the paths each
+// whiteout removes are found within the squashed tree of the given (lower) layer. When previous is nil no paths are
+// considered shadowed. Whiteouts are otherwise only applied when squashing (they are never part of a squashed tree).
+func (l *Layer) Whiteouts(previous *Layer) ([]Whiteout, error) {
+	ctx := context.Background()
+	if err := l.squash(ctx); err != nil {
+		return nil, err
+	}
+
+	var whiteouts []Whiteout
+	// whiteouts by the target path (note: a regular and an opaque whiteout may share a target)
+	byTarget := make(map[file.Path][]int)
+	err := l.Tree.WalkNodes(func(path file.Path, _ filenode.FileNode) error {
+		if !path.IsWhiteout() {
+			return nil
+		}
+		target, err := path.UnWhiteoutPath()
+		if err != nil {
+			return fmt.Errorf("unable to determine whiteout target for path=%q: %w", path, err)
+		}
+		byTarget[target] = append(byTarget[target], len(whiteouts))
+		whiteouts = append(whiteouts, Whiteout{
+			Path:   path,
+			Opaque: path.IsDirWhiteout(),
+			Target: target,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil || len(whiteouts) == 0 {
+		return whiteouts, nil
+	}
+	if err := previous.squash(ctx); err != nil {
+		return nil, err
+	}
+
+	// each lower path is shadowed by every whiteout targeting the path or any of its ancestors
+	err = previous.SquashedTree.WalkNodes(func(path file.Path, _ filenode.FileNode) error {
+		for ancestor := path; ; {
+			for _, idx := range byTarget[ancestor] {
+				if ancestor != path || !whiteouts[idx].Opaque {
+					whiteouts[idx].Shadowed = append(whiteouts[idx].Shadowed, path)
+				}
+			}
+			parent, err := ancestor.ParentPath()
+			if err != nil {
+				return nil
+			}
+			ancestor = parent
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return whiteouts, nil
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/go-test/deep"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestLayer_Whiteouts(t *testing.T) {
+	base := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeDir, Name: "etc/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts"},
+		tar.Header{Typeflag: tar.TypeDir, Name: "var/cache/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/a"},
+		tar.Header{Typeflag: tar.TypeDir, Name: "var/cache/b/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/b/c"},
+		tar.Header{Typeflag: tar.TypeDir, Name: "opt/"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "opt/app"},
+	)
+	top := newTestLayer(t, nil,
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.hosts"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.missing"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/.wh..wh..opq"},
+		tar.Header{Typeflag: tar.TypeReg, Name: "var/cache/new"},
+		tar.Header{Typeflag: tar.TypeReg, Name: ".wh.opt"},
+	)
+	img := newTestImage(t, []v1.Layer{base, top})
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+
+	whiteouts, err := img.Layers[1].Whiteouts(img.Layers[0])
+	if err != nil {
+		t.Fatalf("could not get whiteouts: %+v", err)
+	}
+
+	expected := []Whiteout{
+		{
+			Path:     "/.wh.opt",
+			Target:   "/opt",
+			Shadowed: []file.Path{"/opt", "/opt/app"},
+		},
+		{
+			Path:     "/etc/.wh.hosts",
+			Target:   "/etc/hosts",
+			Shadowed: []file.Path{"/etc/hosts"},
+		},
+		{
+			Path:   "/etc/.wh.missing",
+			Target: "/etc/missing",
+		},
+		{
+			Path:     "/var/cache/.wh..wh..opq",
+			Opaque:   true,
+			Target:   "/var/cache",
+			Shadowed: []file.Path{"/var/cache/a", "/var/cache/b", "/var/cache/b/c"},
+		},
+	}
+	for _, d := range deep.Equal(whiteouts, expected) {
+		t.Errorf("unexpected whiteouts: %s", d)
+	}
+
+	// the whiteouts are applied to the squashed tree
+	for _, removed := range []file.Path{"/opt", "/etc/hosts", "/var/cache/a"} {
+		if squashedTreeOf(t, img).HasPath(removed) {
+			t.Errorf("expected path=%q to be removed", removed)
+		}
+	}
+
+	// without a previous layer nothing is shadowed
+	whiteouts, err = img.Layers[1].Whiteouts(nil)
+	if err != nil {
+		t.Fatalf("could not get whiteouts: %+v", err)
+	}
+	if len(whiteouts) != len(expected) {
+		t.Fatalf("unexpected whiteouts: %+v", whiteouts)
+	}
+	for _, whiteout := range whiteouts {
+		if len(whiteout.Shadowed) != 0 {
+			t.Errorf("expected no shadowed paths for whiteout=%q", whiteout.Path)
+		}
+	}
+
+	whiteouts, err = img.Layers[0].Whiteouts(nil)
+	if err != nil {
+		t.Fatalf("could not get whiteouts: %+v", err)
+	}
+	if len(whiteouts) != 0 {
+		t.Errorf("expected no whiteouts for the base layer: %+v", whiteouts)
+	}
+}
@@ -1,7 +1,11 @@
 package logger
 
+// Logger is the logging interface used throughout the library (e.g. by image providers, file catalog construction,
+// and cleanup), allowing host applications to wire in their own logger (e.g. logrus, zap, or zerolog) with
+// stereoscope.SetLogger. Nothing is logged when no logger is set.
 type Logger interface {
 	Errorf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
 	Info(args ...interface{})
 	Debugf(format string, args ...interface{})
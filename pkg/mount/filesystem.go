@@ -0,0 +1,186 @@
+package mount
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// ErrNotExist is returned for paths that do not exist within the filesystem.
+var ErrNotExist = fmt.Errorf("path does not exist")
+
+// ErrNotDir is returned when listing a path that is not a directory.
+var ErrNotDir = fmt.Errorf("path is not a directory")
+
+// ErrNotLink is returned when reading the link target of a path that is not a symlink.
+var ErrNotLink = fmt.Errorf("path is not a symlink")
+
+// impliedDirMode is the mode of directories only implied by other paths (without a tar entry to describe them).
+const impliedDirMode = os.ModeDir | 0755
+
+// Filesystem is a read-only view of the squashed filesystem of an image, providing the operations needed to serve the
+// filesystem to a kernel filesystem interface: attribute lookups, directory listings, symlink targets, and file contents
+// (read from the file catalog on demand, so nothing is extracted to disk up front). See Mount for serving the filesystem
+// with FUSE (when built with the "fuse" build tag).
+type Filesystem struct {
+	tree    *filetree.FileTree
+	catalog *image.FileCatalog
+}
+
+// Attr describes a single path within the filesystem. Hardlinks are described as the file they link to.
+type Attr struct {
+	// Path is the absolute path as given (not resolved).
+	Path file.Path
+	// Mode is the type and permission bits of the path (e.g. os.ModeDir|0755 or os.ModeSymlink|0777).
+	Mode os.FileMode
+	// Size is the size of the file contents in bytes (the length of the target for symlinks).
+	Size    int64
+	UserID  int
+	GroupID int
+	ModTime time.Time
+	// LinkTarget is the target of a symlink (empty for all other types).
+	LinkTarget string
+}
+
+// IsDir indicates that the path is a directory.
+func (a Attr) IsDir() bool {
+	return a.Mode.IsDir()
+}
+
+// New returns a read-only view of the squashed filesystem of the given image, where all layers are indexed first (for
+// lazily read images).
+func New(img *image.Image) (*Filesystem, error) {
+	tree, err := img.SquashedTreeAtLayer(len(img.Layers) - 1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get squashed filesystem: %w", err)
+	}
+	return NewFromTree(tree, &img.FileCatalog), nil
+}
+
+// NewFromTree returns a read-only view of the given tree, where the metadata and contents of all files within the tree
+// are provided by the given catalog (e.g. any layer squash tree of an image, see image.Image.SquashedTreeAtLayer).
+func NewFromTree(tree *filetree.FileTree, catalog *image.FileCatalog) *Filesystem {
+	return &Filesystem{
+		tree:    tree,
+		catalog: catalog,
+	}
+}
+
+// Stat describes the given path without following a symlink basename (as with lstat), however, symlinks within the
+// ancestors of the path are followed. An ErrNotExist error is returned if the path does not exist.
+func (f *Filesystem) Stat(path file.Path) (Attr, error) {
+	path = path.Normalize()
+	exists, ref, err := f.tree.File(path)
+	if err != nil {
+		return Attr{}, err
+	}
+	if !exists {
+		return Attr{}, fmt.Errorf("%w: path=%q", ErrNotExist, path)
+	}
+	if ref == nil {
+		// only directories may be implied by other paths
+		return Attr{Path: path, Mode: impliedDirMode}, nil
+	}
+
+	metadata, err := f.catalog.Metadata(*ref)
+	if errors.Is(err, image.ErrFileNotFound) {
+		return Attr{Path: path, Mode: impliedDirMode}, nil
+	}
+	if err != nil {
+		return Attr{}, err
+	}
+
+	if metadata.TypeFlag == tar.TypeLink {
+		// hardlinks are indistinguishable from the file they link to
+		_, target, err := f.tree.File(path, filetree.FollowBasenameLinks)
+		if err != nil {
+			return Attr{}, err
+		}
+		if target == nil {
+			return Attr{}, fmt.Errorf("%w: hardlink=%q target=%q", ErrNotExist, path, metadata.Linkname)
+		}
+		if metadata, err = f.catalog.Metadata(*target); err != nil {
+			return Attr{}, err
+		}
+	}
+
+	attr := Attr{
+		Path:    path,
+		Mode:    metadata.Mode,
+		Size:    metadata.Size,
+		UserID:  metadata.UserID,
+		GroupID: metadata.GroupID,
+		ModTime: metadata.ModTime,
+	}
+	if metadata.TypeFlag == tar.TypeSymlink {
+		attr.LinkTarget = metadata.Linkname
+		attr.Size = int64(len(metadata.Linkname))
+	}
+	return attr, nil
+}
+
+// ReadDir returns the names of all entries within the given directory (sorted by name), following symlinks to the
+// directory. An ErrNotDir error is returned if the path is not a directory.
+func (f *Filesystem) ReadDir(path file.Path) ([]string, error) {
+	path = path.Normalize()
+	exists, ref, err := f.tree.File(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: path=%q", ErrNotExist, path)
+	}
+	// directories implied by other paths have no reference
+	if ref != nil {
+		metadata, err := f.catalog.Metadata(*ref)
+		if err == nil && metadata.TypeFlag != tar.TypeDir {
+			return nil, fmt.Errorf("%w: path=%q", ErrNotDir, path)
+		}
+	}
+
+	paths, err := f.tree.ListPaths(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, p.Basename())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadLink returns the target of the given symlink (as found within the layer tar, which may be relative).
+func (f *Filesystem) ReadLink(path file.Path) (string, error) {
+	attr, err := f.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if attr.Mode&os.ModeSymlink == 0 {
+		return "", fmt.Errorf("%w: path=%q", ErrNotLink, path)
+	}
+	return attr.LinkTarget, nil
+}
+
+// Open provides random access to the contents of the file at the given path, following all links, so that reads at an
+// offset (as requested by the kernel) do not read the contents up to the offset again (see
+// image.FileCatalog.OpenSeekableByID).
+func (f *Filesystem) Open(path file.Path) (image.SeekableContents, error) {
+	path = path.Normalize()
+	exists, ref, err := f.tree.File(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || ref == nil {
+		return nil, fmt.Errorf("%w: path=%q", ErrNotExist, path)
+	}
+	return f.catalog.OpenSeekableByID(ref.ID())
+}
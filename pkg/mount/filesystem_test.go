@@ -0,0 +1,205 @@
+package mount
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/go-test/deep"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func testFilesystem(t *testing.T) *Filesystem {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range []tar.Header{
+		{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "etc/hosts", Mode: 0o644, Size: 9},
+		{Typeflag: tar.TypeSymlink, Name: "etc/hosts-link", Linkname: "hosts", Mode: 0o777},
+		{Typeflag: tar.TypeLink, Name: "etc/hosts-hard", Linkname: "etc/hosts", Mode: 0o644},
+		{Typeflag: tar.TypeReg, Name: "opt/app/run", Mode: 0o700, Size: 4},
+		{Typeflag: tar.TypeSymlink, Name: "app", Linkname: "/opt/app", Mode: 0o777},
+	} {
+		header := header
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatalf("could not write header: %+v", err)
+		}
+		var contents string
+		switch header.Name {
+		case "etc/hosts":
+			contents = "127.0.0.1"
+		case "opt/app/run":
+			contents = "exit"
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("could not write contents: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar: %+v", err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("could not create layer: %+v", err)
+	}
+	v1Img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatalf("could not create image: %+v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "stereoscope-mount-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	img := image.NewImage(v1Img, dir)
+	if err := img.Read(); err != nil {
+		t.Fatalf("could not read image: %+v", err)
+	}
+	fs, err := New(img)
+	if err != nil {
+		t.Fatalf("could not create filesystem: %+v", err)
+	}
+	return fs
+}
+
+func TestFilesystem_Stat(t *testing.T) {
+	fs := testFilesystem(t)
+
+	tests := []struct {
+		path   file.Path
+		mode   os.FileMode
+		size   int64
+		target string
+		err    error
+	}{
+		{path: "/etc", mode: os.ModeDir | 0o755},
+		{path: "/etc/hosts", mode: 0o644, size: 9},
+		{path: "/etc/hosts-link", mode: os.ModeSymlink | 0o777, size: 5, target: "hosts"},
+		// hardlinks are described as the file they link to
+		{path: "/etc/hosts-hard", mode: 0o644, size: 9},
+		// implied by other paths
+		{path: "/opt", mode: os.ModeDir | 0o755},
+		// through an ancestor symlink
+		{path: "/app/run", mode: 0o700, size: 4},
+		{path: "/missing", err: ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			attr, err := fs.Stat(test.path)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error=%v, got %+v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not stat path: %+v", err)
+			}
+			if attr.Mode != test.mode {
+				t.Errorf("unexpected mode: %v != %v", attr.Mode, test.mode)
+			}
+			if attr.Size != test.size {
+				t.Errorf("unexpected size: %d != %d", attr.Size, test.size)
+			}
+			if attr.LinkTarget != test.target {
+				t.Errorf("unexpected link target: %q != %q", attr.LinkTarget, test.target)
+			}
+		})
+	}
+}
+
+func TestFilesystem_ReadDir(t *testing.T) {
+	fs := testFilesystem(t)
+
+	names, err := fs.ReadDir("/")
+	if err != nil {
+		t.Fatalf("could not read dir: %+v", err)
+	}
+	for _, d := range deep.Equal(names, []string{"app", "etc", "opt"}) {
+		t.Errorf("unexpected root entries: %s", d)
+	}
+
+	// through a symlink to a directory
+	names, err = fs.ReadDir("/app")
+	if err != nil {
+		t.Fatalf("could not read dir: %+v", err)
+	}
+	for _, d := range deep.Equal(names, []string{"run"}) {
+		t.Errorf("unexpected app entries: %s", d)
+	}
+
+	if _, err := fs.ReadDir("/etc/hosts"); !errors.Is(err, ErrNotDir) {
+		t.Errorf("expected a not a directory error, got %+v", err)
+	}
+	if _, err := fs.ReadDir("/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expected a not exist error, got %+v", err)
+	}
+}
+
+func TestFilesystem_ReadLinkAndOpen(t *testing.T) {
+	fs := testFilesystem(t)
+
+	target, err := fs.ReadLink("/etc/hosts-link")
+	if err != nil {
+		t.Fatalf("could not read link: %+v", err)
+	}
+	if target != "hosts" {
+		t.Errorf("unexpected link target: %q", target)
+	}
+	if _, err := fs.ReadLink("/etc/hosts"); !errors.Is(err, ErrNotLink) {
+		t.Errorf("expected a not a link error, got %+v", err)
+	}
+
+	for _, p := range []file.Path{"/etc/hosts", "/etc/hosts-link", "/etc/hosts-hard"} {
+		reader, err := fs.Open(p)
+		if err != nil {
+			t.Fatalf("could not open path=%q: %+v", p, err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("could not read path=%q: %+v", p, err)
+		}
+		if string(contents) != "127.0.0.1" {
+			t.Errorf("unexpected contents for path=%q: %q", p, contents)
+		}
+	}
+
+	// reads at an offset (as requested by the kernel)
+	contents, err := fs.Open("/app/run")
+	if err != nil {
+		t.Fatalf("could not open path: %+v", err)
+	}
+	defer contents.Close()
+	if contents.Size() != 4 {
+		t.Errorf("unexpected size: %d", contents.Size())
+	}
+	buf := make([]byte, 2)
+	if _, err := contents.ReadAt(buf, 2); err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("could not read at offset: %+v", err)
+	}
+	if string(buf) != "it" {
+		t.Errorf("unexpected contents at offset: %q", buf)
+	}
+
+	if _, err := fs.Open("/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expected a not exist error, got %+v", err)
+	}
+}
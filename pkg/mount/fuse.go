@@ -0,0 +1,178 @@
+//go:build fuse
+// +build fuse
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// Mount serves the given filesystem read-only with FUSE at the given (existing) directory, blocking until the context
+// is done (at which point the directory is unmounted) or the directory is unmounted externally (e.g. with
+// "fusermount -u"). File contents are read on demand for each kernel read request, by offset (see Filesystem.Open).
+func Mount(ctx context.Context, f *Filesystem, dir string) error {
+	conn, err := fuse.Mount(dir, fuse.ReadOnly(), fuse.FSName("stereoscope"), fuse.Subtype("stereoscope"))
+	if err != nil {
+		return fmt.Errorf("unable to mount dir=%q: %w", dir, err)
+	}
+	defer conn.Close()
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := fuse.Unmount(dir); err != nil {
+				log.Errorf("unable to unmount dir=%q: %+v", dir, err)
+			}
+		case <-served:
+		}
+	}()
+
+	if err := fs.Serve(conn, &fuseFS{fs: f}); err != nil {
+		return fmt.Errorf("unable to serve mount dir=%q: %w", dir, err)
+	}
+	<-conn.Ready
+	return conn.MountError
+}
+
+// fuseFS serves a Filesystem as a FUSE filesystem.
+type fuseFS struct {
+	fs *Filesystem
+}
+
+func (f *fuseFS) Root() (fs.Node, error) {
+	return &fuseNode{fs: f.fs, path: "/"}, nil
+}
+
+// fuseNode is a single path within the filesystem (of any type).
+type fuseNode struct {
+	fs   *Filesystem
+	path file.Path
+}
+
+func (n *fuseNode) Attr(_ context.Context, attr *fuse.Attr) error {
+	stat, err := n.fs.Stat(n.path)
+	if err != nil {
+		return fuseError(err)
+	}
+	attr.Mode = stat.Mode
+	attr.Size = uint64(stat.Size)
+	attr.Uid = uint32(stat.UserID)
+	attr.Gid = uint32(stat.GroupID)
+	attr.Mtime = stat.ModTime
+	attr.Ctime = stat.ModTime
+	return nil
+}
+
+func (n *fuseNode) Lookup(_ context.Context, name string) (fs.Node, error) {
+	child := file.Path(path.Join(string(n.path), name))
+	if _, err := n.fs.Stat(child); err != nil {
+		return nil, fuseError(err)
+	}
+	return &fuseNode{fs: n.fs, path: child}, nil
+}
+
+func (n *fuseNode) ReadDirAll(context.Context) ([]fuse.Dirent, error) {
+	names, err := n.fs.ReadDir(n.path)
+	if err != nil {
+		return nil, fuseError(err)
+	}
+	entries := make([]fuse.Dirent, 0, len(names))
+	for _, name := range names {
+		entry := fuse.Dirent{Name: name, Type: fuse.DT_Unknown}
+		if stat, err := n.fs.Stat(file.Path(path.Join(string(n.path), name))); err == nil {
+			entry.Type = direntType(stat.Mode)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (n *fuseNode) Readlink(context.Context, *fuse.ReadlinkRequest) (string, error) {
+	target, err := n.fs.ReadLink(n.path)
+	if err != nil {
+		return "", fuseError(err)
+	}
+	return target, nil
+}
+
+func (n *fuseNode) Open(_ context.Context, request *fuse.OpenRequest, response *fuse.OpenResponse) (fs.Handle, error) {
+	if request.Dir {
+		// directories are listed from the node (see ReadDirAll)
+		return n, nil
+	}
+	contents, err := n.fs.Open(n.path)
+	if err != nil {
+		return nil, fuseError(err)
+	}
+	// the contents of an image never change
+	response.Flags |= fuse.OpenKeepCache
+	return &fuseHandle{contents: contents}, nil
+}
+
+// fuseHandle is an open file, where every kernel read request is served from the given offset.
+type fuseHandle struct {
+	lock     sync.Mutex
+	contents image.SeekableContents
+}
+
+func (h *fuseHandle) Read(_ context.Context, request *fuse.ReadRequest, response *fuse.ReadResponse) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	buf := make([]byte, request.Size)
+	n, err := h.contents.ReadAt(buf, request.Offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fuseError(err)
+	}
+	response.Data = buf[:n]
+	return nil
+}
+
+func (h *fuseHandle) Release(context.Context, *fuse.ReleaseRequest) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.contents.Close()
+}
+
+// direntType returns the directory entry type for the given file mode.
+func direntType(mode os.FileMode) fuse.DirentType {
+	switch {
+	case mode.IsDir():
+		return fuse.DT_Dir
+	case mode&os.ModeSymlink != 0:
+		return fuse.DT_Link
+	case mode.IsRegular():
+		return fuse.DT_File
+	}
+	return fuse.DT_Unknown
+}
+
+// fuseError returns the errno to report to the kernel for the given filesystem error (any other error is reported as
+// EIO).
+func fuseError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotExist), errors.Is(err, image.ErrFileNotFound):
+		return fuse.ENOENT
+	case errors.Is(err, ErrNotDir):
+		return fuse.Errno(syscall.ENOTDIR)
+	case errors.Is(err, ErrNotLink):
+		return fuse.Errno(syscall.EINVAL)
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+//go:build fuse
+// +build fuse
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/go-test/deep"
+)
+
+func TestFuseNode(t *testing.T) {
+	ctx := context.Background()
+	root, err := (&fuseFS{fs: testFilesystem(t)}).Root()
+	if err != nil {
+		t.Fatalf("could not get root: %+v", err)
+	}
+
+	entries, err := root.(*fuseNode).ReadDirAll(ctx)
+	if err != nil {
+		t.Fatalf("could not read root: %+v", err)
+	}
+	expected := []fuse.Dirent{
+		{Name: "app", Type: fuse.DT_Link},
+		{Name: "etc", Type: fuse.DT_Dir},
+		{Name: "opt", Type: fuse.DT_Dir},
+	}
+	for _, d := range deep.Equal(entries, expected) {
+		t.Errorf("unexpected root entries: %s", d)
+	}
+
+	if _, err := root.(*fuseNode).Lookup(ctx, "missing"); !errors.Is(err, fuse.ENOENT) {
+		t.Errorf("expected ENOENT, got %+v", err)
+	}
+
+	etc, err := root.(*fuseNode).Lookup(ctx, "etc")
+	if err != nil {
+		t.Fatalf("could not lookup etc: %+v", err)
+	}
+	link, err := etc.(*fuseNode).Lookup(ctx, "hosts-link")
+	if err != nil {
+		t.Fatalf("could not lookup hosts-link: %+v", err)
+	}
+	target, err := link.(*fuseNode).Readlink(ctx, &fuse.ReadlinkRequest{})
+	if err != nil {
+		t.Fatalf("could not read link: %+v", err)
+	}
+	if target != "hosts" {
+		t.Errorf("unexpected link target: %q", target)
+	}
+
+	hosts, err := etc.(*fuseNode).Lookup(ctx, "hosts")
+	if err != nil {
+		t.Fatalf("could not lookup hosts: %+v", err)
+	}
+	var attr fuse.Attr
+	if err := hosts.(*fuseNode).Attr(ctx, &attr); err != nil {
+		t.Fatalf("could not get attr: %+v", err)
+	}
+	if attr.Mode != 0o644 || attr.Size != 9 {
+		t.Errorf("unexpected attr: %+v", attr)
+	}
+
+	var openResponse fuse.OpenResponse
+	handle, err := hosts.(*fuseNode).Open(ctx, &fuse.OpenRequest{}, &openResponse)
+	if err != nil {
+		t.Fatalf("could not open hosts: %+v", err)
+	}
+	if openResponse.Flags&fuse.OpenKeepCache == 0 {
+		t.Errorf("expected the page cache to be kept: %+v", openResponse.Flags)
+	}
+
+	// the kernel reads by offset, where a read past the end is short
+	for _, test := range []struct {
+		offset   int64
+		size     int
+		expected string
+	}{
+		{offset: 4, size: 3, expected: "0.0"},
+		{offset: 0, size: 3, expected: "127"},
+		{offset: 8, size: 4096, expected: "1"},
+		{offset: 9, size: 4096, expected: ""},
+	} {
+		var readResponse fuse.ReadResponse
+		err := handle.(*fuseHandle).Read(ctx, &fuse.ReadRequest{Offset: test.offset, Size: test.size}, &readResponse)
+		if err != nil {
+			t.Fatalf("could not read at offset=%d: %+v", test.offset, err)
+		}
+		if string(readResponse.Data) != test.expected {
+			t.Errorf("unexpected contents at offset=%d: %q != %q", test.offset, readResponse.Data, test.expected)
+		}
+	}
+
+	if err := handle.(*fuseHandle).Release(ctx, &fuse.ReleaseRequest{}); err != nil {
+		t.Errorf("could not release handle: %+v", err)
+	}
+}
+
+func TestMount(t *testing.T) {
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is not available")
+	}
+	fs := testFilesystem(t)
+
+	dir, err := ioutil.TempDir("", "stereoscope-mount-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mounted := make(chan error)
+	go func() {
+		mounted <- Mount(ctx, fs, dir)
+	}()
+
+	// the mount is served in the background, so wait for it to appear
+	path := filepath.Join(dir, "app", "run")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Lstat(filepath.Join(dir, "etc")); err == nil {
+			break
+		}
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	cancel()
+	if err != nil {
+		t.Fatalf("could not read mounted file: %+v", err)
+	}
+	if string(contents) != "exit" {
+		t.Errorf("unexpected contents: %q", contents)
+	}
+	if err := <-mounted; err != nil {
+		t.Errorf("could not serve mount: %+v", err)
+	}
+}
@@ -2,15 +2,36 @@ package tree
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/anchore/stereoscope/pkg/tree/node"
 )
 
-// Tree represents a simple Tree data structure.
+// maxOverlayDepth is the number of frozen snapshots a tree may be layered over before the snapshots are flattened
+// into one, bounding the cost of lookups for trees that have been copied many times over (e.g. the squash tree of
+// the last layer of a deep image).
+const maxOverlayDepth = 8
+
+// Tree represents a simple Tree data structure. Copies of a Tree share structure: the state of the tree at the time
+// of a copy is frozen into a read-only snapshot that is shared by both the original and the copy, while all later
+// changes are tracked in a per-tree overlay on top of the snapshot. This keeps copies cheap and the memory of each
+// copy proportional to the changes made after the copy instead of the size of the entire tree.
 type Tree struct {
+	// base is the frozen snapshot this tree is layered over (nil if this tree holds all state itself).
+	base *Tree
+	// depth is the number of snapshots this tree is layered over.
+	depth int
+	// length is the number of nodes in the tree (including all nodes from the base).
+	length int
+	// nodes, children, and parent hold all state that differs from the base. A nil node (or nil children lookup)
+	// indicates that the node was removed relative to the base. Children lookups held here are always owned by this
+	// tree and may be modified in place, whereas lookups from the base must be copied before being modified.
 	nodes    map[node.ID]node.Node
 	children map[node.ID]map[node.ID]node.Node
 	parent   map[node.ID]node.Node
+	// shared is set (atomically) once the state held by this tree is shared with a copy, after which this tree must
+	// be layered over a snapshot of that state before it is changed (see unshare).
+	shared int32
 }
 
 // NewTree returns an instance of a Tree.
@@ -22,42 +43,163 @@ func NewTree() *Tree {
 	}
 }
 
+// Copy returns a new Tree with the same nodes and relationships. The copy shares all existing state with this tree
+// (including the node objects themselves), so nodes within the tree must not be modified in place. Further changes
+// to either tree are not visible to the other. Copy only reads this tree, so it is safe to call concurrently with
+// any other reads of this tree (e.g. walking the tree).
 func (t *Tree) Copy() *Tree {
-	ct := NewTree()
-	for k, v := range t.nodes {
-		if v == nil {
-			ct.nodes[k] = nil
-			continue
+	base := t.base
+	if t.base == nil || !t.isEmptyOverlay() {
+		// the current state of this tree is frozen from here on (this tree is layered over its own snapshot of the
+		// state upon the next change)
+		atomic.StoreInt32(&t.shared, 1)
+		base = t.snapshot()
+	}
+
+	return &Tree{
+		base:     base,
+		depth:    base.depth + 1,
+		length:   t.length,
+		nodes:    make(map[node.ID]node.Node),
+		children: make(map[node.ID]map[node.ID]node.Node),
+		parent:   make(map[node.ID]node.Node),
+	}
+}
+
+// snapshot returns a read-only snapshot of all current state of this tree (flattened when layered over too many
+// snapshots), sharing the state held by this tree.
+func (t *Tree) snapshot() *Tree {
+	snapshot := &Tree{
+		base:     t.base,
+		depth:    t.depth,
+		length:   t.length,
+		nodes:    t.nodes,
+		children: t.children,
+		parent:   t.parent,
+	}
+	if snapshot.depth >= maxOverlayDepth {
+		snapshot = snapshot.flatten()
+	}
+	return snapshot
+}
+
+// unshare layers this tree over a snapshot of its current state (with no changes of its own) if the state is shared
+// with a copy, so that the state may be changed. This must be called before any change to the tree.
+func (t *Tree) unshare() {
+	if atomic.LoadInt32(&t.shared) == 0 {
+		return
+	}
+	snapshot := t.snapshot()
+	t.base = snapshot
+	t.depth = snapshot.depth + 1
+	t.nodes = make(map[node.ID]node.Node)
+	t.children = make(map[node.ID]map[node.ID]node.Node)
+	t.parent = make(map[node.ID]node.Node)
+	atomic.StoreInt32(&t.shared, 0)
+}
+
+// isEmptyOverlay indicates if this tree has no changes relative to the base.
+func (t *Tree) isEmptyOverlay() bool {
+	return len(t.nodes) == 0 && len(t.children) == 0 && len(t.parent) == 0
+}
+
+// flatten returns a single frozen snapshot with the same state as this tree (and all snapshots it is layered over).
+// The children lookups are frozen already, so these are shared with the flattened snapshot instead of being copied.
+func (t *Tree) flatten() *Tree {
+	flat := &Tree{
+		length:   t.length,
+		nodes:    make(map[node.ID]node.Node, t.length),
+		children: make(map[node.ID]map[node.ID]node.Node, t.length),
+		parent:   make(map[node.ID]node.Node, t.length),
+	}
+	for _, n := range t.Nodes() {
+		nid := n.ID()
+		flat.nodes[nid] = n
+		flat.parent[nid] = t.lookupParent(nid)
+		if children, ok := t.lookupChildren(nid); ok {
+			flat.children[nid] = children
+		}
+	}
+	return flat
+}
+
+// lookupNode returns the node for the given ID, searching this tree and then the base.
+func (t *Tree) lookupNode(id node.ID) (node.Node, bool) {
+	for c := t; c != nil; c = c.base {
+		if n, ok := c.nodes[id]; ok {
+			return n, n != nil
 		}
-		ct.nodes[k] = v.Copy()
 	}
-	for k, v := range t.parent {
-		if v == nil {
-			ct.parent[k] = nil
-			continue
+	return nil, false
+}
+
+// lookupParent returns the parent for the given ID, searching this tree and then the base.
+func (t *Tree) lookupParent(id node.ID) node.Node {
+	for c := t; c != nil; c = c.base {
+		if n, ok := c.nodes[id]; ok && n == nil {
+			// the node was removed
+			return nil
+		}
+		if p, ok := c.parent[id]; ok {
+			return p
 		}
-		ct.parent[k] = v.Copy()
 	}
-	for from, lookup := range t.children {
-		if _, exists := ct.children[from]; !exists {
-			ct.children[from] = make(map[node.ID]node.Node)
+	return nil
+}
+
+// lookupChildren returns the (read-only) children lookup for the given ID, searching this tree and then the base.
+func (t *Tree) lookupChildren(id node.ID) (map[node.ID]node.Node, bool) {
+	for c := t; c != nil; c = c.base {
+		if children, ok := c.children[id]; ok {
+			return children, children != nil
 		}
-		for to, v := range lookup {
-			if v == nil {
-				ct.children[from][to] = nil
-				continue
+	}
+	return nil, false
+}
+
+// mutableChildren returns the children lookup for the given ID that is owned by this tree (copying the lookup from
+// the base if necessary), which is safe to modify.
+func (t *Tree) mutableChildren(id node.ID) map[node.ID]node.Node {
+	if children := t.children[id]; children != nil {
+		return children
+	}
+	var children map[node.ID]node.Node
+	if t.base != nil {
+		if existing, ok := t.base.lookupChildren(id); ok {
+			children = make(map[node.ID]node.Node, len(existing)+1)
+			for k, v := range existing {
+				children[k] = v
 			}
-			ct.children[from][to] = v.Copy()
 		}
 	}
-	return ct
+	if children == nil {
+		children = make(map[node.ID]node.Node)
+	}
+	t.children[id] = children
+	return children
+}
+
+// forget drops all state for the given node ID from this tree.
+func (t *Tree) forget(id node.ID) {
+	if t.base != nil {
+		if _, exists := t.base.lookupNode(id); exists {
+			// mask the node from the base
+			t.nodes[id] = nil
+			t.children[id] = nil
+			delete(t.parent, id)
+			return
+		}
+	}
+	delete(t.nodes, id)
+	delete(t.children, id)
+	delete(t.parent, id)
 }
 
 // Roots is all of the nodes with no parents.
 func (t *Tree) Roots() node.Nodes {
 	var nodes = make([]node.Node, 0)
-	for _, n := range t.nodes {
-		if parent := t.parent[n.ID()]; parent == nil {
+	for _, n := range t.Nodes() {
+		if parent := t.lookupParent(n.ID()); parent == nil {
 			nodes = append(nodes, n)
 		}
 	}
@@ -66,27 +208,42 @@ func (t *Tree) Roots() node.Nodes {
 
 // HasNode indicates is the given node ID exists in the Tree.
 func (t *Tree) HasNode(id node.ID) bool {
-	if _, exists := t.nodes[id]; exists {
-		return true
-	}
-	return false
+	_, exists := t.lookupNode(id)
+	return exists
 }
 
 // Node returns a node object for the given ID.
 func (t *Tree) Node(id node.ID) node.Node {
-	return t.nodes[id]
+	n, _ := t.lookupNode(id)
+	return n
 }
 
 // Nodes returns all nodes in the Tree.
 func (t *Tree) Nodes() node.Nodes {
-	if len(t.nodes) == 0 {
+	if t.length == 0 {
 		return nil
 	}
-	nodes := make([]node.Node, len(t.nodes))
-	i := 0
-	for _, n := range t.nodes {
-		nodes[i] = n
-		i++
+	nodes := make([]node.Node, 0, t.length)
+
+	if t.base == nil {
+		for _, n := range t.nodes {
+			nodes = append(nodes, n)
+		}
+		return nodes
+	}
+
+	// the first entry found for an ID (from this tree towards the bottom-most base) is the effective entry
+	seen := make(map[node.ID]struct{}, t.length)
+	for c := t; c != nil; c = c.base {
+		for id, n := range c.nodes {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+		}
 	}
 
 	return nodes
@@ -94,17 +251,20 @@ func (t *Tree) Nodes() node.Nodes {
 
 // addNode adds the node to the Tree; returns an error on node ID collisions.
 func (t *Tree) addNode(n node.Node) error {
-	if _, exists := t.nodes[n.ID()]; exists {
+	if t.HasNode(n.ID()) {
 		return fmt.Errorf("node ID collision: %+v", n.ID())
 	}
 	t.nodes[n.ID()] = n
 	t.children[n.ID()] = make(map[node.ID]node.Node)
 	t.parent[n.ID()] = nil
+	t.length++
 	return nil
 }
 
 // Replace takes the given old node and replaces it with the given new one.
 func (t *Tree) Replace(old node.Node, new node.Node) error {
+	t.unshare()
+
 	if !t.HasNode(old.ID()) {
 		return fmt.Errorf("cannot replace node not in the Tree")
 	}
@@ -123,37 +283,43 @@ func (t *Tree) Replace(old node.Node, new node.Node) error {
 	}
 
 	// set the new node parent to the old node parent
-	t.parent[new.ID()] = t.parent[old.ID()]
+	oldParent := t.lookupParent(old.ID())
+	t.parent[new.ID()] = oldParent
 
-	for cid := range t.children[old.ID()] {
+	oldChildren, _ := t.lookupChildren(old.ID())
+	newChildren := t.mutableChildren(new.ID())
+	for cid := range oldChildren {
 		// replace the parent entry for each child
 		t.parent[cid] = new
 
 		// add child entries to the new node
-		t.children[new.ID()][cid] = t.nodes[cid]
+		newChildren[cid] = t.Node(cid)
 	}
 
 	// replace the child entry for the old parents node
-	delete(t.children[t.parent[old.ID()].ID()], old.ID())
-	t.children[t.parent[old.ID()].ID()][new.ID()] = new
-
-	// remove the old node (if not already overwritten)
-	if old.ID() != new.ID() {
-		delete(t.children, old.ID())
-		delete(t.nodes, old.ID())
-		delete(t.parent, old.ID())
+	if oldParent != nil {
+		parentChildren := t.mutableChildren(oldParent.ID())
+		delete(parentChildren, old.ID())
+		parentChildren[new.ID()] = new
 	}
 
+	// remove the old node
+	t.forget(old.ID())
+	t.length--
+
 	return nil
 }
 
 // AddRoot adds a node to the Tree (with no parent).
 func (t *Tree) AddRoot(n node.Node) error {
+	t.unshare()
 	return t.addNode(n)
 }
 
 // AddChild adds a node to the Tree under the given parent.
 func (t *Tree) AddChild(from, to node.Node) error {
+	t.unshare()
+
 	var (
 		fid = from.ID()
 		tid = to.ID()
@@ -164,7 +330,7 @@ func (t *Tree) AddChild(from, to node.Node) error {
 		return fmt.Errorf("should not add self edge")
 	}
 
-	if _, ok := t.nodes[fid]; !ok {
+	if !t.HasNode(fid) {
 		err = t.addNode(from)
 		if err != nil {
 			return err
@@ -172,7 +338,7 @@ func (t *Tree) AddChild(from, to node.Node) error {
 	} else {
 		t.nodes[fid] = from
 	}
-	if _, ok := t.nodes[tid]; !ok {
+	if !t.HasNode(tid) {
 		err = t.addNode(to)
 		if err != nil {
 			return err
@@ -181,19 +347,23 @@ func (t *Tree) AddChild(from, to node.Node) error {
 		t.nodes[tid] = to
 	}
 
-	t.children[fid][tid] = to
+	t.mutableChildren(fid)[tid] = to
 	t.parent[tid] = from
 	return nil
 }
 
 // RemoveNode deletes the node from the Tree and returns the removed node.
 func (t *Tree) RemoveNode(n node.Node) (node.Nodes, error) {
+	t.unshare()
+
 	removedNodes := make([]node.Node, 0)
 	nid := n.ID()
-	if _, ok := t.nodes[nid]; !ok {
+	existing, ok := t.lookupNode(nid)
+	if !ok {
 		return nil, fmt.Errorf("unable to remove node: %+v", nid)
 	}
-	for _, child := range t.children[nid] {
+	children, _ := t.lookupChildren(nid)
+	for _, child := range children {
 		subNodes, err := t.RemoveNode(child)
 		for _, sn := range subNodes {
 			removedNodes = append(removedNodes, sn)
@@ -203,32 +373,27 @@ func (t *Tree) RemoveNode(n node.Node) (node.Nodes, error) {
 		}
 	}
 
-	removedNodes = append(removedNodes, t.nodes[nid])
+	removedNodes = append(removedNodes, existing)
 
-	delete(t.children, nid)
-	if t.parent[nid] != nil {
-		delete(t.children[t.parent[nid].ID()], nid)
+	if parent := t.lookupParent(nid); parent != nil {
+		delete(t.mutableChildren(parent.ID()), nid)
 	}
-	delete(t.parent, nid)
-	delete(t.nodes, nid)
+	t.forget(nid)
+	t.length--
 	return removedNodes, nil
 }
 
 // Children returns all children of the given node.
 func (t *Tree) Children(n node.Node) node.Nodes {
-	nid := n.ID()
-	if _, ok := t.children[nid]; !ok {
+	children, ok := t.lookupChildren(n.ID())
+	if !ok {
 		return nil
 	}
 
-	if len(t.children) == 0 {
-		return nil
-	}
-
-	from := make([]node.Node, len(t.children[nid]))
+	from := make([]node.Node, len(children))
 	i := 0
-	for vid := range t.children[nid] {
-		from[i] = t.nodes[vid]
+	for vid := range children {
+		from[i] = t.Node(vid)
 		i++
 	}
 
@@ -237,12 +402,9 @@ func (t *Tree) Children(n node.Node) node.Nodes {
 
 // Parent returns the parent of the given node (or nil if it is a root)
 func (t *Tree) Parent(n node.Node) node.Node {
-	if parent, ok := t.parent[n.ID()]; ok {
-		return parent
-	}
-	return nil
+	return t.lookupParent(n.ID())
 }
 
 func (t *Tree) Length() int {
-	return len(t.nodes)
+	return t.length
 }
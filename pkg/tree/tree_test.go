@@ -2,8 +2,10 @@ package tree
 
 import (
 	"fmt"
-	"github.com/anchore/stereoscope/pkg/tree/node"
+	"sync"
 	"testing"
+
+	"github.com/anchore/stereoscope/pkg/tree/node"
 )
 
 type testNode struct {
@@ -294,3 +296,181 @@ func TestTree_Replace(t *testing.T) {
 		t.Fatalf("unexpected parent (node:5) %+v", tr.Parent(five).ID())
 	}
 }
+
+// treeStructure captures all nodes and parent relationships of the tree for comparison.
+func treeStructure(tr *Tree) map[node.ID]node.ID {
+	result := make(map[node.ID]node.ID)
+	for _, n := range tr.Nodes() {
+		var parentID node.ID
+		if parent := tr.Parent(n); parent != nil {
+			parentID = parent.ID()
+		}
+		result[n.ID()] = parentID
+		for _, child := range tr.Children(n) {
+			if tr.Parent(child).ID() != n.ID() {
+				panic(fmt.Sprintf("inconsistent parent for child=%v of node=%v", child.ID(), n.ID()))
+			}
+		}
+	}
+	return result
+}
+
+func assertStructure(t *testing.T, tr *Tree, expected map[node.ID]node.ID) {
+	t.Helper()
+	actual := treeStructure(tr)
+	if len(actual) != len(expected) || tr.Length() != len(expected) {
+		t.Fatalf("unexpected number of nodes: %d (length=%d) != %d", len(actual), tr.Length(), len(expected))
+	}
+	for id, parentID := range expected {
+		actualParentID, ok := actual[id]
+		if !ok {
+			t.Fatalf("missing node=%v", id)
+		}
+		if actualParentID != parentID {
+			t.Errorf("unexpected parent for node=%v: %q != %q", id, actualParentID, parentID)
+		}
+	}
+}
+
+func TestTree_Copy(t *testing.T) {
+	tr := NewTree()
+	zero, one, two, three := newTestNode(0), newTestNode(1), newTestNode(2), newTestNode(3)
+	for _, pair := range [][2]node.Node{{zero, one}, {zero, two}, {two, three}} {
+		if err := tr.AddChild(pair[0], pair[1]); err != nil {
+			t.Fatal("could not add node pair", err)
+		}
+	}
+
+	original := map[node.ID]node.ID{"0": "", "1": "0", "2": "0", "3": "2"}
+
+	ct := tr.Copy()
+	assertStructure(t, ct, original)
+
+	// changes to the copy are not visible in the original...
+	if _, err := ct.RemoveNode(two); err != nil {
+		t.Fatal("could not remove node", err)
+	}
+	four := newTestNode(4)
+	if err := ct.AddChild(one, four); err != nil {
+		t.Fatal("could not add node pair", err)
+	}
+	five := newTestNode(5)
+	if err := ct.Replace(one, five); err != nil {
+		t.Fatal("could not replace node", err)
+	}
+
+	copied := map[node.ID]node.ID{"0": "", "5": "0", "4": "5"}
+	assertStructure(t, ct, copied)
+	assertStructure(t, tr, original)
+
+	// ...and changes to the original are not visible in the copy
+	if err := tr.AddChild(three, four); err != nil {
+		t.Fatal("could not add node pair", err)
+	}
+	assertStructure(t, tr, map[node.ID]node.ID{"0": "", "1": "0", "2": "0", "3": "2", "4": "3"})
+	assertStructure(t, ct, copied)
+
+	// re-adding a removed node does not resurrect the removed children
+	if err := ct.AddChild(zero, two); err != nil {
+		t.Fatal("could not add node pair", err)
+	}
+	if children := ct.Children(two); len(children) != 0 {
+		t.Errorf("unexpected children for re-added node: %+v", children)
+	}
+}
+
+func TestTree_Copy_WhileWalking(t *testing.T) {
+	// copying only reads the tree, so copies may be made while the tree is walked (run with -race)
+	tr := NewTree()
+	root := newTestNode("root")
+	expected := map[node.ID]node.ID{"root": ""}
+	for idx := 0; idx < 100; idx++ {
+		if err := tr.AddChild(root, newTestNode(idx)); err != nil {
+			t.Fatal("could not add node", err)
+		}
+		expected[toId(idx)] = "root"
+	}
+	// the tree is layered over a snapshot with changes of its own
+	tr = tr.Copy()
+	if err := tr.AddChild(root, newTestNode("last")); err != nil {
+		t.Fatal("could not add node", err)
+	}
+	expected["last"] = "root"
+
+	var wg sync.WaitGroup
+	copies := make([]*Tree, 8)
+	for idx := range copies {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			visited := 0
+			err := NewDepthFirstWalker(tr, func(node.Node) error {
+				visited++
+				return nil
+			}).WalkAll()
+			if err != nil || visited != len(expected) {
+				t.Errorf("unexpected walk: visited=%d err=%+v", visited, err)
+			}
+		}()
+		go func(idx int) {
+			defer wg.Done()
+			ct := tr.Copy()
+			if err := ct.AddChild(root, newTestNode(fmt.Sprintf("copy-%d", idx))); err != nil {
+				t.Errorf("could not add node: %+v", err)
+			}
+			copies[idx] = ct
+		}(idx)
+	}
+	wg.Wait()
+
+	// changes to the original after the copies are not visible in the copies
+	if err := tr.AddChild(root, newTestNode("after")); err != nil {
+		t.Fatal("could not add node", err)
+	}
+	for idx, ct := range copies {
+		copied := map[node.ID]node.ID{toId(fmt.Sprintf("copy-%d", idx)): "root"}
+		for k, v := range expected {
+			copied[k] = v
+		}
+		assertStructure(t, ct, copied)
+	}
+	expected["after"] = "root"
+	assertStructure(t, tr, expected)
+}
+
+func TestTree_Copy_Deep(t *testing.T) {
+	// copy well beyond the max overlay depth, modifying every copy, and ensure all copies are still independent
+	tr := NewTree()
+	root := newTestNode("root")
+	if err := tr.AddRoot(root); err != nil {
+		t.Fatal("could not add root", err)
+	}
+
+	var trees []*Tree
+	var expected []map[node.ID]node.ID
+	current := map[node.ID]node.ID{"root": ""}
+	for idx := 0; idx < maxOverlayDepth*3; idx++ {
+		tr = tr.Copy()
+		if err := tr.AddChild(root, newTestNode(idx)); err != nil {
+			t.Fatal("could not add node", err)
+		}
+		next := map[node.ID]node.ID{toId(idx): "root"}
+		for k, v := range current {
+			next[k] = v
+		}
+		if idx > 0 && idx%2 == 0 {
+			// remove the node added by the previous copy
+			if _, err := tr.RemoveNode(newTestNode(idx - 1)); err != nil {
+				t.Fatal("could not remove node", err)
+			}
+			delete(next, toId(idx-1))
+		}
+		current = next
+		trees = append(trees, tr)
+		expected = append(expected, next)
+	}
+
+	for idx, tr := range trees {
+		assertStructure(t, tr, expected[idx])
+	}
+}